@@ -12,7 +12,10 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
-"""embed_data.bzl provides the go_embed_data rule for embedding data in go files"""
+"""embed_data.bzl provides the go_embed_data rule for embedding data in go files.
+
+Deprecated: use //go:embed or go_data from go_data.bzl instead.
+"""
 
 load(
     "@io_bazel_rules_go//go/private:context.bzl",  #TODO: This ought to be def
@@ -0,0 +1,113 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""generated_files_test.bzl provides the generated_files_test rule, which
+checks that generated files checked into the source tree are up to date."""
+
+load("@bazel_skylib//lib:shell.bzl", "shell")
+
+_SCRIPT_HEADER = """#!/usr/bin/env bash
+# Generated by @io_bazel_rules_go//extras:generated_files_test.bzl
+set -uo pipefail
+cd "${TEST_SRCDIR}/${TEST_WORKSPACE}"
+status=0
+
+# check compares a checked-in file with a freshly generated file.
+# Arguments are the checked-in file, the generated file (both relative to
+# the workspace runfiles directory), and the generated file's path relative to
+# bazel-bin, which is printed in the update command.
+check() {
+  if [[ ! -f "$1" ]]; then
+    echo >&2 "ERROR: $1 does not exist."
+  elif diff -u "$1" "$2" >&2; then
+    return
+  else
+    echo >&2 "ERROR: $1 is out of date."
+  fi
+  echo >&2 "To update it, run:"
+  echo >&2 "  bazel build %s && cp -f \\"\\$(bazel info bazel-bin)/$3\\" $1"
+  status=1
+}
+
+"""
+
+def _bin_relative_path(f):
+    # short_path is relative to bazel-bin for files in the main repository.
+    # Files in external repositories have short paths like "../repo/file",
+    # but they are in bazel-bin/external/repo.
+    if f.short_path.startswith("../"):
+        return "external/" + f.short_path[len("../"):]
+    return f.short_path
+
+def _label_str(label):
+    # Print labels in the main repository the way users write them.
+    s = str(label)
+    return s[1:] if s.startswith("@//") else s
+
+def _generated_files_test_impl(ctx):
+    generated_by_name = {}
+    for target in ctx.attr.generated:
+        for f in target.files.to_list():
+            if f.basename in generated_by_name:
+                fail("generated: more than one file named {}".format(f.basename))
+            generated_by_name[f.basename] = f
+
+    lines = [_SCRIPT_HEADER % " ".join([_label_str(t.label) for t in ctx.attr.generated])]
+    for src in ctx.files.srcs:
+        if src.basename not in generated_by_name:
+            fail("srcs: {} does not correspond to a file in generated".format(src.short_path))
+        gen = generated_by_name.pop(src.basename)
+        lines.append("check {} {} {}".format(
+            shell.quote(src.short_path),
+            shell.quote(gen.short_path),
+            shell.quote(_bin_relative_path(gen)),
+        ))
+    if not ctx.attr.allow_unmatched and generated_by_name:
+        fail("generated: {} have no counterpart in srcs. Set allow_unmatched = True to ignore them.".format(
+            ", ".join(sorted(generated_by_name.keys())),
+        ))
+    lines.append("exit $status")
+
+    script = ctx.actions.declare_file(ctx.label.name + ".bash")
+    ctx.actions.write(script, "\n".join(lines) + "\n", is_executable = True)
+    runfiles = ctx.runfiles(files = ctx.files.srcs + ctx.files.generated)
+    return [DefaultInfo(
+        executable = script,
+        runfiles = runfiles,
+    )]
+
+generated_files_test = rule(
+    implementation = _generated_files_test_impl,
+    attrs = {
+        "srcs": attr.label_list(
+            allow_files = True,
+            mandatory = True,
+            doc = "Generated files that are checked into the source tree.",
+        ),
+        "generated": attr.label_list(
+            allow_files = True,
+            mandatory = True,
+            doc = """Rules that generate the files in srcs. Each file in srcs
+            is compared with the generated file that has the same base name.""",
+        ),
+        "allow_unmatched": attr.bool(
+            doc = """If False (the default), every generated file must have a
+            counterpart in srcs.""",
+        ),
+    },
+    test = True,
+    doc = """Tests that generated files checked into the source tree are
+    identical to files generated by Bazel rules. When they differ, the test
+    prints a diff and a command to update the checked-in files.""",
+)
@@ -0,0 +1,71 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""go_binary_smoke_test.bzl provides the go_binary_smoke_test macro, which
+checks that a binary starts, exits with the expected code, and prints the
+expected output."""
+
+load("@bazel_skylib//lib:shell.bzl", "shell")
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+_SMOKETEST_LIBRARY = "@io_bazel_rules_go//go/tools/smoketest:go_default_library"
+
+def go_binary_smoke_test(
+        name,
+        binary,
+        args = [],
+        env = {},
+        exit_code = 0,
+        output = None,
+        timeout_secs = 10,
+        **kwargs):
+    """Declares a go_test that runs binary and checks how it exits.
+
+    Args:
+        name: the name of the test.
+        binary: the label of an executable target to run.
+        args: arguments passed to binary.
+        env: environment variables added to binary's environment.
+        exit_code: the exit code binary is expected to return.
+        output: a regular expression (RE2 syntax) that must match the
+            combined stdout and stderr of binary. If None, output is not
+            checked.
+        timeout_secs: the number of seconds binary has to exit. It is
+            killed and the test fails if it runs longer.
+        **kwargs: other attributes passed to go_test, like tags or size.
+    """
+    test_args = [
+        "-binary=$(rootpath {})".format(binary),
+        "-exit_code={}".format(exit_code),
+        "-timeout={}s".format(timeout_secs),
+    ]
+
+    # Test arguments are tokenized like a shell command line, so quote
+    # anything that may contain spaces.
+    if output != None:
+        test_args.append(shell.quote("-output=" + output))
+    test_args.extend([shell.quote("-env={}={}".format(k, v)) for k, v in sorted(env.items())])
+    test_args.append("--")
+    test_args.extend([shell.quote(arg) for arg in args])
+
+    kwargs.setdefault("size", "small")
+    go_test(
+        name = name,
+        embed = [_SMOKETEST_LIBRARY],
+        data = kwargs.pop("data", []) + [binary],
+        args = test_args,
+        # Run from the workspace root so the binary's rootpath is valid.
+        rundir = ".",
+        **kwargs
+    )
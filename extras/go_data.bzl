@@ -0,0 +1,140 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+"""go_data.bzl provides the go_data rule, which generates a .go file holding
+the contents of files and string values. It replaces go_embed_data."""
+
+load(
+    "@io_bazel_rules_go//go/private:context.bzl",
+    "go_context",
+)
+load(
+    "@io_bazel_rules_go//go/private:rules/rule.bzl",
+    "go_rule",
+)
+
+def _file_key(ctx, f):
+    if ctx.attr.key == "basename":
+        return f.basename
+    path = f.short_path
+    if path.startswith("../"):
+        path = "external/" + path[len("../"):]
+    if ctx.attr.key == "package":
+        prefix = ctx.label.package + "/" if ctx.label.package else ""
+        if ctx.label.workspace_root:
+            prefix = ctx.label.workspace_root + "/" + prefix
+        if not path.startswith(prefix):
+            fail("{}: {} is not in package {}".format(ctx.label, f.short_path, ctx.label.package))
+        path = path[len(prefix):]
+    return path
+
+def _go_data_impl(ctx):
+    go = go_context(ctx)
+    if ctx.attr.package:
+        package = ctx.attr.package
+    else:
+        _, _, package = ctx.label.package.rpartition("/")
+        if package == "":
+            fail("%s: must provide package attribute for go_data rules in the repository root directory" % ctx.label)
+
+    entries = [(_file_key(ctx, f), f) for f in ctx.files.srcs]
+    for key, value in ctx.attr.values.items():
+        # Values are written to files, since arguments can't contain newlines.
+        f = go.declare_file(go, path = "values/" + str(len(entries)))
+        ctx.actions.write(f, value)
+        entries.append((key, f))
+    if ctx.attr.single and len(entries) != 1:
+        fail("%s: single requires exactly one file or value; got %d" % (ctx.label, len(entries)))
+    for key, _ in entries:
+        if "=" in key:
+            fail("%s: key %s may not contain '='" % (ctx.label, key))
+
+    out = go.declare_file(go, ext = ".go")
+    args = go.builder_args(go, "gendata")
+    args.add("-label", str(ctx.label))
+    args.add("-package", package)
+    args.add("-var", ctx.attr.var)
+    args.add("-type", ctx.attr.type)
+    if ctx.attr.compression != "none":
+        args.add("-compression", ctx.attr.compression)
+    if ctx.attr.single:
+        args.add("-single")
+    inputs = [f for _, f in entries]
+    if ctx.file.template:
+        args.add("-template", ctx.file.template)
+        inputs.append(ctx.file.template)
+    args.add_all(["{}={}".format(key, f.path) for key, f in entries], before_each = "-file")
+    args.add("-o", out)
+    ctx.actions.run(
+        inputs = inputs,
+        outputs = [out],
+        executable = go.toolchain._builder,
+        arguments = [args],
+        env = go.env,
+        mnemonic = "GoData",
+    )
+
+    library = go.new_library(go, srcs = [out])
+    source = go.library_to_source(go, {}, library, False)
+    return [
+        DefaultInfo(files = depset([out])),
+        library,
+        source,
+    ]
+
+go_data = go_rule(
+    implementation = _go_data_impl,
+    attrs = {
+        "srcs": attr.label_list(
+            allow_files = True,
+            doc = "Files to embed. They may be generated.",
+        ),
+        "values": attr.string_dict(
+            doc = "Strings to embed, by key.",
+        ),
+        "package": attr.string(
+            doc = """Go package name for the generated file. Defaults to the
+            last component of the Bazel package name.""",
+        ),
+        "var": attr.string(
+            default = "Data",
+            doc = "Name of the variable holding the data.",
+        ),
+        "key": attr.string(
+            default = "path",
+            values = ["path", "package", "basename"],
+            doc = """How files are keyed: by path relative to the repository
+            root, by path relative to this package, or by base name.""",
+        ),
+        "single": attr.bool(
+            doc = """If true, var holds the contents of the only file or value
+            instead of a map.""",
+        ),
+        "type": attr.string(
+            default = "bytes",
+            values = ["bytes", "string"],
+            doc = "Whether contents are stored as []byte or string.",
+        ),
+        "compression": attr.string(
+            default = "none",
+            values = ["none", "gzip"],
+            doc = "How contents are compressed.",
+        ),
+        "template": attr.label(
+            allow_single_file = True,
+            doc = """A text/template file the .go file is generated from,
+            instead of the default. See go/extras.rst#go_data.""",
+        ),
+    },
+)
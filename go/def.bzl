@@ -30,6 +30,8 @@ load(
     "@io_bazel_rules_go//go/private:providers.bzl",
     _GoArchive = "GoArchive",
     _GoArchiveData = "GoArchiveData",
+    _GoBuildTagsInfo = "GoBuildTagsInfo",
+    _GoNogoInputsInfo = "GoNogoInputsInfo",
     _GoLibrary = "GoLibrary",
     _GoPath = "GoPath",
     _GoSDK = "GoSDK",
@@ -46,14 +48,22 @@ load(
 )
 load(
     "@io_bazel_rules_go//go/private:rules/wrappers.bzl",
+    _go_benchmark_macro = "go_benchmark_macro",
     _go_binary_macro = "go_binary_macro",
+    _go_c_archive_macro = "go_c_archive_macro",
+    _go_fuzz_test_macro = "go_fuzz_test_macro",
     _go_library_macro = "go_library_macro",
+    _go_shared_library_macro = "go_shared_library_macro",
     _go_test_macro = "go_test_macro",
 )
 load(
     "@io_bazel_rules_go//go/private:rules/source.bzl",
     _go_source = "go_source",
 )
+load(
+    "@io_bazel_rules_go//go/private:rules/symabis.bzl",
+    _go_symabis = "go_symabis",
+)
 load(
     "@io_bazel_rules_go//extras:embed_data.bzl",
     _go_embed_data = "go_embed_data",
@@ -62,6 +72,26 @@ load(
     "@io_bazel_rules_go//go/private:tools/path.bzl",
     _go_path = "go_path",
 )
+load(
+    "@io_bazel_rules_go//go/private:tools/dep_graph.bzl",
+    _go_dep_graph = "go_dep_graph",
+)
+load(
+    "@io_bazel_rules_go//go/private:tools/pprof.bzl",
+    _go_pprof = "go_pprof",
+)
+load(
+    "@io_bazel_rules_go//go/private:tools/fix_imports.bzl",
+    _go_fix_imports = "go_fix_imports",
+)
+load(
+    "@io_bazel_rules_go//go/private:tools/source_roots.bzl",
+    _go_source_roots = "go_source_roots",
+)
+load(
+    "@io_bazel_rules_go//go/private:tools/binary_size_test.bzl",
+    _go_binary_size_test = "go_binary_size_test",
+)
 load(
     "@io_bazel_rules_go//go/private:rules/rule.bzl",
     _go_rule = "go_rule",
@@ -70,10 +100,35 @@ load(
     "@io_bazel_rules_go//go/private:rules/library.bzl",
     _go_tool_library = "go_tool_library",
 )
+load(
+    "@io_bazel_rules_go//go/private:rules/module.bzl",
+    _go_module = "go_module",
+    _go_modules = "go_modules",
+)
+load(
+    "@io_bazel_rules_go//go/private:rules/multiplatform.bzl",
+    _go_multiplatform_binary = "go_multiplatform_binary",
+)
 load(
     "@io_bazel_rules_go//go/private:rules/nogo.bzl",
     _nogo = "nogo_wrapper",
 )
+load(
+    "@io_bazel_rules_go//go/private:rules/nogo_test.bzl",
+    _nogo_test = "nogo_test",
+)
+load(
+    "@io_bazel_rules_go//go/private:rules/settings.bzl",
+    _go_custom_settings = "go_custom_settings",
+)
+load(
+    "@io_bazel_rules_go//go/private:rules/transition.bzl",
+    _go_reset_target = "go_reset_target",
+)
+load(
+    "@io_bazel_rules_go//go/private:rules/xcframework.bzl",
+    _go_xcframework = "go_xcframework",
+)
 
 # TOOLS_NOGO is a list of all analysis passes in
 # golang.org/x/tools/go/analysis/passes.
@@ -130,6 +185,9 @@ go_tool_library = _go_tool_library
 go_toolchain = _go_toolchain
 nogo = _nogo
 
+# See go/nogo.rst#nogo_test for full documentation.
+nogo_test = _nogo_test
+
 # See go/providers.rst#GoLibrary for full documentation.
 GoLibrary = _GoLibrary
 
@@ -145,6 +203,12 @@ GoArchive = _GoArchive
 # See go/providers.rst#GoArchiveData for full documentation.
 GoArchiveData = _GoArchiveData
 
+# See go/providers.rst#GoBuildTagsInfo for full documentation.
+GoBuildTagsInfo = _GoBuildTagsInfo
+
+# See go/providers.rst#GoNogoInputsInfo for full documentation.
+GoNogoInputsInfo = _GoNogoInputsInfo
+
 # See go/providers.rst#GoSDK for full documentation.
 GoSDK = _GoSDK
 
@@ -154,18 +218,66 @@ go_library = _go_library_macro
 # See go/core.rst#go_binary for full documentation.
 go_binary = _go_binary_macro
 
+# See go/core.rst#go_shared_library for full documentation.
+go_shared_library = _go_shared_library_macro
+
+# See go/core.rst#go_c_archive for full documentation.
+go_c_archive = _go_c_archive_macro
+
 # See go/core.rst#go_test for full documentation.
 go_test = _go_test_macro
 
+# See go/core.rst#go_multiplatform_binary for full documentation.
+go_multiplatform_binary = _go_multiplatform_binary
+
+# See go/core.rst#go_xcframework for full documentation.
+go_xcframework = _go_xcframework
+
+# See go/core.rst#go_benchmark for full documentation.
+go_benchmark = _go_benchmark_macro
+
+# See go/core.rst#go_fuzz_test for full documentation.
+go_fuzz_test = _go_fuzz_test_macro
+
 # See go/core.rst#go_test for full documentation.
 go_source = _go_source
 
+# See go/core.rst#go_symabis for full documentation.
+go_symabis = _go_symabis
+
 # See go/core.rst#go_rule for full documentation.
 go_rule = _go_rule
 
 # See go/core.rst#go_path for full documentation.
 go_path = _go_path
 
+# See go/core.rst#go_dep_graph for full documentation.
+go_dep_graph = _go_dep_graph
+
+# See go/core.rst#go_pprof for full documentation.
+go_pprof = _go_pprof
+
+# See go/core.rst#go_fix_imports for full documentation.
+go_fix_imports = _go_fix_imports
+
+# See go/core.rst#go_source_roots for full documentation.
+go_source_roots = _go_source_roots
+
+# See go/core.rst#go_binary_size_test for full documentation.
+go_binary_size_test = _go_binary_size_test
+
+# See go/modes.rst#custom-settings for full documentation.
+go_custom_settings = _go_custom_settings
+
+# See go/modes.rst#resetting-go-settings for full documentation.
+go_reset_target = _go_reset_target
+
+# See go/core.rst#go_module for full documentation.
+go_module = _go_module
+
+# See go/core.rst#go_modules for full documentation.
+go_modules = _go_modules
+
 def go_vet_test(*args, **kwargs):
     fail("The go_vet_test rule has been removed. Please migrate to nogo instead, which supports vet tests.")
 
@@ -22,12 +22,29 @@ load(
     "@io_bazel_rules_go//go/private:repositories.bzl",
     _go_rules_dependencies = "go_rules_dependencies",
 )
+load(
+    "@io_bazel_rules_go//go/private:android.bzl",
+    _go_android_ndk_toolchain = "go_android_ndk_toolchain",
+)
+load(
+    "@io_bazel_rules_go//go/private:musl.bzl",
+    _go_musl_toolchain = "go_musl_toolchain",
+)
+load(
+    "@io_bazel_rules_go//go/private:sysroot.bzl",
+    _go_sysroot_toolchain = "go_sysroot_toolchain",
+)
+load(
+    "@io_bazel_rules_go//go/private:wasm.bzl",
+    _go_download_wasmtime = "go_download_wasmtime",
+)
 load(
     "@io_bazel_rules_go//go/private:sdk.bzl",
     _go_download_sdk = "go_download_sdk",
     _go_host_sdk = "go_host_sdk",
     _go_local_sdk = "go_local_sdk",
     _go_register_toolchains = "go_register_toolchains",
+    _go_source_sdk = "go_source_sdk",
     _go_wrap_sdk = "go_wrap_sdk",
 )
 
@@ -36,4 +53,9 @@ go_register_toolchains = _go_register_toolchains
 go_download_sdk = _go_download_sdk
 go_host_sdk = _go_host_sdk
 go_local_sdk = _go_local_sdk
+go_source_sdk = _go_source_sdk
 go_wrap_sdk = _go_wrap_sdk
+go_musl_toolchain = _go_musl_toolchain
+go_sysroot_toolchain = _go_sysroot_toolchain
+go_download_wasmtime = _go_download_wasmtime
+go_android_ndk_toolchain = _go_android_ndk_toolchain
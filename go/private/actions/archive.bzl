@@ -36,8 +36,13 @@ load(
 )
 load(
     "@io_bazel_rules_go//go/private:actions/compilepkg.bzl",
+    "emit_cgo",
     "emit_compilepkg",
 )
+load(
+    "@io_bazel_rules_go//go/private:actions/nogo.bzl",
+    "emit_nogo",
+)
 
 def emit_archive(go, source = None):
     """See go/toolchains.rst#archive for full documentation."""
@@ -55,13 +60,31 @@ def emit_archive(go, source = None):
     elif testfilter == "only":
         pre_ext = ".external"
     out_lib = go.declare_file(go, ext = pre_ext + ".a")
+
+    # Packages that import this one are compiled and type checked against
+    # export data extracted from the archive. It's much smaller than the
+    # archive, and it doesn't change when only function bodies do, so
+    # dependent actions are less likely to rerun.
+    out_export_data = go.declare_file(go, ext = pre_ext + ".export")
     if go.nogo:
         # TODO(#1847): write nogo data into a new section in the .a file instead
         # of writing a separate file.
         out_export = go.declare_file(go, ext = pre_ext + ".x")
     else:
         out_export = None
+    if go.nogo and go._nogo_fix:
+        out_nogo_fix = go.declare_file(go, ext = pre_ext + ".nogo.patch")
+    else:
+        out_nogo_fix = None
+    if go.nogo and go._nogo_sarif:
+        out_nogo_sarif = go.declare_file(go, ext = pre_ext + ".nogo.sarif")
+    else:
+        out_nogo_sarif = None
     out_cgo_export_h = None  # set if cgo used in c-shared or c-archive mode
+    if go._action_metadata:
+        out_metadata = go.declare_file(go, ext = pre_ext + ".meta.json")
+    else:
+        out_metadata = None
 
     direct = [get_archive(dep) for dep in source.deps]
     runfiles = source.runfiles
@@ -74,6 +97,26 @@ def emit_archive(go, source = None):
     importmap = "main" if source.library.is_main else source.library.importmap
     importpath, _ = effective_importpath_pkgpath(source.library)
 
+    # nogo usually runs in its own action, using the sources the compile
+    # action listed in the export data file before instrumenting them for
+    # coverage. When coverage and cgo are both enabled, files are instrumented
+    # before cgo processes them, so nogo runs in the compile action instead.
+    nogo_in_compile = (go.nogo and source.cgo and not go.mode.pure and
+                       source.cover and go.coverdata)
+    nogo_separate = go.nogo and not nogo_in_compile
+    if nogo_separate:
+        out_nogo_checked = go.declare_file(go, ext = pre_ext + ".nogo")
+    else:
+        # The compile action fails if nogo reports problems.
+        out_nogo_checked = out_export
+    compile_nogo_outputs = {
+        "out_export": out_export if nogo_in_compile else None,
+        "out_nogo_fix": out_nogo_fix if nogo_in_compile else None,
+        "out_nogo_sarif": out_nogo_sarif if nogo_in_compile else None,
+        "nogo_srcs": nogo_separate,
+    }
+
+    cgo_outputs = None
     if source.cgo and not go.mode.pure:
         # TODO(jayconrod): do we need to do full Bourne tokenization here?
         cppopts = [f for fs in source.cppopts for f in fs.split(" ")]
@@ -89,21 +132,50 @@ def emit_archive(go, source = None):
             cxxopts = cxxopts,
             clinkopts = clinkopts,
         )
-        if go.mode.link in (LINKMODE_C_SHARED, LINKMODE_C_ARCHIVE):
-            out_cgo_export_h = go.declare_file(go, path = "_cgo_install.h")
         cgo_deps = cgo.deps
         runfiles = runfiles.merge(cgo.runfiles)
+        if source.cover and go.coverdata:
+            # Files must be instrumented for coverage before cgo processes
+            # them, so everything is done in the compile action.
+            cgo_outputs = None
+            sources = split.go + split.c + split.asm + split.cxx + split.objc + split.headers
+            if go.mode.link in (LINKMODE_C_SHARED, LINKMODE_C_ARCHIVE):
+                out_cgo_export_h = go.declare_file(go, path = "_cgo_install.h")
+        else:
+            cgo_outputs = emit_cgo(
+                go,
+                sources = split.go + split.headers,
+                # Assembly files that aren't Go assembly are compiled with
+                # the C toolchain. GoCompilePkg assembles the rest.
+                csrcs = split.c + split.cxx + split.objc + split.asm,
+                importmap = importmap,
+                cgo = cgo,
+                cxxpch = source.cxxpch,
+                testfilter = testfilter,
+                path_prefix = "cgo" + pre_ext,
+            )
+            sources = split.go + split.asm
+            if split.asm:
+                # Headers may be included by assembly files.
+                sources += split.headers
+            if go.mode.link in (LINKMODE_C_SHARED, LINKMODE_C_ARCHIVE):
+                out_cgo_export_h = cgo_outputs.export_h
         emit_compilepkg(
             go,
-            sources = split.go + split.c + split.asm + split.cxx + split.objc + split.headers,
+            sources = sources,
             cover = source.cover,
+            embedsrcs = source.embedsrcs,
+            symabis = source.symabis,
             importpath = importpath,
             importmap = importmap,
             archives = direct,
             out_lib = out_lib,
-            out_export = out_export,
-            out_cgo_export_h = out_cgo_export_h,
+            out_export_data = out_export_data,
+            # emit_cgo writes the header if it was called.
+            out_cgo_export_h = None if cgo_outputs else out_cgo_export_h,
+            out_metadata = out_metadata,
             gc_goopts = source.gc_goopts,
+            werror = source.werror,
             cgo = True,
             cgo_inputs = cgo.inputs,
             cppopts = cgo.cppopts,
@@ -112,7 +184,10 @@ def emit_archive(go, source = None):
             objcopts = cgo.objcopts,
             objcxxopts = cgo.objcxxopts,
             clinkopts = cgo.clinkopts,
+            cgo_trace = cgo.trace,
+            cgo_outputs = cgo_outputs,
             testfilter = testfilter,
+            **compile_nogo_outputs
         )
     else:
         cgo_deps = depset()
@@ -120,14 +195,33 @@ def emit_archive(go, source = None):
             go,
             sources = split.go + split.c + split.asm + split.cxx + split.objc + split.headers,
             cover = source.cover,
+            embedsrcs = source.embedsrcs,
+            symabis = source.symabis,
             importpath = importpath,
             importmap = importmap,
             archives = direct,
             out_lib = out_lib,
-            out_export = out_export,
+            out_export_data = out_export_data,
+            out_metadata = out_metadata,
             gc_goopts = source.gc_goopts,
+            werror = source.werror,
             cgo = False,
             testfilter = testfilter,
+            **compile_nogo_outputs
+        )
+
+    if nogo_separate:
+        emit_nogo(
+            go,
+            sources = split.go,
+            cgo_outputs = cgo_outputs,
+            importmap = importmap,
+            archives = direct,
+            srcs_list = out_export_data,
+            out_facts = out_export,
+            out_checked = out_nogo_checked,
+            out_nogo_fix = out_nogo_fix,
+            out_nogo_sarif = out_nogo_sarif,
         )
 
     data = GoArchiveData(
@@ -139,6 +233,8 @@ def emit_archive(go, source = None):
         pathtype = source.library.pathtype,
         file = out_lib,
         export_file = out_export,
+        export_data = out_export_data,
+        nogo_checked = out_nogo_checked,
         srcs = as_tuple(source.srcs),
         orig_srcs = as_tuple(source.orig_srcs),
         data_files = as_tuple(data_files),
@@ -159,6 +255,18 @@ def emit_archive(go, source = None):
         x_defs = x_defs,
         cgo_deps = depset(transitive = [cgo_deps] + [a.cgo_deps for a in direct]),
         cgo_exports = cgo_exports,
+        action_metadata = depset(
+            direct = [out_metadata] if out_metadata else [],
+            transitive = [a.action_metadata for a in direct],
+        ),
+        nogo_fixes = depset(
+            direct = [out_nogo_fix] if out_nogo_fix else [],
+            transitive = [a.nogo_fixes for a in direct],
+        ),
+        nogo_sarif_reports = depset(
+            direct = [out_nogo_sarif] if out_nogo_sarif else [],
+            transitive = [a.nogo_sarif_reports for a in direct],
+        ),
         runfiles = runfiles,
         mode = go.mode,
     )
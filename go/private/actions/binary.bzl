@@ -32,7 +32,9 @@ def emit_binary(
         gc_linkopts = [],
         version_file = None,
         info_file = None,
-        executable = None):
+        executable = None,
+        out_metadata = None,
+        out_symbol_map = None):
     """See go/toolchains.rst#binary for full documentation."""
 
     if name == "" and executable == None:
@@ -57,6 +59,8 @@ def emit_binary(
         gc_linkopts = gc_linkopts,
         version_file = version_file,
         info_file = info_file,
+        out_metadata = out_metadata,
+        out_symbol_map = out_symbol_map,
     )
     cgo_dynamic_deps = [
         d
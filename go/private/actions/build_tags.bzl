@@ -0,0 +1,60 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:providers.bzl",
+    "GoBuildTagsInfo",
+)
+
+def emit_build_tags(go, source, testfilter = None):
+    """Declares an action that reports which of source's files are selected
+    by build constraints, and returns a GoBuildTagsInfo describing it.
+
+    The action only runs when the go_build_tags output group or the report
+    file is requested, so it doesn't slow down normal builds. testfilter
+    overrides the test filter of source's library.
+    """
+    tags = {go.mode.goos: None, go.mode.goarch: None, "gc": None}
+    if not go.mode.pure:
+        tags["cgo"] = None
+    for tag in go.tags:
+        if tag:
+            tags[tag] = None
+
+    report = go.declare_file(go, ext = ".build_tags.json")
+    args = go.builder_args(go, "buildtags")
+    args.add("-label", str(source.library.label))
+    args.add("-importpath", source.library.importpath)
+    testfilter = testfilter or source.library.testfilter
+    if testfilter:
+        args.add("-testfilter", testfilter)
+    args.add_all(source.srcs, before_each = "-src")
+    args.add("-o", report)
+    go.actions.run(
+        inputs = source.srcs,
+        outputs = [report],
+        mnemonic = "GoBuildTags",
+        executable = go.toolchain._builder,
+        arguments = [args],
+        env = go.env,
+    )
+
+    return GoBuildTagsInfo(
+        tags = sorted(tags.keys()),
+        goos = go.mode.goos,
+        goarch = go.mode.goarch,
+        cgo = not go.mode.pure,
+        srcs = source.srcs,
+        report = report,
+    )
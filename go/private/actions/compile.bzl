@@ -23,7 +23,7 @@ def _archive(v):
     return "{}={}={}={}".format(
         ":".join(importpaths),
         v.data.importmap,
-        v.data.file.path,
+        (v.data.export_data or v.data.file).path,
         v.data.export_file.path if v.data.export_file else "",
     )
 
@@ -45,7 +45,7 @@ def emit_compile(
         fail("out_lib is a required parameter")
 
     inputs = (sources + [go.package_list] +
-              [archive.data.file for archive in archives] +
+              [archive.data.export_data or archive.data.file for archive in archives] +
               go.sdk.tools + go.sdk.headers + go.stdlib.libs)
     outputs = [out_lib]
 
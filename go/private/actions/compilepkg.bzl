@@ -27,14 +27,22 @@ def _archive(v):
     return "{}={}={}={}".format(
         ":".join(importpaths),
         v.data.importmap,
-        v.data.file.path,
+        (v.data.export_data or v.data.file).path,
         v.data.export_file.path if v.data.export_file else "",
     )
 
+def _embedroot(f):
+    # //go:embed patterns are relative to the package directory. Source and
+    # generated files are in different trees, so the builder looks up the
+    # package directory in each root.
+    return f.root.path or "."
+
 def emit_compilepkg(
         go,
         sources = None,
         cover = None,
+        embedsrcs = [],
+        symabis = [],
         importpath = "",
         importmap = "",
         archives = [],
@@ -46,10 +54,18 @@ def emit_compilepkg(
         objcopts = [],
         objcxxopts = [],
         clinkopts = [],
+        cgo_trace = [],
+        cgo_outputs = None,
         out_lib = None,
+        out_export_data = None,
         out_export = None,
+        out_nogo_fix = None,
+        out_nogo_sarif = None,
+        nogo_srcs = False,
         out_cgo_export_h = None,
+        out_metadata = None,
         gc_goopts = [],
+        werror = [],
         testfilter = None):  # TODO: remove when test action compiles packages
     """Compiles a complete Go package."""
     if sources == None:
@@ -57,16 +73,25 @@ def emit_compilepkg(
     if out_lib == None:
         fail("out_lib is a required parameter")
 
-    inputs = (sources + [go.package_list] +
-              [archive.data.file for archive in archives] +
+    inputs = (sources + embedsrcs + symabis + [go.package_list] +
+              [archive.data.export_data or archive.data.file for archive in archives] +
               go.sdk.tools + go.sdk.headers + go.stdlib.libs)
     outputs = [out_lib]
     env = go.env
 
     args = go.builder_args(go, "compilepkg")
     args.add_all(sources, before_each = "-src")
+    if embedsrcs:
+        args.add_all(embedsrcs, before_each = "-embedsrc", expand_directories = False)
+        args.add_all(
+            sources + embedsrcs,
+            map_each = _embedroot,
+            before_each = "-embedroot",
+            uniquify = True,
+            expand_directories = False,
+        )
     if cover and go.coverdata:
-        inputs.append(go.coverdata.data.file)
+        inputs.append(go.coverdata.data.export_data or go.coverdata.data.file)
         args.add("-arc", _archive(go.coverdata))
         if go.mode.race:
             args.add("-cover_mode", "atomic")
@@ -74,6 +99,7 @@ def emit_compilepkg(
             args.add("-cover_mode", "set")
         args.add_all(cover, before_each = "-cover")
     args.add_all(archives, before_each = "-arc", map_each = _archive)
+    args.add_all(symabis, before_each = "-symabis")
     if importpath:
         args.add("-importpath", importpath)
     if importmap:
@@ -81,17 +107,42 @@ def emit_compilepkg(
     args.add("-package_list", go.package_list)
 
     args.add("-o", out_lib)
-    if go.nogo:
+    if out_export_data:
+        args.add("-export_data", out_export_data)
+        outputs.append(out_export_data)
+    if out_export:
+        # nogo runs in the compile action only when it can't run separately.
+        # See emit_archive.
         args.add("-nogo", go.nogo)
         args.add("-x", out_export)
         inputs.append(go.nogo)
         inputs.extend([archive.data.export_file for archive in archives if archive.data.export_file])
+        inputs.extend([archive.data.nogo_checked for archive in archives if archive.data.nogo_checked])
         outputs.append(out_export)
+        if out_nogo_fix:
+            args.add("-nogo_fix", out_nogo_fix)
+            outputs.append(out_nogo_fix)
+        if out_nogo_sarif:
+            args.add("-nogo_sarif", out_nogo_sarif)
+            outputs.append(out_nogo_sarif)
+    if nogo_srcs:
+        # The sources are listed in the export data file.
+        args.add("-nogo_srcs")
     if out_cgo_export_h:
         args.add("-cgoexport", out_cgo_export_h)
         outputs.append(out_cgo_export_h)
+    if out_metadata:
+        args.add("-metadata", out_metadata)
+        outputs.append(out_metadata)
     if testfilter:
         args.add("-testfilter", testfilter)
+    if go.mode.trimpath_prefix:
+        args.add("-trimpath_prefix", go.mode.trimpath_prefix)
+    args.add_all(werror, before_each = "-werror")
+    if go._werror_policy:
+        args.add("-werror_policy", go._werror_policy)
+        args.add("-label", str(go._ctx.label))
+        inputs.append(go._werror_policy)
 
     gc_flags = [
         go._ctx.expand_make_variables("gc_goopts", f, {})
@@ -104,14 +155,38 @@ def emit_compilepkg(
         gc_flags.append("-msan")
     if go.mode.debug:
         gc_flags.extend(["-N", "-l"])
+    if go._fuzz and testfilter in ("exclude", "only") and _fuzz_instrumented(go.mode):
+        # Instrument the packages a go_test compiles, so the fuzzer can tell
+        # which inputs reach new code. Instrumented code only links with the
+        # testing package, so libraries built for other binaries are left
+        # alone.
+        gc_flags.append("-d=libfuzzer")
     gc_flags.extend(go.toolchain.flags.compile)
-    gc_flags.extend(link_mode_args(go.mode))
-    asm_flags.extend(link_mode_args(go.mode))
+    link_args = link_mode_args(go.mode)
+    gc_flags.extend(link_args)
+    asm_flags.extend(link_args)
+
+    # The compiler refuses to use its concurrent backend with some flags, so
+    # -c is left out in those modes.
+    if (go._compiler_concurrency > 1 and
+        not go.mode.race and
+        not go.mode.debug and
+        "-shared" not in link_args and
+        "-dynlink" not in link_args):
+        gc_flags.append("-c={}".format(go._compiler_concurrency))
     args.add("-gcflags", _quote_opts(gc_flags))
     args.add("-asmflags", _quote_opts(asm_flags))
 
     env = go.env
-    if cgo:
+    if cgo_outputs:
+        # cgo was run and C sources were compiled by emit_cgo.
+        inputs.extend([cgo_outputs.gen_dir, cgo_outputs.obj_dir, cgo_outputs.imports])
+        inputs.extend(cgo_outputs.objs)
+        args.add("-cgo_gendir", cgo_outputs.gen_dir.path)
+        args.add("-cgo_objdir", cgo_outputs.obj_dir.path)
+        args.add("-cgo_imports", cgo_outputs.imports)
+        args.add_all(cgo_outputs.objs, before_each = "-cobj")
+    elif cgo:
         inputs.extend(cgo_inputs.to_list())  # OPT: don't expand depset
         inputs.extend(go.crosstool)
         env["CC"] = go.cgo_tools.c_compiler_path
@@ -127,6 +202,9 @@ def emit_compilepkg(
             args.add("-objcxxflags", _quote_opts(objcxxopts))
         if clinkopts:
             args.add("-ldflags", _quote_opts(clinkopts))
+        args.add_all(cgo_trace, before_each = "-cgo_trace")
+        if go._cgo_concurrency > 1:
+            args.add("-cgo_concurrency", str(go._cgo_concurrency))
 
     go.actions.run(
         inputs = inputs,
@@ -137,5 +215,175 @@ def emit_compilepkg(
         env = go.env,
     )
 
+def emit_cgo(
+        go,
+        sources = [],
+        csrcs = [],
+        importmap = "",
+        cgo = None,
+        cxxpch = None,
+        testfilter = None,
+        path_prefix = "cgo"):
+    """Runs cgo and compiles C sources for a package in separate actions.
+
+    GoCgoGen runs cgo on the .go files that import "C". Each C, C++, and
+    Objective-C file in csrcs is compiled by its own GoCompileC action, as is
+    each assembly file that isn't Go assembly.
+    GoCgoLink compiles the C files generated by cgo and generates
+    _cgo_imports.go. The result should be passed to emit_compilepkg as
+    cgo_outputs.
+
+    Args:
+        go: a GoContext.
+        sources: .go and header files in the package.
+        csrcs: C, C++, Objective-C, Objective-C++, and assembly files in the
+            package.
+        importmap: the package path of the package being compiled.
+        cgo: the struct returned by cgo_configure.
+        cxxpch: a header in sources to precompile and include in each C++
+            file in csrcs. It's ignored if the C/C++ toolchain doesn't
+            support precompiled headers.
+        testfilter: controls which .go files are processed, as in
+            emit_compilepkg.
+        path_prefix: directory, relative to the package output directory,
+            where outputs are declared.
+
+    Returns:
+        A struct with the fields gen_dir, obj_dir, imports, objs, and
+        export_h.
+    """
+    gen_dir = go.declare_directory(go, path = path_prefix + "/gen")
+    obj_dir = go.declare_directory(go, path = path_prefix + "/obj")
+    imports = go.declare_file(go, path = path_prefix + "/_cgo_imports.go")
+    export_h = go.declare_file(go, path = path_prefix + "/export/_cgo_export.h")
+    headers = [f for f in sources if not f.basename.endswith(".go")]
+    have_cxx = any([f.extension in ("cc", "cpp", "cxx", "mm") for f in csrcs])
+
+    env = dict(go.env)
+    env["CC"] = go.cgo_tools.c_compiler_path
+    c_inputs = depset(direct = go.crosstool, transitive = [cgo.inputs])
+
+    args = go.builder_args(go, "cgogen")
+    args.add_all(sources, before_each = "-src")
+    if importmap:
+        args.add("-p", importmap)
+    if testfilter:
+        args.add("-testfilter", testfilter)
+    if have_cxx:
+        args.add("-cxx")
+    _add_cgo_opts(args, cgo.cppopts, cgo.copts, cgo.clinkopts, cgo.trace)
+    args.add("-objdir", gen_dir.path)
+    args.add("-cgoexport", export_h)
+    go.actions.run(
+        inputs = depset(sources + go.sdk.tools, transitive = [c_inputs]),
+        outputs = [gen_dir, export_h],
+        mnemonic = "GoCgoGen",
+        executable = go.toolchain._builder,
+        arguments = [args],
+        env = env,
+    )
+
+    # If the header is precompiled, C++ files include it with -include before
+    # anything else. GCC looks for a .gch file in each include directory
+    # before the header itself, so the precompiled header's directory is
+    # searched first. If the precompiled header doesn't match the flags used
+    # for a file, GCC warns and includes the original header instead.
+    pch_inputs = []
+    pch_cppopts = []
+    pch_cxxopts = []
+    cxx_exts = ("cc", "cpp", "cxx")
+    if (cxxpch and go.cgo_tools.supports_pch and
+        any([f.extension in cxx_exts for f in csrcs])):
+        pch = go.declare_file(go, path = "{}/pch/{}.gch".format(path_prefix, cxxpch.basename))
+        args = go.builder_args(go, "cc")
+        args.add("-src", cxxpch)
+        args.add("-pch")
+        _add_cgo_opts(args, cgo.cppopts, cgo.cxxopts, trace = cgo.trace)
+        args.add("-o", pch)
+        go.actions.run(
+            inputs = depset([cxxpch] + headers, transitive = [c_inputs]),
+            outputs = [pch],
+            mnemonic = "GoCompilePch",
+            executable = go.toolchain._builder,
+            arguments = [args],
+            env = env,
+        )
+        pch_inputs = [pch, cxxpch]
+        pch_cppopts = ["-iquote", pch.dirname, "-iquote", cxxpch.dirname]
+        pch_cxxopts = ["-include", cxxpch.basename, "-Winvalid-pch", "-Wno-error=invalid-pch"]
+
+    objs = []
+    for i, src in enumerate(csrcs):
+        obj = go.declare_file(go, path = "{}/c/{}_{}.o".format(path_prefix, i, src.basename))
+        objs.append(obj)
+        cppopts = cgo.cppopts + ["-iquote", export_h.dirname]
+        copts = _csrc_opts(cgo, src)
+        src_inputs = [src, export_h] + headers
+        if pch_inputs and src.extension in cxx_exts:
+            cppopts = pch_cppopts + cppopts
+            copts = copts + pch_cxxopts
+            src_inputs += pch_inputs
+        args = go.builder_args(go, "cc")
+        args.add("-src", src)
+        _add_cgo_opts(args, cppopts, copts, trace = cgo.trace)
+        args.add("-o", obj)
+        go.actions.run(
+            inputs = depset(src_inputs, transitive = [c_inputs]),
+            outputs = [obj],
+            mnemonic = "GoCompileC",
+            executable = go.toolchain._builder,
+            arguments = [args],
+            env = env,
+        )
+
+    args = go.builder_args(go, "cgolink")
+    args.add("-gendir", gen_dir.path)
+    args.add_all(objs, before_each = "-obj")
+    if have_cxx:
+        args.add("-cxx")
+    _add_cgo_opts(args, cgo.cppopts, cgo.copts, cgo.clinkopts, cgo.trace)
+    args.add("-objdir", obj_dir.path)
+    args.add("-imports", imports)
+    go.actions.run(
+        inputs = depset([gen_dir] + objs + headers + go.sdk.tools, transitive = [c_inputs]),
+        outputs = [obj_dir, imports],
+        mnemonic = "GoCgoLink",
+        executable = go.toolchain._builder,
+        arguments = [args],
+        env = env,
+    )
+
+    return struct(
+        gen_dir = gen_dir,
+        obj_dir = obj_dir,
+        imports = imports,
+        objs = objs,
+        export_h = export_h,
+    )
+
+def _add_cgo_opts(args, cppopts, copts, clinkopts = [], trace = []):
+    if cppopts:
+        args.add("-cppflags", _quote_opts(cppopts))
+    if copts:
+        args.add("-cflags", _quote_opts(copts))
+    if clinkopts:
+        args.add("-ldflags", _quote_opts(clinkopts))
+    args.add_all(trace, before_each = "-cgo_trace")
+
+def _csrc_opts(cgo, src):
+    if src.extension == "m":
+        return cgo.objcopts
+    if src.extension == "mm":
+        return cgo.objcxxopts
+    if src.extension in ("cc", "cpp", "cxx"):
+        return cgo.cxxopts
+    return cgo.copts
+
 def _quote_opts(opts):
     return " ".join([shell.quote(opt) if " " in opt else opt for opt in opts])
+
+def _fuzz_instrumented(mode):
+    """Returns whether the compiler supports fuzzing instrumentation for the
+    target platform."""
+    return (mode.goarch in ("amd64", "arm64") and
+            mode.goos in ("darwin", "freebsd", "linux", "windows"))
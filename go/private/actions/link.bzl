@@ -12,6 +12,10 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+load(
+    "@bazel_skylib//lib:structs.bzl",
+    "structs",
+)
 load(
     "@io_bazel_rules_go//go/private:common.bzl",
     "as_set",
@@ -20,14 +24,26 @@ load(
 load(
     "@io_bazel_rules_go//go/private:mode.bzl",
     "LINKMODE_NORMAL",
+    "LINKMODE_PIE",
     "LINKMODE_PLUGIN",
     "extld_from_cc_toolchain",
     "extldflags_from_cc_toolchain",
+    "lto_options",
+    "mode_string",
+    "static_link_options",
+)
+load(
+    "@io_bazel_rules_go//go/private:providers.bzl",
+    "GoLibrary",
+    "GoSource",
 )
 
 def _format_archive(d):
     return "{}={}={}".format(d.label, d.importmap, d.file.path)
 
+def _format_symbol_package(d):
+    return "{}={}={}".format(d.label, d.importpath, d.importmap)
+
 def _transitive_archives_without_test_archives(archive, test_archives):
     # Build the set of transitive dependencies. Currently, we tolerate multiple
     # archives with the same importmap (though this will be an error in the
@@ -38,6 +54,164 @@ def _transitive_archives_without_test_archives(archive, test_archives):
     deps = depset(transitive = [d.transitive for d in archive.direct])
     return [d for d in deps.to_list() if not any([d.importmap == t.importmap for t in test_archives])]
 
+_MAX_GRAPH_STEPS = 2147483647
+
+def _check_import_cycles(go, archive, arcs):
+    # Bazel reports cycles in the target graph on its own, but two libraries
+    # with the same importmap may form an import cycle without one: for
+    # example, //a:lib imports //b:lib, which imports //a:old_lib, another
+    # library for the same package. The compiler and linker report these
+    # in confusing ways, so look for them here. Walking the graph is only
+    # necessary when a package path is provided more than once, which is rare.
+    seen = {}
+    dups = {}
+    for arc in arcs:
+        if arc.importmap in seen:
+            dups[arc.importmap] = None
+        seen[arc.importmap] = None
+    if not dups:
+        return
+
+    archives = []
+    visited = {}
+    stack = [archive]
+    for _ in range(_MAX_GRAPH_STEPS):
+        if not stack:
+            break
+        a = stack.pop()
+        if a.data.file in visited:
+            continue
+        visited[a.data.file] = None
+        archives.append(a)
+        stack.extend(a.direct)
+
+    for start in archives:
+        if start.data.importmap not in dups:
+            continue
+
+        # Breadth-first search, so the shortest cycle is reported.
+        parents = {start.data.file: None}
+        queue = [start]
+        for i in range(len(archives)):
+            if i >= len(queue):
+                break
+            a = queue[i]
+            for dep in a.direct:
+                if dep.data.file in parents:
+                    continue
+                parents[dep.data.file] = a
+                if dep.data.importmap == start.data.importmap:
+                    fail(_import_cycle_message(go, dep, parents))
+                queue.append(dep)
+
+def _remap_package_conflicts(go, archive, test_archives):
+    # Each library after the first with a given importmap, in the order the
+    # linker sees them, gets a new importmap. It's compiled again, as is each
+    # library in the binary that depends on it, directly or through other
+    # libraries. The first library keeps its importmap, so the binary is
+    # built as it would be if the conflict were only a warning, plus the
+    # libraries that would have been dropped. Returns archive and
+    # test_archives, replaced if they were compiled again.
+    arcs = _transitive_archives_without_test_archives(archive, test_archives)
+    used = {arc.importmap: None for arc in arcs}
+    first = {}
+    renamed = {}
+    for arc in arcs:
+        if arc.importmap not in first:
+            first[arc.importmap] = arc
+            continue
+        for n in range(2, len(arcs) + 2):
+            importmap = "{}~{}".format(arc.importmap, n)
+            if importmap not in used:
+                break
+        used[importmap] = None
+        renamed[arc.file] = importmap
+    if not renamed:
+        return archive, test_archives
+
+    # Compile libraries again in dependency order.
+    order = []
+    visited = {}
+    stack = [(archive, False)]
+    for _ in range(_MAX_GRAPH_STEPS):
+        if not stack:
+            break
+        a, expanded = stack.pop()
+        if expanded:
+            order.append(a)
+            continue
+        if a.data.file in visited:
+            continue
+        visited[a.data.file] = None
+        stack.append((a, True))
+        stack.extend([(dep, False) for dep in reversed(a.direct)])
+
+    recompiled = {}
+    for a in order:
+        importmap = renamed.get(a.data.file)
+        if not importmap and not any([dep.data.file in recompiled for dep in a.direct]):
+            continue
+        library = a.source.library
+        x_defs = a.source.x_defs
+        if importmap:
+            library = GoLibrary(**dict(structs.to_dict(library), importmap = importmap))
+            prefix = a.data.importmap + "."
+            x_defs = {
+                (importmap + k[len(a.data.importmap):] if k.startswith(prefix) else k): v
+                for k, v in x_defs.items()
+            }
+        source = GoSource(**dict(
+            structs.to_dict(a.source),
+            library = library,
+            deps = [recompiled.get(dep.data.file, dep) for dep in a.direct],
+            x_defs = x_defs,
+        ))
+        recompile_go = struct(**dict(
+            structs.to_dict(go),
+            _output_prefix = "{}_/importmap/{}".format(go._ctx.label.name, len(recompiled)),
+        ))
+        recompiled[a.data.file] = go.archive(recompile_go, source)
+
+    lines = ["WARNING: {}: packages provided by more than one library were remapped:".format(go._ctx.label)]
+    for arc in arcs:
+        if arc.file in renamed:
+            lines.append("    {} ({}) is compiled as {}; {} keeps the path".format(
+                arc.importmap,
+                arc.label,
+                renamed[arc.file],
+                first[arc.importmap].label,
+            ))
+    print("\n".join(lines))
+
+    archive = recompiled.get(archive.data.file, archive)
+    test_archives = [
+        recompiled[t.file].data if t.file in recompiled else t
+        for t in test_archives
+    ]
+    return archive, test_archives
+
+def _import_cycle_message(go, last, parents):
+    path = [last]
+    for _ in range(len(parents)):
+        parent = parents[path[-1].data.file]
+        if parent == None:
+            break
+        path.append(parent)
+    path = reversed(path)
+    lines = ["import cycle not allowed in {}:".format(go._ctx.label)]
+    for i, a in enumerate(path):
+        lines.append("    {}{} ({})".format(
+            "imports " if i > 0 else "",
+            a.data.importpath or a.data.importmap,
+            a.data.label,
+        ))
+    lines.append("{} and {} both provide package {}.".format(
+        path[0].data.label,
+        last.data.label,
+        last.data.importmap,
+    ))
+    return "\n".join(lines)
+
 def emit_link(
         go,
         archive = None,
@@ -45,7 +219,9 @@ def emit_link(
         executable = None,
         gc_linkopts = [],
         version_file = None,
-        info_file = None):
+        info_file = None,
+        out_metadata = None,
+        out_symbol_map = None):
     """See go/toolchains.rst#link for full documentation."""
 
     if archive == None:
@@ -74,21 +250,39 @@ def emit_link(
         tool_args.add("-race")
     if go.mode.msan:
         tool_args.add("-msan")
-    if (go.mode.static and not go.mode.pure) or go.mode.link != LINKMODE_NORMAL:
+    # The internal linker can't read objects compiled for LTO, so the
+    # external linker is used whenever LTO is enabled.
+    if (go.mode.static and not go.mode.pure) or go.mode.link != LINKMODE_NORMAL or go.mode.lto:
         tool_args.add("-linkmode", "external")
     if go.mode.static:
-        extldflags.append("-static")
+        extldflags.extend(static_link_options(go))
+    extldflags.extend(lto_options(go))
     if go.mode.link != LINKMODE_NORMAL:
         builder_args.add("-buildmode", go.mode.link)
     if go.mode.link == LINKMODE_PLUGIN:
         tool_args.add("-pluginpath", archive.data.importpath)
 
+    if go._package_conflict_remap:
+        archive, test_archives = _remap_package_conflicts(go, archive, test_archives)
     arcs = _transitive_archives_without_test_archives(archive, test_archives)
+    _check_import_cycles(go, archive, arcs)
     arcs.extend(test_archives)
     if (go.coverage_enabled and go.coverdata and
         not any([arc.importmap == go.coverdata.data.importmap for arc in arcs])):
         arcs.append(go.coverdata.data)
-    builder_args.add_all(arcs, before_each = "-arc", map_each = _format_archive)
+
+    # Large binaries have thousands of dependencies, so they're listed in a
+    # file instead of on the command line. The builder only resolves archives
+    # for packages the main package imports. All transitive archives are still
+    # inputs of the action (see archive.libs below), since which ones are
+    # imported is only known once the archives are read, so the action is
+    # still run again when an archive that isn't linked changes.
+    arc_list = go.actions.declare_file(executable.basename + ".arcs", sibling = executable)
+    arc_list_args = go.actions.args()
+    arc_list_args.set_param_file_format("multiline")
+    arc_list_args.add_all(arcs, map_each = _format_archive, uniquify = True)
+    go.actions.write(arc_list, arc_list_args)
+    builder_args.add("-arc_list", arc_list)
     builder_args.add("-package_list", go.package_list)
 
     # Build a list of rpaths for dynamic libraries we need to find.
@@ -115,21 +309,52 @@ def emit_link(
 
     # Process x_defs, either adding them directly to linker options, or
     # saving them to process through stamping support.
+    # A stamp value may carry a default after a '|', as in "{KEY|default}".
+    # The default is used when the key is missing from the status files, or
+    # when stamping is disabled.
+    # With linkstamp, values of volatile keys are set to placeholders here and
+    # filled in by a separate action after linking.
+    linkstamp = go.stamp and go._linkstamp and go.mode.link in (LINKMODE_NORMAL, LINKMODE_PIE)
     stamp_x_defs = False
+    volatile_x_defs = []
     for k, v in archive.x_defs.items():
-        if go.stamp and v.startswith("{") and v.endswith("}"):
-            builder_args.add("-Xstamp", "%s=%s" % (k, v[1:-1]))
-            stamp_x_defs = True
+        if v.startswith("{") and v.endswith("}"):
+            key, sep, default = v[1:-1].partition("|")
+            if linkstamp and not _is_stable_key(key):
+                placeholder = _linkstamp_placeholder(len(volatile_x_defs))
+                builder_args.add("-X", "%s=%s" % (k, placeholder))
+                volatile_x_defs.append("%s=%s" % (placeholder, v[1:-1]))
+            elif go.stamp:
+                builder_args.add("-Xstamp", "%s=%s" % (k, v[1:-1]))
+                stamp_x_defs = True
+            elif sep:
+                builder_args.add("-X", "%s=%s" % (k, default))
+            else:
+                builder_args.add("-X", "%s=%s" % (k, v))
         else:
             builder_args.add("-X", "%s=%s" % (k, v))
 
+    # Binaries that link the buildinfo package get their label, and when
+    # stamped, the stable workspace status. The builder also sets the build
+    # configuration digest.
+    buildinfo = any([arc.importmap == _BUILDINFO_IMPORTPATH for arc in arcs])
+    if buildinfo:
+        builder_args.add("-X", "%s.label=%s" % (_BUILDINFO_IMPORTPATH, str(go._ctx.label)))
+        builder_args.add("-buildinfo", _BUILDINFO_IMPORTPATH)
+
     # Stamping support
     stamp_inputs = []
     if stamp_x_defs:
-        stamp_inputs = [info_file, version_file]
-        builder_args.add_all(stamp_inputs, before_each = "-stamp")
+        stamp_inputs = [info_file] if linkstamp else [info_file, version_file]
+    elif buildinfo and go.stamp:
+        stamp_inputs = [info_file]
+    builder_args.add_all(stamp_inputs, before_each = "-stamp")
 
-    builder_args.add("-o", executable)
+    link_output = executable
+    if volatile_x_defs:
+        link_output = go.actions.declare_file(executable.basename + ".unstamped", sibling = executable)
+
+    builder_args.add("-o", link_output)
     builder_args.add("-main", archive.data.file)
     builder_args.add("-p", archive.data.importmap)
     tool_args.add_all(gc_linkopts)
@@ -143,10 +368,19 @@ def emit_link(
 
     if go._package_conflict_is_error:
         builder_args.add("-package_conflict_is_error")
+    if go._build_config_digest and go.mode.link in (LINKMODE_NORMAL, LINKMODE_PIE):
+        builder_args.add_all(_build_config(go, gc_linkopts), before_each = "-build_config")
 
-    inputs_direct = stamp_inputs + [go.sdk.package_list]
+    inputs_direct = stamp_inputs + [go.sdk.package_list, arc_list]
+    if go._package_conflict_allowlist:
+        builder_args.add("-package_conflict_allowlist", go._package_conflict_allowlist)
+        inputs_direct.append(go._package_conflict_allowlist)
     if go.coverage_enabled and go.coverdata:
         inputs_direct.append(go.coverdata.data.file)
+    if archive.data.nogo_checked:
+        # The link doesn't read this file, but it shouldn't succeed if nogo
+        # reports problems in the main package or its dependencies.
+        inputs_direct.append(archive.data.nogo_checked)
     inputs_transitive = [
         archive.libs,
         archive.cgo_deps,
@@ -156,15 +390,98 @@ def emit_link(
     ]
     inputs = depset(direct = inputs_direct, transitive = inputs_transitive)
 
+    outputs = [link_output]
+    if out_metadata:
+        builder_args.add("-metadata", out_metadata)
+        outputs.append(out_metadata)
+
     go.actions.run(
         inputs = inputs,
-        outputs = [executable],
+        outputs = outputs,
         mnemonic = "GoLink",
         executable = go.toolchain._builder,
         arguments = [builder_args, "--", tool_args],
         env = go.env,
     )
 
+    if volatile_x_defs:
+        stamp_args = go.builder_args(go, "stamp")
+        stamp_args.add("-in", link_output)
+        stamp_args.add("-o", executable)
+        stamp_args.add("-stamp", version_file)
+        stamp_args.add_all(volatile_x_defs, before_each = "-placeholder")
+
+        # Like C++ linkstamping, this action is cheap and its output changes
+        # with every build, so there's no point in caching it remotely.
+        go.actions.run(
+            inputs = [link_output, version_file],
+            outputs = [executable],
+            mnemonic = "GoStamp",
+            executable = go.toolchain._builder,
+            arguments = [stamp_args],
+            env = go.env,
+            execution_requirements = {"no-remote": "1"},
+        )
+
+    if out_symbol_map:
+        # This runs in its own action so binaries don't wait for it. It only
+        # runs when the go_symbol_map output group is requested.
+        symbol_args = go.builder_args(go, "symbolmap")
+        symbol_args.add("-binary", executable)
+        symbol_args.add("-o", out_symbol_map)
+        symbol_args.add("-package_list", go.package_list)
+        symbol_args.add("-main", _format_symbol_package(archive.data))
+        symbol_args.add_all(arcs, before_each = "-package", map_each = _format_symbol_package)
+        go.actions.run(
+            inputs = depset(
+                direct = [executable, go.sdk.go, go.sdk.package_list],
+                transitive = [as_set(go.sdk.tools)],
+            ),
+            outputs = [out_symbol_map],
+            mnemonic = "GoSymbolMap",
+            executable = go.toolchain._builder,
+            arguments = [symbol_args],
+            env = go.env,
+        )
+
+def _build_config(go, gc_linkopts):
+    """Returns the settings summarized by the build configuration digest.
+
+    Only settings that change how every package in the binary is built are
+    listed, so binaries built from the same sources with the same flags get
+    the same digest. The builder adds the version of the Go SDK.
+    """
+    config = [
+        "mode=" + mode_string(go.mode),
+        "tags=" + ",".join(sorted({tag: None for tag in go.mode.tags}.keys())),
+        "gcflags=" + " ".join(list(go.toolchain.flags.compile)),
+        "ldflags=" + " ".join(list(go.toolchain.flags.link) + gc_linkopts),
+        "trimpath_prefix=" + go.mode.trimpath_prefix,
+        "stamp=" + ("1" if go.stamp else "0"),
+    ]
+    if go.cgo_tools and not go.mode.pure:
+        config.append("cc=" + go.cgo_tools.c_compiler_path)
+    return config
+
+# Keys Bazel writes to stable-status.txt, in addition to keys starting with
+# STABLE_ from the workspace status command.
+_STABLE_STATUS_KEYS = ["BUILD_EMBED_LABEL", "BUILD_HOST", "BUILD_USER"]
+
+# The package whose variables are set to describe the binary. See
+# go/tools/buildinfo.
+_BUILDINFO_IMPORTPATH = "github.com/bazelbuild/rules_go/go/tools/buildinfo"
+
+def _is_stable_key(key):
+    return key.startswith("STABLE_") or key in _STABLE_STATUS_KEYS
+
+# The length of placeholders for volatile stamp values. Values may not be
+# longer than this.
+_LINKSTAMP_PLACEHOLDER_LEN = 128
+
+def _linkstamp_placeholder(index):
+    prefix = "rules_go_linkstamp:%d:" % index
+    return prefix + "." * (_LINKSTAMP_PLACEHOLDER_LEN - len(prefix))
+
 def _extract_extldflags(gc_linkopts, extldflags):
     """Extracts -extldflags from gc_linkopts and combines them into a single list.
 
@@ -0,0 +1,150 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:mode.bzl",
+    "installsuffix",
+)
+
+def _archive(v):
+    importpaths = [v.data.importpath]
+    importpaths.extend(v.data.importpath_aliases)
+    return "{}={}={}={}".format(
+        ":".join(importpaths),
+        v.data.importmap,
+        (v.data.export_data or v.data.file).path,
+        v.data.export_file.path if v.data.export_file else "",
+    )
+
+def _use_sdk_stdlib(go):
+    # Type checking only needs export data, which is the same for the
+    # precompiled standard library and one built with -race or a different
+    # link mode. Files excluded by build tags are a different matter.
+    return (go.mode.goos == go.sdk.goos and
+            go.mode.goarch == go.sdk.goarch and
+            not go.mode.pure and
+            not go._custom_stdlib_tags and
+            len(go.sdk.libs) > 0)
+
+def _nogo_args(go, stdlib_suffix, srcs_list, archives, importmap):
+    # Tags aren't passed: the compile action already filtered the sources.
+    args = go.actions.args()
+    args.use_param_file("-param=%s")
+    args.set_param_file_format("multiline")
+    args.add("nogo")
+    args.add("-sdk", go.sdk.root_file.dirname)
+    args.add("-installsuffix", stdlib_suffix)
+    args.add("-srcs_list", srcs_list)
+    args.add_all(archives, before_each = "-arc", map_each = _archive)
+    if importmap:
+        args.add("-p", importmap)
+    args.add("-package_list", go.package_list)
+    args.add("-nogo", go.nogo)
+    return args
+
+def emit_nogo(
+        go,
+        sources = [],
+        cgo_outputs = None,
+        importmap = "",
+        archives = [],
+        srcs_list = None,
+        out_facts = None,
+        out_checked = None,
+        out_nogo_fix = None,
+        out_nogo_sarif = None):
+    """Runs nogo on a compiled package in separate actions.
+
+    GoNogoFacts runs the analyzers that export facts and writes them for
+    dependent packages. GoNogo runs every analyzer and reports findings. Only
+    facts are needed to check other packages, so findings are reported off
+    the critical path, and GoNogo actions for dependent packages are only run
+    again when the facts or export data they depend on change.
+
+    The actions' command lines and inputs don't depend on how the package was
+    compiled, as long as the sources that were compiled are the same. When
+    only the compilation mode changes (for example, when a test is run with
+    --@io_bazel_rules_go//go/config:race), the actions are cache hits.
+
+    Args:
+        go: a GoContext.
+        sources: .go files in the package.
+        cgo_outputs: the struct returned by emit_cgo, if it was called.
+        importmap: the package path of the package being checked.
+        archives: GoArchives for direct dependencies.
+        srcs_list: the export data file written by emit_compilepkg, which
+            lists the .go files that were compiled, before coverage
+            instrumentation.
+        out_facts: the nogo facts file to write.
+        out_checked: an empty file written by GoNogo if nogo reports no
+            problems in this package. GoNogo depends on the same file for
+            each dependency, so it's only written if no dependency has
+            problems either.
+        out_nogo_fix: if set, nogo writes suggested fixes here.
+        out_nogo_sarif: if set, nogo writes findings in SARIF format here.
+    """
+    if _use_sdk_stdlib(go):
+        goroot = go.sdk.root_file.dirname
+        stdlib_suffix = go.mode.goos + "_" + go.mode.goarch
+        stdlib_libs = go.sdk.libs
+    else:
+        goroot = go.stdlib.root_file.dirname
+        stdlib_suffix = installsuffix(go.mode)
+        stdlib_libs = go.stdlib.libs
+
+    inputs = ([srcs_list, go.nogo, go.package_list] +
+              [f for f in sources if f.extension == "go"] +
+              [(a.data.export_data or a.data.file) for a in archives] +
+              [a.data.export_file for a in archives if a.data.export_file] +
+              go.sdk.tools + stdlib_libs)
+    if cgo_outputs:
+        inputs.extend([cgo_outputs.gen_dir, cgo_outputs.imports])
+
+    env = {
+        "GOARCH": go.mode.goarch,
+        "GOOS": go.mode.goos,
+        "GOROOT": goroot,
+        "GOROOT_FINAL": "GOROOT",
+        "GOPATH": "",
+    }
+
+    facts_args = _nogo_args(go, stdlib_suffix, srcs_list, archives, importmap)
+    facts_args.add("-facts_only")
+    facts_args.add("-x", out_facts)
+    go.actions.run(
+        inputs = inputs,
+        outputs = [out_facts],
+        mnemonic = "GoNogoFacts",
+        executable = go.toolchain._builder,
+        arguments = [facts_args],
+        env = env,
+    )
+
+    check_args = _nogo_args(go, stdlib_suffix, srcs_list, archives, importmap)
+    check_args.add("-checked", out_checked)
+    outputs = [out_checked]
+    if out_nogo_fix:
+        check_args.add("-nogo_fix", out_nogo_fix)
+        outputs.append(out_nogo_fix)
+    if out_nogo_sarif:
+        check_args.add("-nogo_sarif", out_nogo_sarif)
+        outputs.append(out_nogo_sarif)
+    go.actions.run(
+        inputs = inputs + [a.data.nogo_checked for a in archives if a.data.nogo_checked],
+        outputs = outputs,
+        mnemonic = "GoNogo",
+        executable = go.toolchain._builder,
+        arguments = [check_args],
+        env = env,
+    )
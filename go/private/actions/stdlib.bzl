@@ -21,13 +21,16 @@ load(
     "LINKMODE_NORMAL",
     "extldflags_from_cc_toolchain",
     "link_mode_args",
+    "stdlib_mode_key",
 )
 
 def emit_stdlib(go):
     """Returns a standard library for the target configuration.
 
     If the precompiled standard library is suitable, it will be returned.
-    Otherwise, the standard library will be compiled for the target.
+    Otherwise, if the SDK has a prebuilt standard library for the mode, that
+    will be returned. Otherwise, the standard library will be compiled for
+    the target.
 
     Returns:
         A list of providers containing GoLibrary and GoSource. GoSource.stdlib
@@ -40,16 +43,29 @@ def emit_stdlib(go):
 def _stdlib_library_to_source(go, attr, source, merge):
     if _should_use_sdk_stdlib(go):
         source["stdlib"] = _sdk_stdlib(go)
+    elif _prebuilt_stdlib(go):
+        source["stdlib"] = _prebuilt_stdlib(go)
     else:
         source["stdlib"] = _build_stdlib(go)
 
 def _should_use_sdk_stdlib(go):
-    return (go.mode.goos == go.sdk.goos and
+    return (go.sdk.libs and  # the SDK may not include a precompiled stdlib
+            go.mode.goos == go.sdk.goos and
             go.mode.goarch == go.sdk.goarch and
             not go.mode.race and  # TODO(jayconrod): use precompiled race
             not go.mode.msan and
             not go.mode.pure and
-            go.mode.link == LINKMODE_NORMAL)
+            go.mode.link == LINKMODE_NORMAL and
+            not go.mode.trimpath_prefix and
+            not go._custom_stdlib_tags)
+
+def _prebuilt_stdlib(go):
+    # Prebuilt libraries are compiled without custom tags or trimmed file
+    # names, so they can't be used when tags affect the standard library or
+    # file names are rewritten.
+    if go._custom_stdlib_tags or go.mode.trimpath_prefix:
+        return None
+    return go.sdk.prebuilt_stdlibs.get(stdlib_mode_key(go.mode))
 
 def _sdk_stdlib(go):
     return GoStdLib(
@@ -61,13 +77,71 @@ def _build_stdlib(go):
     pkg = go.declare_directory(go, path = "pkg")
     src = go.declare_directory(go, path = "src")
     root_file = go.declare_file(go, path = "ROOT")
+    go.actions.write(root_file, "")
+    if go._stdlib_shards > 1:
+        # Each shard compiles a range of packages in its own action. Shards
+        # are in dependency order, and each one is compiled against the
+        # archives of the ones before it. The last action merges their
+        # archives into one GOROOT.
+        shard_pkgs = []
+        for shard in range(go._stdlib_shards):
+            shard_pkgs.append(_build_stdlib_shard(go, shard, shard_pkgs))
+        args = go.builder_args(go, "stdlib")
+        args.add("-out", root_file.dirname)
+        args.add_all([shard_pkg.dirname for shard_pkg in shard_pkgs], before_each = "-merge")
+        go.actions.run(
+            inputs = _stdlib_sdk_inputs(go) + shard_pkgs,
+            outputs = [pkg, src],
+            mnemonic = "GoStdlibMerge",
+            executable = go.toolchain._builder,
+            arguments = [args],
+            env = go.env,
+        )
+    else:
+        args = _stdlib_args(go, root_file.dirname)
+        go.actions.run(
+            inputs = _stdlib_sdk_inputs(go) + go.crosstool,
+            outputs = [pkg, src],
+            mnemonic = "GoStdlib",
+            executable = go.toolchain._builder,
+            arguments = [args],
+            env = _stdlib_env(go),
+        )
+    return GoStdLib(
+        root_file = root_file,
+        libs = [pkg],
+    )
+
+def _build_stdlib_shard(go, shard, prebuilt_pkgs):
+    pkg = go.declare_directory(go, path = "shard_{}/pkg".format(shard))
+    args = _stdlib_args(go, pkg.dirname)
+    args.add("-shard", str(shard))
+    args.add("-shards", str(go._stdlib_shards))
+    args.add_all([prebuilt_pkg.dirname for prebuilt_pkg in prebuilt_pkgs], before_each = "-prebuilt")
+    go.actions.run(
+        inputs = _stdlib_sdk_inputs(go) + go.crosstool + prebuilt_pkgs,
+        outputs = [pkg],
+        mnemonic = "GoStdlib",
+        progress_message = "Compiling standard library shard {} of {}".format(shard + 1, go._stdlib_shards),
+        executable = go.toolchain._builder,
+        arguments = [args],
+        env = _stdlib_env(go),
+    )
+    return pkg
+
+def _stdlib_args(go, out):
     args = go.builder_args(go, "stdlib")
-    args.add("-out", root_file.dirname)
+    args.add("-out", out)
     if go.mode.race:
         args.add("-race")
+    if go.mode.trimpath_prefix:
+        args.add("-trimpath")
     args.add_all(link_mode_args(go.mode))
-    go.actions.write(root_file, "")
-    env = go.env
+    args.add_all(go._stdlib_packages, before_each = "-package")
+    return args
+
+def _stdlib_env(go):
+    env = dict(go.env)
     if go.mode.pure:
         env.update({"CGO_ENABLED": "0"})
     else:
@@ -77,21 +151,10 @@ def _build_stdlib(go):
             "CGO_CFLAGS": " ".join(go.cgo_tools.c_compile_options),
             "CGO_LDFLAGS": " ".join(extldflags_from_cc_toolchain(go)),
         })
-    inputs = (go.sdk.srcs +
-              go.sdk.headers +
-              go.sdk.tools +
-              [go.sdk.go, go.sdk.package_list, go.sdk.root_file] +
-              go.crosstool)
-    outputs = [pkg, src]
-    go.actions.run(
-        inputs = inputs,
-        outputs = outputs,
-        mnemonic = "GoStdlib",
-        executable = go.toolchain._builder,
-        arguments = [args],
-        env = env,
-    )
-    return GoStdLib(
-        root_file = root_file,
-        libs = [pkg],
-    )
+    return env
+
+def _stdlib_sdk_inputs(go):
+    return (go.sdk.srcs +
+            go.sdk.headers +
+            go.sdk.tools +
+            [go.sdk.go, go.sdk.package_list, go.sdk.root_file])
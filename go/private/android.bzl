@@ -0,0 +1,112 @@
+# Copyright 2014 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:platforms.bzl",
+    "GOARCH_CONSTRAINTS",
+)
+
+# Target triples of the NDK's clang for each architecture, and the names
+# Android uses for their ABIs.
+_ANDROID_TARGETS = {
+    "amd64": struct(triple = "x86_64-linux-android", cpu = "x86_64"),
+    "arm64": struct(triple = "aarch64-linux-android", cpu = "arm64-v8a"),
+}
+
+# The oldest API level the NDK supports for 64-bit architectures.
+_MIN_API_LEVEL = 21
+
+def _go_android_ndk_toolchain_impl(ctx):
+    if ctx.attr.goarch not in _ANDROID_TARGETS:
+        fail("{}: goarch {} is not supported; want one of {}".format(
+            ctx.name,
+            ctx.attr.goarch,
+            ", ".join(sorted(_ANDROID_TARGETS.keys())),
+        ))
+    if ctx.attr.api_level < _MIN_API_LEVEL:
+        fail("{}: api_level must be at least {}".format(ctx.name, _MIN_API_LEVEL))
+    if ctx.os.name == "linux":
+        host = "linux-x86_64"
+    elif ctx.os.name == "mac os x":
+        host = "darwin-x86_64"
+    else:
+        fail("{}: the NDK can't be used on {}".format(ctx.name, ctx.os.name))
+
+    if ctx.attr.urls:
+        ctx.download_and_extract(
+            url = ctx.attr.urls,
+            sha256 = ctx.attr.sha256,
+            stripPrefix = ctx.attr.strip_prefix,
+            output = "ndk",
+        )
+        ndk = "ndk"
+    else:
+        ndk = ctx.attr.path or ctx.os.environ.get("ANDROID_NDK_HOME", "")
+        if not ndk:
+            fail("{}: set path or urls, or set ANDROID_NDK_HOME".format(ctx.name))
+        ndk = str(ctx.path(ndk))
+
+    # Only the prebuilt LLVM toolchain for the host is needed. It includes the
+    # sysroot with Android's headers and libraries.
+    ctx.symlink("{}/toolchains/llvm/prebuilt/{}".format(ndk, host), "prebuilt")
+    target = _ANDROID_TARGETS[ctx.attr.goarch]
+    clang = "prebuilt/bin/{}{}-clang".format(target.triple, ctx.attr.api_level)
+    if not ctx.path(clang).exists:
+        fail("{}: {} not found; check that the NDK is r23 or later and supports API level {}".format(
+            ctx.name,
+            clang,
+            ctx.attr.api_level,
+        ))
+
+    include_dirs = ["prebuilt/sysroot/usr/include"]
+    for d in ("prebuilt/lib/clang", "prebuilt/lib64/clang"):
+        if ctx.path(d).exists:
+            include_dirs.append(d)
+    ctx.template(
+        "BUILD.bazel",
+        Label("@io_bazel_rules_go//go/private:BUILD.android.bazel"),
+        executable = False,
+        substitutions = {
+            "{repo}": ctx.name,
+            "{clang}": clang,
+            "{triple}": target.triple,
+            "{cpu}": target.cpu,
+            "{cpu_constraint}": GOARCH_CONSTRAINTS[ctx.attr.goarch],
+            "{include_dirs}": ", ".join(['"%package(@{}//{})%"'.format(ctx.name, d) for d in include_dirs]),
+            "{exec_compatible_with}": ", ".join(['"{}"'.format(c) for c in ctx.attr.exec_compatible_with]),
+        },
+    )
+
+_go_android_ndk_toolchain = repository_rule(
+    _go_android_ndk_toolchain_impl,
+    attrs = {
+        "goarch": attr.string(mandatory = True),
+        "api_level": attr.int(default = _MIN_API_LEVEL),
+        "path": attr.string(),
+        "urls": attr.string_list(),
+        "sha256": attr.string(),
+        "strip_prefix": attr.string(),
+        "exec_compatible_with": attr.string_list(
+            default = [
+                "@platforms//os:linux",
+                "@platforms//cpu:x86_64",
+            ],
+        ),
+    },
+    environ = ["ANDROID_NDK_HOME"],
+)
+
+def go_android_ndk_toolchain(name, **kwargs):
+    _go_android_ndk_toolchain(name = name, **kwargs)
+    native.register_toolchains("@{}//:toolchain".format(name))
@@ -115,6 +115,18 @@ def join_srcs(source):
     """Combines source from a split_srcs struct into a single list."""
     return source.go + source.headers + source.asm + source.c + source.cxx + source.objc
 
+def expand_env(ctx):
+    """Expands the env attribute of a go_binary or go_test.
+
+    $(location), $(rootpath), and similar functions may refer to targets in
+    data. Make variables, like $(COMPILATION_MODE) or those provided by
+    toolchains, are expanded after locations.
+    """
+    return {
+        name: ctx.expand_make_variables("env", ctx.expand_location(value, ctx.attr.data), {})
+        for name, value in ctx.attr.env.items()
+    }
+
 def env_execute(ctx, arguments, environment = {}, **kwargs):
     """Executes a command in for a repository rule.
 
@@ -156,6 +168,8 @@ def executable_extension(ctx):
 def goos_to_extension(goos):
     if goos == "windows":
         return ".exe"
+    if goos == "wasip1":
+        return ".wasm"
     return ""
 
 ARCHIVE_EXTENSION = ".a"
@@ -249,3 +263,58 @@ def as_set(v):
     if type(v) == "tuple":
         return depset(v)
     fail("as_tuple failed on {}".format(v))
+
+def parse_label_pattern(pattern):
+    """Parses a Bazel target pattern like //foo/... or @repo//foo:bar.
+
+    Only patterns naming a single target, all targets in a package (:all or
+    :*), or all targets beneath a package (/...) are supported.
+    """
+    repo = ""
+    rest = pattern
+    if rest.startswith("@"):
+        i = rest.find("//")
+        if i < 0:
+            fail("invalid label pattern %s" % pattern)
+        repo = rest[1:i]
+        rest = rest[i:]
+    if not rest.startswith("//"):
+        fail("invalid label pattern %s: must start with // or @" % pattern)
+    rest = rest[len("//"):]
+
+    name = None
+    has_name = ":" in rest
+    if has_name:
+        rest, name = rest.split(":", 1)
+        if name in ("all", "*", "all-targets"):
+            name = None
+    recursive = False
+    if rest == "...":
+        recursive = True
+        rest = ""
+    elif rest.endswith("/..."):
+        recursive = True
+        rest = rest[:-len("/...")]
+    if recursive and name != None:
+        fail("invalid label pattern %s: /... may not be combined with a target name" % pattern)
+    if not recursive and not has_name:
+        # //foo is short for //foo:foo.
+        name = rest.rpartition("/")[2]
+    return struct(
+        repo = repo,
+        package = rest,
+        recursive = recursive,
+        name = name,
+    )
+
+def label_matches_pattern(label, pattern):
+    """Reports whether label is matched by a pattern from parse_label_pattern."""
+    if label.workspace_name != pattern.repo:
+        return False
+    if pattern.recursive:
+        if (pattern.package and label.package != pattern.package and
+            not label.package.startswith(pattern.package + "/")):
+            return False
+    elif label.package != pattern.package:
+        return False
+    return pattern.name == None or label.name == pattern.name
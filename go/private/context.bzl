@@ -34,7 +34,10 @@ load(
     "GoArchive",
     "GoConfigInfo",
     "GoContextInfo",
+    "GoCustomSettingsInfo",
     "GoLibrary",
+    "GoModulesInfo",
+    "GoNogoScopeInfo",
     "GoSource",
     "GoStdLib",
     "INFERRED_PATH",
@@ -45,11 +48,16 @@ load(
     "get_mode",
     "installsuffix",
 )
+load(
+    ":rules/module.bzl",
+    "module_for_label",
+)
 load(
     ":common.bzl",
     "as_iterable",
     "goos_to_extension",
     "goos_to_shared_extension",
+    "label_matches_pattern",
 )
 load(
     "//go/platform:apple.bzl",
@@ -113,6 +121,8 @@ def _child_name(go, path, ext, name):
         name += "/" + path
     if ext:
         name += ext
+    if go._output_prefix:
+        name = go._output_prefix + "/" + name
     return name
 
 def _declare_file(go, path = "", ext = "", name = ""):
@@ -134,6 +144,8 @@ def _builder_args(go, command = None):
     args.add("-sdk", go.sdk.root_file.dirname)
     args.add("-installsuffix", installsuffix(go.mode))
     args.add_joined("-tags", go.tags, join_with = ",")
+    if go._start_retries:
+        args.add("-start_retries", str(go._start_retries))
     return args
 
 def _tool_args(go):
@@ -170,10 +182,13 @@ def _merge_embed(source, embed):
     source["srcs"] = s.srcs + source["srcs"]
     source["orig_srcs"] = s.orig_srcs + source["orig_srcs"]
     source["orig_src_map"].update(s.orig_src_map)
+    source["embedsrcs"] = source["embedsrcs"] + s.embedsrcs
+    source["symabis"] = source["symabis"] + s.symabis
     source["cover"] = source["cover"] + s.cover
     source["deps"] = source["deps"] + s.deps
     source["x_defs"].update(s.x_defs)
     source["gc_goopts"] = source["gc_goopts"] + s.gc_goopts
+    source["werror"] = source["werror"] + s.werror
     source["runfiles"] = source["runfiles"].merge(s.runfiles)
     if s.cgo and source["cgo"]:
         fail("multiple libraries with cgo enabled")
@@ -182,6 +197,7 @@ def _merge_embed(source, embed):
     source["cppopts"] = source["cppopts"] or s.cppopts
     source["copts"] = source["copts"] or s.copts
     source["cxxopts"] = source["cxxopts"] or s.cxxopts
+    source["cxxpch"] = source["cxxpch"] or s.cxxpch
     source["clinkopts"] = source["clinkopts"] or s.clinkopts
     source["cgo_deps"] = source["cgo_deps"] + s.cgo_deps
     source["cgo_exports"] = source["cgo_exports"] + s.cgo_exports
@@ -208,33 +224,46 @@ def _dedup_deps(deps):
         deduped_deps.append(dep)
     return deduped_deps
 
+def _module_gc_goopts(go):
+    module = getattr(go, "_module", None)
+    if not module or not module.go_version:
+        return []
+    return ["-lang=go" + module.go_version]
+
 def _library_to_source(go, attr, library, coverage_instrumented):
     #TODO: stop collapsing a depset in this line...
     attr_srcs = [f for t in getattr(attr, "srcs", []) for f in as_iterable(t.files)]
     generated_srcs = getattr(library, "srcs", [])
     srcs = attr_srcs + generated_srcs
+    cxxpch = getattr(attr, "cxxpch", None)
     source = {
         "library": library,
         "mode": go.mode,
         "srcs": srcs,
         "orig_srcs": srcs,
         "orig_src_map": {},
+        "embedsrcs": [f for t in getattr(attr, "embedsrcs", []) for f in as_iterable(t.files)],
+        "symabis": [f for t in getattr(attr, "symabis", []) for f in as_iterable(t.files)],
         "cover": [],
         "x_defs": {},
         "deps": getattr(attr, "deps", []),
-        "gc_goopts": getattr(attr, "gc_goopts", []),
+        "gc_goopts": _module_gc_goopts(go) + getattr(attr, "gc_goopts", []),
+        "werror": getattr(attr, "werror", []),
         "runfiles": _collect_runfiles(go, getattr(attr, "data", []), getattr(attr, "deps", [])),
         "cgo": getattr(attr, "cgo", False),
         "cdeps": getattr(attr, "cdeps", []),
         "cppopts": getattr(attr, "cppopts", []),
         "copts": getattr(attr, "copts", []),
         "cxxopts": getattr(attr, "cxxopts", []),
+        "cxxpch": cxxpch.files.to_list()[0] if cxxpch else None,
         "clinkopts": getattr(attr, "clinkopts", []),
         "cgo_deps": [],
         "cgo_exports": [],
     }
-    if coverage_instrumented and not getattr(attr, "testonly", False):
-        source["cover"] = attr_srcs
+    if coverage_instrumented and _should_cover(attr, library):
+        # Test sources are never instrumented, but library code listed directly
+        # in a go_test's srcs is, since external tests may exercise it.
+        source["cover"] = [f for f in attr_srcs if not f.basename.endswith("_test.go")]
     for dep in source["deps"]:
         _check_binary_dep(go, dep, "deps")
     for e in getattr(attr, "embed", []):
@@ -248,7 +277,7 @@ def _library_to_source(go, attr, library, coverage_instrumented):
         x_defs[k] = v
     source["x_defs"] = x_defs
     if not source["cgo"]:
-        for k in ("cdeps", "cppopts", "copts", "cxxopts", "clinkopts"):
+        for k in ("cdeps", "cppopts", "copts", "cxxopts", "cxxpch", "clinkopts"):
             if getattr(attr, k, None):
                 fail(k + " set without cgo = True")
         for f in source["srcs"]:
@@ -260,6 +289,18 @@ def _library_to_source(go, attr, library, coverage_instrumented):
         library.resolve(go, attr, source, _merge_embed)
     return GoSource(**source)
 
+def _should_cover(attr, library):
+    """Returns whether the sources in attr should be instrumented for coverage.
+
+    Test-only libraries are not instrumented. A go_test is test-only, but its
+    internal test package (testfilter = "exclude") may contain library code.
+    Its external test package (testfilter = "only") contains only tests.
+    """
+    testfilter = getattr(library, "testfilter", None)
+    if testfilter == "only":
+        return False
+    return testfilter == "exclude" or not getattr(attr, "testonly", False)
+
 def _collect_runfiles(go, data, deps):
     """Builds a set of runfiles from the deps and data attributes.
 
@@ -305,7 +346,7 @@ def _check_importpaths(ctx):
         if ":" in p:
             fail("import path '%s' contains invalid character :" % p)
 
-def _infer_importpath(ctx):
+def _infer_importpath(ctx, module):
     DEFAULT_LIB = "go_default_library"
     VENDOR_PREFIX = "/vendor/"
 
@@ -332,13 +373,42 @@ def _infer_importpath(ctx):
     # Guess an import path based on the directory structure
     # This should only really be relied on for binaries
     importpath = ctx.label.package
+    pathtype = INFERRED_PATH
+    if module and importpath.rfind(VENDOR_PREFIX) == -1:
+        # Packages in a module are named the same way the go command names
+        # them, relative to the module root. If the target is named after
+        # something other than its directory, the path is still a guess.
+        if importpath == module.root:
+            importpath = module.path
+        else:
+            importpath = module.path + "/" + importpath[len(module.root):].lstrip("/")
+        pathtype = EXPLICIT_PATH
     if ctx.label.name != DEFAULT_LIB and not importpath.endswith(ctx.label.name):
         importpath += "/" + ctx.label.name
+        pathtype = INFERRED_PATH
     if importpath.rfind(VENDOR_PREFIX) != -1:
         importpath = importpath[len(VENDOR_PREFIX) + importpath.rfind(VENDOR_PREFIX):]
     if importpath.startswith("/"):
         importpath = importpath[1:]
-    return importpath, importpath, INFERRED_PATH
+    return importpath, importpath, pathtype
+
+def nogo_checks(scope, label, tags):
+    """Reports whether nogo should check a target.
+
+    Args:
+        scope: the GoNogoScopeInfo provided by nogo, or None.
+        label: the target's label.
+        tags: the build tags the target is compiled with.
+    """
+    if not scope:
+        return True
+    if scope.includes and not [p for p in scope.includes if label_matches_pattern(label, p)]:
+        return False
+    if [p for p in scope.excludes if label_matches_pattern(label, p)]:
+        return False
+    if [t for t in scope.exclude_tags if t in tags]:
+        return False
+    return True
 
 def go_context(ctx, attr = None):
     """Returns an API used to build Go code.
@@ -352,6 +422,7 @@ def go_context(ctx, attr = None):
     stdlib = None
     coverdata = None
     nogo = None
+    nogo_scope = None
     if hasattr(attr, "_go_context_data"):
         if CgoContextInfo in attr._go_context_data:
             cgo_context_info = attr._go_context_data[CgoContextInfo]
@@ -359,6 +430,7 @@ def go_context(ctx, attr = None):
         stdlib = attr._go_context_data[GoStdLib]
         coverdata = attr._go_context_data[GoContextInfo].coverdata
         nogo = attr._go_context_data[GoContextInfo].nogo
+        nogo_scope = attr._go_context_data[GoContextInfo].nogo_scope
     if getattr(attr, "_cgo_context_data", None) and CgoContextInfo in attr._cgo_context_data:
         cgo_context_info = attr._cgo_context_data[CgoContextInfo]
     if getattr(attr, "cgo_context_data", None) and CgoContextInfo in attr.cgo_context_data:
@@ -370,6 +442,8 @@ def go_context(ctx, attr = None):
 
     mode = get_mode(ctx, toolchain, cgo_context_info, go_config_info)
     tags = mode.tags
+    if nogo and not nogo_checks(nogo_scope, ctx.label, tags):
+        nogo = None
     binary = toolchain.sdk.go
 
     if stdlib:
@@ -377,7 +451,9 @@ def go_context(ctx, attr = None):
     else:
         goroot = toolchain.sdk.root_file.dirname
 
-    env = {
+    # Defaults from the SDK come first, so variables below take precedence.
+    env = dict(toolchain.sdk.env)
+    env.update({
         "GOARCH": mode.goarch,
         "GOOS": mode.goos,
         "GOROOT": goroot,
@@ -391,7 +467,7 @@ def go_context(ctx, attr = None):
         # Explicitly clear this environment variable to ensure that doesn't
         # happen. See #2291 for more information.
         "GOPATH": "",
-    }
+    })
     if mode.pure:
         crosstool = []
         cgo_tools = None
@@ -437,7 +513,10 @@ def go_context(ctx, attr = None):
                  toolchain.sdk.tools)
 
     _check_importpaths(ctx)
-    importpath, importmap, pathtype = _infer_importpath(ctx)
+    module = None
+    if go_config_info:
+        module = module_for_label(go_config_info.modules, ctx.label)
+    importpath, importmap, pathtype = _infer_importpath(ctx, module)
     importpath_aliases = tuple(getattr(attr, "importpath_aliases", ()))
 
     return struct(
@@ -490,17 +569,39 @@ def go_context(ctx, attr = None):
         # Private
         # TODO: All uses of this should be removed
         _ctx = ctx,
+        # Set when libraries are compiled again in another target, so their
+        # outputs don't collide with the target's own.
+        _output_prefix = "",
         # TODO(#1374): Remove in v0.25.
         _package_conflict_is_error = go_config_info._package_conflict_is_error if go_config_info else True,
+        _package_conflict_allowlist = go_config_info.package_conflict_allowlist if go_config_info else None,
+        _package_conflict_remap = go_config_info.package_conflict_remap if go_config_info else False,
+        _werror_policy = go_config_info.werror_policy if go_config_info else None,
+        _action_metadata = go_config_info.action_metadata if go_config_info else False,
+        _compiler_concurrency = go_config_info.compiler_concurrency if go_config_info else 1,
+        _cgo_concurrency = go_config_info.cgo_concurrency if go_config_info else 1,
+        _start_retries = go_config_info.start_retries if go_config_info else 0,
+        _nogo_fix = go_config_info.nogo_fix if go_config_info else False,
+        _nogo_sarif = go_config_info.nogo_sarif if go_config_info else False,
+        _linkstamp = go_config_info.linkstamp if go_config_info else False,
+        _build_config_digest = go_config_info.build_config_digest if go_config_info else False,
+        _cgo_trace = go_config_info.cgo_trace if go_config_info else False,
+        _fuzz = go_config_info.fuzz if go_config_info else False,
+        _custom_stdlib_tags = go_config_info.custom_stdlib_tags if go_config_info else False,
+        _stdlib_packages = go_config_info.stdlib_packages if go_config_info else [],
+        _stdlib_shards = go_config_info.stdlib_shards if go_config_info else 1,
+        _module = module,
     )
 
 def _go_context_data_impl(ctx):
     coverdata = ctx.attr.coverdata[GoArchive]
     nogo = ctx.files.nogo[0] if ctx.files.nogo else None
+    nogo_scope = ctx.attr.nogo[GoNogoScopeInfo] if GoNogoScopeInfo in ctx.attr.nogo else None
     providers = [
         GoContextInfo(
             coverdata = ctx.attr.coverdata[GoArchive],
             nogo = nogo,
+            nogo_scope = nogo_scope,
         ),
         ctx.attr.stdlib[GoStdLib],
         ctx.attr.go_config[GoConfigInfo],
@@ -718,6 +819,15 @@ def _cgo_context_data_impl(ctx):
             ld_static_lib_path = ld_static_lib_path,
             ld_dynamic_lib_path = ld_dynamic_lib_path,
             ld_dynamic_lib_options = ld_dynamic_lib_options,
+            compiler = cc_toolchain.compiler,
+            libc = getattr(cc_toolchain, "libc", ""),
+            cpu = cc_toolchain.cpu,
+            target_gnu_system_name = cc_toolchain.target_gnu_system_name,
+            # Only GCC falls back to the original header when a precompiled
+            # header doesn't match the flags of a compilation. Clang reports
+            # an error, and its precompiled headers record absolute paths,
+            # which differ between sandboxes.
+            supports_pch = cc_toolchain.compiler == "gcc",
         ),
     )]
 
@@ -753,6 +863,7 @@ cgo_context_data_proxy = rule(
 )
 
 def _go_config_impl(ctx):
+    custom_settings = ctx.attr.custom_settings[GoCustomSettingsInfo]
     return [GoConfigInfo(
         static = ctx.attr.static[BuildSettingInfo].value,
         race = ctx.attr.race[BuildSettingInfo].value,
@@ -761,8 +872,27 @@ def _go_config_impl(ctx):
         strip = ctx.attr.strip[BuildSettingInfo].value,
         debug = ctx.attr.debug[BuildSettingInfo].value,
         linkmode = ctx.attr.linkmode[BuildSettingInfo].value,
-        tags = ctx.attr.gotags[BuildSettingInfo].value,
+        pie = ctx.attr.pie[BuildSettingInfo].value,
+        tags = ctx.attr.gotags[BuildSettingInfo].value + custom_settings.tags,
+        custom_stdlib_tags = custom_settings.stdlib and len(custom_settings.tags) > 0,
+        stdlib_packages = ctx.attr.stdlib_packages[BuildSettingInfo].value,
+        stdlib_shards = ctx.attr.stdlib_shards[BuildSettingInfo].value,
+        modules = ctx.attr.modules[GoModulesInfo].modules,
+        trimpath_prefix = ctx.attr.trimpath_prefix[BuildSettingInfo].value,
+        action_metadata = ctx.attr.action_metadata[BuildSettingInfo].value,
+        compiler_concurrency = ctx.attr.compiler_concurrency[BuildSettingInfo].value,
+        cgo_concurrency = ctx.attr.cgo_concurrency[BuildSettingInfo].value,
+        start_retries = ctx.attr.start_retries[BuildSettingInfo].value,
+        nogo_fix = ctx.attr.nogo_fix[BuildSettingInfo].value,
+        nogo_sarif = ctx.attr.nogo_sarif[BuildSettingInfo].value,
+        linkstamp = ctx.attr.linkstamp[BuildSettingInfo].value,
+        build_config_digest = ctx.attr.build_config_digest[BuildSettingInfo].value,
+        cgo_trace = ctx.attr.cgo_trace[BuildSettingInfo].value,
+        fuzz = ctx.attr.fuzz[BuildSettingInfo].value,
         stamp = ctx.attr.stamp,
+        package_conflict_allowlist = ctx.files.package_conflict_allowlist[0] if ctx.files.package_conflict_allowlist else None,
+        package_conflict_remap = ctx.attr.package_conflict_remap[BuildSettingInfo].value,
+        werror_policy = ctx.files.werror_policy[0] if ctx.files.werror_policy else None,
 
         # TODO(#1374): Remove in v0.25.
         _package_conflict_is_error = ctx.attr._package_conflict_is_error[BuildSettingInfo].value,
@@ -799,11 +929,81 @@ go_config = rule(
             mandatory = True,
             providers = [BuildSettingInfo],
         ),
+        "pie": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
         "gotags": attr.label(
             mandatory = True,
             providers = [BuildSettingInfo],
         ),
+        "trimpath_prefix": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "action_metadata": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "compiler_concurrency": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "cgo_concurrency": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "start_retries": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "nogo_fix": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "nogo_sarif": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "linkstamp": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "build_config_digest": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "cgo_trace": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "fuzz": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "stdlib_packages": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "stdlib_shards": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "custom_settings": attr.label(
+            mandatory = True,
+            providers = [GoCustomSettingsInfo],
+        ),
+        "modules": attr.label(
+            mandatory = True,
+            providers = [GoModulesInfo],
+        ),
         "stamp": attr.bool(mandatory = True),
+        "package_conflict_allowlist": attr.label(allow_files = True),
+        "package_conflict_remap": attr.label(
+            mandatory = True,
+            providers = [BuildSettingInfo],
+        ),
+        "werror_policy": attr.label(allow_files = True),
         "_package_conflict_is_error": attr.label(
             default = "//go/config:incompatible_package_conflict_is_error",
         ),
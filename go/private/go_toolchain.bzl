@@ -25,6 +25,8 @@ load("@io_bazel_rules_go//go/private:actions/cover.bzl", "emit_cover")
 load("@io_bazel_rules_go//go/private:actions/link.bzl", "emit_link")
 load("@io_bazel_rules_go//go/private:actions/pack.bzl", "emit_pack")
 load("@io_bazel_rules_go//go/private:actions/stdlib.bzl", "emit_stdlib")
+load("@io_bazel_rules_go//go/private:skylib/lib/versions.bzl", "versions")
+load("@bazel_skylib//lib:selects.bzl", "selects")
 
 def _go_toolchain_impl(ctx):
     sdk = ctx.attr.sdk[GoSDK]
@@ -54,6 +56,8 @@ def _go_toolchain_impl(ctx):
 
         # Internal fields -- may be read by emit functions.
         _builder = ctx.executable.builder,
+        _test_runner = ctx.attr.test_runner,
+        _test_runner_flags = ctx.attr.test_runner_flags,
     )]
 
 go_toolchain = rule(
@@ -87,16 +91,30 @@ go_toolchain = rule(
         "cgo_link_flags": attr.string_list(
             doc = "Flags passed to the external linker (if it is used)",
         ),
+        "test_runner": attr.label(
+            executable = True,
+            cfg = "target",
+            doc = """Tool used to run tests that can't be executed directly,
+            like a WebAssembly runtime or an emulator. It's called with
+            test_runner_flags, the test binary, and the test's arguments""",
+        ),
+        "test_runner_flags": attr.string_list(
+            doc = "Flags passed to test_runner before the test binary",
+        ),
     },
     doc = "Defines a Go toolchain based on an SDK",
     provides = [platform_common.ToolchainInfo],
 )
 
-def declare_toolchains(host, sdk, builder):
+def declare_toolchains(host, sdk, builder, sdk_version = ""):
     """Declares go_toolchain and toolchain targets for each platform."""
 
     # keep in sync with generate_toolchain_names
     host_goos, _, host_goarch = host.partition("_")
+    toolchain_kwargs = {}
+    if sdk_version and _supports_target_settings():
+        _declare_sdk_version_settings(sdk_version)
+        toolchain_kwargs["target_settings"] = [":match_sdk_version"]
     for p in PLATFORMS:
         if p.cgo:
             # Don't declare separate toolchains for cgo_on / cgo_off.
@@ -110,6 +128,9 @@ def declare_toolchains(host, sdk, builder):
             cgo_link_flags.extend(["-shared", "-Wl,-all_load"])
         if host_goos == "linux":
             cgo_link_flags.append("-Wl,-whole-archive")
+        test_runner = None
+        if p.goos == "wasip1":
+            test_runner = "@io_bazel_rules_go//go/private:wasmtime_runner"
 
         toolchain_name = "go_" + p.name
         impl_name = toolchain_name + "-impl"
@@ -128,6 +149,7 @@ def declare_toolchains(host, sdk, builder):
             builder = builder,
             link_flags = link_flags,
             cgo_link_flags = cgo_link_flags,
+            test_runner = test_runner,
             tags = ["manual"],
             visibility = ["//visibility:public"],
         )
@@ -140,4 +162,40 @@ def declare_toolchains(host, sdk, builder):
             ],
             target_compatible_with = constraints,
             toolchain = ":" + impl_name,
+            **toolchain_kwargs
+        )
+
+def _supports_target_settings():
+    # toolchain's target_settings attribute was added in Bazel 5.0. Older
+    # versions can't choose between SDKs, so the first one registered is used.
+    bazel_version = getattr(native, "bazel_version", "")
+    return not bazel_version or versions.is_at_least("5.0.0", bazel_version)
+
+def _declare_sdk_version_settings(sdk_version):
+    # The SDK's toolchains match when //go/toolchain:sdk_version is unset or
+    # names the SDK's minor version, like "1.14", or its exact version, like
+    # "1.14.4".
+    flag = "@io_bazel_rules_go//go/toolchain:sdk_version"
+    minor_version = ".".join(sdk_version.split(".")[:2])
+    native.config_setting(
+        name = "match_all_versions",
+        flag_values = {flag: ""},
+        visibility = ["//visibility:private"],
+    )
+    native.config_setting(
+        name = "match_minor_version",
+        flag_values = {flag: minor_version},
+        visibility = ["//visibility:private"],
+    )
+    settings = [":match_all_versions", ":match_minor_version"]
+    if sdk_version != minor_version:
+        native.config_setting(
+            name = "match_exact_version",
+            flag_values = {flag: sdk_version},
+            visibility = ["//visibility:private"],
         )
+        settings.append(":match_exact_version")
+    selects.config_setting_group(
+        name = "match_sdk_version",
+        match_any = settings,
+    )
@@ -36,6 +36,8 @@ def mode_string(mode):
         result.append("race")
     if mode.msan:
         result.append("msan")
+    if mode.lto:
+        result.append(mode.lto + "lto")
     if mode.pure:
         result.append("pure")
     if mode.debug:
@@ -64,9 +66,71 @@ def _ternary(*values):
         fail("Invalid value {}".format(v))
     fail("_ternary failed to produce a final result from {}".format(values))
 
+def _uses_musl(cgo_context_info):
+    return bool(cgo_context_info) and cgo_context_info.cgo_tools.libc.startswith("musl")
+
+# Architectures targeted by C/C++ toolchains with common values of cpu, as
+# chosen by Bazel's built-in toolchains and rules_go. Toolchains with other
+# values aren't checked, since names vary.
+_CC_CPU_GOARCH = {
+    "aarch64": "arm64",
+    "arm64-v8a": "arm64",
+    "armeabi-v7a": "arm",
+    "darwin_arm64": "arm64",
+    "darwin_x86_64": "amd64",
+    "ios_arm64": "arm64",
+    "ios_armv7": "arm",
+    "ios_i386": "386",
+    "ios_sim_arm64": "arm64",
+    "ios_x86_64": "amd64",
+    "k8": "amd64",
+    "s390x": "s390x",
+    "x64_windows": "amd64",
+    "x86_64": "amd64",
+}
+
+# Substrings of GNU system names identifying the OS a C/C++ toolchain targets.
+# Autoconfigured host toolchains have the name "local", which isn't checked.
+_CC_SYSTEM_GOOS = [
+    ("android", ["android"]),
+    ("apple", ["darwin"]),
+    ("darwin", ["darwin"]),
+    ("freebsd", ["freebsd"]),
+    ("linux", ["linux"]),
+    ("mingw", ["windows"]),
+    ("windows", ["windows"]),
+]
+
+def _check_cc_toolchain(goos, goarch, cgo_tools):
+    """Fails if the C/C++ toolchain used for cgo clearly targets a different
+    platform than Go code. Otherwise, the mismatch would only be reported by
+    the linker, with errors about incompatible objects."""
+    problem = None
+    cc_goarch = _CC_CPU_GOARCH.get(cgo_tools.cpu)
+    if cc_goarch and cc_goarch != goarch:
+        problem = "targets {}".format(cgo_tools.cpu)
+    else:
+        # An android toolchain's triple also contains "linux", so Android is
+        # checked first.
+        for system, goos_list in _CC_SYSTEM_GOOS:
+            if system in cgo_tools.target_gnu_system_name:
+                if goos not in goos_list:
+                    problem = "targets {}".format(cgo_tools.target_gnu_system_name)
+                break
+    if problem:
+        fail(("cgo is enabled for {}/{}, but the C/C++ toolchain {}. Register a C/C++ toolchain " +
+              "for the target platform and build with --incompatible_enable_cc_toolchain_resolution, " +
+              "or set pure = \"on\" to build without cgo. See \"Cross compilation\" in go/core.rst.").format(
+            goos,
+            goarch,
+            problem,
+        ))
+
 def get_mode(ctx, go_toolchain, cgo_context_info, go_config_info):
+    # Binaries are always linked statically with a musl C toolchain, since
+    # that's the reason to use one.
     static = _ternary(
-        "on" if "static" in ctx.features else "auto",
+        "on" if ("static" in ctx.features or "fully_static_link" in ctx.features or _uses_musl(cgo_context_info)) else "auto",
         go_config_info.static if go_config_info else "off",
     )
     pure = _ternary(
@@ -81,12 +145,35 @@ def get_mode(ctx, go_toolchain, cgo_context_info, go_config_info):
         "on" if ("msan" in ctx.features and not pure) else "auto",
         go_config_info.msan if go_config_info else "off",
     )
+
+    # Link-time optimization follows the C/C++ features of the same names.
+    # It applies to C and C++ code built by cgo; Go code is unaffected.
+    lto = ""
+    if not pure:
+        if "thin_lto" in ctx.features:
+            lto = "thin"
+        elif "lto" in ctx.features:
+            lto = "full"
     strip = go_config_info.strip if go_config_info else False
     stamp = go_config_info.stamp if go_config_info else False
     debug = go_config_info.debug if go_config_info else False
+    trimpath_prefix = go_config_info.trimpath_prefix if go_config_info else ""
     linkmode = go_config_info.linkmode if go_config_info else LINKMODE_NORMAL
+    pie = go_config_info.pie if go_config_info else "off"
     goos = go_toolchain.default_goos
     goarch = go_toolchain.default_goarch
+    if linkmode == LINKMODE_NORMAL:
+        if pie == "on":
+            if pure:
+                fail("position-independent executables can't be built when cgo is disabled. Check that pure is not set to \"on\" and a C/C++ toolchain is configured.")
+            linkmode = LINKMODE_PIE
+        elif (pie == "auto" or goos == "android") and _pie_by_default(goos, goarch, pure, static):
+            # Android only runs position-independent executables, so go build
+            # always links them that way there, whatever the pie setting.
+            linkmode = LINKMODE_PIE
+
+    if not pure:
+        _check_cc_toolchain(goos, goarch, cgo_context_info.cgo_tools)
 
     # TODO(jayconrod): check for more invalid and contradictory settings.
     if pure and race:
@@ -108,11 +195,13 @@ def get_mode(ctx, go_toolchain, cgo_context_info, go_config_info):
         static = static,
         race = race,
         msan = msan,
+        lto = lto,
         pure = pure,
         link = linkmode,
         strip = strip,
         stamp = stamp,
         debug = debug,
+        trimpath_prefix = trimpath_prefix,
         goos = goos,
         goarch = goarch,
         tags = tags,
@@ -126,6 +215,17 @@ def installsuffix(mode):
         s += "_msan"
     return s
 
+def stdlib_mode_key(mode):
+    """Returns the name of the standard library built for mode, as used for
+    prebuilt standard libraries, like "linux_amd64_race" or
+    "darwin_amd64_pure_c-archive"."""
+    key = installsuffix(mode)
+    if mode.pure:
+        key += "_pure"
+    if mode.link != LINKMODE_NORMAL:
+        key += "_" + mode.link
+    return key
+
 def mode_tags_equivalent(l, r):
     """Returns whether two modes are equivalent for Go build tags. For example,
     goos and goarch must match, but static doesn't matter."""
@@ -176,6 +276,7 @@ _LINK_PLUGIN_PLATFORMS = {
     "darwin/amd64": None,
 }
 
+# Keep in sync with pieSupportedPlatforms in go/tools/builders/buildmode.go.
 _LINK_PIE_PLATFORMS = {
     "linux/amd64": None,
     "linux/arm": None,
@@ -190,6 +291,29 @@ _LINK_PIE_PLATFORMS = {
     "freebsd/amd64": None,
 }
 
+# Platforms where executables are position-independent by convention. Linux
+# distributions build their own packages as PIE for address space layout
+# randomization, and Android refuses to run anything else.
+_PIE_DEFAULT_PLATFORMS = {
+    "linux/amd64": None,
+    "linux/arm64": None,
+    "linux/ppc64le": None,
+    "linux/s390x": None,
+    "android/amd64": None,
+    "android/arm": None,
+    "android/arm64": None,
+    "android/386": None,
+}
+
+def _pie_by_default(goos, goarch, pure, static):
+    """Returns whether binaries should be position-independent when the pie
+    setting is "auto". PIE requires the external linker, so it's off in pure
+    mode. It's also off for static binaries, since most C toolchains can't
+    link with both -static and -pie."""
+    if pure or static:
+        return False
+    return goos + "/" + goarch in _PIE_DEFAULT_PLATFORMS
+
 def link_mode_args(mode):
     # based on buildModeInit in cmd/go/internal/work/init.go
     platform = mode.goos + "/" + mode.goarch
@@ -220,6 +344,30 @@ def extldflags_from_cc_toolchain(go):
         # in each package. We use the executable options for this.
         return go.cgo_tools.ld_executable_options
 
+def static_link_options(go):
+    """Returns external linker options for a static binary.
+
+    With glibc, a static binary that uses cgo may still load shared libraries
+    at run time for name lookups, and it breaks when the target's glibc
+    differs from the one it was linked with. musl doesn't have that problem,
+    and it supports static position-independent executables."""
+    musl = go.cgo_tools and go.cgo_tools.libc.startswith("musl")
+    if go.mode.link == LINKMODE_PIE:
+        if not musl:
+            fail("static position-independent executables require a musl C toolchain; see \"Building static binaries\" in go/modes.rst")
+        return ["-static-pie"]
+    return ["-static"]
+
+def lto_options(go):
+    """Returns C/C++ compiler and linker options for link-time optimization
+    of cgo code, or an empty list if it's not enabled. GCC doesn't support
+    ThinLTO, so it does full LTO instead."""
+    if not go.mode.lto or not go.cgo_tools:
+        return []
+    if go.mode.lto == "thin" and go.cgo_tools.compiler != "gcc":
+        return ["-flto=thin"]
+    return ["-flto"]
+
 def extld_from_cc_toolchain(go):
     if not go.cgo_tools:
         return []
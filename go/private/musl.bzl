@@ -0,0 +1,76 @@
+# Copyright 2014 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:platforms.bzl",
+    "GOARCH_CONSTRAINTS",
+    "MUSL_GOOS_GOARCH",
+)
+
+# GNU target triples and Bazel CPU names of musl cross compilers, as built by
+# musl-cross-make.
+_MUSL_TARGETS = {
+    "amd64": struct(triple = "x86_64-linux-musl", cpu = "k8"),
+    "arm64": struct(triple = "aarch64-linux-musl", cpu = "aarch64"),
+}
+
+def _go_musl_toolchain_impl(ctx):
+    if ("linux", ctx.attr.goarch) not in MUSL_GOOS_GOARCH:
+        fail("{}: goarch {} is not supported; want one of {}".format(
+            ctx.name,
+            ctx.attr.goarch,
+            ", ".join([goarch for _, goarch in MUSL_GOOS_GOARCH.keys()]),
+        ))
+    if not ctx.attr.urls:
+        fail("{}: no urls specified".format(ctx.name))
+    target = _MUSL_TARGETS[ctx.attr.goarch]
+    ctx.download_and_extract(
+        url = ctx.attr.urls,
+        sha256 = ctx.attr.sha256,
+        stripPrefix = ctx.attr.strip_prefix,
+    )
+    if not ctx.path("bin/{}-gcc".format(target.triple)).exists:
+        fail("{}: bin/{}-gcc not found in the downloaded archive; check strip_prefix".format(ctx.name, target.triple))
+    ctx.template(
+        "BUILD.bazel",
+        Label("@io_bazel_rules_go//go/private:BUILD.musl.bazel"),
+        executable = False,
+        substitutions = {
+            "{repo}": ctx.name,
+            "{triple}": target.triple,
+            "{cpu}": target.cpu,
+            "{cpu_constraint}": GOARCH_CONSTRAINTS[ctx.attr.goarch],
+            "{exec_compatible_with}": ", ".join(['"{}"'.format(c) for c in ctx.attr.exec_compatible_with]),
+        },
+    )
+
+_go_musl_toolchain = repository_rule(
+    _go_musl_toolchain_impl,
+    attrs = {
+        "goarch": attr.string(mandatory = True),
+        "urls": attr.string_list(mandatory = True),
+        "sha256": attr.string(),
+        "strip_prefix": attr.string(),
+        "exec_compatible_with": attr.string_list(
+            default = [
+                "@platforms//os:linux",
+                "@platforms//cpu:x86_64",
+            ],
+        ),
+    },
+)
+
+def go_musl_toolchain(name, **kwargs):
+    _go_musl_toolchain(name = name, **kwargs)
+    native.register_toolchains("@{}//:toolchain".format(name))
@@ -77,6 +77,7 @@ GOOS_GOARCH = (
     ("plan9", "amd64"),
     ("plan9", "arm"),
     ("solaris", "amd64"),
+    ("wasip1", "wasm"),
     ("windows", "386"),
     ("windows", "amd64"),
     ("windows", "arm"),
@@ -132,6 +133,20 @@ CGO_GOOS_GOARCH = {
     ("windows", "amd64"): None,
 }
 
+# Platforms with a musl C toolchain, which can link fully static binaries
+# with cgo. See go_musl_toolchain.
+MUSL_GOOS_GOARCH = {
+    ("linux", "amd64"): None,
+    ("linux", "arm64"): None,
+}
+
+# Platforms with a glibc sysroot, for cross-compiling cgo code against a
+# known version of glibc instead of the host's. See go_sysroot_toolchain.
+GLIBC_GOOS_GOARCH = {
+    ("linux", "amd64"): None,
+    ("linux", "arm64"): None,
+}
+
 def _generate_constraints(names, bazel_constraints):
     return {
         name: bazel_constraints.get(name, "@io_bazel_rules_go//go/toolchain:" + name)
@@ -166,6 +181,28 @@ def _generate_platforms():
                 constraints = constraints + ["@io_bazel_rules_go//go/toolchain:cgo_on"] + mingw,
                 cgo = True,
             ))
+        if (goos, goarch) in MUSL_GOOS_GOARCH:
+            platforms.append(struct(
+                name = goos + "_" + goarch + "_musl",
+                goos = goos,
+                goarch = goarch,
+                constraints = constraints + [
+                    "@io_bazel_rules_go//go/toolchain:cgo_on",
+                    "@io_bazel_rules_go//go/toolchain:musl",
+                ],
+                cgo = True,
+            ))
+        if (goos, goarch) in GLIBC_GOOS_GOARCH:
+            platforms.append(struct(
+                name = goos + "_" + goarch + "_glibc",
+                goos = goos,
+                goarch = goarch,
+                constraints = constraints + [
+                    "@io_bazel_rules_go//go/toolchain:cgo_on",
+                    "@io_bazel_rules_go//go/toolchain:glibc",
+                ],
+                cgo = True,
+            ))
 
     for goarch in ("arm", "arm64", "386", "amd64"):
         constraints = [
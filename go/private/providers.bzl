@@ -34,6 +34,20 @@ GoArchiveData = provider()
 # See go/providers.rst#GoArchive for full documentation.
 GoArchive = provider()
 
+# The build tags a target was compiled with and a report of which of its
+# source files they selected.
+# This is a configuration specific provider.
+# See go/providers.rst#GoBuildTagsInfo for full documentation.
+GoBuildTagsInfo = provider()
+
+# GoNogoInputsInfo is provided by the aspect nogo_test uses to collect the
+# packages it checks. It lets nogo run on packages after they're compiled.
+# See go/providers.rst#GoNogoInputsInfo for full documentation.
+GoNogoInputsInfo = provider()
+
+# GoNogoScopeInfo is provided by nogo. It describes the targets nogo checks.
+GoNogoScopeInfo = provider()
+
 GoAspectProviders = provider()
 
 GoPath = provider()
@@ -56,6 +70,11 @@ GoSDK = provider(
         "tools": ("List of executable files in the SDK built for " +
                   "the execution platform, excluding the go binary file"),
         "go": "The go binary file",
+        "env": ("Default environment variables for actions that use the " +
+                "SDK and for tests, for example, GODEBUG."),
+        "prebuilt_stdlibs": ("A dict of GoStdLib providers for standard " +
+                             "libraries compiled ahead of time, keyed by " +
+                             "the modes they were compiled for."),
     },
 )
 
@@ -63,6 +82,12 @@ GoStdLib = provider()
 
 GoConfigInfo = provider()
 
+GoCustomSettingsInfo = provider()
+
+GoModuleInfo = provider()
+
+GoModulesInfo = provider()
+
 GoContextInfo = provider()
 
 CgoContextInfo = provider()
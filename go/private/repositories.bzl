@@ -17,6 +17,7 @@
 load("//go/private:common.bzl", "MINIMUM_BAZEL_VERSION")
 load("//go/private:skylib/lib/versions.bzl", "versions")
 load("//go/private:nogo.bzl", "DEFAULT_NOGO", "go_register_nogo")
+load("//go/private:wasm.bzl", "go_download_wasmtime")
 load("//proto:gogo.bzl", "gogo_special_proto")
 load("@bazel_tools//tools/build_defs/repo:git.bzl", "git_repository")
 load("@bazel_tools//tools/build_defs/repo:http.bzl", "http_archive")
@@ -273,6 +274,13 @@ def go_rules_dependencies(is_rules_go = False):
         nogo = DEFAULT_NOGO,
     )
 
+    # Runs go_test targets built for wasip1. It's only downloaded when such
+    # a test is built.
+    _maybe(
+        go_download_wasmtime,
+        name = "go_wasmtime",
+    )
+
     go_name_hack(
         name = "io_bazel_rules_go_name_hack",
         is_rules_go = is_rules_go,
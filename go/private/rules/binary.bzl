@@ -12,15 +12,25 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+load(
+    "@bazel_tools//tools/cpp:toolchain_utils.bzl",
+    "find_cpp_toolchain",
+)
 load(
     ":context.bzl",
     "go_context",
 )
+load(
+    ":actions/build_tags.bzl",
+    "emit_build_tags",
+)
 load(
     ":common.bzl",
     "asm_exts",
     "cgo_exts",
+    "expand_env",
     "go_exts",
+    "has_shared_lib_extension",
 )
 load(
     ":providers.bzl",
@@ -33,6 +43,8 @@ load(
 )
 load(
     ":mode.bzl",
+    "LINKMODE_C_ARCHIVE",
+    "LINKMODE_C_SHARED",
     "LINKMODE_PLUGIN",
     "LINKMODE_SHARED",
 )
@@ -53,6 +65,12 @@ def _go_binary_impl(ctx):
         # directly, Bazel warns them not to use the same name as the rule, which is
         # the common case with go_binary.
         executable = ctx.actions.declare_file(ctx.attr.out)
+    link_metadata = None
+    if go._action_metadata:
+        link_metadata = go.declare_file(go, ext = ".link.meta.json")
+    symbol_map = None
+    if go.mode.link != LINKMODE_C_ARCHIVE:
+        symbol_map = go.declare_file(go, ext = ".symbols.json")
     archive, executable, runfiles = go.binary(
         go,
         name = name,
@@ -61,14 +79,26 @@ def _go_binary_impl(ctx):
         version_file = ctx.version_file,
         info_file = ctx.info_file,
         executable = executable,
+        out_metadata = link_metadata,
+        out_symbol_map = symbol_map,
     )
-    return [
+    build_tags = emit_build_tags(go, source)
+    providers = [
         library,
         source,
         archive,
+        build_tags,
         OutputGroupInfo(
             cgo_exports = archive.cgo_exports,
             compilation_outputs = [archive.data.file],
+            go_action_metadata = depset(
+                direct = [link_metadata] if link_metadata else [],
+                transitive = [archive.action_metadata],
+            ),
+            nogo_fix = archive.nogo_fixes,
+            nogo_sarif = archive.nogo_sarif_reports,
+            go_build_tags = [build_tags.report],
+            go_symbol_map = [symbol_map] if symbol_map else [],
         ),
         DefaultInfo(
             files = depset([executable]),
@@ -76,12 +106,20 @@ def _go_binary_impl(ctx):
             executable = executable,
         ),
     ]
+    if ctx.attr.env:
+        # Newer versions of Bazel set this environment for "bazel run", and
+        # older versions ignore it for binaries.
+        providers.append(testing.TestEnvironment(expand_env(ctx)))
+    return providers
 
 _go_binary_kwargs = {
     "implementation": _go_binary_impl,
     "attrs": {
         "srcs": attr.label_list(allow_files = go_exts + asm_exts + cgo_exts),
+        "embedsrcs": attr.label_list(allow_files = True),
+        "symabis": attr.label_list(allow_files = [".symabis"]),
         "data": attr.label_list(allow_files = True),
+        "env": attr.string_dict(),
         "deps": attr.label_list(
             providers = [GoLibrary],
         ),
@@ -90,6 +128,7 @@ _go_binary_kwargs = {
         ),
         "importpath": attr.string(),
         "gc_goopts": attr.string_list(),
+        "werror": attr.string_list(),
         "gc_linkopts": attr.string_list(),
         "x_defs": attr.string_dict(),
         "basename": attr.string(),
@@ -99,6 +138,7 @@ _go_binary_kwargs = {
         "cppopts": attr.string_list(),
         "copts": attr.string_list(),
         "cxxopts": attr.string_list(),
+        "cxxpch": attr.label(allow_single_file = [".h", ".hh", ".hpp", ".hxx"]),
         "clinkopts": attr.string_list(),
         "_go_context_data": attr.label(default = "//:go_context_data"),
     },
@@ -109,54 +149,215 @@ _go_binary_kwargs = {
 go_binary = rule(**_go_binary_kwargs)
 go_transition_binary = go_transition_rule(**_go_binary_kwargs)
 
-def _go_tool_binary_impl(ctx):
-    sdk = ctx.attr.sdk[GoSDK]
-    name = ctx.label.name
-    if sdk.goos == "windows":
-        name += ".exe"
+def _cc_library_to_link(ctx, feature_configuration, cc_toolchain, f, alwayslink = False):
+    if has_shared_lib_extension(f.basename):
+        return cc_common.create_library_to_link(
+            actions = ctx.actions,
+            feature_configuration = feature_configuration,
+            cc_toolchain = cc_toolchain,
+            dynamic_library = f,
+        )
+    return cc_common.create_library_to_link(
+        actions = ctx.actions,
+        feature_configuration = feature_configuration,
+        cc_toolchain = cc_toolchain,
+        static_library = f,
+        alwayslink = alwayslink,
+    )
 
-    cout = ctx.actions.declare_file(name + ".a")
+def _go_cc_library_impl(ctx):
+    """Links a Go program in c-shared or c-archive mode and describes it with
+    CcInfo, so C and C++ rules can depend on it."""
+    go = go_context(ctx)
+    if go.mode.link not in (LINKMODE_C_SHARED, LINKMODE_C_ARCHIVE):
+        fail("{} must be built with linkmode = \"c-shared\" or \"c-archive\"".format(ctx.label))
+
+    library = go.new_library(go, importable = False, is_main = True)
+    source = go.library_to_source(go, ctx.attr, library, ctx.coverage_instrumented())
+    archive, lib, runfiles = go.binary(
+        go,
+        name = ctx.label.name,
+        source = source,
+        gc_linkopts = gc_linkopts(ctx),
+        version_file = ctx.version_file,
+        info_file = ctx.info_file,
+    )
+
+    # Like "go build -buildmode=c-shared" and "c-archive", declare the
+    # functions exported by all packages in one header.
+    header = ctx.actions.declare_file(ctx.label.name + ".h")
+    cgo_exports = archive.cgo_exports.to_list()
+    if cgo_exports:
+        ctx.actions.run_shell(
+            inputs = cgo_exports,
+            outputs = [header],
+            command = "cat \"$@\" > {}".format(header.path),
+            arguments = [f.path for f in cgo_exports],
+            mnemonic = "GoCcLibraryHeader",
+        )
+    else:
+        ctx.actions.write(header, "")
+
+    cc_toolchain = find_cpp_toolchain(ctx)
+    feature_configuration = cc_common.configure_features(
+        ctx = ctx,
+        cc_toolchain = cc_toolchain,
+        requested_features = ctx.features,
+        unsupported_features = ctx.disabled_features,
+    )
+
+    # The whole library is linked, so the Go runtime is initialized even if
+    # nothing refers to it directly. A c-archive doesn't include the C
+    # libraries the cgo code depends on or the system libraries the runtime
+    # needs, so those are linked by the program using it.
+    libraries = [_cc_library_to_link(ctx, feature_configuration, cc_toolchain, lib, alwayslink = True)]
+    if go.mode.link == LINKMODE_C_ARCHIVE:
+        libraries.extend([
+            _cc_library_to_link(ctx, feature_configuration, cc_toolchain, f)
+            for f in archive.cgo_deps.to_list()
+        ])
+        if go.mode.goos == "darwin":
+            linkopts = ["-framework", "CoreFoundation", "-framework", "Security"]
+        elif go.mode.goos == "windows":
+            linkopts = ["-mthreads", "-lwinmm", "-lntdll", "-lws2_32"]
+        else:
+            linkopts = ["-lpthread"]
+    elif go.mode.goos == "darwin":
+        linkopts = []
+    elif go.mode.goos == "windows":
+        linkopts = ["-mthreads"]
+    else:
+        linkopts = ["-pthread"]
+
+    if hasattr(cc_common, "create_linker_input"):
+        linking_context = cc_common.create_linking_context(
+            linker_inputs = depset([cc_common.create_linker_input(
+                owner = ctx.label,
+                libraries = depset(libraries),
+                user_link_flags = depset(linkopts),
+            )]),
+        )
+    else:
+        linking_context = cc_common.create_linking_context(
+            libraries_to_link = libraries,
+            user_link_flags = linkopts,
+        )
+    cc_info = CcInfo(
+        compilation_context = cc_common.create_compilation_context(
+            headers = depset([header]),
+        ),
+        linking_context = linking_context,
+    )
+
+    return [
+        library,
+        source,
+        archive,
+        cc_info,
+        OutputGroupInfo(
+            cgo_exports = archive.cgo_exports,
+            compilation_outputs = [archive.data.file],
+            nogo_fix = archive.nogo_fixes,
+            nogo_sarif = archive.nogo_sarif_reports,
+        ),
+        DefaultInfo(
+            files = depset([lib, header]),
+            runfiles = runfiles,
+        ),
+    ]
+
+_go_cc_library_attrs = {
+    k: v
+    for k, v in _go_binary_kwargs["attrs"].items()
+    if k not in ("basename", "out", "cgo")
+}
+_go_cc_library_attrs.update({
+    "cgo": attr.bool(default = True),
+    "_cc_toolchain": attr.label(default = "@bazel_tools//tools/cpp:current_cc_toolchain"),
+})
+
+_go_cc_library_kwargs = {
+    "implementation": _go_cc_library_impl,
+    "attrs": _go_cc_library_attrs,
+    "fragments": ["cpp"],
+    "provides": [CcInfo],
+    "toolchains": [
+        "@io_bazel_rules_go//go:toolchain",
+        "@bazel_tools//tools/cpp:toolchain_type",
+    ],
+}
+
+go_shared_library = go_transition_rule(**_go_cc_library_kwargs)
+go_c_archive = go_transition_rule(**_go_cc_library_kwargs)
+
+def _go_tool_compile(ctx, sdk, out, srcs, deps, flags):
+    """Compiles srcs into the archive out using only tools from the SDK."""
+    inputs = sdk.libs + sdk.headers + sdk.tools + srcs + deps + [sdk.go]
     if sdk.goos == "windows":
-        cmd = "@echo off\n {go} tool compile -o {cout} -trimpath=%cd% {srcs}".format(
+        cmd = "@echo off\n {go} tool compile {flags} -o {out} -trimpath=%cd% {srcs}".format(
             go = sdk.go.path.replace("/", "\\"),
-            cout = cout.path,
-            srcs = " ".join([f.path for f in ctx.files.srcs]),
+            flags = " ".join(flags),
+            out = out.path,
+            srcs = " ".join([f.path for f in srcs]),
         )
-        bat = ctx.actions.declare_file(name + ".bat")
+        bat = ctx.actions.declare_file(out.basename[:-len(".a")] + ".bat", sibling = out)
         ctx.actions.write(
             output = bat,
             content = cmd,
         )
         ctx.actions.run(
             executable = bat,
-            inputs = sdk.libs + sdk.headers + sdk.tools + ctx.files.srcs + [sdk.go],
-            outputs = [cout],
+            inputs = inputs,
+            outputs = [out],
             env = {"GOROOT": sdk.root_file.dirname},  # NOTE(#2005): avoid realpath in sandbox
             mnemonic = "GoToolchainBinaryCompile",
         )
     else:
-        cmd = "{go} tool compile -o {cout} -trimpath=$PWD {srcs}".format(
+        cmd = "{go} tool compile {flags} -o {out} -trimpath=$PWD {srcs}".format(
             go = sdk.go.path,
-            cout = cout.path,
-            srcs = " ".join([f.path for f in ctx.files.srcs]),
+            flags = " ".join(flags),
+            out = out.path,
+            srcs = " ".join([f.path for f in srcs]),
         )
         ctx.actions.run_shell(
             command = cmd,
-            inputs = sdk.libs + sdk.headers + sdk.tools + ctx.files.srcs + [sdk.go],
-            outputs = [cout],
+            inputs = inputs,
+            outputs = [out],
             env = {"GOROOT": sdk.root_file.dirname},  # NOTE(#2005): avoid realpath in sandbox
             mnemonic = "GoToolchainBinaryCompile",
         )
 
+def _go_tool_binary_impl(ctx):
+    sdk = ctx.attr.sdk[GoSDK]
+    name = ctx.label.name
+    if sdk.goos == "windows":
+        name += ".exe"
+
+    # Libraries are compiled into a directory laid out by import path, which
+    # the compiler and linker search with -I and -L.
+    dep_archives = []
+    dep_flags = []
+    for dep, importpath in ctx.attr.deps.items():
+        archive = ctx.actions.declare_file("{}_deps/{}.a".format(ctx.label.name, importpath))
+        dep_dir = archive.path[:-len("/{}.a".format(importpath))]
+        dep_flags = ["-I", dep_dir]
+        _go_tool_compile(ctx, sdk, archive, dep.files.to_list(), dep_archives, ["-p", importpath] + dep_flags)
+        dep_archives.append(archive)
+
+    cout = ctx.actions.declare_file(name + ".a")
+    _go_tool_compile(ctx, sdk, cout, ctx.files.srcs, dep_archives, dep_flags)
+
     out = ctx.actions.declare_file(name)
     largs = ctx.actions.args()
     largs.add_all(["tool", "link"])
+    if dep_flags:
+        largs.add("-L", dep_flags[1])
     largs.add("-o", out)
     largs.add(cout)
     ctx.actions.run(
         executable = sdk.go,
         arguments = [largs],
-        inputs = sdk.libs + sdk.headers + sdk.tools + [cout],
+        inputs = sdk.libs + sdk.headers + sdk.tools + dep_archives + [cout],
         outputs = [out],
         mnemonic = "GoToolchainBinary",
     )
@@ -173,6 +374,12 @@ go_tool_binary = rule(
             allow_files = True,
             doc = "Source files for the binary. Must be in 'package main'.",
         ),
+        "deps": attr.label_keyed_string_dict(
+            allow_files = True,
+            doc = """Source files of libraries the binary imports, mapped to
+            their import paths. Libraries are compiled in order, and each may
+            import the ones before it.""",
+        ),
         "sdk": attr.label(
             mandatory = True,
             providers = [GoSDK],
@@ -184,8 +391,8 @@ go_tool_binary = rule(
 
 go_tool_binary depends on tools and libraries that are part of the Go SDK.
 It does not depend on other toolchains. It can only compile binaries that
-just have a main package and only depend on the standard library and don't
-require build constraints.
+have a main package and a few libraries listed in deps, which only depend on
+the standard library and each other, and don't require build constraints.
 """,
 )
 
@@ -24,6 +24,7 @@ load(
     "LINKMODE_C_SHARED",
     "LINKMODE_NORMAL",
     "extldflags_from_cc_toolchain",
+    "lto_options",
 )
 load(
     "@rules_cc//cc:defs.bzl",
@@ -56,19 +57,54 @@ def cgo_configure(go, srcs, cdeps, cppopts, copts, cxxopts, clinkopts):
         objcopts: complete list of Objective-C compiler options.
         objcxxopts: complete list of Objective-C++ compiler options.
         clinkopts: complete list of linker options.
+        trace: list of strings, each with an option and the target or
+            setting it came from, separated by a tab. Empty unless
+            //go/config:cgo_trace is set.
     """
     if not go.cgo_tools:
         fail("Go toolchain does not support cgo")
 
-    cppopts = list(cppopts)
+    # trace records where each option came from, so the builder can log it.
+    # It's None when tracing is disabled, and _trace_opts does nothing.
+    trace = [] if go._cgo_trace else None
+    label = str(go._ctx.label)
+    _trace_opts(trace, cppopts, "cppopts of " + label)
+    _trace_opts(trace, go.cgo_tools.c_compile_options, "C/C++ toolchain")
+    _trace_opts(trace, go.cgo_tools.cxx_compile_options, "C/C++ toolchain")
+    _trace_opts(trace, go.cgo_tools.objc_compile_options, "C/C++ toolchain")
+    _trace_opts(trace, go.cgo_tools.objcxx_compile_options, "C/C++ toolchain")
+    env_cppopts = _sdk_env_opts(go, "CGO_CPPFLAGS")
+    env_copts = _sdk_env_opts(go, "CGO_CFLAGS")
+    env_cxxopts = _sdk_env_opts(go, "CGO_CXXFLAGS")
+    env_clinkopts = _sdk_env_opts(go, "CGO_LDFLAGS")
+    _trace_opts(trace, env_cppopts, "env of Go SDK")
+    _trace_opts(trace, env_copts, "env of Go SDK")
+    _trace_opts(trace, env_cxxopts, "env of Go SDK")
+    _trace_opts(trace, copts, "copts of " + label)
+    _trace_opts(trace, cxxopts, "cxxopts of " + label)
+
+    cppopts = env_cppopts + cppopts
     base_dir, _, _ = go._ctx.build_file_path.rpartition("/")
     if base_dir:
         cppopts.extend(["-I", base_dir])
-    copts = go.cgo_tools.c_compile_options + copts
-    cxxopts = go.cgo_tools.cxx_compile_options + cxxopts
+        _trace_opts(trace, ["-I", base_dir], "directory of " + label)
+    copts = go.cgo_tools.c_compile_options + env_copts + copts
+    cxxopts = go.cgo_tools.cxx_compile_options + env_cxxopts + cxxopts
     objcopts = go.cgo_tools.objc_compile_options + copts
     objcxxopts = go.cgo_tools.objcxx_compile_options + cxxopts
-    clinkopts = extldflags_from_cc_toolchain(go) + clinkopts
+    toolchain_clinkopts = extldflags_from_cc_toolchain(go)
+    _trace_opts(trace, toolchain_clinkopts, "C/C++ toolchain")
+    _trace_opts(trace, env_clinkopts, "env of Go SDK")
+    _trace_opts(trace, clinkopts, "clinkopts of " + label)
+    clinkopts = toolchain_clinkopts + env_clinkopts + clinkopts
+    lto_opts = lto_options(go)
+    if lto_opts:
+        _trace_opts(trace, lto_opts, "features of " + label)
+        copts = copts + lto_opts
+        cxxopts = cxxopts + lto_opts
+        objcopts = objcopts + lto_opts
+        objcxxopts = objcxxopts + lto_opts
+        clinkopts = clinkopts + lto_opts
     if go.mode != LINKMODE_NORMAL:
         for opt_list in (copts, cxxopts, objcopts, objcxxopts):
             if "-fPIC" not in opt_list:
@@ -79,7 +115,9 @@ def cgo_configure(go, srcs, cdeps, cppopts, copts, cxxopts, clinkopts):
     seen_system_includes = {}
     for f in srcs:
         if f.basename.endswith(".h"):
+            n = len(cppopts)
             _include_unique(cppopts, "-iquote", f.dirname, seen_quote_includes)
+            _trace_opts(trace, cppopts[n:], "headers in srcs of " + label)
 
     inputs_direct = []
     inputs_transitive = []
@@ -90,8 +128,12 @@ def cgo_configure(go, srcs, cdeps, cppopts, copts, cxxopts, clinkopts):
     # Always include the sandbox as part of the build. Bazel does this, but it
     # doesn't appear in the CompilationContext.
     _include_unique(cppopts, "-iquote", ".", seen_quote_includes)
+    _trace_opts(trace, ["-iquote", "."], "execution root")
     for d in cdeps:
         runfiles = runfiles.merge(d.data_runfiles)
+        cppopts_start = len(cppopts)
+        clinkopts_start = len(clinkopts)
+        lib_opts_start = len(lib_opts)
         if CcInfo in d:
             cc_transitive_headers = d[CcInfo].compilation_context.headers
             inputs_transitive.append(cc_transitive_headers)
@@ -150,6 +192,11 @@ def cgo_configure(go, srcs, cdeps, cppopts, copts, cxxopts, clinkopts):
         else:
             fail("unknown library has neither cc nor objc providers: %s" % d.label)
 
+        origin = str(d.label)
+        _trace_opts(trace, cppopts[cppopts_start:], origin)
+        _trace_opts(trace, clinkopts[clinkopts_start:], origin)
+        _trace_opts(trace, lib_opts[lib_opts_start:], origin)
+
     inputs = depset(direct = inputs_direct, transitive = inputs_transitive)
     deps = depset(direct = deps_direct)
 
@@ -169,8 +216,14 @@ def cgo_configure(go, srcs, cdeps, cppopts, copts, cxxopts, clinkopts):
         objcopts = objcopts,
         objcxxopts = objcxxopts,
         clinkopts = clinkopts,
+        trace = trace or [],
     )
 
+def _sdk_env_opts(go, name):
+    # Like the go command, flags in CGO_* variables are split on spaces and
+    # apply to every cgo package, before the package's own flags.
+    return [opt for opt in go.sdk.env.get(name, "").split(" ") if opt]
+
 def _cc_libs(target):
     # Copied from get_libs_for_static_executable in migration instructions
     # from bazelbuild/bazel#7036.
@@ -193,6 +246,47 @@ _DEFAULT_PLATFORM_COPTS = select({
     "//conditions:default": ["-pthread"],
 })
 
+# Flags that take their argument as a separate word. Keep in sync with
+# cgoFlagsWithArg in go/tools/builders/cgo_trace.go.
+_CGO_FLAGS_WITH_ARG = {
+    "-D": True,
+    "-F": True,
+    "-I": True,
+    "-L": True,
+    "-U": True,
+    "-Xlinker": True,
+    "-arch": True,
+    "-framework": True,
+    "-idirafter": True,
+    "-include": True,
+    "-iquote": True,
+    "-isysroot": True,
+    "-isystem": True,
+    "-l": True,
+    "-target": True,
+    "-x": True,
+}
+
+def _trace_opts(trace, opts, origin):
+    """Records origin as the source of each option in opts.
+
+    Options that take a separate argument are recorded together with it,
+    the same way the builder groups them. trace may be None, in which case
+    nothing is recorded.
+    """
+    if trace == None:
+        return
+    skip = False
+    for i in range(len(opts)):
+        if skip:
+            skip = False
+            continue
+        opt = opts[i]
+        if opt in _CGO_FLAGS_WITH_ARG and i + 1 < len(opts):
+            opt = opt + " " + opts[i + 1]
+            skip = True
+        trace.append(opt + "\t" + origin)
+
 def _include_unique(opts, flag, include, seen):
     if include in seen:
         return
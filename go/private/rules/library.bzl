@@ -22,6 +22,10 @@ load(
     "@io_bazel_rules_go//go/private:context.bzl",
     "go_context",
 )
+load(
+    "@io_bazel_rules_go//go/private:actions/build_tags.bzl",
+    "emit_build_tags",
+)
 load(
     "@io_bazel_rules_go//go/private:providers.bzl",
     "GoLibrary",
@@ -36,17 +40,25 @@ def _go_library_impl(ctx):
     library = go.new_library(go)
     source = go.library_to_source(go, ctx.attr, library, ctx.coverage_instrumented())
     archive = go.archive(go, source)
+    build_tags = emit_build_tags(go, source)
 
     return [
         library,
         source,
         archive,
+        build_tags,
         DefaultInfo(
-            files = depset([archive.data.file]),
+            # nogo runs in a separate action. Building the library should
+            # still fail if nogo reports problems.
+            files = depset([f for f in (archive.data.file, archive.data.nogo_checked) if f]),
         ),
         OutputGroupInfo(
             cgo_exports = archive.cgo_exports,
             compilation_outputs = [archive.data.file],
+            go_action_metadata = archive.action_metadata,
+            nogo_fix = archive.nogo_fixes,
+            nogo_sarif = archive.nogo_sarif_reports,
+            go_build_tags = [build_tags.report],
         ),
     ]
 
@@ -55,18 +67,22 @@ go_library = rule(
     attrs = {
         "data": attr.label_list(allow_files = True),
         "srcs": attr.label_list(allow_files = go_exts + asm_exts + cgo_exts),
+        "embedsrcs": attr.label_list(allow_files = True),
+        "symabis": attr.label_list(allow_files = [".symabis"]),
         "deps": attr.label_list(providers = [GoLibrary]),
         "importpath": attr.string(),
         "importmap": attr.string(),
         "importpath_aliases": attr.string_list(),  # experimental, undocumented
         "embed": attr.label_list(providers = [GoLibrary]),
         "gc_goopts": attr.string_list(),
+        "werror": attr.string_list(),
         "x_defs": attr.string_dict(),
         "cgo": attr.bool(),
         "cdeps": attr.label_list(),
         "cppopts": attr.string_list(),
         "copts": attr.string_list(),
         "cxxopts": attr.string_list(),
+        "cxxpch": attr.label(allow_single_file = [".h", ".hh", ".hpp", ".hxx"]),
         "clinkopts": attr.string_list(),
         "_go_context_data": attr.label(default = "//:go_context_data"),
     },
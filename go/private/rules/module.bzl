@@ -0,0 +1,101 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:providers.bzl",
+    "GoModuleInfo",
+    "GoModulesInfo",
+)
+
+def _go_module_impl(ctx):
+    if not ctx.attr.path:
+        fail("path must not be empty")
+    if ctx.attr.go and not ctx.attr.go.replace(".", "").isdigit():
+        fail("go: invalid Go version: %s" % ctx.attr.go)
+    return [GoModuleInfo(
+        path = ctx.attr.path,
+        root = ctx.label.package,
+        workspace_name = ctx.label.workspace_name,
+        go_version = ctx.attr.go,
+        label = ctx.label,
+    )]
+
+go_module = rule(
+    implementation = _go_module_impl,
+    attrs = {
+        "path": attr.string(
+            mandatory = True,
+            doc = """The module path, as written in the module directive
+            of go.mod.""",
+        ),
+        "go": attr.string(
+            doc = """The Go language version, as written in the go
+            directive of go.mod. If set, packages in the module are
+            compiled with -lang.""",
+        ),
+    },
+    provides = [GoModuleInfo],
+    doc = """Declares a Go module rooted in the package where the rule
+    is declared. Modules are registered with go_modules.""",
+)
+
+def _go_modules_impl(ctx):
+    modules = [m[GoModuleInfo] for m in ctx.attr.modules]
+    roots = {}
+    paths = {}
+    for m in modules:
+        root_key = (m.workspace_name, m.root)
+        if root_key in roots:
+            fail("modules {} and {} have the same root directory".format(roots[root_key], m.label))
+        roots[root_key] = m.label
+        if m.path in paths:
+            fail("modules {} and {} have the same path: {}".format(paths[m.path], m.label, m.path))
+        paths[m.path] = m.label
+
+    # Nested modules come first, so the innermost module containing a
+    # package is found first.
+    modules = sorted(modules, key = _root_depth, reverse = True)
+    return [GoModulesInfo(modules = modules)]
+
+def _root_depth(m):
+    if not m.root:
+        return 0
+    return m.root.count("/") + 1
+
+go_modules = rule(
+    implementation = _go_modules_impl,
+    attrs = {
+        "modules": attr.label_list(
+            providers = [GoModuleInfo],
+            doc = "go_module targets for the modules in the repository.",
+        ),
+    },
+    provides = [GoModulesInfo],
+    doc = """Registers Go modules with rules_go. The target is selected
+    with --@io_bazel_rules_go//go/config:modules.""",
+)
+
+def module_for_label(modules, label):
+    """Returns the innermost module containing a package, or None.
+
+    Args:
+        modules: a list of GoModuleInfo, as sorted by go_modules.
+        label: the label of a target in the package.
+    """
+    for m in modules:
+        if m.workspace_name != label.workspace_name:
+            continue
+        if not m.root or label.package == m.root or label.package.startswith(m.root + "/"):
+            return m
+    return None
@@ -0,0 +1,66 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+def _platforms_transition_impl(settings, attr):
+    return {
+        str(platform): {"//command_line_option:platforms": str(platform)}
+        for platform in attr.platforms
+    }
+
+_platforms_transition = transition(
+    implementation = _platforms_transition_impl,
+    inputs = [],
+    outputs = ["//command_line_option:platforms"],
+)
+
+def _go_multiplatform_binary_impl(ctx):
+    if not ctx.attr.platforms:
+        fail("platforms must not be empty")
+    group_names = {}
+    platforms_by_name = {}
+    for platform in ctx.attr.platforms:
+        name = platform.label.name
+        if name in platforms_by_name:
+            fail("platforms {} and {} have the same name".format(platforms_by_name[name], platform.label))
+        platforms_by_name[name] = platform.label
+        group_names[str(platform.label)] = name
+
+    groups = {}
+    for key, binary in ctx.split_attr.binary.items():
+        name = group_names.get(key, key.rpartition(":")[2])
+        groups[name] = binary[DefaultInfo].files
+    return [
+        DefaultInfo(files = depset(transitive = groups.values())),
+        OutputGroupInfo(**groups),
+    ]
+
+go_multiplatform_binary = rule(
+    implementation = _go_multiplatform_binary_impl,
+    attrs = {
+        "binary": attr.label(
+            mandatory = True,
+            cfg = _platforms_transition,
+            doc = """The go_binary to build for each platform.""",
+        ),
+        "platforms": attr.label_list(
+            mandatory = True,
+            doc = """The platforms to build the binary for. Each platform's
+            binary is in an output group named after the platform.""",
+        ),
+        "_whitelist_function_transition": attr.label(
+            default = "@bazel_tools//tools/whitelists/function_transition_whitelist",
+        ),
+    },
+    doc = """Builds a binary for several platforms at once.""",
+)
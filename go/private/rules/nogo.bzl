@@ -17,52 +17,20 @@ load(
     "go_context",
 )
 load(
-    "@io_bazel_rules_go//go/private:mode.bzl",
-    "LINKMODE_NORMAL",
+    "@io_bazel_rules_go//go/private:common.bzl",
+    "parse_label_pattern",
 )
 load(
     "@io_bazel_rules_go//go/private:providers.bzl",
     "EXPORT_PATH",
     "GoArchive",
     "GoLibrary",
+    "GoNogoScopeInfo",
     "get_archive",
 )
 load(
     "@io_bazel_rules_go//go/private:rules/transition.bzl",
-    "filter_transition_label",
-)
-
-_nogo_transition_dict = {
-    "@io_bazel_rules_go//go/config:static": False,
-    "@io_bazel_rules_go//go/config:msan": False,
-    "@io_bazel_rules_go//go/config:race": False,
-    "@io_bazel_rules_go//go/config:pure": False,
-    "@io_bazel_rules_go//go/config:strip": False,
-    "@io_bazel_rules_go//go/config:debug": False,
-    "@io_bazel_rules_go//go/config:linkmode": LINKMODE_NORMAL,
-    "@io_bazel_rules_go//go/config:tags": [],
-}
-
-_nogo_transition_keys = sorted([filter_transition_label(label) for label in _nogo_transition_dict.keys()])
-
-def _nogo_transition_impl(settings, attr):
-    """Ensures nogo is built in a safe configuration.
-
-    nogo_transition sets all of the //go/config settings to their default
-    values. The nogo binary shouldn't depend on the link mode or tags of the
-    binary being checked. This transition doesn't explicitly change the
-    platform (goos, goarch), but nogo dependencies should have `cfg = "exec"`,
-    so nogo binaries should be built for the execution platform.
-    """
-    settings = dict(settings)
-    for label, value in _nogo_transition_dict.items():
-        settings[filter_transition_label(label)] = value
-    return settings
-
-nogo_transition = transition(
-    implementation = _nogo_transition_impl,
-    inputs = _nogo_transition_keys,
-    outputs = _nogo_transition_keys,
+    "go_reset_transition",
 )
 
 def _nogo_impl(ctx):
@@ -84,6 +52,9 @@ def _nogo_impl(ctx):
     if ctx.file.config:
         nogo_args.add("-config", ctx.file.config)
         nogo_inputs.append(ctx.file.config)
+    if ctx.file.baseline:
+        nogo_args.add("-baseline", ctx.file.baseline)
+        nogo_inputs.append(ctx.file.baseline)
     ctx.actions.run(
         inputs = nogo_inputs,
         outputs = [nogo_main],
@@ -114,11 +85,18 @@ def _nogo_impl(ctx):
         name = ctx.label.name,
         source = nogo_source,
     )
-    return [DefaultInfo(
-        files = depset([executable]),
-        runfiles = nogo_archive.runfiles,
-        executable = executable,
-    )]
+    return [
+        DefaultInfo(
+            files = depset([executable]),
+            runfiles = nogo_archive.runfiles,
+            executable = executable,
+        ),
+        GoNogoScopeInfo(
+            includes = [parse_label_pattern(p) for p in ctx.attr.includes],
+            excludes = [parse_label_pattern(p) for p in ctx.attr.excludes],
+            exclude_tags = ctx.attr.exclude_tags,
+        ),
+    ]
 
 nogo = rule(
     implementation = _nogo_impl,
@@ -129,6 +107,12 @@ nogo = rule(
         "config": attr.label(
             allow_single_file = True,
         ),
+        "baseline": attr.label(
+            allow_single_file = True,
+        ),
+        "includes": attr.string_list(),
+        "excludes": attr.string_list(),
+        "exclude_tags": attr.string_list(),
         "_nogo_srcs": attr.label(
             default = "@io_bazel_rules_go//go/tools/builders:nogo_srcs",
         ),
@@ -140,7 +124,7 @@ nogo = rule(
         ),
     },
     toolchains = ["@io_bazel_rules_go//go:toolchain"],
-    cfg = nogo_transition,
+    cfg = go_reset_transition,
 )
 
 def nogo_wrapper(**kwargs):
@@ -0,0 +1,183 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:context.bzl",
+    "go_context",
+    "nogo_checks",
+)
+load(
+    "@io_bazel_rules_go//go/private:providers.bzl",
+    "GoArchive",
+    "GoNogoInputsInfo",
+    "GoNogoScopeInfo",
+    "get_archive",
+)
+load(
+    "@io_bazel_rules_go//go/private:rules/rule.bzl",
+    "go_rule",
+)
+
+def _package(archive):
+    return struct(
+        data = archive.data,
+        testfilter = getattr(archive.source.library, "testfilter", None),
+        deps = tuple([dep.data for dep in archive.direct]),
+    )
+
+def _nogo_inputs_aspect_impl(target, ctx):
+    transitive = []
+    for attr in ("deps", "embed"):
+        deps = getattr(ctx.rule.attr, attr, [])
+        if type(deps) != "list":
+            continue
+        transitive.extend([dep[GoNogoInputsInfo].packages for dep in deps if GoNogoInputsInfo in dep])
+    if GoArchive not in target:
+        return [GoNogoInputsInfo(
+            packages = depset(transitive = transitive, order = "postorder"),
+        )]
+
+    # go_test provides the archive of its generated main package. The
+    # internal and external test packages have the same label and are only
+    # reachable as its direct dependencies. The external package imports the
+    # internal one, so the internal package comes first.
+    archive = get_archive(target)
+    tests = [_package(a) for a in archive.direct if a.data.label == archive.data.label]
+    packages = ([p for p in tests if p.testfilter != "only"] +
+                [p for p in tests if p.testfilter == "only"] +
+                [_package(archive)])
+    return [GoNogoInputsInfo(
+        packages = depset(
+            direct = packages,
+            transitive = transitive,
+            order = "postorder",
+        ),
+    )]
+
+nogo_inputs_aspect = aspect(
+    _nogo_inputs_aspect_impl,
+    attr_aspects = ["deps", "embed"],
+)
+
+def _dep_arc(data, facts):
+    importpaths = [data.importpath]
+    importpaths.extend(data.importpath_aliases)
+    return "{}={}={}={}".format(
+        ":".join(importpaths),
+        data.importmap,
+        data.file.path,
+        facts.path if facts else "",
+    )
+
+def _output_prefix(ctx, pkg):
+    label = pkg.data.label
+    parts = [ctx.label.name + ".nogo", label.workspace_name or "_main"]
+    if label.package:
+        parts.append(label.package)
+    name = label.name
+    if pkg.testfilter == "exclude":
+        name += ".internal"
+    elif pkg.testfilter == "only":
+        name += ".external"
+    parts.append(name)
+    return "/".join(parts)
+
+def _nogo_test_impl(ctx):
+    go = go_context(ctx)
+    nogo = ctx.executable.nogo
+    scope = ctx.attr.nogo[GoNogoScopeInfo] if GoNogoScopeInfo in ctx.attr.nogo else None
+
+    # Packages are visited after their dependencies, so facts from each
+    # dependency are available when a package is checked.
+    packages = depset(
+        transitive = [dep[GoNogoInputsInfo].packages for dep in ctx.attr.deps],
+        order = "postorder",
+    )
+    facts_by_file = {}
+    findings = []
+    for pkg in packages.to_list():
+        if pkg.data.file in facts_by_file:
+            continue
+        if not nogo_checks(scope, pkg.data.label, go.mode.tags):
+            facts_by_file[pkg.data.file] = None
+            continue
+        prefix = _output_prefix(ctx, pkg)
+        out_facts = ctx.actions.declare_file(prefix + ".x")
+        out_findings = ctx.actions.declare_file(prefix + ".txt")
+
+        deps_facts = [facts_by_file.get(d.file) for d in pkg.deps]
+        inputs = (list(pkg.data.srcs) + [go.package_list] +
+                  [d.file for d in pkg.deps] +
+                  [f for f in deps_facts if f] +
+                  go.sdk.tools + go.stdlib.libs)
+        args = go.builder_args(go, "nogo")
+        args.add_all(pkg.data.srcs, before_each = "-src")
+        args.add_all([_dep_arc(d, f) for d, f in zip(pkg.deps, deps_facts)], before_each = "-arc")
+        args.add("-p", pkg.data.importmap)
+        args.add("-package_list", go.package_list)
+        if pkg.testfilter:
+            args.add("-testfilter", pkg.testfilter)
+        args.add("-nogo", nogo)
+        args.add("-x", out_facts)
+        args.add("-o", out_findings)
+        ctx.actions.run(
+            inputs = inputs,
+            outputs = [out_facts, out_findings],
+            mnemonic = "GoNogo",
+            executable = go.toolchain._builder,
+            arguments = [args],
+            env = go.env,
+            tools = [nogo],
+        )
+        facts_by_file[pkg.data.file] = out_facts
+        findings.append(out_findings)
+
+    lines = [
+        "#!/usr/bin/env bash",
+        "set -euo pipefail",
+        "status=0",
+        "for f in {}; do".format(" ".join([_shell_quote(f.short_path) for f in findings])),
+        "  if [[ -s \"$f\" ]]; then",
+        "    cat \"$f\"",
+        "    status=1",
+        "  fi",
+        "done",
+        "exit $status",
+    ]
+    script = ctx.actions.declare_file(ctx.label.name + ".sh")
+    ctx.actions.write(script, "\n".join(lines) + "\n", is_executable = True)
+    return [DefaultInfo(
+        files = depset(findings),
+        runfiles = ctx.runfiles(files = findings),
+        executable = script,
+    )]
+
+def _shell_quote(s):
+    return "'" + s.replace("'", "'\\''") + "'"
+
+nogo_test = go_rule(
+    _nogo_test_impl,
+    attrs = {
+        "nogo": attr.label(
+            mandatory = True,
+            executable = True,
+            cfg = "exec",
+        ),
+        "deps": attr.label_list(
+            aspects = [nogo_inputs_aspect],
+        ),
+    },
+    test = True,
+    doc = """Runs nogo on deps and their transitive dependencies.""",
+)
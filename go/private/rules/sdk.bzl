@@ -15,9 +15,27 @@
 load(
     "@io_bazel_rules_go//go/private:providers.bzl",
     "GoSDK",
+    "GoStdLib",
 )
 
+# Environment variables set by rules_go itself, which may not be overridden
+# with go_sdk's env.
+_RESERVED_ENV = ["CGO_ENABLED", "GOARCH", "GOOS", "GOPATH", "GOROOT", "GOROOT_FINAL"]
+
 def _go_sdk_impl(ctx):
+    for name in ctx.attr.env:
+        if name in _RESERVED_ENV:
+            fail("env: {} is set by rules_go and may not be set here".format(name))
+    prebuilt_stdlibs = {}
+    for target, mode in ctx.attr.prebuilt_stdlibs.items():
+        files = target.files.to_list()
+        root_files = [f for f in files if f.basename == "ROOT"]
+        if len(root_files) != 1:
+            fail("prebuilt_stdlibs: {} must contain exactly one ROOT file".format(target.label))
+        prebuilt_stdlibs[mode] = GoStdLib(
+            root_file = root_files[0],
+            libs = [f for f in files if f.extension == "a"],
+        )
     package_list = ctx.file.package_list
     if package_list == None:
         package_list = ctx.actions.declare_file("packages.txt")
@@ -32,6 +50,8 @@ def _go_sdk_impl(ctx):
         srcs = ctx.files.srcs,
         tools = ctx.files.tools,
         go = ctx.executable.go,
+        env = ctx.attr.env,
+        prebuilt_stdlibs = prebuilt_stdlibs,
     )]
 
 go_sdk = rule(
@@ -82,6 +102,19 @@ go_sdk = rule(
             cfg = "exec",
             doc = "The go binary",
         ),
+        "env": attr.string_dict(
+            doc = ("Environment variables set for every action that uses " +
+                   "the SDK, and for tests"),
+        ),
+        "prebuilt_stdlibs": attr.label_keyed_string_dict(
+            allow_files = True,
+            doc = ("Standard libraries compiled ahead of time, mapped to " +
+                   "the modes they were compiled for, like " +
+                   "\"linux_arm64_race\". Each must contain a ROOT file " +
+                   "and .a files in pkg/ below the same directory. " +
+                   "Standard libraries for other modes are compiled as " +
+                   "needed."),
+        ),
     },
     doc = ("Collects information about a Go SDK. The SDK must have a normal " +
            "GOROOT directory structure."),
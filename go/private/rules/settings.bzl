@@ -0,0 +1,77 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@bazel_skylib//rules:common_settings.bzl",
+    "BuildSettingInfo",
+)
+load(
+    "@io_bazel_rules_go//go/private:providers.bzl",
+    "GoCustomSettingsInfo",
+)
+
+def _setting_values(label, value):
+    """Returns the strings a build setting value expands to in a tag template.
+
+    A true bool expands to a single empty string, so the template is used
+    as-is. Strings and ints expand to themselves unless they're empty.
+    String lists expand to their elements.
+    """
+    if type(value) == "bool":
+        return [""] if value else []
+    if type(value) == "string":
+        return [value] if value else []
+    if type(value) == "int":
+        return [str(value)]
+    if type(value) == "list":
+        return [v for v in value if v]
+    fail("{}: unsupported build setting type: {}".format(label, type(value)))
+
+def _go_custom_settings_impl(ctx):
+    tags = []
+    seen = {}
+    for target, template in ctx.attr.tags.items():
+        for value in _setting_values(target.label, target[BuildSettingInfo].value):
+            tag = template.replace("{value}", value)
+            if not tag or tag in seen:
+                continue
+            seen[tag] = None
+            tags.append(tag)
+    return [GoCustomSettingsInfo(
+        tags = tags,
+        stdlib = ctx.attr.stdlib,
+    )]
+
+go_custom_settings = rule(
+    implementation = _go_custom_settings_impl,
+    attrs = {
+        "tags": attr.label_keyed_string_dict(
+            providers = [BuildSettingInfo],
+            doc = """Maps build settings to build tag templates. Each
+            template is expanded for the setting's current value, with
+            {value} replaced by the value, and the results are added to
+            the build tags for all Go targets.""",
+        ),
+        "stdlib": attr.bool(
+            default = False,
+            doc = """Whether the tags also affect the standard library.
+            If true and any tags are set, the standard library is built
+            from source with them instead of using the SDK's precompiled
+            copy.""",
+        ),
+    },
+    provides = [GoCustomSettingsInfo],
+    doc = """Registers user-defined build settings with rules_go. The target
+    is selected with --@io_bazel_rules_go//go/config:custom_settings.""",
+)
@@ -39,9 +39,12 @@ go_source = rule(
     attrs = {
         "data": attr.label_list(allow_files = True),
         "srcs": attr.label_list(allow_files = True),
+        "embedsrcs": attr.label_list(allow_files = True),
+        "symabis": attr.label_list(allow_files = [".symabis"]),
         "deps": attr.label_list(providers = [GoLibrary]),
         "embed": attr.label_list(providers = [GoLibrary]),
         "gc_goopts": attr.string_list(),
+        "werror": attr.string_list(),
         "_go_config": attr.label(default = "//:go_config"),
         "_cgo_context_data": attr.label(default = "//:cgo_context_data_proxy"),
     },
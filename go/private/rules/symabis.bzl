@@ -0,0 +1,50 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:common.bzl",
+    "asm_exts",
+)
+load(
+    "@io_bazel_rules_go//go/private:context.bzl",
+    "go_context",
+)
+
+def _go_symabis_impl(ctx):
+    go = go_context(ctx)
+    out = go.declare_file(go, ext = ".symabis")
+    args = go.builder_args(go, "symabis")
+    args.add_all(ctx.files.srcs, before_each = "-src")
+    args.add("-o", out)
+    go.actions.run(
+        inputs = ctx.files.srcs + go.sdk.tools + go.sdk.headers,
+        outputs = [out],
+        mnemonic = "GoSymabis",
+        executable = go.toolchain._builder,
+        arguments = [args],
+        env = go.env,
+    )
+    return [DefaultInfo(files = depset([out]))]
+
+go_symabis = rule(
+    _go_symabis_impl,
+    attrs = {
+        "srcs": attr.label_list(
+            mandatory = True,
+            allow_files = asm_exts,
+        ),
+        "_go_context_data": attr.label(default = "//:go_context_data"),
+    },
+    toolchains = ["@io_bazel_rules_go//go:toolchain"],
+)
@@ -16,10 +16,15 @@ load(
     ":context.bzl",
     "go_context",
 )
+load(
+    ":actions/build_tags.bzl",
+    "emit_build_tags",
+)
 load(
     ":common.bzl",
     "asm_exts",
     "cgo_exts",
+    "expand_env",
     "go_exts",
     "pkg_dir",
     "split_srcs",
@@ -42,6 +47,10 @@ load(
     "LINKMODE_NORMAL",
 )
 
+# Profiles a test may write to its undeclared outputs. The test wrapper maps
+# these to testing flags.
+_PROFILES = ["block", "cpu", "mem", "mutex", "trace"]
+
 def _testmain_library_to_source(go, attr, source, merge):
     source["deps"] = source["deps"] + [attr.library]
 
@@ -68,6 +77,7 @@ def _go_test_impl(ctx):
     )
     external_source = go.library_to_source(go, struct(
         srcs = [struct(files = go_srcs)],
+        embedsrcs = [struct(files = internal_source.embedsrcs)],
         deps = internal_archive.direct + [internal_archive],
         x_defs = ctx.attr.x_defs,
     ), external_library, ctx.coverage_instrumented())
@@ -100,6 +110,25 @@ def _go_test_impl(ctx):
         "l_test=" + external_source.library.importpath,
     )
     arguments.add("-pkgname", internal_source.library.importpath)
+    if ctx.file.shard_timings:
+        arguments.add("-shard_timings", ctx.file.shard_timings.short_path)
+    if getattr(ctx.attr, "retries", 0):
+        arguments.add("-retries", str(ctx.attr.retries))
+    if ctx.attr.failure_hook:
+        arguments.add("-failure_hook", ctx.executable.failure_hook.short_path)
+    for profile in ctx.attr.profiles:
+        if profile not in _PROFILES:
+            fail("invalid profile {}: must be one of {}".format(repr(profile), ", ".join(_PROFILES)))
+    if ctx.attr.profiles:
+        arguments.add_joined("-profiles", ctx.attr.profiles, join_with = ",")
+    if getattr(ctx.attr, "bench", ""):
+        arguments.add("-bench", ctx.attr.bench)
+        if ctx.attr.benchtime:
+            arguments.add("-benchtime", ctx.attr.benchtime)
+        if ctx.attr.count:
+            arguments.add("-benchcount", str(ctx.attr.count))
+        if ctx.attr.benchmem:
+            arguments.add("-benchmem")
     arguments.add_all(go_srcs, before_each = "-src", format_each = "l=%s")
     ctx.actions.run(
         inputs = go_srcs,
@@ -130,6 +159,9 @@ def _go_test_impl(ctx):
         srcs = [struct(files = [main_go] + ctx.files._testmain_additional_srcs)],
         deps = test_deps,
     ), test_library, False)
+    link_metadata = None
+    if go._action_metadata:
+        link_metadata = go.declare_file(go, ext = ".link.meta.json")
     test_archive, executable, runfiles = go.binary(
         go,
         name = ctx.label.name,
@@ -138,15 +170,28 @@ def _go_test_impl(ctx):
         gc_linkopts = gc_linkopts(ctx),
         version_file = ctx.version_file,
         info_file = ctx.info_file,
+        out_metadata = link_metadata,
     )
+    if go.toolchain._test_runner:
+        executable, runfiles = _runner_launcher(ctx, go, executable, runfiles)
+    if ctx.file.shard_timings:
+        runfiles = runfiles.merge(ctx.runfiles(files = [ctx.file.shard_timings]))
+    if ctx.attr.failure_hook:
+        runfiles = runfiles.merge(ctx.runfiles(files = [ctx.executable.failure_hook]))
+        runfiles = runfiles.merge(ctx.attr.failure_hook[DefaultInfo].default_runfiles)
+
+    # The internal test package's sources include the external test
+    # sources, so report on all of them.
+    build_tags = emit_build_tags(go, internal_source, testfilter = "off")
 
     # Bazel only looks for coverage data if the test target has an
     # InstrumentedFilesProvider. If the provider is found and at least one
     # source file is present, Bazel will set the COVERAGE_OUTPUT_FILE
     # environment variable during tests and will save that file to the build
     # events + test outputs.
-    return [
+    providers = [
         test_archive,
+        build_tags,
         DefaultInfo(
             files = depset([executable]),
             runfiles = runfiles,
@@ -154,6 +199,13 @@ def _go_test_impl(ctx):
         ),
         OutputGroupInfo(
             compilation_outputs = [internal_archive.data.file],
+            go_action_metadata = depset(
+                direct = [link_metadata] if link_metadata else [],
+                transitive = [test_archive.action_metadata],
+            ),
+            nogo_fix = test_archive.nogo_fixes,
+            nogo_sarif = test_archive.nogo_sarif_reports,
+            go_build_tags = [build_tags.report],
         ),
         coverage_common.instrumented_files_info(
             ctx,
@@ -162,18 +214,79 @@ def _go_test_impl(ctx):
             extensions = ["go"],
         ),
     ]
+    test_env = dict(go.sdk.env)
+    test_env.update(expand_env(ctx))
+    if ctx.attr.env_inherit:
+        # inherited_environment isn't supported by older versions of Bazel,
+        # so it's only used when needed.
+        providers.append(testing.TestEnvironment(
+            environment = test_env,
+            inherited_environment = ctx.attr.env_inherit,
+        ))
+    elif test_env:
+        providers.append(testing.TestEnvironment(test_env))
+    return providers
+
+# Runs a test with the runner from the Go toolchain, like a WebAssembly runtime
+# or an emulator. The runner is called with its flags, the test binary, and the
+# test's arguments. The
+# launcher may be run from the test's runfiles directory, so paths are
+# relative to it. RUNFILES_DIR tells the runner where to find its own files.
+_RUNNER_LAUNCHER = """#!/usr/bin/env bash
+set -euo pipefail
+if [[ -z "${{RUNFILES_DIR:-}}" ]]; then
+  RUNFILES_DIR="${{TEST_SRCDIR:-$(cd .. && pwd)}}"
+  export RUNFILES_DIR
+fi
+exec "{runner}" {flags} "{binary}" "$@"
+"""
+
+def _runner_launcher(ctx, go, binary, runfiles):
+    # Test binaries for WebAssembly or another architecture can't be executed
+    # directly, so Bazel runs a script that runs them with the toolchain's
+    # runner.
+    runner = go.toolchain._test_runner
+    runner_exe = runner[DefaultInfo].files_to_run.executable
+    launcher = go.declare_file(go, path = ctx.label.name, ext = ".sh")
+    ctx.actions.write(
+        launcher,
+        _RUNNER_LAUNCHER.format(
+            runner = runner_exe.short_path,
+            flags = " ".join([_shell_quote(f) for f in go.toolchain._test_runner_flags]),
+            binary = binary.short_path,
+        ),
+        is_executable = True,
+    )
+    runfiles = runfiles.merge(ctx.runfiles(files = [binary, runner_exe]))
+    runfiles = runfiles.merge(runner[DefaultInfo].default_runfiles)
+    return launcher, runfiles
+
+def _shell_quote(s):
+    return "'" + s.replace("'", "'\\''") + "'"
 
 _go_test_kwargs = {
     "implementation": _go_test_impl,
     "attrs": {
         "data": attr.label_list(allow_files = True),
         "srcs": attr.label_list(allow_files = go_exts + asm_exts + cgo_exts),
+        "embedsrcs": attr.label_list(allow_files = True),
+        "symabis": attr.label_list(allow_files = [".symabis"]),
         "deps": attr.label_list(providers = [GoLibrary]),
         "embed": attr.label_list(providers = [GoLibrary]),
         "importpath": attr.string(),
         "gc_goopts": attr.string_list(),
+        "werror": attr.string_list(),
         "gc_linkopts": attr.string_list(),
         "rundir": attr.string(),
+        "shard_timings": attr.label(allow_single_file = True),
+        "retries": attr.int(),
+        "failure_hook": attr.label(
+            executable = True,
+            cfg = "target",
+        ),
+        "profiles": attr.string_list(),
+        "env": attr.string_dict(),
+        "env_inherit": attr.string_list(),
         "x_defs": attr.string_dict(),
         "linkmode": attr.string(default = LINKMODE_NORMAL),
         "cgo": attr.bool(),
@@ -181,6 +294,7 @@ _go_test_kwargs = {
         "cppopts": attr.string_list(),
         "copts": attr.string_list(),
         "cxxopts": attr.string_list(),
+        "cxxpch": attr.label(allow_single_file = [".h", ".hh", ".hpp", ".hxx"]),
         "clinkopts": attr.string_list(),
         "_go_context_data": attr.label(default = "//:go_context_data"),
         "_testmain_additional_srcs": attr.label_list(
@@ -199,5 +313,23 @@ _go_test_kwargs = {
     "toolchains": ["@io_bazel_rules_go//go:toolchain"],
 }
 
+# go_benchmark is a go_test that only runs benchmarks. The attributes below
+# set defaults for the corresponding testing flags.
+_go_benchmark_attrs = dict(_go_test_kwargs["attrs"])
+_go_benchmark_attrs.update({
+    "bench": attr.string(default = "."),
+    "benchtime": attr.string(),
+    "count": attr.int(),
+    "benchmem": attr.bool(),
+})
+
+# Benchmarks aren't retried.
+_go_benchmark_attrs.pop("retries")
+
+_go_benchmark_kwargs = dict(_go_test_kwargs)
+_go_benchmark_kwargs["attrs"] = _go_benchmark_attrs
+
 go_test = rule(**_go_test_kwargs)
 go_transition_test = go_transition_rule(**_go_test_kwargs)
+go_benchmark = rule(**_go_benchmark_kwargs)
+go_transition_benchmark = go_transition_rule(**_go_benchmark_kwargs)
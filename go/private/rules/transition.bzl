@@ -15,6 +15,7 @@
 load(
     ":mode.bzl",
     "LINKMODES",
+    "LINKMODE_NORMAL",
 )
 load(
     ":platforms.bzl",
@@ -54,7 +55,7 @@ def go_transition_wrapper(kind, transition_kind, name, **kwargs):
     regular rule. This prevents targets from being rebuilt for an alternative
     configuration identical to the default configuration.
     """
-    transition_keys = ("goos", "goarch", "pure", "static", "msan", "race", "gotags", "linkmode")
+    transition_keys = ("goos", "goarch", "pure", "static", "msan", "race", "gotags", "linkmode", "go_version")
     need_transition = any([key in kwargs for key in transition_keys])
     if need_transition:
         transition_kind(name = name, **kwargs)
@@ -94,6 +95,7 @@ def go_transition_rule(**kwargs):
             default = "auto",
             values = ["auto"] + LINKMODES,
         ),
+        "go_version": attr.string(),
         "_whitelist_function_transition": attr.label(
             default = "@bazel_tools//tools/whitelists/function_transition_whitelist",
         ),
@@ -144,6 +146,11 @@ def _go_transition_impl(settings, attr):
             fail('pure is "off" but cgo is not supported on {} {}'.format(goos, goarch))
         platform = "@io_bazel_rules_go//go/toolchain:{}_{}{}".format(goos, goarch, "_cgo" if cgo else "")
         settings["//command_line_option:platforms"] = platform
+        if cgo:
+            # The C/C++ toolchain must target the same platform. Without
+            # toolchain resolution, Bazel would keep the one for --cpu, which
+            # is usually the host's.
+            settings["//command_line_option:incompatible_enable_cc_toolchain_resolution"] = True
 
     tags = getattr(attr, "gotags", [])
     if tags:
@@ -157,30 +164,135 @@ def _go_transition_impl(settings, attr):
         linkmode_label = filter_transition_label("@io_bazel_rules_go//go/config:linkmode")
         settings[linkmode_label] = linkmode
 
+    go_version = getattr(attr, "go_version", "")
+    if go_version:
+        sdk_version_label = filter_transition_label("@io_bazel_rules_go//go/toolchain:sdk_version")
+        settings[sdk_version_label] = go_version
+
     return settings
 
 go_transition = transition(
     implementation = _go_transition_impl,
     inputs = [filter_transition_label(label) for label in [
         "//command_line_option:platforms",
+        "//command_line_option:incompatible_enable_cc_toolchain_resolution",
         "@io_bazel_rules_go//go/config:static",
         "@io_bazel_rules_go//go/config:msan",
         "@io_bazel_rules_go//go/config:race",
         "@io_bazel_rules_go//go/config:pure",
         "@io_bazel_rules_go//go/config:tags",
         "@io_bazel_rules_go//go/config:linkmode",
+        "@io_bazel_rules_go//go/config:custom_settings",
+        "@io_bazel_rules_go//go/toolchain:sdk_version",
     ]],
     outputs = [filter_transition_label(label) for label in [
         "//command_line_option:platforms",
+        "//command_line_option:incompatible_enable_cc_toolchain_resolution",
         "@io_bazel_rules_go//go/config:static",
         "@io_bazel_rules_go//go/config:msan",
         "@io_bazel_rules_go//go/config:race",
         "@io_bazel_rules_go//go/config:pure",
         "@io_bazel_rules_go//go/config:tags",
         "@io_bazel_rules_go//go/config:linkmode",
+        "@io_bazel_rules_go//go/config:custom_settings",
+        "@io_bazel_rules_go//go/toolchain:sdk_version",
     ]],
 )
 
+# Default values of the Go build settings. go_reset_transition sets them.
+_reset_transition_dict = {
+    "@io_bazel_rules_go//go/config:static": False,
+    "@io_bazel_rules_go//go/config:msan": False,
+    "@io_bazel_rules_go//go/config:race": False,
+    "@io_bazel_rules_go//go/config:pure": False,
+    "@io_bazel_rules_go//go/config:strip": False,
+    "@io_bazel_rules_go//go/config:debug": False,
+    "@io_bazel_rules_go//go/config:linkmode": LINKMODE_NORMAL,
+    "@io_bazel_rules_go//go/config:pie": "off",
+    "@io_bazel_rules_go//go/config:tags": [],
+    "@io_bazel_rules_go//go/config:trimpath_prefix": "",
+    "@io_bazel_rules_go//go/config:custom_settings": "@io_bazel_rules_go//go/config:empty_custom_settings",
+    "@io_bazel_rules_go//go/config:compiler_concurrency": 1,
+    "@io_bazel_rules_go//go/config:cgo_concurrency": 1,
+    "@io_bazel_rules_go//go/config:start_retries": 0,
+    "@io_bazel_rules_go//go/config:action_metadata": False,
+    "@io_bazel_rules_go//go/config:linkstamp": False,
+    "@io_bazel_rules_go//go/config:build_config_digest": False,
+    "@io_bazel_rules_go//go/config:cgo_trace": False,
+    "@io_bazel_rules_go//go/config:nogo_fix": False,
+    "@io_bazel_rules_go//go/config:nogo_sarif": False,
+    "@io_bazel_rules_go//go/config:fuzz": False,
+    "@io_bazel_rules_go//go/config:stdlib_packages": [],
+    "@io_bazel_rules_go//go/config:stdlib_shards": 1,
+    "@io_bazel_rules_go//go/config:package_conflict_remap": False,
+    "@io_bazel_rules_go//go/config:werror_policy": "@io_bazel_rules_go//go/config:empty_werror_policy",
+}
+
+_reset_transition_keys = sorted([filter_transition_label(label) for label in _reset_transition_dict.keys()])
+
+def _go_reset_transition_impl(settings, attr):
+    """Builds tools in a configuration with Go settings at their defaults.
+
+    go_reset_transition sets all of the //go/config settings, including
+    custom_settings, to their default values. Tools like nogo shouldn't
+    depend on the link mode or tags of the binary they're used for.
+    Resetting every setting also keeps a tool's path the same across modes,
+    so actions that run it may be cached. This transition doesn't explicitly
+    change the platform (goos, goarch), but tool dependencies should have
+    `cfg = "exec"`, so tools should be built for the execution platform.
+    """
+    settings = dict(settings)
+    for label, value in _reset_transition_dict.items():
+        settings[filter_transition_label(label)] = value
+    return settings
+
+go_reset_transition = transition(
+    implementation = _go_reset_transition_impl,
+    inputs = _reset_transition_keys,
+    outputs = _reset_transition_keys,
+)
+
+def _go_reset_target_impl(ctx):
+    dep = ctx.attr.dep[0]
+    default_info = dep[DefaultInfo]
+    executable = default_info.files_to_run.executable
+    if not executable:
+        fail("dep must be executable")
+
+    # Bazel requires an executable rule to create its executable, so link to
+    # the one built for dep.
+    out = ctx.actions.declare_file(ctx.label.name + ("." + executable.extension if executable.extension else ""))
+    ctx.actions.symlink(
+        output = out,
+        target_file = executable,
+        is_executable = True,
+    )
+    return [DefaultInfo(
+        files = depset([out]),
+        runfiles = default_info.default_runfiles.merge(ctx.runfiles([executable])),
+        executable = out,
+    )]
+
+go_reset_target = rule(
+    implementation = _go_reset_target_impl,
+    attrs = {
+        "dep": attr.label(
+            mandatory = True,
+            executable = True,
+            cfg = go_reset_transition,
+            doc = """The executable to build with Go settings reset.""",
+        ),
+        "_whitelist_function_transition": attr.label(
+            default = "@bazel_tools//tools/whitelists/function_transition_whitelist",
+        ),
+    },
+    executable = True,
+    doc = """Builds an executable with all of the Go build settings,
+    including custom settings, reset to their defaults. Rules that run a
+    tool, written in Go or not, can depend on it so the tool isn't rebuilt
+    for each combination of Go settings its users are built with.""",
+)
+
 def _check_ternary(name, value):
     if value not in ("on", "off", "auto"):
         fail('{}: must be "on", "off", or "auto"'.format(name))
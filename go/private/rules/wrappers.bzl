@@ -19,11 +19,15 @@ load(
 load(
     ":rules/binary.bzl",
     "go_binary",
+    "go_c_archive",
+    "go_shared_library",
     "go_transition_binary",
 )
 load(
     ":rules/test.bzl",
+    "go_benchmark",
     "go_test",
+    "go_transition_benchmark",
     "go_transition_test",
 )
 load(
@@ -34,6 +38,11 @@ load(
     ":rules/transition.bzl",
     "go_transition_wrapper",
 )
+load(
+    ":mode.bzl",
+    "LINKMODE_C_ARCHIVE",
+    "LINKMODE_C_SHARED",
+)
 
 def _cgo(name, kwargs):
     if "objc" in kwargs:
@@ -50,7 +59,46 @@ def go_binary_macro(name, **kwargs):
     go_transition_wrapper(go_binary, go_transition_binary, name = name, **kwargs)
     go_binary_c_archive_shared(name, kwargs)
 
+def go_shared_library_macro(name, **kwargs):
+    """See go/core.rst#go_shared_library for full documentation."""
+    _cgo(name, kwargs)
+    if kwargs.get("linkmode", LINKMODE_C_SHARED) != LINKMODE_C_SHARED:
+        fail("//{}:{}: go_shared_library only supports linkmode = \"c-shared\"".format(native.package_name(), name))
+    kwargs["linkmode"] = LINKMODE_C_SHARED
+    go_shared_library(name = name, **kwargs)
+
+def go_c_archive_macro(name, **kwargs):
+    """See go/core.rst#go_c_archive for full documentation."""
+    _cgo(name, kwargs)
+    if kwargs.get("linkmode", LINKMODE_C_ARCHIVE) != LINKMODE_C_ARCHIVE:
+        fail("//{}:{}: go_c_archive only supports linkmode = \"c-archive\"".format(native.package_name(), name))
+    kwargs["linkmode"] = LINKMODE_C_ARCHIVE
+    go_c_archive(name = name, **kwargs)
+
 def go_test_macro(name, **kwargs):
     """See go/core.rst#go_test for full documentation."""
     _cgo(name, kwargs)
     go_transition_wrapper(go_test, go_transition_test, name = name, **kwargs)
+
+def go_benchmark_macro(name, **kwargs):
+    """See go/core.rst#go_benchmark for full documentation."""
+    _cgo(name, kwargs)
+    go_transition_wrapper(go_benchmark, go_transition_benchmark, name = name, **kwargs)
+
+def go_fuzz_test_macro(name, fuzz, corpus = None, fuzztime = "", args = [], data = [], **kwargs):
+    """See go/core.rst#go_fuzz_test for full documentation."""
+    if corpus == None:
+        corpus = native.glob(["testdata/fuzz/{}/**".format(fuzz)])
+    run_args = ["-test.run=^{}$".format(fuzz)]
+    fuzz_args = run_args + ["-test.fuzz=^{}$".format(fuzz)]
+    if fuzztime:
+        fuzz_args.append("-test.fuzztime=" + fuzztime)
+    go_test_macro(
+        name = name,
+        args = select({
+            "@io_bazel_rules_go//go/private:fuzz": fuzz_args,
+            "//conditions:default": run_args,
+        }) + args,
+        data = data + corpus,
+        **kwargs
+    )
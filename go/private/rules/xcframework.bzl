@@ -0,0 +1,136 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Slices of an XCFramework the library may be built for. platform and arch
+# are the names Apple's tools use. The library is built for the Go platform,
+# and the Apple C toolchain is selected with cpu, which is also what tells the
+# device and simulator apart on arm64.
+_SLICES = {
+    "ios_arm64": struct(
+        platform = "ios",
+        arch = "arm64",
+        go_platform = "@io_bazel_rules_go//go/toolchain:ios_arm64_cgo",
+        cpu = "ios_arm64",
+    ),
+    "ios_simulator_arm64": struct(
+        platform = "ios-simulator",
+        arch = "arm64",
+        go_platform = "@io_bazel_rules_go//go/toolchain:ios_arm64_cgo",
+        cpu = "ios_sim_arm64",
+    ),
+    "ios_simulator_amd64": struct(
+        platform = "ios-simulator",
+        arch = "x86_64",
+        go_platform = "@io_bazel_rules_go//go/toolchain:ios_amd64_cgo",
+        cpu = "ios_x86_64",
+    ),
+}
+
+def _slices_transition_impl(settings, attr):
+    minimum_os = attr.minimum_os_version or settings["//command_line_option:ios_minimum_os"]
+    return {
+        name: {
+            "//command_line_option:platforms": _SLICES[name].go_platform,
+            "//command_line_option:cpu": _SLICES[name].cpu,
+            "//command_line_option:apple_platform_type": "ios",
+            "//command_line_option:ios_minimum_os": minimum_os,
+        }
+        for name in attr.slices
+    }
+
+_slices_transition = transition(
+    implementation = _slices_transition_impl,
+    inputs = ["//command_line_option:ios_minimum_os"],
+    outputs = [
+        "//command_line_option:platforms",
+        "//command_line_option:cpu",
+        "//command_line_option:apple_platform_type",
+        "//command_line_option:ios_minimum_os",
+    ],
+)
+
+def _go_xcframework_impl(ctx):
+    if not ctx.attr.slices:
+        fail("slices must not be empty")
+    for name in ctx.attr.slices:
+        if name not in _SLICES:
+            fail("unknown slice {}; want one of {}".format(name, ", ".join(sorted(_SLICES.keys()))))
+    module_name = ctx.attr.module_name or ctx.label.name
+
+    args = ctx.actions.args()
+    args.use_param_file("-param=%s")
+    args.set_param_file_format("multiline")
+    args.add("xcframework")
+    args.add("-module", module_name)
+    inputs = []
+    header = None
+    for name, library in sorted(ctx.split_attr.library.items()):
+        files = library[DefaultInfo].files.to_list()
+        archives = [f for f in files if f.extension == "a"]
+        headers = [f for f in files if f.extension == "h"]
+        if len(archives) != 1 or len(headers) != 1:
+            fail("{}: library must be a go_c_archive".format(ctx.label))
+        info = _SLICES[name]
+        args.add("-library", "{}:{}={}".format(info.platform, info.arch, archives[0].path))
+        inputs.append(archives[0])
+
+        # The header declares the same functions for every slice, since
+        # exported functions can't depend on the architecture.
+        if not header:
+            header = headers[0]
+            inputs.append(header)
+    args.add("-header", header)
+
+    out = ctx.actions.declare_directory(module_name + ".xcframework")
+    args.add("-o", out.path)
+    ctx.actions.run(
+        executable = ctx.toolchains["@io_bazel_rules_go//go:toolchain"]._builder,
+        arguments = [args],
+        inputs = inputs,
+        outputs = [out],
+        mnemonic = "GoXCFramework",
+        progress_message = "Assembling {}".format(out.short_path),
+    )
+    return [DefaultInfo(files = depset([out]))]
+
+go_xcframework = rule(
+    implementation = _go_xcframework_impl,
+    attrs = {
+        "library": attr.label(
+            mandatory = True,
+            cfg = _slices_transition,
+            doc = """The go_c_archive to build for each slice.""",
+        ),
+        "module_name": attr.string(
+            doc = """The name of the Clang module Swift code imports. It's
+            also the name of the XCFramework and of the library's header.
+            Defaults to the rule's name.""",
+        ),
+        "slices": attr.string_list(
+            default = sorted(_SLICES.keys()),
+            doc = """The platforms and architectures to build the library
+            for.""",
+        ),
+        "minimum_os_version": attr.string(
+            doc = """The minimum iOS version the library runs on. Defaults to
+            --ios_minimum_os.""",
+        ),
+        "_whitelist_function_transition": attr.label(
+            default = "@bazel_tools//tools/whitelists/function_transition_whitelist",
+        ),
+    },
+    toolchains = ["@io_bazel_rules_go//go:toolchain"],
+    doc = """Builds a go_c_archive for iOS devices and simulators and
+    assembles an XCFramework for Xcode and Apple build rules.""",
+)
@@ -12,6 +12,7 @@
 # See the License for the specific language governing permissions and
 # limitations under the License.
 
+load("@bazel_tools//tools/build_defs/repo:utils.bzl", "read_netrc")
 load(
     "@io_bazel_rules_go//go/private:common.bzl",
     "executable_path",
@@ -38,12 +39,24 @@ load(
 def _go_host_sdk_impl(ctx):
     goroot = _detect_host_sdk(ctx)
     platform = _detect_sdk_platform(ctx, goroot)
-    _sdk_build_file(ctx, platform)
+    if ctx.attr.min_version:
+        _check_sdk_version(ctx, goroot, ctx.attr.min_version)
+    _check_sdk_checksums(ctx, goroot, ctx.attr.checksums)
+    _sdk_build_file(ctx, platform, _read_sdk_version(ctx, goroot))
     _local_sdk(ctx, goroot)
 
 _go_host_sdk = repository_rule(
     _go_host_sdk_impl,
     environ = ["GOROOT"],
+    attrs = {
+        "env": attr.string_dict(),
+        "min_version": attr.string(
+            doc = "The minimum version of Go the host SDK must have, for example 1.13.",
+        ),
+        "checksums": attr.string_dict(
+            doc = "SHA-256 sums of files in the SDK, keyed by path relative to GOROOT.",
+        ),
+    },
 )
 
 def go_host_sdk(name, **kwargs):
@@ -51,16 +64,22 @@ def go_host_sdk(name, **kwargs):
     _register_toolchains(name)
 
 def _go_download_sdk_impl(ctx):
-    if ctx.attr.version:
+    version = ctx.attr.version
+    if ctx.attr.go_mod:
+        if version or ctx.attr.sdks:
+            fail("go_mod must not be set with version or sdks")
+        version = _version_from_go_mod(ctx)
+    if version:
         if ctx.attr.sdks:
             fail("version and sdks must not both be set")
-        if ctx.attr.version not in SDK_REPOSITORIES:
-            fail("unknown Go version: {}".format(ctx.attr.version))
-        sdks = SDK_REPOSITORIES[ctx.attr.version]
+        if version not in SDK_REPOSITORIES:
+            fail("unknown Go version: {}".format(version))
+        sdks = SDK_REPOSITORIES[version]
     elif ctx.attr.sdks:
         sdks = ctx.attr.sdks
     else:
-        sdks = SDK_REPOSITORIES[DEFAULT_VERSION]
+        version = DEFAULT_VERSION
+        sdks = SDK_REPOSITORIES[version]
 
     if not ctx.attr.goos and not ctx.attr.goarch:
         platform = _detect_host_platform(ctx)
@@ -73,8 +92,15 @@ def _go_download_sdk_impl(ctx):
     if platform not in sdks:
         fail("unsupported platform {}".format(platform))
     filename, sha256 = sdks[platform]
-    _sdk_build_file(ctx, platform)
-    _remote_sdk(ctx, [url.format(filename) for url in ctx.attr.urls], ctx.attr.strip_prefix, sha256)
+    if not version:
+        version = _version_from_filename(filename, platform)
+    urls = _format_urls(ctx.attr.urls, filename, version, platform)
+    if ctx.attr.stdlib_sha256s and ctx.attr.patches:
+        fail("stdlib_sha256s may not be set with patches, since prebuilt standard libraries don't include them")
+    _sdk_build_file(ctx, platform, version, sorted(ctx.attr.stdlib_sha256s.keys()))
+    _remote_sdk(ctx, urls, ctx.attr.strip_prefix, sha256, _get_auth(ctx, urls))
+    _patch_sdk(ctx, platform)
+    _remote_stdlibs(ctx, version)
 
 _go_download_sdk = repository_rule(
     _go_download_sdk_impl,
@@ -82,9 +108,34 @@ _go_download_sdk = repository_rule(
         "goos": attr.string(),
         "goarch": attr.string(),
         "sdks": attr.string_list_dict(),
+        "env": attr.string_dict(),
         "urls": attr.string_list(default = ["https://dl.google.com/go/{}"]),
         "version": attr.string(),
+        "go_mod": attr.label(
+            allow_single_file = True,
+            doc = "A go.mod file. The SDK version is read from its toolchain or go directive.",
+        ),
         "strip_prefix": attr.string(default = "go"),
+        "netrc": attr.string(
+            doc = "Location of a .netrc file with credentials for urls. Defaults to ~/.netrc.",
+        ),
+        "patches": attr.label_list(
+            doc = "Patch files to apply to the SDK after it's extracted.",
+        ),
+        "patch_args": attr.string_list(
+            default = ["-p0"],
+            doc = "Arguments for applying patches. Only -p<n> is supported.",
+        ),
+        "stdlib_urls": attr.string_list(
+            doc = ("URLs of archives of standard libraries compiled ahead " +
+                   "of time. {version} is replaced with the Go version and " +
+                   "{mode} with the mode the library was compiled for."),
+        ),
+        "stdlib_sha256s": attr.string_dict(
+            doc = ("SHA-256 sums of prebuilt standard library archives, " +
+                   "keyed by mode, like \"linux_amd64_race\". Only these " +
+                   "modes are downloaded."),
+        ),
     },
 )
 
@@ -95,13 +146,14 @@ def go_download_sdk(name, **kwargs):
 def _go_local_sdk_impl(ctx):
     goroot = ctx.attr.path
     platform = _detect_sdk_platform(ctx, goroot)
-    _sdk_build_file(ctx, platform)
+    _sdk_build_file(ctx, platform, _read_sdk_version(ctx, goroot))
     _local_sdk(ctx, goroot)
 
 _go_local_sdk = repository_rule(
     _go_local_sdk_impl,
     attrs = {
         "path": attr.string(),
+        "env": attr.string_dict(),
     },
 )
 
@@ -112,7 +164,7 @@ def go_local_sdk(name, **kwargs):
 def _go_wrap_sdk_impl(ctx):
     goroot = str(ctx.path(ctx.attr.root_file).dirname)
     platform = _detect_sdk_platform(ctx, goroot)
-    _sdk_build_file(ctx, platform)
+    _sdk_build_file(ctx, platform, _read_sdk_version(ctx, goroot))
     _local_sdk(ctx, goroot)
 
 _go_wrap_sdk = repository_rule(
@@ -122,6 +174,7 @@ _go_wrap_sdk = repository_rule(
             mandatory = True,
             doc = "A file in the SDK root direcotry. Used to determine GOROOT.",
         ),
+        "env": attr.string_dict(),
     },
 )
 
@@ -129,6 +182,85 @@ def go_wrap_sdk(name, **kwargs):
     _go_wrap_sdk(name = name, **kwargs)
     _register_toolchains(name)
 
+def _go_source_sdk_impl(ctx):
+    if ctx.attr.urls and ctx.attr.remote:
+        fail("urls and remote must not both be set")
+    if ctx.attr.urls:
+        ctx.download_and_extract(
+            url = ctx.attr.urls,
+            stripPrefix = ctx.attr.strip_prefix,
+            sha256 = ctx.attr.sha256,
+        )
+    elif ctx.attr.remote:
+        if not ctx.attr.commit:
+            fail("commit must be set with remote")
+        _git_checkout(ctx, ctx.attr.remote, ctx.attr.commit)
+    else:
+        fail("one of urls or remote must be set")
+
+    if ctx.attr.bootstrap_root_file:
+        bootstrap = str(ctx.path(ctx.attr.bootstrap_root_file).dirname)
+    else:
+        bootstrap = _detect_host_sdk(ctx)
+    _make_sdk(ctx, bootstrap)
+
+    goroot = str(ctx.path("."))
+    platform = _detect_sdk_platform(ctx, goroot)
+    _sdk_build_file(ctx, platform, _read_sdk_version(ctx, goroot))
+
+_go_source_sdk = repository_rule(
+    _go_source_sdk_impl,
+    environ = ["GOROOT"],
+    attrs = {
+        "urls": attr.string_list(),
+        "sha256": attr.string(),
+        "strip_prefix": attr.string(default = "go"),
+        "remote": attr.string(),
+        "commit": attr.string(),
+        "env": attr.string_dict(),
+        "bootstrap_root_file": attr.label(
+            doc = "A file in the root directory of the SDK used to build Go. Defaults to the host SDK.",
+        ),
+    },
+)
+
+def go_source_sdk(name, **kwargs):
+    _go_source_sdk(name = name, **kwargs)
+    _register_toolchains(name)
+
+def _git_checkout(ctx, remote, commit):
+    ctx.report_progress("Fetching Go sources")
+    for args in (
+        ["init"],
+        ["remote", "add", "origin", remote],
+        ["fetch", "--depth=1", "origin", commit],
+        ["checkout", "FETCH_HEAD"],
+    ):
+        res = ctx.execute(["git"] + args, timeout = 600)
+        if res.return_code:
+            fail("error fetching Go sources from {}:\n{}".format(remote, res.stdout + res.stderr))
+
+def _make_sdk(ctx, bootstrap):
+    ctx.report_progress("Building Go SDK")
+    if ctx.os.name.startswith("windows"):
+        cmd = ["cmd.exe", "/c", "make.bat"]
+    else:
+        cmd = ["./make.bash"]
+    res = ctx.execute(
+        cmd,
+        environment = {"GOROOT_BOOTSTRAP": bootstrap},
+        working_directory = "src",
+        timeout = 3600,
+    )
+    if res.return_code:
+        fail("error building Go SDK:\n" + res.stdout + res.stderr)
+
+    # Without a VERSION file, make.bash names the version after the checked out
+    # commit, so .git is kept until now. Neither it nor the build cache are
+    # needed by toolchains.
+    for path in (".git", "pkg/obj"):
+        ctx.delete(path)
+
 def _register_toolchains(repo):
     labels = [
         "@{}//:{}".format(repo, name)
@@ -136,7 +268,69 @@ def _register_toolchains(repo):
     ]
     native.register_toolchains(*labels)
 
-def _remote_sdk(ctx, urls, strip_prefix, sha256):
+def _version_from_go_mod(ctx):
+    go_version = ""
+    toolchain_version = ""
+    for line in ctx.read(ctx.path(ctx.attr.go_mod)).splitlines():
+        fields = line.partition("//")[0].split()
+        if len(fields) != 2:
+            continue
+        if fields[0] == "go":
+            go_version = fields[1]
+        elif fields[0] == "toolchain" and fields[1].startswith("go"):
+            toolchain_version = fields[1][len("go"):]
+
+    # The toolchain directive names the exact release "go build" uses. Without
+    # one, the go directive is the release the module was written for.
+    version = toolchain_version or go_version
+    if not version:
+        fail("{}: no go or toolchain directive found".format(ctx.attr.go_mod))
+
+    # Starting with Go 1.21, the first release of a minor version ends in ".0",
+    # but rules_go lists it without the patch number.
+    if version not in SDK_REPOSITORIES and version.endswith(".0") and version.count(".") == 2:
+        version = version[:-len(".0")]
+    if version not in SDK_REPOSITORIES:
+        fail("{}: unknown Go version: {}".format(ctx.attr.go_mod, version))
+    return version
+
+def _version_from_filename(filename, platform):
+    # Official archives are named like go1.13.linux-amd64.tar.gz.
+    suffix = "." + platform.replace("_", "-") + "."
+    if not filename.startswith("go") or suffix not in filename:
+        return ""
+    return filename[len("go"):filename.index(suffix)]
+
+def _format_urls(urls, filename, version, platform):
+    goos, _, goarch = platform.partition("_")
+    formatted = []
+    for url in urls:
+        if "{version}" in url and not version:
+            fail("could not determine the Go version for {}; set version or use {{}} in urls".format(url))
+        formatted.append(url.format(filename, version = version, os = goos, arch = goarch))
+    return formatted
+
+def _get_auth(ctx, urls):
+    netrc = ctx.attr.netrc
+    if not netrc:
+        home = ctx.os.environ.get("HOME", ctx.os.environ.get("USERPROFILE", ""))
+        if not home or not ctx.path(home + "/.netrc").exists:
+            return {}
+        netrc = home + "/.netrc"
+    credentials = read_netrc(ctx, netrc)
+    auth = {}
+    for url in urls:
+        host = url.partition("://")[2].partition("/")[0]
+        creds = credentials.get(host, {})
+        if "login" in creds and "password" in creds:
+            auth[url] = {
+                "type": "basic",
+                "login": creds["login"],
+                "password": creds["password"],
+            }
+    return auth
+
+def _remote_sdk(ctx, urls, strip_prefix, sha256, auth):
     # TODO(bazelbuild/bazel#7055): download_and_extract fails to extract
     # archives containing files with non-ASCII names. Go 1.12b1 has a test
     # file like this. Remove this workaround when the bug is fixed.
@@ -149,6 +343,7 @@ def _remote_sdk(ctx, urls, strip_prefix, sha256):
             url = urls,
             sha256 = sha256,
             output = "go_sdk.tar.gz",
+            auth = auth,
         )
         res = ctx.execute(["tar", "-xf", "go_sdk.tar.gz", "--strip-components=1"])
         if res.return_code:
@@ -159,13 +354,71 @@ def _remote_sdk(ctx, urls, strip_prefix, sha256):
             url = urls,
             stripPrefix = strip_prefix,
             sha256 = sha256,
+            auth = auth,
         )
 
+def _remote_stdlibs(ctx, version):
+    """Downloads the prebuilt standard libraries in stdlib_sha256s.
+
+    Each archive contains pkg/<goos>_<goarch>[_race|_msan] and is extracted
+    into its own directory below stdlib/, which is used as GOROOT when the
+    library is used. Tools and sources still come from the SDK.
+    """
+    if not ctx.attr.stdlib_sha256s:
+        return
+    if not ctx.attr.stdlib_urls:
+        fail("stdlib_sha256s is set, but stdlib_urls is not")
+    build = []
+    for mode, sha256 in sorted(ctx.attr.stdlib_sha256s.items()):
+        parts = mode.split("_")
+        if len(parts) < 2:
+            fail("stdlib_sha256s: {} is not a mode; want a name like linux_amd64 or linux_amd64_race".format(mode))
+        suffix = parts[0] + "_" + parts[1]
+        if "race" in parts[2:]:
+            suffix += "_race"
+        elif "msan" in parts[2:]:
+            suffix += "_msan"
+        urls = [url.format(version = version, mode = mode) for url in ctx.attr.stdlib_urls]
+        ctx.report_progress("Downloading prebuilt standard library for " + mode)
+        ctx.download_and_extract(
+            url = urls,
+            sha256 = sha256,
+            output = "stdlib/" + mode,
+            auth = _get_auth(ctx, urls),
+        )
+        if not ctx.path("stdlib/{}/pkg/{}".format(mode, suffix)).exists:
+            fail("stdlib_urls: the archive for {} does not contain pkg/{}".format(mode, suffix))
+        ctx.file("stdlib/{}/ROOT".format(mode))
+        build.append("""
+filegroup(
+    name = "{mode}",
+    srcs = ["{mode}/ROOT"] + glob(["{mode}/pkg/**/*.a"]),
+    visibility = ["//visibility:public"],
+)
+""".format(mode = mode))
+    ctx.file("stdlib/BUILD.bazel", "".join(build))
+
+def _patch_sdk(ctx, platform):
+    if not ctx.attr.patches:
+        return
+    strip = 0
+    for arg in ctx.attr.patch_args:
+        if not arg.startswith("-p") or not arg[len("-p"):].isdigit():
+            fail("patch_args: unsupported argument {}; only -p<n> is supported".format(arg))
+        strip = int(arg[len("-p"):])
+    ctx.report_progress("Patching Go SDK")
+    for patch in ctx.attr.patches:
+        ctx.patch(patch, strip)
+
+    # The precompiled standard library doesn't include the patches. Without
+    # it, the standard library is compiled from the patched sources.
+    ctx.delete("pkg/" + platform)
+
 def _local_sdk(ctx, path):
     for entry in ["src", "pkg", "bin"]:
         ctx.symlink(path + "/" + entry, entry)
 
-def _sdk_build_file(ctx, platform):
+def _sdk_build_file(ctx, platform, version, prebuilt_stdlib_modes = []):
     ctx.file("ROOT")
     goos, _, goarch = platform.partition("_")
     ctx.template(
@@ -176,6 +429,12 @@ def _sdk_build_file(ctx, platform):
             "{goos}": goos,
             "{goarch}": goarch,
             "{exe}": ".exe" if goos == "windows" else "",
+            "{env}": repr(ctx.attr.env),
+            "{sdk_version}": version,
+            "{prebuilt_stdlibs}": repr({
+                "//stdlib:" + mode: mode
+                for mode in prebuilt_stdlib_modes
+            }),
         },
     )
 
@@ -229,6 +488,59 @@ def _detect_host_sdk(ctx):
         fail("host go version failed to report it's GOROOT")
     return root
 
+def _detect_sdk_version(ctx, goroot):
+    # Released SDKs have a VERSION file in GOROOT, which is faster to read than
+    # running go. Versions look like "go1.14.4" or "devel +abcdef".
+    version_path = ctx.path(goroot + "/VERSION")
+    if version_path.exists:
+        return ctx.read(version_path).strip().split("\n")[0]
+    res = ctx.execute([executable_path(ctx, goroot + "/bin/go"), "version"])
+    if res.return_code:
+        fail("Could not detect version of the Go SDK in {}:\n{}".format(goroot, res.stdout + res.stderr))
+
+    # The output looks like "go version go1.14.4 linux/amd64".
+    fields = res.stdout.strip().split(" ")
+    if len(fields) < 3:
+        fail("Could not parse output of go version: {}".format(res.stdout))
+    return fields[2]
+
+def _read_sdk_version(ctx, goroot):
+    # Unlike _detect_sdk_version, this doesn't run go, which may not be built
+    # for the host. It returns "" for development versions, which can't be
+    # selected by version.
+    version_path = ctx.path(goroot + "/VERSION")
+    if not version_path.exists:
+        return ""
+    version = ctx.read(version_path).strip().split("\n")[0]
+    if not version.startswith("go"):
+        return ""
+    return version[len("go"):]
+
+def _check_sdk_version(ctx, goroot, min_version):
+    version = _detect_sdk_version(ctx, goroot)
+    if not version.startswith("go"):
+        # Development versions don't have a version number. Assume they're
+        # new enough.
+        return
+    if not versions.is_at_least(min_version, version[len("go"):]):
+        fail("The Go SDK in {} is version {}, but at least go{} is required. Install a newer version of Go or set GOROOT to point to one.".format(goroot, version, min_version))
+
+def _check_sdk_checksums(ctx, goroot, checksums):
+    for path, want in checksums.items():
+        file = goroot + "/" + path
+        if not ctx.path(file).exists:
+            fail("Go SDK file {} does not exist, but its checksum was listed in checksums".format(file))
+        got = _sha256(ctx, file)
+        if got != want.lower():
+            fail("Go SDK file {} has SHA-256 sum {}, but {} was expected. The SDK may have been modified or replaced.".format(file, got, want))
+
+def _sha256(ctx, path):
+    for cmd in (["sha256sum", path], ["shasum", "-a", "256", path]):
+        res = ctx.execute(cmd)
+        if res.return_code == 0:
+            return res.stdout.strip().split(" ")[0]
+    fail("Could not compute the SHA-256 sum of {}: neither sha256sum nor shasum could be run".format(path))
+
 def _detect_sdk_platform(ctx, goroot):
     res = ctx.execute(["ls", goroot + "/pkg/tool"])
     if res.return_code != 0:
@@ -238,9 +550,9 @@ def _detect_sdk_platform(ctx, goroot):
             return f
     fail("Could not detect SDK platform")
 
-def go_register_toolchains(go_version = None, nogo = None):
+def go_register_toolchains(go_version = None, nogo = None, env = None):
     """See /go/toolchains.rst#go-register-toolchains for full documentation."""
-    sdk_kinds = ("_go_download_sdk", "_go_host_sdk", "_go_local_sdk", "_go_wrap_sdk")
+    sdk_kinds = ("_go_download_sdk", "_go_host_sdk", "_go_local_sdk", "_go_source_sdk", "_go_wrap_sdk")
     existing_rules = native.existing_rules()
     sdk_rules = [r for r in existing_rules.values() if r["kind"] in sdk_kinds]
     if len(sdk_rules) == 0 and "go_sdk" in existing_rules:
@@ -249,17 +561,20 @@ def go_register_toolchains(go_version = None, nogo = None):
 
     if go_version and len(sdk_rules) > 0:
         fail("go_version set after go sdk rule declared ({})".format(", ".join([r["name"] for r in sdk_rules])))
+    if env and len(sdk_rules) > 0:
+        fail("env set after go sdk rule declared ({}); set env on the sdk rule instead".format(", ".join([r["name"] for r in sdk_rules])))
     if len(sdk_rules) == 0:
         if not go_version:
             go_version = DEFAULT_VERSION
         if go_version == "host":
-            go_host_sdk(name = "go_sdk")
+            go_host_sdk(name = "go_sdk", env = env or {})
         else:
             if not versions.is_at_least(MIN_SUPPORTED_VERSION, go_version):
                 print("DEPRECATED: go_register_toolchains: support for Go versions before {} will be removed soon".format(MIN_SUPPORTED_VERSION))
             go_download_sdk(
                 name = "go_sdk",
                 version = go_version,
+                env = env or {},
             )
 
     if nogo:
@@ -0,0 +1,127 @@
+# Copyright 2014 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:platforms.bzl",
+    "GLIBC_GOOS_GOARCH",
+    "GOARCH_CONSTRAINTS",
+    "MUSL_GOOS_GOARCH",
+)
+
+# Target triples clang is invoked with for each C library and architecture,
+# and the Bazel CPU names of the toolchains.
+_SYSROOT_TARGETS = {
+    ("glibc", "amd64"): struct(triple = "x86_64-linux-gnu", cpu = "k8"),
+    ("glibc", "arm64"): struct(triple = "aarch64-linux-gnu", cpu = "aarch64"),
+    ("musl", "amd64"): struct(triple = "x86_64-linux-musl", cpu = "k8"),
+    ("musl", "arm64"): struct(triple = "aarch64-linux-musl", cpu = "aarch64"),
+}
+
+_LIBC_GOOS_GOARCH = {
+    "glibc": GLIBC_GOOS_GOARCH,
+    "musl": MUSL_GOOS_GOARCH,
+}
+
+# LLVM tools the toolchain links into the repository. clang and ld.lld are
+# the only ones needed to build and link cgo code; the rest are linked when
+# they're found.
+_REQUIRED_TOOLS = ["clang", "ld.lld", "llvm-ar"]
+_OPTIONAL_TOOLS = ["llvm-cov", "llvm-dwp", "llvm-nm", "llvm-objcopy", "llvm-objdump", "llvm-strip"]
+
+def _go_sysroot_toolchain_impl(ctx):
+    if ctx.attr.libc not in _LIBC_GOOS_GOARCH:
+        fail("{}: libc {} is not supported; want one of {}".format(
+            ctx.name,
+            ctx.attr.libc,
+            ", ".join(sorted(_LIBC_GOOS_GOARCH.keys())),
+        ))
+    if ("linux", ctx.attr.goarch) not in _LIBC_GOOS_GOARCH[ctx.attr.libc]:
+        fail("{}: goarch {} is not supported; want one of {}".format(
+            ctx.name,
+            ctx.attr.goarch,
+            ", ".join([goarch for _, goarch in _LIBC_GOOS_GOARCH[ctx.attr.libc].keys()]),
+        ))
+    if not ctx.attr.urls:
+        fail("{}: no urls specified".format(ctx.name))
+    target = _SYSROOT_TARGETS[(ctx.attr.libc, ctx.attr.goarch)]
+
+    ctx.download_and_extract(
+        url = ctx.attr.urls,
+        sha256 = ctx.attr.sha256,
+        stripPrefix = ctx.attr.strip_prefix,
+        output = "sysroot",
+    )
+    if not ctx.path("sysroot/usr/include").exists:
+        fail("{}: usr/include not found in the downloaded sysroot; check strip_prefix".format(ctx.name))
+
+    # Only the sysroot is downloaded. The compiler comes from the host, but
+    # since clang is a cross compiler for every target, and the headers and
+    # libraries it builds against all come from the sysroot, its output only
+    # depends on its version.
+    for tool in _REQUIRED_TOOLS + _OPTIONAL_TOOLS:
+        if ctx.attr.llvm_path:
+            path = ctx.path("{}/bin/{}".format(ctx.attr.llvm_path, tool))
+            if not path.exists:
+                path = None
+        else:
+            path = ctx.which(tool)
+        if path:
+            ctx.symlink(path, "bin/" + tool)
+        elif tool in _REQUIRED_TOOLS:
+            fail("{}: {} not found; install LLVM or set llvm_path".format(ctx.name, tool))
+
+    # clang's own headers, like stddef.h, are in its resource directory
+    # rather than the sysroot.
+    include_dirs = ['"%package(@{}//sysroot/usr/include)%"'.format(ctx.name)]
+    result = ctx.execute(["bin/clang", "-print-resource-dir"])
+    if result.return_code == 0 and result.stdout.strip():
+        include_dirs.append('"{}/include"'.format(result.stdout.strip()))
+
+    ctx.template(
+        "BUILD.bazel",
+        Label("@io_bazel_rules_go//go/private:BUILD.sysroot.bazel"),
+        executable = False,
+        substitutions = {
+            "{repo}": ctx.name,
+            "{libc}": ctx.attr.libc,
+            "{triple}": target.triple,
+            "{cpu}": target.cpu,
+            "{cpu_constraint}": GOARCH_CONSTRAINTS[ctx.attr.goarch],
+            "{include_dirs}": ", ".join(include_dirs),
+            "{exec_compatible_with}": ", ".join(['"{}"'.format(c) for c in ctx.attr.exec_compatible_with]),
+        },
+    )
+
+_go_sysroot_toolchain = repository_rule(
+    _go_sysroot_toolchain_impl,
+    attrs = {
+        "goarch": attr.string(mandatory = True),
+        "libc": attr.string(default = "glibc"),
+        "urls": attr.string_list(mandatory = True),
+        "sha256": attr.string(),
+        "strip_prefix": attr.string(),
+        "llvm_path": attr.string(),
+        "exec_compatible_with": attr.string_list(
+            default = [
+                "@platforms//os:linux",
+                "@platforms//cpu:x86_64",
+            ],
+        ),
+    },
+    environ = ["PATH"],
+)
+
+def go_sysroot_toolchain(name, **kwargs):
+    _go_sysroot_toolchain(name = name, **kwargs)
+    native.register_toolchains("@{}//:toolchain".format(name))
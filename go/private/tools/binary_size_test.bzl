@@ -0,0 +1,74 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+def _go_binary_size_test_impl(ctx):
+    binary = ctx.attr.binary[DefaultInfo].files_to_run.executable
+    if not binary:
+        fail("binary must be an executable target")
+    baseline = ctx.file.baseline
+    if baseline.owner.workspace_name != ctx.label.workspace_name:
+        fail("baseline must be in the same repository as the test")
+
+    args = [
+        "-binary",
+        binary.short_path,
+        "-baseline",
+        baseline.short_path,
+        "-baseline_src",
+        baseline.short_path,
+        "-label",
+        str(ctx.label),
+        "-tolerance_percent",
+        ctx.attr.tolerance_percent,
+    ]
+    script = ctx.actions.declare_file(ctx.label.name + ".sh")
+    ctx.actions.write(
+        script,
+        "#!/usr/bin/env bash\nexec {} {} \"$@\"\n".format(
+            _shell_quote(ctx.executable._binary_size.short_path),
+            " ".join([_shell_quote(a) for a in args]),
+        ),
+        is_executable = True,
+    )
+    runfiles = ctx.runfiles(files = [binary, baseline, ctx.executable._binary_size])
+    runfiles = runfiles.merge(ctx.attr._binary_size[DefaultInfo].default_runfiles)
+    return [DefaultInfo(
+        runfiles = runfiles,
+        executable = script,
+    )]
+
+def _shell_quote(s):
+    return "'" + s.replace("'", "'\\''") + "'"
+
+go_binary_size_test = rule(
+    _go_binary_size_test_impl,
+    attrs = {
+        "binary": attr.label(
+            mandatory = True,
+            cfg = "target",
+        ),
+        "baseline": attr.label(
+            mandatory = True,
+            allow_single_file = [".json"],
+        ),
+        "tolerance_percent": attr.string(default = "1"),
+        "_binary_size": attr.label(
+            default = "@io_bazel_rules_go//go/tools/binary_size",
+            executable = True,
+            cfg = "target",
+        ),
+    },
+    test = True,
+    doc = """Compares the size of a binary with a baseline file.""",
+)
@@ -0,0 +1,127 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:providers.bzl",
+    "GoArchive",
+    "get_archive",
+)
+
+_GoDepGraphInfo = provider(
+    doc = "Lines describing the package graph of a target and its dependencies.",
+    fields = {
+        "nodes": "depset of node lines: N, importmap, importpath, label",
+        "edges": "depset of edge lines: E, importer importmap, imported importmap",
+    },
+)
+
+def _node(data):
+    return "N\t{}\t{}\t{}".format(data.importmap, data.importpath, data.label)
+
+def _go_dep_graph_aspect_impl(target, ctx):
+    transitive = []
+    for attr in ("deps", "embed"):
+        deps = getattr(ctx.rule.attr, attr, [])
+        if type(deps) != "list":
+            continue
+        transitive.extend([dep[_GoDepGraphInfo] for dep in deps if _GoDepGraphInfo in dep])
+    if GoArchive not in target:
+        return [_GoDepGraphInfo(
+            nodes = depset(transitive = [t.nodes for t in transitive]),
+            edges = depset(transitive = [t.edges for t in transitive]),
+        )]
+
+    # Edges come from the archive rather than the deps attribute, since
+    # the archive includes dependencies of embedded libraries.
+    archive = get_archive(target)
+    edges = [
+        "E\t{}\t{}".format(archive.data.importmap, dep.data.importmap)
+        for dep in archive.direct
+    ]
+    return [_GoDepGraphInfo(
+        nodes = depset(
+            direct = [_node(archive.data)] + [_node(dep.data) for dep in archive.direct],
+            transitive = [t.nodes for t in transitive],
+        ),
+        edges = depset(
+            direct = edges,
+            transitive = [t.edges for t in transitive],
+        ),
+    )]
+
+_go_dep_graph_aspect = aspect(
+    _go_dep_graph_aspect_impl,
+    attr_aspects = ["deps", "embed"],
+)
+
+def _go_dep_graph_impl(ctx):
+    archive = get_archive(ctx.attr.dep)
+    info = ctx.attr.dep[_GoDepGraphInfo]
+    lines = ["R\t" + archive.data.importmap]
+    lines.extend(info.nodes.to_list())
+    lines.extend(info.edges.to_list())
+    graph = ctx.actions.declare_file(ctx.label.name + ".graph")
+    ctx.actions.write(graph, "\n".join(lines) + "\n")
+
+    args = ["-graph", graph.short_path, "-format", ctx.attr.format]
+    if ctx.attr.depth > 0:
+        args.extend(["-depth", str(ctx.attr.depth)])
+    if ctx.attr.include:
+        args.extend(["-include", ctx.attr.include])
+    if ctx.attr.exclude:
+        args.extend(["-exclude", ctx.attr.exclude])
+    script = ctx.actions.declare_file(ctx.label.name + ".sh")
+    ctx.actions.write(
+        script,
+        "#!/usr/bin/env bash\nexec {} {} \"$@\"\n".format(
+            _shell_quote(ctx.executable._dep_graph.short_path),
+            " ".join([_shell_quote(a) for a in args]),
+        ),
+        is_executable = True,
+    )
+    runfiles = ctx.runfiles(files = [graph, ctx.executable._dep_graph])
+    runfiles = runfiles.merge(ctx.attr._dep_graph[DefaultInfo].default_runfiles)
+    return [DefaultInfo(
+        files = depset([graph]),
+        runfiles = runfiles,
+        executable = script,
+    )]
+
+def _shell_quote(s):
+    return "'" + s.replace("'", "'\\''") + "'"
+
+go_dep_graph = rule(
+    _go_dep_graph_impl,
+    attrs = {
+        "dep": attr.label(
+            mandatory = True,
+            providers = [GoArchive],
+            aspects = [_go_dep_graph_aspect],
+        ),
+        "format": attr.string(
+            default = "dot",
+            values = ["dot", "json"],
+        ),
+        "depth": attr.int(default = 0),
+        "include": attr.string(),
+        "exclude": attr.string(),
+        "_dep_graph": attr.label(
+            default = "@io_bazel_rules_go//go/tools/dep_graph",
+            executable = True,
+            cfg = "target",
+        ),
+    },
+    executable = True,
+    doc = """Renders the Go package dependency graph of a target when run.""",
+)
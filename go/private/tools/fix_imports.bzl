@@ -0,0 +1,114 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+
+load(
+    "@io_bazel_rules_go//go/private:context.bzl",
+    "go_context",
+)
+load(
+    "@io_bazel_rules_go//go/private:rules/rule.bzl",
+    "go_rule",
+)
+
+def _go_fix_imports_impl(ctx):
+    go = go_context(ctx)
+    goimports = ctx.executable._goimports
+    goroot = go.sdk.root_file.short_path.rpartition("/")[0] or "."
+
+    # goimports runs go to find the module cache and packages that may satisfy
+    # missing imports. It uses the SDK of the registered toolchain, not one
+    # installed on the host.
+    lines = [
+        "#!/usr/bin/env bash",
+        "set -euo pipefail",
+        "runfiles=\"$PWD\"",
+        "export GOROOT=\"$runfiles\"/{}".format(_shell_quote(goroot)),
+        "export PATH=\"$GOROOT/bin:$PATH\"",
+        "goimports=\"$runfiles\"/{}".format(_shell_quote(goimports.short_path)),
+        "if [[ -z \"${BUILD_WORKSPACE_DIRECTORY:-}\" ]]; then",
+        "  echo >&2 \"{}: must be run with bazel run\"".format(ctx.label.name),
+        "  exit 1",
+        "fi",
+        "local_prefix={}".format(_shell_quote(ctx.attr.local)),
+        "if [[ -z \"$local_prefix\" && -f \"$BUILD_WORKSPACE_DIRECTORY/go.mod\" ]]; then",
+        "  local_prefix=$(sed -n 's/^module[[:space:]]*\"\\{0,1\\}\\([^\"[:space:]]*\\).*/\\1/p' \"$BUILD_WORKSPACE_DIRECTORY/go.mod\" | head -n 1)",
+        "fi",
+
+        # Arguments starting with '-' are passed to goimports, so flags with
+        # values must be written as -flag=value. Other arguments name files
+        # and directories to fix, relative to the directory bazel run was
+        # started in.
+        "cd \"${BUILD_WORKING_DIRECTORY:-$BUILD_WORKSPACE_DIRECTORY}\"",
+        "flags=()",
+        "paths=()",
+        "for arg in \"$@\"; do",
+        "  case \"$arg\" in",
+        "    -*) flags+=(\"$arg\") ;;",
+        "    *)",
+        "      if [[ ! -e \"$arg\" ]]; then",
+        "        echo >&2 \"{}: $arg: no such file or directory\"".format(ctx.label.name),
+        "        exit 1",
+        "      fi",
+        "      paths+=(\"$arg\")",
+        "      ;;",
+        "  esac",
+        "done",
+        "if [[ ${#flags[@]} -eq 0 ]]; then",
+        "  flags=(-w)",
+        "fi",
+        "if [[ -n \"$local_prefix\" ]]; then",
+        "  flags+=(-local \"$local_prefix\")",
+        "fi",
+        "if [[ ${#paths[@]} -eq 0 ]]; then",
+        "  paths=(\"$BUILD_WORKSPACE_DIRECTORY\")",
+        "fi",
+
+        # find doesn't follow symbolic links, so Bazel's convenience links
+        # to output directories and external repositories are skipped.
+        "files=()",
+        "while IFS= read -r -d '' f; do",
+        "  files+=(\"$f\")",
+        "done < <(find \"${paths[@]}\" -type d \\( -name testdata -o -name vendor -o \\( -name '.*' ! -name . ! -name .. \\) \\) -prune -o -type f -name '*.go' -print0)",
+        "if [[ ${#files[@]} -eq 0 ]]; then",
+        "  exit 0",
+        "fi",
+        "exec \"$goimports\" \"${flags[@]}\" \"${files[@]}\"",
+    ]
+    script = ctx.actions.declare_file(ctx.label.name + ".sh")
+    ctx.actions.write(script, "\n".join(lines) + "\n", is_executable = True)
+    runfiles = ctx.runfiles(
+        files = [go.sdk.root_file, go.sdk.go] + go.sdk.srcs,
+    ).merge(ctx.attr._goimports[DefaultInfo].default_runfiles)
+    return [DefaultInfo(
+        runfiles = runfiles,
+        executable = script,
+    )]
+
+def _shell_quote(s):
+    return "'" + s.replace("'", "'\\''") + "'"
+
+go_fix_imports = go_rule(
+    _go_fix_imports_impl,
+    attrs = {
+        "local": attr.string(),
+        "_goimports": attr.label(
+            default = "@org_golang_x_tools//cmd/goimports",
+            executable = True,
+            cfg = "target",
+        ),
+    },
+    executable = True,
+    doc = """Runs goimports on Go files in the workspace.""",
+)
@@ -25,7 +25,17 @@ load(
     "as_list",
 )
 
+# Version recorded for dependencies whose version isn't known, as the go
+# command does for modules replaced with directories.
+_UNKNOWN_MODULE_VERSION = "v0.0.0-00010101000000-000000000000"
+
 def _go_path_impl(ctx):
+    if ctx.attr.vendor:
+        if not ctx.attr.module_path:
+            fail("module_path must be set when vendor is True")
+        if ctx.attr.include_pkg:
+            fail("include_pkg can't be used when vendor is True")
+
     # Gather all archives. Note that there may be multiple packages with the same
     # importpath (e.g., multiple vendored libraries, internal tests). The same
     # package may also appear in different modes.
@@ -48,9 +58,14 @@ def _go_path_impl(ctx):
             importpath, pkgpath = effective_importpath_pkgpath(archive)
             if importpath == "":
                 continue  # synthetic archive or inferred location
+            if ctx.attr.vendor:
+                dir = _vendor_dir(ctx.attr.module_path, importpath)
+            else:
+                dir = "src/" + pkgpath
             pkg = struct(
                 importpath = importpath,
-                dir = "src/" + pkgpath,
+                dir = dir,
+                workspace_name = archive.label.workspace_name,
                 srcs = as_list(archive.orig_srcs),
                 data = as_list(archive.data_files),
                 pkgs = {mode: archive.file},
@@ -66,7 +81,7 @@ def _go_path_impl(ctx):
     manifest_entry_map = {}
     for pkg in pkg_map.values():
         for f in pkg.srcs:
-            dst = pkg.dir + "/" + f.basename
+            dst = _path_join(pkg.dir, f.basename)
             _add_manifest_entry(manifest_entries, manifest_entry_map, inputs, f, dst)
     if ctx.attr.include_pkg:
         for pkg in pkg_map.values():
@@ -81,9 +96,9 @@ def _go_path_impl(ctx):
                 parts = f.path.split("/")
                 if "testdata" in parts:
                     i = parts.index("testdata")
-                    dst = pkg.dir + "/" + "/".join(parts[i:])
+                    dst = _path_join(pkg.dir, "/".join(parts[i:]))
                 else:
-                    dst = pkg.dir + "/" + f.basename
+                    dst = _path_join(pkg.dir, f.basename)
                 _add_manifest_entry(manifest_entries, manifest_entry_map, inputs, f, dst)
     for f in ctx.files.data:
         _add_manifest_entry(
@@ -93,6 +108,10 @@ def _go_path_impl(ctx):
             f,
             f.basename,
         )
+    if ctx.attr.vendor:
+        go_mod, modules_txt = _vendor_module_files(ctx, pkg_map.values())
+        _add_manifest_entry(manifest_entries, manifest_entry_map, inputs, go_mod, "go.mod")
+        _add_manifest_entry(manifest_entries, manifest_entry_map, inputs, modules_txt, "vendor/modules.txt")
     manifest_file = ctx.actions.declare_file(ctx.label.name + "~manifest")
     manifest_entries_json = [e.to_json() for e in manifest_entries]
     manifest_content = "[\n  " + ",\n  ".join(manifest_entries_json) + "\n]"
@@ -163,6 +182,10 @@ go_path = rule(
         ),
         "include_data": attr.bool(default = True),
         "include_pkg": attr.bool(default = False),
+        "vendor": attr.bool(default = False),
+        "module_path": attr.string(),
+        "module_versions": attr.string_dict(),
+        "go_version": attr.string(default = "1.14"),
         "_go_path": attr.label(
             default = "@io_bazel_rules_go//go/tools/builders:go_path",
             executable = True,
@@ -171,6 +194,87 @@ go_path = rule(
     },
 )
 
+def _path_join(dir, name):
+    return dir + "/" + name if dir else name
+
+def _vendor_dir(module_path, importpath):
+    """Returns the directory of a package in the vendor layout. Packages in
+    the main module are placed relative to the root; others are vendored."""
+    if importpath == module_path:
+        return ""
+    if importpath.startswith(module_path + "/"):
+        return importpath[len(module_path) + 1:]
+    return "vendor/" + importpath
+
+def _is_path_prefix(prefix, path):
+    return path == prefix or path.startswith(prefix + "/")
+
+def _common_path_prefix(paths):
+    prefix = paths[0].split("/")
+    for path in paths[1:]:
+        parts = path.split("/")
+        n = 0
+        for i in range(min(len(prefix), len(parts))):
+            if prefix[i] != parts[i]:
+                break
+            n = i + 1
+        prefix = prefix[:n]
+    return "/".join(prefix)
+
+def _vendor_module_files(ctx, pkgs):
+    """Declares go.mod and vendor/modules.txt files describing the vendored
+    packages.
+
+    Each vendored package is assigned to the longest module path in
+    module_versions containing it. Other packages are grouped by the Bazel
+    repository they came from, in a module named after the longest import
+    path prefix they share, with an unknown version."""
+    known_paths = sorted(ctx.attr.module_versions.keys(), key = len, reverse = True)
+    module_pkgs = {}
+    repo_pkgs = {}
+    for pkg in pkgs:
+        if not pkg.dir.startswith("vendor/"):
+            continue
+        module_path = None
+        for path in known_paths:
+            if _is_path_prefix(path, pkg.importpath):
+                module_path = path
+                break
+        if module_path:
+            module_pkgs.setdefault(module_path, []).append(pkg.importpath)
+        else:
+            repo_pkgs.setdefault(pkg.workspace_name, []).append(pkg.importpath)
+    for importpaths in repo_pkgs.values():
+        module_path = _common_path_prefix(importpaths)
+        if module_path:
+            module_pkgs.setdefault(module_path, []).extend(importpaths)
+        else:
+            # Packages with nothing in common each get their own module.
+            for importpath in importpaths:
+                module_pkgs.setdefault(importpath, []).append(importpath)
+
+    requires = []
+    modules_txt_lines = []
+    for module_path in sorted(module_pkgs.keys()):
+        version = ctx.attr.module_versions.get(module_path, _UNKNOWN_MODULE_VERSION)
+        requires.append("\t{} {}".format(module_path, version))
+        modules_txt_lines.append("# {} {}".format(module_path, version))
+        modules_txt_lines.append("## explicit")
+        modules_txt_lines.extend(sorted({p: None for p in module_pkgs[module_path]}.keys()))
+
+    go_mod_lines = [
+        "module " + ctx.attr.module_path,
+        "",
+        "go " + ctx.attr.go_version,
+    ]
+    if requires:
+        go_mod_lines.extend(["", "require ("] + requires + [")"])
+    go_mod = ctx.actions.declare_file(ctx.label.name + "~go.mod")
+    ctx.actions.write(go_mod, "\n".join(go_mod_lines) + "\n")
+    modules_txt = ctx.actions.declare_file(ctx.label.name + "~modules.txt")
+    ctx.actions.write(modules_txt, "\n".join(modules_txt_lines) + "\n" if modules_txt_lines else "")
+    return go_mod, modules_txt
+
 def _merge_pkg(x, y):
     x_srcs = {f.path: None for f in x.srcs}
     x_data = {f.path: None for f in x.data}
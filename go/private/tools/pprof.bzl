@@ -0,0 +1,81 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:context.bzl",
+    "go_context",
+)
+load(
+    "@io_bazel_rules_go//go/private:rules/rule.bzl",
+    "go_rule",
+)
+
+def _go_pprof_impl(ctx):
+    go = go_context(ctx)
+    pprof = None
+    for f in go.sdk.tools:
+        if f.basename in ("pprof", "pprof.exe"):
+            pprof = f
+            break
+    if not pprof:
+        fail("pprof not found in the Go SDK")
+
+    # Profiles name the executables they were collected from. pprof looks for
+    # executables with the same base name (or build ID) in the directories
+    # listed in PPROF_BINARY_PATH, so pointing it at the binary's directory
+    # lets profiles from deployed copies be symbolized without naming it.
+    lines = [
+        "#!/usr/bin/env bash",
+        "set -euo pipefail",
+        "runfiles=\"$PWD\"",
+    ]
+    runfiles = ctx.runfiles(files = [pprof])
+    if ctx.attr.binary:
+        binary = ctx.executable.binary
+        lines.append(
+            "export PPROF_BINARY_PATH=\"$runfiles\"/{}\"${{PPROF_BINARY_PATH:+:$PPROF_BINARY_PATH}}\"".format(
+                _shell_quote(binary.short_path.rpartition("/")[0] or "."),
+            ),
+        )
+        runfiles = runfiles.merge(ctx.runfiles(files = [binary]))
+
+    # bazel run starts in the runfiles directory. Profiles named on the
+    # command line are relative to the directory bazel was run in.
+    lines.extend([
+        "if [[ -n \"${BUILD_WORKING_DIRECTORY:-}\" ]]; then",
+        "  cd \"$BUILD_WORKING_DIRECTORY\"",
+        "fi",
+        "exec \"$runfiles\"/{} \"$@\"".format(_shell_quote(pprof.short_path)),
+    ])
+    script = ctx.actions.declare_file(ctx.label.name + ".sh")
+    ctx.actions.write(script, "\n".join(lines) + "\n", is_executable = True)
+    return [DefaultInfo(
+        runfiles = runfiles,
+        executable = script,
+    )]
+
+def _shell_quote(s):
+    return "'" + s.replace("'", "'\\''") + "'"
+
+go_pprof = go_rule(
+    _go_pprof_impl,
+    attrs = {
+        "binary": attr.label(
+            executable = True,
+            cfg = "target",
+        ),
+    },
+    executable = True,
+    doc = """Runs the Go SDK's pprof, symbolizing profiles against binary.""",
+)
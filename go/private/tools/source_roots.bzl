@@ -0,0 +1,75 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+load(
+    "@io_bazel_rules_go//go/private:providers.bzl",
+    "GoArchive",
+    "effective_importpath_pkgpath",
+    "get_archive",
+)
+
+def _go_source_roots_impl(ctx):
+    archives = depset(transitive = [get_archive(dep).transitive for dep in ctx.attr.deps])
+
+    # Sources in the main workspace are already where editors expect them.
+    # Only files from external repositories and generated files are linked.
+    lines = []
+    files = []
+    for data in archives.to_list():
+        importpath, _ = effective_importpath_pkgpath(data)
+        if importpath == "":
+            continue
+        for f in data.orig_srcs:
+            if f.is_source and not f.owner.workspace_name:
+                continue
+            lines.append("\t".join([importpath, str(data.label), f.short_path, f.path]))
+            files.append(f)
+    manifest = ctx.actions.declare_file(ctx.label.name + ".manifest")
+    ctx.actions.write(manifest, "\n".join(lines) + "\n")
+
+    args = ["-manifest", manifest.short_path, "-dir", ctx.attr.dir]
+    script = ctx.actions.declare_file(ctx.label.name + ".sh")
+    ctx.actions.write(
+        script,
+        "#!/usr/bin/env bash\nexec {} {} \"$@\"\n".format(
+            _shell_quote(ctx.executable._source_roots.short_path),
+            " ".join([_shell_quote(a) for a in args]),
+        ),
+        is_executable = True,
+    )
+    runfiles = ctx.runfiles(files = [manifest, ctx.executable._source_roots] + files)
+    runfiles = runfiles.merge(ctx.attr._source_roots[DefaultInfo].default_runfiles)
+    return [DefaultInfo(
+        files = depset([manifest]),
+        runfiles = runfiles,
+        executable = script,
+    )]
+
+def _shell_quote(s):
+    return "'" + s.replace("'", "'\\''") + "'"
+
+go_source_roots = rule(
+    _go_source_roots_impl,
+    attrs = {
+        "deps": attr.label_list(providers = [GoArchive]),
+        "dir": attr.string(default = ".go_source_roots"),
+        "_source_roots": attr.label(
+            default = "@io_bazel_rules_go//go/tools/source_roots",
+            executable = True,
+            cfg = "target",
+        ),
+    },
+    executable = True,
+    doc = """Links external and generated Go sources into the workspace when run.""",
+)
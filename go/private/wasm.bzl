@@ -0,0 +1,93 @@
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# wasm.bzl declares go_download_wasmtime, which downloads the wasmtime
+# WebAssembly runtime for the host. go_test runs tests built for wasip1 with it.
+
+DEFAULT_WASMTIME_VERSION = "14.0.4"
+
+# Names wasmtime release archives use for each host, keyed by the names
+# _detect_host returns.
+_WASMTIME_HOSTS = {
+    "darwin_amd64": "x86_64-macos",
+    "darwin_arm64": "aarch64-macos",
+    "linux_amd64": "x86_64-linux",
+    "linux_arm64": "aarch64-linux",
+    "windows_amd64": "x86_64-windows",
+}
+
+def _detect_host(ctx):
+    if ctx.os.name == "linux":
+        goos = "linux"
+    elif ctx.os.name == "mac os x":
+        goos = "darwin"
+    elif ctx.os.name.startswith("windows"):
+        return "windows_amd64"
+    else:
+        fail("{}: unsupported operating system: {}".format(ctx.name, ctx.os.name))
+    res = ctx.execute(["uname", "-m"])
+    if res.return_code == 0 and res.stdout.strip() in ("aarch64", "arm64"):
+        return goos + "_arm64"
+    return goos + "_amd64"
+
+def _go_download_wasmtime_impl(ctx):
+    host = _detect_host(ctx)
+    if host not in _WASMTIME_HOSTS:
+        fail("{}: wasmtime is not available for {}".format(ctx.name, host))
+    ext = ".zip" if host.startswith("windows") else ".tar.xz"
+    prefix = "wasmtime-v{}-{}".format(ctx.attr.version, _WASMTIME_HOSTS[host])
+    urls = [url.format(version = ctx.attr.version, filename = prefix + ext) for url in ctx.attr.urls]
+    result = ctx.download_and_extract(
+        url = urls,
+        sha256 = ctx.attr.sha256s.get(host, ""),
+        stripPrefix = prefix,
+    )
+    if host not in ctx.attr.sha256s:
+        # The version is pinned, but the download can't be verified without
+        # a checksum. Say what to add, as http_archive does.
+        print("{}: no checksum for wasmtime {} on {}. Add sha256s = {{\"{}\": \"{}\"}} to pin it.".format(
+            ctx.name,
+            ctx.attr.version,
+            host,
+            host,
+            result.sha256,
+        ))
+
+    exe = "wasmtime.exe" if host.startswith("windows") else "wasmtime"
+    if not ctx.path(exe).exists:
+        fail("{}: {} not found in the downloaded archive".format(ctx.name, exe))
+    ctx.file("BUILD.bazel", """filegroup(
+    name = "wasmtime",
+    srcs = ["{exe}"],
+    visibility = ["//visibility:public"],
+)
+""".format(exe = exe))
+
+go_download_wasmtime = repository_rule(
+    _go_download_wasmtime_impl,
+    attrs = {
+        "version": attr.string(default = DEFAULT_WASMTIME_VERSION),
+        "urls": attr.string_list(
+            default = ["https://github.com/bytecodealliance/wasmtime/releases/download/v{version}/{filename}"],
+            doc = """URL templates for release archives. {version} and
+            {filename} are replaced.""",
+        ),
+        "sha256s": attr.string_dict(
+            doc = """SHA-256 checksums of release archives, keyed by host
+            platform, like "linux_amd64".""",
+        ),
+    },
+    doc = """Downloads the wasmtime WebAssembly runtime for the host.
+    go_test runs tests built for wasip1 with it.""",
+)
@@ -0,0 +1,45 @@
+#!/usr/bin/env bash
+
+# Copyright 2020 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#    http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+# Runs a WebAssembly module built for wasip1 with wasmtime. This is the
+# default test_runner of wasip1 toolchains. Arguments are passed to
+# "wasmtime run" after the options set here, so they may include more wasmtime
+# options before the module.
+#
+# wasmtime only lets the module see the directories passed with --dir and the
+# variables passed with --env, so the test can find its runfiles and write to
+# its temporary directory.
+
+set -euo pipefail
+
+wasmtime="${RUNFILES_DIR}/go_wasmtime/wasmtime"
+args=(run "--dir=$PWD" "--env=PWD=$PWD")
+for dir in "${TEST_SRCDIR:-}" "${TEST_TMPDIR:-}"; do
+  if [[ -n "$dir" ]]; then
+    args+=("--dir=$dir")
+  fi
+done
+if [[ -n "${TEST_SHARD_STATUS_FILE:-}" ]]; then
+  args+=("--dir=$(dirname "$TEST_SHARD_STATUS_FILE")")
+fi
+vars=(TEST_SRCDIR TEST_WORKSPACE TEST_TMPDIR TEST_TOTAL_SHARDS TEST_SHARD_INDEX
+  TEST_SHARD_STATUS_FILE TESTBRIDGE_TEST_ONLY)
+for var in "${vars[@]}"; do
+  if [[ -n "${!var:-}" ]]; then
+    args+=("--env=$var=${!var}")
+  fi
+done
+exec "$wasmtime" "${args[@]}" "$@"
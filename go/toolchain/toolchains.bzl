@@ -87,6 +87,24 @@ def declare_constraints():
         constraint_setting = ":cgo_constraint",
     )
 
+    # Selects a C toolchain linking against a particular libc instead of the
+    # host's. Toolchains declared with go_musl_toolchain have the musl
+    # constraint; those declared with go_sysroot_toolchain have the constraint
+    # for the sysroot's libc.
+    native.constraint_setting(
+        name = "libc_constraint",
+    )
+
+    native.constraint_value(
+        name = "musl",
+        constraint_setting = ":libc_constraint",
+    )
+
+    native.constraint_value(
+        name = "glibc",
+        constraint_setting = ":libc_constraint",
+    )
+
     for p in PLATFORMS:
         native.platform(
             name = p.name,
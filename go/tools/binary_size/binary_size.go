@@ -0,0 +1,317 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// binary_size compares the size of a Go binary with a baseline. It's run by
+// the go_binary_size_test rule.
+//
+// The size of each section and the size of the symbols the linker emitted
+// for each package are measured. If the binary has grown by more than the
+// tolerance, binary_size fails and lists the sections and packages that grew
+// the most. When run with -update, it writes the current sizes to the
+// baseline file in the workspace instead.
+package main
+
+import (
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("binary_size: ")
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("binary_size", flag.ExitOnError)
+	binaryPath := fs.String("binary", "", "The binary to measure")
+	baselinePath := fs.String("baseline", "", "The baseline file, relative to the working directory")
+	baselineSrc := fs.String("baseline_src", "", "The baseline file, relative to the workspace root. Written with -update.")
+	label := fs.String("label", "", "The label of the test, for messages")
+	tolerance := fs.Float64("tolerance_percent", 1, "How much the binary may grow, as a percentage of the baseline size")
+	top := fs.Int("top", 10, "How many sections and packages to list when the binary is too large")
+	update := fs.Bool("update", false, "Write the current sizes to the baseline file in the workspace")
+	workspace := fs.String("workspace", os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "The workspace root. Set by bazel run.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *binaryPath == "" {
+		return errors.New("-binary must be set")
+	}
+
+	current, err := measure(*binaryPath)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *binaryPath, err)
+	}
+
+	if *update {
+		if *workspace == "" {
+			return errors.New("-update must be used with bazel run")
+		}
+		if *baselineSrc == "" {
+			return errors.New("-baseline_src must be set")
+		}
+		data, err := json.MarshalIndent(current, "", "  ")
+		if err != nil {
+			return err
+		}
+		out := filepath.Join(*workspace, filepath.FromSlash(*baselineSrc))
+		if err := ioutil.WriteFile(out, append(data, '\n'), 0666); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "wrote %s: %d bytes\n", *baselineSrc, current.Total)
+		return nil
+	}
+
+	updateHint := fmt.Sprintf("To accept the current size, run:\n\n    bazel run %s -- -update\n", *label)
+	data, err := ioutil.ReadFile(*baselinePath)
+	if err != nil {
+		return err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return fmt.Errorf("baseline %s is empty. %s", *baselineSrc, updateHint)
+	}
+	var baseline sizes
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return fmt.Errorf("%s: %v", *baselinePath, err)
+	}
+
+	ok := compare(stdout, &baseline, current, *tolerance, *top)
+	if !ok {
+		fmt.Fprintf(stdout, "\n%s", updateHint)
+		return fmt.Errorf("%s grew by more than %g%%", filepath.Base(*binaryPath), *tolerance)
+	}
+	return nil
+}
+
+// sizes describes the size of a binary. It's the format of the baseline file.
+type sizes struct {
+	// Total is the size of the file.
+	Total int64 `json:"total"`
+
+	// Sections maps section names to their sizes in the file.
+	Sections map[string]int64 `json:"sections"`
+
+	// Packages maps package paths to the total size of the symbols the
+	// linker emitted for them. Symbols that don't belong to a package, like
+	// type descriptors and C symbols, are grouped under names in
+	// parentheses. This is empty for binaries without a symbol table.
+	Packages map[string]int64 `json:"packages,omitempty"`
+}
+
+// symbol is a symbol in a binary. Size may be zero if the format doesn't
+// record symbol sizes; it's computed from the address of the next symbol.
+type symbol struct {
+	name    string
+	addr    uint64
+	size    uint64
+	section int
+}
+
+// measure reads the sections and symbols of the binary at path.
+func measure(path string) (*sizes, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &sizes{
+		Total:    fi.Size(),
+		Sections: make(map[string]int64),
+	}
+	var syms []symbol
+	var sectionEnds []uint64
+
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		for _, sec := range f.Sections {
+			sectionEnds = append(sectionEnds, sec.Addr+sec.Size)
+			if sec.Name != "" && sec.Type != elf.SHT_NOBITS {
+				s.Sections[sec.Name] += int64(sec.FileSize)
+			}
+		}
+		elfSyms, _ := f.Symbols()
+		for _, sym := range elfSyms {
+			if sym.Section == elf.SHN_UNDEF || int(sym.Section) >= len(f.Sections) || elf.ST_TYPE(sym.Info) == elf.STT_SECTION || elf.ST_TYPE(sym.Info) == elf.STT_FILE {
+				continue
+			}
+			syms = append(syms, symbol{name: sym.Name, addr: sym.Value, size: sym.Size, section: int(sym.Section)})
+		}
+	} else if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		for _, sec := range f.Sections {
+			sectionEnds = append(sectionEnds, sec.Addr+sec.Size)
+			if sec.Offset != 0 { // not zero-fill
+				s.Sections[sec.Seg+","+sec.Name] += int64(sec.Size)
+			}
+		}
+		if f.Symtab != nil {
+			for _, sym := range f.Symtab.Syms {
+				if sym.Sect == 0 || int(sym.Sect) > len(f.Sections) || sym.Type&0xe0 != 0 {
+					continue // undefined or debugging symbol
+				}
+				syms = append(syms, symbol{name: strings.TrimPrefix(sym.Name, "_"), addr: sym.Value, section: int(sym.Sect - 1)})
+			}
+		}
+	} else if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		for _, sec := range f.Sections {
+			s.Sections[sec.Name] += int64(sec.Size)
+			sectionEnds = append(sectionEnds, uint64(sec.VirtualAddress)+uint64(sec.VirtualSize))
+		}
+		for _, sym := range f.Symbols {
+			if sym.SectionNumber <= 0 || int(sym.SectionNumber) > len(f.Sections) {
+				continue
+			}
+			syms = append(syms, symbol{name: sym.Name, addr: uint64(sym.Value), section: int(sym.SectionNumber - 1)})
+		}
+		for i := range syms {
+			syms[i].addr += uint64(f.Sections[syms[i].section].VirtualAddress)
+		}
+	} else {
+		return nil, errors.New("not an ELF, Mach-O, or PE file")
+	}
+
+	fillSizes(syms, sectionEnds)
+	if len(syms) > 0 {
+		s.Packages = make(map[string]int64)
+		for _, sym := range syms {
+			s.Packages[packageOf(sym.name)] += int64(sym.size)
+		}
+	}
+	return s, nil
+}
+
+// fillSizes sets the size of symbols without one to the distance to the next
+// symbol in the same section, or to the end of the section.
+func fillSizes(syms []symbol, sectionEnds []uint64) {
+	sort.SliceStable(syms, func(i, j int) bool {
+		if syms[i].section != syms[j].section {
+			return syms[i].section < syms[j].section
+		}
+		return syms[i].addr < syms[j].addr
+	})
+	for i := range syms {
+		if syms[i].size != 0 {
+			continue
+		}
+		var end uint64
+		if i+1 < len(syms) && syms[i+1].section == syms[i].section {
+			end = syms[i+1].addr
+		} else if syms[i].section < len(sectionEnds) {
+			end = sectionEnds[syms[i].section]
+		}
+		if end > syms[i].addr {
+			syms[i].size = end - syms[i].addr
+		}
+	}
+}
+
+// packageOf returns the path of the package a symbol belongs to, like
+// "example.com/foo" for "example.com/foo.(*T).Method".
+func packageOf(name string) string {
+	switch {
+	case strings.HasPrefix(name, "type:"), strings.HasPrefix(name, "type."):
+		return "(types)"
+	case strings.HasPrefix(name, "go:"), strings.HasPrefix(name, "go."):
+		return "(go)"
+	}
+	// Type arguments may contain other package paths.
+	if i := strings.IndexByte(name, '['); i >= 0 {
+		name = name[:i]
+	}
+	slash := strings.LastIndexByte(name, '/')
+	dot := strings.IndexByte(name[slash+1:], '.')
+	if dot <= 0 {
+		return "(other)"
+	}
+	return name[:slash+1+dot]
+}
+
+// compare prints how current differs from baseline and reports whether the
+// total size is within tolerance.
+func compare(w io.Writer, baseline, current *sizes, tolerancePercent float64, top int) bool {
+	limit := baseline.Total + int64(float64(baseline.Total)*tolerancePercent/100)
+	fmt.Fprintf(w, "total: %d bytes (baseline %d, %s, limit %d)\n", current.Total, baseline.Total, percent(baseline.Total, current.Total), limit)
+	if current.Total <= limit {
+		if current.Total < baseline.Total-int64(float64(baseline.Total)*tolerancePercent/100) {
+			fmt.Fprintf(w, "note: the binary is much smaller than the baseline; consider updating it\n")
+		}
+		return true
+	}
+
+	fmt.Fprintf(w, "\nsections that grew the most:\n")
+	printGrowth(w, baseline.Sections, current.Sections, top)
+	if len(current.Packages) > 0 {
+		fmt.Fprintf(w, "\npackages that grew the most:\n")
+		printGrowth(w, baseline.Packages, current.Packages, top)
+	} else {
+		fmt.Fprintf(w, "\nthe binary has no symbol table, so sizes can't be attributed to packages\n")
+	}
+	return false
+}
+
+type growth struct {
+	name             string
+	baseline, actual int64
+}
+
+func printGrowth(w io.Writer, baseline, current map[string]int64, top int) {
+	var gs []growth
+	for name, n := range current {
+		if n > baseline[name] {
+			gs = append(gs, growth{name, baseline[name], n})
+		}
+	}
+	sort.Slice(gs, func(i, j int) bool {
+		di, dj := gs[i].actual-gs[i].baseline, gs[j].actual-gs[j].baseline
+		if di != dj {
+			return di > dj
+		}
+		return gs[i].name < gs[j].name
+	})
+	if len(gs) > top {
+		gs = gs[:top]
+	}
+	if len(gs) == 0 {
+		fmt.Fprintf(w, "    (none)\n")
+	}
+	for _, g := range gs {
+		if g.baseline == 0 {
+			fmt.Fprintf(w, "    %+10d  %s (new)\n", g.actual, g.name)
+		} else {
+			fmt.Fprintf(w, "    %+10d  %s (%s)\n", g.actual-g.baseline, g.name, percent(g.baseline, g.actual))
+		}
+	}
+}
+
+func percent(baseline, current int64) string {
+	if baseline == 0 {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", float64(current-baseline)*100/float64(baseline))
+}
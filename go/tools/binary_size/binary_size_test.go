@@ -0,0 +1,124 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPackageOf(t *testing.T) {
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"main.main", "main"},
+		{"fmt.Println", "fmt"},
+		{"example.com/foo.(*T).Method", "example.com/foo"},
+		{"example.com/foo.init.0", "example.com/foo"},
+		{"example.com/foo/v2.F[example.com/bar.T]", "example.com/foo/v2"},
+		{"type:*example.com/foo.T", "(types)"},
+		{"type..eq.example.com/foo.T", "(types)"},
+		{"go:itab.*os.File,io.Writer", "(go)"},
+		{"go.buildid", "(go)"},
+		{"malloc", "(other)"},
+	} {
+		if got := packageOf(tc.name); got != tc.want {
+			t.Errorf("packageOf(%q): got %q; want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestFillSizes(t *testing.T) {
+	syms := []symbol{
+		{name: "b", addr: 0x20, section: 1},
+		{name: "a", addr: 0x10, section: 1},
+		{name: "c", addr: 0x28, size: 4, section: 1},
+		{name: "d", addr: 0x40, section: 2},
+	}
+	fillSizes(syms, []uint64{0, 0x30, 0x48})
+	want := []symbol{
+		{name: "a", addr: 0x10, size: 0x10, section: 1},
+		{name: "b", addr: 0x20, size: 0x8, section: 1},
+		{name: "c", addr: 0x28, size: 4, section: 1},
+		{name: "d", addr: 0x40, size: 0x8, section: 2},
+	}
+	if !reflect.DeepEqual(syms, want) {
+		t.Errorf("got %#v; want %#v", syms, want)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	baseline := &sizes{
+		Total:    1000,
+		Sections: map[string]int64{".text": 600, ".rodata": 400},
+		Packages: map[string]int64{"main": 100, "fmt": 500},
+	}
+
+	within := &sizes{
+		Total:    1010,
+		Sections: map[string]int64{".text": 610, ".rodata": 400},
+		Packages: map[string]int64{"main": 110, "fmt": 500},
+	}
+	var buf bytes.Buffer
+	if !compare(&buf, baseline, within, 1, 10) {
+		t.Errorf("binary within tolerance was reported as too large:\n%s", buf.String())
+	}
+
+	grown := &sizes{
+		Total:    1200,
+		Sections: map[string]int64{".text": 750, ".rodata": 450},
+		Packages: map[string]int64{"main": 100, "fmt": 520, "example.com/big": 180},
+	}
+	buf.Reset()
+	if compare(&buf, baseline, grown, 1, 10) {
+		t.Fatalf("binary beyond tolerance was not reported:\n%s", buf.String())
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"+150  .text (+25.0%)",
+		"+180  example.com/big (new)",
+		"+20  fmt (+4.0%)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "  main") {
+		t.Errorf("output lists package that didn't grow:\n%s", out)
+	}
+	if i, j := strings.Index(out, "example.com/big"), strings.Index(out, "fmt"); i > j {
+		t.Errorf("packages are not sorted by growth:\n%s", out)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := measure(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Total == 0 || len(s.Sections) == 0 {
+		t.Errorf("sizes of test binary are missing: %+v", s)
+	}
+	if len(s.Packages) > 0 && s.Packages["testing"] == 0 {
+		t.Errorf("no symbols attributed to package testing: %v", s.Packages)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// diff compares build tag reports from two configurations and prints the
+// differences in tags and in which files were selected for compilation.
+//
+// Build the go_build_tags output group once for each configuration, and copy
+// the reports somewhere between builds:
+//
+//	bazel build --output_groups=go_build_tags //...
+//	cp -r bazel-bin /tmp/local
+//	bazel build --output_groups=go_build_tags --config=ci //...
+//	bazel run @io_bazel_rules_go//go/tools/build_tags:diff -- /tmp/local bazel-bin
+//
+// Each argument may be a .build_tags.json file or a directory containing
+// them. Reports are matched by target label. diff exits with status 1 if
+// there are differences.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("diff: ")
+	same, err := run(os.Args[1:], os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !same {
+		os.Exit(1)
+	}
+}
+
+// report is a build tags report written by the builder's buildtags verb.
+type report struct {
+	Label       string          `json:"label"`
+	ImportPath  string          `json:"importpath"`
+	GOOS        string          `json:"goos"`
+	GOARCH      string          `json:"goarch"`
+	CgoEnabled  bool            `json:"cgo_enabled"`
+	Compiler    string          `json:"compiler"`
+	Tags        []string        `json:"tags"`
+	ReleaseTags []string        `json:"release_tags"`
+	Files       []fileSelection `json:"files"`
+}
+
+type fileSelection struct {
+	Path     string `json:"path"`
+	Included bool   `json:"included"`
+	Reason   string `json:"reason"`
+}
+
+// run compares the reports named by args and writes the differences to w.
+// It reports whether there were no differences.
+func run(args []string, w io.Writer) (bool, error) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: bazel run @io_bazel_rules_go//go/tools/build_tags:diff -- old new\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return false, errors.New("expected two reports or directories to compare")
+	}
+
+	workspaceDir := os.Getenv("BUILD_WORKSPACE_DIRECTORY")
+	var sides [2]map[string]*report
+	for i, arg := range fs.Args() {
+		if !filepath.IsAbs(arg) && workspaceDir != "" {
+			arg = filepath.Join(workspaceDir, arg)
+		}
+		reports, err := readReports(arg)
+		if err != nil {
+			return false, err
+		}
+		if len(reports) == 0 {
+			return false, fmt.Errorf("%s: no .build_tags.json files found. Build with --output_groups=go_build_tags first.", arg)
+		}
+		sides[i] = reports
+	}
+	return diffReports(sides[0], sides[1], w), nil
+}
+
+// readReports reads the report at path or the reports in the directory at
+// path, recursively. Reports are keyed by label.
+func readReports(path string) (map[string]*report, error) {
+	// bazel-bin is usually a symbolic link, which filepath.Walk won't
+	// descend into.
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	reports := make(map[string]*report)
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != path && (!info.Mode().IsRegular() || !strings.HasSuffix(p, ".build_tags.json")) {
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		r := &report{}
+		if err := json.Unmarshal(data, r); err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		reports[r.Label] = r
+		return nil
+	})
+	return reports, err
+}
+
+// diffReports writes the differences between the reports in old and new
+// to w and reports whether they were the same.
+func diffReports(old, new map[string]*report, w io.Writer) bool {
+	labelSet := make(map[string]bool)
+	for l := range old {
+		labelSet[l] = true
+	}
+	for l := range new {
+		labelSet[l] = true
+	}
+	labels := make([]string, 0, len(labelSet))
+	for l := range labelSet {
+		labels = append(labels, l)
+	}
+	sort.Strings(labels)
+
+	same := true
+	for _, label := range labels {
+		o, n := old[label], new[label]
+		var lines []string
+		switch {
+		case o == nil:
+			lines = []string{"only in new"}
+		case n == nil:
+			lines = []string{"only in old"}
+		default:
+			lines = diffReport(o, n)
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		same = false
+		fmt.Fprintln(w, label)
+		for _, line := range lines {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+	}
+	return same
+}
+
+func diffReport(o, n *report) []string {
+	var lines []string
+	field := func(name, o, n string) {
+		if o != n {
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s", name, o, n))
+		}
+	}
+	field("goos", o.GOOS, n.GOOS)
+	field("goarch", o.GOARCH, n.GOARCH)
+	field("cgo_enabled", fmt.Sprint(o.CgoEnabled), fmt.Sprint(n.CgoEnabled))
+	field("compiler", o.Compiler, n.Compiler)
+	if d := diffSets(o.Tags, n.Tags); d != "" {
+		lines = append(lines, "tags: "+d)
+	}
+	if d := diffSets(o.ReleaseTags, n.ReleaseTags); d != "" {
+		lines = append(lines, "release_tags: "+d)
+	}
+
+	oldFiles := make(map[string]fileSelection)
+	for _, f := range o.Files {
+		oldFiles[normalizePath(f.Path)] = f
+	}
+	newFiles := make(map[string]fileSelection)
+	for _, f := range n.Files {
+		newFiles[normalizePath(f.Path)] = f
+	}
+	paths := make([]string, 0, len(oldFiles)+len(newFiles))
+	for p := range oldFiles {
+		paths = append(paths, p)
+	}
+	for p := range newFiles {
+		if _, ok := oldFiles[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		of, inOld := oldFiles[p]
+		nf, inNew := newFiles[p]
+		switch {
+		case !inOld:
+			lines = append(lines, fmt.Sprintf("%s: only in new (%s)", p, describe(nf)))
+		case !inNew:
+			lines = append(lines, fmt.Sprintf("%s: only in old (%s)", p, describe(of)))
+		case of.Included != nf.Included:
+			lines = append(lines, fmt.Sprintf("%s: %s -> %s", p, describe(of), describe(nf)))
+		}
+	}
+	return lines
+}
+
+// diffSets formats the elements added to and removed from a set, like
+// "+foo -bar". It returns an empty string if the sets are equal.
+func diffSets(o, n []string) string {
+	inOld := make(map[string]bool)
+	for _, s := range o {
+		inOld[s] = true
+	}
+	inNew := make(map[string]bool)
+	for _, s := range n {
+		inNew[s] = true
+	}
+	var changes []string
+	for _, s := range n {
+		if !inOld[s] {
+			changes = append(changes, "+"+s)
+		}
+	}
+	for _, s := range o {
+		if !inNew[s] {
+			changes = append(changes, "-"+s)
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i][1:] < changes[j][1:] })
+	return strings.Join(changes, " ")
+}
+
+func describe(f fileSelection) string {
+	if f.Included {
+		return "included"
+	}
+	if f.Reason == "" {
+		return "excluded"
+	}
+	return "excluded: " + f.Reason
+}
+
+// normalizePath removes the configuration-specific output directory from
+// paths of generated files, so they can be compared across configurations.
+// For example, "bazel-out/k8-fastbuild/bin/pkg/gen.go" becomes
+// "bazel-out/.../bin/pkg/gen.go".
+func normalizePath(p string) string {
+	parts := strings.SplitN(filepath.ToSlash(p), "/", 3)
+	if len(parts) == 3 && parts[0] == "bazel-out" {
+		return "bazel-out/.../" + parts[2]
+	}
+	return p
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "diff_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"old/pkg/lib.build_tags.json": `{
+  "label": "//pkg:lib",
+  "goos": "linux",
+  "goarch": "amd64",
+  "cgo_enabled": true,
+  "compiler": "gc",
+  "tags": ["amd64", "cgo", "gc", "linux"],
+  "files": [
+    {"path": "pkg/lib.go", "included": true},
+    {"path": "pkg/lib_cgo.go", "included": true},
+    {"path": "pkg/lib_nocgo.go", "included": false, "reason": "build constraints not satisfied: // +build !cgo"},
+    {"path": "bazel-out/k8-fastbuild/bin/pkg/gen.go", "included": true}
+  ]
+}`,
+		"old/other/other.build_tags.json": `{"label": "//other:other", "goos": "linux"}`,
+		"old/same/same.build_tags.json":   `{"label": "//same:same", "goos": "linux"}`,
+		"new/pkg/lib.build_tags.json": `{
+  "label": "//pkg:lib",
+  "goos": "linux",
+  "goarch": "amd64",
+  "cgo_enabled": false,
+  "compiler": "gc",
+  "tags": ["amd64", "gc", "linux", "pure"],
+  "files": [
+    {"path": "pkg/lib.go", "included": true},
+    {"path": "pkg/lib_cgo.go", "included": false, "reason": "file imports \"C\", but cgo is disabled"},
+    {"path": "pkg/lib_nocgo.go", "included": true},
+    {"path": "bazel-out/k8-fastbuild-ST-1234/bin/pkg/gen.go", "included": true}
+  ]
+}`,
+		"new/same/same.build_tags.json": `{"label": "//same:same", "goos": "linux"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	out := &bytes.Buffer{}
+	same, err := run([]string{filepath.Join(dir, "old"), filepath.Join(dir, "new")}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same {
+		t.Error("got same; want differences")
+	}
+	want := `//other:other
+  only in old
+//pkg:lib
+  cgo_enabled: true -> false
+  tags: -cgo +pure
+  pkg/lib_cgo.go: included -> excluded: file imports "C", but cgo is disabled
+  pkg/lib_nocgo.go: excluded: build constraints not satisfied: // +build !cgo -> included
+`
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	out.Reset()
+	same, err = run([]string{filepath.Join(dir, "old/same/same.build_tags.json"), filepath.Join(dir, "new/same")}, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !same || out.Len() != 0 {
+		t.Errorf("comparing identical reports: got same=%v, output:\n%s", same, out.Bytes())
+	}
+}
@@ -37,17 +37,22 @@ func (h *header) name() string {
 	return strings.TrimRight(string(h.NameRaw[:]), " ")
 }
 
-func (h *header) size() int64 {
-	s, err := strconv.Atoi(strings.TrimRight(string(h.FileSizeRaw[:]), " "))
+func (h *header) size() (int64, error) {
+	s, err := strconv.ParseInt(strings.TrimRight(string(h.FileSizeRaw[:]), " "), 10, 64)
 	if err != nil {
-		panic(err)
+		return 0, fmt.Errorf("bad size for archive member %q: %v", h.name(), err)
 	}
-	return int64(s)
+	return s, nil
 }
 
-func (h *header) next() int64 {
-	size := h.size()
-	return size + size%2
+// next returns the size of the member data, including the padding byte
+// that keeps headers aligned to even offsets.
+func (h *header) next() (int64, error) {
+	size, err := h.size()
+	if err != nil {
+		return 0, err
+	}
+	return size + size%2, nil
 }
 
 func (h *header) deterministic() *header {
@@ -64,7 +69,10 @@ func (h *header) deterministic() *header {
 // - User IDs
 // - Group IDs
 // - File Modes
-// The archive is modified in place.
+// The archive is modified in place. This applies to every member, including
+// the symbol table written by the host archiver ("/" with GNU ar,
+// "__.SYMDEF SORTED" with Apple's), so archives built on different machines
+// are identical.
 func stripArMetadata(archivePath string) error {
 	archive, err := os.OpenFile(archivePath, os.O_RDWR, 0)
 	if err != nil {
@@ -89,13 +97,20 @@ func stripArMetadata(archivePath string) error {
 			return err
 		}
 
+		next, err := hdr.next()
+		if err != nil {
+			return fmt.Errorf("%s: %v", archivePath, err)
+		}
+
 		// Seek back at the beginning of the header and overwrite it.
-		archive.Seek(-entryLength, os.SEEK_CUR)
+		if _, err := archive.Seek(-entryLength, os.SEEK_CUR); err != nil {
+			return err
+		}
 		if err := binary.Write(archive, binary.BigEndian, hdr.deterministic()); err != nil {
 			return err
 		}
 
-		if _, err := archive.Seek(hdr.next(), os.SEEK_CUR); err == io.EOF {
+		if _, err := archive.Seek(next, os.SEEK_CUR); err == io.EOF {
 			return nil
 		} else if err != nil {
 			return err
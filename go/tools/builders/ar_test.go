@@ -0,0 +1,178 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestArchive(t *testing.T, path string, mtime, uid int, members map[string]string, names ...string) {
+	var buf bytes.Buffer
+	buf.WriteString(arHeader)
+	for _, name := range names {
+		data := members[name]
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", name, mtime, uid, uid, 0644, len(data))
+		buf.WriteString(data)
+		if len(data)%2 != 0 {
+			buf.WriteByte('\n')
+		}
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStripArMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestStripArMetadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	members := map[string]string{
+		"/":        "symbols",
+		"go.o":     "go object",
+		"000000.o": "cgo object",
+	}
+	names := []string{"/", "go.o", "000000.o"}
+	a := filepath.Join(dir, "a.a")
+	b := filepath.Join(dir, "b.a")
+	writeTestArchive(t, a, 1590000000, 1000, members, names...)
+	writeTestArchive(t, b, 1600000000, 501, members, names...)
+	for _, path := range []string{a, b} {
+		if err := stripArMetadata(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aData, err := ioutil.ReadFile(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bData, err := ioutil.ReadFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(aData, bData) {
+		t.Errorf("archives differ after stripping metadata:\n%q\n%q", aData, bData)
+	}
+	if !bytes.Contains(aData, []byte("go object")) {
+		t.Errorf("member data was not preserved:\n%q", aData)
+	}
+}
+
+func TestStripArMetadataBadSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestStripArMetadataBadSize")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "bad.a")
+	data := arHeader + fmt.Sprintf("%-16s%-12d%-6d%-6d%-8o%-10s`\n", "go.o", 0, 0, 0, 0644, "x")
+	if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := stripArMetadata(path); err == nil {
+		t.Error("unexpected success stripping archive with bad member size")
+	}
+}
+
+func TestWriteExportDataMembers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteExportDataMembers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	members := map[string]string{
+		"__.PKGDEF": "go object export data",
+		"_go_.o":    "go object code",
+	}
+	archive := filepath.Join(dir, "lib.a")
+	writeTestArchive(t, archive, 1590000000, 1000, members, "__.PKGDEF", "_go_.o")
+	exportData := filepath.Join(dir, "lib.export")
+	if err := writeExportData(archive, exportData, archiveMember{name: nogoSrcsMember, data: []byte("lib.go\n")}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(exportData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The compiler expects export data in the first member.
+	if want := arHeader + "__.PKGDEF"; !bytes.HasPrefix(data, []byte(want)) {
+		t.Errorf("export data file doesn't start with %q: %q", want, data)
+	}
+	for name, want := range map[string]string{
+		"__.PKGDEF":    members["__.PKGDEF"],
+		nogoSrcsMember: "lib.go\n",
+	} {
+		if got, err := readArchiveMember(exportData, name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if string(got) != want {
+			t.Errorf("%s: got %q; want %q", name, got, want)
+		}
+	}
+	if _, err := readArchiveMember(exportData, "_go_.o"); err == nil {
+		t.Error("export data file contains compiled code")
+	}
+}
+
+func TestPackWithoutObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestPackWithoutObjects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	in := filepath.Join(dir, "in.a")
+	writeTestArchive(t, in, 0, 0, map[string]string{"__.PKGDEF": "go object"}, "__.PKGDEF")
+	// A static library with no object files to append.
+	emptyLib := filepath.Join(dir, "empty.a")
+	writeTestArchive(t, emptyLib, 0, 0, map[string]string{"README": "not an object"}, "README")
+
+	for _, tc := range []struct {
+		desc string
+		args []string
+	}{
+		{desc: "nothing", args: nil},
+		{desc: "empty_archive", args: []string{"-arc", emptyLib}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			out := filepath.Join(dir, tc.desc+"_out.a")
+			// There's no SDK, so this fails if go tool pack is run.
+			args := []string{"-sdk", filepath.Join(dir, "no_sdk"), "-in", in, "-out", out}
+			if err := pack(append(args, tc.args...)); err != nil {
+				t.Fatal(err)
+			}
+			want, err := ioutil.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got archive %q; want a copy of %q", got, want)
+			}
+		})
+	}
+}
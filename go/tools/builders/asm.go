@@ -24,25 +24,27 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 // asm builds a single .s file with "go tool asm". It is invoked by the
 // Go rules as an action.
 func asm(args []string) error {
 	// Parse arguments.
-	args, err := readParamsFiles(args)
+	args, err := buildenv.ReadParamsFiles(args)
 	if err != nil {
 		return err
 	}
-	builderArgs, asmFlags := splitArgs(args)
+	builderArgs, asmFlags := buildenv.SplitArgs(args)
 	var outPath string
 	flags := flag.NewFlagSet("GoAsm", flag.ExitOnError)
 	flags.StringVar(&outPath, "o", "", "The output archive file to write")
-	goenv := envFlags(flags)
+	goenv := buildenv.EnvFlags(flags)
 	if err := flags.Parse(builderArgs); err != nil {
 		return err
 	}
-	if err := goenv.checkFlags(); err != nil {
+	if err := goenv.CheckFlags(); err != nil {
 		return err
 	}
 	if flags.NArg() != 1 {
@@ -60,14 +62,14 @@ func asm(args []string) error {
 	}
 
 	// Build source with the assembler.
-	return asmFile(goenv, source, asmFlags, outPath)
+	return asmFile(goenv, source, asmFlags, buildenv.Abs("."), outPath)
 }
 
 // buildSymabisFile generates a file from assembly files that is consumed
 // by the compiler. This is only needed in go1.12+ when there is at least one
 // .s file. If the symabis file is not needed, no file will be generated,
 // and "", nil will be returned.
-func buildSymabisFile(goenv *env, sFiles, hFiles []fileInfo, asmhdr string) (string, error) {
+func buildSymabisFile(goenv *buildenv.Env, sFiles, hFiles []fileInfo, asmhdr string) (string, error) {
 	if len(sFiles) == 0 {
 		return "", nil
 	}
@@ -113,14 +115,14 @@ func buildSymabisFile(goenv *env, sFiles, hFiles []fileInfo, asmhdr string) (str
 	if err != nil {
 		return symabisName, err
 	}
-	asmargs := goenv.goTool("asm")
+	asmargs := goenv.GoTool("asm")
 	asmargs = append(asmargs, "-trimpath", wd)
 	asmargs = append(asmargs, "-I", wd)
 	asmargs = append(asmargs, "-I", filepath.Join(os.Getenv("GOROOT"), "pkg", "include"))
 	asmargs = append(asmargs, "-I", asmhdrDir)
 	seenHdrDirs := map[string]bool{wd: true, asmhdrDir: true}
 	for _, hFile := range hFiles {
-		hdrDir := filepath.Dir(abs(hFile.filename))
+		hdrDir := filepath.Dir(buildenv.Abs(hFile.filename))
 		if !seenHdrDirs[hdrDir] {
 			asmargs = append(asmargs, "-I", hdrDir)
 			seenHdrDirs[hdrDir] = true
@@ -133,16 +135,53 @@ func buildSymabisFile(goenv *env, sFiles, hFiles []fileInfo, asmhdr string) (str
 		asmargs = append(asmargs, sFile.filename)
 	}
 
-	err = goenv.runCommand(asmargs)
+	err = goenv.RunCommand(asmargs)
 	return symabisName, err
 }
 
-func asmFile(goenv *env, srcPath string, asmFlags []string, outPath string) error {
-	args := goenv.goTool("asm")
+func asmFile(goenv *buildenv.Env, srcPath string, asmFlags []string, trimpath, outPath string) error {
+	args := goenv.GoTool("asm")
 	args = append(args, asmFlags...)
-	args = append(args, "-trimpath", ".")
+	args = append(args, "-trimpath", trimpath)
 	args = append(args, "-o", outPath)
 	args = append(args, "--", srcPath)
-	absArgs(args, []string{"-I", "-o", "-trimpath"})
-	return goenv.runCommand(args)
+	buildenv.AbsArgs(args, []string{"-I", "-o"})
+	return goenv.RunCommand(args)
+}
+
+// isGoAssembly reports whether the assembly file at path is written for the
+// Go assembler. Packages that use cgo may also contain assembly for the C
+// toolchain's assembler. Like the go command, this looks for TEXT, DATA, or
+// GLOBL directives at the start of a line, which only Go assembly has.
+func isGoAssembly(path string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		for _, directive := range []string{"TEXT", "DATA", "GLOBL"} {
+			if strings.HasPrefix(line, directive) && len(line) > len(directive) && (line[len(directive)] == ' ' || line[len(directive)] == '\t') {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// splitGoAssembly separates Go assembly files from assembly files that must
+// be compiled with the C toolchain.
+func splitGoAssembly(sSrcs []fileInfo) (goSrcs []fileInfo, cSrcs []string, err error) {
+	for _, src := range sSrcs {
+		isGo, err := isGoAssembly(src.filename)
+		if err != nil {
+			return nil, nil, err
+		}
+		if isGo {
+			goSrcs = append(goSrcs, src)
+		} else {
+			cSrcs = append(cSrcs, src.filename)
+		}
+	}
+	return goSrcs, cSrcs, nil
 }
@@ -0,0 +1,66 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitGoAssembly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSplitGoAssembly")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var srcs []fileInfo
+	for _, f := range []struct{ name, content string }{
+		{"text_amd64.s", "#include \"textflag.h\"\n\nTEXT ·Add(SB),NOSPLIT,$0-24\n\tRET\n"},
+		{"data.s", "DATA ·x+0(SB)/8, $1\nGLOBL ·x(SB), RODATA, $8\n"},
+		{"indented.s", "  TEXT\t·f(SB),$0\n"},
+		{"gnu.S", "\t.text\n\t.globl add\nadd:\n\tret\n"},
+		{"empty.s", ""},
+		{"text_label.S", "TEXTURE:\n\tret\n"},
+	} {
+		path := filepath.Join(dir, f.name)
+		if err := ioutil.WriteFile(path, []byte(f.content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		srcs = append(srcs, fileInfo{filename: path, ext: sExt})
+	}
+
+	goSrcs, cSrcs, err := splitGoAssembly(srcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotGo []string
+	for _, src := range goSrcs {
+		gotGo = append(gotGo, filepath.Base(src.filename))
+	}
+	var gotC []string
+	for _, src := range cSrcs {
+		gotC = append(gotC, filepath.Base(src))
+	}
+	if want := []string{"text_amd64.s", "data.s", "indented.s"}; !reflect.DeepEqual(gotGo, want) {
+		t.Errorf("Go assembly: got %v; want %v", gotGo, want)
+	}
+	if want := []string{"gnu.S", "empty.s", "text_label.S"}; !reflect.DeepEqual(gotC, want) {
+		t.Errorf("C assembly: got %v; want %v", gotC, want)
+	}
+}
@@ -0,0 +1,426 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package buildenv handles the environment, arguments, and paths of the Go
+// builders. Builders are invoked by Bazel with a command line built from
+// go.builder_args, with paths relative to the execution root. This package
+// parses the common flags, expands params files, makes paths absolute, and
+// locates and runs tools in the Go SDK.
+//
+// It's used by the builder in this repository and may be used by custom
+// builders invoked the same way. See ../README.rst. The builder is compiled
+// by go_tool_binary before any other Go code, so this package may only
+// depend on the standard library.
+package buildenv
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var (
+	// CgoEnvVars is the list of all cgo environment variable
+	CgoEnvVars = []string{"CGO_CFLAGS", "CGO_CXXFLAGS", "CGO_CPPFLAGS", "CGO_LDFLAGS"}
+	// CgoAbsEnvFlags are all the flags that need absolute path in CgoEnvVars
+	CgoAbsEnvFlags = []string{"-I", "-L", "-isysroot", "-isystem", "-iquote", "-include", "-gcc-toolchain", "--sysroot"}
+)
+
+// Env holds a small amount of Go environment and toolchain information
+// which is common to multiple builders. Most Bazel-agnostic build information
+// is collected in go/build.Default though.
+//
+// See ../README.rst for more information about handling arguments and
+// environment variables.
+type Env struct {
+	// SDK is the path to the Go SDK, which contains tools for the host
+	// platform. This may be different than GOROOT.
+	SDK string
+
+	// InstallSuffix is the name of the directory below GOROOT/pkg that contains
+	// the .a files for the standard library we should build against.
+	// For example, linux_amd64_race.
+	InstallSuffix string
+
+	// Verbose indicates whether subprocess command lines should be printed.
+	Verbose bool
+
+	// workDirPath is a temporary work directory. It is created lazily.
+	workDirPath string
+
+	ShouldPreserveWorkDir bool
+
+	// StartRetries is the number of times a subprocess is started again
+	// when it fails to start with a transient error.
+	StartRetries int
+
+	// Output, if set, receives the standard output and standard error of
+	// subprocesses started with RunCommand, and the standard error of those
+	// started with RunCommandToFile. Compilers may print diagnostics to either.
+	Output io.Writer
+}
+
+// EnvFlags registers flags common to multiple builders and returns an Env
+// configured with those flags.
+func EnvFlags(flags *flag.FlagSet) *Env {
+	env := &Env{}
+	flags.StringVar(&env.SDK, "sdk", "", "Path to the Go SDK.")
+	flags.Var(&tagFlag{}, "tags", "List of build tags considered true.")
+	flags.StringVar(&env.InstallSuffix, "installsuffix", "", "Standard library under GOROOT/pkg")
+	flags.BoolVar(&env.Verbose, "v", false, "Whether subprocess command lines should be printed")
+	flags.BoolVar(&env.ShouldPreserveWorkDir, "work", false, "if true, the temporary work directory will be preserved")
+	flags.IntVar(&env.StartRetries, "start_retries", 0, "Number of times to retry starting a subprocess that fails to start with a transient error.")
+	return env
+}
+
+// CheckFlags checks whether env flags were set to valid values. CheckFlags
+// should be called after parsing flags.
+func (e *Env) CheckFlags() error {
+	if e.SDK == "" {
+		return errors.New("-sdk was not set")
+	}
+	return nil
+}
+
+// WorkDir returns a path to a temporary work directory. The same directory
+// is returned on multiple calls. The caller is responsible for cleaning
+// up the work directory by calling cleanup.
+func (e *Env) WorkDir() (path string, cleanup func(), err error) {
+	if e.workDirPath != "" {
+		return e.workDirPath, func() {}, nil
+	}
+	// Keep the stem "rules_go_work" in sync with reproducible_binary_test.go.
+	e.workDirPath, err = ioutil.TempDir("", "rules_go_work-")
+	if err != nil {
+		return "", func() {}, err
+	}
+	if e.Verbose {
+		log.Printf("WORK=%s\n", e.workDirPath)
+	}
+	if e.ShouldPreserveWorkDir {
+		cleanup = func() {}
+	} else {
+		cleanup = func() { os.RemoveAll(e.workDirPath) }
+	}
+	return e.workDirPath, cleanup, nil
+}
+
+// GoTool returns a slice containing the path to an executable at
+// $GOROOT/pkg/$GOOS_$GOARCH/$tool and additional arguments.
+func (e *Env) GoTool(tool string, args ...string) []string {
+	platform := fmt.Sprintf("%s_%s", runtime.GOOS, runtime.GOARCH)
+	toolPath := filepath.Join(e.SDK, "pkg", "tool", platform, tool)
+	if runtime.GOOS == "windows" {
+		toolPath += ".exe"
+	}
+	return append([]string{toolPath}, args...)
+}
+
+// GoCmd returns a slice containing the path to the go executable
+// and additional arguments.
+func (e *Env) GoCmd(cmd string, args ...string) []string {
+	exe := filepath.Join(e.SDK, "bin", "go")
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	return append([]string{exe, cmd}, args...)
+}
+
+// RunCommand executes a subprocess that inherits stdout, stderr, and the
+// environment from this process.
+func (e *Env) RunCommand(args []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if e.Output != nil {
+		// exec.Cmd serializes writes when Stdout and Stderr are the same.
+		cmd.Stdout = e.Output
+		cmd.Stderr = e.Output
+	}
+	return runAndLogCommand(cmd, e.Verbose, e.StartRetries)
+}
+
+// RunCommandToFile executes a subprocess and writes the output to the given
+// writer.
+func (e *Env) RunCommandToFile(w io.Writer, args []string) error {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	if e.Output != nil {
+		cmd.Stderr = e.Output
+	}
+	return runAndLogCommand(cmd, e.Verbose, e.StartRetries)
+}
+
+// AbsEnv applies AbsArgs to the space-separated arguments in each of the
+// environment variables named by envNameList.
+func AbsEnv(envNameList []string, argList []string) error {
+	for _, envName := range envNameList {
+		splitedEnv := strings.Fields(os.Getenv(envName))
+		AbsArgs(splitedEnv, argList)
+		if err := os.Setenv(envName, strings.Join(splitedEnv, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AbsCCEnv rewrites the C toolchain environment so that it stays valid when
+// a subprocess runs in a different directory than the builder. CC and each
+// PATH entry are made absolute, as are path arguments in CgoEnvVars. Builders
+// that invoke the go command or cgo outside the execroot should call this
+// before starting the subprocess.
+func AbsCCEnv() error {
+	if cc := os.Getenv("CC"); cc != "" {
+		if err := os.Setenv("CC", Abs(cc)); err != nil {
+			return err
+		}
+	}
+	var absPaths []string
+	for _, path := range filepath.SplitList(os.Getenv("PATH")) {
+		absPaths = append(absPaths, Abs(path))
+	}
+	if err := os.Setenv("PATH", strings.Join(absPaths, string(os.PathListSeparator))); err != nil {
+		return err
+	}
+	return AbsEnv(CgoEnvVars, CgoAbsEnvFlags)
+}
+
+func runAndLogCommand(cmd *exec.Cmd, verbose bool, startRetries int) error {
+	if verbose {
+		formatCommand(os.Stderr, cmd)
+	}
+	if err := RunWithStartRetries(cmd, startRetries); err != nil {
+		return fmt.Errorf("error running subcommand: %v", err)
+	}
+	return nil
+}
+
+// startRetryDelay is how long RunWithStartRetries waits before the first
+// retry. The delay doubles with each retry after that.
+var startRetryDelay = 100 * time.Millisecond
+
+// RunWithStartRetries runs cmd. If it can't be started because of an error
+// that's likely to go away on its own, it's started again, up to retries
+// times. Only start failures are retried: the subprocess never ran, so it
+// can't have written any output.
+func RunWithStartRetries(cmd *exec.Cmd, retries int) error {
+	delay := startRetryDelay
+	for attempt := 0; ; attempt++ {
+		err := cmd.Start()
+		if err == nil {
+			return cmd.Wait()
+		}
+		if attempt >= retries || !isTransientStartError(err) {
+			return err
+		}
+		log.Printf("error starting %s, retrying in %v (attempt %d of %d): %v", cmd.Path, delay, attempt+1, retries, err)
+		time.Sleep(delay)
+		delay *= 2
+
+		// A Cmd can't be started twice, even if the first attempt failed.
+		cmd = &exec.Cmd{
+			Path:   cmd.Path,
+			Args:   cmd.Args,
+			Env:    cmd.Env,
+			Dir:    cmd.Dir,
+			Stdin:  cmd.Stdin,
+			Stdout: cmd.Stdout,
+			Stderr: cmd.Stderr,
+		}
+	}
+}
+
+// isTransientStartError reports whether err, returned when starting a
+// subprocess, is caused by a condition that usually clears up quickly.
+// ETXTBSY is reported when the executable was just written and another
+// process forked while it was still open for writing. EAGAIN is reported by
+// fork when the machine is briefly out of processes or memory. On Windows,
+// virus scanners and indexers may hold executables open for a moment after
+// they're written.
+func isTransientStartError(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		const (
+			errorSharingViolation = 32
+			errorLockViolation    = 33
+		)
+		return errno == errorSharingViolation || errno == errorLockViolation
+	}
+	return errno == syscall.ETXTBSY || errno == syscall.EAGAIN
+}
+
+// ReadParamsFiles looks for arguments in args of the form
+// "-param=filename". When it finds these arguments it reads the file "filename"
+// and replaces the argument with its content (each argument must be on a
+// separate line; blank lines are ignored).
+func ReadParamsFiles(args []string) ([]string, error) {
+	var paramsIndices []int
+	for i, arg := range args {
+		if strings.HasPrefix(arg, "-param=") {
+			paramsIndices = append(paramsIndices, i)
+		}
+	}
+	if len(paramsIndices) == 0 {
+		return args, nil
+	}
+	var expandedArgs []string
+	last := 0
+	for _, pi := range paramsIndices {
+		expandedArgs = append(expandedArgs, args[last:pi]...)
+		last = pi + 1
+
+		fileName := args[pi][len("-param="):]
+		content, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return nil, err
+		}
+		fileArgs := strings.Split(string(content), "\n")
+		if len(fileArgs) >= 0 && fileArgs[len(fileArgs)-1] == "" {
+			// Ignore final empty line.
+			fileArgs = fileArgs[:len(fileArgs)-1]
+		}
+		expandedArgs = append(expandedArgs, fileArgs...)
+	}
+	expandedArgs = append(expandedArgs, args[last:]...)
+	return expandedArgs, nil
+}
+
+// SplitArgs splits a list of command line arguments into two parts: arguments
+// that should be interpreted by the builder (before "--"), and arguments
+// that should be passed through to the underlying tool (after "--").
+func SplitArgs(args []string) (builderArgs []string, toolArgs []string) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], args[i+1:]
+		}
+	}
+	return args, nil
+}
+
+// Abs returns the absolute representation of path. Some tools/APIs require
+// absolute paths to work correctly. Most notably, golang on Windows cannot
+// handle relative paths to files whose absolute path is > ~250 chars, while
+// it can handle absolute paths. See http://goo.gl/eqeWjm.
+//
+// Note that strings that begin with "__BAZEL_" are not absolutized. These are
+// used on macOS for paths that the compiler wrapper (wrapped_clang) is
+// supposed to know about.
+func Abs(path string) string {
+	if strings.HasPrefix(path, "__BAZEL_") {
+		return path
+	}
+
+	if abs, err := filepath.Abs(path); err != nil {
+		return path
+	} else {
+		return abs
+	}
+}
+
+// AbsArgs applies Abs to strings that appear in args. Only paths that are
+// part of options named by flags are modified.
+func AbsArgs(args []string, flags []string) {
+	absNext := false
+	for i := range args {
+		if absNext {
+			args[i] = Abs(args[i])
+			absNext = false
+			continue
+		}
+		for _, f := range flags {
+			if !strings.HasPrefix(args[i], f) {
+				continue
+			}
+			possibleValue := args[i][len(f):]
+			if len(possibleValue) == 0 {
+				absNext = true
+				break
+			}
+			separator := ""
+			if possibleValue[0] == '=' {
+				possibleValue = possibleValue[1:]
+				separator = "="
+			}
+			args[i] = fmt.Sprintf("%s%s%s", f, separator, Abs(possibleValue))
+			break
+		}
+	}
+}
+
+// formatCommand writes cmd to w in a format where it can be pasted into a
+// shell. Spaces in environment variables and arguments are escaped as needed.
+func formatCommand(w io.Writer, cmd *exec.Cmd) {
+	quoteIfNeeded := func(s string) string {
+		if strings.IndexByte(s, ' ') < 0 {
+			return s
+		}
+		return strconv.Quote(s)
+	}
+	quoteEnvIfNeeded := func(s string) string {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			return s
+		}
+		key, value := s[:eq], s[eq+1:]
+		if strings.IndexByte(value, ' ') < 0 {
+			return s
+		}
+		return fmt.Sprintf("%s=%s", key, strconv.Quote(value))
+	}
+
+	environ := cmd.Env
+	if environ == nil {
+		environ = os.Environ()
+	}
+	for _, e := range environ {
+		fmt.Fprintf(w, "%s \\\n", quoteEnvIfNeeded(e))
+	}
+
+	sep := ""
+	for _, arg := range cmd.Args {
+		fmt.Fprintf(w, "%s%s", sep, quoteIfNeeded(arg))
+		sep = " "
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// tagFlag adds tags to the build.Default context. Tags are expected to be
+// formatted as a comma-separated list.
+type tagFlag struct{}
+
+func (f *tagFlag) String() string {
+	return strings.Join(build.Default.BuildTags, ",")
+}
+
+func (f *tagFlag) Set(opt string) error {
+	tags := strings.Split(opt, ",")
+	build.Default.BuildTags = append(build.Default.BuildTags, tags...)
+	return nil
+}
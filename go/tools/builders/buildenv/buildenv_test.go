@@ -0,0 +1,180 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buildenv
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestReadParamsFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestReadParamsFiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	paramsPath := filepath.Join(dir, "params")
+	if err := ioutil.WriteFile(paramsPath, []byte("-b\nfoo bar\n\n-c\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadParamsFiles([]string{"-a", "-param=" + paramsPath, "-d"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"-a", "-b", "foo bar", "", "-c", "-d"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, tc := range []struct {
+		args, builderArgs, toolArgs []string
+	}{
+		{
+			args:        []string{"-a", "-b"},
+			builderArgs: []string{"-a", "-b"},
+		}, {
+			args:        []string{"-a", "--", "-b", "--", "-c"},
+			builderArgs: []string{"-a"},
+			toolArgs:    []string{"-b", "--", "-c"},
+		},
+	} {
+		builderArgs, toolArgs := SplitArgs(tc.args)
+		if !reflect.DeepEqual(builderArgs, tc.builderArgs) || !reflect.DeepEqual(toolArgs, tc.toolArgs) {
+			t.Errorf("SplitArgs(%q): got %q, %q; want %q, %q", tc.args, builderArgs, toolArgs, tc.builderArgs, tc.toolArgs)
+		}
+	}
+}
+
+func TestAbsArgs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-Ifoo", "-I", "bar", "--sysroot=baz", "-DX=y", "-I__BAZEL_XCODE_SDKROOT__/include"}
+	AbsArgs(args, CgoAbsEnvFlags)
+	want := []string{
+		"-I" + filepath.Join(wd, "foo"),
+		"-I",
+		filepath.Join(wd, "bar"),
+		"--sysroot=" + filepath.Join(wd, "baz"),
+		"-DX=y",
+		"-I__BAZEL_XCODE_SDKROOT__/include",
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("got %q; want %q", args, want)
+	}
+}
+
+func TestAbsCCEnv(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"CC", "PATH", "CGO_CFLAGS"} {
+		defer os.Setenv(name, os.Getenv(name))
+	}
+	os.Setenv("CC", "external/toolchain/bin/cc")
+	os.Setenv("PATH", strings.Join([]string{"bin", "/usr/bin"}, string(os.PathListSeparator)))
+	os.Setenv("CGO_CFLAGS", "-isystem inc -O2")
+
+	if err := AbsCCEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := os.Getenv("CC"), filepath.Join(wd, "external/toolchain/bin/cc"); got != want {
+		t.Errorf("CC: got %q; want %q", got, want)
+	}
+	wantPath := strings.Join([]string{filepath.Join(wd, "bin"), Abs("/usr/bin")}, string(os.PathListSeparator))
+	if got := os.Getenv("PATH"); got != wantPath {
+		t.Errorf("PATH: got %q; want %q", got, wantPath)
+	}
+	if got, want := os.Getenv("CGO_CFLAGS"), "-isystem "+filepath.Join(wd, "inc")+" -O2"; got != want {
+		t.Errorf("CGO_CFLAGS: got %q; want %q", got, want)
+	}
+}
+
+func TestIsTransientStartError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("errno values differ on Windows")
+	}
+	for _, tc := range []struct {
+		desc string
+		err  error
+		want bool
+	}{
+		{"etxtbsy", &os.PathError{Op: "fork/exec", Path: "tool", Err: syscall.ETXTBSY}, true},
+		{"eagain", &os.PathError{Op: "fork/exec", Path: "tool", Err: syscall.EAGAIN}, true},
+		{"enoent", &os.PathError{Op: "fork/exec", Path: "tool", Err: syscall.ENOENT}, false},
+		{"other", errors.New("exit status 1"), false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			if got := isTransientStartError(tc.err); got != tc.want {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRunWithStartRetries(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("ETXTBSY is only reported reliably on Linux")
+	}
+	dir, err := ioutil.TempDir("", "TestRunWithStartRetries")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(d time.Duration) { startRetryDelay = d }(startRetryDelay)
+	startRetryDelay = 50 * time.Millisecond
+
+	// Keep the script open for writing, so starting it fails with ETXTBSY
+	// until it's closed.
+	path := filepath.Join(dir, "tool.sh")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0777)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("#!/bin/sh\necho ok\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(path)
+	if err := RunWithStartRetries(cmd, 0); !isTransientStartError(err) {
+		t.Fatalf("got error %v; want a transient start error", err)
+	}
+
+	time.AfterFunc(20*time.Millisecond, func() { f.Close() })
+	var out bytes.Buffer
+	cmd = exec.Command(path)
+	cmd.Stdout = &out
+	if err := RunWithStartRetries(cmd, 5); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); got != "ok\n" {
+		t.Errorf("got output %q; want %q", got, "ok\n")
+	}
+}
@@ -22,13 +22,15 @@ package main
 import (
 	"log"
 	"os"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("builder: ")
 
-	args, err := readParamsFiles(os.Args[1:])
+	args, err := buildenv.ReadParamsFiles(os.Args[1:])
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -41,6 +43,14 @@ func main() {
 	switch verb {
 	case "asm":
 		action = asm
+	case "buildtags":
+		action = buildTags
+	case "cc":
+		action = compileC
+	case "cgogen":
+		action = cgoGen
+	case "cgolink":
+		action = cgoLink
 	case "compile":
 		action = compile
 	case "compilepkg":
@@ -49,16 +59,28 @@ func main() {
 		action = cover
 	case "filterbuildid":
 		action = filterBuildID
+	case "gendata":
+		action = genData
 	case "gentestmain":
 		action = genTestMain
 	case "link":
 		action = link
 	case "gennogomain":
 		action = genNogoMain
+	case "nogo":
+		action = nogoPkg
 	case "pack":
 		action = pack
+	case "stamp":
+		action = stamp
 	case "stdlib":
 		action = stdlib
+	case "symabis":
+		action = genSymabis
+	case "symbolmap":
+		action = writeSymbolMap
+	case "xcframework":
+		action = xcframework
 	default:
 		log.Fatalf("unknown action: %s", verb)
 	}
@@ -0,0 +1,111 @@
+// Copyright 2017 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// buildConfigDigestKey is the key of the build setting that records the
+// digest in a binary's build information.
+const buildConfigDigestKey = "bazel.config"
+
+// runtime.modinfo holds a binary's build information between two 16-byte
+// markers. The go command uses binary markers, but readers (including
+// "go version -m" and runtime/debug.ReadBuildInfo) only check the length and
+// the newline before the end marker, so printable markers are used here. The
+// value is passed to the linker on the command line, which can't carry the
+// NUL byte in the go command's end marker.
+const (
+	modinfoStart = "bazel/modinfo>>>"
+	modinfoEnd   = "<<<bazel/modinfo"
+)
+
+// buildConfigDigest returns a short digest of a build configuration. config
+// lists settings as key=value pairs in a fixed order. The version of the Go
+// SDK in goroot is included, if it's recorded in the SDK's VERSION file.
+func buildConfigDigest(goroot string, config []string) string {
+	h := sha256.New()
+	if version := sdkVersion(goroot); version != "" {
+		h.Write([]byte("go=" + version + "\n"))
+	}
+	for _, c := range config {
+		h.Write([]byte(c + "\n"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// sdkVersion returns the first line of the SDK's VERSION file, or "" if the
+// file can't be read. SDKs built from source may not have one.
+func sdkVersion(goroot string) string {
+	f, err := os.Open(filepath.Join(goroot, "VERSION"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	if !s.Scan() {
+		return ""
+	}
+	return strings.TrimSpace(s.Text())
+}
+
+// buildInfo returns the value of runtime.modinfo for a binary with the main
+// package path and the build configuration digest.
+func buildInfo(path, digest string) string {
+	var b strings.Builder
+	b.WriteString(modinfoStart)
+	if path != "" {
+		b.WriteString("path\t" + path + "\n")
+	}
+	b.WriteString("build\t" + buildConfigDigestKey + "=" + digest + "\n")
+	b.WriteString(modinfoEnd)
+	return b.String()
+}
+
+// isStableStatusKey reports whether a workspace status key comes from Bazel's
+// stable status file. This matches _is_stable_key in link.bzl.
+func isStableStatusKey(key string) bool {
+	switch key {
+	case "BUILD_EMBED_LABEL", "BUILD_HOST", "BUILD_USER":
+		return true
+	}
+	return strings.HasPrefix(key, "STABLE_")
+}
+
+// stableStatus returns the stable workspace status values in stampMap, one
+// key and value per line, sorted by key. This is the format read by the
+// buildinfo package. Volatile values are left out, so the link doesn't
+// depend on them.
+func stableStatus(stampMap map[string]string) string {
+	var keys []string
+	for k := range stampMap {
+		if isStableStatusKey(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k + " " + stampMap[k] + "\n")
+	}
+	return b.String()
+}
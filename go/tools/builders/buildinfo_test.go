@@ -0,0 +1,85 @@
+// Copyright 2017 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildConfigDigest(t *testing.T) {
+	goroot, err := ioutil.TempDir("", "TestBuildConfigDigest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(goroot)
+
+	config := []string{"mode=linux_amd64", "tags=a,b"}
+	d1 := buildConfigDigest(goroot, config)
+	if len(d1) != 12 {
+		t.Errorf("got digest %q; want 12 hex digits", d1)
+	}
+	if d := buildConfigDigest(goroot, config); d != d1 {
+		t.Errorf("got digest %q for the same configuration; want %q", d, d1)
+	}
+	if d := buildConfigDigest(goroot, []string{"mode=linux_amd64", "tags=a"}); d == d1 {
+		t.Errorf("got digest %q for different tags; want a different digest", d)
+	}
+	if err := ioutil.WriteFile(filepath.Join(goroot, "VERSION"), []byte("go1.14.2\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if d := buildConfigDigest(goroot, config); d == d1 {
+		t.Errorf("got digest %q with an SDK version; want a different digest", d)
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	info := buildInfo("example.com/cmd", "0123456789ab")
+
+	// These are the checks made by "go version -m" and
+	// runtime/debug.ReadBuildInfo before the markers are removed.
+	if len(info) < 33 || info[len(info)-17] != '\n' {
+		t.Fatalf("build info not recognized: %q", info)
+	}
+	if strings.ContainsRune(info, 0) {
+		t.Errorf("build info contains a NUL byte: %q", info)
+	}
+	got := info[16 : len(info)-16]
+	want := "path\texample.com/cmd\nbuild\tbazel.config=0123456789ab\n"
+	if got != want {
+		t.Errorf("got build info %q; want %q", got, want)
+	}
+}
+
+func TestStableStatus(t *testing.T) {
+	stampMap := map[string]string{
+		"STABLE_GIT_COMMIT": "abc123",
+		"BUILD_EMBED_LABEL": "",
+		"BUILD_USER":        "builder",
+		"BUILD_TIMESTAMP":   "1600000000",
+		"GIT_DIRTY":         "1",
+	}
+	got := stableStatus(stampMap)
+	want := "BUILD_EMBED_LABEL \nBUILD_USER builder\nSTABLE_GIT_COMMIT abc123\n"
+	if got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if got := stableStatus(nil); got != "" {
+		t.Errorf("got %q for no status; want empty", got)
+	}
+}
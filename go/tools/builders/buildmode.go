@@ -0,0 +1,48 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "fmt"
+
+// pieSupportedPlatforms lists the platforms where executables may be linked
+// with -buildmode=pie, from buildModeInit in cmd/go/internal/work/init.go.
+// Keep in sync with _LINK_PIE_PLATFORMS in go/private/mode.bzl.
+var pieSupportedPlatforms = map[string]bool{
+	"linux/amd64":   true,
+	"linux/arm":     true,
+	"linux/arm64":   true,
+	"linux/386":     true,
+	"linux/s390x":   true,
+	"linux/ppc64le": true,
+	"android/amd64": true,
+	"android/arm":   true,
+	"android/arm64": true,
+	"android/386":   true,
+	"freebsd/amd64": true,
+}
+
+// checkBuildmode reports an error if buildmode can't be used to link for
+// goos and goarch. Without this check, the linker would silently build an
+// ordinary executable when the rules can't pass the flags a mode needs.
+func checkBuildmode(buildmode, goos, goarch string) error {
+	platform := goos + "/" + goarch
+	switch buildmode {
+	case "pie":
+		if !pieSupportedPlatforms[platform] {
+			return fmt.Errorf("-buildmode=pie not supported on %s; set --@io_bazel_rules_go//go/config:pie=auto to use it only where it's supported", platform)
+		}
+	}
+	return nil
+}
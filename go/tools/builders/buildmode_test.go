@@ -0,0 +1,40 @@
+// Copyright 2018 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckBuildmode(t *testing.T) {
+	for _, test := range []struct {
+		buildmode, goos, goarch, wantErr string
+	}{
+		{buildmode: "", goos: "windows", goarch: "amd64"},
+		{buildmode: "pie", goos: "linux", goarch: "amd64"},
+		{buildmode: "pie", goos: "android", goarch: "arm64"},
+		{buildmode: "pie", goos: "windows", goarch: "amd64", wantErr: "not supported on windows/amd64"},
+		{buildmode: "pie", goos: "linux", goarch: "mips", wantErr: "not supported on linux/mips"},
+		{buildmode: "c-shared", goos: "linux", goarch: "mips"},
+	} {
+		err := checkBuildmode(test.buildmode, test.goos, test.goarch)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("checkBuildmode(%q, %q, %q): unexpected error: %v", test.buildmode, test.goos, test.goarch, err)
+		} else if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("checkBuildmode(%q, %q, %q): got error %v; want error containing %q", test.buildmode, test.goos, test.goarch, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// buildTagsReport describes the build tags a package was configured with
+// and which of its source files were selected for compilation. It's written
+// by the buildtags verb and read by @io_bazel_rules_go//go/tools/build_tags:diff.
+type buildTagsReport struct {
+	Label      string `json:"label"`
+	ImportPath string `json:"importpath"`
+	GOOS       string `json:"goos"`
+	GOARCH     string `json:"goarch"`
+	CgoEnabled bool   `json:"cgo_enabled"`
+	Compiler   string `json:"compiler"`
+
+	// Tags is the set of tags considered true when matching files, other
+	// than release tags. It includes GOOS, GOARCH, the compiler, and "cgo"
+	// when cgo is enabled.
+	Tags []string `json:"tags"`
+
+	// ReleaseTags are the Go release tags, like "go1.14".
+	ReleaseTags []string `json:"release_tags"`
+
+	Files []fileSelection `json:"files"`
+}
+
+// fileSelection records whether a source file was selected for compilation
+// and, if not, why.
+type fileSelection struct {
+	Path     string `json:"path"`
+	Included bool   `json:"included"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// buildTags writes a report of the build tags and file selection decisions
+// for a package, using the same logic as compilepkg.
+func buildTags(args []string) error {
+	args, err := buildenv.ReadParamsFiles(args)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("GoBuildTags", flag.ExitOnError)
+	goenv := buildenv.EnvFlags(fs)
+	var srcs multiFlag
+	var label, importPath, testFilter, outPath string
+	fs.Var(&srcs, "src", "A source file to check")
+	fs.StringVar(&label, "label", "", "The label of the target that compiles the package")
+	fs.StringVar(&importPath, "importpath", "", "The import path of the package")
+	fs.StringVar(&testFilter, "testfilter", "off", "Controls test package filtering")
+	fs.StringVar(&outPath, "o", "", "The JSON file to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := goenv.CheckFlags(); err != nil {
+		return err
+	}
+	if outPath == "" {
+		return errors.New("-o must be set")
+	}
+
+	bctx := build.Default
+	report := buildTagsReport{
+		Label:       label,
+		ImportPath:  importPath,
+		GOOS:        bctx.GOOS,
+		GOARCH:      bctx.GOARCH,
+		CgoEnabled:  bctx.CgoEnabled,
+		Compiler:    bctx.Compiler,
+		Tags:        effectiveTags(bctx),
+		ReleaseTags: bctx.ReleaseTags,
+		Files:       make([]fileSelection, 0, len(srcs)),
+	}
+	for _, src := range srcs {
+		sel, err := selectFile(bctx, src, testFilter)
+		if err != nil {
+			return err
+		}
+		report.Files = append(report.Files, sel)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(buildenv.Abs(outPath), append(data, '\n'), 0666)
+}
+
+// effectiveTags returns the sorted set of non-release tags that are true in
+// bctx.
+func effectiveTags(bctx build.Context) []string {
+	set := map[string]bool{bctx.GOOS: true, bctx.GOARCH: true, bctx.Compiler: true}
+	if bctx.CgoEnabled {
+		set["cgo"] = true
+	}
+	for _, t := range bctx.BuildTags {
+		if t != "" {
+			set[t] = true
+		}
+	}
+	tags := make([]string, 0, len(set))
+	for t := range set {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// selectFile reports whether compilepkg would compile src and explains why
+// it would not.
+func selectFile(bctx build.Context, src, testFilter string) (fileSelection, error) {
+	sel := fileSelection{Path: src}
+	fi, err := readFileInfo(bctx, buildenv.Abs(src), true)
+	if err != nil {
+		return sel, err
+	}
+	if !fi.matched {
+		sel.Reason, err = explainMismatch(bctx, src, fi)
+		return sel, err
+	}
+	if fi.ext == goExt {
+		isTest := strings.HasSuffix(fi.pkg, "_test")
+		if testFilter == "only" && !isTest {
+			sel.Reason = fmt.Sprintf("package %s is excluded from the external test package", fi.pkg)
+			return sel, nil
+		}
+		if testFilter == "exclude" && isTest {
+			sel.Reason = fmt.Sprintf("package %s is compiled separately as the external test package", fi.pkg)
+			return sel, nil
+		}
+	}
+	sel.Included = true
+	return sel, nil
+}
+
+// explainMismatch returns the reason a file was excluded by readFileInfo.
+func explainMismatch(bctx build.Context, src string, fi fileInfo) (string, error) {
+	// Check the file name on its own by hiding the file's content.
+	nameCtx := bctx
+	nameCtx.OpenFile = func(string) (io.ReadCloser, error) {
+		content := ""
+		if fi.ext == goExt {
+			content = "package p\n"
+		}
+		return ioutil.NopCloser(strings.NewReader(content)), nil
+	}
+	dir, base := filepath.Split(buildenv.Abs(src))
+	if match, err := nameCtx.MatchFile(dir, base); err != nil {
+		return "", err
+	} else if !match {
+		return fmt.Sprintf("file name does not match GOOS=%s GOARCH=%s", bctx.GOOS, bctx.GOARCH), nil
+	}
+
+	match, err := bctx.MatchFile(dir, base)
+	if err != nil {
+		return "", err
+	}
+	if match && fi.isCgo && !bctx.CgoEnabled {
+		return `file imports "C", but cgo is disabled`, nil
+	}
+	constraints, err := readConstraints(buildenv.Abs(src))
+	if err != nil {
+		return "", err
+	}
+	if len(constraints) == 0 {
+		return "build constraints not satisfied", nil
+	}
+	return "build constraints not satisfied: " + strings.Join(constraints, "; "), nil
+}
+
+// readConstraints returns the build constraint lines in the leading run of
+// line comments and blank lines in a file.
+func readConstraints(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var constraints []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "//") {
+			break
+		}
+		if strings.HasPrefix(line, "//go:build ") || strings.HasPrefix(line, "// +build ") {
+			constraints = append(constraints, line)
+		}
+	}
+	return constraints, scanner.Err()
+}
@@ -0,0 +1,115 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSelectFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "buildtags_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"lib.go":         "package p\n",
+		"lib_windows.go": "package p\n",
+		"foo.go":         "// Copyright\n\n// +build foo,!bar\n\npackage p\n",
+		"cgo.go":         "package p\n\nimport \"C\"\n",
+		"lib_test.go":    "package p\n",
+		"ext_test.go":    "package p_test\n",
+		"lib.s":          "// +build ignore\n\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bctx := build.Default
+	bctx.GOOS = "linux"
+	bctx.GOARCH = "amd64"
+	bctx.CgoEnabled = false
+	bctx.BuildTags = []string{"bar"}
+
+	for _, test := range []struct {
+		name, testFilter string
+		want             fileSelection
+	}{
+		{
+			name: "lib.go",
+			want: fileSelection{Included: true},
+		}, {
+			name: "lib_windows.go",
+			want: fileSelection{Reason: "file name does not match GOOS=linux GOARCH=amd64"},
+		}, {
+			name: "foo.go",
+			want: fileSelection{Reason: "build constraints not satisfied: // +build foo,!bar"},
+		}, {
+			name: "cgo.go",
+			want: fileSelection{Reason: `file imports "C", but cgo is disabled`},
+		}, {
+			name:       "lib_test.go",
+			testFilter: "only",
+			want:       fileSelection{Reason: "package p is excluded from the external test package"},
+		}, {
+			name:       "ext_test.go",
+			testFilter: "exclude",
+			want:       fileSelection{Reason: "package p_test is compiled separately as the external test package"},
+		}, {
+			name:       "ext_test.go",
+			testFilter: "off",
+			want:       fileSelection{Included: true},
+		}, {
+			name: "lib.s",
+			want: fileSelection{Reason: "build constraints not satisfied: // +build ignore"},
+		},
+	} {
+		t.Run(test.name+"_"+test.testFilter, func(t *testing.T) {
+			path := filepath.Join(dir, test.name)
+			testFilter := test.testFilter
+			if testFilter == "" {
+				testFilter = "off"
+			}
+			got, err := selectFile(bctx, path, testFilter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.want.Path = path
+			if got != test.want {
+				t.Errorf("got %+v; want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEffectiveTags(t *testing.T) {
+	bctx := build.Default
+	bctx.GOOS = "linux"
+	bctx.GOARCH = "arm64"
+	bctx.Compiler = "gc"
+	bctx.CgoEnabled = true
+	bctx.BuildTags = []string{"race", "", "linux"}
+	want := []string{"arm64", "cgo", "gc", "linux", "race"}
+	if got := effectiveTags(bctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
@@ -23,13 +23,20 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 // cgo2 processes a set of mixed source files with cgo.
-func cgo2(goenv *env, goSrcs, cgoSrcs, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSrcs, hSrcs []string, packagePath, packageName string, cc string, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags, ldFlags []string, cgoExportHPath string) (srcDir string, allGoSrcs, cObjs []string, err error) {
+// Up to ccConcurrency C, C++, Objective-C, and assembly files are compiled
+// at a time.
+func cgo2(goenv *buildenv.Env, goSrcs, cgoSrcs, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSrcs, hSrcs []string, packagePath, packageName string, cc string, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags, ldFlags []string, cgoExportHPath string, ccConcurrency int) (srcDir string, allGoSrcs, cObjs []string, err error) {
 	// Report an error if the C/C++ toolchain wasn't configured.
 	if cc == "" {
 		err := cgoError(cgoSrcs[:])
@@ -48,21 +55,82 @@ func cgo2(goenv *env, goSrcs, cgoSrcs, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSr
 	// might miss dependencies like -lstdc++ if they aren't referenced in
 	// some other way.
 	if len(cgoSrcs) == 0 {
-		cObjs, err = compileCSources(goenv, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSrcs, hSrcs, cc, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags)
+		cObjs, err = compileCSources(goenv, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSrcs, hSrcs, cc, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags, ccConcurrency)
 		return ".", nil, cObjs, err
 	}
 
-	workDir, cleanup, err := goenv.workDir()
+	workDir, cleanup, err := goenv.WorkDir()
 	if err != nil {
 		return "", nil, nil, err
 	}
 	defer cleanup()
 
-	// Filter out -lstdc++ and -lc++ from ldflags if we don't have C++ sources,
-	// and set CGO_LDFLAGS. These flags get written as special comments into cgo
+	// Set CGO_LDFLAGS. These flags get written as special comments into cgo
 	// generated sources. The compiler encodes those flags in the compiled .a
 	// file, and the linker passes them on to the external linker.
 	haveCxx := len(cxxSrcs)+len(objcxxSrcs) > 0
+	combinedLdFlags := cgoLdFlags(ldFlags, haveCxx)
+	os.Setenv("CGO_LDFLAGS", strings.Join(combinedLdFlags, " "))
+
+	// Generate Go and C code.
+	genGoSrcs, genCSrcs, cgoMainC, err := cgoCodegen(goenv, cgoSrcs, hSrcs, packagePath, cppFlags, cFlags, workDir, filepath.Join(workDir, "cgosrcs"))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if cgoExportHPath != "" {
+		if err := copyFile(filepath.Join(workDir, "_cgo_export.h"), cgoExportHPath); err != nil {
+			return "", nil, nil, err
+		}
+	}
+
+	// Compile C, C++, Objective-C/C++, and assembly code.
+	hdrIncludes := cgoHdrIncludes(hSrcs, workDir)
+	defaultCFlags := defaultCFlags(workDir)
+	combinedCFlags := combineFlags(cppFlags, hdrIncludes, cFlags, defaultCFlags)
+	var jobs []cCompileJob
+	for _, lang := range []struct{ srcs, flags []string }{
+		{genCSrcs, combinedCFlags},
+		{cSrcs, combinedCFlags},
+		{cxxSrcs, combineFlags(cppFlags, hdrIncludes, cxxFlags, defaultCFlags)},
+		{objcSrcs, combineFlags(cppFlags, hdrIncludes, objcFlags, defaultCFlags)},
+		{objcxxSrcs, combineFlags(cppFlags, hdrIncludes, objcxxFlags, defaultCFlags)},
+		{sSrcs, combineFlags(cppFlags, hdrIncludes, cFlags, defaultCFlags)},
+	} {
+		for _, src := range lang.srcs {
+			obj := filepath.Join(workDir, fmt.Sprintf("_x%d.o", len(cObjs)))
+			cObjs = append(cObjs, obj)
+			jobs = append(jobs, cCompileJob{src: src, flags: lang.flags, out: obj})
+		}
+	}
+	if err := cCompileAll(goenv, cc, jobs, ccConcurrency); err != nil {
+		return "", nil, nil, err
+	}
+
+	cgoImportsGo := filepath.Join(workDir, "_cgo_imports.go")
+	if err := cgoImports(goenv, cc, packageName, cgoMainC, combinedCFlags, combinedLdFlags, cObjs, workDir, cgoImportsGo); err != nil {
+		return "", nil, nil, err
+	}
+	genGoSrcs = append(genGoSrcs, cgoImportsGo)
+
+	// Copy regular Go source files into the work directory so that we can
+	// use -trimpath=workDir.
+	goBases, err := gatherSrcs(workDir, goSrcs)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	allGoSrcs = make([]string, len(goSrcs)+len(genGoSrcs))
+	for i := range goSrcs {
+		allGoSrcs[i] = filepath.Join(workDir, goBases[i])
+	}
+	copy(allGoSrcs[len(goSrcs):], genGoSrcs)
+	return workDir, allGoSrcs, cObjs, nil
+}
+
+// cgoLdFlags returns the flags cgo should record for the external linker.
+// -lstdc++ and -lc++ are filtered out of ldFlags if the package doesn't
+// have C++ sources, and platform defaults are appended.
+func cgoLdFlags(ldFlags []string, haveCxx bool) []string {
 	if !haveCxx {
 		for _, f := range ldFlags {
 			if strings.HasSuffix(f, ".a") {
@@ -82,12 +150,35 @@ func cgo2(goenv *env, goSrcs, cgoSrcs, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSr
 			}
 		}
 	}
-	combinedLdFlags = append(combinedLdFlags, defaultLdFlags()...)
-	os.Setenv("CGO_LDFLAGS", strings.Join(combinedLdFlags, " "))
+	return append(combinedLdFlags, defaultLdFlags()...)
+}
+
+// cgoHdrIncludes returns -iquote flags for the directories containing
+// hSrcs, followed by objDir, which contains _cgo_export.h.
+func cgoHdrIncludes(hSrcs []string, objDir string) []string {
+	hdrDirs := map[string]bool{}
+	var hdrIncludes []string
+	for _, hdr := range hSrcs {
+		hdrDir := filepath.Dir(hdr)
+		if !hdrDirs[hdrDir] {
+			hdrDirs[hdrDir] = true
+			hdrIncludes = append(hdrIncludes, "-iquote", hdrDir)
+		}
+	}
+	return append(hdrIncludes, "-iquote", objDir)
+}
 
-	// If cgo sources are in different directories, gather them into a temporary
+// cgoCodegen runs cgo on cgoSrcs, writing generated Go and C files into
+// objDir. If cgoSrcs are not all in the same directory, they are copied into
+// gatherDir first. CGO_LDFLAGS should already be set.
+//
+// cgoCodegen returns the generated Go and C files and _cgo_main.c, which is
+// needed to generate _cgo_imports.go.
+func cgoCodegen(goenv *buildenv.Env, cgoSrcs, hSrcs []string, packagePath string, cppFlags, cFlags []string, objDir, gatherDir string) (genGoSrcs, genCSrcs []string, cgoMainC string, err error) {
+	// If cgo sources are in different directories, gather them into a
 	// directory so we can use -srcdir.
-	srcDir = filepath.Dir(cgoSrcs[0])
+	cgoSrcs = append([]string{}, cgoSrcs...)
+	srcDir := filepath.Dir(cgoSrcs[0])
 	srcsInSingleDir := true
 	for _, src := range cgoSrcs[1:] {
 		if filepath.Dir(src) != srcDir {
@@ -101,111 +192,62 @@ func cgo2(goenv *env, goSrcs, cgoSrcs, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSr
 			cgoSrcs[i] = filepath.Base(cgoSrcs[i])
 		}
 	} else {
-		srcDir = filepath.Join(workDir, "cgosrcs")
+		srcDir = gatherDir
 		if err := os.Mkdir(srcDir, 0777); err != nil {
-			return "", nil, nil, err
+			return nil, nil, "", err
 		}
 		copiedSrcs, err := gatherSrcs(srcDir, cgoSrcs)
 		if err != nil {
-			return "", nil, nil, err
+			return nil, nil, "", err
 		}
 		cgoSrcs = copiedSrcs
 	}
 
-	// Generate Go and C code.
-	hdrDirs := map[string]bool{}
-	var hdrIncludes []string
-	for _, hdr := range hSrcs {
-		hdrDir := filepath.Dir(hdr)
-		if !hdrDirs[hdrDir] {
-			hdrDirs[hdrDir] = true
-			hdrIncludes = append(hdrIncludes, "-iquote", hdrDir)
-		}
-	}
-	hdrIncludes = append(hdrIncludes, "-iquote", workDir) // for _cgo_export.h
-
-	args := goenv.goTool("cgo", "-srcdir", srcDir, "-objdir", workDir)
+	args := goenv.GoTool("cgo", "-srcdir", srcDir, "-objdir", objDir)
 	if packagePath != "" {
 		args = append(args, "-importpath", packagePath)
 	}
 	args = append(args, "--")
 	args = append(args, cppFlags...)
-	args = append(args, hdrIncludes...)
+	args = append(args, cgoHdrIncludes(hSrcs, objDir)...)
 	args = append(args, cFlags...)
 	args = append(args, cgoSrcs...)
-	if err := goenv.runCommand(args); err != nil {
-		return "", nil, nil, err
+	if err := goenv.RunCommand(args); err != nil {
+		return nil, nil, "", err
 	}
 
-	if cgoExportHPath != "" {
-		if err := copyFile(filepath.Join(workDir, "_cgo_export.h"), cgoExportHPath); err != nil {
-			return "", nil, nil, err
-		}
-	}
-	genGoSrcs := make([]string, 1+len(cgoSrcs))
-	genGoSrcs[0] = filepath.Join(workDir, "_cgo_gotypes.go")
-	genCSrcs := make([]string, 1+len(cgoSrcs))
-	genCSrcs[0] = filepath.Join(workDir, "_cgo_export.c")
+	genGoSrcs = make([]string, 1+len(cgoSrcs))
+	genGoSrcs[0] = filepath.Join(objDir, "_cgo_gotypes.go")
+	genCSrcs = make([]string, 1+len(cgoSrcs))
+	genCSrcs[0] = filepath.Join(objDir, "_cgo_export.c")
 	for i, src := range cgoSrcs {
 		stem := strings.TrimSuffix(filepath.Base(src), ".go")
-		genGoSrcs[i+1] = filepath.Join(workDir, stem+".cgo1.go")
-		genCSrcs[i+1] = filepath.Join(workDir, stem+".cgo2.c")
-	}
-	cgoMainC := filepath.Join(workDir, "_cgo_main.c")
-
-	// Compile C, C++, Objective-C/C++, and assembly code.
-	defaultCFlags := defaultCFlags(workDir)
-	combinedCFlags := combineFlags(cppFlags, hdrIncludes, cFlags, defaultCFlags)
-	for _, lang := range []struct{ srcs, flags []string }{
-		{genCSrcs, combinedCFlags},
-		{cSrcs, combinedCFlags},
-		{cxxSrcs, combineFlags(cppFlags, hdrIncludes, cxxFlags, defaultCFlags)},
-		{objcSrcs, combineFlags(cppFlags, hdrIncludes, objcFlags, defaultCFlags)},
-		{objcxxSrcs, combineFlags(cppFlags, hdrIncludes, objcxxFlags, defaultCFlags)},
-		{sSrcs, nil},
-	} {
-		for _, src := range lang.srcs {
-			obj := filepath.Join(workDir, fmt.Sprintf("_x%d.o", len(cObjs)))
-			cObjs = append(cObjs, obj)
-			if err := cCompile(goenv, src, cc, lang.flags, obj); err != nil {
-				return "", nil, nil, err
-			}
-		}
+		genGoSrcs[i+1] = filepath.Join(objDir, stem+".cgo1.go")
+		genCSrcs[i+1] = filepath.Join(objDir, stem+".cgo2.c")
 	}
+	cgoMainC = filepath.Join(objDir, "_cgo_main.c")
+	return genGoSrcs, genCSrcs, cgoMainC, nil
+}
 
+// cgoImports compiles cgoMainC and links it with the objects compiled for a
+// cgo package, then uses the dynamic symbols in the result to generate
+// _cgo_imports.go at outPath. Intermediate files are written in workDir.
+func cgoImports(goenv *buildenv.Env, cc, packageName, cgoMainC string, cFlags, ldFlags, cObjs []string, workDir, outPath string) error {
 	mainObj := filepath.Join(workDir, "_cgo_main.o")
-	if err := cCompile(goenv, cgoMainC, cc, combinedCFlags, mainObj); err != nil {
-		return "", nil, nil, err
+	if err := cCompile(goenv, cgoMainC, cc, cFlags, mainObj); err != nil {
+		return err
 	}
 
 	// Link cgo binary and use the symbols to generate _cgo_import.go.
 	mainBin := filepath.Join(workDir, "_cgo_.o") // .o is a lie; it's an executable
-	args = append([]string{cc, "-o", mainBin, mainObj}, cObjs...)
-	args = append(args, combinedLdFlags...)
-	if err := goenv.runCommand(args); err != nil {
-		return "", nil, nil, err
+	args := append([]string{cc, "-o", mainBin, mainObj}, cObjs...)
+	args = append(args, ldFlags...)
+	if err := goenv.RunCommand(args); err != nil {
+		return err
 	}
 
-	cgoImportsGo := filepath.Join(workDir, "_cgo_imports.go")
-	args = goenv.goTool("cgo", "-dynpackage", packageName, "-dynimport", mainBin, "-dynout", cgoImportsGo)
-	if err := goenv.runCommand(args); err != nil {
-		return "", nil, nil, err
-	}
-	genGoSrcs = append(genGoSrcs, cgoImportsGo)
-
-	// Copy regular Go source files into the work directory so that we can
-	// use -trimpath=workDir.
-	goBases, err := gatherSrcs(workDir, goSrcs)
-	if err != nil {
-		return "", nil, nil, err
-	}
-
-	allGoSrcs = make([]string, len(goSrcs)+len(genGoSrcs))
-	for i := range goSrcs {
-		allGoSrcs[i] = filepath.Join(workDir, goBases[i])
-	}
-	copy(allGoSrcs[len(goSrcs):], genGoSrcs)
-	return workDir, allGoSrcs, cObjs, nil
+	args = goenv.GoTool("cgo", "-dynpackage", packageName, "-dynimport", mainBin, "-dynout", outPath)
+	return goenv.RunCommand(args)
 }
 
 // compileCSources compiles a list of C, C++, Objective-C, Objective-C++,
@@ -213,8 +255,8 @@ func cgo2(goenv *env, goSrcs, cgoSrcs, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSr
 // It does not run cgo. This is used for packages with "cgo = True" but
 // without any .go files that import "C". The Go command forbids this,
 // but we have historically allowed it.
-func compileCSources(goenv *env, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSrcs, hSrcs []string, cc string, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags []string) (cObjs []string, err error) {
-	workDir, cleanup, err := goenv.workDir()
+func compileCSources(goenv *buildenv.Env, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSrcs, hSrcs []string, cc string, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags []string, ccConcurrency int) (cObjs []string, err error) {
+	workDir, cleanup, err := goenv.WorkDir()
 	if err != nil {
 		return nil, err
 	}
@@ -231,21 +273,23 @@ func compileCSources(goenv *env, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSrcs, hS
 	}
 
 	defaultCFlags := defaultCFlags(workDir)
+	var jobs []cCompileJob
 	for _, lang := range []struct{ srcs, flags []string }{
 		{cSrcs, combineFlags(cppFlags, hdrIncludes, cFlags, defaultCFlags)},
 		{cxxSrcs, combineFlags(cppFlags, hdrIncludes, cxxFlags, defaultCFlags)},
 		{objcSrcs, combineFlags(cppFlags, hdrIncludes, objcFlags, defaultCFlags)},
 		{objcxxSrcs, combineFlags(cppFlags, hdrIncludes, objcxxFlags, defaultCFlags)},
-		{sSrcs, nil},
+		{sSrcs, combineFlags(cppFlags, hdrIncludes, cFlags, defaultCFlags)},
 	} {
 		for _, src := range lang.srcs {
 			obj := filepath.Join(workDir, fmt.Sprintf("_x%d.o", len(cObjs)))
 			cObjs = append(cObjs, obj)
-			if err := cCompile(goenv, src, cc, lang.flags, obj); err != nil {
-				return nil, err
-			}
+			jobs = append(jobs, cCompileJob{src: src, flags: lang.flags, out: obj})
 		}
 	}
+	if err := cCompileAll(goenv, cc, jobs, ccConcurrency); err != nil {
+		return nil, err
+	}
 	return cObjs, nil
 }
 
@@ -261,16 +305,82 @@ func combineFlags(lists ...[]string) []string {
 	return flags
 }
 
-func cCompile(goenv *env, src, cc string, flags []string, out string) error {
+func cCompile(goenv *buildenv.Env, src, cc string, flags []string, out string) error {
 	args := []string{cc}
 	args = append(args, flags...)
 	args = append(args, "-c", src, "-o", out)
-	return goenv.runCommand(args)
+	return goenv.RunCommand(args)
+}
+
+// cCompileJob is a C, C++, Objective-C, or assembly file to be compiled by
+// cCompileAll.
+type cCompileJob struct {
+	src, out string
+	flags    []string
+}
+
+// cCompileAll compiles each job with cCompile, running up to concurrency
+// compilers at a time. Each compiler's output is buffered and printed in the
+// order of jobs, so diagnostics for different files aren't interleaved. No
+// more jobs are started after one fails, and the error of the first failed
+// job is returned.
+func cCompileAll(goenv *buildenv.Env, cc string, jobs []cCompileJob, concurrency int) error {
+	if concurrency <= 1 || len(jobs) <= 1 {
+		for _, job := range jobs {
+			if err := cCompile(goenv, job.src, cc, job.flags, job.out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	outputs := make([]bytes.Buffer, len(jobs))
+	errs := make([]error, len(jobs))
+	sem := make(chan struct{}, concurrency)
+	var failed int32
+	var wg sync.WaitGroup
+	for i := range jobs {
+		sem <- struct{}{}
+		if atomic.LoadInt32(&failed) != 0 {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			jobEnv := *goenv
+			jobEnv.Output = &outputs[i]
+			job := jobs[i]
+			if errs[i] = cCompile(&jobEnv, job.src, cc, job.flags, job.out); errs[i] != nil {
+				atomic.StoreInt32(&failed, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var w io.Writer = os.Stderr
+	if goenv.Output != nil {
+		w = goenv.Output
+	}
+	for i := range outputs {
+		if _, err := outputs[i].WriteTo(w); err != nil {
+			return err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func defaultCFlags(workDir string) []string {
 	flags := []string{
-		"-fdebug-prefix-map=" + abs(".") + "=.",
+		"-fdebug-prefix-map=" + buildenv.Abs(".") + "=.",
 		"-fdebug-prefix-map=" + workDir + "=.",
 	}
 	goos, goarch := os.Getenv("GOOS"), os.Getenv("GOARCH")
@@ -0,0 +1,124 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// fakeCC is a C compiler that prints the name of the file it compiles,
+// sleeps longer for earlier files so they finish last, and fails for files
+// named bad.c.
+const fakeCC = `#!/bin/sh
+while [ "$#" -gt 0 ]; do
+  case "$1" in
+    -c) src="$2"; shift ;;
+    -o) out="$2"; shift ;;
+    -delay=*) delay="${1#-delay=}" ;;
+  esac
+  shift
+done
+echo "compiling $(basename "$src")"
+sleep "$delay"
+case "$src" in
+  *bad.c) echo "error in $(basename "$src")"; exit 1 ;;
+esac
+touch "$out"
+`
+
+func TestCCompileAll(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake compiler is a shell script")
+	}
+	dir, err := ioutil.TempDir("", "TestCCompileAll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cc := filepath.Join(dir, "cc.sh")
+	if err := ioutil.WriteFile(cc, []byte(fakeCC), 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		desc        string
+		srcs        []string
+		concurrency int
+		wantOutput  string
+		wantErr     bool
+	}{
+		{
+			desc:        "serial",
+			srcs:        []string{"a.c", "b.c", "c.c"},
+			concurrency: 1,
+			wantOutput:  "compiling a.c\ncompiling b.c\ncompiling c.c\n",
+		}, {
+			desc:        "parallel",
+			srcs:        []string{"a.c", "b.c", "c.c", "d.c"},
+			concurrency: 4,
+			wantOutput:  "compiling a.c\ncompiling b.c\ncompiling c.c\ncompiling d.c\n",
+		}, {
+			desc:        "parallel_error",
+			srcs:        []string{"a.c", "bad.c", "c.c"},
+			concurrency: 3,
+			wantOutput:  "compiling a.c\ncompiling bad.c\nerror in bad.c\ncompiling c.c\n",
+			wantErr:     true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			outDir := filepath.Join(dir, tc.desc)
+			if err := os.Mkdir(outDir, 0777); err != nil {
+				t.Fatal(err)
+			}
+			var jobs []cCompileJob
+			for i, src := range tc.srcs {
+				delay := fmt.Sprintf("-delay=0.%d", len(tc.srcs)-i)
+				jobs = append(jobs, cCompileJob{
+					src:   filepath.Join(dir, src),
+					out:   filepath.Join(outDir, strings.TrimSuffix(src, ".c")+".o"),
+					flags: []string{delay},
+				})
+			}
+			var out bytes.Buffer
+			goenv := &buildenv.Env{Output: &out}
+			err := cCompileAll(goenv, cc, jobs, tc.concurrency)
+			if tc.wantErr && err == nil {
+				t.Fatal("unexpected success")
+			} else if !tc.wantErr && err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tc.wantOutput {
+				t.Errorf("got output:\n%s\nwant:\n%s", got, tc.wantOutput)
+			}
+			if tc.wantErr {
+				return
+			}
+			for _, job := range jobs {
+				if _, err := os.Stat(job.out); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// cgoTrace maps cgo flags to the targets or settings they came from. It's
+// filled in by -cgo_trace flags, which are passed when
+// @io_bazel_rules_go//go/config:cgo_trace is set. Each value has a flag and
+// its origin, separated by a tab. Flags that take an argument, like
+// "-I dir", are recorded with their argument.
+type cgoTrace map[string]string
+
+func (t cgoTrace) String() string {
+	entries := make([]string, 0, len(t))
+	for flag, origin := range t {
+		entries = append(entries, flag+"\t"+origin)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ", ")
+}
+
+func (t cgoTrace) Set(v string) error {
+	tab := strings.IndexByte(v, '\t')
+	if tab < 0 {
+		return fmt.Errorf("-cgo_trace value does not contain a tab: %q", v)
+	}
+	flag, origin := v[:tab], v[tab+1:]
+	if _, ok := t[flag]; !ok {
+		t[flag] = origin
+	}
+	return nil
+}
+
+// cgoFlagsWithArg are flags that take their argument as a separate word.
+// Keep in sync with _CGO_FLAGS_WITH_ARG in go/private/rules/cgo.bzl.
+var cgoFlagsWithArg = map[string]bool{
+	"-D":         true,
+	"-F":         true,
+	"-I":         true,
+	"-L":         true,
+	"-U":         true,
+	"-Xlinker":   true,
+	"-arch":      true,
+	"-framework": true,
+	"-idirafter": true,
+	"-include":   true,
+	"-iquote":    true,
+	"-isysroot":  true,
+	"-isystem":   true,
+	"-l":         true,
+	"-target":    true,
+	"-x":         true,
+}
+
+// groupCgoFlags groups flags that take a separate argument with the
+// argument, so "-I", "dir" becomes "-I dir".
+func groupCgoFlags(flags []string) []string {
+	var groups []string
+	for i := 0; i < len(flags); i++ {
+		if cgoFlagsWithArg[flags[i]] && i+1 < len(flags) {
+			groups = append(groups, flags[i]+" "+flags[i+1])
+			i++
+		} else {
+			groups = append(groups, flags[i])
+		}
+	}
+	return groups
+}
+
+// log writes each flag in flags to the log with its origin. kind describes
+// the flags, like "cppflags". Nothing is logged if tracing is disabled.
+func (t cgoTrace) log(kind string, flags []string) {
+	if len(t) == 0 {
+		return
+	}
+	for _, flag := range groupCgoFlags(flags) {
+		origin, ok := t[flag]
+		if !ok {
+			origin = "rules_go"
+		}
+		log.Printf("cgo trace: %s: %s (from %s)", kind, flag, origin)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGroupCgoFlags(t *testing.T) {
+	flags := []string{"-I", "a/include", "-DFOO=1", "-isystem", "b", "-O2", "-l"}
+	want := []string{"-I a/include", "-DFOO=1", "-isystem b", "-O2", "-l"}
+	if got := groupCgoFlags(flags); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestCgoTraceLog(t *testing.T) {
+	trace := cgoTrace{}
+	for _, v := range []string{
+		"-I external/zlib\t@zlib//:zlib",
+		"-DFOO=1\tcppopts of //:lib",
+		"-DFOO=1\t//:other",
+	} {
+		if err := trace.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := trace.Set("-O2"); err == nil {
+		t.Error("setting a value without an origin: got success; want error")
+	}
+
+	var buf bytes.Buffer
+	logFlags := log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	defer func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(logFlags)
+	}()
+	trace.log("cppflags", []string{"-I", "external/zlib", "-DFOO=1", "-Ibazel-out/gen"})
+
+	want := strings.Join([]string{
+		"cgo trace: cppflags: -I external/zlib (from @zlib//:zlib)",
+		"cgo trace: cppflags: -DFOO=1 (from cppopts of //:lib)",
+		"cgo trace: cppflags: -Ibazel-out/gen (from rules_go)",
+		"",
+	}, "\n")
+	if got := buf.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
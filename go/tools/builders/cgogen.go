@@ -0,0 +1,387 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// cgogen.go implements the actions that process a cgo package separately
+// from GoCompilePkg, so that Bazel can cache each step on its own:
+//
+//   cgogen (GoCgoGen) runs cgo on the .go files that import "C".
+//   cc (GoCompileC) compiles one C, C++, or Objective-C source file. It also
+//       compiles C++ precompiled headers (GoCompilePch).
+//   cgolink (GoCgoLink) compiles the C files generated by cgo and generates
+//       _cgo_imports.go from the objects of the whole package.
+//
+// GoCompilePkg then compiles the generated Go files and packs the objects
+// into the archive. A change to a C file only recompiles that file and
+// relinks, and a change to a Go file without cgo doesn't run cgo at all.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// cgoGen runs cgo on the Go files in a package that import "C". Generated
+// files are written to a directory that's later read by cgoLink and
+// compilePkg.
+func cgoGen(args []string) error {
+	args, err := buildenv.ReadParamsFiles(args)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("GoCgoGen", flag.ExitOnError)
+	goenv := buildenv.EnvFlags(fs)
+	var unfilteredSrcs multiFlag
+	var packagePath, testFilter, objDir, cgoExportHPath string
+	var haveCxx bool
+	var cppFlags, cFlags, ldFlags quoteMultiFlag
+	fs.Var(&unfilteredSrcs, "src", ".go or header file to be filtered and processed with cgo")
+	fs.StringVar(&packagePath, "p", "", "The package path (importmap) of the package being compiled")
+	fs.StringVar(&testFilter, "testfilter", "off", "Controls test package filtering")
+	fs.Var(&cppFlags, "cppflags", "C preprocessor flags")
+	fs.Var(&cFlags, "cflags", "C compiler flags")
+	fs.Var(&ldFlags, "ldflags", "C linker flags")
+	fs.BoolVar(&haveCxx, "cxx", false, "Whether the package has C++ or Objective-C++ sources")
+	fs.StringVar(&objDir, "objdir", "", "The directory where generated files are written")
+	fs.StringVar(&cgoExportHPath, "cgoexport", "", "The _cgo_export.h file to write")
+	trace := cgoTrace{}
+	fs.Var(trace, "cgo_trace", "A cgo flag and the target or setting it came from, separated by a tab")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := goenv.CheckFlags(); err != nil {
+		return err
+	}
+	trace.log("cppflags", cppFlags)
+	trace.log("cflags", cFlags)
+	trace.log("ldflags", ldFlags)
+	if objDir == "" {
+		return errors.New("-objdir was not set")
+	}
+	objDir = buildenv.Abs(objDir)
+	for i := range unfilteredSrcs {
+		unfilteredSrcs[i] = buildenv.Abs(unfilteredSrcs[i])
+	}
+	if err := os.MkdirAll(objDir, 0777); err != nil {
+		return err
+	}
+
+	srcs, err := filterAndSplitFiles(unfilteredSrcs)
+	if err != nil {
+		return err
+	}
+	if err := applyTestFilter(&srcs, testFilter); err != nil {
+		return err
+	}
+	var cgoSrcs, hSrcs []string
+	for _, src := range srcs.goSrcs {
+		if src.isCgo {
+			cgoSrcs = append(cgoSrcs, src.filename)
+		}
+	}
+	for _, src := range srcs.hSrcs {
+		hSrcs = append(hSrcs, src.filename)
+	}
+	if len(cgoSrcs) == 0 {
+		// Packages with C sources but no cgo files are allowed. cgoLink
+		// and compilePkg treat an empty directory accordingly.
+		if cgoExportHPath != "" {
+			return ioutil.WriteFile(cgoExportHPath, nil, 0666)
+		}
+		return nil
+	}
+	if os.Getenv("CC") == "" {
+		return cgoError(cgoSrcs)
+	}
+
+	workDir, cleanup, err := goenv.WorkDir()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	os.Setenv("CGO_LDFLAGS", strings.Join(cgoLdFlags(ldFlags, haveCxx), " "))
+	genGoSrcs, genCSrcs, cgoMainC, err := cgoCodegen(goenv, cgoSrcs, hSrcs, packagePath, cppFlags, cFlags, objDir, filepath.Join(workDir, "cgosrcs"))
+	if err != nil {
+		return err
+	}
+
+	// cgo records absolute file names in line directives. Actions may run in
+	// different sandboxes, so make names relative to the execution root.
+	// The compiler resolves them against its own working directory.
+	generated := append(append(genGoSrcs, genCSrcs...), cgoMainC, filepath.Join(objDir, "_cgo_export.h"))
+	for _, path := range generated {
+		if err := relativizeExecRoot(path); err != nil {
+			return err
+		}
+	}
+
+	// Remove objects cgo leaves behind after running the C compiler. They
+	// are not used by later actions.
+	objs, err := filepath.Glob(filepath.Join(objDir, "*.o"))
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if err := os.Remove(obj); err != nil {
+			return err
+		}
+	}
+
+	if cgoExportHPath != "" {
+		return copyFile(filepath.Join(objDir, "_cgo_export.h"), cgoExportHPath)
+	}
+	return nil
+}
+
+// relativizeExecRoot rewrites absolute paths within the execution root that
+// appear in a file to paths relative to the execution root.
+func relativizeExecRoot(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	prefix := []byte(buildenv.Abs(".") + string(filepath.Separator))
+	if !bytes.Contains(data, prefix) {
+		return nil
+	}
+	return ioutil.WriteFile(path, bytes.ReplaceAll(data, prefix, nil), 0666)
+}
+
+// compileC compiles a C, C++, Objective-C, or Objective-C++ file in a cgo
+// package. If the file is excluded by build constraints, an empty output
+// file is written, and cgoLink and compilePkg skip it.
+//
+// With -pch, compileC compiles a C++ header into a precompiled header for
+// GCC instead. Build constraints are not checked in that case.
+func compileC(args []string) error {
+	args, err := buildenv.ReadParamsFiles(args)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("GoCompileC", flag.ExitOnError)
+	goenv := buildenv.EnvFlags(fs)
+	var src, outPath string
+	var pch bool
+	var cppFlags, cFlags quoteMultiFlag
+	fs.StringVar(&src, "src", "", "The source file to compile")
+	fs.BoolVar(&pch, "pch", false, "Whether src is a C++ header to be precompiled")
+	fs.Var(&cppFlags, "cppflags", "C preprocessor flags")
+	fs.Var(&cFlags, "cflags", "Compiler flags for the language of the source file")
+	fs.StringVar(&outPath, "o", "", "The object file to write")
+	trace := cgoTrace{}
+	fs.Var(trace, "cgo_trace", "A cgo flag and the target or setting it came from, separated by a tab")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := goenv.CheckFlags(); err != nil {
+		return err
+	}
+	trace.log("cppflags", cppFlags)
+	trace.log("cflags", cFlags)
+	if src == "" || outPath == "" {
+		return errors.New("-src and -o must be set")
+	}
+
+	if !pch {
+		srcs, err := filterAndSplitFiles([]string{buildenv.Abs(src)})
+		if err != nil {
+			return err
+		}
+		// Go assembly is assembled by GoCompilePkg. Other assembly files are
+		// compiled here, as the go command does in packages that use cgo.
+		_, sSrcs, err := splitGoAssembly(srcs.sSrcs)
+		if err != nil {
+			return err
+		}
+		if len(srcs.cSrcs)+len(srcs.cxxSrcs)+len(srcs.objcSrcs)+len(srcs.objcxxSrcs)+len(sSrcs) == 0 {
+			return ioutil.WriteFile(outPath, nil, 0666)
+		}
+	}
+	cc := os.Getenv("CC")
+	if cc == "" {
+		return cgoError{src}
+	}
+	flags := combineFlags(cppFlags, cFlags, defaultCFlags(buildenv.Abs(".")))
+	if pch {
+		// Warnings about the header are reported when sources including it
+		// are compiled. GCC warns about "#pragma once" in a header compiled
+		// on its own, which shouldn't fail the build with -Werror.
+		flags = append(flags, "-x", "c++-header", "-Wno-error")
+	}
+	return cCompile(goenv, src, cc, flags, outPath)
+}
+
+// cgoLink compiles the C files generated by cgoGen, then links them with the
+// package's other objects to generate _cgo_imports.go.
+func cgoLink(args []string) error {
+	args, err := buildenv.ReadParamsFiles(args)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("GoCgoLink", flag.ExitOnError)
+	goenv := buildenv.EnvFlags(fs)
+	var objs multiFlag
+	var genDir, objDir, importsPath string
+	var haveCxx bool
+	var cppFlags, cFlags, ldFlags quoteMultiFlag
+	fs.StringVar(&genDir, "gendir", "", "The directory written by cgogen")
+	fs.Var(&objs, "obj", "Object file compiled from a C, C++, or Objective-C source in the package")
+	fs.Var(&cppFlags, "cppflags", "C preprocessor flags")
+	fs.Var(&cFlags, "cflags", "C compiler flags")
+	fs.Var(&ldFlags, "ldflags", "C linker flags")
+	fs.BoolVar(&haveCxx, "cxx", false, "Whether the package has C++ or Objective-C++ sources")
+	fs.StringVar(&objDir, "objdir", "", "The directory where objects compiled from generated files are written")
+	fs.StringVar(&importsPath, "imports", "", "The _cgo_imports.go file to write")
+	trace := cgoTrace{}
+	fs.Var(trace, "cgo_trace", "A cgo flag and the target or setting it came from, separated by a tab")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := goenv.CheckFlags(); err != nil {
+		return err
+	}
+	trace.log("cppflags", cppFlags)
+	trace.log("cflags", cFlags)
+	trace.log("ldflags", ldFlags)
+	if genDir == "" || objDir == "" || importsPath == "" {
+		return errors.New("-gendir, -objdir, and -imports must be set")
+	}
+	genDir = buildenv.Abs(genDir)
+	objDir = buildenv.Abs(objDir)
+	if err := os.MkdirAll(objDir, 0777); err != nil {
+		return err
+	}
+
+	cgoMainC := filepath.Join(genDir, "_cgo_main.c")
+	if _, err := os.Stat(cgoMainC); os.IsNotExist(err) {
+		// cgoGen didn't find any files that import "C".
+		return ioutil.WriteFile(importsPath, nil, 0666)
+	}
+	packageName, err := cgoPackageName(filepath.Join(genDir, "_cgo_gotypes.go"))
+	if err != nil {
+		return err
+	}
+	cc := os.Getenv("CC")
+	if cc == "" {
+		return cgoError{genDir}
+	}
+
+	workDir, cleanup, err := goenv.WorkDir()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	genCSrcs, err := filepath.Glob(filepath.Join(genDir, "*.cgo2.c"))
+	if err != nil {
+		return err
+	}
+	genCSrcs = append([]string{filepath.Join(genDir, "_cgo_export.c")}, genCSrcs...)
+	cFlags = combineFlags(cppFlags, []string{"-iquote", genDir}, cFlags, defaultCFlags(genDir))
+	var cObjs []string
+	for _, src := range genCSrcs {
+		obj := filepath.Join(objDir, strings.TrimSuffix(filepath.Base(src), ".c")+".o")
+		if err := cCompile(goenv, src, cc, cFlags, obj); err != nil {
+			return err
+		}
+		cObjs = append(cObjs, obj)
+	}
+	for _, obj := range objs {
+		if nonEmpty, err := isNonEmptyFile(obj); err != nil {
+			return err
+		} else if nonEmpty {
+			cObjs = append(cObjs, obj)
+		}
+	}
+
+	return cgoImports(goenv, cc, packageName, cgoMainC, cFlags, cgoLdFlags(ldFlags, haveCxx), cObjs, workDir, importsPath)
+}
+
+// cgoPackageName returns the name of the package declared in a Go file
+// generated by cgo.
+func cgoPackageName(path string) (string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly)
+	if err != nil {
+		return "", err
+	}
+	return f.Name.Name, nil
+}
+
+func isNonEmptyFile(path string) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return fi.Size() > 0, nil
+}
+
+// cgoOutputs lists the files produced for a package by the GoCgoGen,
+// GoCompileC, and GoCgoLink actions. When compileArchive is given a non-nil
+// *cgoOutputs, it compiles and packs these files instead of running cgo.
+type cgoOutputs struct {
+	// genDir is the directory written by cgoGen.
+	genDir string
+
+	// objDir is the directory written by cgoLink.
+	objDir string
+
+	// importsPath is the _cgo_imports.go file written by cgoLink. It is
+	// empty if the package has no files that import "C".
+	importsPath string
+
+	// objs are object files written by compileC. Empty files are skipped.
+	objs []string
+}
+
+// goSrcs returns the generated Go files that should be compiled along with
+// the Go files that don't import "C".
+func (o *cgoOutputs) goSrcs() ([]string, error) {
+	srcs, err := filepath.Glob(filepath.Join(o.genDir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	if len(srcs) == 0 {
+		return nil, nil
+	}
+	sort.Strings(srcs)
+	return append(srcs, o.importsPath), nil
+}
+
+// objFiles returns the object files to be packed into the archive.
+func (o *cgoOutputs) objFiles() ([]string, error) {
+	objs, err := filepath.Glob(filepath.Join(o.objDir, "*.o"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(objs)
+	for _, obj := range o.objs {
+		if nonEmpty, err := isNonEmptyFile(obj); err != nil {
+			return nil, err
+		} else if nonEmpty {
+			objs = append(objs, obj)
+		}
+	}
+	return objs, nil
+}
@@ -25,19 +25,21 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 func compile(args []string) error {
 	// Parse arguments.
-	args, err := readParamsFiles(args)
+	args, err := buildenv.ReadParamsFiles(args)
 	if err != nil {
 		return err
 	}
-	builderArgs, toolArgs := splitArgs(args)
+	builderArgs, toolArgs := buildenv.SplitArgs(args)
 	flags := flag.NewFlagSet("GoCompile", flag.ExitOnError)
 	unfiltered := multiFlag{}
 	archives := compileArchiveMultiFlag{}
-	goenv := envFlags(flags)
+	goenv := buildenv.EnvFlags(flags)
 	packagePath := flags.String("p", "", "The package path (importmap) of the package being compiled")
 	flags.Var(&unfiltered, "src", "A source file to be filtered and compiled")
 	flags.Var(&archives, "arc", "Import path, package path, and file name of a direct dependency, separated by '='")
@@ -50,12 +52,12 @@ func compile(args []string) error {
 	if err := flags.Parse(builderArgs); err != nil {
 		return err
 	}
-	if err := goenv.checkFlags(); err != nil {
+	if err := goenv.CheckFlags(); err != nil {
 		return err
 	}
-	*output = abs(*output)
+	*output = buildenv.Abs(*output)
 	if *asmhdr != "" {
-		*asmhdr = abs(*asmhdr)
+		*asmhdr = buildenv.Abs(*asmhdr)
 	}
 
 	// Filter sources using build constraints.
@@ -114,7 +116,7 @@ func compile(args []string) error {
 	}
 
 	// Build an importcfg file for the compiler.
-	importcfgName, err := buildImportcfgFileForCompile(imports, goenv.installSuffix, filepath.Dir(*output))
+	importcfgName, err := buildImportcfgFileForCompile(imports, goenv.InstallSuffix, filepath.Dir(*output))
 	if err != nil {
 		return err
 	}
@@ -130,7 +132,7 @@ func compile(args []string) error {
 	}
 
 	// Compile the filtered files.
-	goargs := goenv.goTool("compile")
+	goargs := goenv.GoTool("compile")
 	goargs = append(goargs, "-p", *packagePath)
 	goargs = append(goargs, "-importcfg", importcfgName)
 	goargs = append(goargs, "-pack", "-o", *output)
@@ -147,7 +149,7 @@ func compile(args []string) error {
 		filenames = append(filenames, f.filename)
 	}
 	goargs = append(goargs, filenames...)
-	absArgs(goargs, []string{"-I", "-o", "-trimpath", "-importcfg"})
+	buildenv.AbsArgs(goargs, []string{"-I", "-o", "-trimpath", "-importcfg"})
 	cmd := exec.Command(goargs[0], goargs[1:]...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -29,25 +29,34 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 func compilePkg(args []string) error {
 	// Parse arguments.
-	args, err := readParamsFiles(args)
+	args, err := buildenv.ReadParamsFiles(args)
 	if err != nil {
 		return err
 	}
 
 	fs := flag.NewFlagSet("GoCompilePkg", flag.ExitOnError)
-	goenv := envFlags(fs)
-	var unfilteredSrcs, coverSrcs multiFlag
+	goenv := buildenv.EnvFlags(fs)
+	var unfilteredSrcs, coverSrcs, embedSrcs, embedRoots, cObjs, depSymabis, werrorExprs multiFlag
 	var deps compileArchiveMultiFlag
 	var importPath, packagePath, nogoPath, packageListPath, coverMode string
-	var outPath, outFactsPath, cgoExportHPath string
-	var testFilter string
+	var outPath, outFactsPath, outFixPath, outSARIFPath, cgoExportHPath, metadataPath string
+	var outExportDataPath string
+	var exportNogoSrcs bool
+	var testFilter, trimpathPrefix string
+	var werrorPolicyPath, label string
+	var cgoGenDir, cgoObjDir, cgoImportsPath string
+	var cgoConcurrency int
 	var gcFlags, asmFlags, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags, ldFlags quoteMultiFlag
 	fs.Var(&unfilteredSrcs, "src", ".go, .c, .cc, .m, .mm, .s, or .S file to be filtered and compiled")
 	fs.Var(&coverSrcs, "cover", ".go file that should be instrumented for coverage (must also be a -src)")
+	fs.Var(&embedSrcs, "embedsrc", "file or directory that may be embedded with //go:embed")
+	fs.Var(&embedRoots, "embedroot", "root directory (source or output) containing the package directory, used to resolve //go:embed patterns")
 	fs.Var(&deps, "arc", "Import path, package path, and file name of a direct dependency, separated by '='")
 	fs.StringVar(&importPath, "importpath", "", "The import path of the package being compiled. Not passed to the compiler, but may be displayed in debug data.")
 	fs.StringVar(&packagePath, "p", "", "The package path (importmap) of the package being compiled")
@@ -59,30 +68,59 @@ func compilePkg(args []string) error {
 	fs.Var(&objcFlags, "objcflags", "Objective-C compiler flags")
 	fs.Var(&objcxxFlags, "objcxxflags", "Objective-C++ compiler flags")
 	fs.Var(&ldFlags, "ldflags", "C linker flags")
+	fs.StringVar(&cgoGenDir, "cgo_gendir", "", "Directory of files generated by the cgogen action. If set, cgo is not run.")
+	fs.StringVar(&cgoObjDir, "cgo_objdir", "", "Directory of objects written by the cgolink action")
+	fs.StringVar(&cgoImportsPath, "cgo_imports", "", "The _cgo_imports.go file written by the cgolink action")
+	fs.IntVar(&cgoConcurrency, "cgo_concurrency", 1, "The number of C, C++, Objective-C, and assembly files that may be compiled at a time when cgo runs in this action. Ignored with -cgo_gendir.")
+	fs.Var(&cObjs, "cobj", "Object file written by the cc action, to be packed into the archive")
+	fs.Var(&depSymabis, "symabis", "A symabis file written by go_symabis for assembly in another package that calls functions in this package")
 	fs.StringVar(&nogoPath, "nogo", "", "The nogo binary. If unset, nogo will not be run.")
 	fs.StringVar(&packageListPath, "package_list", "", "The file containing the list of standard library packages")
 	fs.StringVar(&coverMode, "cover_mode", "", "The coverage mode to use. Empty if coverage instrumentation should not be added.")
 	fs.StringVar(&outPath, "o", "", "The output archive file to write")
 	fs.StringVar(&outFactsPath, "x", "", "The nogo facts file to write")
+	fs.StringVar(&outFixPath, "nogo_fix", "", "The file where nogo should write a unified diff of suggested fixes. If set, nogo findings are not errors.")
+	fs.StringVar(&outSARIFPath, "nogo_sarif", "", "The file where nogo should write findings in SARIF format. If set, nogo findings are not errors.")
+	fs.BoolVar(&exportNogoSrcs, "nogo_srcs", false, "If true, the Go files nogo should check are listed in the export data file, for nogo running in a separate action")
+	fs.StringVar(&outExportDataPath, "export_data", "", "The file where the package's export data is written, for compiling and checking packages that import it")
 	fs.StringVar(&cgoExportHPath, "cgoexport", "", "The _cgo_exports.h file to write")
+	fs.StringVar(&metadataPath, "metadata", "", "The action metadata file to write. If unset, no metadata is written.")
 	fs.StringVar(&testFilter, "testfilter", "off", "Controls test package filtering")
+	fs.StringVar(&trimpathPrefix, "trimpath_prefix", "", "If set, source file names recorded in the archive are workspace-relative and joined with this prefix")
+	fs.Var(&werrorExprs, "werror", "Regular expression matching compiler output that should be treated as an error")
+	fs.StringVar(&werrorPolicyPath, "werror_policy", "", "File listing regular expressions matching compiler output that should be treated as errors for targets matching label patterns")
+	fs.StringVar(&label, "label", "", "The label of the target being compiled, matched against patterns in the werror policy")
+	trace := cgoTrace{}
+	fs.Var(trace, "cgo_trace", "A cgo flag and the target or setting it came from, separated by a tab")
 	if err := fs.Parse(args); err != nil {
 		return err
 	}
-	if err := goenv.checkFlags(); err != nil {
+	if err := goenv.CheckFlags(); err != nil {
 		return err
 	}
+	trace.log("cppflags", cppFlags)
+	trace.log("cflags", cFlags)
+	trace.log("cxxflags", cxxFlags)
+	trace.log("objcflags", objcFlags)
+	trace.log("objcxxflags", objcxxFlags)
+	trace.log("ldflags", ldFlags)
 	if importPath == "" {
 		importPath = packagePath
 	}
 	cgoEnabled := os.Getenv("CGO_ENABLED") == "1"
 	cc := os.Getenv("CC")
-	outPath = abs(outPath)
+	outPath = buildenv.Abs(outPath)
 	for i := range unfilteredSrcs {
-		unfilteredSrcs[i] = abs(unfilteredSrcs[i])
+		unfilteredSrcs[i] = buildenv.Abs(unfilteredSrcs[i])
 	}
 	for i := range coverSrcs {
-		coverSrcs[i] = abs(coverSrcs[i])
+		coverSrcs[i] = buildenv.Abs(coverSrcs[i])
+	}
+	for i := range embedSrcs {
+		embedSrcs[i] = buildenv.Abs(embedSrcs[i])
+	}
+	for i := range embedRoots {
+		embedRoots[i] = buildenv.Abs(embedRoots[i])
 	}
 
 	// Filter sources.
@@ -94,40 +132,54 @@ func compilePkg(args []string) error {
 	// TODO(jayconrod): remove -testfilter flag. The test action should compile
 	// the main, internal, and external packages by calling compileArchive
 	// with the correct sources for each.
-	switch testFilter {
-	case "off":
-	case "only":
-		testSrcs := make([]fileInfo, 0, len(srcs.goSrcs))
-		for _, f := range srcs.goSrcs {
-			if strings.HasSuffix(f.pkg, "_test") {
-				testSrcs = append(testSrcs, f)
-			}
+	if err := applyTestFilter(&srcs, testFilter); err != nil {
+		return err
+	}
+
+	// Compiler output matching werror expressions is still printed, but the
+	// action fails after compiling.
+	if werrorPolicyPath != "" {
+		exprs, err := readWerrorPolicy(werrorPolicyPath, label)
+		if err != nil {
+			return err
 		}
-		srcs.goSrcs = testSrcs
-	case "exclude":
-		libSrcs := make([]fileInfo, 0, len(srcs.goSrcs))
-		for _, f := range srcs.goSrcs {
-			if !strings.HasSuffix(f.pkg, "_test") {
-				libSrcs = append(libSrcs, f)
-			}
+		werrorExprs = append(werrorExprs, exprs...)
+	}
+	var werror *werrorWriter
+	if len(werrorExprs) > 0 {
+		if werror, err = newWerrorWriter(os.Stderr, werrorExprs); err != nil {
+			return err
 		}
-		srcs.goSrcs = libSrcs
-	default:
-		return fmt.Errorf("invalid test filter %q", testFilter)
+		goenv.Output = werror
 	}
 
-	return compileArchive(
+	var cgoOut *cgoOutputs
+	if cgoGenDir != "" {
+		cgoOut = &cgoOutputs{
+			genDir:      buildenv.Abs(cgoGenDir),
+			objDir:      buildenv.Abs(cgoObjDir),
+			importsPath: buildenv.Abs(cgoImportsPath),
+			objs:        cObjs,
+		}
+	}
+
+	err = compileArchive(
 		goenv,
 		importPath,
 		packagePath,
 		srcs,
+		embedSrcs,
+		embedRoots,
 		deps,
+		depSymabis,
 		coverMode,
 		coverSrcs,
 		cgoEnabled,
 		cc,
+		cgoOut,
 		gcFlags,
 		asmFlags,
+		trimpathPrefix,
 		cppFlags,
 		cFlags,
 		cxxFlags,
@@ -138,21 +190,65 @@ func compilePkg(args []string) error {
 		packageListPath,
 		outPath,
 		outFactsPath,
-		cgoExportHPath)
+		outFixPath,
+		outSARIFPath,
+		exportNogoSrcs,
+		outExportDataPath,
+		cgoExportHPath,
+		cgoConcurrency)
+	if err != nil {
+		return err
+	}
+	if werror != nil {
+		if err := werror.err(); err != nil {
+			return err
+		}
+	}
+
+	m := &actionMetadata{
+		Mnemonic:    "GoCompilePkg",
+		ImportPath:  importPath,
+		PackagePath: packagePath,
+		Inputs: map[string]int{
+			"srcs":     len(unfilteredSrcs),
+			"go":       len(srcs.goSrcs),
+			"c":        len(srcs.cSrcs) + len(srcs.cxxSrcs) + len(srcs.objcSrcs) + len(srcs.objcxxSrcs) + len(cObjs),
+			"asm":      len(srcs.sSrcs),
+			"headers":  len(srcs.hSrcs),
+			"embed":    len(embedSrcs),
+			"archives": len(deps),
+		},
+	}
+	for _, src := range srcs.goSrcs {
+		if src.isCgo {
+			m.Inputs["cgo"]++
+		}
+	}
+	m.addOutput("archive", outPath)
+	m.addOutput("export", outFactsPath)
+	m.addOutput("nogo_fix", outFixPath)
+	m.addOutput("nogo_sarif", outSARIFPath)
+	m.addOutput("export_data", outExportDataPath)
+	return writeActionMetadata(metadataPath, m)
 }
 
 func compileArchive(
-	goenv *env,
+	goenv *buildenv.Env,
 	importPath string,
 	packagePath string,
 	srcs archiveSrcs,
+	embedSrcs []string,
+	embedRoots []string,
 	deps []archive,
+	depSymabis []string,
 	coverMode string,
 	coverSrcs []string,
 	cgoEnabled bool,
 	cc string,
+	cgoOut *cgoOutputs,
 	gcFlags []string,
 	asmFlags []string,
+	trimpathPrefix string,
 	cppFlags []string,
 	cFlags []string,
 	cxxFlags []string,
@@ -163,9 +259,14 @@ func compileArchive(
 	packageListPath string,
 	outPath string,
 	outFactsPath string,
-	cgoExportHPath string) error {
+	outFixPath string,
+	outSARIFPath string,
+	exportNogoSrcs bool,
+	outExportDataPath string,
+	cgoExportHPath string,
+	cgoConcurrency int) error {
 
-	workDir, cleanup, err := goenv.workDir()
+	workDir, cleanup, err := goenv.WorkDir()
 	if err != nil {
 		return err
 	}
@@ -209,16 +310,27 @@ func compileArchive(
 	for i, src := range srcs.objcxxSrcs {
 		objcxxSrcs[i] = src.filename
 	}
-	sSrcs := make([]string, len(srcs.sSrcs))
-	for i, src := range srcs.sSrcs {
-		sSrcs[i] = src.filename
-	}
 	hSrcs := make([]string, len(srcs.hSrcs))
 	for i, src := range srcs.hSrcs {
 		hSrcs[i] = src.filename
 	}
 	haveCgo := len(cgoSrcs)+len(cSrcs)+len(cxxSrcs)+len(objcSrcs)+len(objcxxSrcs) > 0
 
+	// In packages that use cgo, the go command compiles assembly with the C
+	// toolchain. We also allow Go assembly in these packages, so only files
+	// without Go assembly directives are compiled with the C toolchain. The
+	// rest are assembled below, and only they contribute to the symabis file.
+	// If cgo ran in separate actions, GoCompileC already compiled the others.
+	var sSrcs []string
+	if cgoEnabled && (haveCgo || cgoOut != nil) {
+		if srcs.sSrcs, sSrcs, err = splitGoAssembly(srcs.sSrcs); err != nil {
+			return err
+		}
+	}
+
+	// nogo checks the sources as written, not as instrumented for coverage.
+	nogoSrcs := append([]string{}, goSrcs...)
+
 	// Instrument source files for coverage.
 	if coverMode != "" {
 		shouldCover := make(map[string]bool)
@@ -259,28 +371,49 @@ func compileArchive(
 	}
 
 	// If we have cgo, generate separate C and go files, and compile the
-	// C files.
-	var objFiles []string
-	if cgoEnabled && haveCgo {
-		// TODO(#2006): Compile .s and .S files with cgo2, not the Go assembler.
-		// If cgo is not enabled or we don't have other cgo sources, don't
-		// compile .S files.
+	// C files. If that was done by separate actions, use their outputs.
+	var objFiles, cgoGenSrcs []string
+	trimDir, trimPkgDir := ".", ""
+	if cgoEnabled && cgoOut != nil {
+		if cgoGenSrcs, err = cgoOut.goSrcs(); err != nil {
+			return err
+		}
+		goSrcs = append(goSrcs, cgoGenSrcs...)
+		nogoSrcs = append(nogoSrcs, cgoGenSrcs...)
+		if objFiles, err = cgoOut.objFiles(); err != nil {
+			return err
+		}
+	} else if cgoEnabled && haveCgo {
 		var srcDir string
-		srcDir, goSrcs, objFiles, err = cgo2(goenv, goSrcs, cgoSrcs, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, nil, hSrcs, packagePath, packageName, cc, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags, ldFlags, cgoExportHPath)
+		srcDir, goSrcs, objFiles, err = cgo2(goenv, goSrcs, cgoSrcs, cSrcs, cxxSrcs, objcSrcs, objcxxSrcs, sSrcs, hSrcs, packagePath, packageName, cc, cppFlags, cFlags, cxxFlags, objcFlags, objcxxFlags, ldFlags, cgoExportHPath, cgoConcurrency)
 		if err != nil {
 			return err
 		}
 
-		gcFlags = append(gcFlags, "-trimpath="+srcDir)
+		trimDir = srcDir
+		if len(srcs.goSrcs) > 0 {
+			trimPkgDir = filepath.Dir(srcs.goSrcs[0].filename)
+		}
 	} else {
 		if cgoExportHPath != "" {
 			if err := ioutil.WriteFile(cgoExportHPath, nil, 0666); err != nil {
 				return err
 			}
 		}
-		gcFlags = append(gcFlags, "-trimpath=.")
 	}
 
+	// Trim the execution root (or cgo source directory) from file names
+	// recorded in the archive, or rewrite them if a prefix was requested.
+	var trimSrcs []string
+	for _, src := range srcs.goSrcs {
+		trimSrcs = append(trimSrcs, src.filename)
+	}
+	for _, src := range srcs.sSrcs {
+		trimSrcs = append(trimSrcs, src.filename)
+	}
+	trimSrcs = append(trimSrcs, cgoGenSrcs...)
+	gcFlags = append(gcFlags, "-trimpath="+trimpathRewrites(trimDir, trimPkgDir, trimpathPrefix, trimSrcs))
+
 	// Check that the filtered sources don't import anything outside of
 	// the standard library and the direct dependencies.
 	imports, err := checkImports(srcs.goSrcs, deps, packageListPath)
@@ -312,7 +445,7 @@ func compileArchive(
 	}
 
 	// Build an importcfg file for the compiler.
-	importcfgPath, err := buildImportcfgFileForCompile(imports, goenv.installSuffix, filepath.Dir(outPath))
+	importcfgPath, err := buildImportcfgFileForCompile(imports, goenv.InstallSuffix, filepath.Dir(outPath))
 	if err != nil {
 		return err
 	}
@@ -324,7 +457,7 @@ func compileArchive(
 		ctx, cancel := context.WithCancel(context.Background())
 		nogoChan = make(chan error)
 		go func() {
-			nogoChan <- runNogo(ctx, workDir, nogoPath, goSrcs, deps, packagePath, importcfgPath, outFactsPath)
+			nogoChan <- runNogo(ctx, workDir, nogoPath, goSrcs, deps, packagePath, importcfgPath, outFactsPath, outFixPath, outSARIFPath, false)
 		}()
 		defer func() {
 			if nogoChan != nil {
@@ -346,12 +479,44 @@ func compileArchive(
 	if err != nil {
 		return err
 	}
+	if len(depSymabis) > 0 {
+		symabisPath, err = mergeSymabis(packagePath, symabisPath, depSymabis)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(symabisPath)
+	}
+
+	// Resolve //go:embed patterns, if there are any.
+	embedcfgPath, err := buildEmbedcfgFile(srcs.goSrcs, embedSrcs, embedRoots, workDir)
+	if err != nil {
+		return err
+	}
 
 	// Compile the filtered .go files.
-	if err := compileGo(goenv, goSrcs, packagePath, importcfgPath, asmHdrPath, symabisPath, gcFlags, outPath); err != nil {
+	if err := compileGo(goenv, goSrcs, packagePath, importcfgPath, embedcfgPath, asmHdrPath, symabisPath, gcFlags, outPath); err != nil {
 		return err
 	}
 
+	// Write the export data for packages that import this one, along with
+	// inputs for the nogo action, if it runs separately. Objects appended
+	// below don't contribute to it.
+	if outExportDataPath != "" {
+		var members []archiveMember
+		if exportNogoSrcs {
+			data, err := formatNogoSrcsList(nogoSrcs)
+			if err != nil {
+				return err
+			}
+			members = append(members, archiveMember{name: nogoSrcsMember, data: data})
+		}
+		if err := writeExportData(outPath, outExportDataPath, members...); err != nil {
+			return err
+		}
+	} else if exportNogoSrcs {
+		return errors.New("-nogo_srcs requires -export_data")
+	}
+
 	// Compile the .s files.
 	if len(srcs.sSrcs) > 0 {
 		includeSet := map[string]struct{}{
@@ -369,9 +534,10 @@ func compileArchive(
 		for _, inc := range includes {
 			asmFlags = append(asmFlags, "-I", inc)
 		}
+		asmTrimpath := trimpathRewrites(".", "", trimpathPrefix, trimSrcs)
 		for i, sSrc := range srcs.sSrcs {
 			obj := filepath.Join(workDir, fmt.Sprintf("s%d.o", i))
-			if err := asmFile(goenv, sSrc.filename, asmFlags, obj); err != nil {
+			if err := asmFile(goenv, sSrc.filename, asmFlags, asmTrimpath, obj); err != nil {
 				return err
 			}
 			objFiles = append(objFiles, obj)
@@ -398,9 +564,39 @@ func compileArchive(
 	return nil
 }
 
-func compileGo(goenv *env, srcs []string, packagePath, importcfgPath, asmHdrPath, symabisPath string, gcFlags []string, outPath string) error {
-	args := goenv.goTool("compile")
+// applyTestFilter removes Go files from srcs depending on whether they belong
+// to an external test package. testFilter may be "off", "only", or "exclude".
+func applyTestFilter(srcs *archiveSrcs, testFilter string) error {
+	switch testFilter {
+	case "off":
+	case "only":
+		testSrcs := make([]fileInfo, 0, len(srcs.goSrcs))
+		for _, f := range srcs.goSrcs {
+			if strings.HasSuffix(f.pkg, "_test") {
+				testSrcs = append(testSrcs, f)
+			}
+		}
+		srcs.goSrcs = testSrcs
+	case "exclude":
+		libSrcs := make([]fileInfo, 0, len(srcs.goSrcs))
+		for _, f := range srcs.goSrcs {
+			if !strings.HasSuffix(f.pkg, "_test") {
+				libSrcs = append(libSrcs, f)
+			}
+		}
+		srcs.goSrcs = libSrcs
+	default:
+		return fmt.Errorf("invalid test filter %q", testFilter)
+	}
+	return nil
+}
+
+func compileGo(goenv *buildenv.Env, srcs []string, packagePath, importcfgPath, embedcfgPath, asmHdrPath, symabisPath string, gcFlags []string, outPath string) error {
+	args := goenv.GoTool("compile")
 	args = append(args, "-p", packagePath, "-importcfg", importcfgPath, "-pack")
+	if embedcfgPath != "" {
+		args = append(args, "-embedcfg", embedcfgPath)
+	}
 	if asmHdrPath != "" {
 		args = append(args, "-asmhdr", asmHdrPath)
 	}
@@ -411,11 +607,11 @@ func compileGo(goenv *env, srcs []string, packagePath, importcfgPath, asmHdrPath
 	args = append(args, "-o", outPath)
 	args = append(args, "--")
 	args = append(args, srcs...)
-	absArgs(args, []string{"-I", "-o", "-trimpath", "-importcfg"})
-	return goenv.runCommand(args)
+	buildenv.AbsArgs(args, []string{"-I", "-o", "-importcfg"})
+	return goenv.RunCommand(args)
 }
 
-func runNogo(ctx context.Context, workDir string, nogoPath string, srcs []string, deps []archive, packagePath, importcfgPath, outFactsPath string) error {
+func runNogo(ctx context.Context, workDir string, nogoPath string, srcs []string, deps []archive, packagePath, importcfgPath, outFactsPath, outFixPath, outSARIFPath string, factsOnly bool) error {
 	args := []string{nogoPath}
 	args = append(args, "-p", packagePath)
 	args = append(args, "-importcfg", importcfgPath)
@@ -424,7 +620,18 @@ func runNogo(ctx context.Context, workDir string, nogoPath string, srcs []string
 			args = append(args, "-fact", fmt.Sprintf("%s=%s", dep.importPath, dep.xFile))
 		}
 	}
-	args = append(args, "-x", outFactsPath)
+	if outFactsPath != "" {
+		args = append(args, "-x", outFactsPath)
+	}
+	if factsOnly {
+		args = append(args, "-facts_only")
+	}
+	if outFixPath != "" {
+		args = append(args, "-fix", outFixPath)
+	}
+	if outSARIFPath != "" {
+		args = append(args, "-sarif", outSARIFPath)
+	}
 	args = append(args, srcs...)
 
 	paramFile := filepath.Join(workDir, "nogo.param")
@@ -450,6 +657,11 @@ func runNogo(ctx context.Context, workDir string, nogoPath string, srcs []string
 			return fmt.Errorf("error running nogo: %v", err)
 		}
 	}
+	if out.Len() != 0 {
+		// When writing fixes or a SARIF report, nogo reports findings
+		// without failing.
+		fmt.Fprint(os.Stderr, out.String())
+	}
 	return nil
 }
 
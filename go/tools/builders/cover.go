@@ -24,12 +24,14 @@ import (
 	"go/token"
 	"io/ioutil"
 	"strconv"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 // cover transforms a source file with "go tool cover". It is invoked by the
 // Go rules as an action.
 func cover(args []string) error {
-	args, err := readParamsFiles(args)
+	args, err := buildenv.ReadParamsFiles(args)
 	if err != nil {
 		return err
 	}
@@ -40,11 +42,11 @@ func cover(args []string) error {
 	flags.StringVar(&origSrc, "src", "", "original source file")
 	flags.StringVar(&srcName, "srcname", "", "source name printed in coverage data")
 	flags.StringVar(&mode, "mode", "set", "coverage mode to use")
-	goenv := envFlags(flags)
+	goenv := buildenv.EnvFlags(flags)
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
-	if err := goenv.checkFlags(); err != nil {
+	if err := goenv.CheckFlags(); err != nil {
 		return err
 	}
 	if coverSrc == "" {
@@ -66,9 +68,9 @@ func cover(args []string) error {
 // instrumentForCoverage runs "go tool cover" on a source file to produce
 // a coverage-instrumented version of the file. It also registers the file
 // with the coverdata package.
-func instrumentForCoverage(goenv *env, srcPath, srcName, coverVar, mode, outPath string) error {
-	goargs := goenv.goTool("cover", "-var", coverVar, "-mode", mode, "-o", outPath, srcPath)
-	if err := goenv.runCommand(goargs); err != nil {
+func instrumentForCoverage(goenv *buildenv.Env, srcPath, srcName, coverVar, mode, outPath string) error {
+	goargs := goenv.GoTool("cover", "-var", coverVar, "-mode", mode, "-o", outPath, srcPath)
+	if err := goenv.RunCommand(goargs); err != nil {
 		return err
 	}
 
@@ -0,0 +1,347 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// buildEmbedcfgFile writes an embedcfg file to be read by the compiler.
+// An embedcfg file is needed (Go 1.16 or higher) when a package has
+// //go:embed directives. It maps each pattern to the files it matches and
+// each file to its location on disk.
+//
+// Patterns are evaluated relative to the directory containing the .go files,
+// with the same semantics as the go command. Since Bazel places source and
+// generated files in different trees, that directory is looked up in each
+// of embedRoots, and the matching parts of embedSrcs are merged. embedSrcs
+// may include directories, which are walked.
+//
+// The embedcfg file is created in workDir, and its name is returned. If no
+// embedcfg file is needed, "" is returned with no error.
+func buildEmbedcfgFile(goSrcs []fileInfo, embedSrcs, embedRoots []string, workDir string) (string, error) {
+	// Find the directory containing the files with //go:embed directives.
+	var embeds []fileEmbed
+	pkgDir, pkgDirSrc := "", ""
+	for _, src := range goSrcs {
+		if len(src.embeds) == 0 {
+			continue
+		}
+		dir, err := relToEmbedRoot(filepath.Dir(src.filename), embedRoots)
+		if err != nil {
+			return "", err
+		}
+		if pkgDirSrc != "" && dir != pkgDir {
+			return "", fmt.Errorf("%s and %s both have //go:embed directives but are in different directories", pkgDirSrc, src.filename)
+		}
+		pkgDir, pkgDirSrc = dir, src.filename
+		embeds = append(embeds, src.embeds...)
+	}
+	if len(embeds) == 0 {
+		return "", nil
+	}
+
+	tree, err := newEmbedTree(pkgDir, embedSrcs, embedRoots)
+	if err != nil {
+		return "", err
+	}
+
+	cfg := struct {
+		Patterns map[string][]string
+		Files    map[string]string
+	}{
+		Patterns: make(map[string][]string),
+		Files:    make(map[string]string),
+	}
+	for _, e := range embeds {
+		if _, ok := cfg.Patterns[e.pattern]; ok {
+			continue
+		}
+		files, err := tree.resolve(e.pattern)
+		if err != nil {
+			return "", fmt.Errorf("%s: pattern %s: %v", e.pos, e.pattern, err)
+		}
+		cfg.Patterns[e.pattern] = files
+		for _, f := range files {
+			cfg.Files[f] = tree.files[f]
+		}
+	}
+
+	data, err := json.MarshalIndent(&cfg, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	embedcfgPath := filepath.Join(workDir, "embedcfg")
+	if err := ioutil.WriteFile(embedcfgPath, data, 0666); err != nil {
+		return "", err
+	}
+	return embedcfgPath, nil
+}
+
+// relToEmbedRoot returns p relative to the longest of roots that contains it,
+// as a slash-separated path.
+func relToEmbedRoot(p string, roots []string) (string, error) {
+	rel, found := "", false
+	bestRoot := ""
+	for _, root := range roots {
+		var r string
+		if p == root {
+			r = ""
+		} else if strings.HasPrefix(p, root+string(filepath.Separator)) {
+			r = p[len(root)+1:]
+		} else {
+			continue
+		}
+		if !found || len(root) > len(bestRoot) {
+			rel, found, bestRoot = r, true, root
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("%s is not in any embed root", p)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// embedTree is a view of the files that may be embedded, as they would
+// appear in a single package directory.
+type embedTree struct {
+	// files maps slash-separated paths relative to the package directory
+	// to paths on disk.
+	files map[string]string
+
+	// dirs is the set of directories containing files, relative to the
+	// package directory. The package directory itself is not included.
+	dirs map[string]bool
+
+	// paths is a sorted list of the keys in files and dirs.
+	paths []string
+}
+
+func newEmbedTree(pkgDir string, embedSrcs, embedRoots []string) (*embedTree, error) {
+	t := &embedTree{
+		files: make(map[string]string),
+		dirs:  make(map[string]bool),
+	}
+	add := func(rel, file string) error {
+		if other, ok := t.files[rel]; ok && other != file {
+			return fmt.Errorf("embedded file %s is provided by both %s and %s", rel, other, file)
+		}
+		t.files[rel] = file
+		for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+			t.dirs[dir] = true
+		}
+		return nil
+	}
+	for _, src := range embedSrcs {
+		rel, err := relToEmbedRoot(src, embedRoots)
+		if err != nil {
+			return nil, err
+		}
+		if pkgDir != "" {
+			if !strings.HasPrefix(rel, pkgDir+"/") {
+				// Not in the package directory, so no valid pattern could match it.
+				continue
+			}
+			rel = rel[len(pkgDir)+1:]
+		}
+		info, err := os.Stat(src)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			if err := add(rel, src); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := addEmbedDir(rel, src, add); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	for f := range t.files {
+		t.paths = append(t.paths, f)
+	}
+	for d := range t.dirs {
+		t.paths = append(t.paths, d)
+	}
+	sort.Strings(t.paths)
+	return t, nil
+}
+
+// addEmbedDir calls add for each file in the directory dir, which is rel
+// relative to the package directory.
+//
+// dir may be a symbolic link, as it is in a sandbox, and so may the files
+// in it. Links to directories inside dir aren't followed. In a source
+// directory, those are usually Bazel's convenience links like bazel-bin,
+// which lead to output trees that shouldn't be embedded. Other files Bazel
+// ignores, like those under directories listed in .bazelignore, can't be
+// told apart here, since .bazelignore isn't an input of the action.
+func addEmbedDir(rel, dir string, add func(rel, file string) error) error {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if info, err = os.Stat(p); err != nil {
+				return nil // dangling link
+			}
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return add(path.Join(rel, filepath.ToSlash(p[len(root)+1:])), filepath.Join(dir, p[len(root)+1:]))
+	})
+}
+
+// resolve returns the sorted list of files matched by an embed pattern,
+// following the rules of the go command. Hidden files (starting with '.' or
+// '_') inside matched directories are only included if the pattern has the
+// "all:" prefix. Version control directories and nested modules are never
+// included.
+func (t *embedTree) resolve(pattern string) ([]string, error) {
+	glob := pattern
+	all := strings.HasPrefix(pattern, "all:")
+	if all {
+		glob = pattern[len("all:"):]
+	}
+	if !validEmbedPattern(glob) {
+		return nil, errors.New("invalid pattern syntax")
+	}
+
+	var matches []string
+	for _, p := range t.paths {
+		match, err := path.Match(glob, p)
+		if err != nil {
+			return nil, err
+		}
+		if match {
+			matches = append(matches, p)
+		}
+	}
+
+	have := make(map[string]bool)
+	var list []string
+	for _, m := range matches {
+		what := "file"
+		if t.dirs[m] {
+			what = "directory"
+		}
+		for dir := m; dir != "."; dir = path.Dir(dir) {
+			if _, ok := t.files[path.Join(dir, "go.mod")]; ok {
+				return nil, fmt.Errorf("cannot embed %s %s: in different module", what, m)
+			}
+			if elem := path.Base(dir); isBadEmbedName(elem) {
+				if dir == m {
+					return nil, fmt.Errorf("cannot embed %s %s: invalid name %s", what, m, elem)
+				}
+				return nil, fmt.Errorf("cannot embed %s %s: in invalid directory %s", what, m, elem)
+			}
+		}
+
+		if !t.dirs[m] {
+			if !have[m] {
+				have[m] = true
+				list = append(list, m)
+			}
+			continue
+		}
+
+		count := 0
+		for _, p := range t.paths {
+			if !strings.HasPrefix(p, m+"/") || t.dirs[p] || t.skipInDir(m, p, all) {
+				continue
+			}
+			count++
+			if !have[p] {
+				have[p] = true
+				list = append(list, p)
+			}
+		}
+		if count == 0 {
+			return nil, fmt.Errorf("cannot embed directory %s: contains no embeddable files", m)
+		}
+	}
+	if len(list) == 0 {
+		return nil, errors.New("no matching files found")
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// skipInDir returns whether the file p should be left out when the
+// directory dir is embedded. Files are left out if they or any directory
+// between dir and p have a bad name, are hidden (unless all is set), or
+// are part of a different module.
+func (t *embedTree) skipInDir(dir, p string, all bool) bool {
+	for q := p; q != dir; q = path.Dir(q) {
+		name := path.Base(q)
+		if isBadEmbedName(name) || (!all && (name[0] == '.' || name[0] == '_')) {
+			return true
+		}
+		if q != p {
+			if _, ok := t.files[path.Join(q, "go.mod")]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validEmbedPattern reports whether pattern is a valid //go:embed pattern
+// after the "all:" prefix is removed. Patterns must be unrooted,
+// slash-separated paths without "." or ".." elements.
+func validEmbedPattern(pattern string) bool {
+	if pattern == "" || pattern == "." {
+		return false
+	}
+	for _, elem := range strings.Split(pattern, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// isBadEmbedName reports whether name is the name of a file or directory
+// that should never be embedded: version control directories, and names that
+// can't appear in module zip files.
+func isBadEmbedName(name string) bool {
+	switch name {
+	case "", ".bzr", ".hg", ".git", ".svn":
+		return true
+	}
+	for _, r := range name {
+		if r < ' ' || r == 0x7f || strings.ContainsRune("\"'*<>?`|:\\", r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,292 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestParseGoEmbed(t *testing.T) {
+	for _, tc := range []struct {
+		args    string
+		want    []string
+		wantErr bool
+	}{
+		{args: " a b\tc", want: []string{"a", "b", "c"}},
+		{args: ` "a b" ` + "`c d`", want: []string{"a b", "c d"}},
+		{args: ` "a\"b"`, want: []string{`a"b`}},
+		{args: ` "a`, wantErr: true},
+		{args: ` "a"b`, wantErr: true},
+	} {
+		got, err := parseGoEmbed(tc.args)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseGoEmbed(%q): got %q; want error", tc.args, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseGoEmbed(%q): %v", tc.args, err)
+		} else if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("parseGoEmbed(%q): got %q; want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+// The expectations below follow the behavior of "go build" for the same
+// directory layout.
+func TestBuildEmbedcfgFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestBuildEmbedcfgFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	srcRoot := filepath.Join(dir, "src")
+	genRoot := filepath.Join(dir, "bin")
+	var embedSrcs []string
+	for _, f := range []string{
+		"src/pkg/a.txt",
+		"src/pkg/.hidden",
+		"src/pkg/_underscore",
+		"src/pkg/static/index.html",
+		"src/pkg/static/.dotfile",
+		"src/pkg/static/_partial.html",
+		"src/pkg/static/.git/config",
+		"src/pkg/static/img/logo.png",
+		"src/pkg/static/mod/go.mod",
+		"src/pkg/static/mod/x.txt",
+		"src/pkg/empty/.keep",
+		"src/pkg/sub/go.mod",
+		"src/pkg/sub/y.txt",
+		"src/other/z.txt",
+		"bin/pkg/gen.txt",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		embedSrcs = append(embedSrcs, path)
+	}
+	embedRoots := []string{srcRoot, genRoot}
+	goSrc := filepath.Join(srcRoot, "pkg", "pkg.go")
+
+	for _, tc := range []struct {
+		desc, pattern string
+		want          []string
+		wantErr       string
+	}{
+		{
+			desc:    "file",
+			pattern: "a.txt",
+			want:    []string{"a.txt"},
+		}, {
+			desc:    "generated_file",
+			pattern: "gen.txt",
+			want:    []string{"gen.txt"},
+		}, {
+			desc:    "glob",
+			pattern: "*.txt",
+			want:    []string{"a.txt", "gen.txt"},
+		}, {
+			desc:    "glob_matches_hidden",
+			pattern: ".h*",
+			want:    []string{".hidden"},
+		}, {
+			desc:    "dir",
+			pattern: "static",
+			want:    []string{"static/img/logo.png", "static/index.html"},
+		}, {
+			desc:    "dir_all",
+			pattern: "all:static",
+			want:    []string{"static/.dotfile", "static/_partial.html", "static/img/logo.png", "static/index.html"},
+		}, {
+			desc:    "dir_glob",
+			pattern: "st*",
+			want:    []string{"static/img/logo.png", "static/index.html"},
+		}, {
+			desc:    "explicit_hidden_in_dir",
+			pattern: "static/_partial.html",
+			want:    []string{"static/_partial.html"},
+		}, {
+			desc:    "empty_dir",
+			pattern: "empty",
+			wantErr: "contains no embeddable files",
+		}, {
+			desc:    "empty_dir_all",
+			pattern: "all:empty",
+			want:    []string{"empty/.keep"},
+		}, {
+			desc:    "vcs",
+			pattern: "all:static/.git",
+			wantErr: "invalid name .git",
+		}, {
+			desc:    "module",
+			pattern: "sub",
+			wantErr: "in different module",
+		}, {
+			desc:    "module_file",
+			pattern: "sub/y.txt",
+			wantErr: "in different module",
+		}, {
+			desc:    "no_match",
+			pattern: "missing",
+			wantErr: "no matching files found",
+		}, {
+			desc:    "outside_package",
+			pattern: "../other/z.txt",
+			wantErr: "invalid pattern syntax",
+		}, {
+			desc:    "dot",
+			pattern: ".",
+			wantErr: "invalid pattern syntax",
+		}, {
+			desc:    "bad_glob",
+			pattern: "[",
+			wantErr: "syntax error in pattern",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			workDir := filepath.Join(dir, "work", tc.desc)
+			if err := os.MkdirAll(workDir, 0777); err != nil {
+				t.Fatal(err)
+			}
+			goSrcs := []fileInfo{{
+				filename: goSrc,
+				embeds:   []fileEmbed{{pattern: tc.pattern}},
+			}}
+			path, err := buildEmbedcfgFile(goSrcs, embedSrcs, embedRoots, workDir)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("got error %v; want error containing %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var cfg struct {
+				Patterns map[string][]string
+				Files    map[string]string
+			}
+			if err := json.Unmarshal(data, &cfg); err != nil {
+				t.Fatal(err)
+			}
+			if got := cfg.Patterns[tc.pattern]; !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %q; want %q", got, tc.want)
+			}
+			for _, f := range tc.want {
+				if _, err := os.Stat(cfg.Files[f]); err != nil {
+					t.Errorf("file %s: %v", f, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildEmbedcfgFileNoEmbeds(t *testing.T) {
+	path, err := buildEmbedcfgFile([]fileInfo{{filename: "/src/pkg/pkg.go"}}, nil, []string{"/src"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "" {
+		t.Errorf("got %q; want no embedcfg file", path)
+	}
+}
+
+func TestBuildEmbedcfgFileDirLinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links may not be supported")
+	}
+	dir, err := ioutil.TempDir("", "TestBuildEmbedcfgFileDirLinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The embedded directory is a link into the workspace, as in a sandbox.
+	// It has a link to a file, which is embedded, and a convenience link to
+	// an output tree, which isn't.
+	for _, f := range []string{
+		"workspace/pkg/static/index.html",
+		"workspace/pkg/target.txt",
+		"out/bin/pkg/gen.txt",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"sandbox/pkg/static":                "workspace/pkg/static",
+		"workspace/pkg/static/linked.txt":   "workspace/pkg/target.txt",
+		"workspace/pkg/static/bazel-bin":    "out/bin",
+		"workspace/pkg/static/dangling.txt": "missing.txt",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(link))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(dir, filepath.FromSlash(target)), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root := filepath.Join(dir, "sandbox")
+	static := filepath.Join(root, "pkg", "static")
+	goSrcs := []fileInfo{{
+		filename: filepath.Join(root, "pkg", "pkg.go"),
+		embeds:   []fileEmbed{{pattern: "static"}},
+	}}
+	path, err := buildEmbedcfgFile(goSrcs, []string{static}, []string{root}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cfg struct {
+		Patterns map[string][]string
+		Files    map[string]string
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"static/index.html", "static/linked.txt"}
+	if got := cfg.Patterns["static"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if got, want := cfg.Files["static/index.html"], filepath.Join(static, "index.html"); got != want {
+		t.Errorf("got file %s; want %s", got, want)
+	}
+}
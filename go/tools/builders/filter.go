@@ -33,6 +33,13 @@ type fileInfo struct {
 	isCgo    bool
 	pkg      string
 	imports  []string
+	embeds   []fileEmbed
+}
+
+// fileEmbed is a pattern from a //go:embed directive.
+type fileEmbed struct {
+	pos     token.Position
+	pattern string
 }
 
 type ext int
@@ -165,13 +172,106 @@ func readFileInfo(bctx build.Context, input string, needPackage bool) (fileInfo,
 	// matched if cgo is enabled or the file is not cgo
 	fi.matched = fi.matched && (bctx.CgoEnabled || !fi.isCgo)
 
+	importsEmbed := false
 	for _, i := range parsed.Imports {
 		path, err := strconv.Unquote(i.Path.Value)
 		if err != nil {
 			return fi, err
 		}
 		fi.imports = append(fi.imports, path)
+		if path == "embed" {
+			importsEmbed = true
+		}
+	}
+
+	// //go:embed directives may only be used in files that import "embed".
+	// Only parse the rest of those files.
+	if importsEmbed {
+		if fi.embeds, err = readEmbeds(input); err != nil {
+			return fi, err
+		}
 	}
 
 	return fi, nil
 }
+
+// readEmbeds returns the patterns in //go:embed directives in a Go file.
+func readEmbeds(input string) ([]fileEmbed, error) {
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, input, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var embeds []fileEmbed
+	for _, cg := range parsed.Comments {
+		for _, c := range cg.List {
+			if !strings.HasPrefix(c.Text, "//go:embed") {
+				continue
+			}
+			args := c.Text[len("//go:embed"):]
+			if args != "" && args[0] != ' ' && args[0] != '\t' {
+				// Some other directive, like //go:embedfoo.
+				continue
+			}
+			pos := fset.Position(c.Slash)
+			patterns, err := parseGoEmbed(args)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", pos, err)
+			}
+			for _, pattern := range patterns {
+				embeds = append(embeds, fileEmbed{pos: pos, pattern: pattern})
+			}
+		}
+	}
+	return embeds, nil
+}
+
+// parseGoEmbed splits the arguments of a //go:embed directive into patterns.
+// Patterns are separated by spaces and may be quoted with double quotes or
+// back quotes, like Go string literals.
+func parseGoEmbed(args string) ([]string, error) {
+	var patterns []string
+	for args = strings.TrimSpace(args); args != ""; args = strings.TrimSpace(args) {
+		var pattern string
+		switch args[0] {
+		default:
+			i := strings.IndexAny(args, " \t")
+			if i < 0 {
+				i = len(args)
+			}
+			pattern, args = args[:i], args[i:]
+
+		case '`':
+			i := strings.IndexByte(args[1:], '`')
+			if i < 0 {
+				return nil, fmt.Errorf("invalid quoted string in //go:embed: %s", args)
+			}
+			pattern, args = args[1:1+i], args[2+i:]
+
+		case '"':
+			i := 1
+			for ; i < len(args); i++ {
+				if args[i] == '\\' {
+					i++
+					continue
+				}
+				if args[i] == '"' {
+					break
+				}
+			}
+			if i >= len(args) {
+				return nil, fmt.Errorf("invalid quoted string in //go:embed: %s", args)
+			}
+			q, err := strconv.Unquote(args[:i+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid quoted string in //go:embed: %s", args[:i+1])
+			}
+			pattern, args = q, args[i+1:]
+		}
+		if args != "" && args[0] != ' ' && args[0] != '\t' {
+			return nil, fmt.Errorf("invalid quoted string in //go:embed: %s", pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
@@ -23,7 +23,29 @@ import (
 
 // filterBuildID executes the tool on the command line, filtering out any
 // -buildid arguments. It is intended to be used with -toolexec.
+//
+// If the arguments start with -prebuilt and the path of a file written by
+// writeStdlibShardImportcfg, packages listed in that file aren't compiled
+// again. See usePrebuiltArchive.
 func filterBuildID(args []string) error {
+	var prebuilt map[string]string
+	if len(args) > 2 && args[0] == "-prebuilt" {
+		var err error
+		if prebuilt, err = readStdlibShardImportcfg(args[1]); err != nil {
+			return err
+		}
+		args = args[2:]
+	}
+	if prebuilt != nil {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		if args, err = usePrebuiltArchive(args, dir, prebuilt); args == nil || err != nil {
+			return err
+		}
+	}
+
 	newArgs := make([]string, 0, len(args))
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
@@ -17,8 +17,6 @@ package main
 import (
 	"errors"
 	"fmt"
-	"go/build"
-	"strings"
 	"unicode"
 )
 
@@ -119,17 +117,3 @@ func splitQuoted(s string) (r []string, err error) {
 	}
 	return args, err
 }
-
-// tagFlag adds tags to the build.Default context. Tags are expected to be
-// formatted as a comma-separated list.
-type tagFlag struct{}
-
-func (f *tagFlag) String() string {
-	return strings.Join(build.Default.BuildTags, ",")
-}
-
-func (f *tagFlag) Set(opt string) error {
-	tags := strings.Split(opt, ",")
-	build.Default.BuildTags = append(build.Default.BuildTags, tags...)
-	return nil
-}
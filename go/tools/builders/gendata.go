@@ -0,0 +1,209 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// dataTemplateData is the value go_data templates are executed with.
+type dataTemplateData struct {
+	// Label is the label of the go_data target.
+	Label string
+
+	// Package is the name of the Go package to generate.
+	Package string
+
+	// Var is the name of the variable to declare.
+	Var string
+
+	// Type is the Go type of each entry's contents: "[]byte" or "string".
+	Type string
+
+	// Compression is "gzip" if contents are compressed, or "" otherwise.
+	Compression string
+
+	// Single is true if Var holds the contents of the only entry, rather than
+	// a map from keys to contents.
+	Single bool
+
+	// Entries lists the embedded files and values, in the order they were
+	// given.
+	Entries []dataEntry
+}
+
+type dataEntry struct {
+	// Key is the map key for the entry.
+	Key string
+
+	// Literal is a Go expression of type Type with the entry's contents,
+	// compressed if Compression is set.
+	Literal string
+
+	// Size is the length of the contents before compression.
+	Size int
+}
+
+var dataTemplateFuncs = template.FuncMap{"quote": strconv.Quote}
+
+var defaultDataTemplate = `// Code generated by go_data for {{.Label}}. DO NOT EDIT.
+
+package {{.Package}}
+{{if .Single}}
+var {{.Var}} = {{(index .Entries 0).Literal}}
+{{else}}
+var {{.Var}} = map[string]{{.Type}}{
+{{- range .Entries}}
+	{{quote .Key}}: {{.Literal}},
+{{- end}}
+}
+{{end}}`
+
+// genData generates a Go source file declaring a variable that holds the
+// contents of files, for go_data. The file is generated from a text/template,
+// which may be provided with -template, and formatted with gofmt.
+func genData(args []string) error {
+	args, err := buildenv.ReadParamsFiles(args)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("GoData", flag.ExitOnError)
+	_ = buildenv.EnvFlags(fs)
+	var files multiFlag
+	d := dataTemplateData{}
+	var dataType, templatePath, outPath string
+	fs.StringVar(&d.Label, "label", "", "Label of the go_data target")
+	fs.StringVar(&d.Package, "package", "", "Name of the Go package to generate")
+	fs.StringVar(&d.Var, "var", "", "Name of the variable to declare")
+	fs.StringVar(&dataType, "type", "bytes", "Type of each entry: bytes or string")
+	fs.StringVar(&d.Compression, "compression", "", "How to compress contents: gzip, or empty for none")
+	fs.BoolVar(&d.Single, "single", false, "Whether to declare a single value instead of a map")
+	fs.Var(&files, "file", "An entry, as key=path")
+	fs.StringVar(&templatePath, "template", "", "Template to generate the file from, instead of the default")
+	fs.StringVar(&outPath, "o", "", "Go file to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if d.Package == "" || d.Var == "" || outPath == "" {
+		return errors.New("-package, -var, and -o must be set")
+	}
+	switch dataType {
+	case "bytes":
+		d.Type = "[]byte"
+	case "string":
+		d.Type = "string"
+	default:
+		return fmt.Errorf("unknown -type %q; want bytes or string", dataType)
+	}
+	if d.Compression != "" && d.Compression != "gzip" {
+		return fmt.Errorf("unknown -compression %q; want gzip", d.Compression)
+	}
+	if d.Single && len(files) != 1 {
+		return fmt.Errorf("-single requires exactly one entry; got %d", len(files))
+	}
+
+	text := defaultDataTemplate
+	if templatePath != "" {
+		data, err := ioutil.ReadFile(templatePath)
+		if err != nil {
+			return err
+		}
+		text = string(data)
+	}
+	tmpl, err := template.New("go_data").Funcs(dataTemplateFuncs).Parse(text)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[string]string)
+	for _, f := range files {
+		i := strings.IndexByte(f, '=')
+		if i < 0 {
+			return fmt.Errorf("badly formed -file %q; want key=path", f)
+		}
+		key, path := f[:i], f[i+1:]
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("%s and %s have the same key %q", other, path, key)
+		}
+		seen[key] = path
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		entry, err := newDataEntry(key, contents, d.Type, d.Compression)
+		if err != nil {
+			return err
+		}
+		d.Entries = append(d.Entries, entry)
+	}
+
+	out, err := renderDataTemplate(tmpl, d)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(outPath, out, 0666)
+}
+
+// newDataEntry returns an entry for contents, compressing them if needed.
+func newDataEntry(key string, contents []byte, typ, compression string) (dataEntry, error) {
+	e := dataEntry{Key: key, Size: len(contents)}
+	if compression == "gzip" {
+		// The gzip header has no name or modification time, so the output
+		// doesn't change between builds.
+		buf := &bytes.Buffer{}
+		zw, err := gzip.NewWriterLevel(buf, gzip.BestCompression)
+		if err != nil {
+			return dataEntry{}, err
+		}
+		if _, err := zw.Write(contents); err != nil {
+			return dataEntry{}, err
+		}
+		if err := zw.Close(); err != nil {
+			return dataEntry{}, err
+		}
+		contents = buf.Bytes()
+	}
+	e.Literal = strconv.Quote(string(contents))
+	if typ == "[]byte" {
+		e.Literal = "[]byte(" + e.Literal + ")"
+	}
+	return e, nil
+}
+
+// renderDataTemplate executes tmpl with d and formats the result. Templates
+// that don't produce valid Go are reported with the generated source, which
+// is easier to debug than the template.
+func renderDataTemplate(tmpl *template.Template, d dataTemplateData) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, d); err != nil {
+		return nil, err
+	}
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("template produced invalid Go source: %v\n%s", err, buf.Bytes())
+	}
+	return out, nil
+}
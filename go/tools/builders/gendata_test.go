@@ -0,0 +1,155 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestGenData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestGenData")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	a := write("a.txt", "hello\n")
+	b := write("b.bin", "\x00\"\\")
+	tmpl := write("custom.tmpl", `package {{.Package}}
+
+const {{.Var}}Count = {{len .Entries}}
+`)
+
+	for _, test := range []struct {
+		desc    string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{
+			desc: "map",
+			args: []string{"-file", "a.txt=" + a, "-file", "x/b.bin=" + b},
+			want: `// Code generated by go_data for //:data. DO NOT EDIT.
+
+package data
+
+var Data = map[string][]byte{
+	"a.txt":   []byte("hello\n"),
+	"x/b.bin": []byte("\x00\"\\"),
+}
+`,
+		}, {
+			desc: "single_string",
+			args: []string{"-single", "-type", "string", "-file", "a.txt=" + a},
+			want: `// Code generated by go_data for //:data. DO NOT EDIT.
+
+package data
+
+var Data = "hello\n"
+`,
+		}, {
+			desc: "template",
+			args: []string{"-template", tmpl, "-file", "a.txt=" + a, "-file", "b.bin=" + b},
+			want: `package data
+
+const DataCount = 2
+`,
+		}, {
+			desc:    "duplicate_key",
+			args:    []string{"-file", "a=" + a, "-file", "a=" + b},
+			wantErr: `have the same key "a"`,
+		}, {
+			desc:    "single_with_two",
+			args:    []string{"-single", "-file", "a=" + a, "-file", "b=" + b},
+			wantErr: "exactly one entry",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			out := filepath.Join(dir, test.desc+".go")
+			args := append([]string{"-label", "//:data", "-package", "data", "-var", "Data", "-o", out}, test.args...)
+			err := genData(args)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("got error %v; want error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNewDataEntryGzip(t *testing.T) {
+	e, err := newDataEntry("k", []byte("hello, world"), "string", "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Size != len("hello, world") {
+		t.Errorf("got size %d; want %d", e.Size, len("hello, world"))
+	}
+	compressed, err := strconv.Unquote(e.Literal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(strings.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello, world" {
+		t.Errorf("got %q; want %q", got, "hello, world")
+	}
+
+	again, err := newDataEntry("k", []byte("hello, world"), "string", "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Literal != e.Literal {
+		t.Error("compressed contents are not deterministic")
+	}
+}
+
+func TestRenderDataTemplateInvalid(t *testing.T) {
+	tmpl := template.Must(template.New("bad").Parse("package {{.Package}}\n\nvar = {{.Var}}\n"))
+	_, err := renderDataTemplate(tmpl, dataTemplateData{Package: "data", Var: "Data"})
+	if err == nil || !strings.Contains(err.Error(), "invalid Go source") {
+		t.Errorf("got error %v; want invalid Go source error", err)
+	}
+}
@@ -27,6 +27,7 @@ import (
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"text/template"
 )
 
@@ -73,10 +74,27 @@ var configs = map[string]config{
 			{{printf "regexp.MustCompile(%q)" $path}},
 			{{- end}}
 		},
+		{{- end -}}
+		{{- if $config.ExcludeGenerated}}
+		excludeGenerated: true,
+		{{- end -}}
+		{{- if $config.AnalyzerFlags}}
+		analyzerFlags: map[string]string{
+			{{- range $flag, $value := $config.AnalyzerFlags}}
+			{{printf "%q" $flag}}: {{printf "%q" $value}},
+			{{- end}}
+		},
 		{{- end}}
 	},
 {{- end}}
 }
+
+// baseline contains known findings that are not reported.
+var baseline = map[baselineEntry]bool{
+{{- range .Baseline}}
+	{file: {{printf "%q" .File}}, analyzer: {{printf "%q" .Analyzer}}, hash: {{printf "%q" .Hash}}}: true,
+{{- end}}
+}
 `
 
 func genNogoMain(args []string) error {
@@ -85,6 +103,7 @@ func genNogoMain(args []string) error {
 	out := flags.String("output", "", "output file to write (defaults to stdout)")
 	flags.Var(&analyzerImportPaths, "analyzer_importpath", "import path of an analyzer library")
 	configFile := flags.String("config", "", "nogo config file")
+	baselineFile := flags.String("baseline", "", "file listing known findings that should not be reported")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
@@ -109,6 +128,24 @@ func genNogoMain(args []string) error {
 		return err
 	}
 
+	type BaselineEntry struct {
+		File, Analyzer, Hash string
+	}
+	var baseline []BaselineEntry
+	if *baselineFile != "" {
+		data, err := ioutil.ReadFile(*baselineFile)
+		if err != nil {
+			return fmt.Errorf("failed to read baseline file: %v", err)
+		}
+		entries, err := parseBaseline(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", *baselineFile, err)
+		}
+		for _, e := range entries {
+			baseline = append(baseline, BaselineEntry{File: e.file, Analyzer: e.analyzer, Hash: e.hash})
+		}
+	}
+
 	type Import struct {
 		Path, Name string
 	}
@@ -127,10 +164,12 @@ func genNogoMain(args []string) error {
 	data := struct {
 		Imports    []Import
 		Configs    Configs
+		Baseline   []BaselineEntry
 		NeedRegexp bool
 	}{
-		Imports: imports,
-		Configs: config,
+		Imports:  imports,
+		Configs:  config,
+		Baseline: baseline,
 	}
 	for _, c := range config {
 		if len(c.OnlyFiles) > 0 || len(c.ExcludeFiles) > 0 {
@@ -169,10 +208,17 @@ func buildConfig(path string) (Configs, error) {
 				return Configs{}, fmt.Errorf("invalid pattern for analysis %q: %v", name, err)
 			}
 		}
+		for flag := range config.AnalyzerFlags {
+			if flag == "" || strings.HasPrefix(flag, "-") {
+				return Configs{}, fmt.Errorf("invalid flag name for analysis %q: %q: names must not be empty or start with '-'", name, flag)
+			}
+		}
 		configs[name] = Config{
 			// Description is currently unused.
-			OnlyFiles:    config.OnlyFiles,
-			ExcludeFiles: config.ExcludeFiles,
+			OnlyFiles:        config.OnlyFiles,
+			ExcludeFiles:     config.ExcludeFiles,
+			ExcludeGenerated: config.ExcludeGenerated,
+			AnalyzerFlags:    config.AnalyzerFlags,
 		}
 	}
 	return configs, nil
@@ -181,7 +227,9 @@ func buildConfig(path string) (Configs, error) {
 type Configs map[string]Config
 
 type Config struct {
-	Description  string
-	OnlyFiles    map[string]string `json:"only_files"`
-	ExcludeFiles map[string]string `json:"exclude_files"`
+	Description      string
+	OnlyFiles        map[string]string `json:"only_files"`
+	ExcludeFiles     map[string]string `json:"exclude_files"`
+	ExcludeGenerated bool              `json:"exclude_generated"`
+	AnalyzerFlags    map[string]string `json:"analyzer_flags"`
 }
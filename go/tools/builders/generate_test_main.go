@@ -26,9 +26,13 @@ import (
 	"go/token"
 	"os"
 	"path/filepath"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 type Import struct {
@@ -41,6 +45,12 @@ type TestCase struct {
 	Name    string
 }
 
+// BenchmarkFlag is a testing flag set by default in benchmark mode.
+type BenchmarkFlag struct {
+	Name  string
+	Value string
+}
+
 type Example struct {
 	Package   string
 	Name      string
@@ -50,14 +60,48 @@ type Example struct {
 
 // Cases holds template data.
 type Cases struct {
-	RunDir     string
-	Imports    []*Import
-	Tests      []TestCase
-	Benchmarks []TestCase
-	Examples   []Example
-	TestMain   string
-	Coverage   bool
-	Pkgname    string
+	RunDir      string
+	Imports     []*Import
+	Tests       []TestCase
+	Benchmarks  []TestCase
+	FuzzTargets []TestCase
+	Examples    []Example
+	TestMain    string
+	Coverage    bool
+	Pkgname     string
+
+	// ShardTimings is the path of a file with test durations from earlier
+	// runs, relative to the runfiles directory. It's used to balance tests
+	// across shards.
+	ShardTimings string
+
+	// Retries is the number of times tests that fail are rerun by the
+	// wrapper before the test is reported as failing.
+	Retries int
+
+	// FailureHook is the path of an executable the wrapper runs when the
+	// test fails, relative to the runfiles directory.
+	FailureHook string
+
+	// Profiles lists the profiles the test writes to its undeclared outputs,
+	// separated by commas.
+	Profiles string
+
+	// Benchmark is true if the test binary is built by go_benchmark. Only
+	// benchmarks are run, with BenchmarkFlags as defaults for the testing
+	// flags. Flags on the command line take precedence.
+	Benchmark      bool
+	BenchmarkFlags []BenchmarkFlag
+
+	// NativeFuzz is true if the testing package supports native fuzzing
+	// (Go 1.18 and later). testing.MainStart takes a list of fuzz targets
+	// in those versions.
+	NativeFuzz bool
+
+	// TestMainExitCode is true if the test should exit with the result of
+	// m.Run when TestMain returns, as it does with the go command in Go 1.15
+	// and later. Earlier versions exit with status 0.
+	TestMainExitCode bool
 }
 
 const testMainTpl = `
@@ -66,8 +110,10 @@ import (
 	"flag"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
+{{if .TestMainExitCode}}
+	"reflect"
+{{end}}
 	"runtime"
 	"strconv"
 	"testing"
@@ -94,34 +140,67 @@ var benchmarks = []testing.InternalBenchmark{
 {{end}}
 }
 
+{{if .NativeFuzz}}
+var fuzzTargets = []testing.InternalFuzzTarget{
+{{range .FuzzTargets}}
+	{"{{.Name}}", {{.Package}}.{{.Name}} },
+{{end}}
+}
+{{end}}
+
 var examples = []testing.InternalExample{
 {{range .Examples}}
 	{Name: "{{.Name}}", F: {{.Package}}.{{.Name}}, Output: {{printf "%q" .Output}}, Unordered: {{.Unordered}} },
 {{end}}
 }
 
-func testsInShard() []testing.InternalTest {
+// shardSelection holds the names of the tests chosen by the shard plugin or
+// balanced using a timings file. It's nil if neither is used.
+var shardSelection map[string]bool
+
+// inShard reports whether the i'th test, named name, should run in the
+// current shard.
+func inShard(i int, name string) bool {
+	if shardSelection != nil {
+		return shardSelection[name]
+	}
 	totalShards, err := strconv.Atoi(os.Getenv("TEST_TOTAL_SHARDS"))
 	if err != nil || totalShards <= 1 {
-		return allTests
+		return true
 	}
 	shardIndex, err := strconv.Atoi(os.Getenv("TEST_SHARD_INDEX"))
 	if err != nil || shardIndex < 0 {
-		return allTests
+		return true
 	}
+	return i % totalShards == shardIndex
+}
+
+func testsInShard() []testing.InternalTest {
 	tests := []testing.InternalTest{}
 	for i, t := range allTests {
-		if i % totalShards == shardIndex {
+		if inShard(i, t.Name) {
 			tests = append(tests, t)
 		}
 	}
 	return tests
 }
 
+// testNames returns the names of all tests.
+func testNames() []string {
+	names := []string{}
+	for _, t := range allTests {
+		names = append(names, t.Name)
+	}
+	return names
+}
+
 func main() {
-	if shouldWrap() {
-		err := wrap("{{.Pkgname}}")
-		if xerr, ok := err.(*exec.ExitError); ok {
+	if err := touchShardStatusFile(); err != nil {
+		log.Fatal(err)
+	}
+	if shouldWrap() || fuzzing() {
+		err := wrap("{{.Pkgname}}", testNames(), {{printf "%q" .RunDir}}, {{.Benchmark}}, {{.Retries}}, {{printf "%q" .FailureHook}})
+		if xerr, ok := err.(exitCoder); ok {
 			os.Exit(xerr.ExitCode())
 		} else if err != nil {
 			log.Print(err)
@@ -137,6 +216,11 @@ func main() {
 	testWorkspace := os.Getenv("TEST_WORKSPACE")
 	if testSrcdir != "" && testWorkspace != "" {
 		abs := filepath.Join(testSrcdir, testWorkspace, {{printf "%q" .RunDir}})
+		if dir := os.Getenv(fuzzDirEnv); dir != "" {
+			// The wrapper made a writable copy of the test directory, so the
+			// fuzzer can record new failing inputs in testdata/fuzz.
+			abs = dir
+		}
 		err := os.Chdir(abs)
 		// Ignore the Chdir err when on Windows, since it might have have runfiles symlinks.
 		// https://github.com/bazelbuild/rules_go/pull/1721#issuecomment-422145904
@@ -148,10 +232,46 @@ func main() {
 		}
 	}
 
+	selection, err := readShardSelection()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if selection == nil {
+		selection, err = timedShardSelection(testNames(), {{printf "%q" .ShardTimings}})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	shardSelection = selection
+
+{{if .Benchmark}}
+	// Only benchmarks run in benchmark mode.
+{{if .NativeFuzz}}
+	m := testing.MainStart(testdeps.TestDeps{}, nil, benchmarks, nil, nil)
+{{else}}
+	m := testing.MainStart(testdeps.TestDeps{}, nil, benchmarks, nil)
+{{end}}
+{{range .BenchmarkFlags}}
+	if err := flag.Lookup({{printf "%q" .Name}}).Value.Set({{printf "%q" .Value}}); err != nil {
+		log.Fatalf("invalid value for -%s: %v", {{printf "%q" .Name}}, err)
+	}
+{{end}}
+{{else if .NativeFuzz}}
+	m := testing.MainStart(testdeps.TestDeps{}, testsInShard(), benchmarks, fuzzTargets, examples)
+{{else}}
 	m := testing.MainStart(testdeps.TestDeps{}, testsInShard(), benchmarks, examples)
+{{end}}
 
 	if filter := os.Getenv("TESTBRIDGE_TEST_ONLY"); filter != "" {
+{{if .Benchmark}}
+		flag.Lookup("test.bench").Value.Set(filter)
+{{else}}
 		flag.Lookup("test.run").Value.Set(filter)
+{{end}}
+	}
+
+	if err := setProfileFlags({{printf "%q" .Profiles}}); err != nil {
+		log.Fatal(err)
 	}
 
 	{{if .Coverage}}
@@ -169,30 +289,41 @@ func main() {
 	os.Exit(m.Run())
 	{{else}}
 	{{.TestMain}}(m)
+	{{if .TestMainExitCode}}
+	os.Exit(int(reflect.ValueOf(m).Elem().FieldByName("exitCode").Int()))
+	{{end}}
 	{{end}}
 }
 `
 
 func genTestMain(args []string) error {
 	// Prepare our flags
-	args, err := readParamsFiles(args)
+	args, err := buildenv.ReadParamsFiles(args)
 	if err != nil {
 		return err
 	}
 	imports := multiFlag{}
 	sources := multiFlag{}
 	flags := flag.NewFlagSet("GoTestGenTest", flag.ExitOnError)
-	goenv := envFlags(flags)
+	goenv := buildenv.EnvFlags(flags)
 	runDir := flags.String("rundir", ".", "Path to directory where tests should run.")
 	out := flags.String("output", "", "output file to write. Defaults to stdout.")
 	coverage := flags.Bool("coverage", false, "whether coverage is supported")
 	pkgname := flags.String("pkgname", "", "package name of test")
+	shardTimings := flags.String("shard_timings", "", "runfiles path of a file with test durations used to balance shards")
+	retries := flags.Int("retries", 0, "number of times failed tests are rerun")
+	failureHook := flags.String("failure_hook", "", "runfiles path of an executable run when the test fails")
+	profiles := flags.String("profiles", "", "comma-separated list of profiles the test writes")
+	bench := flags.String("bench", "", "if set, only benchmarks matching this pattern are run by default")
+	benchtime := flags.String("benchtime", "", "default value of -test.benchtime in benchmark mode")
+	benchcount := flags.Int("benchcount", 0, "default value of -test.count in benchmark mode")
+	benchmem := flags.Bool("benchmem", false, "default value of -test.benchmem in benchmark mode")
 	flags.Var(&imports, "import", "Packages to import")
 	flags.Var(&sources, "src", "Sources to process for tests")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
-	if err := goenv.checkFlags(); err != nil {
+	if err := goenv.CheckFlags(); err != nil {
 		return err
 	}
 	// Process import args
@@ -235,13 +366,33 @@ func genTestMain(args []string) error {
 	}
 
 	cases := Cases{
-		RunDir:   strings.Replace(filepath.FromSlash(*runDir), `\`, `\\`, -1),
-		Coverage: *coverage,
-		Pkgname:  *pkgname,
+		RunDir:       strings.Replace(filepath.FromSlash(*runDir), `\`, `\\`, -1),
+		Coverage:     *coverage,
+		Pkgname:      *pkgname,
+		ShardTimings: *shardTimings,
+		Retries:      *retries,
+		FailureHook:  *failureHook,
+		Profiles:     *profiles,
+		NativeFuzz:   supportsNativeFuzzing(runtime.Version()),
+	}
+	cases.TestMainExitCode = goVersionAtLeast(runtime.Version(), 15)
+	if *bench != "" {
+		cases.Benchmark = true
+		cases.BenchmarkFlags = append(cases.BenchmarkFlags, BenchmarkFlag{"test.bench", *bench})
+		if *benchtime != "" {
+			cases.BenchmarkFlags = append(cases.BenchmarkFlags, BenchmarkFlag{"test.benchtime", *benchtime})
+		}
+		if *benchcount > 0 {
+			cases.BenchmarkFlags = append(cases.BenchmarkFlags, BenchmarkFlag{"test.count", strconv.Itoa(*benchcount)})
+		}
+		if *benchmem {
+			cases.BenchmarkFlags = append(cases.BenchmarkFlags, BenchmarkFlag{"test.benchmem", "true"})
+		}
 	}
 
 	testFileSet := token.NewFileSet()
 	pkgs := map[string]bool{}
+	var testMainPos token.Position
 	for _, f := range goSrcs {
 		parse, err := parser.ParseFile(testFileSet, f.filename, nil, parser.ParseComments)
 		if err != nil {
@@ -272,7 +423,17 @@ func genTestMain(args []string) error {
 				continue
 			}
 			if fn.Name.Name == "TestMain" {
-				// TestMain is not, itself, a test
+				// TestMain is not, itself, a test. It may be defined in
+				// either the internal or the external test package, but
+				// not both, as with the go command.
+				pos := testFileSet.Position(fn.Pos())
+				if !isTestMain(fn) {
+					return fmt.Errorf("%s: wrong signature for TestMain, must be: func TestMain(m *testing.M)", pos)
+				}
+				if testMainPos.IsValid() {
+					return fmt.Errorf("%s: multiple definitions of TestMain; previous definition at %s", pos, testMainPos)
+				}
+				testMainPos = pos
 				pkgs[pkg] = true
 				cases.TestMain = fmt.Sprintf("%s.%s", pkg, fn.Name.Name)
 				continue
@@ -327,6 +488,17 @@ func genTestMain(args []string) error {
 					Name:    fn.Name.Name,
 				})
 			}
+			if strings.HasPrefix(fn.Name.Name, "Fuzz") {
+				// Before Go 1.18, functions like this were not special.
+				if selExpr.Sel.Name != "F" || !cases.NativeFuzz {
+					continue
+				}
+				pkgs[pkg] = true
+				cases.FuzzTargets = append(cases.FuzzTargets, TestCase{
+					Package: pkg,
+					Name:    fn.Name.Name,
+				})
+			}
 		}
 	}
 
@@ -346,3 +518,44 @@ func genTestMain(args []string) error {
 	}
 	return nil
 }
+
+// isTestMain reports whether fn has the signature of TestMain:
+// func TestMain(m *testing.M). Like tests, the testing package may be
+// imported under another name.
+func isTestMain(fn *ast.FuncDecl) bool {
+	if fn.Type.Results != nil && len(fn.Type.Results.List) > 0 {
+		return false
+	}
+	params := fn.Type.Params.List
+	if len(params) != 1 || len(params[0].Names) > 1 {
+		return false
+	}
+	star, ok := params[0].Type.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "M"
+}
+
+// supportsNativeFuzzing reports whether the testing package of the given Go
+// version supports fuzz targets. The builder is compiled with the SDK it
+// generates code for, so runtime.Version describes the target SDK.
+func supportsNativeFuzzing(version string) bool {
+	return goVersionAtLeast(version, 18)
+}
+
+// goVersionAtLeast reports whether version, as returned by runtime.Version,
+// is Go 1.minor or later. Development versions are assumed to be recent.
+func goVersionAtLeast(version string, minor int) bool {
+	if !strings.HasPrefix(version, "go1.") {
+		// Probably a development version.
+		return true
+	}
+	v := version[len("go1."):]
+	if i := strings.IndexAny(v, ".abcdefghijklmnopqrstuvwxyz"); i >= 0 {
+		v = v[:i]
+	}
+	n, err := strconv.Atoi(v)
+	return err != nil || n >= minor
+}
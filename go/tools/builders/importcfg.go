@@ -26,6 +26,8 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 type archive struct {
@@ -109,7 +111,7 @@ func buildImportcfgFileForCompile(imports map[string]*archive, installSuffix, di
 	if !ok {
 		return "", errors.New("GOROOT not set")
 	}
-	goroot = abs(goroot)
+	goroot = buildenv.Abs(goroot)
 
 	sortedImports := make([]string, 0, len(imports))
 	for imp := range imports {
@@ -120,8 +122,12 @@ func buildImportcfgFileForCompile(imports map[string]*archive, installSuffix, di
 	for _, imp := range sortedImports {
 		if arc := imports[imp]; arc == nil {
 			// std package
-			path := filepath.Join(goroot, "pkg", installSuffix, filepath.FromSlash(imp))
-			fmt.Fprintf(buf, "packagefile %s=%s.a\n", imp, path)
+			path := filepath.Join(goroot, "pkg", installSuffix, filepath.FromSlash(imp)) + ".a"
+			// unsafe is built into the compiler and has no archive.
+			if _, err := os.Stat(path); os.IsNotExist(err) && imp != "unsafe" {
+				return "", fmt.Errorf("standard library package %q was not built for this configuration. If --@io_bazel_rules_go//go/config:stdlib_packages is set, add %q to it", imp, imp)
+			}
+			fmt.Fprintf(buf, "packagefile %s=%s\n", imp, path)
 		} else {
 			if imp != arc.packagePath {
 				fmt.Fprintf(buf, "importmap %s=%s\n", imp, arc.packagePath)
@@ -147,13 +153,20 @@ func buildImportcfgFileForCompile(imports map[string]*archive, installSuffix, di
 	return filename, nil
 }
 
-func buildImportcfgFileForLink(archives []archive, stdPackageListPath, installSuffix, dir string, packageConflictIsError bool) (string, error) {
+// buildImportcfgFileForLink writes an importcfg file to be consumed by the
+// linker. The file is constructed from the transitive dependencies in archives
+// and the standard library. If more than one archive has the same package
+// path, the first one is used, unless allowlist names the label of the
+// archive to use for that path. Conflicts not resolved by allowlist are
+// reported as warnings, or as errors if packageConflictIsError is set.
+// The caller is responsible for deleting the importcfg file.
+func buildImportcfgFileForLink(archives []archive, stdPackageListPath, installSuffix, dir string, packageConflictIsError bool, allowlist map[string]string) (string, error) {
 	buf := &bytes.Buffer{}
 	goroot, ok := os.LookupEnv("GOROOT")
 	if !ok {
 		return "", errors.New("GOROOT not set")
 	}
-	prefix := abs(filepath.Join(goroot, "pkg", installSuffix))
+	prefix := buildenv.Abs(filepath.Join(goroot, "pkg", installSuffix))
 	stdPackageListFile, err := os.Open(stdPackageListPath)
 	if err != nil {
 		return "", err
@@ -172,11 +185,16 @@ func buildImportcfgFileForLink(archives []archive, stdPackageListPath, installSu
 	}
 	depsSeen := map[string]string{}
 	for _, arc := range archives {
-		if conflictLabel, ok := depsSeen[arc.packagePath]; ok {
+		if winner, ok := allowlist[arc.packagePath]; ok && hasArchive(archives, arc.packagePath, winner) {
+			if normalizeLabel(arc.label) != winner {
+				continue
+			}
+		} else if conflictLabel, ok := depsSeen[arc.packagePath]; ok {
 			msg := fmt.Sprintf(`package %q is provided by more than one rule:
     %s
     %s
-Set "importmap" to different paths in each library.
+Set "importmap" to different paths in each library, or list the package in
+--@io_bazel_rules_go//go/config:package_conflict_allowlist.
 This will be an error in the future.`, arc.packagePath, arc.label, conflictLabel)
 
 			// TODO(#1374): Always make this an error.
@@ -206,6 +224,137 @@ This will be an error in the future.`, arc.packagePath, arc.label, conflictLabel
 	return filename, nil
 }
 
+// readPackageConflictAllowlist reads a file listing package paths that may
+// be provided by more than one archive when linking. Each non-blank line
+// contains a package path and the label of the archive that should be linked
+// for that path, separated by whitespace. Text after '#' is ignored.
+// The returned map is keyed by package path.
+func readPackageConflictAllowlist(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	allowlist := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		if j := strings.IndexByte(line, '#'); j >= 0 {
+			line = line[:j]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a package path and a label, got %q", path, i+1, line)
+		}
+		if prev, ok := allowlist[fields[0]]; ok {
+			return nil, fmt.Errorf("%s:%d: package %q already allowed for %s", path, i+1, fields[0], prev)
+		}
+		allowlist[fields[0]] = normalizeLabel(fields[1])
+	}
+	return allowlist, nil
+}
+
+// readLinkArchiveList reads a file listing archives to link, one per line,
+// in the same form as the -arc flag of the link builder.
+func readLinkArchiveList(path string) ([]archive, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var archives linkArchiveMultiFlag
+	for i, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if err := archives.Set(line); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+	}
+	return archives, nil
+}
+
+// dedupArchives removes archives with the same package path and file as an
+// earlier archive. The order of the remaining archives is preserved.
+func dedupArchives(archives []archive) []archive {
+	seen := make(map[string]bool)
+	deduped := archives[:0:0]
+	for _, arc := range archives {
+		key := arc.packagePath + "=" + arc.aFile
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		deduped = append(deduped, arc)
+	}
+	return deduped
+}
+
+// reachableArchives returns the archives that provide packages the linker
+// may load, starting from the packages imported by mainArchive. An
+// archive's imports are only read once its package is reached, so archives
+// that nothing imports aren't opened. Packages without an archive are in the
+// standard library. If an archive was written in an object format
+// readArchiveImports doesn't understand, all archives are returned.
+// The order of archives is preserved.
+func reachableArchives(mainArchive string, archives []archive) ([]archive, error) {
+	byPath := make(map[string][]string)
+	for _, arc := range archives {
+		byPath[arc.packagePath] = append(byPath[arc.packagePath], arc.aFile)
+	}
+
+	queue, err := readArchiveImports(mainArchive)
+	reached := make(map[string]bool)
+	for err == nil && len(queue) > 0 {
+		pkg := queue[0]
+		queue = queue[1:]
+		if reached[pkg] {
+			continue
+		}
+		reached[pkg] = true
+		for _, aFile := range byPath[pkg] {
+			var imports []string
+			if imports, err = readArchiveImports(aFile); err != nil {
+				break
+			}
+			queue = append(queue, imports...)
+		}
+	}
+	if errors.Is(err, errUnknownObjectFormat) {
+		return archives, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var linked []archive
+	for _, arc := range archives {
+		if reached[arc.packagePath] {
+			linked = append(linked, arc)
+		}
+	}
+	return linked, nil
+}
+
+// hasArchive returns whether archives contains an archive with the given
+// package path and (normalized) label.
+func hasArchive(archives []archive, packagePath, label string) bool {
+	for _, arc := range archives {
+		if arc.packagePath == packagePath && normalizeLabel(arc.label) == label {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeLabel strips the "@" prefix from labels in the main repository,
+// so "@//foo:bar" and "//foo:bar" compare equal. Bazel versions differ in
+// how they format these labels.
+func normalizeLabel(label string) string {
+	if strings.HasPrefix(label, "@//") {
+		return label[1:]
+	}
+	return label
+}
+
 type depsError struct {
 	missing []missingDep
 	known   []string
@@ -260,10 +409,10 @@ func (m *compileArchiveMultiFlag) Set(v string) error {
 		importPath:        importPaths[0],
 		importPathAliases: importPaths[1:],
 		packagePath:       parts[1],
-		aFile:             abs(parts[2]),
+		aFile:             buildenv.Abs(parts[2]),
 	}
 	if parts[3] != "" {
-		a.xFile = abs(parts[3])
+		a.xFile = buildenv.Abs(parts[3])
 	}
 	*m = append(*m, a)
 	return nil
@@ -275,7 +424,7 @@ func (m *linkArchiveMultiFlag) String() string {
 	if m == nil || len(*m) == 0 {
 		return ""
 	}
-	return fmt.Sprint(m)
+	return fmt.Sprint(*m)
 }
 
 func (m *linkArchiveMultiFlag) Set(v string) error {
@@ -286,7 +435,7 @@ func (m *linkArchiveMultiFlag) Set(v string) error {
 	*m = append(*m, archive{
 		label:       parts[0],
 		packagePath: parts[1],
-		aFile:       abs(parts[2]),
+		aFile:       buildenv.Abs(parts[2]),
 	})
 	return nil
 }
@@ -0,0 +1,311 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+func TestReadPackageConflictAllowlist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestReadPackageConflictAllowlist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		desc, content string
+		want          map[string]string
+		wantErr       bool
+	}{
+		{
+			desc: "valid",
+			content: `# Shims kept during the migration to example.com/new.
+example.com/old @//third_party/old:go_default_library
+example.com/util //util:go_default_library  # comment
+
+`,
+			want: map[string]string{
+				"example.com/old":  "//third_party/old:go_default_library",
+				"example.com/util": "//util:go_default_library",
+			},
+		}, {
+			desc:    "missing_label",
+			content: "example.com/old\n",
+			wantErr: true,
+		}, {
+			desc:    "duplicate",
+			content: "example.com/old //a:a\nexample.com/old //b:b\n",
+			wantErr: true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			path := filepath.Join(dir, tc.desc)
+			if err := ioutil.WriteFile(path, []byte(tc.content), 0666); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readPackageConflictAllowlist(path)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("got %v; want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBuildImportcfgFileForLinkConflicts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestBuildImportcfgFileForLinkConflicts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if goroot, ok := os.LookupEnv("GOROOT"); ok {
+		defer os.Setenv("GOROOT", goroot)
+	} else {
+		defer os.Unsetenv("GOROOT")
+	}
+	os.Setenv("GOROOT", dir)
+	packageListPath := filepath.Join(dir, "packages.txt")
+	if err := ioutil.WriteFile(packageListPath, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	archives := []archive{
+		{label: "//de:foo", packagePath: "example.com/foo", aFile: "/de/foo.a"},
+		{label: "//en:foo", packagePath: "example.com/foo", aFile: "/en/foo.a"},
+	}
+	for _, tc := range []struct {
+		desc      string
+		allowlist map[string]string
+		want      string
+		wantErr   bool
+	}{
+		{
+			desc:    "no_allowlist",
+			wantErr: true,
+		}, {
+			desc:      "second_wins",
+			allowlist: map[string]string{"example.com/foo": "//en:foo"},
+			want:      "packagefile example.com/foo=/en/foo.a\n",
+		}, {
+			desc:      "unknown_winner",
+			allowlist: map[string]string{"example.com/foo": "//fr:foo"},
+			wantErr:   true,
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			name, err := buildImportcfgFileForLink(archives, packageListPath, "", dir, true, tc.allowlist)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("got success; want error")
+				}
+				if !strings.Contains(err.Error(), "provided by more than one rule") {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(name)
+			got, err := ioutil.ReadFile(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+// goTestObject returns a Go object file with the given magic string and
+// imports in its autolib table. The file has an export data section
+// containing "\n!\n" before the object, like some compiled packages.
+func goTestObject(magic string, imports ...string) string {
+	var strs bytes.Buffer
+	var autolib bytes.Buffer
+	const headerSize = 8 + 8 + 4 + 2*4
+	strOff := headerSize + 16*len(imports)
+	for _, imp := range imports {
+		binary.Write(&autolib, binary.LittleEndian, uint32(len(imp)))
+		binary.Write(&autolib, binary.LittleEndian, uint32(strOff+strs.Len()))
+		autolib.Write(make([]byte, 8))
+		strs.WriteString(imp)
+	}
+	var obj bytes.Buffer
+	obj.WriteString(magic)
+	obj.Write(make([]byte, 8+4))
+	binary.Write(&obj, binary.LittleEndian, uint32(headerSize))
+	binary.Write(&obj, binary.LittleEndian, uint32(headerSize+autolib.Len()))
+	obj.Write(autolib.Bytes())
+	obj.Write(strs.Bytes())
+	return "go object linux amd64 go1.20 X:none\n\n$$B\nexport\n!\ndata\n$$\n\n!\n" + obj.String()
+}
+
+func writeTestGoArchive(t *testing.T, path string, members ...string) {
+	var buf bytes.Buffer
+	buf.WriteString(arHeader)
+	names := []string{"__.PKGDEF", "_go_.o", "_x000.o"}
+	for i, data := range members {
+		fmt.Fprintf(&buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", names[i], 0, 0, 0, 0644, len(data))
+		buf.WriteString(data)
+		if len(data)%2 != 0 {
+			buf.WriteByte('\n')
+		}
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReachableArchives(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestReachableArchives")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const pkgdef = "go object linux amd64 go1.20 X:none\n"
+	write := func(name string, members ...string) string {
+		path := filepath.Join(dir, name)
+		writeTestGoArchive(t, path, members...)
+		return path
+	}
+	mainPath := write("main.a", pkgdef, goTestObject(goObjectMagic, "example.com/a", "fmt"))
+	aPath := write("a.a", pkgdef, goTestObject(goObjectMagic, "example.com/b"), "\x7fELF cgo object")
+	bPath := write("b.a", pkgdef, goTestObject(goObjectMagic))
+	cPath := write("c.a", pkgdef, goTestObject(goObjectMagic, "example.com/b"))
+	newPath := write("new.a", pkgdef, goTestObject("\x00go999ld", "example.com/b"))
+
+	a := archive{label: "//a", packagePath: "example.com/a", aFile: aPath}
+	b := archive{label: "//b", packagePath: "example.com/b", aFile: bPath}
+	c := archive{label: "//c", packagePath: "example.com/c", aFile: cPath}
+	for _, tc := range []struct {
+		desc     string
+		archives []archive
+		want     []archive
+	}{
+		{
+			desc:     "unreachable",
+			archives: []archive{c, b, a},
+			want:     []archive{b, a},
+		}, {
+			desc:     "unknown_format",
+			archives: []archive{c, {label: "//a", packagePath: "example.com/a", aFile: newPath}},
+			want:     []archive{c, {label: "//a", packagePath: "example.com/a", aFile: newPath}},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got, err := reachableArchives(mainPath, tc.archives)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+// countingReaderAt counts the bytes read from r.
+type countingReaderAt struct {
+	r io.ReaderAt
+	n int
+}
+
+func (cr *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := cr.r.ReadAt(p, off)
+	cr.n += n
+	return n, err
+}
+
+func TestReadObjectImports(t *testing.T) {
+	// The rest of a large object isn't read.
+	obj := goTestObject(goObjectMagic, "example.com/a", "fmt") + strings.Repeat("x", 1<<20)
+	r := &countingReaderAt{r: strings.NewReader(obj)}
+	got, err := readObjectImports(r, 0, int64(len(obj)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"example.com/a", "fmt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if r.n > 16<<10 {
+		t.Errorf("read %d bytes of a %d-byte object", r.n, len(obj))
+	}
+
+	// Export data sections may have lines longer than the read buffer.
+	long := strings.Replace(obj, "\nexport\n", "\n"+strings.Repeat("e", 10000)+"\n", 1)
+	got, err = readObjectImports(strings.NewReader(long), 0, int64(len(long)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"example.com/a", "fmt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("with long lines: got %q; want %q", got, want)
+	}
+}
+
+func TestReadLinkArchiveList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestReadLinkArchiveList")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	listPath := filepath.Join(dir, "bin.arcs")
+	content := "//a=example.com/a=/a.a\n//b=example.com/b=/b.a\n//a:alias=example.com/a=/a.a\n"
+	if err := ioutil.WriteFile(listPath, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	archives, err := readLinkArchiveList(listPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := dedupArchives(archives)
+	want := []archive{
+		{label: "//a", packagePath: "example.com/a", aFile: buildenv.Abs("/a.a")},
+		{label: "//b", packagePath: "example.com/b", aFile: buildenv.Abs("/b.a")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	if err := ioutil.WriteFile(listPath, []byte("//a=example.com/a\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readLinkArchiveList(listPath); err == nil {
+		t.Error("got success for badly formed list; want error")
+	}
+}
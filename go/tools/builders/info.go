@@ -21,21 +21,23 @@ import (
 	"fmt"
 	"log"
 	"os"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 func run(args []string) error {
-	args, err := readParamsFiles(args)
+	args, err := buildenv.ReadParamsFiles(args)
 	if err != nil {
 		return err
 	}
 	filename := ""
 	flags := flag.NewFlagSet("info", flag.ExitOnError)
 	flags.StringVar(&filename, "out", filename, "The file to write the report to")
-	goenv := envFlags(flags)
+	goenv := buildenv.EnvFlags(flags)
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
-	if err := goenv.checkFlags(); err != nil {
+	if err := goenv.CheckFlags(); err != nil {
 		return err
 	}
 	f := os.Stderr
@@ -47,10 +49,10 @@ func run(args []string) error {
 		}
 		defer f.Close()
 	}
-	if err := goenv.runCommandToFile(f, goenv.goCmd("version")); err != nil {
+	if err := goenv.RunCommandToFile(f, goenv.GoCmd("version")); err != nil {
 		return err
 	}
-	if err := goenv.runCommandToFile(f, goenv.goCmd("env")); err != nil {
+	if err := goenv.RunCommandToFile(f, goenv.GoCmd("env")); err != nil {
 		return err
 	}
 	return nil
@@ -17,44 +17,49 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 func link(args []string) error {
 	// Parse arguments.
-	args, err := readParamsFiles(args)
+	args, err := buildenv.ReadParamsFiles(args)
 	if err != nil {
 		return err
 	}
-	builderArgs, toolArgs := splitArgs(args)
+	builderArgs, toolArgs := buildenv.SplitArgs(args)
 	xstamps := multiFlag{}
 	stamps := multiFlag{}
 	xdefs := multiFlag{}
+	buildConfig := multiFlag{}
 	archives := linkArchiveMultiFlag{}
 	flags := flag.NewFlagSet("link", flag.ExitOnError)
-	goenv := envFlags(flags)
+	goenv := buildenv.EnvFlags(flags)
 	main := flags.String("main", "", "Path to the main archive.")
 	packagePath := flags.String("p", "", "Package path of the main archive.")
 	outFile := flags.String("o", "", "Path to output file.")
 	flags.Var(&archives, "arc", "Label, package path, and file name of a dependency, separated by '='")
+	arcList := flags.String("arc_list", "", "File listing dependencies, one per line, in the same form as -arc.")
 	packageList := flags.String("package_list", "", "The file containing the list of standard library packages")
 	buildmode := flags.String("buildmode", "", "Build mode used.")
 	flags.Var(&xdefs, "X", "A string variable to replace in the linked binary (repeated).")
-	flags.Var(&xstamps, "Xstamp", "Like -X but the values are looked up in the -stamp file.")
+	flags.Var(&xstamps, "Xstamp", "Like -X but the values are looked up in the -stamp file. A value of the form key|default falls back to default when key is missing.")
 	flags.Var(&stamps, "stamp", "The name of a file with stamping values.")
 	packageConflictIsError := flags.Bool("package_conflict_is_error", false, "Whether importpath conflicts are errors.")
+	packageConflictAllowlist := flags.String("package_conflict_allowlist", "", "File listing package paths that may be provided by more than one library.")
+	metadataPath := flags.String("metadata", "", "The action metadata file to write. If unset, no metadata is written.")
+	buildinfoPkg := flags.String("buildinfo", "", "Import path of the buildinfo package, if it's linked. Its variables are set to describe the binary.")
+	flags.Var(&buildConfig, "build_config", "A key=value build setting included in the build configuration digest recorded in the binary (repeated).")
 	if err := flags.Parse(builderArgs); err != nil {
 		return err
 	}
-	if err := goenv.checkFlags(); err != nil {
+	if err := goenv.CheckFlags(); err != nil {
 		return err
 	}
 
@@ -64,42 +69,45 @@ func link(args []string) error {
 	// longer length limits. Absolute paths do not work on macOS for .dylib
 	// outputs because they get baked in as the "install path".
 	if runtime.GOOS != "darwin" {
-		*outFile = abs(*outFile)
+		*outFile = buildenv.Abs(*outFile)
 	}
-	*main = abs(*main)
+	*main = buildenv.Abs(*main)
 
 	// If we were given any stamp value files, read and parse them
-	stampMap := map[string]string{}
-	for _, stampfile := range stamps {
-		stampbuf, err := ioutil.ReadFile(stampfile)
+	stampMap, err := readStampFiles(stamps)
+	if err != nil {
+		return err
+	}
+
+	// Only archives for packages the main package imports, directly or
+	// indirectly, are listed in the importcfg file.
+	if *arcList != "" {
+		listed, err := readLinkArchiveList(*arcList)
 		if err != nil {
-			return fmt.Errorf("Failed reading stamp file %s: %v", stampfile, err)
-		}
-		scanner := bufio.NewScanner(bytes.NewReader(stampbuf))
-		for scanner.Scan() {
-			line := strings.SplitN(scanner.Text(), " ", 2)
-			switch len(line) {
-			case 0:
-				// Nothing to do here
-			case 1:
-				// Map to the empty string
-				stampMap[line[0]] = ""
-			case 2:
-				// Key and value
-				stampMap[line[0]] = line[1]
-			}
+			return err
 		}
+		archives = append(archives, listed...)
+	}
+	linked, err := reachableArchives(*main, dedupArchives(archives))
+	if err != nil {
+		return err
 	}
 
 	// Build an importcfg file.
-	importcfgName, err := buildImportcfgFileForLink(archives, *packageList, goenv.installSuffix, filepath.Dir(*outFile), *packageConflictIsError)
+	var allowlist map[string]string
+	if *packageConflictAllowlist != "" {
+		if allowlist, err = readPackageConflictAllowlist(*packageConflictAllowlist); err != nil {
+			return err
+		}
+	}
+	importcfgName, err := buildImportcfgFileForLink(linked, *packageList, goenv.InstallSuffix, filepath.Dir(*outFile), *packageConflictIsError, allowlist)
 	if err != nil {
 		return err
 	}
 	defer os.Remove(importcfgName)
 
 	// generate any additional link options we need
-	goargs := goenv.goTool("link")
+	goargs := goenv.GoTool("link")
 	goargs = append(goargs, "-importcfg", importcfgName)
 
 	parseXdef := func(xdef string) (pkg, name, value string, err error) {
@@ -122,7 +130,7 @@ func link(args []string) error {
 		if err != nil {
 			return err
 		}
-		if value, ok := stampMap[key]; ok {
+		if value, ok := lookupStamp(stampMap, key); ok {
 			goargs = append(goargs, "-X", fmt.Sprintf("%s.%s=%s", pkg, name, value))
 		}
 	}
@@ -134,7 +142,24 @@ func link(args []string) error {
 		goargs = append(goargs, "-X", fmt.Sprintf("%s.%s=%s", pkg, name, value))
 	}
 
+	var digest string
+	if len(buildConfig) > 0 {
+		digest = buildConfigDigest(goenv.SDK, buildConfig)
+		goargs = append(goargs, "-X", "runtime.modinfo="+buildInfo(*packagePath, digest))
+	}
+	if *buildinfoPkg != "" {
+		if status := stableStatus(stampMap); status != "" {
+			goargs = append(goargs, "-X", *buildinfoPkg+".stableStatus="+status)
+		}
+		if digest != "" {
+			goargs = append(goargs, "-X", *buildinfoPkg+".configDigest="+digest)
+		}
+	}
+
 	if *buildmode != "" {
+		if err := checkBuildmode(*buildmode, os.Getenv("GOOS"), os.Getenv("GOARCH")); err != nil {
+			return err
+		}
 		goargs = append(goargs, "-buildmode", *buildmode)
 	}
 	goargs = append(goargs, "-o", *outFile)
@@ -142,7 +167,7 @@ func link(args []string) error {
 	// add in the unprocess pass through options
 	goargs = append(goargs, toolArgs...)
 	goargs = append(goargs, *main)
-	if err := goenv.runCommand(goargs); err != nil {
+	if err := goenv.RunCommand(goargs); err != nil {
 		return err
 	}
 
@@ -152,5 +177,11 @@ func link(args []string) error {
 		}
 	}
 
-	return nil
+	m := &actionMetadata{
+		Mnemonic:    "GoLink",
+		PackagePath: *packagePath,
+		Inputs:      map[string]int{"archives": len(archives), "linked_archives": len(linked)},
+	}
+	m.addOutput("executable", *outFile)
+	return writeActionMetadata(*metadataPath, m)
 }
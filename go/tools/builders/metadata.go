@@ -0,0 +1,82 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+)
+
+// actionMetadata describes a compile or link action. It's written as JSON
+// to a declared output when --@io_bazel_rules_go//go/config:action_metadata
+// is set, so build observability tools can attribute time and cache misses
+// to Go packages. Only deterministic values are recorded, so the file does
+// not prevent the action from being cached.
+type actionMetadata struct {
+	// Mnemonic is the mnemonic of the action, for example, "GoCompilePkg".
+	Mnemonic string `json:"mnemonic"`
+
+	// ImportPath is the import path of the package being compiled. It is
+	// empty for link actions.
+	ImportPath string `json:"importpath,omitempty"`
+
+	// PackagePath is the package path (importmap) of the package being
+	// compiled or the main package being linked.
+	PackagePath string `json:"packagepath,omitempty"`
+
+	// Inputs counts the inputs of the action by kind, for example, "go" for
+	// Go source files or "archives" for compiled dependencies.
+	Inputs map[string]int `json:"inputs"`
+
+	// Outputs maps kinds of outputs, for example, "archive", to their sizes
+	// in bytes.
+	Outputs map[string]int64 `json:"outputs"`
+}
+
+// addOutput records the size of an output file. Missing files are not
+// recorded.
+func (m *actionMetadata) addOutput(kind, path string) {
+	if path == "" {
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if m.Outputs == nil {
+		m.Outputs = make(map[string]int64)
+	}
+	m.Outputs[kind] = info.Size()
+}
+
+// writeActionMetadata writes m as JSON to path. Nothing is written if path
+// is empty.
+func writeActionMetadata(path string, m *actionMetadata) error {
+	if path == "" {
+		return nil
+	}
+	if m.Inputs == nil {
+		m.Inputs = make(map[string]int)
+	}
+	if m.Outputs == nil {
+		m.Outputs = make(map[string]int64)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0666)
+}
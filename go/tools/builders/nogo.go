@@ -0,0 +1,200 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"go/build"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// nogoPkg runs nogo on a package in its own action, separate from the
+// compile action. The action's inputs don't depend on how the package was
+// compiled (for example, with -race), so its outputs may be reused across
+// builds in different modes.
+//
+// With -facts_only, only analyzers that export facts are run, and findings
+// are ignored. Packages are usually checked twice: once to write facts for
+// dependent packages, and once, off the critical path, to report findings.
+//
+// nogoPkg is also used by nogo_test. In that case, findings are written to a
+// file instead of failing the action, so the test can report them.
+func nogoPkg(args []string) error {
+	args, err := buildenv.ReadParamsFiles(args)
+	if err != nil {
+		return err
+	}
+
+	fs := flag.NewFlagSet("GoNogo", flag.ExitOnError)
+	goenv := buildenv.EnvFlags(fs)
+	var unfilteredSrcs multiFlag
+	var deps compileArchiveMultiFlag
+	var packagePath, nogoPath, packageListPath, testFilter, srcsListPath string
+	var outFactsPath, outFindingsPath, outCheckedPath, outFixPath, outSARIFPath string
+	var factsOnly bool
+	fs.Var(&unfilteredSrcs, "src", ".go, .c, .cc, .m, .mm, .s, or .S file to be filtered and checked")
+	fs.StringVar(&srcsListPath, "srcs_list", "", "The export data file written by the compile action, which lists the Go files to check. If set, -src files are inputs but are not checked themselves.")
+	fs.Var(&deps, "arc", "Import path, package path, export data file, and facts file of a direct dependency, separated by '='")
+	fs.StringVar(&packagePath, "p", "", "The package path (importmap) of the package being checked")
+	fs.StringVar(&nogoPath, "nogo", "", "The nogo binary")
+	fs.StringVar(&packageListPath, "package_list", "", "The file containing the list of standard library packages")
+	fs.StringVar(&testFilter, "testfilter", "off", "Controls test package filtering")
+	fs.BoolVar(&factsOnly, "facts_only", false, "If true, only facts are written, and findings are ignored")
+	fs.StringVar(&outFactsPath, "x", "", "The nogo facts file to write")
+	fs.StringVar(&outFindingsPath, "o", "", "The file where findings should be written. If unset, findings are errors.")
+	fs.StringVar(&outCheckedPath, "checked", "", "An empty file to write after the package is checked without errors")
+	fs.StringVar(&outFixPath, "nogo_fix", "", "The file where nogo should write a unified diff of suggested fixes. If set, nogo findings are not errors.")
+	fs.StringVar(&outSARIFPath, "nogo_sarif", "", "The file where nogo should write findings in SARIF format. If set, nogo findings are not errors.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := goenv.CheckFlags(); err != nil {
+		return err
+	}
+	if factsOnly && outFactsPath == "" {
+		return errors.New("-facts_only requires -x")
+	}
+	var outPaths []string
+	for _, p := range []*string{&outFactsPath, &outFindingsPath, &outCheckedPath} {
+		if *p != "" {
+			*p = buildenv.Abs(*p)
+			outPaths = append(outPaths, *p)
+		}
+	}
+
+	var srcs []fileInfo
+	if srcsListPath != "" {
+		// The compile action already filtered the sources, processed them with
+		// cgo, and listed them before instrumenting them for coverage.
+		if srcs, err = readNogoSrcsList(srcsListPath); err != nil {
+			return err
+		}
+	} else {
+		for i := range unfilteredSrcs {
+			unfilteredSrcs[i] = buildenv.Abs(unfilteredSrcs[i])
+		}
+		archiveSrcs, err := filterAndSplitFiles(unfilteredSrcs)
+		if err != nil {
+			return err
+		}
+		if err := applyTestFilter(&archiveSrcs, testFilter); err != nil {
+			return err
+		}
+		srcs = archiveSrcs.goSrcs
+
+		// cgo packages are skipped: nogo needs the Go files generated by cgo,
+		// and without a list from the compile action, we don't have them.
+		for _, src := range srcs {
+			if src.isCgo {
+				return writeEmptyFiles(outPaths)
+			}
+		}
+	}
+
+	workDir, cleanup, err := goenv.WorkDir()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if len(srcs) == 0 {
+		// Check an empty file, as the compile action would, so facts and
+		// reports are still written.
+		emptyPath := filepath.Join(workDir, "_empty.go")
+		if err := ioutil.WriteFile(emptyPath, []byte("package empty\n"), 0666); err != nil {
+			return err
+		}
+		srcs = append(srcs, fileInfo{filename: emptyPath, ext: goExt, matched: true, pkg: "empty"})
+	}
+	goSrcs := make([]string, len(srcs))
+	for i, src := range srcs {
+		goSrcs[i] = src.filename
+	}
+
+	imports, err := checkImports(srcs, deps, packageListPath)
+	if err != nil {
+		return err
+	}
+	importcfgPath, err := buildImportcfgFileForCompile(imports, goenv.InstallSuffix, workDir)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(importcfgPath)
+
+	nogoErr := runNogo(context.Background(), workDir, nogoPath, goSrcs, deps, packagePath, importcfgPath, outFactsPath, outFixPath, outSARIFPath, factsOnly)
+	if outFindingsPath == "" && nogoErr != nil {
+		return nogoErr
+	}
+	if outFactsPath != "" {
+		if _, err := os.Stat(outFactsPath); os.IsNotExist(err) {
+			// nogo may stop before writing facts if it couldn't load the package.
+			if err := ioutil.WriteFile(outFactsPath, nil, 0666); err != nil {
+				return err
+			}
+		}
+	}
+	if outCheckedPath != "" {
+		if err := ioutil.WriteFile(outCheckedPath, nil, 0666); err != nil {
+			return err
+		}
+	}
+	if outFindingsPath == "" {
+		return nil
+	}
+	var findings []byte
+	if nogoErr != nil {
+		findings = []byte(nogoErr.Error())
+	}
+	return ioutil.WriteFile(outFindingsPath, findings, 0666)
+}
+
+// writeEmptyFiles creates or truncates each named file.
+func writeEmptyFiles(paths []string) error {
+	for _, path := range paths {
+		if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readNogoSrcsList reads a list written by formatNogoSrcsList from an export
+// data file. Build constraints aren't checked again, since the list was
+// already filtered with the tags the package was compiled with.
+func readNogoSrcsList(exportDataPath string) ([]fileInfo, error) {
+	data, err := readArchiveMember(exportDataPath, nogoSrcsMember)
+	if err != nil {
+		return nil, err
+	}
+	names, err := parseNogoSrcsList(data, exportDataPath)
+	if err != nil {
+		return nil, err
+	}
+	var srcs []fileInfo
+	for _, name := range names {
+		src, err := readFileInfo(build.Default, buildenv.Abs(name), true)
+		if err != nil {
+			return nil, err
+		}
+		srcs = append(srcs, src)
+	}
+	return srcs, nil
+}
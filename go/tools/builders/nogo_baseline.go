@@ -0,0 +1,68 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// baselineEntry identifies a known finding that nogo should not report.
+// Entries don't include line numbers, so they still match after unrelated
+// changes move a finding within its file.
+type baselineEntry struct {
+	// file is the slash-separated path of the file relative to the execution
+	// root, or "-" for findings without a position.
+	file string
+
+	// analyzer is the name of the analyzer that reported the finding.
+	analyzer string
+
+	// hash is the result of baselineHash for the finding's message.
+	hash string
+}
+
+// baselineHash returns a short, stable hash of a diagnostic message.
+// @io_bazel_rules_go//go/tools/nogo/baseline computes the same hash.
+func baselineHash(message string) string {
+	sum := sha256.Sum256([]byte(message))
+	return hex.EncodeToString(sum[:8])
+}
+
+// parseBaseline parses a baseline file. Each line has a file path, an
+// analyzer name, and a message hash, separated by tabs. Blank lines and
+// lines starting with '#' are ignored.
+func parseBaseline(data []byte) ([]baselineEntry, error) {
+	var entries []baselineEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || fields[0] == "" || fields[1] == "" || fields[2] == "" {
+			return nil, fmt.Errorf("line %d: want a file, analyzer, and message hash separated by tabs", lineNum)
+		}
+		entries = append(entries, baselineEntry{file: fields[0], analyzer: fields[1], hash: fields[2]})
+	}
+	return entries, scanner.Err()
+}
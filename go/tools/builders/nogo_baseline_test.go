@@ -0,0 +1,59 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBaselineHash(t *testing.T) {
+	// The hash is part of the baseline file format, so it must not change.
+	if got, want := baselineHash("unreachable code"), "5c09c9ac800bba52"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	if baselineHash("a") == baselineHash("b") {
+		t.Error("different messages have the same hash")
+	}
+}
+
+func TestParseBaseline(t *testing.T) {
+	data := []byte(`# Known findings.
+
+pkg/a.go	unreachable	0123456789abcdef
+-	nilness	fedcba9876543210
+`)
+	got, err := parseBaseline(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []baselineEntry{
+		{file: "pkg/a.go", analyzer: "unreachable", hash: "0123456789abcdef"},
+		{file: "-", analyzer: "nilness", hash: "fedcba9876543210"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v; want %#v", got, want)
+	}
+
+	for _, bad := range []string{
+		"pkg/a.go unreachable 0123456789abcdef\n",
+		"pkg/a.go\tunreachable\n",
+		"pkg/a.go\t\t0123456789abcdef\n",
+	} {
+		if _, err := parseBaseline([]byte(bad)); err == nil {
+			t.Errorf("parseBaseline(%q): got success; want error", bad)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around each change in
+// a unified diff.
+const diffContext = 3
+
+// textEdit replaces the bytes in [start, end) of a file with text. It is
+// a position-independent form of analysis.TextEdit.
+type textEdit struct {
+	start, end int
+	text       string
+}
+
+// editsOverlap reports whether two edits touch the same bytes. Two
+// insertions at the same offset are considered overlapping, since the
+// order they should be applied in is ambiguous.
+func editsOverlap(a, b textEdit) bool {
+	if a.start == b.start {
+		return true
+	}
+	return a.start < b.end && b.start < a.end
+}
+
+// lineChange replaces lines [oldStart, oldEnd) of a file with newLines.
+type lineChange struct {
+	oldStart, oldEnd int
+	newLines         []string
+}
+
+// diffEdits returns a unified diff that applies edits to content. The edits
+// must not overlap. name is used for both file names in the diff header.
+// diffEdits returns an empty string if the edits don't change anything.
+func diffEdits(name string, content []byte, edits []textEdit) string {
+	edits = append([]textEdit(nil), edits...)
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	lines := splitLines(content)
+	lineStarts := make([]int, len(lines)+1)
+	for i, l := range lines {
+		lineStarts[i+1] = lineStarts[i] + len(l)
+	}
+	lineOf := func(offset int) int {
+		l := sort.Search(len(lines), func(i int) bool { return lineStarts[i+1] > offset })
+		if l == len(lines) && l > 0 && !strings.HasSuffix(lines[l-1], "\n") {
+			// The end of a file without a trailing newline is part of the
+			// last line.
+			l--
+		}
+		return l
+	}
+
+	// Convert byte edits to line changes, merging edits that touch the same
+	// or adjacent lines.
+	var changes []lineChange
+	for i := 0; i < len(edits); {
+		first := lineOf(edits[i].start)
+		last := first
+		var text bytes.Buffer
+		text.Write(content[lineStarts[first]:edits[i].start])
+		j := i
+		for ; j < len(edits); j++ {
+			if j > i {
+				if lineOf(edits[j].start) > last+1 {
+					break
+				}
+				text.Write(content[edits[j-1].end:edits[j].start])
+			}
+			text.WriteString(edits[j].text)
+			// If the edit removes a newline, the next line is joined to the
+			// last line, so it's part of the change, too.
+			if l := lineOf(edits[j].end); l > last {
+				last = l
+			}
+		}
+		oldEnd := last + 1
+		if oldEnd > len(lines) {
+			oldEnd = len(lines)
+		}
+		text.Write(content[edits[j-1].end:lineStarts[oldEnd]])
+		// Trim lines that didn't change, for example, the line after an
+		// insertion at the beginning of a line.
+		newLines := splitLines(text.Bytes())
+		for first < oldEnd && len(newLines) > 0 && lines[first] == newLines[0] {
+			first++
+			newLines = newLines[1:]
+		}
+		for first < oldEnd && len(newLines) > 0 && lines[oldEnd-1] == newLines[len(newLines)-1] {
+			oldEnd--
+			newLines = newLines[:len(newLines)-1]
+		}
+		if first < oldEnd || len(newLines) > 0 {
+			changes = append(changes, lineChange{oldStart: first, oldEnd: oldEnd, newLines: newLines})
+		}
+		i = j
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- a/%s\n+++ b/%s\n", name, name)
+	delta := 0
+	for i := 0; i < len(changes); {
+		// Group changes whose context would overlap into one hunk.
+		j := i + 1
+		for j < len(changes) && changes[j].oldStart-changes[j-1].oldEnd <= 2*diffContext {
+			j++
+		}
+		hunkStart := changes[i].oldStart - diffContext
+		if hunkStart < 0 {
+			hunkStart = 0
+		}
+		hunkEnd := changes[j-1].oldEnd + diffContext
+		if hunkEnd > len(lines) {
+			hunkEnd = len(lines)
+		}
+
+		var body bytes.Buffer
+		oldLen, newLen := 0, 0
+		pos := hunkStart
+		for _, c := range changes[i:j] {
+			for ; pos < c.oldStart; pos++ {
+				writeDiffLine(&body, ' ', lines[pos])
+				oldLen++
+				newLen++
+			}
+			for ; pos < c.oldEnd; pos++ {
+				writeDiffLine(&body, '-', lines[pos])
+				oldLen++
+			}
+			for _, l := range c.newLines {
+				writeDiffLine(&body, '+', l)
+				newLen++
+			}
+		}
+		for ; pos < hunkEnd; pos++ {
+			writeDiffLine(&body, ' ', lines[pos])
+			oldLen++
+			newLen++
+		}
+
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(hunkStart, oldLen), hunkRange(hunkStart+delta, newLen))
+		buf.Write(body.Bytes())
+		delta += newLen - oldLen
+		i = j
+	}
+	return buf.String()
+}
+
+// splitLines splits data into lines, each including its trailing newline.
+// The last line may not have a newline.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n') + 1
+		if i == 0 {
+			i = len(data)
+		}
+		lines = append(lines, string(data[:i]))
+		data = data[i:]
+	}
+	return lines
+}
+
+func writeDiffLine(buf *bytes.Buffer, prefix byte, line string) {
+	buf.WriteByte(prefix)
+	buf.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		buf.WriteString("\n\\ No newline at end of file\n")
+	}
+}
+
+// hunkRange formats the start and length of a range of lines in a hunk
+// header. start is zero-based. By convention, an empty range starts at the
+// line before it.
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffEdits(t *testing.T) {
+	const tenLines = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"
+	for _, test := range []struct {
+		desc, content string
+		edits         []textEdit
+		want          string
+	}{
+		{
+			desc:    "no_change",
+			content: "a\nb\n",
+			edits:   []textEdit{{start: 0, end: 1, text: "a"}},
+			want:    "",
+		}, {
+			desc:    "replace",
+			content: tenLines,
+			edits:   []textEdit{{start: 8, end: 9, text: "five"}},
+			want: `--- a/f.go
++++ b/f.go
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`,
+		}, {
+			desc:    "insert_and_delete",
+			content: tenLines,
+			edits: []textEdit{
+				{start: 0, end: 0, text: "0\n"},
+				{start: 18, end: 21},
+			},
+			want: `--- a/f.go
++++ b/f.go
+@@ -1,3 +1,4 @@
++0
+ 1
+ 2
+ 3
+@@ -7,4 +8,3 @@
+ 7
+ 8
+ 9
+-10
+`,
+		}, {
+			desc:    "separate_hunks",
+			content: tenLines,
+			edits: []textEdit{
+				{start: 0, end: 1, text: "one"},
+				{start: 18, end: 20, text: "ten"},
+			},
+			want: `--- a/f.go
++++ b/f.go
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -7,4 +7,4 @@
+ 7
+ 8
+ 9
+-10
++ten
+`,
+		}, {
+			desc:    "no_newline",
+			content: "a\nb",
+			edits:   []textEdit{{start: 2, end: 3, text: "c"}},
+			want: `--- a/f.go
++++ b/f.go
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++c
+\ No newline at end of file
+`,
+		}, {
+			desc:    "append",
+			content: "a\n",
+			edits:   []textEdit{{start: 2, end: 2, text: "b\n"}},
+			want: `--- a/f.go
++++ b/f.go
+@@ -1 +1,2 @@
+ a
++b
+`,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got := diffEdits("f.go", []byte(test.content), test.edits)
+			if got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestEditsOverlap(t *testing.T) {
+	for _, test := range []struct {
+		a, b textEdit
+		want bool
+	}{
+		{textEdit{start: 0, end: 2}, textEdit{start: 2, end: 4}, false},
+		{textEdit{start: 0, end: 3}, textEdit{start: 2, end: 4}, true},
+		{textEdit{start: 2, end: 2}, textEdit{start: 2, end: 2}, true},
+		{textEdit{start: 1, end: 1}, textEdit{start: 0, end: 4}, true},
+	} {
+		if got := editsOverlap(test.a, test.b); got != test.want {
+			t.Errorf("editsOverlap(%v, %v): got %v; want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	got := strings.Join(splitLines([]byte("a\n\nb")), "|")
+	if want := "a\n|\n|b"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/ast"
+	"regexp"
+	"strings"
+)
+
+// generatedMarker matches the comment that marks generated files, as
+// described in https://golang.org/s/generatedcode.
+var generatedMarker = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// generatedSuffixes are suffixes of files written by known generators. Old
+// versions of some generators don't write the marker comment.
+var generatedSuffixes = []string{
+	".pb.go",
+	".pb.gw.go",
+}
+
+// isGeneratedFile reports whether the file f, named filename, was generated.
+// A file is generated if it has the standard marker comment before its
+// package clause or if its name has a suffix used by a known generator.
+func isGeneratedFile(filename string, f *ast.File) bool {
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(filename, suffix) {
+			return true
+		}
+	}
+	for _, group := range f.Comments {
+		if group.Pos() > f.Package {
+			break
+		}
+		for _, c := range group.List {
+			if generatedMarker.MatchString(c.Text) {
+				return true
+			}
+		}
+	}
+	return false
+}
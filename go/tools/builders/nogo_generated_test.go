@@ -0,0 +1,75 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestIsGeneratedFile(t *testing.T) {
+	for _, test := range []struct {
+		desc, filename, src string
+		want                bool
+	}{
+		{
+			desc:     "marker",
+			filename: "gen.go",
+			src:      "// Code generated by stringer; DO NOT EDIT.\n\npackage p\n",
+			want:     true,
+		}, {
+			desc:     "marker_after_license",
+			filename: "gen.go",
+			src:      "// Copyright 2020\n\n// Code generated by cmd/cgo; DO NOT EDIT.\n\npackage p\n",
+			want:     true,
+		}, {
+			desc:     "marker_after_package",
+			filename: "gen.go",
+			src:      "package p\n\n// Code generated by stringer; DO NOT EDIT.\n",
+			want:     false,
+		}, {
+			desc:     "marker_in_block_comment",
+			filename: "gen.go",
+			src:      "/* Code generated by stringer; DO NOT EDIT. */\n\npackage p\n",
+			want:     false,
+		}, {
+			desc:     "marker_not_whole_line",
+			filename: "gen.go",
+			src:      "// Code generated by stringer; DO NOT EDIT. Really.\n\npackage p\n",
+			want:     false,
+		}, {
+			desc:     "protoc",
+			filename: "foo/foo.pb.go",
+			src:      "package foo\n",
+			want:     true,
+		}, {
+			desc:     "plain",
+			filename: "foo.go",
+			src:      "// Package p does things.\npackage p\n",
+			want:     false,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			f, err := parser.ParseFile(token.NewFileSet(), test.filename, test.src, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := isGeneratedFile(test.filename, f); got != test.want {
+				t.Errorf("got %v; want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -32,12 +32,14 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"sort"
 	"strings"
 	"sync"
 
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 	"golang.org/x/tools/go/analysis"
 	"golang.org/x/tools/go/analysis/internal/facts"
 	"golang.org/x/tools/go/gcexportdata"
@@ -49,6 +51,22 @@ func init() {
 	}
 }
 
+// setAnalyzerFlags sets the flags of each analyzer to the values in its
+// configuration.
+func setAnalyzerFlags(analyzers []*analysis.Analyzer) error {
+	for _, a := range analyzers {
+		for name, value := range configs[a.Name].analyzerFlags {
+			if a.Flags.Lookup(name) == nil {
+				return fmt.Errorf("analyzer %q has no flag %q", a.Name, name)
+			}
+			if err := a.Flags.Set(name, value); err != nil {
+				return fmt.Errorf("analyzer %q: invalid value %q for flag %q: %v", a.Name, value, name, err)
+			}
+		}
+	}
+	return nil
+}
+
 var typesSizes = types.SizesFor("gc", os.Getenv("GOARCH"))
 
 func main() {
@@ -62,7 +80,7 @@ func main() {
 // run returns an error if there is a problem loading the package or if any
 // analysis fails.
 func run(args []string) error {
-	args, err := readParamsFiles(args)
+	args, err := buildenv.ReadParamsFiles(args)
 	if err != nil {
 		return fmt.Errorf("error reading paramfiles: %v", err)
 	}
@@ -73,26 +91,69 @@ func run(args []string) error {
 	importcfg := flags.String("importcfg", "", "The import configuration file")
 	packagePath := flags.String("p", "", "The package path (importmap) of the package being compiled")
 	xPath := flags.String("x", "", "The file where serialized facts should be written")
+	fixPath := flags.String("fix", "", "The file where a unified diff of suggested fixes should be written. If set, findings are printed but are not errors.")
+	sarifPath := flags.String("sarif", "", "The file where findings should be written in SARIF format. If set, findings are printed but are not errors.")
+	factsOnly := flags.Bool("facts_only", false, "If true, only analyzers that export facts (and the analyzers they require) are run, and findings are not reported")
 	flags.Parse(args)
 	srcs := flags.Args()
+	if err := setAnalyzerFlags(analyzers); err != nil {
+		return err
+	}
 
 	packageFile, importMap, err := readImportCfg(*importcfg)
 	if err != nil {
 		return fmt.Errorf("error parsing importcfg: %v", err)
 	}
 
-	diagnostics, facts, err := checkPackage(analyzers, *packagePath, packageFile, importMap, factMap, srcs)
+	if *factsOnly {
+		facts, err := packageFacts(analyzers, *packagePath, packageFile, importMap, factMap, srcs)
+		if err != nil {
+			return fmt.Errorf("error running analyzers: %v", err)
+		}
+		if err := ioutil.WriteFile(buildenv.Abs(*xPath), facts, 0666); err != nil {
+			return fmt.Errorf("error writing facts: %v", err)
+		}
+		return nil
+	}
+
+	diagnostics, facts, reported, err := checkPackage(analyzers, *packagePath, packageFile, importMap, factMap, srcs)
 	if err != nil {
 		return fmt.Errorf("error running analyzers: %v", err)
 	}
-	if diagnostics != "" {
-		return fmt.Errorf("errors found by nogo during build-time code analysis:\n%s\n", diagnostics)
+	if *fixPath != "" {
+		fixes, err := suggestedFixes(reported)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(buildenv.Abs(*fixPath), []byte(fixes), 0666); err != nil {
+			return fmt.Errorf("error writing fixes: %v", err)
+		}
 	}
+	if *sarifPath != "" {
+		report, err := sarifReport(sarifFindings(reported))
+		if err != nil {
+			return fmt.Errorf("error encoding SARIF report: %v", err)
+		}
+		if err := ioutil.WriteFile(buildenv.Abs(*sarifPath), report, 0666); err != nil {
+			return fmt.Errorf("error writing SARIF report: %v", err)
+		}
+	}
+	// Facts are written even if there are findings. nogo_test reports
+	// findings without failing, and dependent packages still need the facts.
 	if *xPath != "" {
-		if err := ioutil.WriteFile(abs(*xPath), facts, 0666); err != nil {
+		if err := ioutil.WriteFile(buildenv.Abs(*xPath), facts, 0666); err != nil {
 			return fmt.Errorf("error writing facts: %v", err)
 		}
 	}
+	if *fixPath != "" || *sarifPath != "" {
+		// Findings are collected in other outputs, so they don't fail the
+		// build.
+		if diagnostics != "" {
+			fmt.Fprintf(os.Stderr, "findings from nogo during build-time code analysis:\n%s\n", diagnostics)
+		}
+	} else if diagnostics != "" {
+		return fmt.Errorf("errors found by nogo during build-time code analysis:\n%s\n", diagnostics)
+	}
 
 	return nil
 }
@@ -140,12 +201,55 @@ func readImportCfg(file string) (packageFile map[string]string, importMap map[st
 	return packageFile, importMap, nil
 }
 
+// packageFacts runs the analyzers that declare fact types, including those
+// only required by the given analyzers, on the specified package and returns
+// the encoded facts for importers of the package. Other analyzers are
+// skipped, since they can't affect the facts. For example, an analyzer that
+// only reads summaries exported by ssasummary doesn't run here, but
+// ssasummary does. Diagnostics and analyzer errors are ignored. They're
+// reported when the package is checked with checkPackage.
+func packageFacts(analyzers []*analysis.Analyzer, packagePath string, packageFile, importMap map[string]string, factMap map[string]string, filenames []string) ([]byte, error) {
+	factAnalyzers := factProducers(analyzers)
+	if len(factAnalyzers) == 0 {
+		// There's nothing to export, so don't bother loading the package.
+		return nil, nil
+	}
+	_, facts, _, err := checkPackage(factAnalyzers, packagePath, packageFile, importMap, factMap, filenames)
+	return facts, err
+}
+
+// factProducers returns the analyzers that declare fact types among the
+// given analyzers and the analyzers they require, transitively.
+func factProducers(analyzers []*analysis.Analyzer) []*analysis.Analyzer {
+	var producers []*analysis.Analyzer
+	seen := make(map[*analysis.Analyzer]bool)
+	var visit func(a *analysis.Analyzer)
+	visit = func(a *analysis.Analyzer) {
+		if seen[a] {
+			return
+		}
+		seen[a] = true
+		if len(a.FactTypes) > 0 {
+			producers = append(producers, a)
+		}
+		for _, req := range a.Requires {
+			visit(req)
+		}
+	}
+	for _, a := range analyzers {
+		visit(a)
+	}
+	return producers
+}
+
 // checkPackage runs all the given analyzers on the specified package and
 // returns the source code diagnostics that the must be printed in the build log.
 // It returns an empty string if no source code diagnostics need to be printed.
+// checkPackage also returns the diagnostics themselves, so they can be
+// written in other formats.
 //
 // This implementation was adapted from that of golang.org/x/tools/go/checker/internal/checker.
-func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFile, importMap map[string]string, factMap map[string]string, filenames []string) (string, []byte, error) {
+func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFile, importMap map[string]string, factMap map[string]string, filenames []string) (string, []byte, findings, error) {
 	// Register fact types and establish dependencies between analyzers.
 	actions := make(map[*analysis.Analyzer]*action)
 	var visit func(a *analysis.Analyzer) *action
@@ -179,7 +283,7 @@ func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFil
 	imp := newImporter(importMap, packageFile, factMap)
 	pkg, err := load(packagePath, imp, filenames)
 	if err != nil {
-		return "", nil, fmt.Errorf("error loading package: %v", err)
+		return "", nil, findings{}, fmt.Errorf("error loading package: %v", err)
 	}
 	for _, act := range actions {
 		act.pkg = pkg
@@ -189,9 +293,26 @@ func checkPackage(analyzers []*analysis.Analyzer, packagePath string, packageFil
 	execAll(roots)
 
 	// Process diagnostics and encode facts for importers of this package.
-	diagnostics := checkAnalysisResults(roots, pkg)
+	diagnostics, reported := checkAnalysisResults(roots, pkg)
 	facts := pkg.facts.Encode()
-	return diagnostics, facts, nil
+	return diagnostics, facts, findings{pkg: pkg, diagnostics: reported}, nil
+}
+
+// diagnostic is a diagnostic reported by an analyzer.
+type diagnostic struct {
+	analysis.Diagnostic
+	analyzer *analysis.Analyzer
+
+	// inBaseline is true if the diagnostic is a known finding listed in the
+	// baseline. Such diagnostics are not printed in the build log.
+	inBaseline bool
+}
+
+// findings are the diagnostics reported for a package, including those
+// listed in the baseline.
+type findings struct {
+	pkg         *goPackage
+	diagnostics []diagnostic
 }
 
 // An action represents one unit of analysis work: the application of
@@ -364,10 +485,12 @@ func (g *goPackage) String() string {
 
 // checkAnalysisResults checks the analysis diagnostics in the given actions
 // and returns a string containing all the diagnostics that should be printed
-// to the build log.
-func checkAnalysisResults(actions []*action, pkg *goPackage) string {
-	var diagnostics []analysis.Diagnostic
+// to the build log, along with the diagnostics themselves. Diagnostics listed
+// in the baseline are returned but not printed.
+func checkAnalysisResults(actions []*action, pkg *goPackage) (string, []diagnostic) {
+	var diagnostics []diagnostic
 	var errs []error
+	var generated map[string]bool
 	for _, act := range actions {
 		if act.err != nil {
 			// Analyzer failed.
@@ -381,7 +504,9 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 		if !ok {
 			// If the analyzer is not explicitly configured, it emits diagnostics for
 			// all files.
-			diagnostics = append(diagnostics, act.diagnostics...)
+			for _, d := range act.diagnostics {
+				diagnostics = append(diagnostics, diagnostic{Diagnostic: d, analyzer: act.a, inBaseline: inBaseline(act.a, d, pkg)})
+			}
 			continue
 		}
 		// Discard diagnostics based on the analyzer configuration.
@@ -412,13 +537,19 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 					}
 				}
 			}
+			if include && config.excludeGenerated {
+				if generated == nil {
+					generated = generatedFiles(pkg)
+				}
+				include = !generated[filename]
+			}
 			if include {
-				diagnostics = append(diagnostics, d)
+				diagnostics = append(diagnostics, diagnostic{Diagnostic: d, analyzer: act.a, inBaseline: inBaseline(act.a, d, pkg)})
 			}
 		}
 	}
 	if len(diagnostics) == 0 && len(errs) == 0 {
-		return ""
+		return "", nil
 	}
 
 	sort.Slice(diagnostics, func(i, j int) bool {
@@ -432,11 +563,164 @@ func checkAnalysisResults(actions []*action, pkg *goPackage) string {
 		errMsg.WriteString(err.Error())
 	}
 	for _, d := range diagnostics {
+		if d.inBaseline {
+			continue
+		}
 		errMsg.WriteString(sep)
 		sep = "\n"
 		fmt.Fprintf(errMsg, "%s: %s", pkg.fset.Position(d.Pos), d.Message)
 	}
-	return errMsg.String()
+	return errMsg.String(), diagnostics
+}
+
+// generatedFiles returns the names of generated files in pkg.
+func generatedFiles(pkg *goPackage) map[string]bool {
+	generated := make(map[string]bool)
+	for _, f := range pkg.syntax {
+		filename := pkg.fset.File(f.Pos()).Name()
+		if isGeneratedFile(filename, f) {
+			generated[filename] = true
+		}
+	}
+	return generated
+}
+
+// inBaseline reports whether d is a known finding listed in the baseline.
+func inBaseline(a *analysis.Analyzer, d analysis.Diagnostic, pkg *goPackage) bool {
+	if len(baseline) == 0 {
+		return false
+	}
+	file := "-"
+	if f := pkg.fset.File(d.Pos); f != nil {
+		file = execRootRelPath(f.Name())
+	}
+	return baseline[baselineEntry{file: file, analyzer: a.Name, hash: baselineHash(d.Message)}]
+}
+
+// execRootRelPath returns the slash-separated path of a file relative to the
+// execution root, which is the workspace root for source files in the main
+// repository.
+func execRootRelPath(filename string) string {
+	if rel, err := filepath.Rel(buildenv.Abs("."), buildenv.Abs(filename)); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(filename)
+}
+
+// suggestedFixes returns a unified diff that applies the first suggested fix
+// of each diagnostic. Fixes that overlap an earlier fix are skipped; running
+// nogo again after applying the diff will suggest them again. Only files in
+// the workspace are fixed. Generated files and files in external
+// repositories are skipped.
+func suggestedFixes(reported findings) (string, error) {
+	pkg := reported.pkg
+	editsByFile := make(map[string][]textEdit)
+	for _, d := range reported.diagnostics {
+		if len(d.SuggestedFixes) == 0 {
+			continue
+		}
+		fileEdits := make(map[string][]textEdit)
+		valid := true
+		for _, e := range d.SuggestedFixes[0].TextEdits {
+			f := pkg.fset.File(e.Pos)
+			if f == nil {
+				valid = false
+				break
+			}
+			end := e.End
+			if !end.IsValid() {
+				end = e.Pos
+			}
+			edit := textEdit{start: f.Offset(e.Pos), end: f.Offset(end), text: string(e.NewText)}
+			for _, prev := range editsByFile[f.Name()] {
+				if editsOverlap(prev, edit) {
+					valid = false
+				}
+			}
+			fileEdits[f.Name()] = append(fileEdits[f.Name()], edit)
+		}
+		if !valid {
+			continue
+		}
+		for name, edits := range fileEdits {
+			editsByFile[name] = append(editsByFile[name], edits...)
+		}
+	}
+
+	names := make([]string, 0, len(editsByFile))
+	for name := range editsByFile {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	execRoot := buildenv.Abs(".")
+	buf := &bytes.Buffer{}
+	for _, name := range names {
+		rel, err := filepath.Rel(execRoot, buildenv.Abs(name))
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if strings.HasPrefix(rel, "../") || strings.HasPrefix(rel, "bazel-out/") || strings.HasPrefix(rel, "external/") {
+			continue
+		}
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("error reading file to fix: %v", err)
+		}
+		buf.WriteString(diffEdits(rel, content, editsByFile[name]))
+	}
+	return buf.String(), nil
+}
+
+// sarifFindings converts reported diagnostics to findings for a SARIF report.
+// File paths are relative to the execution root.
+func sarifFindings(reported findings) []sarifFinding {
+	lines := make(map[string][][]byte)
+	column := func(pos token.Position) int {
+		fileLines, ok := lines[pos.Filename]
+		if !ok {
+			// If the file can't be read, columns are reported in bytes, which
+			// is only wrong for lines with non-ASCII text.
+			if content, err := ioutil.ReadFile(pos.Filename); err == nil {
+				fileLines = bytes.SplitAfter(content, []byte("\n"))
+			}
+			lines[pos.Filename] = fileLines
+		}
+		if pos.Line < 1 || pos.Line > len(fileLines) {
+			return pos.Column
+		}
+		return utf16Column(fileLines[pos.Line-1], pos.Column)
+	}
+
+	sarif := make([]sarifFinding, 0, len(reported.diagnostics))
+	for _, d := range reported.diagnostics {
+		f := sarifFinding{
+			analyzer:    d.analyzer.Name,
+			analyzerDoc: d.analyzer.Doc,
+			category:    d.Category,
+			message:     d.Message,
+		}
+		if len(baseline) > 0 {
+			f.baselineState = "new"
+			if d.inBaseline {
+				f.baselineState = "unchanged"
+			}
+		}
+		// NOTE(golang.org/issue/31008): nilness does not set positions.
+		if start := reported.pkg.fset.Position(d.Pos); start.IsValid() {
+			f.file = execRootRelPath(start.Filename)
+			f.startLine = start.Line
+			f.startColumn = column(start)
+			if d.End.IsValid() {
+				if end := reported.pkg.fset.Position(d.End); end.Filename == start.Filename {
+					f.endLine = end.Line
+					f.endColumn = column(end)
+				}
+			}
+		}
+		sarif = append(sarif, f)
+	}
+	return sarif
 }
 
 // config determines which source files an analyzer will emit diagnostics for.
@@ -451,6 +735,14 @@ type config struct {
 	// excludeFiles is a list of regular expressions that match files that an
 	// analyzer will not emit diagnostics for.
 	excludeFiles []*regexp.Regexp
+
+	// excludeGenerated is true if the analyzer will not emit diagnostics for
+	// generated files. See isGeneratedFile.
+	excludeGenerated bool
+
+	// analyzerFlags maps the names of flags in the analyzer's flag set to
+	// the values they're set to before analysis.
+	analyzerFlags map[string]string
 }
 
 // importer is an implementation of go/types.Importer that imports type
@@ -0,0 +1,228 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// sarifFinding is a nogo diagnostic to be reported in a SARIF log. It is
+// independent of the analysis package so it can be tested without it.
+type sarifFinding struct {
+	// analyzer is the name of the analyzer that reported the finding, and
+	// analyzerDoc is its documentation.
+	analyzer, analyzerDoc string
+
+	// category optionally classifies the finding within the analyzer.
+	category string
+
+	message string
+
+	// file is the slash-separated path of the file relative to the
+	// workspace root. It is empty if the finding has no position.
+	file string
+
+	// startLine, startColumn, endLine, and endColumn locate the finding
+	// within file. Lines and columns are one-based, and columns are counted
+	// in UTF-16 code units as SARIF expects. end may be zero if unknown.
+	startLine, startColumn, endLine, endColumn int
+
+	// baselineState is "unchanged" if the finding is listed in the nogo
+	// baseline, or "new" if it's not. It's empty if there is no baseline.
+	baselineState string
+}
+
+// ruleID returns the identifier of the SARIF rule for a finding. Findings
+// of different categories within an analyzer are reported as separate rules.
+func (f sarifFinding) ruleID() string {
+	if f.category == "" {
+		return f.analyzer
+	}
+	return f.analyzer + "/" + f.category
+}
+
+// The types below are the subset of the SARIF 2.1.0 object model used
+// by nogo. See https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html.
+
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	Name                 string             `json:"name"`
+	ShortDescription     *sarifMessage      `json:"shortDescription,omitempty"`
+	FullDescription      *sarifMessage      `json:"fullDescription,omitempty"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+	Properties           map[string]string  `json:"properties,omitempty"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID        string          `json:"ruleId"`
+	RuleIndex     int             `json:"ruleIndex"`
+	Level         string          `json:"level"`
+	Message       sarifMessage    `json:"message"`
+	Locations     []sarifLocation `json:"locations,omitempty"`
+	BaselineState string          `json:"baselineState,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+// sarifReport returns a SARIF 2.1.0 log containing findings. Each distinct
+// rule is described once in the log. All findings have the "error" level,
+// since nogo fails the build when it reports them.
+func sarifReport(findings []sarifFinding) ([]byte, error) {
+	ruleIndex := make(map[string]int)
+	var rules []sarifRule
+	for _, f := range findings {
+		id := f.ruleID()
+		if _, ok := ruleIndex[id]; ok {
+			continue
+		}
+		ruleIndex[id] = -1
+		rule := sarifRule{
+			ID:                   id,
+			Name:                 f.analyzer,
+			DefaultConfiguration: sarifConfiguration{Level: "error"},
+			Properties:           map[string]string{"analyzer": f.analyzer},
+		}
+		if doc := strings.TrimSpace(f.analyzerDoc); doc != "" {
+			short := doc
+			if i := strings.Index(short, "\n\n"); i >= 0 {
+				short = short[:i]
+			}
+			rule.ShortDescription = &sarifMessage{Text: strings.Join(strings.Fields(short), " ")}
+			rule.FullDescription = &sarifMessage{Text: doc}
+		}
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	for i, r := range rules {
+		ruleIndex[r.ID] = i
+	}
+
+	results := make([]sarifResult, 0, len(findings))
+	for _, f := range findings {
+		id := f.ruleID()
+		result := sarifResult{
+			RuleID:        id,
+			RuleIndex:     ruleIndex[id],
+			Level:         "error",
+			Message:       sarifMessage{Text: f.message},
+			BaselineState: f.baselineState,
+		}
+		if f.file != "" {
+			loc := sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: f.file, URIBaseID: "%SRCROOT%"},
+			}
+			if f.startLine > 0 {
+				loc.Region = &sarifRegion{
+					StartLine:   f.startLine,
+					StartColumn: f.startColumn,
+					EndLine:     f.endLine,
+					EndColumn:   f.endColumn,
+				}
+			}
+			result.Locations = []sarifLocation{{PhysicalLocation: loc}}
+		}
+		results = append(results, result)
+	}
+
+	report := sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "nogo",
+				InformationURI: "https://github.com/bazelbuild/rules_go/blob/master/go/nogo.rst",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+	if report.Runs[0].Tool.Driver.Rules == nil {
+		report.Runs[0].Tool.Driver.Rules = []sarifRule{}
+	}
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// utf16Column converts a one-based byte column within line to a one-based
+// column counted in UTF-16 code units.
+func utf16Column(line []byte, byteColumn int) int {
+	if byteColumn < 1 {
+		return byteColumn
+	}
+	if byteColumn-1 > len(line) {
+		byteColumn = len(line) + 1
+	}
+	col := 1
+	for b := line[:byteColumn-1]; len(b) > 0; {
+		r, size := utf8.DecodeRune(b)
+		if r >= 0x10000 {
+			col += 2
+		} else {
+			col++
+		}
+		b = b[size:]
+	}
+	return col
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSARIFReport(t *testing.T) {
+	data, err := sarifReport([]sarifFinding{
+		{
+			analyzer:    "printf",
+			analyzerDoc: "check consistency\nof Printf calls\n\nMore details.",
+			message:     "bad format",
+			file:        "pkg/a.go",
+			startLine:   3,
+			startColumn: 2,
+			endLine:     3,
+			endColumn:   10,
+		}, {
+			analyzer:      "nilness",
+			message:       "no position",
+			baselineState: "unchanged",
+		}, {
+			analyzer:    "printf",
+			analyzerDoc: "check consistency\nof Printf calls\n\nMore details.",
+			category:    "verbs",
+			message:     "bad verb",
+			file:        "pkg/b.go",
+			startLine:   1,
+			startColumn: 1,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Version string
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Name  string
+					Rules []struct {
+						ID               string
+						Name             string
+						ShortDescription *struct{ Text string }
+					}
+				}
+			}
+			Results []struct {
+				RuleID        string
+				RuleIndex     int
+				Level         string
+				Message       struct{ Text string }
+				BaselineState string
+				Locations     []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI, URIBaseID string }
+						Region           map[string]int
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != "2.1.0" || len(got.Runs) != 1 {
+		t.Fatalf("got version %q with %d runs; want 2.1.0 with 1 run", got.Version, len(got.Runs))
+	}
+	run := got.Runs[0]
+
+	var ruleIDs []string
+	for _, r := range run.Tool.Driver.Rules {
+		ruleIDs = append(ruleIDs, r.ID)
+	}
+	if want := []string{"nilness", "printf", "printf/verbs"}; !reflect.DeepEqual(ruleIDs, want) {
+		t.Errorf("got rules %q; want %q", ruleIDs, want)
+	}
+	if d := run.Tool.Driver.Rules[1].ShortDescription; d == nil || d.Text != "check consistency of Printf calls" {
+		t.Errorf("got short description %v; want %q", d, "check consistency of Printf calls")
+	}
+
+	if len(run.Results) != 3 {
+		t.Fatalf("got %d results; want 3", len(run.Results))
+	}
+	for _, r := range run.Results {
+		if r.Level != "error" {
+			t.Errorf("%s: got level %q; want error", r.Message.Text, r.Level)
+		}
+		if got := run.Tool.Driver.Rules[r.RuleIndex].ID; got != r.RuleID {
+			t.Errorf("%s: rule index points to %q; want %q", r.Message.Text, got, r.RuleID)
+		}
+	}
+	if got := run.Results[1].BaselineState; got != "unchanged" {
+		t.Errorf("got baseline state %q; want unchanged", got)
+	}
+	if got := run.Results[0].BaselineState; got != "" {
+		t.Errorf("got baseline state %q without a baseline; want none", got)
+	}
+	if locs := run.Results[1].Locations; len(locs) != 0 {
+		t.Errorf("got locations for finding without a position: %v", locs)
+	}
+	loc := run.Results[0].Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "pkg/a.go" || loc.ArtifactLocation.URIBaseID != "%SRCROOT%" {
+		t.Errorf("got artifact location %+v", loc.ArtifactLocation)
+	}
+	wantRegion := map[string]int{"startLine": 3, "startColumn": 2, "endLine": 3, "endColumn": 10}
+	if !reflect.DeepEqual(loc.Region, wantRegion) {
+		t.Errorf("got region %v; want %v", loc.Region, wantRegion)
+	}
+}
+
+func TestUTF16Column(t *testing.T) {
+	line := []byte("aé\U0001F600b\n")
+	for _, test := range []struct {
+		byteColumn, want int
+	}{
+		{1, 1},
+		{2, 2},
+		{4, 3}, // after the two-byte é
+		{8, 5}, // after the emoji, which is two UTF-16 code units
+		{100, 7},
+	} {
+		if got := utf16Column(line, test.byteColumn); got != test.want {
+			t.Errorf("utf16Column(%q, %d): got %d; want %d", line, test.byteColumn, got, test.want)
+		}
+	}
+}
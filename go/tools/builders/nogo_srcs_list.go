@@ -0,0 +1,91 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nogoSrcsBinDir stands for the output directory of the configuration in
+// the names of generated files in a list written by formatNogoSrcsList.
+const nogoSrcsBinDir = "$(BINDIR)/"
+
+// formatNogoSrcsList lists the names of the Go files nogo should check,
+// one per line. Names are relative to the execution root, so the list is
+// the same no matter which directory the action ran in. The compile action
+// writes the list into the export data file as nogoSrcsMember.
+//
+// The export data file is usually the same when a package is built in a
+// different configuration, so the names of generated files, like those
+// written by cgo, start with nogoSrcsBinDir instead of a directory like
+// bazel-out/k8-fastbuild/bin.
+func formatNogoSrcsList(srcs []string) ([]byte, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	for _, src := range srcs {
+		if rel, err := filepath.Rel(wd, src); err == nil && !strings.HasPrefix(rel, "..") {
+			src = rel
+		}
+		src = filepath.ToSlash(src)
+		if _, rest, ok := splitBinDir(src); ok {
+			src = nogoSrcsBinDir + rest
+		}
+		fmt.Fprintln(buf, src)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseNogoSrcsList returns the file names in a list written by
+// formatNogoSrcsList. Generated files are in the output directory of the
+// configuration of exportDataPath, the file the list was read from.
+func parseNogoSrcsList(data []byte, exportDataPath string) ([]string, error) {
+	binDir, _, hasBinDir := splitBinDir(filepath.ToSlash(exportDataPath))
+	var names []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, nogoSrcsBinDir) {
+			if !hasBinDir {
+				return nil, fmt.Errorf("%s: can't locate generated file %s: not in an output directory", exportDataPath, line)
+			}
+			line = binDir + strings.TrimPrefix(line, nogoSrcsBinDir)
+		}
+		names = append(names, filepath.FromSlash(line))
+	}
+	return names, nil
+}
+
+// splitBinDir splits a slash-separated path to an output file into the
+// output directory of its configuration, like bazel-out/k8-fastbuild/bin/,
+// and the rest of the path. ok is false if the path isn't in an output
+// directory.
+func splitBinDir(path string) (binDir, rest string, ok bool) {
+	parts := strings.Split(path, "/")
+	for i := 0; i+3 < len(parts); i++ {
+		if parts[i] == "bazel-out" && parts[i+2] == "bin" {
+			binDir = strings.Join(parts[:i+3], "/") + "/"
+			return binDir, path[len(binDir):], true
+		}
+	}
+	return "", path, false
+}
@@ -0,0 +1,59 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestNogoSrcsList(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcs := []string{
+		filepath.Join(wd, "pkg", "a.go"),
+		filepath.Join(wd, "bazel-out", "k8-fastbuild-race", "bin", "pkg", "_cgo_gotypes.go"),
+	}
+	data, err := formatNogoSrcsList(srcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Generated files don't depend on the configuration the list was
+	// written in.
+	if want := "pkg/a.go\n$(BINDIR)/pkg/_cgo_gotypes.go\n"; string(data) != want {
+		t.Errorf("got list %q; want %q", data, want)
+	}
+
+	got, err := parseNogoSrcsList(data, filepath.FromSlash("bazel-out/k8-opt/bin/pkg/pkg.x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.FromSlash("pkg/a.go"),
+		filepath.FromSlash("bazel-out/k8-opt/bin/pkg/_cgo_gotypes.go"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	if _, err := parseNogoSrcsList(data, "pkg.x"); err == nil {
+		t.Error("parsing a list with generated files outside an output directory: got success; want error")
+	}
+}
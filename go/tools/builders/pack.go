@@ -17,6 +17,7 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"flag"
 	"fmt"
@@ -27,6 +28,8 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 // pack copies an .a file and appends a list of .o files to the copy using
@@ -37,13 +40,18 @@ import (
 // pack has a primitive parser for these formats, since cmd/pack can't
 // handle them, and ar may not be available (cpp.ar_executable is libtool
 // on darwin).
+//
+// When there's nothing to append, the archive is only copied: go tool pack
+// isn't run, and no temporary directory is created. pack doesn't produce
+// thin archives, which would avoid the copy, since the Go linker can't read
+// them.
 func pack(args []string) error {
-	args, err := readParamsFiles(args)
+	args, err := buildenv.ReadParamsFiles(args)
 	if err != nil {
 		return err
 	}
 	flags := flag.NewFlagSet("GoPack", flag.ExitOnError)
-	goenv := envFlags(flags)
+	goenv := buildenv.EnvFlags(flags)
 	inArchive := flags.String("in", "", "Path to input archive")
 	outArchive := flags.String("out", "", "Path to output archive")
 	objects := multiFlag{}
@@ -53,13 +61,16 @@ func pack(args []string) error {
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
-	if err := goenv.checkFlags(); err != nil {
+	if err := goenv.CheckFlags(); err != nil {
 		return err
 	}
 
-	if err := copyFile(abs(*inArchive), abs(*outArchive)); err != nil {
+	if err := copyFile(buildenv.Abs(*inArchive), buildenv.Abs(*outArchive)); err != nil {
 		return err
 	}
+	if len(objects) == 0 && len(archives) == 0 {
+		return nil
+	}
 
 	dir, err := ioutil.TempDir("", "go-pack")
 	if err != nil {
@@ -75,8 +86,11 @@ func pack(args []string) error {
 		}
 		objects = append(objects, archiveObjects...)
 	}
+	if len(objects) == 0 {
+		return nil
+	}
 
-	return appendFiles(goenv, abs(*outArchive), objects)
+	return appendFiles(goenv, buildenv.Abs(*outArchive), objects)
 }
 
 func copyFile(inPath, outPath string) error {
@@ -325,8 +339,265 @@ func simpleName(name string, names map[string]struct{}) (string, error) {
 	return "", fmt.Errorf("cannot shorten file name: %q", name)
 }
 
-func appendFiles(goenv *env, archive string, files []string) error {
-	args := goenv.goTool("pack", "r", archive)
+func appendFiles(goenv *buildenv.Env, archive string, files []string) error {
+	args := goenv.GoTool("pack", "r", archive)
 	args = append(args, files...)
-	return goenv.runCommand(args)
+	return goenv.RunCommand(args)
+}
+
+// archiveMember is a named file written into an archive by writeExportData.
+type archiveMember struct {
+	name string
+	data []byte
+}
+
+// nogoSrcsMember is the name of the member of the export data file that
+// lists the Go files nogo should check. See formatNogoSrcsList.
+const nogoSrcsMember = "nogo_srcs"
+
+// writeExportData copies the export data from a compiled archive to a new
+// archive. The export data is all the compiler and nogo need from packages
+// imported by the package they're working on, and it's much smaller than the
+// compiled code. It's also usually the same when the package is compiled in a
+// different mode, for example, with -race, so actions in dependent packages
+// may be cached.
+//
+// members are written after the export data. The file is the one small
+// output of the compile action other actions read, so anything else they
+// need from it is stored here instead of in more files. The compiler and
+// nogo only read the export data, which must be the first member. Members
+// must not depend on the configuration, or the file would no longer be
+// shared across configurations. Facts and findings are written by the nogo
+// actions, not the compile action, so they stay in their own files.
+func writeExportData(archive, outPath string, members ...archiveMember) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(arHeader))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != arHeader {
+		return fmt.Errorf("%s: bad header", archive)
+	}
+	var nameData []byte
+	for {
+		name, size, err := readMetadata(r, &nameData)
+		if err == io.EOF {
+			return fmt.Errorf("%s: export data not found", archive)
+		}
+		if err != nil {
+			return err
+		}
+		if name != "__.PKGDEF" {
+			if err := skipFile(r, size); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Timestamps, owners, and modes are zeroed, so the output only
+		// depends on the export data.
+		buf := &bytes.Buffer{}
+		fmt.Fprintf(buf, "%s%-16s%-12d%-6d%-6d%-8o%-10d`\n", arHeader, name, 0, 0, 0, 0644, size)
+		if _, err := io.CopyN(buf, r, size); err != nil {
+			return err
+		}
+		if size%2 != 0 {
+			buf.WriteByte('\n')
+		}
+		for _, m := range members {
+			fmt.Fprintf(buf, "%-16s%-12d%-6d%-6d%-8o%-10d`\n", m.name, 0, 0, 0, 0644, len(m.data))
+			buf.Write(m.data)
+			if len(m.data)%2 != 0 {
+				buf.WriteByte('\n')
+			}
+		}
+		return ioutil.WriteFile(outPath, buf.Bytes(), 0666)
+	}
+}
+
+// readArchiveMember returns the contents of the named member of an archive,
+// like one written by writeExportData.
+func readArchiveMember(archive, member string) ([]byte, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+
+	header := make([]byte, len(arHeader))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != arHeader {
+		return nil, fmt.Errorf("%s: bad header", archive)
+	}
+	var nameData []byte
+	for {
+		name, size, err := readMetadata(r, &nameData)
+		if err == io.EOF {
+			return nil, fmt.Errorf("%s: %s not found", archive, member)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if name != member {
+			if err := skipFile(r, size); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data, nil
+	}
+}
+
+// errUnknownObjectFormat is returned by readArchiveImports when an archive
+// contains a Go object file in a format it doesn't understand, for example,
+// one written by a newer compiler.
+var errUnknownObjectFormat = errors.New("unknown Go object file format")
+
+// goObjectMagic identifies the Go object file format read by
+// readObjectImports. It's the same from Go 1.20 on.
+const goObjectMagic = "\x00go120ld"
+
+// readArchiveImports returns the package paths imported by the Go object
+// files in an archive. These are the packages the linker loads after the
+// archive, as recorded in the autolib table of each object. The export data
+// in __.PKGDEF and objects not written by the Go toolchain, like those
+// compiled from C, are skipped. Only the headers of members and the parts of
+// objects holding the autolib table are read, so this is cheap even for large
+// archives.
+func readArchiveImports(archive string) ([]string, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cr := &countingReader{r: f}
+	r := bufio.NewReader(cr)
+
+	header := make([]byte, len(arHeader))
+	if _, err := io.ReadFull(r, header); err != nil || string(header) != arHeader {
+		return nil, fmt.Errorf("%s: bad header", archive)
+	}
+	var imports []string
+	var nameData []byte
+	for {
+		name, size, err := readMetadata(r, &nameData)
+		if err == io.EOF {
+			return imports, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset := cr.n - int64(r.Buffered())
+		if name != "__.PKGDEF" {
+			objImports, err := readObjectImports(f, offset, size)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", archive, name, err)
+			}
+			imports = append(imports, objImports...)
+		}
+
+		// Seek past the member instead of reading it. Members are aligned at
+		// 2-byte offsets.
+		next := offset + size + size%2
+		if _, err := f.Seek(next, io.SeekStart); err != nil {
+			return nil, err
+		}
+		cr.n = next
+		r.Reset(cr)
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// readObjectImports returns the package paths in the autolib table of a Go
+// object file of the given size at offset in r. Objects that don't start with
+// a "go object" header aren't Go objects, and nil is returned for them.
+func readObjectImports(r io.ReaderAt, offset, size int64) ([]string, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, offset, size))
+	line, err := br.ReadSlice('\n')
+	if !bytes.HasPrefix(line, []byte("go object ")) {
+		return nil, nil
+	}
+
+	// The header is followed by optional sections delimited by "$$" lines,
+	// then by a "!" line and the object itself. The sections may contain "!"
+	// lines, so the delimiters are counted, as the linker does. Lines longer
+	// than the buffer are read in pieces.
+	objOffset := int64(len(line))
+	markers, lineStart := 0, err == nil
+	for {
+		line, err = br.ReadSlice('\n')
+		objOffset += int64(len(line))
+		if err == bufio.ErrBufferFull {
+			lineStart = false
+			continue
+		} else if err != nil {
+			return nil, errUnknownObjectFormat
+		}
+		if lineStart {
+			if markers%2 == 0 && string(line) == "!\n" {
+				break
+			}
+			if bytes.HasPrefix(line, []byte("$$")) {
+				markers++
+			}
+		}
+		lineStart = true
+	}
+	offset += objOffset
+	size -= objOffset
+
+	// The object starts with the magic string, an 8-byte fingerprint, 4 bytes
+	// of flags, and the offsets of its blocks. The autolib block comes first,
+	// and each of its entries is a reference to a package path in the string
+	// table (a 4-byte length and a 4-byte offset) followed by the package's
+	// 8-byte fingerprint. Numbers are little-endian.
+	const (
+		offsetsStart    = len(goObjectMagic) + 8 + 4
+		importEntrySize = 16
+	)
+	header := make([]byte, offsetsStart+8)
+	if _, err := r.ReadAt(header, offset); err != nil || string(header[:len(goObjectMagic)]) != goObjectMagic {
+		return nil, errUnknownObjectFormat
+	}
+	start := binary.LittleEndian.Uint32(header[offsetsStart:])
+	end := binary.LittleEndian.Uint32(header[offsetsStart+4:])
+	if start > end || int64(end) > size || (end-start)%importEntrySize != 0 {
+		return nil, errUnknownObjectFormat
+	}
+	autolib := make([]byte, end-start)
+	if _, err := r.ReadAt(autolib, offset+int64(start)); err != nil {
+		return nil, err
+	}
+	var imports []string
+	for off := 0; off < len(autolib); off += importEntrySize {
+		n := binary.LittleEndian.Uint32(autolib[off:])
+		strOff := binary.LittleEndian.Uint32(autolib[off+4:])
+		if int64(strOff)+int64(n) > size {
+			return nil, errUnknownObjectFormat
+		}
+		path := make([]byte, n)
+		if _, err := r.ReadAt(path, offset+int64(strOff)); err != nil {
+			return nil, err
+		}
+		imports = append(imports, string(path))
+	}
+	return imports, nil
 }
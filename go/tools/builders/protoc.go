@@ -26,6 +26,8 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 type genFileInfo struct {
@@ -40,7 +42,7 @@ type genFileInfo struct {
 
 func run(args []string) error {
 	// process the args
-	args, err := readParamsFiles(args)
+	args, err := buildenv.ReadParamsFiles(args)
 	if err != nil {
 		return err
 	}
@@ -53,6 +55,7 @@ func run(args []string) error {
 	outPath := flags.String("out_path", "", "The base output path to write to.")
 	plugin := flags.String("plugin", "", "The go plugin to use.")
 	importpath := flags.String("importpath", "", "The importpath for the generated sources.")
+	checkGoPackages := flags.Bool("check_go_package", false, "Whether to check that go_package options match the importpath.")
 	flags.Var(&options, "option", "The plugin options.")
 	flags.Var(&descriptors, "descriptor_set", "The descriptor set to read.")
 	flags.Var(&expected, "expected", "The expected output files.")
@@ -61,14 +64,30 @@ func run(args []string) error {
 		return err
 	}
 
+	if *checkGoPackages {
+		goPackages := make(map[string]string)
+		for _, d := range descriptors {
+			data, err := ioutil.ReadFile(d)
+			if err != nil {
+				return err
+			}
+			if err := readGoPackages(data, goPackages); err != nil {
+				return fmt.Errorf("%s: %v", d, err)
+			}
+		}
+		if err := checkGoPackage(*importpath, flags.Args(), goPackages); err != nil {
+			return err
+		}
+	}
+
 	// Output to a temporary folder and then move the contents into place below.
 	// This is to work around long file paths on Windows.
 	tmpDir, err := ioutil.TempDir("", "go_proto")
 	if err != nil {
 		return err
 	}
-	tmpDir = abs(tmpDir)        // required to work with long paths on Windows
-	absOutPath := abs(*outPath) // required to work with long paths on Windows
+	tmpDir = buildenv.Abs(tmpDir)        // required to work with long paths on Windows
+	absOutPath := buildenv.Abs(*outPath) // required to work with long paths on Windows
 	defer os.RemoveAll(tmpDir)
 
 	pluginBase := filepath.Base(*plugin)
@@ -124,10 +143,6 @@ func run(args []string) error {
 			return nil
 		}
 
-		if !strings.HasSuffix(path, ".go") {
-			return nil
-		}
-
 		info := &genFileInfo{
 			path:    path,
 			base:    filepath.Base(path),
@@ -163,8 +178,12 @@ func run(args []string) error {
 			// Some plugins only create output files if the proto source files have
 			// have relevant definitions (e.g., services for grpc_gateway). Create
 			// trivial files that the compiler will ignore for missing outputs.
-			data := []byte("// +build ignore\n\npackage ignore")
-			if err := ioutil.WriteFile(abs(f.path), data, 0644); err != nil {
+			// Other outputs, like OpenAPI specs, are left empty.
+			var data []byte
+			if strings.HasSuffix(f.path, ".go") {
+				data = []byte("// +build ignore\n\npackage ignore")
+			}
+			if err := ioutil.WriteFile(buildenv.Abs(f.path), data, 0644); err != nil {
 				return err
 			}
 		case f.expected && f.ambiguious:
@@ -174,7 +193,7 @@ func run(args []string) error {
 			if err != nil {
 				return err
 			}
-			if err := ioutil.WriteFile(abs(f.path), data, 0644); err != nil {
+			if err := ioutil.WriteFile(buildenv.Abs(f.path), data, 0644); err != nil {
 				return err
 			}
 		case !f.expected:
@@ -0,0 +1,169 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Field numbers in descriptor.proto. The builders can't depend on the
+// protobuf runtime, so descriptor sets are decoded by hand. Only the fields
+// below are read.
+const (
+	fileDescriptorSetFile      = 1  // FileDescriptorSet.file
+	fileDescriptorProtoName    = 1  // FileDescriptorProto.name
+	fileDescriptorProtoOptions = 8  // FileDescriptorProto.options
+	fileOptionsGoPackage       = 11 // FileOptions.go_package
+)
+
+const (
+	wireTypeVarint  = 0
+	wireTypeFixed64 = 1
+	wireTypeBytes   = 2
+	wireTypeFixed32 = 5
+)
+
+var errTruncatedField = errors.New("truncated field")
+
+// readGoPackages decodes a serialized FileDescriptorSet and records the
+// go_package option of each file in it, keyed by the file's import path.
+// Files without the option are recorded with an empty string.
+func readGoPackages(data []byte, goPackages map[string]string) error {
+	err := walkBytesFields(data, func(num int, file []byte) error {
+		if num != fileDescriptorSetFile {
+			return nil
+		}
+		var name, goPackage string
+		err := walkBytesFields(file, func(num int, b []byte) error {
+			switch num {
+			case fileDescriptorProtoName:
+				name = string(b)
+			case fileDescriptorProtoOptions:
+				return walkBytesFields(b, func(num int, b []byte) error {
+					if num == fileOptionsGoPackage {
+						goPackage = string(b)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		goPackages[name] = goPackage
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("malformed descriptor set: %v", err)
+	}
+	return nil
+}
+
+// walkBytesFields calls visit with the field number and contents of each
+// length-delimited field in an encoded message. Other fields are skipped.
+func walkBytesFields(data []byte, visit func(num int, b []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errTruncatedField
+		}
+		data = data[n:]
+		num := int(key >> 3)
+		switch key & 7 {
+		case wireTypeVarint:
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return errTruncatedField
+			}
+			data = data[n:]
+		case wireTypeFixed64:
+			if len(data) < 8 {
+				return errTruncatedField
+			}
+			data = data[8:]
+		case wireTypeFixed32:
+			if len(data) < 4 {
+				return errTruncatedField
+			}
+			data = data[4:]
+		case wireTypeBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return errTruncatedField
+			}
+			if err := visit(num, data[n:n+int(size)]); err != nil {
+				return err
+			}
+			data = data[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported wire type %d for field %d", key&7, num)
+		}
+	}
+	return nil
+}
+
+// goPackageImportPath returns the import path in a go_package option. The
+// option may end with an explicit package name after a semicolon, as in
+// "example.com/foo;foo". Values without a slash or a dot are package names
+// from older versions of protoc-gen-go, not import paths, so "" is
+// returned for them.
+func goPackageImportPath(goPackage string) string {
+	if i := strings.IndexByte(goPackage, ';'); i >= 0 {
+		goPackage = goPackage[:i]
+	}
+	if !strings.ContainsAny(goPackage, "/.") {
+		return ""
+	}
+	return goPackage
+}
+
+// checkGoPackage reports an error if the go_package options of the proto
+// files in srcs disagree with each other or with importpath. Files without
+// an import path in go_package are not checked.
+func checkGoPackage(importpath string, srcs []string, goPackages map[string]string) error {
+	byPath := make(map[string][]string)
+	for _, src := range srcs {
+		if path := goPackageImportPath(goPackages[src]); path != "" {
+			byPath[path] = append(byPath[path], src)
+		}
+	}
+	switch len(byPath) {
+	case 0:
+		return nil
+	case 1:
+		for path, files := range byPath {
+			if path != importpath {
+				return fmt.Errorf("importpath %q does not match option go_package %q in %s; set importpath = %q", importpath, path, strings.Join(files, ", "), path)
+			}
+		}
+		return nil
+	default:
+		var paths []string
+		for path := range byPath {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		buf := &strings.Builder{}
+		fmt.Fprintf(buf, "proto files compiled into %s have different go_package options:", importpath)
+		for _, path := range paths {
+			fmt.Fprintf(buf, "\n\t%s: %s", path, strings.Join(byPath[path], ", "))
+		}
+		return errors.New(buf.String())
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// appendBytesField appends a length-delimited field to an encoded message.
+func appendBytesField(b []byte, num int, value []byte) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], uint64(num)<<3|wireTypeBytes)
+	b = append(b, buf[:n]...)
+	n = binary.PutUvarint(buf[:], uint64(len(value)))
+	b = append(b, buf[:n]...)
+	return append(b, value...)
+}
+
+func encodeFile(name, goPackage string) []byte {
+	var file []byte
+	file = appendBytesField(file, fileDescriptorProtoName, []byte(name))
+	// FileDescriptorProto.package, which should be skipped.
+	file = appendBytesField(file, 2, []byte("foo.bar"))
+	if goPackage != "" {
+		var options []byte
+		// FileOptions.optimize_for, a varint which should be skipped.
+		options = append(options, 9<<3|wireTypeVarint, 1)
+		options = appendBytesField(options, fileOptionsGoPackage, []byte(goPackage))
+		file = appendBytesField(file, fileDescriptorProtoOptions, options)
+	}
+	return file
+}
+
+func TestReadGoPackages(t *testing.T) {
+	var set []byte
+	set = appendBytesField(set, fileDescriptorSetFile, encodeFile("a/a.proto", "example.com/a;a"))
+	set = appendBytesField(set, fileDescriptorSetFile, encodeFile("b/b.proto", ""))
+	got := make(map[string]string)
+	if err := readGoPackages(set, got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"a/a.proto": "example.com/a;a",
+		"b/b.proto": "",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	if err := readGoPackages(set[:len(set)-1], make(map[string]string)); err == nil {
+		t.Error("truncated descriptor set: got nil error")
+	}
+}
+
+func TestGoPackageImportPath(t *testing.T) {
+	for goPackage, want := range map[string]string{
+		"example.com/foo":     "example.com/foo",
+		"example.com/foo;bar": "example.com/foo",
+		"foo":                 "",
+		"":                    "",
+	} {
+		if got := goPackageImportPath(goPackage); got != want {
+			t.Errorf("goPackageImportPath(%q): got %q; want %q", goPackage, got, want)
+		}
+	}
+}
+
+func TestCheckGoPackage(t *testing.T) {
+	goPackages := map[string]string{
+		"a.proto":   "example.com/a;a",
+		"a2.proto":  "example.com/a",
+		"b.proto":   "example.com/b",
+		"old.proto": "old",
+		"no.proto":  "",
+	}
+	for _, test := range []struct {
+		desc, importpath string
+		srcs             []string
+		wantErr          string
+	}{
+		{
+			desc:       "match",
+			importpath: "example.com/a",
+			srcs:       []string{"a.proto", "a2.proto", "old.proto", "no.proto"},
+		}, {
+			desc:       "unchecked",
+			importpath: "example.com/c",
+			srcs:       []string{"old.proto", "no.proto"},
+		}, {
+			desc:       "mismatch",
+			importpath: "example.com/c",
+			srcs:       []string{"a.proto"},
+			wantErr:    `set importpath = "example.com/a"`,
+		}, {
+			desc:       "inconsistent",
+			importpath: "example.com/a",
+			srcs:       []string{"a.proto", "b.proto"},
+			wantErr:    "example.com/b: b.proto",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			err := checkGoPackage(test.importpath, test.srcs, goPackages)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error %v; want error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
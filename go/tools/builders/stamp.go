@@ -0,0 +1,434 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// stamp sets variables stamped with volatile workspace status values in a
+// linked binary. The link action sets each such variable to a fixed-length
+// placeholder, so it doesn't depend on volatile-status.txt and can be cached
+// remotely. This action replaces the placeholders with the real values, much
+// like the linkstamp step Bazel uses for C++.
+func stamp(args []string) error {
+	args, err := buildenv.ReadParamsFiles(args)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("GoStamp", flag.ExitOnError)
+	goenv := buildenv.EnvFlags(fs)
+	var stamps, placeholders multiFlag
+	inPath := fs.String("in", "", "The linked binary containing placeholders")
+	outPath := fs.String("o", "", "The stamped binary to write")
+	fs.Var(&stamps, "stamp", "The name of a file with stamping values.")
+	fs.Var(&placeholders, "placeholder", "A placeholder and the stamp key that replaces it, as placeholder=key or placeholder=key|default.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := goenv.CheckFlags(); err != nil {
+		return err
+	}
+	if *inPath == "" || *outPath == "" {
+		return errors.New("-in and -o must be set")
+	}
+
+	stampMap, err := readStampFiles(stamps)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string)
+	for _, p := range placeholders {
+		eq := strings.IndexByte(p, '=')
+		if eq < 0 {
+			return fmt.Errorf("-placeholder flag does not contain '=': %s", p)
+		}
+		// A key that is missing without a default sets the variable to the
+		// empty string, since its original value has been replaced.
+		value, _ := lookupStamp(stampMap, p[eq+1:])
+		values[p[:eq]] = value
+	}
+
+	data, err := ioutil.ReadFile(buildenv.Abs(*inPath))
+	if err != nil {
+		return err
+	}
+	img, err := readImage(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *inPath, err)
+	}
+	if err := img.replaceStrings(data, values); err != nil {
+		return fmt.Errorf("%s: %v", *inPath, err)
+	}
+	if err := img.updateCodeSignature(data); err != nil {
+		return fmt.Errorf("%s: %v", *inPath, err)
+	}
+	return ioutil.WriteFile(buildenv.Abs(*outPath), data, 0777)
+}
+
+// readStampFiles reads workspace status files, which contain a key and a
+// value separated by a space on each line.
+func readStampFiles(paths []string) (map[string]string, error) {
+	stampMap := map[string]string{}
+	for _, stampfile := range paths {
+		stampbuf, err := ioutil.ReadFile(stampfile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed reading stamp file %s: %v", stampfile, err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(stampbuf))
+		for scanner.Scan() {
+			line := strings.SplitN(scanner.Text(), " ", 2)
+			switch len(line) {
+			case 0:
+				// Nothing to do here
+			case 1:
+				// Map to the empty string
+				stampMap[line[0]] = ""
+			case 2:
+				// Key and value
+				stampMap[line[0]] = line[1]
+			}
+		}
+	}
+	return stampMap, nil
+}
+
+// lookupStamp returns the value of a stamp key. The key may be followed by
+// '|' and a default value, used when the key is not present in stampMap.
+// lookupStamp returns false if there is neither a value nor a default.
+func lookupStamp(stampMap map[string]string, key string) (string, bool) {
+	var defaultValue string
+	hasDefault := false
+	if bar := strings.IndexByte(key, '|'); bar >= 0 {
+		key, defaultValue, hasDefault = key[:bar], key[bar+1:], true
+	}
+	if value, ok := stampMap[key]; ok {
+		return value, true
+	}
+	return defaultValue, hasDefault
+}
+
+// binaryImage describes how an executable file is laid out in memory.
+type binaryImage struct {
+	order    binary.ByteOrder
+	ptrSize  int
+	sections []imageSection
+
+	// data lists the sections holding initialized, writable data, where
+	// the linker stores variables.
+	data []imageSection
+
+	// codeSignature is the part of a Mach-O file holding its code signature,
+	// if it has one.
+	codeSignature *imageSection
+}
+
+// imageSection maps a range of the file to the address where it's loaded.
+type imageSection struct {
+	offset, size, addr uint64
+}
+
+const (
+	// lcCodeSignature is the Mach-O load command locating the code
+	// signature. debug/macho doesn't define it.
+	lcCodeSignature = 0x1d
+
+	// peSectionData is set in the characteristics of PE sections holding
+	// initialized, writable data. debug/pe only defines the flags in Go 1.15
+	// and later.
+	peSectionData = 0x00000040 | 0x80000000
+)
+
+// readImage reads the layout of an ELF, Mach-O, or PE executable.
+func readImage(data []byte) (*binaryImage, error) {
+	r := bytes.NewReader(data)
+	if f, err := elf.NewFile(r); err == nil {
+		img := &binaryImage{order: f.ByteOrder, ptrSize: 8}
+		if f.Class == elf.ELFCLASS32 {
+			img.ptrSize = 4
+		}
+		for _, p := range f.Progs {
+			if p.Type == elf.PT_LOAD {
+				img.sections = append(img.sections, imageSection{p.Off, p.Filesz, p.Vaddr})
+			}
+		}
+		for _, s := range f.Sections {
+			if s.Type == elf.SHT_PROGBITS && s.Flags&(elf.SHF_ALLOC|elf.SHF_WRITE) == elf.SHF_ALLOC|elf.SHF_WRITE {
+				img.data = append(img.data, imageSection{s.Offset, s.Size, s.Addr})
+			}
+		}
+		return img, nil
+	}
+	if f, err := macho.NewFile(r); err == nil {
+		img := &binaryImage{order: f.ByteOrder, ptrSize: 4}
+		if f.Magic == macho.Magic64 {
+			img.ptrSize = 8
+		}
+		for _, l := range f.Loads {
+			switch l := l.(type) {
+			case *macho.Segment:
+				img.sections = append(img.sections, imageSection{l.Offset, l.Filesz, l.Addr})
+			case macho.LoadBytes:
+				if len(l) >= 16 && f.ByteOrder.Uint32(l) == lcCodeSignature {
+					img.codeSignature = &imageSection{offset: uint64(f.ByteOrder.Uint32(l[8:])), size: uint64(f.ByteOrder.Uint32(l[12:]))}
+				}
+			}
+		}
+		for _, s := range f.Sections {
+			// Sections with other types, like zero-filled ones, have no
+			// contents in the file, or hold pointers written by the linker.
+			const sRegular = 0
+			if s.Seg == "__DATA" && s.Flags&0xff == sRegular {
+				img.data = append(img.data, imageSection{uint64(s.Offset), s.Size, s.Addr})
+			}
+		}
+		return img, nil
+	}
+	if f, err := pe.NewFile(r); err == nil {
+		img := &binaryImage{order: binary.LittleEndian}
+		var imageBase uint64
+		switch h := f.OptionalHeader.(type) {
+		case *pe.OptionalHeader32:
+			img.ptrSize, imageBase = 4, uint64(h.ImageBase)
+		case *pe.OptionalHeader64:
+			img.ptrSize, imageBase = 8, h.ImageBase
+		default:
+			return nil, errors.New("PE file has no optional header")
+		}
+		for _, s := range f.Sections {
+			size := s.Size
+			if s.VirtualSize < size {
+				size = s.VirtualSize
+			}
+			section := imageSection{uint64(s.Offset), uint64(size), imageBase + uint64(s.VirtualAddress)}
+			img.sections = append(img.sections, section)
+			if s.Characteristics&peSectionData == peSectionData {
+				img.data = append(img.data, section)
+			}
+		}
+		return img, nil
+	}
+	return nil, errors.New("not an ELF, Mach-O, or PE executable")
+}
+
+// addr returns the address where the byte at offset in the file is loaded.
+func (img *binaryImage) addr(offset uint64) (uint64, bool) {
+	for _, s := range img.sections {
+		if s.offset <= offset && offset < s.offset+s.size {
+			return s.addr + offset - s.offset, true
+		}
+	}
+	return 0, false
+}
+
+// replaceStrings replaces the contents of string variables set to placeholders
+// with the corresponding values in data, which holds the contents of the
+// executable described by img.
+//
+// The linker stores the contents of a variable set with -X separately from
+// the variable, which holds the address and length of the contents. Each
+// placeholder is overwritten with its value, and the length of each variable
+// pointing to the placeholder is updated. Only aligned variables in data
+// sections are updated, so other data that happens to look the same isn't
+// changed. Values may not be longer than their placeholders.
+func (img *binaryImage) replaceStrings(data []byte, values map[string]string) error {
+	for placeholder, value := range values {
+		if len(value) > len(placeholder) {
+			return fmt.Errorf("stamp value %q is longer than %d bytes. Use a STABLE_ key for long values, or disable //go/config:linkstamp.", value, len(placeholder))
+		}
+		needle := []byte(placeholder)
+		header := make([]byte, 2*img.ptrSize)
+		found := 0
+		for start := 0; ; {
+			i := bytes.Index(data[start:], needle)
+			if i < 0 {
+				break
+			}
+			offset := start + i
+			start = offset + len(needle)
+			addr, ok := img.addr(uint64(offset))
+			if !ok {
+				continue
+			}
+			img.putUint(header, addr)
+			img.putUint(header[img.ptrSize:], uint64(len(placeholder)))
+			for _, s := range img.data {
+				if s.offset > uint64(len(data)) || s.size > uint64(len(data))-s.offset {
+					continue
+				}
+				section := data[s.offset : s.offset+s.size]
+				for j := 0; ; {
+					k := bytes.Index(section[j:], header)
+					if k < 0 {
+						break
+					}
+					if (s.addr+uint64(j+k))%uint64(img.ptrSize) != 0 {
+						j += k + 1
+						continue
+					}
+					img.putUint(section[j+k+img.ptrSize:], uint64(len(value)))
+					j += k + len(header)
+					found++
+				}
+			}
+			n := copy(data[offset:], value)
+			for n < len(placeholder) {
+				data[offset+n] = 0
+				n++
+			}
+		}
+		if found == 0 {
+			return fmt.Errorf("could not find a variable set to placeholder %q. Volatile stamping is only supported for executables linked in the default link mode.", placeholder)
+		}
+	}
+	return nil
+}
+
+func (img *binaryImage) putUint(b []byte, v uint64) {
+	if img.ptrSize == 4 {
+		img.order.PutUint32(b, uint32(v))
+	} else {
+		img.order.PutUint64(b, v)
+	}
+}
+
+// Constants for Mach-O code signatures, from osfmk/kern/cs_blobs.h in the
+// xnu sources. Code signatures are big endian.
+const (
+	csMagicEmbeddedSignature = 0xfade0cc0
+	csMagicCodeDirectory     = 0xfade0c02
+	csMagicBlobWrapper       = 0xfade0b01
+
+	csSlotCodeDirectory            = 0
+	csSlotAlternateCodeDirectories = 0x1000
+	csSlotSignature                = 0x10000
+
+	csHashTypeSHA1         = 1
+	csHashTypeSHA256       = 2
+	csHashTypeSHA256Trunc  = 3
+	csHashTypeSHA384       = 4
+	csCodeDirectoryVersion = 0x20300 // The first version with a 64-bit code limit.
+)
+
+// updateCodeSignature updates the code signature of a Mach-O file after
+// replaceStrings has changed it. Executables for darwin/arm64 must be signed,
+// so both the Go linker and the system linker sign them ad hoc, without a
+// certificate. The code directory holds a hash of each page of the file, and
+// the kernel won't run an executable whose pages don't match, so the hashes
+// are computed again. A signature made with a certificate covers the code
+// directory and can't be updated, so executables signed that way can't be
+// stamped.
+func (img *binaryImage) updateCodeSignature(data []byte) error {
+	if img.codeSignature == nil {
+		return nil
+	}
+	cs := img.codeSignature
+	if cs.offset > uint64(len(data)) || cs.size > uint64(len(data))-cs.offset || cs.size < 12 {
+		return errors.New("code signature is out of bounds")
+	}
+	sig := data[cs.offset : cs.offset+cs.size]
+	be := binary.BigEndian
+	if be.Uint32(sig) != csMagicEmbeddedSignature {
+		return errors.New("code signature has an unknown format")
+	}
+	count := be.Uint32(sig[8:])
+	if uint64(count) > (uint64(len(sig))-12)/8 {
+		return errors.New("code signature is truncated")
+	}
+	for i := uint32(0); i < count; i++ {
+		slot, offset := be.Uint32(sig[12+8*i:]), be.Uint32(sig[16+8*i:])
+		if uint64(offset)+8 > uint64(len(sig)) {
+			return errors.New("code signature is truncated")
+		}
+		blob := sig[offset:]
+		switch {
+		case slot == csSlotSignature:
+			// Ad hoc signatures may have an empty signature blob.
+			if be.Uint32(blob) == csMagicBlobWrapper && be.Uint32(blob[4:]) > 8 {
+				return errors.New("executable is signed with a certificate and can't be stamped after linking; disable //go/config:linkstamp")
+			}
+		case slot == csSlotCodeDirectory || (csSlotAlternateCodeDirectories <= slot && slot < csSlotAlternateCodeDirectories+5):
+			if err := updateCodeDirectory(data[:cs.offset], blob); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updateCodeDirectory computes the hash of each page of code, the part of
+// the file before the code signature, and stores them in the code directory
+// cd.
+func updateCodeDirectory(code, cd []byte) error {
+	be := binary.BigEndian
+	if len(cd) < 40 || be.Uint32(cd) != csMagicCodeDirectory || uint64(be.Uint32(cd[4:])) > uint64(len(cd)) {
+		return errors.New("code directory has an unknown format")
+	}
+	cd = cd[:be.Uint32(cd[4:])]
+	version := be.Uint32(cd[8:])
+	hashOffset := uint64(be.Uint32(cd[16:]))
+	nCodeSlots := uint64(be.Uint32(cd[28:]))
+	codeLimit := uint64(be.Uint32(cd[32:]))
+	if version >= csCodeDirectoryVersion && len(cd) >= 64 {
+		if codeLimit64 := be.Uint64(cd[56:]); codeLimit64 != 0 {
+			codeLimit = codeLimit64
+		}
+	}
+	hashSize := uint64(cd[36])
+	var newHash func() hash.Hash
+	switch cd[37] {
+	case csHashTypeSHA1:
+		newHash = sha1.New
+	case csHashTypeSHA256, csHashTypeSHA256Trunc:
+		newHash = sha256.New
+	case csHashTypeSHA384:
+		newHash = sha512.New384
+	default:
+		return fmt.Errorf("code directory has unknown hash type %d", cd[37])
+	}
+	pageSize := codeLimit
+	if cd[39] != 0 {
+		pageSize = 1 << cd[39]
+	}
+	if codeLimit > uint64(len(code)) || hashOffset+nCodeSlots*hashSize > uint64(len(cd)) || (pageSize > 0 && (codeLimit+pageSize-1)/pageSize != nCodeSlots) {
+		return errors.New("code directory doesn't match the file")
+	}
+	for i := uint64(0); i < nCodeSlots; i++ {
+		end := (i + 1) * pageSize
+		if end > codeLimit {
+			end = codeLimit
+		}
+		h := newHash()
+		h.Write(code[i*pageSize : end])
+		copy(cd[hashOffset+i*hashSize:hashOffset+(i+1)*hashSize], h.Sum(nil))
+	}
+	return nil
+}
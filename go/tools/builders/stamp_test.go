@@ -0,0 +1,192 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"debug/macho"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestLookupStamp(t *testing.T) {
+	stampMap := map[string]string{"BUILD_TIMESTAMP": "1600000000", "EMPTY": ""}
+	for _, test := range []struct {
+		key, want string
+		ok        bool
+	}{
+		{key: "BUILD_TIMESTAMP", want: "1600000000", ok: true},
+		{key: "BUILD_TIMESTAMP|0", want: "1600000000", ok: true},
+		{key: "EMPTY|x", want: "", ok: true},
+		{key: "MISSING|dev", want: "dev", ok: true},
+		{key: "MISSING|", want: "", ok: true},
+		{key: "MISSING", want: "", ok: false},
+	} {
+		if got, ok := lookupStamp(stampMap, test.key); got != test.want || ok != test.ok {
+			t.Errorf("lookupStamp(%q): got %q, %v; want %q, %v", test.key, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestReplaceStrings(t *testing.T) {
+	const placeholder = "rules_go_linkstamp:0:................"
+	img := &binaryImage{
+		order:    binary.LittleEndian,
+		ptrSize:  8,
+		sections: []imageSection{{offset: 0x100, size: 0x100, addr: 0x401000}},
+		data:     []imageSection{{offset: 0x180, size: 0x80, addr: 0x401080}},
+	}
+
+	// Lay out the placeholder contents in rodata and the variable pointing
+	// to them in data, as the linker would. Rodata also holds the same
+	// address and length, which must not be changed.
+	data := make([]byte, 0x200)
+	copy(data[0x110:], placeholder)
+	img.order.PutUint64(data[0x180:], 0x401010)
+	img.order.PutUint64(data[0x188:], uint64(len(placeholder)))
+	img.order.PutUint64(data[0x140:], 0x401010)
+	img.order.PutUint64(data[0x148:], uint64(len(placeholder)))
+
+	if err := img.replaceStrings(data, map[string]string{placeholder: "1600000000"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := img.order.Uint64(data[0x180:]); got != 0x401010 {
+		t.Errorf("got address %#x; want %#x", got, 0x401010)
+	}
+	if got := img.order.Uint64(data[0x188:]); got != 10 {
+		t.Errorf("got length %d; want 10", got)
+	}
+	if got := img.order.Uint64(data[0x148:]); got != uint64(len(placeholder)) {
+		t.Errorf("got length %d outside data; want %d", got, len(placeholder))
+	}
+	want := append([]byte("1600000000"), make([]byte, len(placeholder)-10)...)
+	if got := data[0x110 : 0x110+len(placeholder)]; !bytes.Equal(got, want) {
+		t.Errorf("got contents %q; want %q", got, want)
+	}
+
+	if err := img.replaceStrings(data, map[string]string{"rules_go_linkstamp:1:": "x"}); err == nil {
+		t.Error("replacing a missing placeholder: got success; want error")
+	}
+	long := strings.Repeat("x", len(placeholder)+1)
+	copy(data[0x110:], placeholder)
+	if err := img.replaceStrings(data, map[string]string{placeholder: long}); err == nil {
+		t.Error("replacing with a long value: got success; want error")
+	}
+}
+
+func TestUpdateCodeSignature(t *testing.T) {
+	const (
+		pageSize    = 0x1000
+		textAddr    = 0x100000000
+		dataOffset  = pageSize
+		sigOffset   = 2 * pageSize
+		nCodeSlots  = 2
+		placeholder = "rules_go_linkstamp:0:................"
+	)
+
+	// Build a minimal darwin/arm64 executable with a text segment holding
+	// the placeholder, a data segment holding the variable, and an ad hoc
+	// code signature.
+	var buf bytes.Buffer
+	put := func(v interface{}) {
+		if err := binary.Write(&buf, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	name := func(s string) (b [16]byte) {
+		copy(b[:], s)
+		return b
+	}
+	segSize := uint32(binary.Size(macho.Segment64{}))
+	sectSize := uint32(binary.Size(macho.Section64{}))
+	put(macho.FileHeader{
+		Magic: macho.Magic64,
+		Cpu:   macho.CpuArm64,
+		Type:  macho.TypeExec,
+		Ncmd:  3,
+		Cmdsz: 2*segSize + sectSize + 16,
+	})
+	put(uint32(0)) // reserved
+	put(macho.Segment64{Cmd: macho.LoadCmdSegment64, Len: segSize, Name: name("__TEXT"), Addr: textAddr, Memsz: pageSize, Offset: 0, Filesz: pageSize, Maxprot: 5, Prot: 5})
+	put(macho.Segment64{Cmd: macho.LoadCmdSegment64, Len: segSize + sectSize, Name: name("__DATA"), Addr: textAddr + dataOffset, Memsz: pageSize, Offset: dataOffset, Filesz: pageSize, Maxprot: 3, Prot: 3, Nsect: 1})
+	put(macho.Section64{Name: name("__data"), Seg: name("__DATA"), Addr: textAddr + dataOffset, Size: 0x100, Offset: dataOffset, Align: 3})
+	put([]uint32{lcCodeSignature, 16, sigOffset, 0})
+
+	data := make([]byte, sigOffset)
+	copy(data, buf.Bytes())
+	copy(data[0x800:], placeholder)
+	binary.LittleEndian.PutUint64(data[dataOffset:], textAddr+0x800)
+	binary.LittleEndian.PutUint64(data[dataOffset+8:], uint64(len(placeholder)))
+
+	// The signature is a super blob with an empty signature blob, as the Go
+	// linker writes it, and a code directory with a hash for each page.
+	const cdOffset = 12 + 2*8
+	const hashOffset = 88
+	cd := make([]byte, hashOffset+nCodeSlots*sha256.Size)
+	be := binary.BigEndian
+	be.PutUint32(cd[0:], csMagicCodeDirectory)
+	be.PutUint32(cd[4:], uint32(len(cd)))
+	be.PutUint32(cd[8:], 0x20400)
+	be.PutUint32(cd[16:], hashOffset)
+	be.PutUint32(cd[28:], nCodeSlots)
+	be.PutUint32(cd[32:], sigOffset)
+	cd[36] = sha256.Size
+	cd[37] = csHashTypeSHA256
+	cd[39] = 12
+	sig := make([]byte, cdOffset)
+	be.PutUint32(sig[0:], csMagicEmbeddedSignature)
+	be.PutUint32(sig[8:], 2)
+	be.PutUint32(sig[12:], csSlotCodeDirectory)
+	be.PutUint32(sig[16:], cdOffset)
+	be.PutUint32(sig[20:], csSlotSignature)
+	be.PutUint32(sig[24:], uint32(cdOffset+len(cd)))
+	sig = append(sig, cd...)
+	sig = append(sig, 0xfa, 0xde, 0x0b, 0x01, 0, 0, 0, 8)
+	be.PutUint32(sig[4:], uint32(len(sig)))
+	data = append(data, sig...)
+	binary.LittleEndian.PutUint32(data[buf.Len()-4:], uint32(len(sig)))
+
+	img, err := readImage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.codeSignature == nil || img.codeSignature.offset != sigOffset {
+		t.Fatalf("got code signature %+v; want one at %#x", img.codeSignature, sigOffset)
+	}
+	if err := img.replaceStrings(data, map[string]string{placeholder: "1600000000"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := img.updateCodeSignature(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := binary.LittleEndian.Uint64(data[dataOffset+8:]); got != 10 {
+		t.Errorf("got length %d; want 10", got)
+	}
+	hashes := data[sigOffset+cdOffset+hashOffset:]
+	for i := 0; i < nCodeSlots; i++ {
+		want := sha256.Sum256(data[i*pageSize : (i+1)*pageSize])
+		if got := hashes[i*sha256.Size : (i+1)*sha256.Size]; !bytes.Equal(got, want[:]) {
+			t.Errorf("page %d: got hash %x; want %x", i, got, want)
+		}
+	}
+
+	// A signature made with a certificate can't be updated.
+	copy(data[len(data)-8:], []byte{0xfa, 0xde, 0x0b, 0x01, 0, 0, 0, 9})
+	if err := img.updateCodeSignature(data); err == nil {
+		t.Error("updating a signature made with a certificate: got success; want error")
+	}
+}
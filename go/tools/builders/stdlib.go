@@ -21,28 +21,42 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
 )
 
 // stdlib builds the standard library in the appropriate mode into a new goroot.
 func stdlib(args []string) error {
 	// process the args
 	flags := flag.NewFlagSet("stdlib", flag.ExitOnError)
-	goenv := envFlags(flags)
+	goenv := buildenv.EnvFlags(flags)
 	out := flags.String("out", "", "Path to output go root")
 	race := flags.Bool("race", false, "Build in race mode")
 	shared := flags.Bool("shared", false, "Build in shared mode")
 	dynlink := flags.Bool("dynlink", false, "Build in dynlink mode")
+	trimpath := flags.Bool("trimpath", false, "Record file names by import path, as with go build -trimpath")
+	var packages multiFlag
+	flags.Var(&packages, "package", "A standard library package to build, along with its dependencies (repeated). If none are given, all of std is built.")
+	shard := flags.Int("shard", 0, "The shard of the standard library to build, from 0 to -shards - 1")
+	shards := flags.Int("shards", 1, "The number of shards the standard library is split into")
+	var prebuilt multiFlag
+	flags.Var(&prebuilt, "prebuilt", "The output go root of an earlier shard, whose packages are used instead of compiled again (repeated)")
+	var merge multiFlag
+	flags.Var(&merge, "merge", "The output go root of a shard to merge into the output (repeated). Nothing is compiled when set.")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
-	if err := goenv.checkFlags(); err != nil {
+	if err := goenv.CheckFlags(); err != nil {
 		return err
 	}
+	if *shards < 1 || *shard < 0 || *shard >= *shards {
+		return fmt.Errorf("-shard must be from 0 to %d", *shards-1)
+	}
 	goroot := os.Getenv("GOROOT")
 	if goroot == "" {
 		return fmt.Errorf("GOROOT not set")
 	}
-	output := abs(*out)
+	output := buildenv.Abs(*out)
 
 	// Fail fast if cgo is required but a toolchain is not configured.
 	if os.Getenv("CGO_ENABLED") == "1" && filepath.Base(os.Getenv("CC")) == "vc_installation_error.bat" {
@@ -59,6 +73,18 @@ You may need to use the flags --cpu=x64_windows --compiler=mingw-gcc.`)
 	if err != nil {
 		return err
 	}
+	pkgDir := filepath.Join(output, "pkg", goenv.InstallSuffix)
+
+	shardPkgDirs := func(roots []string) []string {
+		dirs := make([]string, len(roots))
+		for i, root := range roots {
+			dirs[i] = filepath.Join(buildenv.Abs(root), "pkg", goenv.InstallSuffix)
+		}
+		return dirs
+	}
+	if len(merge) > 0 {
+		return mergeStdlibShards(pkgDir, shardPkgDirs(merge))
+	}
 
 	// Now switch to the newly created GOROOT
 	os.Setenv("GOROOT", output)
@@ -74,18 +100,14 @@ You may need to use the flags --cpu=x64_windows --compiler=mingw-gcc.`)
 	// modules on in "auto" mode.
 	os.Setenv("GO111MODULE", "off")
 
-	// Make sure we have an absolute path to the C compiler.
-	// TODO(#1357): also take absolute paths of includes and other paths in flags.
-	os.Setenv("CC", abs(os.Getenv("CC")))
-
-	// Ensure paths are absolute.
-	absPaths := []string{}
-	for _, path := range filepath.SplitList(os.Getenv("PATH")) {
-		absPaths = append(absPaths, abs(path))
+	// Make sure we have absolute paths to the C compiler, the directories in
+	// PATH, and any paths in cgo flags. The go command runs cgo in its own
+	// working directory, so relative paths would not resolve.
+	if err := buildenv.AbsCCEnv(); err != nil {
+		return fmt.Errorf("error modifying cgo environment to absolute path: %v", err)
 	}
-	os.Setenv("PATH", strings.Join(absPaths, string(os.PathListSeparator)))
 
-	sandboxPath := abs(".")
+	sandboxPath := buildenv.Abs(".")
 
 	// Strip path prefix from source files in debug information.
 	os.Setenv("CGO_CFLAGS", os.Getenv("CGO_CFLAGS")+" "+strings.Join(defaultCFlags(output), " "))
@@ -97,9 +119,23 @@ You may need to use the flags --cpu=x64_windows --compiler=mingw-gcc.`)
 	// creating reproducible builds because the build ids are hashed from
 	// CGO_CFLAGS, which frequently contains absolute paths. As a workaround,
 	// we strip the build ids, since they won't be used after this.
-	installArgs := goenv.goCmd("install", "-toolexec", abs(os.Args[0])+" filterbuildid")
-	if len(build.Default.BuildTags) > 0 {
-		installArgs = append(installArgs, "-tags", strings.Join(build.Default.BuildTags, " "))
+	toolexec := buildenv.Abs(os.Args[0]) + " filterbuildid"
+	if len(prebuilt) > 0 {
+		workDir, cleanup, err := goenv.WorkDir()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		importcfgPath, err := writeStdlibShardImportcfg(workDir, shardPkgDirs(prebuilt))
+		if err != nil {
+			return err
+		}
+		toolexec += " -prebuilt " + importcfgPath
+	}
+	installArgs := goenv.GoCmd("install", "-toolexec", toolexec)
+	tags := strings.Join(build.Default.BuildTags, " ")
+	if tags != "" {
+		installArgs = append(installArgs, "-tags", tags)
 	}
 
 	gcflags := []string{}
@@ -108,6 +144,13 @@ You may need to use the flags --cpu=x64_windows --compiler=mingw-gcc.`)
 	if *race {
 		installArgs = append(installArgs, "-race")
 	}
+	if *trimpath {
+		// The go command rewrites the directory of each package to its import
+		// path. Do the same for assembly files, which are trimmed separately.
+		// This doesn't depend on GOROOT_FINAL, which Go 1.21 and later ignore.
+		installArgs = append(installArgs, "-trimpath")
+		asmflags[1] = filepath.Join(output, "src") + "=>"
+	}
 	if *shared {
 		gcflags = append(gcflags, "-shared")
 		ldflags = append(ldflags, "-shared")
@@ -133,16 +176,38 @@ You may need to use the flags --cpu=x64_windows --compiler=mingw-gcc.`)
 	installArgs = append(installArgs, "-ldflags="+allSlug+strings.Join(ldflags, " "))
 	installArgs = append(installArgs, "-asmflags="+allSlug+strings.Join(asmflags, " "))
 
-	// Modifying CGO flags to use only absolute path
-	// because go is having its own sandbox, all CGO flags must use absolute path
-	if err := absEnv(cgoEnvVars, cgoAbsEnvFlags); err != nil {
-		return fmt.Errorf("error modifying cgo environment to absolute path: %v", err)
-	}
-
 	// TODO(#1885): don't install runtime/cgo in pure mode.
-	installArgs = append(installArgs, "std", "runtime/cgo")
-	if err := goenv.runCommand(installArgs); err != nil {
-		return err
+	if len(packages) == 0 {
+		packages = multiFlag{"std"}
+	}
+	packages = append(packages, "runtime/cgo")
+	if *shards > 1 {
+		if packages, err = listStdlibShard(goenv, packages, tags, *shard, *shards); err != nil {
+			return err
+		}
+	}
+	if len(packages) > 0 {
+		installArgs = append(installArgs, packages...)
+		if err := goenv.RunCommand(installArgs); err != nil {
+			return err
+		}
+	}
+	if *shards > 1 {
+		// Only the shard's archives are merged, so any others the go command
+		// installed are removed. The sources and tools were only needed to
+		// compile them. A shard may be empty when there are more shards than
+		// packages.
+		if err := os.MkdirAll(pkgDir, 0777); err != nil {
+			return err
+		}
+		if err := pruneStdlibShard(pkgDir, packages); err != nil {
+			return err
+		}
+		for _, dir := range []string{"src", "pkg/tool", "pkg/include"} {
+			if err := os.RemoveAll(filepath.Join(output, filepath.FromSlash(dir))); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
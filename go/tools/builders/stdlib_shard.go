@@ -0,0 +1,250 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// listStdlibShard lists the packages matched by patterns and their
+// dependencies, and returns the ones in the given shard. go list -deps prints
+// each package after its dependencies, and packages are split into contiguous
+// ranges of that list, so the dependencies of a shard's packages are all in
+// the same shard or an earlier one. Every action lists the same packages in
+// the same order, so they all compute the same shards.
+func listStdlibShard(goenv *buildenv.Env, patterns []string, tags string, shard, shards int) ([]string, error) {
+	args := goenv.GoCmd("list", "-e", "-deps", "-f", "{{.ImportPath}}")
+	if tags != "" {
+		args = append(args, "-tags", tags)
+	}
+	args = append(args, patterns...)
+	var out bytes.Buffer
+	if err := goenv.RunCommandToFile(&out, args); err != nil {
+		return nil, err
+	}
+	return stdlibShard(strings.Fields(out.String()), shard, shards), nil
+}
+
+// stdlibShard returns the packages in the given shard of pkgs, which are in
+// dependency order.
+func stdlibShard(pkgs []string, shard, shards int) []string {
+	seen := make(map[string]bool)
+	var ordered []string
+	for _, pkg := range pkgs {
+		if pkg == "unsafe" || seen[pkg] {
+			// unsafe has no archive.
+			continue
+		}
+		seen[pkg] = true
+		ordered = append(ordered, pkg)
+	}
+	n := len(ordered)
+	return ordered[shard*n/shards : (shard+1)*n/shards]
+}
+
+// writeStdlibShardImportcfg writes an importcfg file to dir with a
+// packagefile line for each archive compiled by an earlier shard, below
+// shardPkgDirs. It returns the file's path. The go command still plans to
+// compile those packages when they're dependencies of the shard's packages,
+// but the filterbuildid tool wrapper reads this file and copies the archives
+// instead. See usePrebuiltArchive.
+func writeStdlibShardImportcfg(dir string, shardPkgDirs []string) (string, error) {
+	buf := &bytes.Buffer{}
+	for _, shardPkgDir := range shardPkgDirs {
+		err := filepath.Walk(shardPkgDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(path) != ".a" {
+				return err
+			}
+			rel, err := filepath.Rel(shardPkgDir, path)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(buf, "packagefile %s=%s\n", strings.TrimSuffix(filepath.ToSlash(rel), ".a"), path)
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	path := filepath.Join(dir, "prebuilt.importcfg")
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// readStdlibShardImportcfg reads the file written by writeStdlibShardImportcfg
+// and returns a map from import paths to archive files.
+func readStdlibShardImportcfg(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	archives := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		if line == "" {
+			continue
+		}
+		eq := strings.IndexByte(line, '=')
+		if !strings.HasPrefix(line, "packagefile ") || eq < 0 {
+			return nil, fmt.Errorf(`%s:%d: syntax is "packagefile path=filename"`, path, i+1)
+		}
+		archives[line[len("packagefile "):eq]] = line[eq+1:]
+	}
+	return archives, nil
+}
+
+// usePrebuiltArchive checks whether args, a tool command line the go command
+// runs with -toolexec in the directory dir, is for a package in prebuilt,
+// which maps import paths to archives compiled by an earlier shard. If it's
+// not, usePrebuiltArchive returns args unchanged.
+//
+// The compiler isn't run for such a package. Its archive is copied to the
+// compiler's output instead, and dependent packages are compiled against its
+// export data. It returns nil args when it's done that. The assembler is run
+// on an empty file, since the go command appends the assembled objects to
+// the archive, and the objects in the copied archive are already there. The
+// archive is removed by pruneStdlibShard afterward, so only its export data
+// is used. The C files of cgo packages are still compiled by the go command,
+// which doesn't run the C compiler through -toolexec.
+func usePrebuiltArchive(args []string, dir string, prebuilt map[string]string) ([]string, error) {
+	tool := strings.TrimSuffix(filepath.Base(args[0]), ".exe")
+	if tool != "compile" && tool != "asm" {
+		return args, nil
+	}
+	var pkg, out string
+	for i := 1; i+1 < len(args); i++ {
+		switch args[i] {
+		case "-p":
+			pkg = args[i+1]
+		case "-o":
+			out = args[i+1]
+		}
+	}
+	if pkg == "" {
+		// The assembler is only passed -p in Go 1.19 and later. Tools run in
+		// the package's directory.
+		rel, err := filepath.Rel(filepath.Join(os.Getenv("GOROOT"), "src"), dir)
+		if err != nil {
+			return args, nil
+		}
+		pkg = filepath.ToSlash(rel)
+	}
+	archive, ok := prebuilt[pkg]
+	if !ok || out == "" {
+		return args, nil
+	}
+	if !filepath.IsAbs(out) {
+		out = filepath.Join(dir, out)
+	}
+
+	if tool == "compile" {
+		if err := os.Remove(out); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, copyFile(archive, out)
+	}
+	emptyPath := filepath.Join(filepath.Dir(out), "_prebuilt_empty.s")
+	if err := ioutil.WriteFile(emptyPath, nil, 0666); err != nil {
+		return nil, err
+	}
+	newArgs := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !strings.HasSuffix(arg, ".s") {
+			newArgs = append(newArgs, arg)
+		}
+	}
+	return append(newArgs, emptyPath), nil
+}
+
+// pruneStdlibShard removes archives below pkgDir for packages outside the
+// shard. go install may install dependencies of the shard's packages, which
+// are copies of earlier shards' archives, but each package must come from
+// exactly one shard when they're merged.
+func pruneStdlibShard(pkgDir string, pkgs []string) error {
+	keep := make(map[string]bool)
+	for _, pkg := range pkgs {
+		keep[pkg] = true
+	}
+	return filepath.Walk(pkgDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".a" {
+			return err
+		}
+		rel, err := filepath.Rel(pkgDir, path)
+		if err != nil {
+			return err
+		}
+		if keep[strings.TrimSuffix(filepath.ToSlash(rel), ".a")] {
+			return nil
+		}
+		return os.Remove(path)
+	})
+}
+
+// mergeStdlibShards copies the archives compiled by each shard into pkgDir.
+// Archives are hard linked rather than copied when possible, since the
+// shards' outputs are read-only and the merged library is as large as all of
+// them together. Shards are disjoint, so an archive that's already present
+// means the shards were computed differently, and it's reported as an error.
+func mergeStdlibShards(pkgDir string, shardPkgDirs []string) error {
+	for _, shardPkgDir := range shardPkgDirs {
+		err := filepath.Walk(shardPkgDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(shardPkgDir, path)
+			if err != nil {
+				return err
+			}
+			dst := filepath.Join(pkgDir, rel)
+			if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+				return err
+			}
+			err = hardLinkOrCopyFile(path, dst)
+			if os.IsExist(err) {
+				return fmt.Errorf("%s was compiled by more than one shard", rel)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hardLinkOrCopyFile creates outPath as a hard link to the file inPath
+// refers to, so its data isn't copied. inPath may be a symbolic link, as
+// inputs in a sandbox are. Files that can be written are copied instead, so
+// a later change to one doesn't change the other; Bazel outputs are
+// read-only. Files are also copied when a hard link can't be created, for
+// example, because the output is on a different file system.
+func hardLinkOrCopyFile(inPath, outPath string) error {
+	if target, err := filepath.EvalSymlinks(inPath); err == nil {
+		if fi, err := os.Stat(target); err == nil && fi.Mode().Perm()&0222 == 0 {
+			if err := os.Link(target, outPath); err == nil {
+				return nil
+			}
+		}
+	}
+	return copyFile(inPath, outPath)
+}
@@ -0,0 +1,258 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestStdlibShard(t *testing.T) {
+	// go list -deps prints packages in dependency order, and unsafe has no
+	// archive.
+	pkgs := []string{"unsafe", "internal/bytealg", "runtime", "errors", "fmt", "runtime", "vendor/golang.org/x/net/dns/dnsmessage", "net", "net/http"}
+	var all []string
+	for shard := 0; shard < 3; shard++ {
+		got := stdlibShard(pkgs, shard, 3)
+		if len(got) < 2 || len(got) > 3 {
+			t.Errorf("shard %d: got %v; want 2 or 3 packages", shard, got)
+		}
+		all = append(all, got...)
+	}
+	want := []string{"internal/bytealg", "runtime", "errors", "fmt", "vendor/golang.org/x/net/dns/dnsmessage", "net", "net/http"}
+	if !reflect.DeepEqual(all, want) {
+		t.Errorf("got packages %v across shards; want each of %v once, in dependency order", all, want)
+	}
+	if got := stdlibShard(pkgs[:2], 1, 4); len(got) != 0 {
+		t.Errorf("got %v in a shard beyond the packages; want nothing", got)
+	}
+}
+
+func TestUsePrebuiltArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestUsePrebuiltArchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An earlier shard compiled runtime.
+	shardPkgDir := filepath.Join(dir, "shard_0", "pkg", "linux_amd64")
+	if err := os.MkdirAll(shardPkgDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	runtimeArchive := filepath.Join(shardPkgDir, "runtime.a")
+	if err := ioutil.WriteFile(runtimeArchive, []byte("runtime archive"), 0444); err != nil {
+		t.Fatal(err)
+	}
+	importcfgPath, err := writeStdlibShardImportcfg(dir, []string{shardPkgDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	prebuilt, err := readStdlibShardImportcfg(importcfgPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]string{"runtime": runtimeArchive}; !reflect.DeepEqual(prebuilt, want) {
+		t.Fatalf("got prebuilt archives %v; want %v", prebuilt, want)
+	}
+
+	goroot := filepath.Join(dir, "goroot")
+	defer os.Setenv("GOROOT", os.Getenv("GOROOT"))
+	os.Setenv("GOROOT", goroot)
+	workDir := filepath.Join(dir, "b001")
+	if err := os.MkdirAll(workDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("compile", func(t *testing.T) {
+		out := filepath.Join(workDir, "_pkg_.a")
+		args := []string{"/sdk/pkg/tool/linux_amd64/compile", "-o", out, "-p", "runtime", "-std", "-+", "-pack", "./proc.go"}
+		newArgs, err := usePrebuiltArchive(args, filepath.Join(goroot, "src", "runtime"), prebuilt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if newArgs != nil {
+			t.Errorf("got command %q; want the compiler not to run", newArgs)
+		}
+		if data, err := ioutil.ReadFile(out); err != nil {
+			t.Fatal(err)
+		} else if string(data) != "runtime archive" {
+			t.Errorf("got compiler output %q; want the prebuilt archive", data)
+		}
+	})
+
+	t.Run("asm", func(t *testing.T) {
+		// Before Go 1.19, the assembler isn't passed -p.
+		out := filepath.Join(workDir, "asm_amd64.o")
+		args := []string{"/sdk/pkg/tool/linux_amd64/asm", "-trimpath", workDir + "=>", "-I", workDir, "-o", out, "./asm_amd64.s", "./duff_amd64.s"}
+		newArgs, err := usePrebuiltArchive(args, filepath.Join(goroot, "src", "runtime"), prebuilt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		emptyPath := filepath.Join(workDir, "_prebuilt_empty.s")
+		want := append(args[:len(args)-2:len(args)-2], emptyPath)
+		if !reflect.DeepEqual(newArgs, want) {
+			t.Errorf("got command %q; want %q", newArgs, want)
+		}
+		if data, err := ioutil.ReadFile(emptyPath); err != nil {
+			t.Fatal(err)
+		} else if len(data) != 0 {
+			t.Errorf("got assembly %q; want an empty file", data)
+		}
+	})
+
+	t.Run("other_package", func(t *testing.T) {
+		args := []string{"/sdk/pkg/tool/linux_amd64/compile", "-o", filepath.Join(dir, "b002", "_pkg_.a"), "-p", "fmt", "-std", "-pack", "./print.go"}
+		newArgs, err := usePrebuiltArchive(args, filepath.Join(goroot, "src", "fmt"), prebuilt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(newArgs, args) {
+			t.Errorf("got command %q; want %q unchanged", newArgs, args)
+		}
+	})
+}
+
+func TestStdlibShardMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestStdlibShardMerge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each shard compiled fmt's dependencies too.
+	shards := [][]string{{"errors", "fmt"}, {"net", "net/http"}}
+	var shardPkgDirs []string
+	for i, pkgs := range shards {
+		pkgDir := filepath.Join(dir, fmt.Sprintf("shard_%d", i), "pkg", "linux_amd64")
+		for _, pkg := range append([]string{"errors", "runtime", "internal/bytealg"}, pkgs...) {
+			path := filepath.Join(pkgDir, filepath.FromSlash(pkg)+".a")
+			if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+				t.Fatal(err)
+			}
+			// The first shard's archives are read-only, like Bazel outputs,
+			// so they're hard linked. The others are copied.
+			perm := os.FileMode(0666)
+			if i == 0 {
+				perm = 0444
+			}
+			if err := ioutil.WriteFile(path, []byte(pkg), perm); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := pruneStdlibShard(pkgDir, pkgs); err != nil {
+			t.Fatal(err)
+		}
+		shardPkgDirs = append(shardPkgDirs, pkgDir)
+	}
+
+	out := filepath.Join(dir, "out", "pkg", "linux_amd64")
+	if err := mergeStdlibShards(out, shardPkgDirs); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	if err := filepath.Walk(out, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(out, path)
+		got = append(got, filepath.ToSlash(rel))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	want := []string{"errors.a", "fmt.a", "net.a", "net/http.a"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("merged archives: got %v; want %v", got, want)
+	}
+	for i, pkg := range []string{"fmt", "net"} {
+		inInfo, err := os.Stat(filepath.Join(shardPkgDirs[i], pkg+".a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outInfo, err := os.Stat(filepath.Join(out, pkg+".a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked, wantLinked := os.SameFile(inInfo, outInfo), i == 0; linked != wantLinked {
+			t.Errorf("%s.a: got hard link %v; want %v", pkg, linked, wantLinked)
+		}
+	}
+
+	// Merging a shard twice means the shards overlap.
+	err = mergeStdlibShards(filepath.Join(dir, "out2"), []string{shardPkgDirs[0], shardPkgDirs[0]})
+	if err == nil || !strings.Contains(err.Error(), "more than one shard") {
+		t.Errorf("got error %v; want error about more than one shard", err)
+	}
+}
+
+func TestHardLinkOrCopyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestHardLinkOrCopyFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		desc     string
+		mode     os.FileMode
+		wantLink bool
+	}{
+		{desc: "read_only", mode: 0444, wantLink: true},
+		{desc: "writable", mode: 0644, wantLink: false},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			in := filepath.Join(dir, tc.desc+".a")
+			if err := ioutil.WriteFile(in, []byte(arHeader), tc.mode); err != nil {
+				t.Fatal(err)
+			}
+			// Inputs in a sandbox are symbolic links to the real files.
+			inLink := filepath.Join(dir, tc.desc+"_link.a")
+			if err := os.Symlink(in, inLink); err != nil {
+				t.Skipf("can't create symbolic link: %v", err)
+			}
+			out := filepath.Join(dir, tc.desc+"_out.a")
+			if err := hardLinkOrCopyFile(inLink, out); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := ioutil.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != arHeader {
+				t.Errorf("got %q; want %q", data, arHeader)
+			}
+			inInfo, err := os.Stat(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			outInfo, err := os.Lstat(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := os.SameFile(inInfo, outInfo); got != tc.wantLink {
+				t.Errorf("got linked %v; want %v", got, tc.wantLink)
+			}
+		})
+	}
+}
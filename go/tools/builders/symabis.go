@@ -0,0 +1,136 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// genSymabis writes a symabis file for a set of assembly files with
+// "go tool asm -gensymabis". It's used by go_symabis to describe the
+// symbols assembly in one package references in other packages.
+func genSymabis(args []string) error {
+	args, err := buildenv.ReadParamsFiles(args)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("GoSymabis", flag.ExitOnError)
+	goenv := buildenv.EnvFlags(fs)
+	var unfilteredSrcs multiFlag
+	fs.Var(&unfilteredSrcs, "src", ".s or .h file to scan")
+	outPath := fs.String("o", "", "The symabis file to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := goenv.CheckFlags(); err != nil {
+		return err
+	}
+	if *outPath == "" {
+		return errors.New("-o must be set")
+	}
+
+	srcs, err := filterAndSplitFiles(unfilteredSrcs)
+	if err != nil {
+		return err
+	}
+	workDir, cleanup, err := goenv.WorkDir()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	var data []byte
+	if len(srcs.sSrcs) > 0 {
+		symabisPath, err := buildSymabisFile(goenv, srcs.sSrcs, srcs.hSrcs, filepath.Join(workDir, "go_asm.h"))
+		if symabisPath != "" {
+			defer os.Remove(symabisPath)
+		}
+		if err != nil {
+			return err
+		}
+		if symabisPath != "" {
+			if data, err = ioutil.ReadFile(symabisPath); err != nil {
+				return err
+			}
+		}
+	}
+	return ioutil.WriteFile(*outPath, data, 0666)
+}
+
+// mergeSymabis writes a symabis file for the package packagePath, containing
+// the entries in ownPath and the references to packagePath's symbols in
+// depPaths. ownPath may be empty if the package has no assembly. This lets
+// the compiler generate ABI wrappers for functions that are called from
+// assembly in other packages. The caller is responsible for deleting the
+// returned file.
+func mergeSymabis(packagePath, ownPath string, depPaths []string) (string, error) {
+	var buf bytes.Buffer
+	if ownPath != "" {
+		data, err := ioutil.ReadFile(ownPath)
+		if err != nil {
+			return "", err
+		}
+		buf.Write(data)
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			buf.WriteByte('\n')
+		}
+	}
+	prefix := packagePath + "."
+	for _, path := range depPaths {
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			// Other packages' definitions and references to symbols in
+			// other packages don't concern the compiler. Unqualified names
+			// refer to symbols in the package the file was generated for.
+			fields := strings.Fields(s.Text())
+			if len(fields) == 3 && fields[0] == "ref" && strings.HasPrefix(fields[1], prefix) {
+				buf.WriteString(s.Text())
+				buf.WriteByte('\n')
+			}
+		}
+		err = s.Err()
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	out, err := ioutil.TempFile("", "symabis")
+	if err != nil {
+		return "", err
+	}
+	if _, err := out.Write(buf.Bytes()); err != nil {
+		out.Close()
+		os.Remove(out.Name())
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(out.Name())
+		return "", err
+	}
+	return out.Name(), nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMergeSymabis(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMergeSymabis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	own := write("own", "def \"\".Add ABI0")
+	dep := write("dep", `def "".Sum ABI0
+ref "".helper ABI0
+ref example.com/a.Mul ABI0
+ref example.com/ab.Div ABI0
+ref runtime.memmove ABI0
+def example.com/a.Sub ABI0
+`)
+
+	for _, tc := range []struct {
+		desc, own, want string
+	}{
+		{
+			desc: "with_asm",
+			own:  own,
+			want: "def \"\".Add ABI0\nref example.com/a.Mul ABI0\n",
+		}, {
+			desc: "without_asm",
+			want: "ref example.com/a.Mul ABI0\n",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			path, err := mergeSymabis("example.com/a", tc.own, []string{dep})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(path)
+			got, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// symbolMap describes which functions from which packages were linked into
+// a binary. Vulnerability scanners use it to check whether an affected
+// function is actually present, rather than only its module.
+type symbolMap struct {
+	// GoVersion is the version of the Go SDK the binary was built with. It
+	// determines the versions of standard library packages.
+	GoVersion string `json:"go_version,omitempty"`
+
+	// Packages lists the packages with functions in the binary, sorted by
+	// import path.
+	Packages []*symbolPackage `json:"packages"`
+}
+
+type symbolPackage struct {
+	// ImportPath is the path the package is imported with.
+	ImportPath string `json:"importpath"`
+
+	// PackagePath is the package path (importmap) used for symbols in the
+	// binary. It's omitted when it matches ImportPath.
+	PackagePath string `json:"packagepath,omitempty"`
+
+	// Label is the label of the library the package was built from. It's
+	// empty for standard library packages.
+	Label string `json:"label,omitempty"`
+
+	// Repository is the name of the Bazel repository containing Label,
+	// for example, the go_repository a module was downloaded with. It's
+	// empty for packages in the main workspace.
+	Repository string `json:"repository,omitempty"`
+
+	// Std is true for standard library packages.
+	Std bool `json:"std,omitempty"`
+
+	// Functions lists the functions and methods linked from the package,
+	// without the package path, for example, "(*Server).Serve". Closures
+	// and generic instantiations are listed separately.
+	Functions []string `json:"functions"`
+}
+
+// symbolMapFlag parses -main and -package flags of the form
+// label=importpath=importmap.
+type symbolMapFlag []*symbolPackage
+
+func (m *symbolMapFlag) String() string {
+	if m == nil || len(*m) == 0 {
+		return ""
+	}
+	return fmt.Sprint(*m)
+}
+
+func (m *symbolMapFlag) Set(v string) error {
+	parts := strings.Split(v, "=")
+	if len(parts) != 3 {
+		return fmt.Errorf("badly formed package flag: %s", v)
+	}
+	*m = append(*m, &symbolPackage{
+		Label:       parts[0],
+		Repository:  labelRepository(parts[0]),
+		ImportPath:  parts[1],
+		PackagePath: parts[2],
+	})
+	return nil
+}
+
+// writeSymbolMap writes a JSON file mapping functions in a linked binary to
+// the packages, libraries, and repositories they came from.
+func writeSymbolMap(args []string) error {
+	args, err := buildenv.ReadParamsFiles(args)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("GoSymbolMap", flag.ExitOnError)
+	goenv := buildenv.EnvFlags(fs)
+	var mainPkg, pkgs symbolMapFlag
+	binaryPath := fs.String("binary", "", "The linked binary")
+	outPath := fs.String("o", "", "The JSON file to write")
+	packageListPath := fs.String("package_list", "", "The file containing the list of standard library packages")
+	fs.Var(&mainPkg, "main", "The main package, as label=importpath=importmap")
+	fs.Var(&pkgs, "package", "A linked package, as label=importpath=importmap")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if err := goenv.CheckFlags(); err != nil {
+		return err
+	}
+	if *binaryPath == "" || *outPath == "" {
+		return errors.New("-binary and -o must be set")
+	}
+	stdPkgs, err := readStdPackageList(*packageListPath)
+	if err != nil {
+		return err
+	}
+
+	var version bytes.Buffer
+	if err := goenv.RunCommandToFile(&version, goenv.GoCmd("version", buildenv.Abs(*binaryPath))); err != nil {
+		return err
+	}
+	var nm bytes.Buffer
+	if err := goenv.RunCommandToFile(&nm, goenv.GoTool("nm", buildenv.Abs(*binaryPath))); err != nil {
+		return err
+	}
+	m, err := buildSymbolMap(&nm, mainPkg, pkgs, stdPkgs)
+	if err != nil {
+		return err
+	}
+	m.GoVersion = parseGoVersionOutput(version.String())
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(buildenv.Abs(*outPath), append(data, '\n'), 0666)
+}
+
+// buildSymbolMap reads output from "go tool nm" and attributes each function
+// to a package in mainPkg, pkgs, or the standard library. Other symbols, like
+// data, type descriptors, and C functions, are not recorded.
+func buildSymbolMap(nm io.Reader, mainPkg, pkgs []*symbolPackage, stdPkgs map[string]bool) (*symbolMap, error) {
+	byPath := make(map[string]*symbolPackage)
+	for _, p := range pkgs {
+		byPath[p.PackagePath] = p
+	}
+	if len(mainPkg) > 0 {
+		// The main package is compiled with the package path "main".
+		byPath["main"] = mainPkg[0]
+	}
+	functions := make(map[*symbolPackage]map[string]bool)
+
+	s := bufio.NewScanner(nm)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		kind, name := parseNMLine(s.Text())
+		if kind != "T" && kind != "t" {
+			continue
+		}
+		path, fn := splitSymbolName(name)
+		if path == "" {
+			continue
+		}
+		p, ok := byPath[path]
+		if !ok {
+			if !stdPkgs[path] {
+				continue
+			}
+			p = &symbolPackage{ImportPath: path, PackagePath: path, Std: true}
+			byPath[path] = p
+		}
+		if functions[p] == nil {
+			functions[p] = make(map[string]bool)
+		}
+		functions[p][fn] = true
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	m := &symbolMap{Packages: []*symbolPackage{}}
+	for p, fns := range functions {
+		for fn := range fns {
+			p.Functions = append(p.Functions, fn)
+		}
+		sort.Strings(p.Functions)
+		if p.PackagePath == p.ImportPath {
+			p.PackagePath = ""
+		}
+		m.Packages = append(m.Packages, p)
+	}
+	sort.Slice(m.Packages, func(i, j int) bool {
+		return m.Packages[i].ImportPath < m.Packages[j].ImportPath
+	})
+	return m, nil
+}
+
+// parseNMLine returns the kind and name of the symbol on a line of output
+// from "go tool nm". Undefined symbols have no address. Names may contain
+// spaces, for example, in instantiations of generic functions.
+func parseNMLine(line string) (kind, name string) {
+	fields := strings.SplitN(strings.TrimLeft(line, " "), " ", 3)
+	switch {
+	case len(fields) == 3 && len(fields[1]) == 1:
+		return fields[1], fields[2]
+	case len(fields) >= 2 && len(fields[0]) == 1:
+		return fields[0], strings.Join(fields[1:], " ")
+	default:
+		return "", ""
+	}
+}
+
+// splitSymbolName splits a linker symbol name into a package path and the
+// name of the function within the package. The linker escapes dots in the
+// last element of package paths, so "gopkg.in/yaml.v2" appears as
+// "gopkg.in/yaml%2ev2".
+func splitSymbolName(name string) (path, fn string) {
+	prefix := name
+	if i := strings.IndexByte(prefix, '['); i >= 0 {
+		prefix = prefix[:i]
+	}
+	slash := strings.LastIndexByte(prefix, '/')
+	dot := strings.IndexByte(prefix[slash+1:], '.')
+	if dot < 0 {
+		return "", ""
+	}
+	dot += slash + 1
+	path, err := url.PathUnescape(name[:dot])
+	if err != nil {
+		return "", ""
+	}
+	return path, name[dot+1:]
+}
+
+// labelRepository returns the name of the repository in a label string, or
+// "" for labels in the main workspace.
+func labelRepository(label string) string {
+	if !strings.HasPrefix(label, "@") {
+		return ""
+	}
+	if i := strings.Index(label, "//"); i >= 0 {
+		return label[1:i]
+	}
+	return label[1:]
+}
+
+// parseGoVersionOutput returns the version from the output of
+// "go version <binary>", which looks like "path: go1.14.2".
+func parseGoVersionOutput(out string) string {
+	out = strings.TrimSpace(out)
+	if i := strings.LastIndex(out, ": "); i >= 0 {
+		return out[i+2:]
+	}
+	return ""
+}
+
+// readStdPackageList reads the list of standard library packages written
+// by the SDK rules.
+func readStdPackageList(path string) (map[string]bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pkgs := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			pkgs[line] = true
+		}
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSplitSymbolName(t *testing.T) {
+	for _, test := range []struct {
+		name, path, fn string
+	}{
+		{name: "main.main", path: "main", fn: "main"},
+		{name: "net/http.(*Server).Serve", path: "net/http", fn: "(*Server).Serve"},
+		{name: "example.com/a.F.func1", path: "example.com/a", fn: "F.func1"},
+		{name: "gopkg.in/yaml%2ev2.Marshal", path: "gopkg.in/yaml.v2", fn: "Marshal"},
+		{name: "example.com/a.Map[go.shape.string]", path: "example.com/a", fn: "Map[go.shape.string]"},
+		{name: "example.com/a.(*List[go.shape.int]).Push", path: "example.com/a", fn: "(*List[go.shape.int]).Push"},
+		{name: "_cgo_topofstack", path: "", fn: ""},
+	} {
+		if path, fn := splitSymbolName(test.name); path != test.path || fn != test.fn {
+			t.Errorf("splitSymbolName(%q): got %q, %q; want %q, %q", test.name, path, fn, test.path, test.fn)
+		}
+	}
+}
+
+func TestParseNMLine(t *testing.T) {
+	for _, test := range []struct {
+		line, kind, name string
+	}{
+		{line: "  4a1b20 T net/http.(*Server).Serve", kind: "T", name: "net/http.(*Server).Serve"},
+		{line: "  4a1b20 t example.com/a.F[go.shape.struct { X int }]", kind: "t", name: "example.com/a.F[go.shape.struct { X int }]"},
+		{line: "         U __libc_start_main", kind: "U", name: "__libc_start_main"},
+		{line: "", kind: "", name: ""},
+	} {
+		if kind, name := parseNMLine(test.line); kind != test.kind || name != test.name {
+			t.Errorf("parseNMLine(%q): got %q, %q; want %q, %q", test.line, kind, name, test.kind, test.name)
+		}
+	}
+}
+
+func TestLabelRepository(t *testing.T) {
+	for label, want := range map[string]string{
+		"//foo:go_default_library":                    "",
+		"@org_golang_x_net//http2:go_default_library": "org_golang_x_net",
+		"@io_bazel_rules_go//go/tools/coverdata":      "io_bazel_rules_go",
+	} {
+		if got := labelRepository(label); got != want {
+			t.Errorf("labelRepository(%q): got %q; want %q", label, got, want)
+		}
+	}
+}
+
+func TestBuildSymbolMap(t *testing.T) {
+	var mainPkg, pkgs symbolMapFlag
+	for _, v := range []string{
+		"//cmd/server:server_lib=example.com/cmd/server=example.com/cmd/server",
+	} {
+		if err := mainPkg.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range []string{
+		"@org_golang_x_net//http2:go_default_library=golang.org/x/net/http2=golang.org/x/net/http2",
+		"//vendor/gopkg.in/yaml.v2:go_default_library=gopkg.in/yaml.v2=example.com/vendor/gopkg.in/yaml.v2",
+		"@org_golang_x_text//unused:go_default_library=golang.org/x/text/unused=golang.org/x/text/unused",
+	} {
+		if err := pkgs.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	nm := strings.Join([]string{
+		"  401000 T main.main",
+		"  401100 T main.init.0",
+		"  402000 T golang.org/x/net/http2.(*Framer).WriteData",
+		"  402100 t golang.org/x/net/http2.(*Framer).WriteData",
+		"  403000 T example.com/vendor/gopkg.in/yaml%2ev2.Marshal",
+		"  404000 D golang.org/x/net/http2.ErrFrameTooLarge",
+		"  405000 T fmt.Println",
+		"  406000 T type:.eq.[2]interface {}",
+		"  407000 T example.com/unknown.F",
+		"         U __libc_start_main",
+	}, "\n")
+	stdPkgs := map[string]bool{"fmt": true}
+
+	m, err := buildSymbolMap(strings.NewReader(nm), mainPkg, pkgs, stdPkgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+  "packages": [
+    {
+      "importpath": "example.com/cmd/server",
+      "label": "//cmd/server:server_lib",
+      "functions": [
+        "init.0",
+        "main"
+      ]
+    },
+    {
+      "importpath": "fmt",
+      "std": true,
+      "functions": [
+        "Println"
+      ]
+    },
+    {
+      "importpath": "golang.org/x/net/http2",
+      "label": "@org_golang_x_net//http2:go_default_library",
+      "repository": "org_golang_x_net",
+      "functions": [
+        "(*Framer).WriteData"
+      ]
+    },
+    {
+      "importpath": "gopkg.in/yaml.v2",
+      "packagepath": "example.com/vendor/gopkg.in/yaml.v2",
+      "label": "//vendor/gopkg.in/yaml.v2:go_default_library",
+      "functions": [
+        "Marshal"
+      ]
+    }
+  ]
+}`
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseGoVersionOutput(t *testing.T) {
+	if got, want := parseGoVersionOutput("bazel-out/k8-fastbuild/bin/cmd/server: go1.14.2\n"), "go1.14.2"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// trimpathRewrites returns the value of the -trimpath flag for the compiler
+// and assembler. trimDir is the directory that would be trimmed without a
+// prefix: the execution root, or the cgo source directory. When cgo copies
+// the sources into a temporary directory, pkgDir is the directory they were
+// copied from, and names in trimDir are rewritten as if they were there.
+//
+// If prefix is empty, trimDir is returned, and file names are recorded
+// relative to it. Otherwise, file names are rewritten to be relative to the
+// workspace and are joined with prefix. Generated files are rewritten as if
+// they were in the source tree, so a generated file appears next to the
+// sources in its package. A prefix of "." produces workspace-relative names.
+//
+// Rewrite rules require Go 1.13 or later.
+func trimpathRewrites(trimDir, pkgDir, prefix string, srcs []string) string {
+	trimDir = buildenv.Abs(trimDir)
+	if prefix == "" {
+		return trimDir
+	}
+	execRoot := buildenv.Abs(".")
+
+	var rules []string
+	if trimDir != execRoot {
+		dir := trimDir
+		if pkgDir != "" {
+			dir = buildenv.Abs(pkgDir)
+		}
+		rel, err := filepath.Rel(execRoot, dir)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			// The package directory is outside the execution root.
+			rel = ""
+		}
+		rules = append(rules, trimDir+"=>"+joinTrimpathPrefix(prefix, stripOutputRoot(filepath.ToSlash(rel))))
+	}
+
+	roots := make(map[string]bool)
+	for _, src := range srcs {
+		rel, err := filepath.Rel(execRoot, src)
+		if err != nil {
+			continue
+		}
+		if root := outputRoot(filepath.ToSlash(rel)); root != "" {
+			roots[root] = true
+		}
+	}
+	var sortedRoots []string
+	for root := range roots {
+		sortedRoots = append(sortedRoots, root)
+	}
+	sort.Strings(sortedRoots)
+	for _, root := range sortedRoots {
+		rules = append(rules, filepath.Join(execRoot, filepath.FromSlash(root))+"=>"+joinTrimpathPrefix(prefix, ""))
+	}
+
+	rules = append(rules, execRoot+"=>"+joinTrimpathPrefix(prefix, ""))
+	return strings.Join(rules, ";")
+}
+
+// outputRoot returns the output root directory containing a file, given
+// its slash-separated path relative to the execution root. For example,
+// the output root of "bazel-out/k8-fastbuild/bin/foo/gen.go" is
+// "bazel-out/k8-fastbuild/bin". "" is returned for source files.
+func outputRoot(rel string) string {
+	parts := strings.SplitN(rel, "/", 4)
+	if len(parts) < 3 || parts[0] != "bazel-out" {
+		return ""
+	}
+	return path.Join(parts[:3]...)
+}
+
+// stripOutputRoot removes the output root from rel, if there is one.
+func stripOutputRoot(rel string) string {
+	root := outputRoot(rel)
+	if root == "" {
+		return rel
+	}
+	return strings.TrimPrefix(rel[len(root):], "/")
+}
+
+// joinTrimpathPrefix returns the replacement for a directory that is rel
+// within the workspace. An empty replacement makes the compiler record
+// paths relative to the directory that was trimmed.
+func joinTrimpathPrefix(prefix, rel string) string {
+	if prefix == "." {
+		return rel
+	}
+	if prefix != "/" {
+		prefix = strings.TrimSuffix(prefix, "/")
+	}
+	if rel == "" || rel == "." {
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + rel
+}
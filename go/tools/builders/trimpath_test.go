@@ -0,0 +1,90 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrimpathRewrites(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srcs := []string{
+		filepath.Join(wd, "pkg/a.go"),
+		filepath.Join(wd, "bazel-out/k8-fastbuild/bin/pkg/gen.go"),
+		filepath.Join(wd, "external/repo/b.go"),
+	}
+	for _, tc := range []struct {
+		desc, trimDir, pkgDir, prefix string
+		want                          []string
+	}{
+		{
+			desc:    "no_prefix",
+			trimDir: ".",
+			want:    []string{wd},
+		}, {
+			desc:    "no_prefix_cgo",
+			trimDir: "pkg",
+			want:    []string{filepath.Join(wd, "pkg")},
+		}, {
+			desc:    "workspace_relative",
+			trimDir: ".",
+			prefix:  ".",
+			want: []string{
+				filepath.Join(wd, "bazel-out/k8-fastbuild/bin") + "=>",
+				wd + "=>",
+			},
+		}, {
+			desc:    "prefix",
+			trimDir: ".",
+			prefix:  "/home/gopher/src/",
+			want: []string{
+				filepath.Join(wd, "bazel-out/k8-fastbuild/bin") + "=>/home/gopher/src",
+				wd + "=>/home/gopher/src",
+			},
+		}, {
+			desc:    "cgo_copied",
+			trimDir: filepath.Join(os.TempDir(), "cgo"),
+			pkgDir:  "pkg",
+			prefix:  "src",
+			want: []string{
+				filepath.Join(os.TempDir(), "cgo") + "=>src/pkg",
+				filepath.Join(wd, "bazel-out/k8-fastbuild/bin") + "=>src",
+				wd + "=>src",
+			},
+		}, {
+			desc:    "cgo_generated",
+			trimDir: "bazel-out/k8-fastbuild/bin/pkg",
+			prefix:  "src",
+			want: []string{
+				filepath.Join(wd, "bazel-out/k8-fastbuild/bin/pkg") + "=>src/pkg",
+				filepath.Join(wd, "bazel-out/k8-fastbuild/bin") + "=>src",
+				wd + "=>src",
+			},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			got := trimpathRewrites(tc.trimDir, tc.pkgDir, tc.prefix, srcs)
+			if want := strings.Join(tc.want, ";"); got != want {
+				t.Errorf("got %q; want %q", got, want)
+			}
+		})
+	}
+}
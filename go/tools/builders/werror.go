@@ -0,0 +1,149 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+)
+
+// readWerrorPolicy reads a file listing compiler output that should be
+// treated as an error in some parts of the repository. Each non-blank line
+// contains a label pattern followed by a regular expression, separated by
+// whitespace. The expression extends to the end of the line and may contain
+// spaces. Lines starting with '#' are ignored; '#' elsewhere is part of the
+// expression. readWerrorPolicy returns the expressions whose patterns match
+// label.
+func readWerrorPolicy(path, label string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var exprs []string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		j := strings.IndexAny(line, " \t")
+		if j < 0 {
+			return nil, fmt.Errorf("%s:%d: expected a label pattern and a regular expression, got %q", path, i+1, line)
+		}
+		pattern, expr := line[:j], strings.TrimSpace(line[j:])
+		if !strings.Contains(pattern, "//") {
+			return nil, fmt.Errorf("%s:%d: invalid label pattern %q", path, i+1, pattern)
+		}
+		if _, err := regexp.Compile(expr); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, i+1, err)
+		}
+		if matchLabelPattern(pattern, label) {
+			exprs = append(exprs, expr)
+		}
+	}
+	return exprs, nil
+}
+
+// matchLabelPattern reports whether label matches pattern. Patterns may name
+// a single target ("//a/b:c"), every target in a package ("//a/b" or
+// "//a/b:all"), or every target in a package and its subpackages
+// ("//a/b/..." or "//...").
+func matchLabelPattern(pattern, label string) bool {
+	pattern, label = normalizeLabel(pattern), normalizeLabel(label)
+	i, j := strings.Index(pattern, "//"), strings.Index(label, "//")
+	if i < 0 || j < 0 || pattern[:i] != label[:j] {
+		return false
+	}
+	pattern, label = pattern[i+2:], label[j+2:]
+	pkg, name := label, ""
+	if k := strings.IndexByte(label, ':'); k >= 0 {
+		pkg, name = label[:k], label[k+1:]
+	}
+	switch {
+	case pattern == "...":
+		return true
+	case strings.HasSuffix(pattern, "/..."):
+		dir := strings.TrimSuffix(pattern, "/...")
+		return pkg == dir || strings.HasPrefix(pkg, dir+"/")
+	case strings.HasSuffix(pattern, ":all"):
+		return pkg == strings.TrimSuffix(pattern, ":all")
+	case strings.Contains(pattern, ":"):
+		return pattern == pkg+":"+name
+	default:
+		return pattern == pkg
+	}
+}
+
+// werrorWriter copies output from the compiler and other tools to w and
+// records lines matching any of a list of regular expressions.
+type werrorWriter struct {
+	w       io.Writer
+	res     []*regexp.Regexp
+	line    []byte
+	matches []string
+}
+
+func newWerrorWriter(w io.Writer, exprs []string) (*werrorWriter, error) {
+	ww := &werrorWriter{w: w}
+	for _, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid werror expression %q: %v", expr, err)
+		}
+		ww.res = append(ww.res, re)
+	}
+	return ww, nil
+}
+
+func (ww *werrorWriter) Write(p []byte) (int, error) {
+	n, err := ww.w.Write(p)
+	for q := p[:n]; len(q) > 0; {
+		i := bytes.IndexByte(q, '\n')
+		if i < 0 {
+			ww.line = append(ww.line, q...)
+			break
+		}
+		ww.line = append(ww.line, q[:i]...)
+		ww.check()
+		q = q[i+1:]
+	}
+	return n, err
+}
+
+func (ww *werrorWriter) check() {
+	line := strings.TrimRight(string(ww.line), "\r")
+	ww.line = ww.line[:0]
+	for _, re := range ww.res {
+		if re.MatchString(line) {
+			ww.matches = append(ww.matches, line)
+			return
+		}
+	}
+}
+
+// err returns an error listing the lines that matched, or nil if no lines
+// matched.
+func (ww *werrorWriter) err() error {
+	if len(ww.line) > 0 {
+		ww.check()
+	}
+	if len(ww.matches) == 0 {
+		return nil
+	}
+	return fmt.Errorf("compiler output treated as errors by werror:\n%s", strings.Join(ww.matches, "\n"))
+}
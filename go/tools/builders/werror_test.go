@@ -0,0 +1,112 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatchLabelPattern(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, label string
+		want           bool
+	}{
+		{"//...", "//a/b:c", true},
+		{"//a/...", "//a:c", true},
+		{"//a/...", "//a/b:c", true},
+		{"//a/...", "//ab:c", false},
+		{"//a", "//a:c", true},
+		{"//a", "//a/b:c", false},
+		{"//a:all", "//a:c", true},
+		{"//a:c", "//a:c", true},
+		{"//a:c", "//a:d", false},
+		{"@//a/...", "//a/b:c", true},
+		{"//a/...", "@r//a/b:c", false},
+		{"@r//a/...", "@r//a/b:c", true},
+	} {
+		if got := matchLabelPattern(tc.pattern, tc.label); got != tc.want {
+			t.Errorf("matchLabelPattern(%q, %q) = %v; want %v", tc.pattern, tc.label, got, tc.want)
+		}
+	}
+}
+
+func TestReadWerrorPolicy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestReadWerrorPolicy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "policy.txt")
+	policy := `
+# Payments must not allocate in hot paths.
+//payments/... moved to heap: .*
+//payments/ledger:ledger	escapes to heap
+//search/... deprecated
+`
+	if err := ioutil.WriteFile(path, []byte(policy), 0666); err != nil {
+		t.Fatal(err)
+	}
+	exprs, err := readWerrorPolicy(path, "//payments/ledger:ledger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"moved to heap: .*", "escapes to heap"}; !reflect.DeepEqual(exprs, want) {
+		t.Errorf("got %q; want %q", exprs, want)
+	}
+
+	for _, bad := range []string{"//a/...\n", "a/... x\n", "//a/... (\n"} {
+		if err := ioutil.WriteFile(path, []byte(bad), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readWerrorPolicy(path, "//a:a"); err == nil {
+			t.Errorf("policy %q: got success; want error", bad)
+		}
+	}
+}
+
+func TestWerrorWriter(t *testing.T) {
+	var out bytes.Buffer
+	w, err := newWerrorWriter(&out, []string{"moved to heap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const output = "a.go:3:2: moved to heap: x\na.go:4:6: can inline f\na.go:9:2: moved to "
+	for _, chunk := range []string{output[:10], output[10:40], output[40:], "heap: y"} {
+		if _, err := w.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := out.String(), output+"heap: y"; got != want {
+		t.Errorf("output was not copied: got %q; want %q", got, want)
+	}
+	err = w.err()
+	if err == nil {
+		t.Fatal("got no error; want error")
+	}
+	for _, line := range []string{"a.go:3:2: moved to heap: x", "a.go:9:2: moved to heap: y"} {
+		if !strings.Contains(err.Error(), line) {
+			t.Errorf("error does not mention %q:\n%v", line, err)
+		}
+	}
+	if strings.Contains(err.Error(), "can inline") {
+		t.Errorf("error mentions a line that didn't match:\n%v", err)
+	}
+}
@@ -0,0 +1,269 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/builders/buildenv"
+)
+
+// xcLibrary is a static library built for one architecture of a platform,
+// like the iOS simulator.
+type xcLibrary struct {
+	platform, variant, arch, path string
+}
+
+// xcLibraryFlag parses -library flags of the form platform:arch=path, where
+// platform is "ios" or "ios-simulator".
+type xcLibraryFlag []xcLibrary
+
+func (f *xcLibraryFlag) String() string {
+	if f == nil || len(*f) == 0 {
+		return ""
+	}
+	return fmt.Sprint(*f)
+}
+
+func (f *xcLibraryFlag) Set(v string) error {
+	eq := strings.IndexByte(v, '=')
+	colon := strings.IndexByte(v, ':')
+	if eq < 0 || colon < 0 || colon > eq {
+		return fmt.Errorf("badly formed library flag: %s", v)
+	}
+	lib := xcLibrary{arch: v[colon+1 : eq], path: v[eq+1:]}
+	lib.platform = v[:colon]
+	if i := strings.IndexByte(lib.platform, '-'); i >= 0 {
+		lib.platform, lib.variant = lib.platform[:i], lib.platform[i+1:]
+	}
+	if _, ok := machoCPUs[lib.arch]; !ok {
+		return fmt.Errorf("library flag %s: unsupported architecture %s", v, lib.arch)
+	}
+	*f = append(*f, lib)
+	return nil
+}
+
+// xcSlice is a directory of an XCFramework with a library and headers for
+// one platform. The library contains code for each of its architectures.
+type xcSlice struct {
+	platform, variant string
+	libs              []xcLibrary
+}
+
+// identifier returns the name of the slice's directory, which follows the
+// convention of xcodebuild -create-xcframework, like
+// "ios-arm64_x86_64-simulator".
+func (s *xcSlice) identifier() string {
+	id := s.platform + "-" + strings.Join(s.archs(), "_")
+	if s.variant != "" {
+		id += "-" + s.variant
+	}
+	return id
+}
+
+func (s *xcSlice) archs() []string {
+	archs := make([]string, len(s.libs))
+	for i, lib := range s.libs {
+		archs[i] = lib.arch
+	}
+	return archs
+}
+
+// machoCPUs maps architecture names to Mach-O CPU types and subtypes, and
+// the alignment of slices in universal files, as a power of two.
+var machoCPUs = map[string]struct{ cpu, subtype, align uint32 }{
+	"arm64":  {0x0100000c, 0, 14},
+	"x86_64": {0x01000007, 3, 12},
+}
+
+// xcframework assembles an XCFramework from static libraries built with
+// -buildmode=c-archive, so Xcode projects and Apple build rules can link a
+// Go library for devices and simulators as a single dependency.
+func xcframework(args []string) error {
+	args, err := buildenv.ReadParamsFiles(args)
+	if err != nil {
+		return err
+	}
+	fs := flag.NewFlagSet("GoXCFramework", flag.ExitOnError)
+	var libs xcLibraryFlag
+	fs.Var(&libs, "library", "A static library, as platform:arch=path")
+	module := fs.String("module", "", "The name of the Clang module")
+	header := fs.String("header", "", "The header declaring the library's exported functions")
+	out := fs.String("o", "", "The XCFramework directory to write")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *module == "" || *header == "" || *out == "" {
+		return errors.New("-module, -header, and -o must be set")
+	}
+	if len(libs) == 0 {
+		return errors.New("no libraries given")
+	}
+
+	headerData, err := ioutil.ReadFile(*header)
+	if err != nil {
+		return err
+	}
+	slices, err := groupXCSlices(libs)
+	if err != nil {
+		return err
+	}
+	libName := "lib" + *module + ".a"
+	for _, s := range slices {
+		dir := filepath.Join(*out, s.identifier())
+		if err := os.MkdirAll(filepath.Join(dir, "Headers"), 0777); err != nil {
+			return err
+		}
+		if err := writeUniversalArchive(filepath.Join(dir, libName), s.libs); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "Headers", *module+".h"), headerData, 0666); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "Headers", "module.modulemap"), []byte(moduleMap(*module)), 0666); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(filepath.Join(*out, "Info.plist"), []byte(xcframeworkInfoPlist(slices, libName)), 0666)
+}
+
+// groupXCSlices groups libraries by platform and variant. Slices and their
+// architectures are sorted, so the output doesn't depend on flag order.
+func groupXCSlices(libs []xcLibrary) ([]*xcSlice, error) {
+	byKey := make(map[string]*xcSlice)
+	var slices []*xcSlice
+	for _, lib := range libs {
+		key := lib.platform + "-" + lib.variant
+		s, ok := byKey[key]
+		if !ok {
+			s = &xcSlice{platform: lib.platform, variant: lib.variant}
+			byKey[key] = s
+			slices = append(slices, s)
+		}
+		for _, other := range s.libs {
+			if other.arch == lib.arch {
+				return nil, fmt.Errorf("more than one library for %s %s", s.identifier(), lib.arch)
+			}
+		}
+		s.libs = append(s.libs, lib)
+	}
+	for _, s := range slices {
+		sort.Slice(s.libs, func(i, j int) bool { return s.libs[i].arch < s.libs[j].arch })
+	}
+	sort.Slice(slices, func(i, j int) bool { return slices[i].identifier() < slices[j].identifier() })
+	return slices, nil
+}
+
+// writeUniversalArchive writes a universal ("fat") file containing each of
+// libs, like lipo -create. A single library is copied as is.
+func writeUniversalArchive(path string, libs []xcLibrary) error {
+	if len(libs) == 1 {
+		return copyFile(libs[0].path, path)
+	}
+	datas := make([][]byte, len(libs))
+	for i, lib := range libs {
+		data, err := ioutil.ReadFile(lib.path)
+		if err != nil {
+			return err
+		}
+		datas[i] = data
+	}
+
+	var hdr, body bytes.Buffer
+	const fatMagic = 0xcafebabe
+	binary.Write(&hdr, binary.BigEndian, []uint32{fatMagic, uint32(len(libs))})
+	offset := uint32(8 + 20*len(libs))
+	for i, lib := range libs {
+		cpu := machoCPUs[lib.arch]
+		aligned := (offset + 1<<cpu.align - 1) &^ (1<<cpu.align - 1)
+		body.Write(make([]byte, aligned-offset))
+		offset = aligned
+		binary.Write(&hdr, binary.BigEndian, []uint32{cpu.cpu, cpu.subtype, offset, uint32(len(datas[i])), cpu.align})
+		body.Write(datas[i])
+		offset += uint32(len(datas[i]))
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, io.MultiReader(&hdr, &body)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// moduleMap returns a Clang module map for the library's header, so Swift
+// code can import the module.
+func moduleMap(module string) string {
+	return fmt.Sprintf("module %s {\n    header %q\n    export *\n}\n", module, module+".h")
+}
+
+func xcframeworkInfoPlist(slices []*xcSlice, libName string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>AvailableLibraries</key>
+	<array>
+`)
+	for _, s := range slices {
+		b.WriteString("\t\t<dict>\n")
+		writePlistString(&b, "HeadersPath", "Headers")
+		writePlistString(&b, "LibraryIdentifier", s.identifier())
+		writePlistString(&b, "LibraryPath", libName)
+		b.WriteString("\t\t\t<key>SupportedArchitectures</key>\n\t\t\t<array>\n")
+		for _, arch := range s.archs() {
+			b.WriteString("\t\t\t\t<string>" + xmlEscape(arch) + "</string>\n")
+		}
+		b.WriteString("\t\t\t</array>\n")
+		writePlistString(&b, "SupportedPlatform", s.platform)
+		if s.variant != "" {
+			writePlistString(&b, "SupportedPlatformVariant", s.variant)
+		}
+		b.WriteString("\t\t</dict>\n")
+	}
+	b.WriteString(`	</array>
+	<key>CFBundlePackageType</key>
+	<string>XFWK</string>
+	<key>XCFrameworkFormatVersion</key>
+	<string>1.0</string>
+</dict>
+</plist>
+`)
+	return b.String()
+}
+
+func writePlistString(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, "\t\t\t<key>%s</key>\n\t\t\t<string>%s</string>\n", xmlEscape(key), xmlEscape(value))
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
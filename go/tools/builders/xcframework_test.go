@@ -0,0 +1,150 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestXCFramework(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestXCFramework")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"device_arm64.a": "!<arch>\ndevice arm64",
+		"sim_arm64.a":    "!<arch>\nsimulator arm64",
+		"sim_x86_64.a":   "!<arch>\nsimulator x86_64",
+		"hello.h":        "extern void Hello(void);\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := filepath.Join(dir, "Hello.xcframework")
+	if err := xcframework([]string{
+		"-module", "Hello",
+		"-header", filepath.Join(dir, "hello.h"),
+		"-library", "ios-simulator:x86_64=" + filepath.Join(dir, "sim_x86_64.a"),
+		"-library", "ios:arm64=" + filepath.Join(dir, "device_arm64.a"),
+		"-library", "ios-simulator:arm64=" + filepath.Join(dir, "sim_arm64.a"),
+		"-o", out,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	device, err := ioutil.ReadFile(filepath.Join(out, "ios-arm64", "libHello.a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(device) != files["device_arm64.a"] {
+		t.Errorf("device library: got %q; want %q", device, files["device_arm64.a"])
+	}
+
+	fat, err := ioutil.ReadFile(filepath.Join(out, "ios-arm64_x86_64-simulator", "libHello.a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hdr struct{ Magic, N uint32 }
+	r := bytes.NewReader(fat)
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Magic != 0xcafebabe || hdr.N != 2 {
+		t.Fatalf("simulator library: got magic %#x with %d architectures; want 0xcafebabe with 2", hdr.Magic, hdr.N)
+	}
+	for _, want := range []struct {
+		cpu  uint32
+		file string
+	}{
+		{0x0100000c, "sim_arm64.a"},
+		{0x01000007, "sim_x86_64.a"},
+	} {
+		var arch struct{ CPU, Subtype, Offset, Size, Align uint32 }
+		if err := binary.Read(r, binary.BigEndian, &arch); err != nil {
+			t.Fatal(err)
+		}
+		if arch.CPU != want.cpu {
+			t.Errorf("simulator library: got cpu %#x; want %#x", arch.CPU, want.cpu)
+			continue
+		}
+		if arch.Offset%(1<<arch.Align) != 0 {
+			t.Errorf("simulator library: offset %d of cpu %#x is not aligned to 2^%d", arch.Offset, arch.CPU, arch.Align)
+		}
+		if got := string(fat[arch.Offset : arch.Offset+arch.Size]); got != files[want.file] {
+			t.Errorf("simulator library: cpu %#x contains %q; want %q", arch.CPU, got, files[want.file])
+		}
+	}
+
+	for _, slice := range []string{"ios-arm64", "ios-arm64_x86_64-simulator"} {
+		h, err := ioutil.ReadFile(filepath.Join(out, slice, "Headers", "Hello.h"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(h) != files["hello.h"] {
+			t.Errorf("%s header: got %q; want %q", slice, h, files["hello.h"])
+		}
+		m, err := ioutil.ReadFile(filepath.Join(out, slice, "Headers", "module.modulemap"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "module Hello {\n    header \"Hello.h\"\n    export *\n}\n"; string(m) != want {
+			t.Errorf("%s module map: got %q; want %q", slice, m, want)
+		}
+	}
+
+	plist, err := ioutil.ReadFile(filepath.Join(out, "Info.plist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<string>ios-arm64</string>",
+		"<string>ios-arm64_x86_64-simulator</string>",
+		"<key>SupportedPlatformVariant</key>\n\t\t\t<string>simulator</string>",
+		"<string>libHello.a</string>",
+		"<string>XFWK</string>",
+	} {
+		if !strings.Contains(string(plist), want) {
+			t.Errorf("Info.plist does not contain %q:\n%s", want, plist)
+		}
+	}
+	if strings.Count(string(plist), "SupportedPlatformVariant") != 1 {
+		t.Errorf("Info.plist should only have a platform variant for the simulator:\n%s", plist)
+	}
+}
+
+func TestXCFrameworkDuplicateArch(t *testing.T) {
+	var libs xcLibraryFlag
+	for _, v := range []string{"ios:arm64=a.a", "ios:arm64=b.a"} {
+		if err := libs.Set(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := groupXCSlices(libs); err == nil || !strings.Contains(err.Error(), "more than one library") {
+		t.Errorf("got error %v; want error about more than one library", err)
+	}
+	if err := libs.Set("ios:armv7=c.a"); err == nil {
+		t.Error("unsupported architecture was accepted")
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package buildinfo reports how a binary was built with Bazel: its label,
+// values from Bazel's stable workspace status, and the digest of its build
+// configuration. These are set when a binary that imports this package is
+// linked; nothing needs to be added to x_defs.
+//
+// In binaries built without Bazel, the functions in this package report that
+// the information is missing.
+package buildinfo
+
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel"
+)
+
+// These variables are set by the linker. They're unexported, so the values
+// can only be read through the functions below.
+var (
+	// label is the label of the binary or test.
+	label string
+
+	// stableStatus has the contents of Bazel's stable workspace status
+	// file, one key and value per line, separated by a space. It's empty
+	// when the binary isn't stamped.
+	stableStatus string
+
+	// configDigest is the build configuration digest, also recorded in the
+	// binary's build information. It's empty unless the binary was built
+	// with --@io_bazel_rules_go//go/config:build_config_digest.
+	configDigest string
+)
+
+// Label returns the label of the binary or test that was linked, for
+// example, "//cmd/server:server". It returns "" if the binary wasn't built
+// with Bazel.
+func Label() string {
+	return label
+}
+
+// ConfigDigest returns the digest of the configuration the binary was built
+// with. See "Build configuration digest" in go/core.rst for what it covers.
+// It returns "" unless the binary was built with
+// --@io_bazel_rules_go//go/config:build_config_digest.
+func ConfigDigest() string {
+	return configDigest
+}
+
+// Stamped reports whether the binary was built with --stamp.
+func Stamped() bool {
+	return stableStatus != ""
+}
+
+// Status returns the value of a key in Bazel's stable workspace status, such
+// as BUILD_EMBED_LABEL or a STABLE_ key printed by the workspace status
+// command. Volatile keys, like BUILD_TIMESTAMP, aren't recorded, since they
+// would make the binary change with every build; stamp them with x_defs
+// instead. Status returns false if the key is missing or the binary isn't
+// stamped.
+func Status(key string) (string, bool) {
+	for _, line := range strings.Split(stableStatus, "\n") {
+		k, v := line, ""
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			k, v = line[:i], line[i+1:]
+		}
+		if k == key && k != "" {
+			return v, true
+		}
+	}
+	return "", false
+}
+
+// StatusKeys returns the sorted keys of the stable workspace status values
+// recorded in the binary.
+func StatusKeys() []string {
+	var keys []string
+	for _, line := range strings.Split(stableStatus, "\n") {
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			line = line[:i]
+		}
+		if line != "" {
+			keys = append(keys, line)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Runfile returns the absolute path of a file in the binary's runfiles,
+// named relative to the binary's package, for example, a file listed in its
+// data attribute. See bazel.Runfile for where it looks.
+func Runfile(name string) (string, error) {
+	if label == "" {
+		return "", errors.New("buildinfo: binary was not built with Bazel")
+	}
+	l := label
+	repo := ""
+	if strings.HasPrefix(l, "@") {
+		i := strings.Index(l, "//")
+		if i < 0 {
+			return "", errors.New("buildinfo: malformed label " + label)
+		}
+		repo, l = l[1:i], l[i:]
+	}
+	pkg := strings.TrimPrefix(l, "//")
+	if i := strings.IndexByte(pkg, ':'); i >= 0 {
+		pkg = pkg[:i]
+	}
+	if repo != "" {
+		// Files from other repositories are beside the main workspace's
+		// directory in the runfiles tree.
+		pkg = path.Join("..", repo, pkg)
+	}
+	return bazel.Runfile(path.Join(pkg, name))
+}
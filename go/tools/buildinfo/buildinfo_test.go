@@ -0,0 +1,131 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buildinfo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The tests below read the values the linker set in this test binary. They
+// pass with or without --stamp and
+// --@io_bazel_rules_go//go/config:build_config_digest.
+
+func TestLabel(t *testing.T) {
+	const want = "//go/tools/buildinfo:go_default_test"
+	if got := Label(); !strings.HasSuffix(got, want) {
+		t.Errorf("got label %q; want %q", got, want)
+	}
+}
+
+func TestStamps(t *testing.T) {
+	if !Stamped() {
+		if keys := StatusKeys(); len(keys) != 0 {
+			t.Errorf("not stamped, but got status keys %q", keys)
+		}
+		if _, ok := Status("BUILD_USER"); ok {
+			t.Error("not stamped, but BUILD_USER is set")
+		}
+		return
+	}
+	// Bazel always writes these to the stable status file.
+	for _, key := range []string{"BUILD_EMBED_LABEL", "BUILD_HOST", "BUILD_USER"} {
+		if _, ok := Status(key); !ok {
+			t.Errorf("stamped, but %s is missing", key)
+		}
+	}
+	if v, ok := Status("BUILD_TIMESTAMP"); ok {
+		t.Errorf("got volatile key BUILD_TIMESTAMP = %q; want it left out", v)
+	}
+}
+
+func TestConfigDigest(t *testing.T) {
+	digest := ConfigDigest()
+	if digest == "" {
+		return
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{12}$`).MatchString(digest) {
+		t.Fatalf("got digest %q; want 12 hex digits", digest)
+	}
+	// The same digest is in the build information, as "go version -m"
+	// shows it.
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("bazel.config="+digest)) {
+		t.Errorf("digest %s not found in the build information of %s", digest, exe)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	defer func(s string) { stableStatus = s }(stableStatus)
+	stableStatus = "BUILD_USER alice\nSTABLE_COMMIT abc 123\nSTABLE_EMPTY"
+
+	if !Stamped() {
+		t.Error("got Stamped() = false; want true")
+	}
+	for _, tc := range []struct {
+		key, want string
+		ok        bool
+	}{
+		{key: "BUILD_USER", want: "alice", ok: true},
+		{key: "STABLE_COMMIT", want: "abc 123", ok: true},
+		{key: "STABLE_EMPTY", want: "", ok: true},
+		{key: "STABLE_MISSING"},
+		{key: ""},
+	} {
+		if got, ok := Status(tc.key); got != tc.want || ok != tc.ok {
+			t.Errorf("Status(%q) = %q, %v; want %q, %v", tc.key, got, ok, tc.want, tc.ok)
+		}
+	}
+	want := []string{"BUILD_USER", "STABLE_COMMIT", "STABLE_EMPTY"}
+	if got := StatusKeys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got keys %q; want %q", got, want)
+	}
+}
+
+func TestRunfile(t *testing.T) {
+	path, err := Runfile("BUILD.bazel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("go_default_test")) {
+		t.Errorf("%s is not this package's build file", path)
+	}
+
+	defer func(l string) { label = l }(label)
+	label = ""
+	if _, err := Runfile("BUILD.bazel"); err == nil {
+		t.Error("got no error without a label")
+	}
+	label = "@repo"
+	if _, err := Runfile("BUILD.bazel"); err == nil {
+		t.Error("got no error for a malformed label")
+	}
+}
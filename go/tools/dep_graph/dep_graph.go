@@ -0,0 +1,276 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// dep_graph renders a Go package dependency graph written by the go_dep_graph
+// rule in DOT or JSON format.
+//
+// The graph file has one entry per line, with tab-separated fields:
+//
+//	R <importmap>                        the root package
+//	N <importmap> <importpath> <label>   a package
+//	E <from importmap> <to importmap>    an import
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("dep_graph: ")
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("dep_graph", flag.ExitOnError)
+	graphPath := fs.String("graph", "", "The graph file written by go_dep_graph")
+	format := fs.String("format", "dot", "The output format: dot or json")
+	depth := fs.Int("depth", 0, "If positive, only packages at most this many imports away from the root are shown")
+	include := fs.String("include", "", "If set, only packages with import paths matching this regular expression are shown. The root is always shown.")
+	exclude := fs.String("exclude", "", "If set, packages with import paths matching this regular expression are hidden")
+	outPath := fs.String("o", "", "The file to write. If unset, the graph is written to stdout.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *graphPath == "" {
+		return errors.New("-graph must be set")
+	}
+	if *format != "dot" && *format != "json" {
+		return fmt.Errorf("-format must be dot or json; got %q", *format)
+	}
+
+	f, err := os.Open(*graphPath)
+	if err != nil {
+		return err
+	}
+	g, err := readGraph(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", *graphPath, err)
+	}
+
+	var includeRe, excludeRe *regexp.Regexp
+	if *include != "" {
+		if includeRe, err = regexp.Compile(*include); err != nil {
+			return fmt.Errorf("-include: %v", err)
+		}
+	}
+	if *exclude != "" {
+		if excludeRe, err = regexp.Compile(*exclude); err != nil {
+			return fmt.Errorf("-exclude: %v", err)
+		}
+	}
+	g = g.filter(*depth, func(n *node) bool {
+		if n.importMap == g.root {
+			return true
+		}
+		if includeRe != nil && !includeRe.MatchString(n.importPath) {
+			return false
+		}
+		return excludeRe == nil || !excludeRe.MatchString(n.importPath)
+	})
+
+	w := stdout
+	if *outPath != "" {
+		out, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		w = out
+	}
+	if *format == "json" {
+		return g.writeJSON(w)
+	}
+	return g.writeDOT(w)
+}
+
+type node struct {
+	importMap  string
+	importPath string
+	label      string
+}
+
+// graph is a package dependency graph. Nodes and edges are keyed by
+// importmap, which is unique among packages linked into a binary.
+type graph struct {
+	root  string
+	nodes map[string]*node
+	edges map[string][]string
+}
+
+func readGraph(r io.Reader) (*graph, error) {
+	g := &graph{nodes: make(map[string]*node), edges: make(map[string][]string)}
+	seenEdges := make(map[[2]string]bool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		switch {
+		case fields[0] == "R" && len(fields) == 2:
+			g.root = fields[1]
+		case fields[0] == "N" && len(fields) == 4:
+			g.nodes[fields[1]] = &node{importMap: fields[1], importPath: fields[2], label: fields[3]}
+		case fields[0] == "E" && len(fields) == 3:
+			key := [2]string{fields[1], fields[2]}
+			if !seenEdges[key] {
+				seenEdges[key] = true
+				g.edges[fields[1]] = append(g.edges[fields[1]], fields[2])
+			}
+		default:
+			return nil, fmt.Errorf("line %d: malformed entry", lineNum)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if g.root == "" || g.nodes[g.root] == nil {
+		return nil, errors.New("graph has no root package")
+	}
+	return g, nil
+}
+
+// filter returns the subgraph of packages reachable from the root within
+// maxDepth imports (or any number if maxDepth is not positive) for which keep
+// returns true. When a package is hidden, its importers are connected to
+// the visible packages it imports, directly or through other hidden
+// packages, so the graph still shows what depends on what.
+func (g *graph) filter(maxDepth int, keep func(*node) bool) *graph {
+	depth := map[string]int{g.root: 0}
+	queue := []string{g.root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		if maxDepth > 0 && depth[n] >= maxDepth {
+			continue
+		}
+		for _, m := range g.edges[n] {
+			if _, ok := depth[m]; !ok {
+				depth[m] = depth[n] + 1
+				queue = append(queue, m)
+			}
+		}
+	}
+
+	visible := func(n string) bool {
+		_, reachable := depth[n]
+		return reachable && g.nodes[n] != nil && keep(g.nodes[n])
+	}
+	out := &graph{root: g.root, nodes: make(map[string]*node), edges: make(map[string][]string)}
+	for n := range depth {
+		if !visible(n) {
+			continue
+		}
+		out.nodes[n] = g.nodes[n]
+		seen := map[string]bool{n: true}
+		stack := append([]string(nil), g.edges[n]...)
+		for len(stack) > 0 {
+			m := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if seen[m] {
+				continue
+			}
+			seen[m] = true
+			if _, reachable := depth[m]; !reachable {
+				continue
+			}
+			if visible(m) {
+				out.edges[n] = append(out.edges[n], m)
+			} else {
+				stack = append(stack, g.edges[m]...)
+			}
+		}
+		sort.Strings(out.edges[n])
+	}
+	return out
+}
+
+func (g *graph) sortedNodes() []*node {
+	nodes := make([]*node, 0, len(g.nodes))
+	for _, n := range g.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].importMap < nodes[j].importMap })
+	return nodes
+}
+
+func (g *graph) writeDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph deps {")
+	fmt.Fprintln(bw, "  node [shape=box];")
+	for _, n := range g.sortedNodes() {
+		attrs := fmt.Sprintf("label=%s, tooltip=%s", strconv.Quote(n.importPath), strconv.Quote(n.label))
+		if n.importMap == g.root {
+			attrs += ", style=bold"
+		}
+		fmt.Fprintf(bw, "  %s [%s];\n", strconv.Quote(n.importMap), attrs)
+	}
+	for _, n := range g.sortedNodes() {
+		for _, m := range g.edges[n.importMap] {
+			fmt.Fprintf(bw, "  %s -> %s;\n", strconv.Quote(n.importMap), strconv.Quote(m))
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+type jsonPackage struct {
+	ImportPath string   `json:"importpath"`
+	ImportMap  string   `json:"importmap"`
+	Label      string   `json:"label"`
+	Imports    []string `json:"imports"`
+}
+
+type jsonGraph struct {
+	Root     string        `json:"root"`
+	Packages []jsonPackage `json:"packages"`
+}
+
+func (g *graph) writeJSON(w io.Writer) error {
+	out := jsonGraph{Root: g.root}
+	for _, n := range g.sortedNodes() {
+		imports := g.edges[n.importMap]
+		if imports == nil {
+			imports = []string{}
+		}
+		out.Packages = append(out.Packages, jsonPackage{
+			ImportPath: n.importPath,
+			ImportMap:  n.importMap,
+			Label:      n.label,
+			Imports:    imports,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
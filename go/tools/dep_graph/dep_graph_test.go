@@ -0,0 +1,162 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testGraph is main -> {a, b}, a -> c, b -> c, c -> d. e is unreachable.
+const testGraph = `R	main
+N	main	example.com/cmd	//cmd:cmd
+N	example.com/a	example.com/a	//a:a
+N	example.com/b	example.com/b	//b:b
+N	example.com/internal/c	example.com/internal/c	//internal/c:c
+N	example.com/d	example.com/d	//d:d
+N	example.com/e	example.com/e	//e:e
+E	main	example.com/a
+E	main	example.com/b
+E	example.com/a	example.com/internal/c
+E	example.com/b	example.com/internal/c
+E	example.com/internal/c	example.com/d
+E	example.com/e	example.com/d
+`
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dep_graph_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	graphPath := filepath.Join(dir, "test.graph")
+	if err := ioutil.WriteFile(graphPath, []byte(testGraph), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		desc string
+		args []string
+		want string
+	}{
+		{
+			desc: "dot",
+			args: []string{"-format", "dot"},
+			want: `digraph deps {
+  node [shape=box];
+  "example.com/a" [label="example.com/a", tooltip="//a:a"];
+  "example.com/b" [label="example.com/b", tooltip="//b:b"];
+  "example.com/d" [label="example.com/d", tooltip="//d:d"];
+  "example.com/internal/c" [label="example.com/internal/c", tooltip="//internal/c:c"];
+  "main" [label="example.com/cmd", tooltip="//cmd:cmd", style=bold];
+  "example.com/a" -> "example.com/internal/c";
+  "example.com/b" -> "example.com/internal/c";
+  "example.com/internal/c" -> "example.com/d";
+  "main" -> "example.com/a";
+  "main" -> "example.com/b";
+}
+`,
+		}, {
+			desc: "depth",
+			args: []string{"-format", "dot", "-depth", "1"},
+			want: `digraph deps {
+  node [shape=box];
+  "example.com/a" [label="example.com/a", tooltip="//a:a"];
+  "example.com/b" [label="example.com/b", tooltip="//b:b"];
+  "main" [label="example.com/cmd", tooltip="//cmd:cmd", style=bold];
+  "main" -> "example.com/a";
+  "main" -> "example.com/b";
+}
+`,
+		}, {
+			desc: "exclude",
+			args: []string{"-format", "json", "-exclude", "/internal/"},
+			want: `{
+  "root": "main",
+  "packages": [
+    {
+      "importpath": "example.com/a",
+      "importmap": "example.com/a",
+      "label": "//a:a",
+      "imports": [
+        "example.com/d"
+      ]
+    },
+    {
+      "importpath": "example.com/b",
+      "importmap": "example.com/b",
+      "label": "//b:b",
+      "imports": [
+        "example.com/d"
+      ]
+    },
+    {
+      "importpath": "example.com/d",
+      "importmap": "example.com/d",
+      "label": "//d:d",
+      "imports": []
+    },
+    {
+      "importpath": "example.com/cmd",
+      "importmap": "main",
+      "label": "//cmd:cmd",
+      "imports": [
+        "example.com/a",
+        "example.com/b"
+      ]
+    }
+  ]
+}
+`,
+		}, {
+			desc: "include",
+			args: []string{"-format", "dot", "-include", "example.com/d"},
+			want: `digraph deps {
+  node [shape=box];
+  "example.com/d" [label="example.com/d", tooltip="//d:d"];
+  "main" [label="example.com/cmd", tooltip="//cmd:cmd", style=bold];
+  "main" -> "example.com/d";
+}
+`,
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			args := append([]string{"-graph", graphPath}, test.args...)
+			if err := run(args, out); err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReadGraphErrors(t *testing.T) {
+	for _, content := range []string{
+		"",
+		"N\tmain\tmain\t//:main\n",
+		"R\tmain\nX\tbad\n",
+	} {
+		if _, err := readGraph(strings.NewReader(content)); err == nil {
+			t.Errorf("readGraph(%q): got success; want error", content)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// baseline writes a nogo baseline file listing the findings in SARIF reports
+// written by nogo. nogo doesn't report findings listed in its baseline.
+//
+// Build with --@io_bazel_rules_go//go/config:nogo_sarif and
+// --output_groups=nogo_sarif to produce a .nogo.sarif report for each
+// package, then run:
+//
+//	bazel run @io_bazel_rules_go//go/tools/nogo/baseline -- -o nogo_baseline.txt
+//
+// By default, baseline reads reports in bazel-bin. Report files or
+// directories containing them may be listed on the command line instead.
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("baseline: ")
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("baseline", flag.ExitOnError)
+	outPath := fs.String("o", "", "The baseline file to write, relative to the workspace root. If unset, the baseline is written to stdout.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: bazel run @io_bazel_rules_go//go/tools/nogo/baseline -- [-o file] [report files or directories...]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	workspaceDir := os.Getenv("BUILD_WORKSPACE_DIRECTORY")
+	if workspaceDir == "" {
+		var err error
+		if workspaceDir, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+	roots := fs.Args()
+	if len(roots) == 0 {
+		roots = []string{"bazel-bin"}
+	}
+	for i, root := range roots {
+		if !filepath.IsAbs(root) {
+			roots[i] = filepath.Join(workspaceDir, root)
+		}
+	}
+
+	reports, err := findReports(roots)
+	if err != nil {
+		return err
+	}
+	if len(reports) == 0 {
+		return errors.New("no .nogo.sarif files found. Build with --@io_bazel_rules_go//go/config:nogo_sarif --output_groups=nogo_sarif first.")
+	}
+	seen := make(map[string]bool)
+	var entries []string
+	for _, path := range reports {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		reportEntries, err := readReport(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		for _, e := range reportEntries {
+			if !seen[e] {
+				seen[e] = true
+				entries = append(entries, e)
+			}
+		}
+	}
+	sort.Strings(entries)
+
+	w := stdout
+	if *outPath != "" {
+		path := *outPath
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(workspaceDir, path)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# Known nogo findings. Each line lists a file, an analyzer, and a hash of")
+	fmt.Fprintln(bw, "# the finding's message. Generated by @io_bazel_rules_go//go/tools/nogo/baseline.")
+	for _, e := range entries {
+		fmt.Fprintln(bw, e)
+	}
+	return bw.Flush()
+}
+
+// findReports returns the .nogo.sarif files in roots. Each root may be a
+// file or a directory, which is searched recursively.
+func findReports(roots []string) ([]string, error) {
+	var files []string
+	for _, root := range roots {
+		// bazel-bin is usually a symbolic link, which filepath.Walk won't
+		// descend into.
+		root, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == root && !info.IsDir() {
+				files = append(files, path)
+			} else if info.Mode().IsRegular() && strings.HasSuffix(path, ".nogo.sarif") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// sarifLog is the subset of a SARIF log written by nogo that's needed to
+// identify findings.
+type sarifLog struct {
+	Runs []struct {
+		Results []struct {
+			RuleID  string `json:"ruleId"`
+			Message struct {
+				Text string `json:"text"`
+			} `json:"message"`
+			Locations []struct {
+				PhysicalLocation struct {
+					ArtifactLocation struct {
+						URI string `json:"uri"`
+					} `json:"artifactLocation"`
+				} `json:"physicalLocation"`
+			} `json:"locations"`
+		} `json:"results"`
+	} `json:"runs"`
+}
+
+// readReport returns baseline entries for the findings in a SARIF report.
+func readReport(data []byte) ([]string, error) {
+	var report sarifLog
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	var entries []string
+	for _, run := range report.Runs {
+		for _, r := range run.Results {
+			// Rule IDs are the analyzer name, optionally followed by a slash
+			// and the diagnostic's category.
+			analyzer := r.RuleID
+			if i := strings.IndexByte(analyzer, '/'); i >= 0 {
+				analyzer = analyzer[:i]
+			}
+			file := "-"
+			if len(r.Locations) > 0 && r.Locations[0].PhysicalLocation.ArtifactLocation.URI != "" {
+				file = r.Locations[0].PhysicalLocation.ArtifactLocation.URI
+			}
+			entries = append(entries, strings.Join([]string{file, analyzer, messageHash(r.Message.Text)}, "\t"))
+		}
+	}
+	return entries, nil
+}
+
+// messageHash returns a short, stable hash of a diagnostic message. It must
+// match baselineHash in go/tools/builders/nogo_baseline.go.
+func messageHash(message string) string {
+	sum := sha256.Sum256([]byte(message))
+	return hex.EncodeToString(sum[:8])
+}
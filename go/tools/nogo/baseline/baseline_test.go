@@ -0,0 +1,95 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testReport = `{
+  "version": "2.1.0",
+  "runs": [{
+    "tool": {"driver": {"name": "nogo", "rules": []}},
+    "results": [
+      {
+        "ruleId": "unreachable",
+        "message": {"text": "unreachable code"},
+        "locations": [{"physicalLocation": {"artifactLocation": {"uri": "pkg/a.go", "uriBaseId": "%SRCROOT%"}}}]
+      },
+      {
+        "ruleId": "custom/style",
+        "message": {"text": "bad name"},
+        "locations": [{"physicalLocation": {"artifactLocation": {"uri": "pkg/b.go", "uriBaseId": "%SRCROOT%"}}}]
+      },
+      {
+        "ruleId": "nilness",
+        "message": {"text": "nil dereference"}
+      }
+    ]
+  }]
+}`
+
+func TestMessageHash(t *testing.T) {
+	// Keep in sync with TestBaselineHash in go/tools/builders.
+	if got, want := messageHash("unreachable code"), "5c09c9ac800bba52"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "baseline_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The same findings may be reported for a library and its test.
+	for _, name := range []string{"bazel-bin/pkg/a.nogo.sarif", "bazel-bin/pkg/a_test.internal.nogo.sarif"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(testReport), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Setenv("BUILD_WORKSPACE_DIRECTORY", dir)
+	defer os.Unsetenv("BUILD_WORKSPACE_DIRECTORY")
+
+	var out bytes.Buffer
+	if err := run(nil, &out); err != nil {
+		t.Fatal(err)
+	}
+	want := "# Known nogo findings. Each line lists a file, an analyzer, and a hash of\n" +
+		"# the finding's message. Generated by @io_bazel_rules_go//go/tools/nogo/baseline.\n" +
+		"-\tnilness\t" + messageHash("nil dereference") + "\n" +
+		"pkg/a.go\tunreachable\t5c09c9ac800bba52\n" +
+		"pkg/b.go\tcustom\t" + messageHash("bad name") + "\n"
+	if got := out.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := run([]string{"-o", "nogo_baseline.txt"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(dir, "nogo_baseline.txt")); err != nil {
+		t.Fatal(err)
+	} else if string(got) != want {
+		t.Errorf("got file:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,356 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// fix applies suggested fixes written by nogo to files in the workspace.
+//
+// Build with --@io_bazel_rules_go//go/config:nogo_fix and
+// --output_groups=nogo_fix to produce a .nogo.patch file for each package,
+// then run:
+//
+//	bazel run @io_bazel_rules_go//go/tools/nogo:fix
+//
+// By default, fix looks for patches in bazel-bin. Patch files or directories
+// containing them may be listed on the command line instead.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("fix: ")
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("fix", flag.ExitOnError)
+	dryRun := fs.Bool("n", false, "Print the names of files that would be changed without changing them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: bazel run @io_bazel_rules_go//go/tools/nogo:fix -- [-n] [patch files or directories...]\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	workspaceDir := os.Getenv("BUILD_WORKSPACE_DIRECTORY")
+	if workspaceDir == "" {
+		var err error
+		if workspaceDir, err = os.Getwd(); err != nil {
+			return err
+		}
+	}
+	roots := fs.Args()
+	if len(roots) == 0 {
+		roots = []string{"bazel-bin"}
+	}
+	for i, root := range roots {
+		if !filepath.IsAbs(root) {
+			roots[i] = filepath.Join(workspaceDir, root)
+		}
+	}
+
+	patchFiles, err := findPatchFiles(roots)
+	if err != nil {
+		return err
+	}
+	if len(patchFiles) == 0 {
+		return errors.New("no .nogo.patch files found. Build with --@io_bazel_rules_go//go/config:nogo_fix --output_groups=nogo_fix first.")
+	}
+
+	// The same file may be fixed by more than one patch, for example, when
+	// it's compiled into both a library and its test. Collect the hunks for
+	// each file and drop duplicates.
+	hunksByFile := make(map[string][]hunk)
+	seen := make(map[string]bool)
+	for _, patchFile := range patchFiles {
+		data, err := ioutil.ReadFile(patchFile)
+		if err != nil {
+			return err
+		}
+		patches, err := parsePatch(data)
+		if err != nil {
+			return fmt.Errorf("%s: %v", patchFile, err)
+		}
+		for _, p := range patches {
+			for _, h := range p.hunks {
+				key := p.name + "\x00" + h.String()
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				hunksByFile[p.name] = append(hunksByFile[p.name], h)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(hunksByFile))
+	for name := range hunksByFile {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs []string
+	for _, name := range names {
+		path := filepath.Join(workspaceDir, filepath.FromSlash(name))
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		fixed, err := applyHunks(content, hunksByFile[name])
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		if bytes.Equal(content, fixed) {
+			continue
+		}
+		fmt.Println(name)
+		if *dryRun {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, fixed, info.Mode()); err != nil {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+// findPatchFiles returns the .nogo.patch files in roots. Each root may be a
+// file or a directory, which is searched recursively.
+func findPatchFiles(roots []string) ([]string, error) {
+	var files []string
+	for _, root := range roots {
+		// bazel-bin is usually a symbolic link, which filepath.Walk won't
+		// descend into.
+		root, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			return nil, err
+		}
+		err = filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if path == root && !info.IsDir() {
+				files = append(files, path)
+			} else if info.Mode().IsRegular() && strings.HasSuffix(path, ".nogo.patch") {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// filePatch is the part of a unified diff that applies to one file.
+type filePatch struct {
+	name  string
+	hunks []hunk
+}
+
+// hunk replaces old with new. oldStart is the one-based line number where
+// old starts, or the line before it if old is empty. Each line includes its
+// trailing newline, except the last line of a file without one.
+type hunk struct {
+	oldStart int
+	old, new []string
+}
+
+func (h hunk) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "@@ -%d @@\n", h.oldStart)
+	for _, l := range h.old {
+		fmt.Fprintf(&buf, "-%q\n", l)
+	}
+	for _, l := range h.new {
+		fmt.Fprintf(&buf, "+%q\n", l)
+	}
+	return buf.String()
+}
+
+// parsePatch parses a unified diff, like the ones written by nogo. File names
+// have their "a/" and "b/" prefixes removed.
+func parsePatch(data []byte) ([]filePatch, error) {
+	var patches []filePatch
+	var h *hunk
+	oldLeft, newLeft := 0, 0
+	lastOld, lastNew := false, false
+	for lineNum, line := range strings.SplitAfter(string(data), "\n") {
+		lineNum++
+		if line == "" {
+			continue
+		}
+		inHunk := h != nil && (oldLeft > 0 || newLeft > 0)
+		switch {
+		case inHunk && (line[0] == ' ' || line == "\n"):
+			// Some tools write empty context lines without the leading space.
+			ctx := strings.TrimPrefix(line, " ")
+			h.old = append(h.old, ctx)
+			h.new = append(h.new, ctx)
+			oldLeft--
+			newLeft--
+			lastOld, lastNew = true, true
+		case inHunk && line[0] == '-':
+			h.old = append(h.old, line[1:])
+			oldLeft--
+			lastOld, lastNew = true, false
+		case inHunk && line[0] == '+':
+			h.new = append(h.new, line[1:])
+			newLeft--
+			lastOld, lastNew = false, true
+		case h != nil && line[0] == '\\':
+			// "\ No newline at end of file" applies to the previous line.
+			if lastOld {
+				h.old[len(h.old)-1] = strings.TrimSuffix(h.old[len(h.old)-1], "\n")
+			}
+			if lastNew {
+				h.new[len(h.new)-1] = strings.TrimSuffix(h.new[len(h.new)-1], "\n")
+			}
+		case inHunk:
+			return nil, fmt.Errorf("line %d: unexpected line in hunk", lineNum)
+		case strings.HasPrefix(line, "+++ "):
+			name := strings.TrimSpace(line[len("+++ "):])
+			if i := strings.IndexByte(name, '\t'); i >= 0 {
+				name = name[:i]
+			}
+			name = strings.TrimPrefix(name, "b/")
+			patches = append(patches, filePatch{name: name})
+			h = nil
+		case strings.HasPrefix(line, "@@ "):
+			if len(patches) == 0 {
+				return nil, fmt.Errorf("line %d: hunk without file header", lineNum)
+			}
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[3] != "@@" {
+				return nil, fmt.Errorf("line %d: malformed hunk header", lineNum)
+			}
+			oldStart, oldLen, err := parseHunkRange(fields[1], "-")
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			_, newLen, err := parseHunkRange(fields[2], "+")
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNum, err)
+			}
+			cur := &patches[len(patches)-1]
+			cur.hunks = append(cur.hunks, hunk{oldStart: oldStart})
+			h = &cur.hunks[len(cur.hunks)-1]
+			oldLeft, newLeft = oldLen, newLen
+		default:
+			// Ignore anything else outside of hunks, like "---" and "diff"
+			// lines.
+			h = nil
+		}
+	}
+	if oldLeft > 0 || newLeft > 0 {
+		return nil, errors.New("patch ends in the middle of a hunk")
+	}
+	return patches, nil
+}
+
+// parseHunkRange parses a range like "-12,3" from a hunk header. A range
+// without a length has one line.
+func parseHunkRange(s, prefix string) (start, n int, err error) {
+	if !strings.HasPrefix(s, prefix) {
+		return 0, 0, fmt.Errorf("malformed hunk range %q", s)
+	}
+	s = s[len(prefix):]
+	n = 1
+	if i := strings.IndexByte(s, ','); i >= 0 {
+		if n, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, fmt.Errorf("malformed hunk range: %v", err)
+		}
+		s = s[:i]
+	}
+	if start, err = strconv.Atoi(s); err != nil {
+		return 0, 0, fmt.Errorf("malformed hunk range: %v", err)
+	}
+	return start, n, nil
+}
+
+// applyHunks applies hunks to content in order. A hunk is applied where its
+// old lines match, starting at its recorded position. Hunks that have already
+// been applied are skipped.
+func applyHunks(content []byte, hunks []hunk) ([]byte, error) {
+	lines := strings.SplitAfter(string(content), "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	offset := 0
+	for _, h := range hunks {
+		// oldStart refers to the line before an empty range.
+		base := h.oldStart - 1
+		if len(h.old) == 0 {
+			base = h.oldStart
+		}
+		want := base + offset
+		if i := findLines(lines, h.old, want); i >= 0 {
+			replaced := append(append([]string{}, h.new...), lines[i+len(h.old):]...)
+			lines = append(lines[:i], replaced...)
+			offset = i - base + len(h.new) - len(h.old)
+			continue
+		}
+		if findLines(lines, h.new, want) >= 0 {
+			continue
+		}
+		return nil, fmt.Errorf("patch does not apply near line %d; the file may have changed since it was built", h.oldStart)
+	}
+	return []byte(strings.Join(lines, "")), nil
+}
+
+// findLines returns the index where sub appears in lines, searching outward
+// from want. It returns -1 if sub doesn't appear.
+func findLines(lines, sub []string, want int) int {
+	match := func(i int) bool {
+		if i < 0 || i+len(sub) > len(lines) {
+			return false
+		}
+		for j, l := range sub {
+			if lines[i+j] != l {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; d <= len(lines); d++ {
+		if match(want - d) {
+			return want - d
+		}
+		if d > 0 && match(want+d) {
+			return want + d
+		}
+	}
+	return -1
+}
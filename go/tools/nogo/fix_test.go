@@ -0,0 +1,147 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testPatch = `--- a/pkg/a.go
++++ b/pkg/a.go
+@@ -1,5 +1,5 @@
+ package p
+
+-func foo() {}
++func bar() {}
+
+-func g() { foo() }
++func g() { bar() }
+--- a/pkg/b.go
++++ b/pkg/b.go
+@@ -1 +1,2 @@
+-package p
+\ No newline at end of file
++package p
++-- not a header
+`
+
+func TestParsePatch(t *testing.T) {
+	patches, err := parsePatch([]byte(testPatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 2 {
+		t.Fatalf("got %d file patches; want 2", len(patches))
+	}
+	if got, want := patches[0].name, "pkg/a.go"; got != want {
+		t.Errorf("got name %q; want %q", got, want)
+	}
+	b := patches[1]
+	if len(b.hunks) != 1 {
+		t.Fatalf("got %d hunks for %s; want 1", len(b.hunks), b.name)
+	}
+	h := b.hunks[0]
+	if len(h.old) != 1 || h.old[0] != "package p" {
+		t.Errorf("got old lines %q; want [\"package p\"]", h.old)
+	}
+	if len(h.new) != 2 || h.new[1] != "-- not a header\n" {
+		t.Errorf("got new lines %q", h.new)
+	}
+}
+
+func TestApplyHunks(t *testing.T) {
+	patches, err := parsePatch([]byte(testPatch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hunks := patches[0].hunks
+
+	for _, test := range []struct {
+		desc, content, want string
+	}{
+		{
+			desc:    "exact",
+			content: "package p\n\nfunc foo() {}\n\nfunc g() { foo() }\n",
+			want:    "package p\n\nfunc bar() {}\n\nfunc g() { bar() }\n",
+		}, {
+			desc:    "moved",
+			content: "// comment\n\npackage p\n\nfunc foo() {}\n\nfunc g() { foo() }\n",
+			want:    "// comment\n\npackage p\n\nfunc bar() {}\n\nfunc g() { bar() }\n",
+		}, {
+			desc:    "already_applied",
+			content: "package p\n\nfunc bar() {}\n\nfunc g() { bar() }\n",
+			want:    "package p\n\nfunc bar() {}\n\nfunc g() { bar() }\n",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			got, err := applyHunks([]byte(test.content), hunks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, test.want)
+			}
+		})
+	}
+
+	if _, err := applyHunks([]byte("package q\n"), hunks); err == nil {
+		t.Error("applying to a changed file: got success; want error")
+	}
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fix_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"pkg/a.go": "package p\n\nfunc foo() {}\n\nfunc g() { foo() }\n",
+		"pkg/b.go": "package p",
+		// The same patch may be written for a library and its test.
+		"bazel-bin/pkg/a.nogo.patch":               testPatch,
+		"bazel-bin/pkg/a_test.internal.nogo.patch": testPatch,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Setenv("BUILD_WORKSPACE_DIRECTORY", dir)
+	defer os.Unsetenv("BUILD_WORKSPACE_DIRECTORY")
+	if err := run(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"pkg/a.go": "package p\n\nfunc bar() {}\n\nfunc g() { bar() }\n",
+		"pkg/b.go": "package p\n-- not a header\n",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+}
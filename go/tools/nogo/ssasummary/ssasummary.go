@@ -0,0 +1,359 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package ssasummary provides an analyzer that summarizes the behavior of
+// each function in a package, based on its SSA form, and exports the
+// summaries as facts.
+//
+// Analyzers built on buildssa only see SSA for the package being analyzed.
+// nogo analyzes each package separately, so a summary is all an analyzer can
+// learn about functions in other packages. Analyzers that need to follow
+// values across calls, like taint checkers, may require Analyzer and look up
+// summaries of the functions a package calls through its Result.
+//
+// Summaries are approximate. They follow values through SSA registers,
+// including through calls to functions with summaries, but not through memory
+// (pointers, fields, and globals) or dynamic calls.
+package ssasummary
+
+import (
+	"fmt"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/buildssa"
+	"golang.org/x/tools/go/ssa"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name:       "ssasummary",
+	Doc:        "summarize functions for interprocedural analysis",
+	Run:        run,
+	Requires:   []*analysis.Analyzer{buildssa.Analyzer},
+	ResultType: reflect.TypeOf(new(Result)),
+	FactTypes:  []analysis.Fact{new(Summary)},
+}
+
+// Summary is a fact describing a function or method. Parameters are numbered
+// the way SSA numbers them: the receiver of a method is parameter 0.
+type Summary struct {
+	// NilResults lists results that may be nil. Only results of pointer,
+	// slice, map, channel, function, and interface types are listed.
+	NilResults []int
+
+	// Flows lists parameters whose values may flow into results.
+	Flows []Flow
+
+	// Calls lists parameters whose values may be passed to statically
+	// known functions, including calls made with go and defer.
+	Calls []Call
+}
+
+func (*Summary) AFact() {}
+
+func (s *Summary) String() string {
+	var parts []string
+	if len(s.NilResults) > 0 {
+		parts = append(parts, fmt.Sprintf("nil%v", s.NilResults))
+	}
+	for _, f := range s.Flows {
+		parts = append(parts, fmt.Sprintf("p%d->r%d", f.Param, f.Result))
+	}
+	for _, c := range s.Calls {
+		parts = append(parts, fmt.Sprintf("p%d->%s#%d", c.Param, c.Func, c.Arg))
+	}
+	return "summary(" + strings.Join(parts, " ") + ")"
+}
+
+// Flow records that parameter Param may flow into result Result.
+type Flow struct {
+	Param, Result int
+}
+
+// Call records that parameter Param may be passed as argument Arg to the
+// function Func. Func is the name returned by (*types.Func).FullName, so
+// summaries of functions in packages that aren't imported directly can be
+// found with Result.LookupName.
+type Call struct {
+	Func       string
+	Arg, Param int
+}
+
+// Result provides summaries for functions in the package being analyzed
+// and for functions in its dependencies.
+type Result struct {
+	summaries map[string]*Summary
+}
+
+// Lookup returns the summary of fn, or nil if there is none. Functions
+// without bodies and functions in packages that weren't analyzed don't
+// have summaries.
+func (r *Result) Lookup(fn *types.Func) *Summary {
+	return r.summaries[fn.FullName()]
+}
+
+// LookupName returns the summary of the function with the given full name,
+// as used in Call.
+func (r *Result) LookupName(name string) *Summary {
+	return r.summaries[name]
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	res := &Result{summaries: make(map[string]*Summary)}
+	for _, f := range pass.AllObjectFacts() {
+		if fn, ok := f.Object.(*types.Func); ok {
+			res.summaries[fn.FullName()] = f.Fact.(*Summary)
+		}
+	}
+
+	// Functions in the same package may call each other, so summaries are
+	// recomputed until they stop changing. Summaries only grow, so this
+	// terminates.
+	ssaInput := pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA)
+	var funcs []*ssa.Function
+	for _, f := range ssaInput.SrcFuncs {
+		if fn, ok := f.Object().(*types.Func); ok && f.Synthetic == "" {
+			funcs = append(funcs, f)
+			res.summaries[fn.FullName()] = new(Summary)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, f := range funcs {
+			name := f.Object().(*types.Func).FullName()
+			s := summarize(f, res)
+			if !reflect.DeepEqual(s, res.summaries[name]) {
+				res.summaries[name] = s
+				changed = true
+			}
+		}
+	}
+
+	for _, f := range funcs {
+		fn := f.Object().(*types.Func)
+		pass.ExportObjectFact(fn, res.summaries[fn.FullName()])
+	}
+	return res, nil
+}
+
+// summarize computes the summary of f, using res for functions it calls.
+func summarize(f *ssa.Function, res *Result) *Summary {
+	sum := &summarizer{
+		res:    res,
+		params: make(map[ssa.Value]int),
+		deps:   make(map[ssa.Value][]int),
+		nils:   make(map[ssa.Value]bool),
+	}
+	for i, p := range f.Params {
+		sum.params[p] = i
+	}
+
+	s := &Summary{}
+	nilResults := make(map[int]bool)
+	flows := make(map[Flow]bool)
+	calls := make(map[Call]bool)
+	for _, b := range f.Blocks {
+		for _, instr := range b.Instrs {
+			switch instr := instr.(type) {
+			case *ssa.Return:
+				for i, v := range instr.Results {
+					if sum.mayBeNil(v) {
+						nilResults[i] = true
+					}
+					for _, p := range sum.paramsOf(v) {
+						flows[Flow{Param: p, Result: i}] = true
+					}
+				}
+			case ssa.CallInstruction:
+				callee := staticCallee(instr.Common())
+				if callee == nil {
+					continue
+				}
+				for i, arg := range instr.Common().Args {
+					for _, p := range sum.paramsOf(arg) {
+						calls[Call{Func: callee.FullName(), Arg: i, Param: p}] = true
+					}
+				}
+			}
+		}
+	}
+
+	for i := range nilResults {
+		s.NilResults = append(s.NilResults, i)
+	}
+	sort.Ints(s.NilResults)
+	for f := range flows {
+		s.Flows = append(s.Flows, f)
+	}
+	sort.Slice(s.Flows, func(i, j int) bool {
+		a, b := s.Flows[i], s.Flows[j]
+		return a.Param < b.Param || a.Param == b.Param && a.Result < b.Result
+	})
+	for c := range calls {
+		s.Calls = append(s.Calls, c)
+	}
+	sort.Slice(s.Calls, func(i, j int) bool {
+		a, b := s.Calls[i], s.Calls[j]
+		if a.Func != b.Func {
+			return a.Func < b.Func
+		}
+		return a.Arg < b.Arg || a.Arg == b.Arg && a.Param < b.Param
+	})
+	return s
+}
+
+type summarizer struct {
+	res    *Result
+	params map[ssa.Value]int
+
+	// deps and nils memoize paramsOf and mayBeNil. A value being visited
+	// is recorded as having no parameters and not being nil, which cuts
+	// cycles through phi nodes.
+	deps map[ssa.Value][]int
+	nils map[ssa.Value]bool
+}
+
+// paramsOf returns the parameters v may be derived from.
+func (s *summarizer) paramsOf(v ssa.Value) []int {
+	if ps, ok := s.deps[v]; ok {
+		return ps
+	}
+	s.deps[v] = nil
+
+	var ps []int
+	switch v := v.(type) {
+	case *ssa.Parameter:
+		ps = []int{s.params[v]}
+	case *ssa.Const, *ssa.Global, *ssa.Function, *ssa.Builtin:
+		// No parameters.
+	case *ssa.Call:
+		ps = s.callParams(&v.Call, 0)
+	case *ssa.Extract:
+		if call, ok := v.Tuple.(*ssa.Call); ok {
+			ps = s.callParams(&call.Call, v.Index)
+		} else {
+			ps = s.paramsOf(v.Tuple)
+		}
+	case ssa.Instruction:
+		for _, op := range v.Operands(nil) {
+			if *op != nil {
+				ps = union(ps, s.paramsOf(*op))
+			}
+		}
+	}
+	s.deps[v] = ps
+	return ps
+}
+
+// callParams returns the parameters that may flow into the given result of
+// a call. If the callee has no summary, any argument may.
+func (s *summarizer) callParams(call *ssa.CallCommon, result int) []int {
+	var ps []int
+	var callSum *Summary
+	if callee := staticCallee(call); callee != nil {
+		callSum = s.res.Lookup(callee)
+	}
+	if callSum == nil {
+		if !call.IsInvoke() {
+			ps = s.paramsOf(call.Value)
+		}
+		for _, arg := range call.Args {
+			ps = union(ps, s.paramsOf(arg))
+		}
+		return ps
+	}
+	for _, f := range callSum.Flows {
+		if f.Result == result && f.Param < len(call.Args) {
+			ps = union(ps, s.paramsOf(call.Args[f.Param]))
+		}
+	}
+	return ps
+}
+
+// mayBeNil reports whether v may be nil.
+func (s *summarizer) mayBeNil(v ssa.Value) bool {
+	if isNil, ok := s.nils[v]; ok {
+		return isNil
+	}
+	s.nils[v] = false
+
+	isNil := false
+	switch v := v.(type) {
+	case *ssa.Const:
+		isNil = v.IsNil()
+	case *ssa.Phi:
+		for _, e := range v.Edges {
+			if s.mayBeNil(e) {
+				isNil = true
+				break
+			}
+		}
+	case *ssa.ChangeType:
+		isNil = s.mayBeNil(v.X)
+	case *ssa.Call:
+		isNil = s.callMayReturnNil(&v.Call, 0)
+	case *ssa.Extract:
+		if call, ok := v.Tuple.(*ssa.Call); ok {
+			isNil = s.callMayReturnNil(&call.Call, v.Index)
+		}
+	}
+	s.nils[v] = isNil
+	return isNil
+}
+
+func (s *summarizer) callMayReturnNil(call *ssa.CallCommon, result int) bool {
+	callee := staticCallee(call)
+	if callee == nil {
+		return false
+	}
+	callSum := s.res.Lookup(callee)
+	if callSum == nil {
+		return false
+	}
+	for _, r := range callSum.NilResults {
+		if r == result {
+			return true
+		}
+	}
+	return false
+}
+
+func staticCallee(call *ssa.CallCommon) *types.Func {
+	f := call.StaticCallee()
+	if f == nil {
+		return nil
+	}
+	fn, _ := f.Object().(*types.Func)
+	return fn
+}
+
+func union(a, b []int) []int {
+	for _, x := range b {
+		found := false
+		for _, y := range a {
+			if x == y {
+				found = true
+				break
+			}
+		}
+		if !found {
+			a = append(a, x)
+		}
+	}
+	sort.Ints(a)
+	return a
+}
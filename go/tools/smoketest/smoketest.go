@@ -0,0 +1,103 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package smoketest runs a binary and checks that it starts. It is embedded
+// in tests declared with go_binary_smoke_test in
+// @io_bazel_rules_go//extras:go_binary_smoke_test.bzl, which pass the
+// binary and expectations as flags. Arguments after "--" are passed to
+// the binary.
+package smoketest
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	binary   = flag.String("binary", "", "Path to the binary to run, relative to the workspace runfiles directory.")
+	exitCode = flag.Int("exit_code", 0, "Expected exit code of the binary.")
+	output   = flag.String("output", "", "Regular expression that must match the binary's combined stdout and stderr.")
+	timeout  = flag.Duration("timeout", 10*time.Second, "Time the binary has to exit before it is killed.")
+	env      multiFlag
+)
+
+func init() {
+	flag.Var(&env, "env", "KEY=VALUE pair to add to the binary's environment. May be repeated.")
+}
+
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, " ")
+}
+
+func (m *multiFlag) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("%q is not a KEY=VALUE pair", v)
+	}
+	*m = append(*m, v)
+	return nil
+}
+
+func TestSmoke(t *testing.T) {
+	if *binary == "" {
+		t.Fatal("-binary must be set")
+	}
+	var outputRe *regexp.Regexp
+	if *output != "" {
+		var err error
+		if outputRe, err = regexp.Compile(*output); err != nil {
+			t.Fatalf("-output: %v", err)
+		}
+	}
+	path, err := filepath.Abs(filepath.FromSlash(*binary))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, path, flag.Args()...)
+	cmd.Env = append(os.Environ(), env...)
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err = cmd.Run()
+	t.Logf("%s %s\n%s", *binary, strings.Join(flag.Args(), " "), out.Bytes())
+
+	if ctx.Err() == context.DeadlineExceeded {
+		t.Fatalf("%s did not exit within %v", *binary, *timeout)
+	}
+	code := 0
+	if xerr, ok := err.(*exec.ExitError); ok {
+		code = xerr.ExitCode()
+	} else if err != nil {
+		t.Fatalf("could not run %s: %v", *binary, err)
+	}
+	if code != *exitCode {
+		t.Errorf("%s exited with code %d; want %d", *binary, code, *exitCode)
+	}
+	if outputRe != nil && !outputRe.Match(out.Bytes()) {
+		t.Errorf("output of %s does not match %q", *binary, *output)
+	}
+}
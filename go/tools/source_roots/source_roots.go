@@ -0,0 +1,229 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// source_roots links Go sources from external repositories and generated
+// files into a directory in the workspace, so editors and code search
+// indexers that don't understand Bazel can find them. It's run by the
+// go_source_roots rule.
+//
+// The manifest written by go_source_roots has one file per line, with
+// tab-separated fields:
+//
+//	<importpath> <label> <runfiles path> <execroot path>
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// mappingName is the name of the file describing the linked packages. Its
+// presence marks a directory as one written by source_roots, which may be
+// replaced.
+const mappingName = "source_roots.json"
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("source_roots: ")
+	if err := run(os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("source_roots", flag.ExitOnError)
+	manifestPath := fs.String("manifest", "", "The manifest written by go_source_roots")
+	dir := fs.String("dir", "", "The directory to write, relative to the workspace root")
+	workspace := fs.String("workspace", os.Getenv("BUILD_WORKSPACE_DIRECTORY"), "The workspace root. Set by bazel run.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *manifestPath == "" {
+		return errors.New("-manifest must be set")
+	}
+	if *dir == "" {
+		return errors.New("-dir must be set")
+	}
+	if *workspace == "" {
+		return errors.New("-workspace must be set when not run with bazel run")
+	}
+
+	f, err := os.Open(*manifestPath)
+	if err != nil {
+		return err
+	}
+	pkgs, err := readManifest(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %v", *manifestPath, err)
+	}
+
+	outDir := filepath.Join(*workspace, filepath.FromSlash(*dir))
+	if err := writeSourceRoots(outDir, pkgs); err != nil {
+		return err
+	}
+	if !isBazelIgnored(*workspace, *dir) {
+		log.Printf("warning: %s is not listed in .bazelignore. Add it so Bazel doesn't look for packages in it.", *dir)
+	}
+	return nil
+}
+
+// pkg is a Go package with files linked into the output directory.
+type pkg struct {
+	ImportPath string `json:"importpath"`
+	Label      string `json:"label"`
+	Dir        string `json:"dir"`
+	Files      []file `json:"files"`
+}
+
+// file is a linked file. Name is the base name of the link, and Path is the
+// path of the original file relative to the execution root, like
+// external/com_example/foo.go or bazel-out/k8-fastbuild/bin/foo.pb.go.
+type file struct {
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	runfilesPath string
+}
+
+func readManifest(r io.Reader) ([]*pkg, error) {
+	byImportPath := make(map[string]*pkg)
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected 4 fields; got %d", lineNum, len(fields))
+		}
+		importPath, label, runfilesPath, execPath := fields[0], fields[1], fields[2], fields[3]
+		p, ok := byImportPath[importPath]
+		if !ok {
+			p = &pkg{ImportPath: importPath, Label: label, Dir: importPath}
+			byImportPath[importPath] = p
+		}
+		name := path.Base(execPath)
+		dup := false
+		for _, f := range p.Files {
+			if f.Name == name {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			p.Files = append(p.Files, file{Name: name, Path: execPath, runfilesPath: runfilesPath})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	pkgs := make([]*pkg, 0, len(byImportPath))
+	for _, p := range byImportPath {
+		sort.Slice(p.Files, func(i, j int) bool { return p.Files[i].Name < p.Files[j].Name })
+		pkgs = append(pkgs, p)
+	}
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].ImportPath < pkgs[j].ImportPath })
+	return pkgs, nil
+}
+
+// writeSourceRoots replaces outDir with a directory containing a link to each
+// file in pkgs, in a subdirectory named after its import path, and a mapping
+// file describing them. Links point to the files the runfiles refer to, so
+// they stay valid after bazel run exits.
+func writeSourceRoots(outDir string, pkgs []*pkg) error {
+	if err := clearOutDir(outDir); err != nil {
+		return err
+	}
+	for _, p := range pkgs {
+		pkgDir := filepath.Join(outDir, filepath.FromSlash(p.Dir))
+		if err := os.MkdirAll(pkgDir, 0777); err != nil {
+			return err
+		}
+		for _, f := range p.Files {
+			target, err := filepath.EvalSymlinks(filepath.FromSlash(f.runfilesPath))
+			if err != nil {
+				return err
+			}
+			if target, err = filepath.Abs(target); err != nil {
+				return err
+			}
+			if err := os.Symlink(target, filepath.Join(pkgDir, f.Name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	mapping, err := json.MarshalIndent(struct {
+		Packages []*pkg `json:"packages"`
+	}{pkgs}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(outDir, mappingName), append(mapping, '\n'), 0666)
+}
+
+// clearOutDir removes outDir if it was written by an earlier run and creates
+// it again. Directories without a mapping file are left alone, in case they
+// were set to something that wasn't meant to be replaced.
+func clearOutDir(outDir string) error {
+	entries, err := ioutil.ReadDir(outDir)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if len(entries) > 0 {
+		if _, err := os.Stat(filepath.Join(outDir, mappingName)); err != nil {
+			return fmt.Errorf("%s is not empty and was not written by go_source_roots; not replacing it", outDir)
+		}
+		if err := os.RemoveAll(outDir); err != nil {
+			return err
+		}
+	}
+	return os.MkdirAll(outDir, 0777)
+}
+
+// isBazelIgnored reports whether dir is listed in the workspace's
+// .bazelignore file. The links may point into Bazel's output directories,
+// which Bazel would otherwise traverse when evaluating patterns like //....
+func isBazelIgnored(workspace, dir string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(workspace, ".bazelignore"))
+	if err != nil {
+		return false
+	}
+	dir = path.Clean(filepath.ToSlash(dir))
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if ignored := path.Clean(line); ignored == dir || strings.HasPrefix(dir, ignored+"/") {
+			return true
+		}
+	}
+	return false
+}
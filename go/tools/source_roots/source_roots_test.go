@@ -0,0 +1,156 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testManifest = `example.com/dep	@com_example_dep//:dep	../com_example_dep/dep.go	external/com_example_dep/dep.go
+example.com/dep	@com_example_dep//:dep	../com_example_dep/dep.go	external/com_example_dep/dep.go
+example.com/api	//api:api_go_proto	api/api.pb.go	bazel-out/k8-fastbuild/bin/api/api.pb.go
+`
+
+func TestReadManifest(t *testing.T) {
+	pkgs, err := readManifest(strings.NewReader(testManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []*pkg{
+		{
+			ImportPath: "example.com/api",
+			Label:      "//api:api_go_proto",
+			Dir:        "example.com/api",
+			Files:      []file{{Name: "api.pb.go", Path: "bazel-out/k8-fastbuild/bin/api/api.pb.go", runfilesPath: "api/api.pb.go"}},
+		}, {
+			ImportPath: "example.com/dep",
+			Label:      "@com_example_dep//:dep",
+			Dir:        "example.com/dep",
+			Files:      []file{{Name: "dep.go", Path: "external/com_example_dep/dep.go", runfilesPath: "../com_example_dep/dep.go"}},
+		},
+	}
+	if !reflect.DeepEqual(pkgs, want) {
+		t.Errorf("got %#v; want %#v", pkgs, want)
+	}
+
+	if _, err := readManifest(strings.NewReader("example.com/dep\t//:dep\n")); err == nil {
+		t.Error("unexpected success reading malformed manifest")
+	}
+}
+
+func TestWriteSourceRoots(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source_roots_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "dep.go")
+	if err := ioutil.WriteFile(src, []byte("package dep\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	pkgs := []*pkg{{
+		ImportPath: "example.com/dep",
+		Label:      "@com_example_dep//:dep",
+		Dir:        "example.com/dep",
+		Files:      []file{{Name: "dep.go", Path: "external/com_example_dep/dep.go", runfilesPath: src}},
+	}}
+
+	outDir := filepath.Join(dir, "roots")
+	for i := 0; i < 2; i++ {
+		// The second run replaces the output of the first.
+		if err := writeSourceRoots(outDir, pkgs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(outDir, "example.com", "dep", "dep.go")
+	if target, err := os.Readlink(link); err != nil {
+		t.Fatal(err)
+	} else if wantTarget, _ := filepath.EvalSymlinks(src); target != wantTarget {
+		t.Errorf("link points to %s; want %s", target, wantTarget)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(outDir, mappingName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mapping struct {
+		Packages []struct {
+			ImportPath string `json:"importpath"`
+			Label      string `json:"label"`
+			Dir        string `json:"dir"`
+			Files      []struct {
+				Name string `json:"name"`
+				Path string `json:"path"`
+			} `json:"files"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		t.Fatal(err)
+	}
+	if len(mapping.Packages) != 1 || mapping.Packages[0].Label != "@com_example_dep//:dep" || len(mapping.Packages[0].Files) != 1 || mapping.Packages[0].Files[0].Path != "external/com_example_dep/dep.go" {
+		t.Errorf("unexpected mapping:\n%s", data)
+	}
+}
+
+func TestWriteSourceRootsKeepsOtherDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source_roots_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	keep := filepath.Join(dir, "keep.txt")
+	if err := ioutil.WriteFile(keep, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSourceRoots(dir, nil); err == nil {
+		t.Fatal("unexpected success writing to a directory with other files")
+	}
+	if _, err := os.Stat(keep); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsBazelIgnored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "source_roots_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if isBazelIgnored(dir, ".go_source_roots") {
+		t.Error("directory ignored without .bazelignore")
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, ".bazelignore"), []byte("# comment\nide/\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		dir  string
+		want bool
+	}{
+		{"ide", true},
+		{"ide/go", true},
+		{"ide2", false},
+		{".go_source_roots", false},
+	} {
+		if got := isBazelIgnored(dir, tc.dir); got != tc.want {
+			t.Errorf("isBazelIgnored(%q) = %v; want %v", tc.dir, got, tc.want)
+		}
+	}
+}
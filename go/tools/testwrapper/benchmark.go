@@ -0,0 +1,42 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// benchmarkResultsFile is the name of the file in the test's undeclared
+// outputs where a go_benchmark's output is copied. The file is in the
+// format read by benchstat.
+const benchmarkResultsFile = "benchmark.txt"
+
+// createBenchmarkResults creates benchmarkResultsFile in the test's undeclared
+// outputs. It returns nil if there's no directory for outputs, for example,
+// when the test is run with "bazel run".
+func createBenchmarkResults() (io.WriteCloser, error) {
+	outDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if outDir == "" {
+		return nil, nil
+	}
+	f, err := os.Create(filepath.Join(outDir, benchmarkResultsFile))
+	if err != nil {
+		return nil, fmt.Errorf("error creating benchmark results file: %v", err)
+	}
+	return f, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCreateBenchmarkResults(t *testing.T) {
+	outDir, err := ioutil.TempDir("", "TestCreateBenchmarkResults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+	old, hadOld := os.LookupEnv("TEST_UNDECLARED_OUTPUTS_DIR")
+	defer func() {
+		if hadOld {
+			os.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", old)
+		} else {
+			os.Unsetenv("TEST_UNDECLARED_OUTPUTS_DIR")
+		}
+	}()
+
+	os.Unsetenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if w, err := createBenchmarkResults(); err != nil {
+		t.Fatal(err)
+	} else if w != nil {
+		t.Error("got a writer without an outputs directory")
+	}
+
+	os.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", outDir)
+	w, err := createBenchmarkResults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "BenchmarkX-8   \t 1000\t  1234 ns/op\n"
+	if _, err := w.Write([]byte(want)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(outDir, benchmarkResultsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
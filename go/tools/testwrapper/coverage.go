@@ -0,0 +1,180 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// coverageOutputEnv names the file where Bazel expects a test's coverage
+// profile. The generated test main writes its profile there.
+const coverageOutputEnv = "COVERAGE_OUTPUT_FILE"
+
+// coverageProfile holds the counters from one or more Go coverage profiles,
+// as written by -test.coverprofile.
+type coverageProfile struct {
+	mode   string
+	blocks []string
+	counts map[string]uint64
+}
+
+// merge adds the counters from the profile in data. Blocks are identified
+// by their position and statement count. In "set" mode, a block is covered
+// if it was covered in any profile; otherwise, counts are added.
+func (p *coverageProfile) merge(data []byte) error {
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; s.Scan(); line++ {
+		text := strings.TrimSpace(s.Text())
+		if text == "" {
+			continue
+		}
+		if line == 1 {
+			mode := strings.TrimPrefix(text, "mode: ")
+			if mode == text {
+				return fmt.Errorf("coverage profile: missing mode line")
+			}
+			if p.mode != "" && p.mode != mode {
+				return fmt.Errorf("coverage profile: can't merge mode %q with mode %q", mode, p.mode)
+			}
+			p.mode = mode
+			continue
+		}
+		i := strings.LastIndexByte(text, ' ')
+		if i < 0 {
+			return fmt.Errorf("coverage profile: line %d: malformed block %q", line, text)
+		}
+		block := text[:i]
+		count, err := strconv.ParseUint(text[i+1:], 10, 64)
+		if err != nil {
+			return fmt.Errorf("coverage profile: line %d: malformed count: %v", line, err)
+		}
+		if p.counts == nil {
+			p.counts = make(map[string]uint64)
+		}
+		old, ok := p.counts[block]
+		if !ok {
+			p.blocks = append(p.blocks, block)
+		}
+		if p.mode == "set" {
+			if count > 0 || old > 0 {
+				count = 1
+			}
+		} else {
+			count += old
+		}
+		p.counts[block] = count
+	}
+	return s.Err()
+}
+
+// write writes the merged profile in the same format it was read. Blocks
+// appear in the order they were first seen.
+func (p *coverageProfile) write(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", p.mode)
+	for _, block := range p.blocks {
+		fmt.Fprintf(bw, "%s %d\n", block, p.counts[block])
+	}
+	return bw.Flush()
+}
+
+// coverageCollector gathers the profiles written by each run of the test
+// binary, so reruns don't overwrite coverage from earlier runs. A nil
+// collector does nothing; it's used when coverage isn't being collected.
+type coverageCollector struct {
+	out   string
+	dir   string
+	files []string
+}
+
+// newCoverageCollector returns a collector for the profile named by
+// coverageOutputEnv, or nil if it's not set.
+func newCoverageCollector() (*coverageCollector, error) {
+	out := os.Getenv(coverageOutputEnv)
+	if out == "" {
+		return nil, nil
+	}
+	dir, err := ioutil.TempDir(os.Getenv("TEST_TMPDIR"), "coverage")
+	if err != nil {
+		return nil, fmt.Errorf("error creating coverage directory: %v", err)
+	}
+	return &coverageCollector{out: out, dir: dir}, nil
+}
+
+// env returns env with coverageOutputEnv set to a new file for the next run
+// of the test binary.
+func (c *coverageCollector) env(env []string) []string {
+	if c == nil {
+		return env
+	}
+	path := filepath.Join(c.dir, fmt.Sprintf("run%d.dat", len(c.files)))
+	c.files = append(c.files, path)
+	return append(env[:len(env):len(env)], coverageOutputEnv+"="+path)
+}
+
+// finish merges the profiles written by each run into the output file.
+// Counters already in the output file are kept: shards and repeated runs
+// that share it each add their own. Runs that didn't write a profile, for
+// example, because they crashed, are skipped.
+func (c *coverageCollector) finish() error {
+	if c == nil {
+		return nil
+	}
+	defer os.RemoveAll(c.dir)
+	var p coverageProfile
+	for _, path := range append([]string{c.out}, c.files...) {
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("error reading coverage profile: %v", err)
+		}
+		if err := p.merge(data); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	if p.mode == "" {
+		return nil
+	}
+	// Write the merged profile beside the output and rename it, so shards
+	// sharing the output never see a partial profile.
+	f, err := ioutil.TempFile(filepath.Dir(c.out), filepath.Base(c.out)+".tmp")
+	if err != nil {
+		return fmt.Errorf("error writing coverage profile: %v", err)
+	}
+	werr := f.Chmod(0644)
+	if werr == nil {
+		werr = p.write(f)
+	}
+	if cerr := f.Close(); werr == nil {
+		werr = cerr
+	}
+	if werr == nil {
+		werr = os.Rename(f.Name(), c.out)
+	}
+	if werr != nil {
+		os.Remove(f.Name())
+		return fmt.Errorf("error writing coverage profile: %v", werr)
+	}
+	return nil
+}
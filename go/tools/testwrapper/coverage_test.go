@@ -0,0 +1,138 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCoverageProfileMerge(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		profiles []string
+		want     string
+	}{
+		{
+			desc: "set",
+			profiles: []string{
+				"mode: set\na.go:1.1,2.2 1 1\na.go:3.1,4.2 2 0\n",
+				"mode: set\na.go:1.1,2.2 1 0\na.go:3.1,4.2 2 1\nb.go:1.1,2.2 1 0\n",
+			},
+			want: "mode: set\na.go:1.1,2.2 1 1\na.go:3.1,4.2 2 1\nb.go:1.1,2.2 1 0\n",
+		},
+		{
+			desc: "count",
+			profiles: []string{
+				"mode: count\na.go:1.1,2.2 1 3\n",
+				"",
+				"mode: count\na.go:1.1,2.2 1 4\na.go:3.1,4.2 2 1\n",
+			},
+			want: "mode: count\na.go:1.1,2.2 1 7\na.go:3.1,4.2 2 1\n",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var p coverageProfile
+			for _, profile := range tc.profiles {
+				if err := p.merge([]byte(profile)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var buf bytes.Buffer
+			if err := p.write(&buf); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCoverageProfileMergeErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		profiles []string
+	}{
+		{desc: "mode mismatch", profiles: []string{"mode: set\n", "mode: atomic\n"}},
+		{desc: "missing mode", profiles: []string{"a.go:1.1,2.2 1 1\n"}},
+		{desc: "bad count", profiles: []string{"mode: set\na.go:1.1,2.2 1 x\n"}},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			var p coverageProfile
+			var err error
+			for _, profile := range tc.profiles {
+				if err = p.merge([]byte(profile)); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				t.Error("unexpected success")
+			}
+		})
+	}
+}
+
+func TestCoverageCollector(t *testing.T) {
+	dir, err := ioutil.TempDir("", "coverage_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "coverage.dat")
+	if err := ioutil.WriteFile(out, []byte("mode: count\na.go:1.1,2.2 1 1\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(coverageOutputEnv, out)
+	defer os.Unsetenv(coverageOutputEnv)
+
+	c, err := newCoverageCollector()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, profile := range []string{
+		"mode: count\na.go:1.1,2.2 1 2\n",
+		"", // The run crashed before writing a profile.
+		"mode: count\na.go:1.1,2.2 1 3\n",
+	} {
+		env := c.env(nil)
+		if len(env) != 1 {
+			t.Fatalf("run %d: got env %q; want one variable", i, env)
+		}
+		if profile == "" {
+			continue
+		}
+		path := env[0][len(coverageOutputEnv)+1:]
+		if err := ioutil.WriteFile(path, []byte(profile), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.finish(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "mode: count\na.go:1.1,2.2 1 6\n"; got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if _, err := os.Stat(c.dir); !os.IsNotExist(err) {
+		t.Errorf("coverage directory %s was not removed", c.dir)
+	}
+}
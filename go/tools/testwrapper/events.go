@@ -0,0 +1,100 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// eventsEnv enables streaming of test2json events while the test runs, so
+// tools can show the progress of long tests before they finish. If it's a
+// boolean, events are written to eventsFile in the test's undeclared outputs
+// directory. Otherwise, it names a directory where a file named after the
+// test target and shard is written; the directory must be writable from the
+// test's sandbox.
+const eventsEnv = "GO_TEST_EVENTS"
+
+// eventsFile is the name of the events file in the undeclared outputs
+// directory. Each line is a test2json event.
+const eventsFile = "test_events.json"
+
+// eventStream is a file that test2json events are written to as they're
+// converted. A nil *eventStream discards events.
+type eventStream struct {
+	f *os.File
+}
+
+// newEventStream creates the events file requested by eventsEnv. It returns
+// nil if events aren't requested, or if they're requested in the undeclared
+// outputs directory and there isn't one, for example, when the test is run
+// with "bazel run".
+func newEventStream() (*eventStream, error) {
+	value := os.Getenv(eventsEnv)
+	if value == "" {
+		return nil, nil
+	}
+	var path string
+	if on, err := strconv.ParseBool(value); err == nil {
+		dir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+		if !on || dir == "" {
+			return nil, nil
+		}
+		path = filepath.Join(dir, eventsFile)
+	} else {
+		path = filepath.Join(value, eventsFileName(os.Getenv("TEST_TARGET"), os.Getenv("TEST_SHARD_INDEX")))
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("error creating test events file: %v", err)
+	}
+	return &eventStream{f: f}, nil
+}
+
+// eventsFileName returns the name of the events file written to a directory
+// named by eventsEnv for the given target and shard index. Files for
+// different targets and shards don't collide, so one directory may be shared
+// by a whole build.
+func eventsFileName(target, shard string) string {
+	name := strings.TrimLeft(target, "@/")
+	name = strings.NewReplacer("//", "_", "/", "_", ":", "_", "@", "_").Replace(name)
+	if name == "" {
+		name = "test"
+	}
+	if shard != "" {
+		name += ".shard" + shard
+	}
+	return name + ".json"
+}
+
+// writer returns a writer that writes to w and to the events file.
+func (s *eventStream) writer(w io.Writer) io.Writer {
+	if s == nil {
+		return w
+	}
+	return io.MultiWriter(w, s.f)
+}
+
+// Close closes the events file.
+func (s *eventStream) Close() error {
+	if s == nil {
+		return nil
+	}
+	return s.f.Close()
+}
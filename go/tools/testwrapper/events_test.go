@@ -0,0 +1,91 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEventsFileName(t *testing.T) {
+	for _, tc := range []struct {
+		target, shard, want string
+	}{
+		{"//foo/bar:baz_test", "", "foo_bar_baz_test.json"},
+		{"//foo:baz_test", "2", "foo_baz_test.shard2.json"},
+		{"@repo//foo:baz_test", "", "repo_foo_baz_test.json"},
+		{"", "", "test.json"},
+	} {
+		if got := eventsFileName(tc.target, tc.shard); got != tc.want {
+			t.Errorf("eventsFileName(%q, %q) = %q; want %q", tc.target, tc.shard, got, tc.want)
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	dir, err := ioutil.TempDir(os.Getenv("TEST_TMPDIR"), "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		desc, value, outputs, want string
+	}{
+		{desc: "unset"},
+		{desc: "false", value: "0", outputs: dir},
+		{desc: "no_outputs", value: "1"},
+		{desc: "outputs", value: "1", outputs: dir, want: filepath.Join(dir, eventsFile)},
+		{desc: "dir", value: dir, want: filepath.Join(dir, "pkg_events_test.json")},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			defer setenv(eventsEnv, tc.value)()
+			defer setenv("TEST_UNDECLARED_OUTPUTS_DIR", tc.outputs)()
+			defer setenv("TEST_TARGET", "//pkg:events_test")()
+			defer setenv("TEST_SHARD_INDEX", "")()
+			s, err := newEventStream()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want == "" {
+				if s != nil {
+					t.Fatalf("got events file %s; want none", s.f.Name())
+				}
+				return
+			}
+			if s == nil {
+				t.Fatal("got no events file")
+			}
+			var buf bytes.Buffer
+			w := s.writer(&buf)
+			if _, err := w.Write([]byte("{\"Action\":\"run\"}\n")); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadFile(tc.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != buf.String() {
+				t.Errorf("events file contains %q; want %q", data, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// failureHookEnv names an executable the wrapper runs after a test fails,
+// for example, to upload its outputs or notify a triage bot. If set, it
+// overrides the go_test's failure_hook attribute. Relative paths are
+// relative to the test's runfiles directory.
+const failureHookEnv = "GO_TEST_FAILURE_HOOK"
+
+// failureHookTimeoutEnv may be set to how long the failure hook may run,
+// in a format accepted by time.ParseDuration.
+const failureHookTimeoutEnv = "GO_TEST_FAILURE_HOOK_TIMEOUT"
+
+// defaultFailureHookTimeout is how long the failure hook may run if
+// failureHookTimeoutEnv isn't set.
+const defaultFailureHookTimeout = time.Minute
+
+// runFailureHook runs the failure hook named by failureHookEnv, or hook if
+// that's not set, with the test's undeclared outputs directory as its only
+// argument. pkg is the import path of the package being tested; it's passed
+// to the hook in GO_TEST_PACKAGE. The hook's output goes to the test log.
+// The hook is killed if it runs longer than its timeout. Errors are
+// reported, but they don't change the result of the test.
+func runFailureHook(pkg, hook string) {
+	if env := os.Getenv(failureHookEnv); env != "" {
+		hook = env
+	}
+	if hook == "" {
+		return
+	}
+	if !filepath.IsAbs(hook) {
+		hook = filepath.Join(os.Getenv("TEST_SRCDIR"), os.Getenv("TEST_WORKSPACE"), hook)
+	}
+	timeout := defaultFailureHookTimeout
+	if s := os.Getenv(failureHookTimeoutEnv); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid value for %s: %q\n", failureHookTimeoutEnv, s)
+			return
+		}
+		timeout = d
+	}
+	outputsDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if outputsDir != "" {
+		if err := os.MkdirAll(outputsDir, 0777); err != nil {
+			fmt.Fprintf(os.Stderr, "failure hook %s not run: %v\n", hook, err)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, hook, outputsDir)
+	cmd.Env = append(os.Environ(), "GO_TEST_PACKAGE="+pkg)
+	// Writing straight to the test's own files means Wait doesn't need to
+	// copy output, so it returns when the hook is killed even if the hook's
+	// children still hold them open.
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	fmt.Fprintf(os.Stderr, "running failure hook %s\n", hook)
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		fmt.Fprintf(os.Stderr, "failure hook %s timed out after %v\n", hook, timeout)
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "failure hook %s failed: %v\n", hook, err)
+	}
+}
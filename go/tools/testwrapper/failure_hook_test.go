@@ -0,0 +1,103 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func writeFailureHook(t *testing.T, dir, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks in this test are shell scripts")
+	}
+	path := filepath.Join(dir, "hook.sh")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0777); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// setenv sets an environment variable and returns a function that restores
+// its previous value.
+func setenv(key, value string) func() {
+	old, ok := os.LookupEnv(key)
+	os.Setenv(key, value)
+	return func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	}
+}
+
+func TestRunFailureHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failure_hook_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	outputsDir := filepath.Join(dir, "outputs")
+	defer setenv("TEST_UNDECLARED_OUTPUTS_DIR", outputsDir)()
+	hook := writeFailureHook(t, dir, `echo "$GO_TEST_PACKAGE" > "$1/hook.txt"`)
+
+	runFailureHook("example.com/hook", hook)
+	data, err := ioutil.ReadFile(filepath.Join(outputsDir, "hook.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(data), "example.com/hook\n"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestRunFailureHookEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failure_hook_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setenv("TEST_UNDECLARED_OUTPUTS_DIR", dir)()
+	hook := writeFailureHook(t, dir, `touch "$1/env.txt"`)
+	defer setenv(failureHookEnv, hook)()
+
+	runFailureHook("example.com/hook", filepath.Join(dir, "missing"))
+	if _, err := os.Stat(filepath.Join(dir, "env.txt")); err != nil {
+		t.Errorf("hook from %s was not run: %v", failureHookEnv, err)
+	}
+}
+
+func TestRunFailureHookTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "failure_hook_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setenv("TEST_UNDECLARED_OUTPUTS_DIR", dir)()
+	defer setenv(failureHookTimeoutEnv, "100ms")()
+	hook := writeFailureHook(t, dir, "exec sleep 60\n")
+
+	start := time.Now()
+	runFailureHook("example.com/hook", hook)
+	if d := time.Since(start); d > 30*time.Second {
+		t.Errorf("hook ran for %v; want it killed after its timeout", d)
+	}
+}
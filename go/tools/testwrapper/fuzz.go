@@ -0,0 +1,226 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// fuzzDirEnv is set by the wrapper to the directory the test should run in
+// while fuzzing. Runfiles may not be writable, so the wrapper builds a copy
+// of the test directory where testdata/fuzz may be written. Fuzz workers
+// started by the testing package inherit this.
+const fuzzDirEnv = "GO_TEST_FUZZ_DIR"
+
+// fuzzCorpusDir is the directory, relative to the test directory, where the
+// testing package reads seed inputs and writes failing inputs.
+const fuzzCorpusDir = "testdata/fuzz"
+
+// fuzzing reports whether the fuzzer was requested with -test.fuzz and the
+// wrapper hasn't started the test process yet.
+func fuzzing() bool {
+	if _, ok := os.LookupEnv(fuzzDirEnv); ok {
+		return false
+	}
+	return fuzzPattern(os.Args[1:]) != ""
+}
+
+// fuzzPattern returns the value of the -test.fuzz flag in args, or "" if
+// it's not set.
+func fuzzPattern(args []string) string {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if name == arg {
+			continue
+		}
+		if name == "test.fuzz" && i+1 < len(args) {
+			return args[i+1]
+		}
+		if strings.HasPrefix(name, "test.fuzz=") {
+			return name[len("test.fuzz="):]
+		}
+	}
+	return ""
+}
+
+// hasFlag reports whether the flag with the given name is set in args.
+func hasFlag(args []string, flag string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		name := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if name != arg && (name == flag || strings.HasPrefix(name, flag+"=")) {
+			return true
+		}
+	}
+	return false
+}
+
+// prepareFuzzDir builds a copy of the runfiles tree under tmpDir where the
+// test directory, runDir, may be written. Only the directories leading to
+// and inside runDir's corpus are created; everything else is symlinked, so
+// tests that read files with relative paths still work. prepareFuzzDir
+// returns the path of the copy of runDir.
+func prepareFuzzDir(srcdir, workspace, runDir, tmpDir string) (string, error) {
+	corpus := filepath.Join(workspace, runDir, filepath.FromSlash(fuzzCorpusDir))
+	if err := mirrorDir(srcdir, tmpDir, "", corpus); err != nil {
+		return "", err
+	}
+	dir := filepath.Join(tmpDir, workspace, runDir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// mirrorDir recreates the directory src/rel in dst. Entries that lead to or
+// are inside the directory keep are recreated the same way; other entries
+// are symlinked.
+func mirrorDir(src, dst, rel, keep string) error {
+	if err := os.MkdirAll(filepath.Join(dst, rel), 0777); err != nil {
+		return err
+	}
+	fis, err := ioutil.ReadDir(filepath.Join(src, rel))
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		entryRel := filepath.Join(rel, fi.Name())
+		srcPath := filepath.Join(src, entryRel)
+		if fi.IsDir() || fi.Mode()&os.ModeSymlink != 0 {
+			if st, err := os.Stat(srcPath); err == nil && st.IsDir() && leadsTo(entryRel, keep) {
+				if err := mirrorDir(src, dst, entryRel, keep); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if err := os.Symlink(srcPath, filepath.Join(dst, entryRel)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// leadsTo reports whether rel is keep, a parent of keep, or inside keep.
+func leadsTo(rel, keep string) bool {
+	sep := string(filepath.Separator)
+	return rel == keep || strings.HasPrefix(keep, rel+sep) || strings.HasPrefix(rel, keep+sep)
+}
+
+// collectFuzzInputs copies inputs the fuzzer wrote to the corpus in dir into
+// outDir, keeping their paths relative to dir. Seed inputs from the source
+// tree are symlinks and aren't copied. collectFuzzInputs returns the paths
+// of the copied files, relative to dir.
+func collectFuzzInputs(dir, outDir string) ([]string, error) {
+	var written []string
+	corpus := filepath.Join(dir, filepath.FromSlash(fuzzCorpusDir))
+	err := filepath.Walk(corpus, func(path string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) && path == corpus {
+			return filepath.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if err := copyFile(path, filepath.Join(outDir, rel)); err != nil {
+			return err
+		}
+		written = append(written, filepath.ToSlash(rel))
+		return nil
+	})
+	return written, err
+}
+
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0777); err != nil {
+		return err
+	}
+	r, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// setupFuzzing prepares the environment and arguments for a test process
+// that will run the fuzzer. The returned function should be called after
+// the process exits to save the inputs it found.
+func setupFuzzing(runDir string, args, env []string) ([]string, []string, func() error, error) {
+	done := func() error { return nil }
+	outDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if outDir != "" && !hasFlag(args, "test.fuzzcachedir") {
+		// The cache holds generated inputs that expanded coverage. Keeping it
+		// in the test's outputs makes it available after the test, and a
+		// later run may be pointed at it with --test_arg.
+		args = append([]string{"-test.fuzzcachedir=" + filepath.Join(outDir, "fuzzcache")}, args...)
+	}
+
+	srcdir := os.Getenv("TEST_SRCDIR")
+	workspace := os.Getenv("TEST_WORKSPACE")
+	tmpDir := os.Getenv("TEST_TMPDIR")
+	if srcdir == "" || workspace == "" || tmpDir == "" {
+		// Not run by Bazel. The test runs in the current directory, which
+		// should already be writable.
+		return args, append(env, fuzzDirEnv+"="), done, nil
+	}
+	dir, err := prepareFuzzDir(srcdir, workspace, runDir, filepath.Join(tmpDir, "fuzz"))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("error preparing directory for fuzzing: %v", err)
+	}
+	env = append(env, fuzzDirEnv+"="+dir)
+	done = func() error {
+		if outDir == "" {
+			return nil
+		}
+		written, err := collectFuzzInputs(dir, outDir)
+		if err != nil {
+			return fmt.Errorf("error saving fuzz inputs: %v", err)
+		}
+		if len(written) > 0 {
+			fmt.Fprintf(os.Stderr, "\nThe fuzzer wrote these inputs to the test's undeclared outputs:\n")
+			for _, w := range written {
+				fmt.Fprintf(os.Stderr, "    %s\n", w)
+			}
+			fmt.Fprintf(os.Stderr, "Copy them into the package's source directory to add them to the seed corpus.\n")
+		}
+		return nil
+	}
+	return args, env, done, nil
+}
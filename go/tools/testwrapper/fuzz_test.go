@@ -0,0 +1,111 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestFuzzPattern(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, ""},
+		{[]string{"-test.v"}, ""},
+		{[]string{"-test.fuzz=FuzzX"}, "FuzzX"},
+		{[]string{"--test.fuzz", "FuzzX"}, "FuzzX"},
+		{[]string{"-test.fuzztime=10s"}, ""},
+		{[]string{"--", "-test.fuzz=FuzzX"}, ""},
+	} {
+		if got := fuzzPattern(tc.args); got != tc.want {
+			t.Errorf("fuzzPattern(%q) = %q; want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestHasFlag(t *testing.T) {
+	args := []string{"-test.fuzz=FuzzX", "--test.fuzzcachedir", "/tmp/x"}
+	if !hasFlag(args, "test.fuzzcachedir") {
+		t.Error("test.fuzzcachedir not found")
+	}
+	if hasFlag(args, "test.fuzztime") {
+		t.Error("test.fuzztime found")
+	}
+}
+
+func TestFuzzDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks may not be available")
+	}
+	tmp, err := ioutil.TempDir("", "TestFuzzDir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	srcdir := filepath.Join(tmp, "runfiles")
+	for _, name := range []string{
+		"ws/pkg/a.txt",
+		"ws/pkg/testdata/fuzz/FuzzX/seed",
+		"ws/other/b.txt",
+	} {
+		path := filepath.Join(srcdir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(name), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dir, err := prepareFuzzDir(srcdir, "ws", "pkg", filepath.Join(tmp, "fuzz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.txt", "../other/b.txt", "testdata/fuzz/FuzzX/seed"} {
+		if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Error(err)
+		}
+	}
+	if fi, err := os.Lstat(filepath.Join(dir, "testdata", "fuzz", "FuzzX")); err != nil {
+		t.Fatal(err)
+	} else if !fi.IsDir() {
+		t.Fatalf("corpus directory was not copied: mode %v", fi.Mode())
+	}
+
+	// Simulate the fuzzer finding a failing input.
+	crasher := filepath.Join(dir, "testdata", "fuzz", "FuzzX", "crasher")
+	if err := ioutil.WriteFile(crasher, []byte("crash"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(tmp, "outputs")
+	written, err := collectFuzzInputs(dir, outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"testdata/fuzz/FuzzX/crasher"}; !reflect.DeepEqual(written, want) {
+		t.Errorf("got %q; want %q", written, want)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(outDir, "testdata", "fuzz", "FuzzX", "crasher")); err != nil {
+		t.Error(err)
+	} else if string(data) != "crash" {
+		t.Errorf("got %q; want %q", data, "crash")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// profilesEnv may list the profiles a test writes, separated by commas. If
+// set, it overrides the go_test's profiles attribute, so profiles can be
+// collected without rebuilding the test.
+const profilesEnv = "GO_TEST_PROFILES"
+
+// profileFlags maps the names of profiles to the testing flags that enable
+// them and the files they're written to.
+var profileFlags = map[string]struct{ flag, file string }{
+	"block": {"test.blockprofile", "block.pprof"},
+	"cpu":   {"test.cpuprofile", "cpu.pprof"},
+	"mem":   {"test.memprofile", "mem.pprof"},
+	"mutex": {"test.mutexprofile", "mutex.pprof"},
+	"trace": {"test.trace", "trace.out"},
+}
+
+// setProfileFlags sets the testing flags for the profiles listed in
+// profilesEnv, or in def if that's not set, so they're written to the
+// test's undeclared outputs directory. It must be called after the testing
+// flags are registered and before they're parsed, so flags on the command
+// line take precedence. Profiles aren't written when there's no directory
+// for outputs, for example, when the test is run with "bazel run".
+func setProfileFlags(def string) error {
+	names := def
+	if env, ok := os.LookupEnv(profilesEnv); ok {
+		names = env
+	}
+	dir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		pf, ok := profileFlags[name]
+		if !ok {
+			return fmt.Errorf("invalid profile %q: must be one of block, cpu, mem, mutex, trace", name)
+		}
+		if dir == "" {
+			continue
+		}
+		f := flag.Lookup(pf.flag)
+		if f == nil {
+			return fmt.Errorf("can't write %s profile: flag -%s is not defined", name, pf.flag)
+		}
+		if err := f.Value.Set(filepath.Join(dir, pf.file)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
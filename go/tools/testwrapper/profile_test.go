@@ -0,0 +1,63 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetProfileFlags(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profile_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer setenv("TEST_UNDECLARED_OUTPUTS_DIR", dir)()
+	for _, name := range []string{"test.cpuprofile", "test.trace"} {
+		f := flag.Lookup(name)
+		if f == nil {
+			t.Fatalf("flag -%s is not defined", name)
+		}
+		defer f.Value.Set(f.Value.String())
+	}
+
+	if err := setProfileFlags("cpu, trace"); err != nil {
+		t.Fatal(err)
+	}
+	for name, file := range map[string]string{
+		"test.cpuprofile": "cpu.pprof",
+		"test.trace":      "trace.out",
+	} {
+		if got, want := flag.Lookup(name).Value.String(), filepath.Join(dir, file); got != want {
+			t.Errorf("-%s: got %q; want %q", name, got, want)
+		}
+	}
+}
+
+func TestSetProfileFlagsEnv(t *testing.T) {
+	defer setenv("TEST_UNDECLARED_OUTPUTS_DIR", "")()
+	defer setenv(profilesEnv, "bogus")()
+	if err := setProfileFlags("cpu"); err == nil {
+		t.Error("unexpected success with invalid profile from environment")
+	}
+	defer setenv(profilesEnv, "")()
+	if err := setProfileFlags("bogus"); err != nil {
+		t.Errorf("profiles attribute was not overridden by empty %s: %v", profilesEnv, err)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// raceReportFile is the name of the file in the test's undeclared outputs
+// where reports from the race detector are copied.
+const raceReportFile = "race_reports.txt"
+
+// raceTestName is the name of the test case added to the XML report when
+// the race detector reports a data race.
+const raceTestName = "DataRace"
+
+// raceExitCode is the status the wrapper exits with when the race detector
+// reported a data race but the test process exited successfully. It's the
+// race detector's default exit code.
+const raceExitCode = 66
+
+const raceSeparator = "=================="
+
+// raceDetector is an io.Writer that finds reports written by the race
+// detector in a test's output. A report starts with a separator line followed
+// by "WARNING: DATA RACE" and ends with another separator line. File names in
+// reports are made relative to the workspace; see raceFramePath. If out is
+// set, the output is copied there, one line at a time, with the lines between
+// "WARNING: DATA RACE" and the closing separator rewritten.
+type raceDetector struct {
+	out      io.Writer
+	line     []byte
+	afterSep bool
+	inReport bool
+	report   strings.Builder
+	reports  []string
+}
+
+func (d *raceDetector) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			d.line = append(d.line, p...)
+			break
+		}
+		d.line = append(d.line, p[:i+1]...)
+		d.processLine(string(d.line))
+		d.line = d.line[:0]
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// Close copies output after the last newline unchanged and records a report
+// that was cut off, for example, because the process crashed while the
+// report was being written.
+func (d *raceDetector) Close() error {
+	if len(d.line) > 0 {
+		if d.out != nil {
+			d.out.Write(d.line)
+		}
+		if d.inReport {
+			d.report.Write(d.line)
+		}
+		d.line = nil
+	}
+	if d.inReport {
+		d.reports = append(d.reports, d.report.String())
+		d.inReport = false
+	}
+	return nil
+}
+
+func (d *raceDetector) processLine(line string) {
+	text := strings.TrimRight(line, "\r\n")
+	if d.inReport && text != raceSeparator {
+		line = rewriteRaceFrame(line)
+	}
+	if d.out != nil {
+		io.WriteString(d.out, line)
+	}
+	switch {
+	case d.inReport:
+		d.report.WriteString(line)
+		if text == raceSeparator {
+			d.reports = append(d.reports, d.report.String())
+			d.inReport = false
+		}
+	case d.afterSep && strings.HasPrefix(text, "WARNING: DATA RACE"):
+		d.inReport = true
+		d.report.Reset()
+		d.report.WriteString(raceSeparator + "\n")
+		d.report.WriteString(line)
+	}
+	d.afterSep = !d.inReport && text == raceSeparator
+}
+
+// raceFrameRe matches a line in a race report with the file name and line
+// number of a stack frame.
+var raceFrameRe = regexp.MustCompile(`^(\s+)(\S+)(:\d+(?: \+0x[0-9a-f]+)?\r?\n?)$`)
+
+// rewriteRaceFrame rewrites the file name in line with raceFramePath, if
+// line is a stack frame.
+func rewriteRaceFrame(line string) string {
+	m := raceFrameRe.FindStringSubmatch(line)
+	if m == nil {
+		return line
+	}
+	return m[1] + raceFramePath(m[2]) + m[3]
+}
+
+// raceFramePath returns a file name recorded in a test binary relative to
+// the workspace. Files are recorded relative to the execution root, so
+// generated files have names like "bazel-out/k8-fastbuild/bin/foo/gen.go";
+// they're shown next to the sources in their package instead. Absolute names
+// in the execution root, for example, from packages built without
+// -trimpath, are made relative. Other names are returned unchanged.
+func raceFramePath(name string) string {
+	p := filepath.ToSlash(name)
+	if i := strings.Index(p, "/execroot/"); i >= 0 {
+		rest := p[i+len("/execroot/"):]
+		j := strings.IndexByte(rest, '/')
+		if j < 0 {
+			return name
+		}
+		p = rest[j+1:]
+	}
+	if parts := strings.SplitN(p, "/", 4); len(parts) == 4 && parts[0] == "bazel-out" && (parts[2] == "bin" || parts[2] == "genfiles") {
+		p = parts[3]
+	}
+	if p == filepath.ToSlash(name) {
+		return name
+	}
+	return p
+}
+
+// raceError is returned by wrap when the race detector reported a data race
+// and the test process didn't fail.
+type raceError struct {
+	count int
+}
+
+func (e *raceError) Error() string {
+	return fmt.Sprintf("the race detector reported %d data race(s)", e.count)
+}
+
+func (e *raceError) ExitCode() int {
+	return raceExitCode
+}
+
+// saveRaceReports writes reports to raceReportFile in the test's undeclared
+// outputs, if there's a directory for them, and returns the path.
+func saveRaceReports(reports []string) (string, error) {
+	outDir := os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR")
+	if outDir == "" {
+		return "", nil
+	}
+	path := filepath.Join(outDir, raceReportFile)
+	data := strings.Join(reports, "\n")
+	if err := ioutil.WriteFile(path, []byte(data), 0666); err != nil {
+		return "", fmt.Errorf("error writing race reports: %v", err)
+	}
+	return path, nil
+}
+
+// addRaceFailure appends test2json events for a failed test case named
+// raceTestName to buf, so data races appear in the XML report even if no test
+// was marked as failed.
+func addRaceFailure(buf *bytes.Buffer, pkg string, reports []string) error {
+	enc := json.NewEncoder(buf)
+	events := []jsonEvent{
+		{Action: "run", Package: pkg, Test: raceTestName},
+		{Action: "output", Package: pkg, Test: raceTestName, Output: strings.Join(reports, "\n")},
+		{Action: "fail", Package: pkg, Test: raceTestName},
+	}
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
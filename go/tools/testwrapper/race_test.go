@@ -0,0 +1,139 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const raceReport = `==================
+WARNING: DATA RACE
+Write at 0x00c000018128 by goroutine 8:
+  example.com/race.TestRace.func1()
+      race_test.go:12 +0x44
+
+Previous write at 0x00c000018128 by goroutine 7:
+  example.com/race.TestRace()
+      race_test.go:14 +0x98
+==================
+`
+
+func TestRaceDetector(t *testing.T) {
+	output := "=== RUN   TestRace\n" + raceReport + "--- FAIL: TestRace (0.00s)\n" +
+		"==================\nnot a race\n" + raceReport + "==================\nWARNING: DATA RACE\ncut off"
+	d := &raceDetector{}
+	// Write in small pieces to check that lines split across writes are
+	// handled.
+	for i := 0; i < len(output); i += 7 {
+		end := i + 7
+		if end > len(output) {
+			end = len(output)
+		}
+		if _, err := d.Write([]byte(output[i:end])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+
+	want := []string{raceReport, raceReport, "==================\nWARNING: DATA RACE\ncut off"}
+	if !reflect.DeepEqual(d.reports, want) {
+		t.Errorf("got reports:\n%s\nwant:\n%s", strings.Join(d.reports, "---\n"), strings.Join(want, "---\n"))
+	}
+}
+
+func TestRaceDetectorNoRaces(t *testing.T) {
+	d := &raceDetector{}
+	fmt.Fprint(d, "==================\nWARNING: something else\n==================\n")
+	d.Close()
+	if len(d.reports) != 0 {
+		t.Errorf("got %d reports; want 0", len(d.reports))
+	}
+}
+
+func TestAddRaceFailure(t *testing.T) {
+	var buf bytes.Buffer
+	if err := addRaceFailure(&buf, "example.com/race", []string{raceReport}); err != nil {
+		t.Fatal(err)
+	}
+	xml, err := json2xml(&buf, "example.com/race")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`failures="1"`, `name="DataRace"`, "WARNING: DATA RACE"} {
+		if !bytes.Contains(xml, []byte(want)) {
+			t.Errorf("report does not contain %q:\n%s", want, xml)
+		}
+	}
+}
+
+func TestRaceFramePath(t *testing.T) {
+	for _, tc := range []struct {
+		name, want string
+	}{
+		{"foo/race_test.go", "foo/race_test.go"},
+		{"bazel-out/k8-fastbuild/bin/foo/gen.go", "foo/gen.go"},
+		{"/home/u/.cache/bazel/_bazel_u/1234/execroot/__main__/foo/race_test.go", "foo/race_test.go"},
+		{"/home/u/.cache/bazel/_bazel_u/1234/execroot/__main__/bazel-out/k8-fastbuild/bin/foo/gen.go", "foo/gen.go"},
+		{"external/repo/bar/bar.go", "external/repo/bar/bar.go"},
+		{"GOROOT/src/sync/mutex.go", "GOROOT/src/sync/mutex.go"},
+	} {
+		if got := raceFramePath(tc.name); got != tc.want {
+			t.Errorf("raceFramePath(%q) = %q; want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRaceDetectorRewritesReports(t *testing.T) {
+	report := `==================
+WARNING: DATA RACE
+Write at 0x00c000018128 by goroutine 8:
+  example.com/race.TestRace.func1()
+      bazel-out/k8-fastbuild/bin/race/gen.go:12 +0x44
+==================
+`
+	want := strings.Replace(report, "bazel-out/k8-fastbuild/bin/", "", 1)
+	other := "    bazel-out/k8-fastbuild/bin/race/gen.go:3\n"
+	var out bytes.Buffer
+	d := &raceDetector{out: &out}
+	fmt.Fprint(d, other+report)
+	d.Close()
+
+	if got := out.String(); got != other+want {
+		t.Errorf("got output:\n%s\nwant:\n%s", got, other+want)
+	}
+	if len(d.reports) != 1 || d.reports[0] != want {
+		t.Errorf("got reports:\n%s\nwant:\n%s", strings.Join(d.reports, "---\n"), want)
+	}
+}
+
+func TestRaceDetectorCopiesOtherOutput(t *testing.T) {
+	for _, output := range []string{
+		"no newline",
+		"==================\nWARNING: DATA RACE\n      bazel-out/k8-fastbuild/bin/race/gen.go:12",
+		"==================\nWARNING: DATA RACE\n==================\n    bazel-out/k8-fastbuild/bin/race/gen.go:3\n",
+	} {
+		var out bytes.Buffer
+		d := &raceDetector{out: &out}
+		fmt.Fprint(d, output)
+		d.Close()
+		if got := out.String(); got != output {
+			t.Errorf("got output %q; want %q", got, output)
+		}
+	}
+}
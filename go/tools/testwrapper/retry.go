@@ -0,0 +1,154 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// retriesEnv may be set to the number of times failed tests are rerun. If
+// set, it overrides the go_test's retries attribute.
+const retriesEnv = "GO_TEST_RETRIES"
+
+// testRetries returns the number of times failed tests should be rerun,
+// from retriesEnv if it's set, or def otherwise.
+func testRetries(def int) (int, error) {
+	s, ok := os.LookupEnv(retriesEnv)
+	if !ok || s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid value for %s: %q", retriesEnv, s)
+	}
+	return n, nil
+}
+
+// failedTests returns the names of the top-level tests and examples that
+// failed according to the test2json events in data, in the order they
+// finished. complete is false if a test started but didn't finish, for
+// example, because it called os.Exit. Rerunning only the failed tests isn't
+// safe then, since some tests may not have run at all.
+func failedTests(data []byte) (failed []string, complete bool, err error) {
+	var events []jsonEvent
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var e jsonEvent
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, false, fmt.Errorf("error decoding test2json output: %v", err)
+		}
+		events = append(events, e)
+	}
+
+	// The last event is the result for the whole package. The converter
+	// attributes it to the test that was running when output ended, which
+	// would make a test that never finished look like it passed.
+	if len(events) > 0 {
+		events = events[:len(events)-1]
+	}
+	states := make(map[string]string)
+	var order []string
+	for _, e := range events {
+		if e.Test == "" || strings.Contains(e.Test, "/") {
+			continue
+		}
+		switch e.Action {
+		case "run", "pass", "skip":
+			states[e.Test] = e.Action
+		case "fail":
+			states[e.Test] = e.Action
+			order = append(order, e.Test)
+		}
+	}
+	complete = true
+	for _, state := range states {
+		if state == "run" {
+			complete = false
+		}
+	}
+	for _, name := range order {
+		if states[name] == "fail" {
+			failed = append(failed, name)
+		}
+	}
+	return failed, complete, nil
+}
+
+// retryRunPattern returns a -test.run pattern that matches exactly the
+// named tests and examples.
+func retryRunPattern(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+	return "^(" + strings.Join(quoted, "|") + ")$"
+}
+
+// retryFailedTests reruns the tests that failed in a run of the test binary
+// with args and env, up to retries times, until they pass. err is the error
+// from that run. jsonBuffer holds the run's test2json events; events from
+// retries are appended, so the report shows the output of every attempt and
+// the result of the last. Only runs where the test binary exited with status
+// 1 after every test finished are retried; crashes, timeouts, and failures
+// outside of tests are not. retryFailedTests returns the error from the last
+// attempt. Events from retries are also written to events. Each attempt
+// writes its coverage profile to a new file from coverage, so counters from
+// earlier attempts are kept.
+func retryFailedTests(pkg string, args, env []string, jsonBuffer *bytes.Buffer, events *eventStream, races *raceDetector, coverage *coverageCollector, retries int, err error) error {
+	start := 0
+	var retried []string
+	for attempt := 1; attempt <= retries; attempt++ {
+		xerr, ok := err.(*exec.ExitError)
+		if !ok || xerr.ExitCode() != 1 || len(races.reports) > 0 {
+			break
+		}
+		failed, complete, ferr := failedTests(jsonBuffer.Bytes()[start:])
+		if ferr != nil {
+			return ferr
+		}
+		if !complete || len(failed) == 0 {
+			break
+		}
+		if retried == nil {
+			retried = failed
+		}
+		fmt.Fprintf(os.Stderr, "retrying failed tests (attempt %d of %d): %s\n", attempt, retries, strings.Join(failed, " "))
+
+		start = jsonBuffer.Len()
+		jsonConverter := NewConverter(events.writer(jsonBuffer), pkg, Timestamp)
+		retryArgs := append(args[:len(args):len(args)], "-test.run="+retryRunPattern(failed))
+		cmd := exec.Command(os.Args[0], retryArgs...)
+		cmd.Env = coverage.env(env)
+		cmd.Stderr = races
+		cmd.Stdout = io.MultiWriter(os.Stdout, jsonConverter)
+		err = runTest(cmd)
+		jsonConverter.Close()
+		races.Close()
+	}
+	if err == nil && len(retried) > 0 {
+		fmt.Fprintf(os.Stderr, "failed tests passed when retried: %s\n", strings.Join(retried, " "))
+	}
+	return err
+}
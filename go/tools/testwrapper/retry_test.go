@@ -0,0 +1,126 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func convertOutput(t *testing.T, output string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	c := NewConverter(&buf, "example.com/retry", 0)
+	if _, err := c.Write([]byte(output)); err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	return buf.Bytes()
+}
+
+func TestFailedTests(t *testing.T) {
+	for _, tc := range []struct {
+		desc, output string
+		failed       []string
+		complete     bool
+	}{
+		{
+			desc: "pass",
+			output: `=== RUN   TestA
+--- PASS: TestA (0.00s)
+PASS
+`,
+			complete: true,
+		},
+		{
+			desc: "fail",
+			output: `=== RUN   TestA
+--- FAIL: TestA (0.00s)
+=== RUN   TestB
+=== RUN   TestB/sub
+--- FAIL: TestB (0.00s)
+    --- FAIL: TestB/sub (0.00s)
+=== RUN   TestC
+--- PASS: TestC (0.00s)
+=== RUN   ExampleD
+--- FAIL: ExampleD (0.00s)
+got:
+1
+want:
+2
+FAIL
+`,
+			failed:   []string{"TestA", "TestB", "ExampleD"},
+			complete: true,
+		},
+		{
+			desc: "exit",
+			output: `=== RUN   TestA
+--- FAIL: TestA (0.00s)
+=== RUN   TestB
+exit status 1
+`,
+			failed: []string{"TestA"},
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			failed, complete, err := failedTests(convertOutput(t, tc.output))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(failed, tc.failed) {
+				t.Errorf("got failed tests %q; want %q", failed, tc.failed)
+			}
+			if complete != tc.complete {
+				t.Errorf("got complete %v; want %v", complete, tc.complete)
+			}
+		})
+	}
+}
+
+func TestRetryRunPattern(t *testing.T) {
+	re := regexp.MustCompile(retryRunPattern([]string{"TestA", "ExampleB_c"}))
+	for name, want := range map[string]bool{
+		"TestA":       true,
+		"ExampleB_c":  true,
+		"TestAB":      false,
+		"XTestA":      false,
+		"ExampleB":    false,
+		"TestA|TestB": false,
+	} {
+		if got := re.MatchString(name); got != want {
+			t.Errorf("%q matched %q: got %v; want %v", re, name, got, want)
+		}
+	}
+}
+
+func TestTestRetries(t *testing.T) {
+	defer os.Unsetenv(retriesEnv)
+	os.Unsetenv(retriesEnv)
+	if n, err := testRetries(2); err != nil || n != 2 {
+		t.Errorf("got %d, %v; want 2, <nil>", n, err)
+	}
+	os.Setenv(retriesEnv, "0")
+	if n, err := testRetries(2); err != nil || n != 0 {
+		t.Errorf("got %d, %v; want 0, <nil>", n, err)
+	}
+	os.Setenv(retriesEnv, "-1")
+	if _, err := testRetries(2); err == nil {
+		t.Error("got no error for negative retries")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// shardPluginEnv names an executable that chooses which tests run in the
+// current shard, for example, by asking an external test distribution
+// service. The wrapper writes the names of all tests to the plugin's
+// standard input, one per line, and the plugin writes the names it chose to
+// standard output the same way. Examples aren't sharded. The plugin
+// inherits the test's environment, including TEST_TARGET, TEST_SHARD_INDEX,
+// and TEST_TOTAL_SHARDS, and GO_TEST_PACKAGE is set to the import path of
+// the package being tested.
+const shardPluginEnv = "GO_TEST_SHARD_PLUGIN"
+
+// shardSelectionEnv is set by the wrapper to the name of a file listing the
+// tests chosen by the shard plugin, one per line.
+const shardSelectionEnv = "GO_TEST_SHARD_SELECTION"
+
+// queryShardPlugin runs the shard plugin named by shardPluginEnv and returns
+// the names it chose from names. pkg is the import path of the package being
+// tested. queryShardPlugin returns false if no plugin is configured.
+func queryShardPlugin(pkg string, names []string) ([]string, bool, error) {
+	plugin := os.Getenv(shardPluginEnv)
+	if plugin == "" {
+		return nil, false, nil
+	}
+	cmd := exec.Command(plugin)
+	cmd.Env = append(os.Environ(), "GO_TEST_PACKAGE="+pkg)
+	cmd.Stdin = strings.NewReader(strings.Join(names, "\n") + "\n")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, false, fmt.Errorf("shard plugin %s failed: %v", plugin, err)
+	}
+
+	known := make(map[string]bool)
+	for _, name := range names {
+		known[name] = true
+	}
+	var selected []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" {
+			continue
+		}
+		if !known[name] {
+			return nil, false, fmt.Errorf("shard plugin %s selected unknown test %q", plugin, name)
+		}
+		selected = append(selected, name)
+	}
+	return selected, true, scanner.Err()
+}
+
+// writeShardSelection writes the names chosen by the shard plugin to a
+// temporary file and returns its name.
+func writeShardSelection(selected []string) (string, error) {
+	f, err := ioutil.TempFile(os.Getenv("TEST_TMPDIR"), "shard_selection")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.WriteString(strings.Join(selected, "\n"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// readShardSelection reads the names of tests chosen by the shard plugin
+// from the file written by the wrapper. It returns nil if no plugin was used,
+// in which case tests are split across shards by index.
+func readShardSelection() (map[string]bool, error) {
+	path := os.Getenv(shardSelectionEnv)
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading shard selection: %v", err)
+	}
+	selection := make(map[string]bool)
+	for _, name := range strings.Split(string(data), "\n") {
+		if name != "" {
+			selection[name] = true
+		}
+	}
+	return selection, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestShardPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("test plugins are shell scripts")
+	}
+	dir, err := ioutil.TempDir(os.Getenv("TEST_TMPDIR"), "shard_plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writePlugin := func(name, script string) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0777); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	defer os.Unsetenv(shardPluginEnv)
+	names := []string{"TestA", "TestB", "ExampleC"}
+
+	os.Unsetenv(shardPluginEnv)
+	if _, ok, err := queryShardPlugin("example.com/p", names); ok || err != nil {
+		t.Errorf("without a plugin: got %v, %v; want false, nil", ok, err)
+	}
+
+	os.Setenv(shardPluginEnv, writePlugin("select", `[ "$GO_TEST_PACKAGE" = example.com/p ] || exit 1
+grep -v TestB
+`))
+	selected, ok, err := queryShardPlugin("example.com/p", names)
+	if err != nil || !ok {
+		t.Fatalf("got %v, %v; want true, nil", ok, err)
+	}
+	if want := []string{"TestA", "ExampleC"}; !reflect.DeepEqual(selected, want) {
+		t.Errorf("got %q; want %q", selected, want)
+	}
+
+	path, err := writeShardSelection(selected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+	os.Setenv(shardSelectionEnv, path)
+	defer os.Unsetenv(shardSelectionEnv)
+	selection, err := readShardSelection()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]bool{"TestA": true, "ExampleC": true}; !reflect.DeepEqual(selection, want) {
+		t.Errorf("got selection %v; want %v", selection, want)
+	}
+
+	os.Setenv(shardPluginEnv, writePlugin("unknown", "echo TestD\n"))
+	if _, _, err := queryShardPlugin("example.com/p", names); err == nil {
+		t.Error("plugin selecting an unknown test: got success; want error")
+	}
+
+	os.Setenv(shardPluginEnv, writePlugin("fail", "exit 1\n"))
+	if _, _, err := queryShardPlugin("example.com/p", names); err == nil {
+		t.Error("failing plugin: got success; want error")
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// shardTimingsEnv names a file with the durations of tests and examples from
+// earlier runs. If set, it overrides the go_test's shard_timings attribute.
+// Relative paths are relative to the test's runfiles directory.
+const shardTimingsEnv = "GO_TEST_SHARD_TIMINGS"
+
+// shardTimingsFile is the name of the file in a sharded test's undeclared
+// outputs where the wrapper records how long each test and example took.
+// Files from all shards may be concatenated to form a timings file for later
+// runs.
+const shardTimingsFile = "shard_timings.txt"
+
+// minShardDuration is the duration, in seconds, assumed for tests that took
+// no measurable time, so they're still spread across shards.
+const minShardDuration = 0.001
+
+// touchShardStatusFile creates the file named by TEST_SHARD_STATUS_FILE, if
+// it's set. This tells Bazel the test supports sharding. Tests that don't
+// create the file fail with --incompatible_check_sharding_support.
+func touchShardStatusFile() error {
+	path := os.Getenv("TEST_SHARD_STATUS_FILE")
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("error creating shard status file: %v", err)
+	}
+	return f.Close()
+}
+
+// shardInfo returns the number of shards and the index of the current shard
+// from the environment. total is 1 if the test isn't sharded.
+func shardInfo() (total, index int) {
+	total, err := strconv.Atoi(os.Getenv("TEST_TOTAL_SHARDS"))
+	if err != nil || total <= 1 {
+		return 1, 0
+	}
+	index, err = strconv.Atoi(os.Getenv("TEST_SHARD_INDEX"))
+	if err != nil || index < 0 || index >= total {
+		return 1, 0
+	}
+	return total, index
+}
+
+// readShardTimings parses a timings file. Each line has the name of a test
+// or example and its duration in seconds, separated by white space. Blank
+// lines and lines starting with '#' are ignored. If a name appears more than
+// once, the last duration is used.
+func readShardTimings(r io.Reader) (map[string]float64, error) {
+	timings := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want a test name and a duration", line)
+		}
+		d, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("line %d: invalid duration %q", line, fields[1])
+		}
+		timings[fields[0]] = d
+	}
+	return timings, scanner.Err()
+}
+
+// balanceShards chooses which of names run in shard index of total, so the
+// shards take about the same time according to timings. Tests without a
+// timing are assumed to take the average time of those with one. Every
+// shard computes the same assignment, so each test runs exactly once.
+func balanceShards(names []string, timings map[string]float64, total, index int) map[string]bool {
+	sum, n := 0.0, 0
+	for _, name := range names {
+		if d, ok := timings[name]; ok {
+			sum += d
+			n++
+		}
+	}
+	defaultDuration := 1.0
+	if n > 0 {
+		defaultDuration = sum / float64(n)
+	}
+	durations := make([]float64, len(names))
+	order := make([]int, len(names))
+	for i, name := range names {
+		d, ok := timings[name]
+		if !ok {
+			d = defaultDuration
+		}
+		if d < minShardDuration {
+			d = minShardDuration
+		}
+		durations[i] = d
+		order[i] = i
+	}
+
+	// Assign the longest tests first, each to the shard with the least work
+	// so far. Ties are broken by position, so the result is deterministic.
+	sort.SliceStable(order, func(i, j int) bool {
+		return durations[order[i]] > durations[order[j]]
+	})
+	loads := make([]float64, total)
+	selection := make(map[string]bool)
+	for _, i := range order {
+		shard := 0
+		for s := 1; s < total; s++ {
+			if loads[s] < loads[shard] {
+				shard = s
+			}
+		}
+		loads[shard] += durations[i]
+		if shard == index {
+			selection[names[i]] = true
+		}
+	}
+	return selection
+}
+
+// timedShardSelection chooses the tests to run in the current shard using
+// the timings file named by shardTimingsEnv, or path if that's not set. It
+// returns nil if the test isn't sharded or there's no timings file, in which
+// case tests are split across shards by index.
+func timedShardSelection(names []string, path string) (map[string]bool, error) {
+	total, index := shardInfo()
+	if total <= 1 {
+		return nil, nil
+	}
+	if env := os.Getenv(shardTimingsEnv); env != "" {
+		path = env
+	}
+	if path == "" {
+		return nil, nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(os.Getenv("TEST_SRCDIR"), os.Getenv("TEST_WORKSPACE"), path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading shard timings: %v", err)
+	}
+	defer f.Close()
+	timings, err := readShardTimings(f)
+	if err != nil {
+		return nil, fmt.Errorf("error reading shard timings from %s: %v", path, err)
+	}
+	return balanceShards(names, timings, total, index), nil
+}
+
+// shouldRecordShardTimings reports whether the wrapper should write the
+// durations of tests to shardTimingsFile. This is only done for sharded
+// tests.
+func shouldRecordShardTimings() bool {
+	total, _ := shardInfo()
+	return total > 1 && os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR") != ""
+}
+
+// saveShardTimings writes the durations of the top-level tests and examples
+// reported in the test2json events in data to shardTimingsFile in the test's
+// undeclared outputs.
+func saveShardTimings(data []byte) error {
+	var buf bytes.Buffer
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var e jsonEvent
+		if err := dec.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error decoding test2json output: %v", err)
+		}
+		if (e.Action != "pass" && e.Action != "fail") || e.Test == "" || strings.Contains(e.Test, "/") || e.Elapsed == nil {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s %s\n", e.Test, strconv.FormatFloat(*e.Elapsed, 'f', -1, 64))
+	}
+	path := filepath.Join(os.Getenv("TEST_UNDECLARED_OUTPUTS_DIR"), shardTimingsFile)
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0666); err != nil {
+		return fmt.Errorf("error writing shard timings: %v", err)
+	}
+	return nil
+}
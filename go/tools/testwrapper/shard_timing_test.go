@@ -0,0 +1,123 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadShardTimings(t *testing.T) {
+	timings, err := readShardTimings(strings.NewReader(`
+# from shard 1
+TestA 1.5
+ExampleB	0
+TestA 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]float64{"TestA": 2, "ExampleB": 0}; !reflect.DeepEqual(timings, want) {
+		t.Errorf("got %v; want %v", timings, want)
+	}
+
+	for _, bad := range []string{"TestA\n", "TestA 1 2\n", "TestA x\n", "TestA -1\n"} {
+		if _, err := readShardTimings(strings.NewReader(bad)); err == nil {
+			t.Errorf("readShardTimings(%q): got success; want error", bad)
+		}
+	}
+}
+
+func TestBalanceShards(t *testing.T) {
+	names := []string{"TestSlow", "TestA", "TestB", "TestC", "TestD", "TestNew"}
+	timings := map[string]float64{
+		"TestSlow": 8,
+		"TestA":    2,
+		"TestB":    2,
+		"TestC":    2,
+		"TestD":    2,
+	}
+	// TestNew has no timing, so it's assumed to take the average, 3.2s.
+	want := []map[string]bool{
+		{"TestSlow": true, "TestD": true},
+		{"TestNew": true, "TestA": true, "TestB": true, "TestC": true},
+	}
+	for i := range want {
+		if got := balanceShards(names, timings, len(want), i); !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("shard %d: got %v; want %v", i, got, want[i])
+		}
+	}
+
+	// Without timings, every test should still run exactly once.
+	seen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		for name := range balanceShards(names, nil, 4, i) {
+			seen[name]++
+		}
+	}
+	for _, name := range names {
+		if seen[name] != 1 {
+			t.Errorf("%s ran in %d shards; want 1", name, seen[name])
+		}
+	}
+}
+
+func TestSaveShardTimings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSaveShardTimings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("TEST_UNDECLARED_OUTPUTS_DIR", dir)
+	defer os.Unsetenv("TEST_UNDECLARED_OUTPUTS_DIR")
+
+	events := `{"Action":"run","Test":"TestA"}
+{"Action":"pass","Test":"TestA/sub","Elapsed":0.5}
+{"Action":"pass","Test":"TestA","Elapsed":1.25}
+{"Action":"fail","Test":"ExampleB","Elapsed":0}
+{"Action":"pass","Elapsed":3}
+`
+	if err := saveShardTimings([]byte(events)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, shardTimingsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "TestA 1.25\nExampleB 0\n"; string(data) != want {
+		t.Errorf("got %q; want %q", data, want)
+	}
+}
+
+func TestTouchShardStatusFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestTouchShardStatusFile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "status")
+	os.Setenv("TEST_SHARD_STATUS_FILE", path)
+	defer os.Unsetenv("TEST_SHARD_STATUS_FILE")
+	if err := touchShardStatusFile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// terminationGracePeriod is how long the test may take to print its
+// goroutines and exit after the wrapper is terminated before it's killed.
+// Bazel waits --local_termination_grace_seconds, 15 by default, before
+// killing the wrapper, which leaves time to write the report.
+var terminationGracePeriod = 5 * time.Second
+
+// runTest runs the test binary in cmd and waits for it to exit.
+//
+// When a test times out, Bazel sends SIGTERM to the test's process group.
+// The Go runtime exits on SIGTERM without saying what the test was doing,
+// so on Linux, the test runs in its own process group, and when the wrapper
+// receives SIGTERM, it sends SIGQUIT to the test instead. That makes the runtime print
+// the stacks of all goroutines to stderr, which ends up in the test log, and
+// exit. If the test is still running after terminationGracePeriod, it's
+// killed. Interrupts are forwarded to the test as they are. Processes the
+// test started and left running are killed when it exits, as Bazel would
+// if they were in its process group.
+func runTest(cmd *exec.Cmd) error {
+	setTestProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p := cmd.Process
+	defer killTestProcessGroup(p)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(sigs)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		var kill *time.Timer
+		for {
+			select {
+			case <-done:
+				if kill != nil {
+					kill.Stop()
+				}
+				return
+			case sig := <-sigs:
+				if sig != syscall.SIGTERM {
+					p.Signal(sig)
+					continue
+				}
+				if kill != nil {
+					continue
+				}
+				if err := quitTest(p); err != nil {
+					fmt.Fprintf(os.Stderr, "test terminated; could not print goroutines: %v\n", err)
+					killTestProcessGroup(p)
+					continue
+				}
+				fmt.Fprintf(os.Stderr, "test terminated, possibly because it timed out; sent SIGQUIT to print goroutines\n")
+				kill = time.AfterFunc(terminationGracePeriod, func() { killTestProcessGroup(p) })
+			}
+		}
+	}()
+	return cmd.Wait()
+}
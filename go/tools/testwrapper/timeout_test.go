@@ -0,0 +1,106 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// terminateOnReady sends SIGTERM to the current process, as Bazel would on a
+// timeout, when the test process prints "ready".
+type terminateOnReady struct {
+	t    *testing.T
+	once sync.Once
+}
+
+func (w *terminateOnReady) Write(p []byte) (int, error) {
+	if bytes.Contains(p, []byte("ready")) {
+		w.once.Do(func() {
+			self, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				w.t.Error(err)
+				return
+			}
+			if err := self.Signal(syscall.SIGTERM); err != nil {
+				w.t.Error(err)
+			}
+		})
+	}
+	return len(p), nil
+}
+
+func runTerminatedTest(t *testing.T, script string) (string, error) {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("tests are only run in their own process group on Linux")
+	}
+	// Keep SIGTERM from killing this process if it arrives before runTest
+	// starts handling it.
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	cmd := exec.Command("/bin/sh", "-c", script)
+	var stderr bytes.Buffer
+	cmd.Stdout = &terminateOnReady{t: t}
+	cmd.Stderr = &stderr
+	err := runTest(cmd)
+	return stderr.String(), err
+}
+
+func TestRunTestQuitsOnTerminate(t *testing.T) {
+	start := time.Now()
+	stderr, err := runTerminatedTest(t, `
+trap 'echo "SIGQUIT: quit" >&2; exit 2' QUIT
+echo ready
+while :; do sleep 0.1; done
+`)
+	if xerr, ok := err.(*exec.ExitError); !ok || xerr.ExitCode() != 2 {
+		t.Errorf("got error %v; want exit status 2", err)
+	}
+	if !strings.Contains(stderr, "SIGQUIT: quit") {
+		t.Errorf("test did not receive SIGQUIT; stderr:\n%s", stderr)
+	}
+	if d := time.Since(start); d >= terminationGracePeriod {
+		t.Errorf("test took %v to exit; want less than the grace period", d)
+	}
+}
+
+func TestRunTestKillsAfterGracePeriod(t *testing.T) {
+	defer func(d time.Duration) { terminationGracePeriod = d }(terminationGracePeriod)
+	terminationGracePeriod = 100 * time.Millisecond
+
+	_, err := runTerminatedTest(t, `
+trap '' QUIT
+echo ready
+while :; do sleep 0.1; done
+`)
+	xerr, ok := err.(*exec.ExitError)
+	if !ok {
+		t.Fatalf("got error %v; want the test to be killed", err)
+	}
+	if ws, ok := xerr.Sys().(syscall.WaitStatus); !ok || !ws.Signaled() || ws.Signal() != syscall.SIGKILL {
+		t.Errorf("got %v; want the test to be killed", err)
+	}
+}
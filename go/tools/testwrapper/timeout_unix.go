@@ -0,0 +1,39 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !windows && !wasm && !wasip1
+// +build !linux,!windows,!wasm,!wasip1
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Without Linux's parent death signal, a test in its own process group would
+// outlive a wrapper Bazel kills, so the test stays in Bazel's group. Bazel's
+// SIGTERM reaches it directly, and the runtime exits before the wrapper can
+// ask it to print its goroutines.
+
+func setTestProcessGroup(cmd *exec.Cmd) {}
+
+func quitTest(p *os.Process) error {
+	return errors.New("only supported on Linux")
+}
+
+func killTestProcessGroup(p *os.Process) {
+	p.Kill()
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Windows has no process groups Bazel signals, and no way to make a Go
+// program print its goroutines from outside, so the test is just killed.
+
+func setTestProcessGroup(cmd *exec.Cmd) {}
+
+func quitTest(p *os.Process) error {
+	return errors.New("not supported on Windows")
+}
+
+func killTestProcessGroup(p *os.Process) {
+	p.Kill()
+}
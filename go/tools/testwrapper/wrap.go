@@ -44,7 +44,9 @@ func shouldWrap() bool {
 
 // shouldAddTestV indicates if the test wrapper should prepend a -test.v flag to
 // the test args. This is required to get information about passing tests from
-// test2json for complete XML reports.
+// test2json for complete XML reports, so it's done by default when a report is
+// written. GO_TEST_WRAP_TESTV=0 keeps the test log short instead, at the cost
+// of passing tests and subtests missing from the report.
 func shouldAddTestV() bool {
 	if wrapEnv, ok := os.LookupEnv("GO_TEST_WRAP_TESTV"); ok {
 		wrap, err := strconv.ParseBool(wrapEnv)
@@ -53,23 +55,140 @@ func shouldAddTestV() bool {
 		}
 		return wrap
 	}
-	return false
+	_, ok := os.LookupEnv("XML_OUTPUT_FILE")
+	return ok
+}
+
+// exitCoder is implemented by errors returned by wrap that carry the status
+// the test should exit with.
+type exitCoder interface {
+	ExitCode() int
 }
 
-func wrap(pkg string) error {
+// wrap runs the test binary again in a child process and converts its output
+// to a report. Reports from the race detector are saved separately. names
+// lists the tests in the binary, which are passed to the shard plugin, if
+// there is one. runDir is the directory the test runs in, relative
+// to the workspace root; it's copied when fuzzing. If benchmark is true, the
+// binary was built by go_benchmark, and its output is also saved to
+// benchmarkResultsFile. Tests that fail are rerun up to retries times. If
+// the test still fails, failureHook is run; see runFailureHook.
+func wrap(pkg string, names []string, runDir string, benchmark bool, retries int, failureHook string) (err error) {
+	events, err := newEventStream()
+	if err != nil {
+		return err
+	}
+	defer events.Close()
 	var jsonBuffer bytes.Buffer
-	jsonConverter := NewConverter(&jsonBuffer, pkg, Timestamp)
+	jsonConverter := NewConverter(events.writer(&jsonBuffer), pkg, Timestamp)
 
 	args := os.Args[1:]
-	if shouldAddTestV() {
+	retries, err = testRetries(retries)
+	if err != nil {
+		return err
+	}
+	if benchmark || fuzzing() {
+		retries = 0
+	}
+	recordTimings := shouldRecordShardTimings()
+	if shouldAddTestV() || recordTimings || retries > 0 || events != nil {
+		// test2json only reports how long passing tests took with -test.v.
+		// Without it, tests that started but never finished can't be found
+		// before retrying, and streamed events couldn't show when each test
+		// starts.
 		args = append([]string{"-test.v"}, args...)
 	}
+	env := append(os.Environ(), "GO_TEST_WRAP=0")
+	fuzzDone := func() error { return nil }
+	if fuzzing() {
+		args, env, fuzzDone, err = setupFuzzing(runDir, args, env)
+		if err != nil {
+			return err
+		}
+	}
+	coverage, err := newCoverageCollector()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Run the hook last, so it sees the report and saved outputs.
+		if _, ok := err.(exitCoder); ok {
+			runFailureHook(pkg, failureHook)
+		}
+	}()
 	cmd := exec.Command(os.Args[0], args...)
-	cmd.Env = append(os.Environ(), "GO_TEST_WRAP=0")
-	cmd.Stderr = os.Stderr
+	cmd.Env = env
+	if selected, ok, err := queryShardPlugin(pkg, names); err != nil {
+		return err
+	} else if ok {
+		path, err := writeShardSelection(selected)
+		if err != nil {
+			return fmt.Errorf("error writing shard selection: %v", err)
+		}
+		defer os.Remove(path)
+		cmd.Env = append(cmd.Env, shardSelectionEnv+"="+path)
+	}
+	races := &raceDetector{out: os.Stderr}
+	cmd.Stderr = races
 	cmd.Stdout = io.MultiWriter(os.Stdout, jsonConverter)
-	err := cmd.Run()
+	var results io.WriteCloser
+	if benchmark {
+		if results, err = createBenchmarkResults(); err != nil {
+			return err
+		} else if results != nil {
+			cmd.Stdout = io.MultiWriter(cmd.Stdout, results)
+		}
+	}
+	baseEnv := cmd.Env
+	cmd.Env = coverage.env(baseEnv)
+	err = runTest(cmd)
 	jsonConverter.Close()
+	races.Close()
+	if retries > 0 {
+		err = retryFailedTests(pkg, args, baseEnv, &jsonBuffer, events, races, coverage, retries, err)
+	}
+	if cerr := coverage.finish(); cerr != nil {
+		return cerr
+	}
+	if results != nil {
+		if cerr := results.Close(); cerr != nil {
+			if err == nil {
+				err = fmt.Errorf("error writing benchmark results: %v", cerr)
+			}
+		} else {
+			fmt.Fprintf(os.Stderr, "benchmark results were written to %s\n", benchmarkResultsFile)
+		}
+	}
+	if len(races.reports) > 0 {
+		// The process may exit successfully after a race if TestMain ignores
+		// the result of m.Run or GORACE sets exitcode=0, so the wrapper fails
+		// the test itself.
+		path, rerr := saveRaceReports(races.reports)
+		if rerr != nil {
+			return rerr
+		}
+		if path != "" {
+			fmt.Fprintf(os.Stderr, "race reports were written to %s\n", raceReportFile)
+		}
+		if rerr := addRaceFailure(&jsonBuffer, pkg, races.reports); rerr != nil {
+			return rerr
+		}
+		if err == nil {
+			err = &raceError{count: len(races.reports)}
+			fmt.Fprintln(os.Stderr, err)
+		}
+	}
+	if recordTimings {
+		if terr := saveShardTimings(jsonBuffer.Bytes()); terr != nil {
+			return terr
+		}
+	}
+	if ferr := fuzzDone(); ferr != nil {
+		if err != nil {
+			return fmt.Errorf("%s (error wrapping test execution: %s)", ferr, err)
+		}
+		return ferr
+	}
 	if out, ok := os.LookupEnv("XML_OUTPUT_FILE"); ok {
 		werr := writeReport(jsonBuffer, pkg, out)
 		if werr != nil {
@@ -39,6 +39,8 @@ type xmlTestSuite struct {
 	Tests     int           `xml:"tests,attr"`
 	Time      string        `xml:"time,attr"`
 	Name      string        `xml:"name,attr"`
+	Timestamp string        `xml:"timestamp,attr,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
 }
 
 type xmlTestCase struct {
@@ -49,6 +51,7 @@ type xmlTestCase struct {
 	Failure   *xmlMessage `xml:"failure,omitempty"`
 	Error     *xmlMessage `xml:"error,omitempty"`
 	Skipped   *xmlMessage `xml:"skipped,omitempty"`
+	SystemOut string      `xml:"system-out,omitempty"`
 }
 
 type xmlMessage struct {
@@ -73,10 +76,20 @@ type testCase struct {
 	duration *float64
 }
 
+// testSuite holds results for the package that aren't specific to a test.
+type testSuite struct {
+	duration *float64
+	start    *time.Time
+	output   strings.Builder
+}
+
 // json2xml converts test2json's output into an xml output readable by Bazel.
+// There is one testcase element for each test, subtest, and example, with its
+// duration and output. Output written outside of tests, for example, by
+// TestMain, is recorded in the testsuite's system-out element.
 // http://windyroad.com.au/dl/Open%20Source/JUnit.xsd
 func json2xml(r io.Reader, pkgName string) ([]byte, error) {
-	var pkgDuration *float64
+	var suite testSuite
 	testcases := make(map[string]*testCase)
 	testCaseByName := func(name string) *testCase {
 		if name == "" {
@@ -96,6 +109,9 @@ func json2xml(r io.Reader, pkgName string) ([]byte, error) {
 		} else if err != nil {
 			return nil, fmt.Errorf("error decoding test2json output: %s", err)
 		}
+		if suite.start == nil && e.Time != nil {
+			suite.start = e.Time
+		}
 		switch s := e.Action; s {
 		case "run":
 			if c := testCaseByName(e.Test); c != nil {
@@ -104,6 +120,8 @@ func json2xml(r io.Reader, pkgName string) ([]byte, error) {
 		case "output":
 			if c := testCaseByName(e.Test); c != nil {
 				c.output.WriteString(e.Output)
+			} else {
+				suite.output.WriteString(e.Output)
 			}
 		case "skip":
 			if c := testCaseByName(e.Test); c != nil {
@@ -116,32 +134,36 @@ func json2xml(r io.Reader, pkgName string) ([]byte, error) {
 				c.state = s
 				c.duration = e.Elapsed
 			} else {
-				pkgDuration = e.Elapsed
+				suite.duration = e.Elapsed
 			}
 		case "pass":
 			if c := testCaseByName(e.Test); c != nil {
 				c.duration = e.Elapsed
 				c.state = s
 			} else {
-				pkgDuration = e.Elapsed
+				suite.duration = e.Elapsed
 			}
 		}
 	}
 
-	return xml.MarshalIndent(toXML(pkgName, pkgDuration, testcases), "", "\t")
+	return xml.MarshalIndent(toXML(pkgName, &suite, testcases), "", "\t")
 }
 
-func toXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase) *xmlTestSuites {
+func toXML(pkgName string, ts *testSuite, testcases map[string]*testCase) *xmlTestSuites {
 	cases := make([]string, 0, len(testcases))
 	for k := range testcases {
 		cases = append(cases, k)
 	}
 	sort.Strings(cases)
 	suite := xmlTestSuite{
-		Name: pkgName,
+		Name:      pkgName,
+		SystemOut: ts.output.String(),
 	}
-	if pkgDuration != nil {
-		suite.Time = fmt.Sprintf("%.3f", *pkgDuration)
+	if ts.duration != nil {
+		suite.Time = fmt.Sprintf("%.3f", *ts.duration)
+	}
+	if ts.start != nil {
+		suite.Timestamp = ts.start.UTC().Format("2006-01-02T15:04:05")
 	}
 	for _, name := range cases {
 		c := testcases[name]
@@ -157,17 +179,21 @@ func toXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase)
 		case "skip":
 			suite.Skipped++
 			newCase.Skipped = &xmlMessage{
-				Message:  "Skipped",
+				Message:  testMessage(c.output.String(), true, "Skipped"),
 				Contents: c.output.String(),
 			}
 		case "fail":
 			suite.Failures++
 			newCase.Failure = &xmlMessage{
-				Message:  "Failed",
+				Message:  testMessage(c.output.String(), false, "Failed"),
 				Contents: c.output.String(),
 			}
 		case "pass":
-			break
+			// Output of passing tests is only kept if they logged something
+			// besides the lines marking their start and end.
+			if testMessage(c.output.String(), false, "") != "" {
+				newCase.SystemOut = c.output.String()
+			}
 		default:
 			suite.Errors++
 			newCase.Error = &xmlMessage{
@@ -179,3 +205,23 @@ func toXML(pkgName string, pkgDuration *float64, testcases map[string]*testCase)
 	}
 	return &xmlTestSuites{Suites: []xmlTestSuite{suite}}
 }
+
+// testMessage returns a line logged by a test, such as the reason it failed or
+// was skipped, to summarize its result. Lines written by the testing package
+// to mark the start and end of tests are ignored. If last is true, the last
+// line is returned, otherwise the first is. def is returned if the test didn't
+// log anything.
+func testMessage(output string, last bool, def string) string {
+	msg := def
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "=== ") || strings.HasPrefix(line, "--- ") {
+			continue
+		}
+		msg = line
+		if !last {
+			break
+		}
+	}
+	return msg
+}
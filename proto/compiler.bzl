@@ -28,7 +28,15 @@ load(
 
 GoProtoCompiler = provider()
 
-def go_proto_compile(go, compiler, protos, imports, importpath):
+GoProtoImportRemaps = provider(
+    doc = "Go import paths to use for proto files, for every go_proto_compiler",
+    fields = {
+        "remaps": "List of proto=importpath strings",
+        "deps": "Go libraries providing the remapped import paths",
+    },
+)
+
+def go_proto_compile(go, compiler, protos, imports, importpath, options = [], check_go_package = False):
     """Invokes protoc to generate Go sources for a given set of protos
 
     Args:
@@ -37,9 +45,17 @@ def go_proto_compile(go, compiler, protos, imports, importpath):
         protos: list of ProtoInfo providers for protos to compile.
         imports: depset of strings mapping proto import paths to Go import paths.
         importpath: the import path of the Go library being generated.
+        options: plugin options set on the go_proto_library, passed after
+            the compiler's own options. go_proto_library only passes this
+            argument when options are set, so compile functions that don't
+            accept it keep working.
+        check_go_package: whether protoc should fail if the go_package options
+            of the protos don't match importpath. Like options, this is only
+            passed when set.
 
     Returns:
-        A list of .go Files generated by the compiler.
+        A list of Files generated by the compiler. Files that don't end with
+        .go, like OpenAPI specs, are not compiled.
     """
 
     go_srcs = []
@@ -60,14 +76,15 @@ def go_proto_compile(go, compiler, protos, imports, importpath):
                 continue
             proto_paths[path] = src
 
-            out = go.declare_file(
-                go,
-                path = importpath + "/" + src.basename[:-len(".proto")],
-                ext = compiler.suffix,
-            )
-            go_srcs.append(out)
-            if outpath == None:
-                outpath = out.dirname[:-len(importpath)]
+            for suffix in getattr(compiler, "suffixes", [compiler.suffix]):
+                out = go.declare_file(
+                    go,
+                    path = importpath + "/" + src.basename[:-len(".proto")],
+                    ext = suffix,
+                )
+                go_srcs.append(out)
+                if outpath == None:
+                    outpath = out.dirname[:-len(importpath)]
 
     transitive_descriptor_sets = depset(direct = [], transitive = desc_sets)
 
@@ -76,14 +93,20 @@ def go_proto_compile(go, compiler, protos, imports, importpath):
     args.add("-importpath", importpath)
     args.add("-out_path", outpath)
     args.add("-plugin", compiler.plugin)
+    if check_go_package:
+        args.add("-check_go_package")
 
     # TODO(jayconrod): can we just use go.env instead?
     args.add_all(compiler.options, before_each = "-option")
+    args.add_all(options, before_each = "-option")
     if compiler.import_path_option:
         args.add_all([importpath], before_each = "-option", format_each = "import_path=%s")
     args.add_all(transitive_descriptor_sets, before_each = "-descriptor_set")
     args.add_all(go_srcs, before_each = "-expected")
     args.add_all(imports, before_each = "-import")
+
+    # Remaps come after imports, so they take precedence.
+    args.add_all(getattr(compiler, "import_remaps", []), before_each = "-import")
     args.add_all(proto_paths.keys())
     go.actions.run(
         inputs = depset(
@@ -149,9 +172,17 @@ def proto_path(src, proto):
         return src.path
     return src.path[len(prefix):]
 
+def _import_remaps_to_source(go, attr, source, merge):
+    labels = {dep.label: None for dep in source["deps"]}
+    source["deps"] = source["deps"] + [
+        dep
+        for dep in attr.import_remaps[GoProtoImportRemaps].deps
+        if dep.label not in labels
+    ]
+
 def _go_proto_compiler_impl(ctx):
     go = go_context(ctx)
-    library = go.new_library(go)
+    library = go.new_library(go, resolver = _import_remaps_to_source)
     source = go.library_to_source(go, ctx.attr, library, ctx.coverage_instrumented())
     return [
         GoProtoCompiler(
@@ -159,11 +190,13 @@ def _go_proto_compiler_impl(ctx):
             compile = go_proto_compile,
             options = ctx.attr.options,
             suffix = ctx.attr.suffix,
+            suffixes = ctx.attr.suffixes or [ctx.attr.suffix],
             go_protoc = ctx.executable._go_protoc,
             protoc = ctx.executable._protoc,
             plugin = ctx.executable.plugin,
             valid_archive = ctx.attr.valid_archive,
             import_path_option = ctx.attr.import_path_option,
+            import_remaps = ctx.attr.import_remaps[GoProtoImportRemaps].remaps,
         ),
         library,
         source,
@@ -175,6 +208,7 @@ go_proto_compiler = go_rule(
         "deps": attr.label_list(providers = [GoLibrary]),
         "options": attr.string_list(),
         "suffix": attr.string(default = ".pb.go"),
+        "suffixes": attr.string_list(),
         "valid_archive": attr.bool(default = True),
         "import_path_option": attr.bool(default = False),
         "plugin": attr.label(
@@ -183,6 +217,10 @@ go_proto_compiler = go_rule(
             cfg = "exec",
             default = "@com_github_golang_protobuf//protoc-gen-go",
         ),
+        "import_remaps": attr.label(
+            providers = [GoProtoImportRemaps],
+            default = "@io_bazel_rules_go//proto:import_remaps",
+        ),
         "_go_protoc": attr.label(
             executable = True,
             cfg = "exec",
@@ -195,3 +233,22 @@ go_proto_compiler = go_rule(
         ),
     },
 )
+
+def _go_proto_import_remaps_impl(ctx):
+    return [GoProtoImportRemaps(
+        remaps = ["{}={}".format(k, v) for k, v in ctx.attr.remaps.items()],
+        deps = ctx.attr.deps,
+    )]
+
+go_proto_import_remaps = rule(
+    implementation = _go_proto_import_remaps_impl,
+    attrs = {
+        "remaps": attr.string_dict(),
+        "deps": attr.label_list(providers = [GoLibrary]),
+    },
+    doc = """Maps proto files to the Go import paths generated code should use
+    to import them, overriding go_package and the importpath of
+    go_proto_library targets. The go_proto_compiler rules use the
+    go_proto_import_remaps target that @io_bazel_rules_go//proto:import_remaps
+    points to.""",
+)
@@ -85,6 +85,8 @@ def _proto_library_to_source(go, attr, source, merge):
 def _go_proto_library_impl(ctx):
     go = go_context(ctx)
     if go.pathtype == INFERRED_PATH:
+        # The importpath can't be read from go_package here: Bazel needs it
+        # during analysis, before any .proto file is read.
         fail("importpath must be specified in this library or one of its embedded libraries")
     if ctx.attr.compiler:
         #TODO: print("DEPRECATED: compiler attribute on {}, use compilers instead".format(ctx.label))
@@ -103,19 +105,31 @@ def _go_proto_library_impl(ctx):
         proto_deps = ctx.attr.protos
 
     go_srcs = []
+    other_files = []
     valid_archive = False
 
     for c in compilers:
         compiler = c[GoProtoCompiler]
         if compiler.valid_archive:
             valid_archive = True
-        go_srcs.extend(compiler.compile(
+        kwargs = {}
+        if ctx.attr.compiler_options:
+            kwargs["options"] = ctx.attr.compiler_options
+        if ctx.attr.check_go_package:
+            kwargs["check_go_package"] = True
+        outs = compiler.compile(
             go,
             compiler = compiler,
             protos = [d[ProtoInfo] for d in proto_deps],
             imports = get_imports(ctx.attr),
             importpath = go.importpath,
-        ))
+            **kwargs
+        )
+        for out in outs:
+            if out.extension == "go":
+                go_srcs.append(out)
+            else:
+                other_files.append(out)
     library = go.new_library(
         go,
         resolver = _proto_library_to_source,
@@ -125,14 +139,19 @@ def _go_proto_library_impl(ctx):
     providers = [library, source]
     output_groups = {
         "go_generated_srcs": go_srcs,
+        "proto_generated_files": other_files,
     }
-    if valid_archive:
+    if ctx.attr.srcs_only:
+        # The generated sources are compiled by the library that embeds this
+        # one or lists it in srcs, together with hand-written code.
+        providers.append(DefaultInfo(files = depset(go_srcs)))
+    elif valid_archive:
         archive = go.archive(go, source)
         output_groups["compilation_outputs"] = [archive.data.file]
         providers.extend([
             archive,
             DefaultInfo(
-                files = depset([archive.data.file]),
+                files = depset([archive.data.file] + other_files),
                 runfiles = archive.runfiles,
             ),
         ])
@@ -154,11 +173,14 @@ go_proto_library = go_rule(
         "importmap": attr.string(),
         "embed": attr.label_list(providers = [GoLibrary]),
         "gc_goopts": attr.string_list(),
+        "srcs_only": attr.bool(),
         "compiler": attr.label(providers = [GoProtoCompiler]),
         "compilers": attr.label_list(
             providers = [GoProtoCompiler],
             default = ["@io_bazel_rules_go//proto:go_proto"],
         ),
+        "compiler_options": attr.string_list(),
+        "check_go_package": attr.bool(),
     },
 )
 # go_proto_library is a rule that takes a proto_library (in the proto
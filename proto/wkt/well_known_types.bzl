@@ -54,7 +54,7 @@ def gen_well_known_types():
             deps = [WELL_KNOWN_TYPE_RULES[dep] for dep in deps],
         )
 
-def _go_proto_wrapper_compile(go, compiler, protos, imports, importpath):
+def _go_proto_wrapper_compile(go, compiler, protos, imports, importpath, options = [], check_go_package = False):
     return []
 
 def _go_proto_wrapper_impl(ctx):
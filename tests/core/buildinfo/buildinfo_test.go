@@ -0,0 +1,121 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package buildinfo_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "main",
+    srcs = ["main.go"],
+    data = ["data.txt"],
+    deps = ["@io_bazel_rules_go//go/tools/buildinfo:go_default_library"],
+)
+
+-- main.go --
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/bazelbuild/rules_go/go/tools/buildinfo"
+)
+
+func main() {
+	fmt.Println("label:", buildinfo.Label())
+	fmt.Println("stamped:", buildinfo.Stamped())
+	commit, _ := buildinfo.Status("STABLE_COMMIT")
+	fmt.Println("commit:", commit)
+	_, ok := buildinfo.Status("VOLATILE_KEY")
+	fmt.Println("volatile:", ok)
+	fmt.Println("digest:", buildinfo.ConfigDigest() != "")
+	path, err := buildinfo.Runfile("data.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print("data: ", string(data))
+}
+
+-- data.txt --
+hello
+
+-- status.sh --
+#!/bin/sh
+echo STABLE_COMMIT abc123
+echo VOLATILE_KEY xyz
+`,
+	})
+}
+
+func runMain(t *testing.T, args ...string) string {
+	t.Helper()
+	args = append(append([]string{"run"}, args...), "//:main")
+	out, err := bazel_testing.BazelOutput(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestUnstamped(t *testing.T) {
+	got := runMain(t)
+	want := `label: //:main
+stamped: false
+commit: 
+volatile: false
+digest: false
+data: hello
+`
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestStamped(t *testing.T) {
+	if err := os.Chmod("status.sh", 0777); err != nil {
+		t.Fatal(err)
+	}
+	got := runMain(t,
+		"--stamp",
+		"--workspace_status_command=./status.sh",
+		"--@io_bazel_rules_go//go/config:build_config_digest")
+	for _, want := range []string{
+		"stamped: true\n",
+		"commit: abc123\n",
+		"volatile: false\n",
+		"digest: true\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%q not found in output:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+package asm
+
+// GoAdd calls add from Go assembly.
+func GoAdd(a, b int) int
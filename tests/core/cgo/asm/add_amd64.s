@@ -0,0 +1,10 @@
+// func GoAdd(a, b int) int
+TEXT ·GoAdd(SB),0,$24-24
+	MOVQ a+0(FP), AX
+	MOVQ AX, 0(SP)
+	MOVQ b+8(FP), AX
+	MOVQ AX, 8(SP)
+	CALL ·add(SB)
+	MOVQ 16(SP), AX
+	MOVQ AX, ret+16(FP)
+	RET
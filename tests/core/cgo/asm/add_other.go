@@ -0,0 +1,8 @@
+//go:build !amd64
+// +build !amd64
+
+package asm
+
+func GoAdd(a, b int) int {
+	return add(a, b)
+}
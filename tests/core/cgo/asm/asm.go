@@ -0,0 +1,15 @@
+package asm
+
+// int gnu_add(int a, int b);
+import "C"
+
+// GNUAdd calls a function written in assembly for the C toolchain.
+func GNUAdd(a, b int) int {
+	return int(C.gnu_add(C.int(a), C.int(b)))
+}
+
+// add is called from Go assembly, so the compiler needs the package's
+// symabis file to generate a wrapper for it.
+func add(a, b int) int {
+	return a + b
+}
@@ -0,0 +1,15 @@
+package asm
+
+import "testing"
+
+func TestGNUAdd(t *testing.T) {
+	if got := GNUAdd(2, 3); got != 5 {
+		t.Errorf("got %d; want 5", got)
+	}
+}
+
+func TestGoAdd(t *testing.T) {
+	if got := GoAdd(2, 3); got != 5 {
+		t.Errorf("got %d; want 5", got)
+	}
+}
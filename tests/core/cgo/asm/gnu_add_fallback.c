@@ -0,0 +1,4 @@
+// Platforms not handled in gnu_add.S use C.
+#if !(defined(__x86_64__) || defined(__aarch64__)) || defined(_WIN32)
+int gnu_add(int a, int b) { return a + b; }
+#endif
@@ -0,0 +1,107 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgo_concurrency_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "lib",
+    srcs = [
+        "add.c",
+        "lib.go",
+        "lib.h",
+        "mul.c",
+        "sub.c",
+    ],
+    cgo = True,
+    importpath = "example.com/lib",
+)
+
+go_test(
+    name = "lib_test",
+    srcs = ["lib_test.go"],
+    embed = [":lib"],
+)
+
+-- lib.h --
+int add(int a, int b);
+int sub(int a, int b);
+int mul(int a, int b);
+
+-- add.c --
+#include "lib.h"
+
+int add(int a, int b) { return a + b; }
+
+-- sub.c --
+#include "lib.h"
+
+int sub(int a, int b) { return a - b; }
+
+-- mul.c --
+#include "lib.h"
+
+int mul(int a, int b) { return a * b; }
+
+-- lib.go --
+package lib
+
+// #include "lib.h"
+import "C"
+
+func Eval(a, b, c int) int {
+	return int(C.sub(C.mul(C.add(C.int(a), C.int(b)), C.int(c)), C.int(a)))
+}
+
+-- lib_test.go --
+package lib
+
+import "testing"
+
+func TestEval(t *testing.T) {
+	if got := Eval(1, 2, 3); got != 8 {
+		t.Errorf("got %d; want 8", got)
+	}
+}
+`,
+	})
+}
+
+// TestCgoConcurrency checks that a cgo package instrumented for coverage,
+// where cgo runs in the compile action, builds and works with C files
+// compiled in parallel.
+func TestCgoConcurrency(t *testing.T) {
+	for _, args := range [][]string{
+		{"--@io_bazel_rules_go//go/config:cgo_concurrency=4", "--collect_code_coverage"},
+		{"--@io_bazel_rules_go//go/config:cgo_concurrency=4"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			if err := bazel_testing.RunBazel(append([]string{"test"}, append(args, "//:lib_test")...)...); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cgo_trace_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+cc_library(
+    name = "dep",
+    srcs = ["dep.c"],
+    hdrs = ["dep.h"],
+    defines = ["DEP_DEFINE=1"],
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    cdeps = [":dep"],
+    cgo = True,
+    clinkopts = ["-lm"],
+    copts = ["-DLIB_COPT=1"],
+    importpath = "example.com/lib",
+)
+
+-- dep.h --
+int dep(void);
+
+-- dep.c --
+#include "dep.h"
+
+int dep(void) { return DEP_DEFINE; }
+
+-- lib.go --
+package lib
+
+// #include "dep.h"
+import "C"
+
+func Dep() int { return int(C.dep()) }
+`,
+	})
+}
+
+func TestTrace(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("build", "--@io_bazel_rules_go//go/config:cgo_trace", "//:lib")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, stderr)
+	}
+	for _, want := range []string{
+		"cgogen: cgo trace: cppflags: -DDEP_DEFINE=1 (from //:dep)",
+		"cgogen: cgo trace: cflags: -DLIB_COPT=1 (from copts of //:lib)",
+		"cgogen: cgo trace: ldflags: -lm (from clinkopts of //:lib)",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("did not find %q in output:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestNoTrace(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("build", "//:lib")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("build failed: %v\n%s", err, stderr)
+	}
+	if strings.Contains(stderr.String(), "cgo trace:") {
+		t.Errorf("found trace output without cgo_trace:\n%s", stderr)
+	}
+}
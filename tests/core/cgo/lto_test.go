@@ -0,0 +1,86 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lto_test
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "main",
+    srcs = ["main.go"],
+    cgo = True,
+)
+
+-- main.go --
+package main
+
+// static int answer(void) { return 42; }
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.answer())
+}
+`,
+	})
+}
+
+func TestLTO(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("run", "--features=lto", "--@io_bazel_rules_go//go/config:cgo_trace", "//:main")
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run failed: %v\n%s", err, stderr)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "42" {
+		t.Errorf("got %q; want 42", got)
+	}
+	for _, want := range []string{
+		"cgo trace: cflags: -flto (from features of //:main)",
+		"cgo trace: ldflags: -flto (from features of //:main)",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("did not find %q in output:\n%s", want, stderr)
+		}
+	}
+}
+
+func TestLTOLinkMode(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("aquery", "--features=lto", "mnemonic(GoLink, //:main)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// aquery may print each argument on its own line.
+	for _, want := range []string{`-linkmode\W+external`, `-extldflags\W+[^\n]*-flto`} {
+		if !regexp.MustCompile(want).Match(out) {
+			t.Errorf("did not find %q in link command:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+#include "pch.h"
+
+#include <sstream>
+
+int pch_count_words(const char* s) {
+  std::map<std::string, int> words;
+  std::istringstream in(s);
+  std::string w;
+  while (in >> w) {
+    words[w]++;
+  }
+  return static_cast<int>(words.size());
+}
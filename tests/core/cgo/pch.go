@@ -0,0 +1,14 @@
+package pch
+
+// #include <stdlib.h>
+// #include "pch.h"
+import "C"
+
+import "unsafe"
+
+// CountWords returns the number of distinct words in s.
+func CountWords(s string) int {
+	cs := C.CString(s)
+	defer C.free(unsafe.Pointer(cs))
+	return int(C.pch_count_words(cs))
+}
@@ -0,0 +1,17 @@
+#ifndef RULES_GO_TESTS_CORE_CGO_PCH_H
+#define RULES_GO_TESTS_CORE_CGO_PCH_H
+
+#ifdef __cplusplus
+#include <map>
+#include <string>
+
+extern "C" {
+#endif
+
+int pch_count_words(const char* s);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif
@@ -0,0 +1,9 @@
+package pch
+
+import "testing"
+
+func TestCountWords(t *testing.T) {
+	if got := CountWords("a b a c"); got != 3 {
+		t.Errorf("got %d; want 3", got)
+	}
+}
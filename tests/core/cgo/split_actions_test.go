@@ -0,0 +1,155 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package split_actions_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library", "go_test")
+
+go_library(
+    name = "lib",
+    srcs = [
+        "add.c",
+        "add.h",
+        "cgo.go",
+        "excluded.c",
+        "mul.c",
+        "plain.go",
+    ],
+    cgo = True,
+    importpath = "example.com/lib",
+)
+
+go_binary(
+    name = "bin",
+    srcs = ["bin.go"],
+    deps = [":lib"],
+)
+
+go_test(
+    name = "lib_test",
+    srcs = ["lib_test.go"],
+    embed = [":lib"],
+)
+
+-- add.h --
+int add(int a, int b);
+int mul(int a, int b);
+
+-- add.c --
+#include "add.h"
+#include "_cgo_export.h"
+
+int add(int a, int b) { return a + b + Zero(); }
+
+-- mul.c --
+#include "add.h"
+
+int mul(int a, int b) { return a * b; }
+
+-- excluded.c --
+// +build ignore
+
+#error "excluded.c should not be compiled"
+
+-- cgo.go --
+package lib
+
+// #include "add.h"
+import "C"
+
+//export Zero
+func Zero() C.int { return 0 }
+
+func Add(a, b int) int { return int(C.add(C.int(a), C.int(b))) }
+
+func Mul(a, b int) int { return int(C.mul(C.int(a), C.int(b))) }
+
+-- plain.go --
+package lib
+
+func AddMul(a, b, c int) int { return Mul(Add(a, b), c) }
+
+-- lib_test.go --
+package lib
+
+import "testing"
+
+func TestAddMul(t *testing.T) {
+	if got := AddMul(1, 2, 3); got != 9 {
+		t.Errorf("got %d; want 9", got)
+	}
+}
+
+-- bin.go --
+package main
+
+import (
+	"fmt"
+
+	"example.com/lib"
+)
+
+func main() {
+	fmt.Println(lib.AddMul(2, 3, 4))
+}
+`,
+	})
+}
+
+func TestActions(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("aquery", "--output=text", "//:lib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, m := range regexp.MustCompile(`(?m)^\s*Mnemonic: (\S+)$`).FindAllSubmatch(out, -1) {
+		counts[string(m[1])]++
+	}
+	want := map[string]int{
+		"GoCgoGen":     1,
+		"GoCompileC":   3,
+		"GoCgoLink":    1,
+		"GoCompilePkg": 1,
+	}
+	for mnemonic, n := range want {
+		if counts[mnemonic] != n {
+			t.Errorf("got %d %s actions; want %d", counts[mnemonic], mnemonic, n)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("run", "//:bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "20" {
+		t.Errorf("got %q; want %q", got, "20")
+	}
+	if err := bazel_testing.RunBazel("test", "//:lib_test"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -65,6 +65,15 @@ go_library(
     importpath = "example.com/coverage/c",
 )
 
+go_test(
+    name = "d_test",
+    srcs = [
+        "d.go",
+        "d_test.go",
+    ],
+    importpath = "example.com/coverage/d",
+)
+
 -- a_test.go --
 package a
 
@@ -111,6 +120,25 @@ func CDead() int {
 	return 34
 }
 
+-- d.go --
+package d
+
+func DLive() int {
+	return 56
+}
+
+-- d_test.go --
+package d_test
+
+import (
+	"testing"
+
+	"example.com/coverage/d"
+)
+
+func TestD(t *testing.T) {
+	d.DLive()
+}
 `,
 	})
 }
@@ -142,6 +170,24 @@ func TestCoverage(t *testing.T) {
 	}
 }
 
+func TestCoverageFromExternalTest(t *testing.T) {
+	if err := bazel_testing.RunBazel("coverage", ":d_test"); err != nil {
+		t.Fatal(err)
+	}
+
+	coveragePath := filepath.FromSlash("bazel-testlogs/d_test/coverage.dat")
+	coverageData, err := ioutil.ReadFile(coveragePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if include := "example.com/coverage/d/d.go:"; !bytes.Contains(coverageData, []byte(include)) {
+		t.Errorf("%s: does not contain %q\n", coveragePath, include)
+	}
+	if exclude := "d_test.go:"; bytes.Contains(coverageData, []byte(exclude)) {
+		t.Errorf("%s: contains %q\n", coveragePath, exclude)
+	}
+}
+
 func TestCrossBuild(t *testing.T) {
 	if err := bazel_testing.RunBazel("build", "--collect_code_coverage", "--instrumentation_filter=-//:b", "//:a_test_cross"); err != nil {
 		t.Fatal(err)
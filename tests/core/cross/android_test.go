@@ -0,0 +1,130 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package android_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "hello",
+    srcs = ["hello.go"],
+    cgo = True,
+)
+
+-- hello.go --
+package main
+
+// int answer(void) { return 42; }
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.answer())
+}
+`,
+		SetUp: setUpAndroidNDK,
+	})
+}
+
+// setUpAndroidNDK writes an archive laid out like the Android NDK and
+// declares it with go_android_ndk_toolchain. The tools are never run; the
+// tests only check how actions are configured.
+func setUpAndroidNDK() error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "ndk.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	bin := fmt.Sprintf("android-ndk/toolchains/llvm/prebuilt/%s-x86_64/bin/", runtime.GOOS)
+	for _, tool := range []string{"aarch64-linux-android24-clang", "clang", "ld.lld", "llvm-ar", "llvm-cov", "llvm-dwp", "llvm-nm", "llvm-objcopy", "llvm-objdump", "llvm-strip"} {
+		script := "#!/bin/sh\nexit 1\n"
+		if err := tw.WriteHeader(&tar.Header{
+			Name: bin + tool,
+			Mode: 0755,
+			Size: int64(len(script)),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(script)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	w, err := os.OpenFile("WORKSPACE", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	_, err = fmt.Fprintf(w, `
+load("@io_bazel_rules_go//go:deps.bzl", "go_android_ndk_toolchain")
+
+go_android_ndk_toolchain(
+    name = "android_ndk_arm64",
+    api_level = 24,
+    exec_compatible_with = [],
+    goarch = "arm64",
+    strip_prefix = "android-ndk",
+    urls = ["file://%s"],
+)
+`, filepath.ToSlash(path))
+	return err
+}
+
+func TestAndroidLink(t *testing.T) {
+	out, err := bazel_testing.BazelOutput(
+		"aquery",
+		"--incompatible_enable_cc_toolchain_resolution",
+		"--platforms=@io_bazel_rules_go//go/toolchain:android_arm64_cgo",
+		"mnemonic(GoLink, //:hello)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`aarch64-linux-android24-clang`).Match(out) {
+		t.Errorf("link action does not use the NDK's clang:\n%s", out)
+	}
+	if !regexp.MustCompile(`-buildmode[\s\\]+pie`).Match(out) {
+		t.Errorf("link action does not build a position-independent executable:\n%s", out)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cc_toolchain_test
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "hello",
+    srcs = ["hello.go"],
+    cgo = True,
+)
+
+-- hello.go --
+package main
+
+// int answer(void) { return 42; }
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.answer())
+}
+`,
+	})
+}
+
+// TestMismatch checks that building cgo code for another architecture with
+// the host's C toolchain fails with an error naming both platforms.
+func TestMismatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the host C toolchain's cpu is only known on Linux")
+	}
+	goarch := "arm64"
+	if runtime.GOARCH == "arm64" {
+		goarch = "amd64"
+	}
+	_, err := bazel_testing.BazelOutput(
+		"build",
+		fmt.Sprintf("--platforms=@io_bazel_rules_go//go/toolchain:linux_%s_cgo", goarch),
+		"//:hello")
+	if err == nil {
+		t.Fatal("got success; want failure")
+	}
+	want := fmt.Sprintf("cgo is enabled for linux/%s, but the C/C++ toolchain targets", goarch)
+	if !strings.Contains(err.Error(), want) {
+		t.Errorf("got error:\n%v\nwant error containing %q", err, want)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package multiplatform_test
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_multiplatform_binary", "go_test")
+
+go_binary(
+    name = "cli",
+    srcs = ["cli.go"],
+)
+
+go_multiplatform_binary(
+    name = "cli_release",
+    binary = ":cli",
+    platforms = [
+        "@io_bazel_rules_go//go/toolchain:linux_arm64",
+        "@io_bazel_rules_go//go/toolchain:windows_amd64",
+    ],
+)
+
+filegroup(
+    name = "cli_linux",
+    srcs = [":cli_release"],
+    output_group = "linux_arm64",
+)
+
+filegroup(
+    name = "cli_windows",
+    srcs = [":cli_release"],
+    output_group = "windows_amd64",
+)
+
+go_test(
+    name = "check_test",
+    srcs = ["check_test.go"],
+    args = [
+        "$(location :cli_linux)",
+        "$(location :cli_windows)",
+    ],
+    data = [
+        ":cli_linux",
+        ":cli_windows",
+    ],
+)
+
+-- cli.go --
+package main
+
+func main() {}
+
+-- check_test.go --
+package check_test
+
+import (
+	"debug/elf"
+	"debug/pe"
+	"flag"
+	"testing"
+)
+
+func TestBinaries(t *testing.T) {
+	linux, windows := flag.Arg(0), flag.Arg(1)
+	if f, err := elf.Open(linux); err != nil {
+		t.Error(err)
+	} else if f.Machine != elf.EM_AARCH64 {
+		t.Errorf("%s: got machine %v; want %v", linux, f.Machine, elf.EM_AARCH64)
+	}
+	if f, err := pe.Open(windows); err != nil {
+		t.Error(err)
+	} else if f.Machine != pe.IMAGE_FILE_MACHINE_AMD64 {
+		t.Errorf("%s: got machine %#x; want amd64", windows, f.Machine)
+	}
+}
+`,
+	})
+}
+
+func TestMultiplatformBinary(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:check_test"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package musl_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "hello",
+    srcs = ["hello.go"],
+    cgo = True,
+)
+
+go_binary(
+    name = "hello_pie",
+    srcs = ["hello.go"],
+    cgo = True,
+    linkmode = "pie",
+)
+
+-- hello.go --
+package main
+
+// int answer(void) { return 42; }
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.answer())
+}
+`,
+		SetUp: setUpMuslToolchain,
+	})
+}
+
+// setUpMuslToolchain writes an archive laid out like a musl cross compiler
+// and declares it with go_musl_toolchain. The tools are never run; the tests
+// only check how actions are configured.
+func setUpMuslToolchain() error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "musl.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	for _, tool := range []string{"ar", "cpp", "gcc", "gcov", "ld", "nm", "objcopy", "objdump", "strip"} {
+		script := "#!/bin/sh\nexit 1\n"
+		if err := tw.WriteHeader(&tar.Header{
+			Name: "x86_64-linux-musl-cross/bin/x86_64-linux-musl-" + tool,
+			Mode: 0755,
+			Size: int64(len(script)),
+		}); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(script)); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	w, err := os.OpenFile("WORKSPACE", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	_, err = fmt.Fprintf(w, `
+load("@io_bazel_rules_go//go:deps.bzl", "go_musl_toolchain")
+
+go_musl_toolchain(
+    name = "musl_amd64",
+    goarch = "amd64",
+    strip_prefix = "x86_64-linux-musl-cross",
+    urls = ["file://%s"],
+)
+`, filepath.ToSlash(path))
+	return err
+}
+
+func muslLinkAction(target string) (string, error) {
+	out, err := bazel_testing.BazelOutput(
+		"aquery",
+		"--incompatible_enable_cc_toolchain_resolution",
+		"--platforms=@io_bazel_rules_go//go/toolchain:linux_amd64_musl",
+		fmt.Sprintf("mnemonic(GoLink, %s)", target))
+	return string(out), err
+}
+
+func TestMuslIsStatic(t *testing.T) {
+	out, err := muslLinkAction("//:hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "x86_64-linux-musl-gcc") {
+		t.Errorf("link action does not use the musl compiler:\n%s", out)
+	}
+	if !strings.Contains(out, "-static") {
+		t.Errorf("link action is not static:\n%s", out)
+	}
+}
+
+func TestMuslStaticPIE(t *testing.T) {
+	out, err := muslLinkAction("//:hello_pie")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "-static-pie") {
+		t.Errorf("link action does not build a static PIE:\n%s", out)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sysroot_test
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "hello",
+    srcs = ["hello.go"],
+    cgo = True,
+)
+
+-- hello.go --
+package main
+
+// int answer(void) { return 42; }
+import "C"
+
+import "fmt"
+
+func main() {
+	fmt.Println(C.answer())
+}
+`,
+		SetUp: setUpSysroot,
+	})
+}
+
+// setUpSysroot writes an archive laid out like a sysroot and a directory
+// laid out like an LLVM installation, and declares them with
+// go_sysroot_toolchain. The tools are never run; the tests only check how
+// actions are configured.
+func setUpSysroot() error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	llvmBin := filepath.Join(dir, "llvm", "bin")
+	if err := os.MkdirAll(llvmBin, 0777); err != nil {
+		return err
+	}
+	for _, tool := range []string{"clang", "ld.lld", "llvm-ar"} {
+		if err := ioutil.WriteFile(filepath.Join(llvmBin, tool), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+			return err
+		}
+	}
+
+	path := filepath.Join(dir, "sysroot.tar.gz")
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	header := "int printf(const char *, ...);\n"
+	if err := tw.WriteHeader(&tar.Header{
+		Name: "sysroot/usr/include/stdio.h",
+		Mode: 0644,
+		Size: int64(len(header)),
+	}); err != nil {
+		return err
+	}
+	if _, err := tw.Write([]byte(header)); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	w, err := os.OpenFile("WORKSPACE", os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	_, err = fmt.Fprintf(w, `
+load("@io_bazel_rules_go//go:deps.bzl", "go_sysroot_toolchain")
+
+go_sysroot_toolchain(
+    name = "sysroot_arm64",
+    goarch = "arm64",
+    llvm_path = "%s",
+    strip_prefix = "sysroot",
+    urls = ["file://%s"],
+)
+`, filepath.ToSlash(filepath.Join(dir, "llvm")), filepath.ToSlash(path))
+	return err
+}
+
+func TestSysrootLink(t *testing.T) {
+	out, err := bazel_testing.BazelOutput(
+		"aquery",
+		"--incompatible_enable_cc_toolchain_resolution",
+		"--platforms=@io_bazel_rules_go//go/toolchain:linux_arm64_glibc",
+		"mnemonic(GoLink, //:hello)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"external/sysroot_arm64/bin/clang",
+		"--target=aarch64-linux-gnu",
+		"--sysroot=external/sysroot_arm64/sysroot",
+		"-fuse-ld=lld",
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("link action does not contain %q:\n%s", want, out)
+		}
+	}
+}
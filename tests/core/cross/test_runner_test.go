@@ -0,0 +1,127 @@
+// Copyright 2019 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package test_runner_test
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test", "go_toolchain")
+
+go_toolchain(
+    name = "js_wasm_impl",
+    builder = "@go_sdk//:builder",
+    goarch = "wasm",
+    goos = "js",
+    sdk = "@go_sdk//:go_sdk",
+    test_runner = ":runner",
+    test_runner_flags = ["--runner_flag"],
+)
+
+toolchain(
+    name = "js_wasm_toolchain",
+    target_compatible_with = [
+        "@io_bazel_rules_go//go/toolchain:js",
+        "@io_bazel_rules_go//go/toolchain:wasm",
+    ],
+    toolchain = ":js_wasm_impl",
+    toolchain_type = "@io_bazel_rules_go//go:toolchain",
+)
+
+go_toolchain(
+    name = "linux_arm64_impl",
+    builder = "@go_sdk//:builder",
+    goarch = "arm64",
+    goos = "linux",
+    sdk = "@go_sdk//:go_sdk",
+    test_runner = ":runner",
+    test_runner_flags = ["--runner_flag"],
+)
+
+toolchain(
+    name = "linux_arm64_toolchain",
+    target_compatible_with = [
+        "@platforms//os:linux",
+        "@platforms//cpu:aarch64",
+    ],
+    toolchain = ":linux_arm64_impl",
+    toolchain_type = "@io_bazel_rules_go//go:toolchain",
+)
+
+sh_binary(
+    name = "runner",
+    srcs = ["runner.sh"],
+)
+
+go_test(
+    name = "wasm_test",
+    srcs = ["runner_test.go"],
+    args = ["-test.v"],
+    goarch = "wasm",
+    goos = "js",
+)
+
+go_test(
+    name = "arm64_test",
+    srcs = ["runner_test.go"],
+    args = ["-test.v"],
+    goarch = "arm64",
+    goos = "linux",
+    pure = "on",
+)
+
+-- runner.sh --
+#!/usr/bin/env bash
+set -euo pipefail
+if [[ "$#" -ne 3 || "$1" != --runner_flag || "$3" != -test.v ]]; then
+  echo "unexpected arguments: $*" >&2
+  exit 1
+fi
+if [[ ! -f "$2" ]]; then
+  echo "test binary $2 not found" >&2
+  exit 1
+fi
+if [[ -z "${RUNFILES_DIR:-}" ]]; then
+  echo "RUNFILES_DIR not set" >&2
+  exit 1
+fi
+
+-- runner_test.go --
+package runner_test
+
+import "testing"
+
+func Test(t *testing.T) {}
+`,
+	})
+}
+
+func TestWasm(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "--extra_toolchains=//:js_wasm_toolchain", "//:wasm_test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmulator(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "--extra_toolchains=//:linux_arm64_toolchain", "//:arm64_test"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wasip1_test
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestGOOS(t *testing.T) {
+	if runtime.GOOS != "wasip1" || runtime.GOARCH != "wasm" {
+		t.Errorf("got %s/%s; want wasip1/wasm", runtime.GOOS, runtime.GOARCH)
+	}
+}
+
+func TestRunfiles(t *testing.T) {
+	data, err := ioutil.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "package main") {
+		t.Errorf("unexpected contents of main.go:\n%s", data)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generated_files_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//extras:generated_files_test.bzl", "generated_files_test")
+
+genrule(
+    name = "gen",
+    outs = ["gen.txt"],
+    cmd = "echo fresh >$@",
+)
+
+generated_files_test(
+    name = "up_to_date_test",
+    srcs = ["current/gen.txt"],
+    generated = [":gen"],
+)
+
+generated_files_test(
+    name = "stale_test",
+    srcs = ["stale/gen.txt"],
+    generated = [":gen"],
+)
+
+-- current/gen.txt --
+fresh
+-- stale/gen.txt --
+old
+`,
+	})
+}
+
+func TestUpToDate(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:up_to_date_test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStale(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("test", "--test_output=errors", "//:stale_test")
+	if err == nil {
+		t.Fatal("got success; want failure")
+	}
+	xerr, ok := err.(*bazel_testing.StderrExitError)
+	if !ok || xerr.Err.ExitCode() != 3 {
+		t.Fatalf("got %v; want exit code 3 (test failure)", err)
+	}
+	for _, want := range []string{"-old", "+fresh", "stale/gen.txt is out of date", "bazel build //:gen"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
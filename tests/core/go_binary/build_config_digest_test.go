@@ -0,0 +1,93 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build_config_digest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "main",
+    srcs = ["main.go"],
+)
+
+-- main.go --
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"regexp"
+)
+
+// main prints the digest recorded in its own build information.
+func main() {
+	exe, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(exe)
+	if err != nil {
+		log.Fatal(err)
+	}
+	re := regexp.MustCompile("build\\tbazel\\.config=([0-9a-f]{12})\\n")
+	if m := re.FindSubmatch(data); m != nil {
+		fmt.Printf("%s\n", m[1])
+	}
+}
+`,
+	})
+}
+
+// buildDigest runs //:main with args and returns the digest recorded in the
+// binary, or "" if there isn't one.
+func buildDigest(t *testing.T, args ...string) string {
+	t.Helper()
+	args = append(append([]string{"run"}, args...), "//:main")
+	out, err := bazel_testing.BazelOutput(args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestBuildConfigDigest(t *testing.T) {
+	if d := buildDigest(t); d != "" {
+		t.Errorf("got digest %q without build_config_digest; want none", d)
+	}
+
+	const flag = "--@io_bazel_rules_go//go/config:build_config_digest"
+	d1 := buildDigest(t, flag)
+	if d1 == "" {
+		t.Fatal("digest not found in binary")
+	}
+	if d := buildDigest(t, flag); d != d1 {
+		t.Errorf("got digest %q when rebuilding; want %q", d, d1)
+	}
+	if d := buildDigest(t, flag, "--@io_bazel_rules_go//go/config:tags=extra"); d == d1 || d == "" {
+		t.Errorf("got digest %q with different tags; want a digest other than %q", d, d1)
+	}
+}
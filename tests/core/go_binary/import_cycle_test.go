@@ -0,0 +1,130 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package import_cycle_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library", "go_test")
+
+go_library(
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/a",
+    deps = [":b"],
+)
+
+go_library(
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/b",
+    deps = [":a_old"],
+)
+
+go_library(
+    name = "a_old",
+    srcs = ["a_old.go"],
+    importpath = "example.com/a",
+)
+
+go_binary(
+    name = "bin",
+    srcs = ["bin.go"],
+    deps = [":a"],
+)
+
+go_test(
+    name = "a_old_test",
+    srcs = ["a_old_test.go"],
+    embed = [":a_old"],
+    deps = [":b"],
+)
+
+-- a.go --
+package a
+
+import "example.com/b"
+
+func A() string { return b.B() }
+
+-- b.go --
+package b
+
+import "example.com/a"
+
+func B() string { return a.Old() }
+
+-- a_old.go --
+package a
+
+func Old() string { return "old" }
+
+-- a_old_test.go --
+package a_test
+
+import (
+	"testing"
+
+	"example.com/b"
+)
+
+func TestB(t *testing.T) {
+	if got := b.B(); got != "old" {
+		t.Errorf("got %q; want %q", got, "old")
+	}
+}
+
+-- bin.go --
+package main
+
+import "example.com/a"
+
+func main() { println(a.A()) }
+`,
+	})
+}
+
+func TestCycle(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("build", "//:bin")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("unexpected success")
+	}
+	for _, want := range []string{
+		"import cycle not allowed in //:bin:",
+		"    example.com/a (//:a)",
+		"    imports example.com/b (//:b)",
+		"    imports example.com/a (//:a_old)",
+	} {
+		if !bytes.Contains(stderr.Bytes(), []byte(want)) {
+			t.Errorf("did not find %q in output:\n%s", want, stderr.Bytes())
+		}
+	}
+}
+
+func TestExternalTest(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:a_old_test"); err != nil {
+		t.Fatal(err)
+	}
+}
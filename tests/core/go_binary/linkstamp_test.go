@@ -0,0 +1,106 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package linkstamp_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "main",
+    srcs = ["main.go"],
+    x_defs = {
+        "Version": "{STABLE_VERSION}",
+        "Time": "{BUILD_TIMESTAMP}",
+        "Custom": "{CUSTOM|none}",
+        "Missing": "{MISSING|dev}",
+    },
+)
+
+-- main.go --
+package main
+
+import "fmt"
+
+var Version, Time, Custom, Missing string
+
+func main() {
+	fmt.Printf("Version=%s Custom=%s Missing=%s Time=%v\n", Version, Custom, Missing, Time != "")
+}
+
+-- status.sh --
+#!/bin/sh
+echo STABLE_VERSION 1.2.3
+echo CUSTOM $(cat custom.txt)
+
+-- custom.txt --
+abc
+`,
+	})
+}
+
+// linkstampOutput runs a bazel command with volatile stamping enabled.
+func linkstampOutput(args ...string) ([]byte, error) {
+	if err := os.Chmod("status.sh", 0777); err != nil {
+		return nil, err
+	}
+	args = append(args,
+		"--stamp",
+		"--workspace_status_command=./status.sh",
+		"--@io_bazel_rules_go//go/config:linkstamp")
+	return bazel_testing.BazelOutput(args...)
+}
+
+func TestLinkstamp(t *testing.T) {
+	out, err := linkstampOutput("run", "//:main")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.TrimSpace(string(out))
+	want := "Version=1.2.3 Custom=abc Missing=dev Time=true"
+	if got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestLinkDoesNotDependOnVolatileStatus(t *testing.T) {
+	out, err := linkstampOutput("aquery", "mnemonic(GoLink, //:main)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "stable-status.txt") {
+		t.Errorf("GoLink action does not depend on stable-status.txt:\n%s", out)
+	}
+	if strings.Contains(string(out), "volatile-status.txt") {
+		t.Errorf("GoLink action depends on volatile-status.txt:\n%s", out)
+	}
+
+	if out, err = linkstampOutput("aquery", "mnemonic(GoStamp, //:main)"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "volatile-status.txt") {
+		t.Errorf("GoStamp action does not depend on volatile-status.txt:\n%s", out)
+	}
+}
@@ -15,6 +15,8 @@
 package package_conflict_test
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
@@ -52,6 +54,11 @@ go_library(
     deps = [":foo_en"],
 )
 
+exports_files([
+    "allowlist_en.txt",
+    "allowlist_fr.txt",
+])
+
 go_binary(
     name = "main",
     srcs = ["main.go"],
@@ -61,6 +68,13 @@ go_binary(
     ],
 )
 
+-- allowlist_en.txt --
+# The English version wins.
+github.com/bazelbuild/rules_go/tests/core/package_conflict/foo //:foo_en
+
+-- allowlist_fr.txt --
+github.com/bazelbuild/rules_go/tests/core/package_conflict/foo //:foo_fr
+
 -- foo_en.go --
 package foo
 
@@ -140,3 +154,36 @@ func TestPackageConflictIsWarning(t *testing.T) {
 func TestPackageConflictIsError(t *testing.T) {
 	runTest(t, true, "--@io_bazel_rules_go//go/config:incompatible_package_conflict_is_error=True")
 }
+
+func TestPackageConflictAllowlist(t *testing.T) {
+	runTest(t, false,
+		"--@io_bazel_rules_go//go/config:incompatible_package_conflict_is_error=True",
+		"--@io_bazel_rules_go//go/config:package_conflict_allowlist=//:allowlist_en.txt")
+}
+
+func TestPackageConflictAllowlistUnknownLabel(t *testing.T) {
+	runTest(t, true,
+		"--@io_bazel_rules_go//go/config:incompatible_package_conflict_is_error=True",
+		"--@io_bazel_rules_go//go/config:package_conflict_allowlist=//:allowlist_fr.txt")
+}
+
+func TestPackageConflictRemap(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("run",
+		"--@io_bazel_rules_go//go/config:incompatible_package_conflict_is_error=True",
+		"--@io_bazel_rules_go//go/config:package_conflict_remap",
+		"//:main")
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("%v\n%s", err, stderr.Bytes())
+	}
+
+	// Both libraries are linked, so each greeting is printed.
+	if got, want := stdout.String(), "Hallo, Welt!\nHello, World!\n"; got != want {
+		t.Errorf("got output %q; want %q", got, want)
+	}
+	if !strings.Contains(stderr.String(), "tests/core/package_conflict/foo~2") {
+		t.Errorf("remapped importmap not reported:\n%s", stderr.Bytes())
+	}
+}
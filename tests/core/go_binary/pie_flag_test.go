@@ -0,0 +1,109 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pie_flag_test
+
+import (
+	"debug/elf"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "hello",
+    srcs = ["hello.go"],
+)
+
+go_binary(
+    name = "hello_windows",
+    srcs = ["hello.go"],
+    goarch = "amd64",
+    goos = "windows",
+)
+
+-- hello.go --
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+`,
+	})
+}
+
+// elfType builds //:hello with the given flags and returns the type of the
+// resulting ELF file.
+func elfType(t *testing.T, args ...string) elf.Type {
+	if err := bazel_testing.RunBazel(append([]string{"build", "//:hello"}, args...)...); err != nil {
+		t.Fatal(err)
+	}
+	out, err := bazel_testing.BazelOutput(append([]string{"info", "bazel-bin"}, args...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := elf.Open(filepath.Join(strings.TrimSpace(string(out)), "hello_", "hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	return f.Type
+}
+
+func TestPIESetting(t *testing.T) {
+	if runtime.GOOS != "linux" || runtime.GOARCH != "amd64" {
+		t.Skip("test only runs on linux/amd64")
+	}
+	for _, test := range []struct {
+		desc string
+		args []string
+		want elf.Type
+	}{
+		{desc: "default", want: elf.ET_EXEC},
+		{desc: "off", args: []string{"--@io_bazel_rules_go//go/config:pie=off"}, want: elf.ET_EXEC},
+		{desc: "on", args: []string{"--@io_bazel_rules_go//go/config:pie=on"}, want: elf.ET_DYN},
+		{desc: "auto", args: []string{"--@io_bazel_rules_go//go/config:pie=auto"}, want: elf.ET_DYN},
+		{desc: "auto_pure", args: []string{"--@io_bazel_rules_go//go/config:pie=auto", "--@io_bazel_rules_go//go/config:pure"}, want: elf.ET_EXEC},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := elfType(t, test.args...); got != test.want {
+				t.Errorf("got %v; want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPIEUnsupported(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:hello_windows", "--@io_bazel_rules_go//go/config:pie=auto"); err != nil {
+		t.Fatalf("unexpected error with pie=auto: %v", err)
+	}
+	err := bazel_testing.RunBazel("build", "//:hello_windows", "--@io_bazel_rules_go//go/config:pie=on")
+	if err == nil {
+		t.Fatal("unexpected success with pie=on")
+	}
+	if !strings.Contains(err.Error(), "-buildmode=pie not supported on windows/amd64") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_binary_size_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_binary_size_test", "go_library")
+
+go_binary(
+    name = "hello",
+    srcs = ["hello.go"],
+    deps = [":big"],
+)
+
+go_library(
+    name = "big",
+    srcs = ["big.go"],
+    importpath = "example.com/big",
+)
+
+go_binary_size_test(
+    name = "hello_size_test",
+    baseline = "hello_size.json",
+    binary = ":hello",
+)
+
+-- hello.go --
+package main
+
+import "os"
+
+func main() {
+	os.Stdout.WriteString("hello\n")
+}
+
+-- big.go --
+package big
+
+var Table = [...]string{
+	` + strings.Repeat(`"The quick brown fox jumps over the lazy dog.",
+	`, 8192) + `
+}
+
+func Lookup(i int) string {
+	return Table[i%len(Table)]
+}
+
+-- hello_size.json --
+`,
+	})
+}
+
+func TestBinarySize(t *testing.T) {
+	err := bazel_testing.RunBazel("test", "//:hello_size_test")
+	if err == nil {
+		t.Fatal("test passed with an empty baseline")
+	}
+
+	if err := bazel_testing.RunBazel("run", "//:hello_size_test", "--", "-update"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile("hello_size.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"main"`) {
+		t.Errorf("baseline does not contain package main:\n%s", data)
+	}
+	if err := bazel_testing.RunBazel("test", "//:hello_size_test"); err != nil {
+		t.Fatalf("test failed after updating baseline: %v", err)
+	}
+
+	bigMain := `package main
+
+import (
+	"os"
+
+	"example.com/big"
+)
+
+func main() {
+	os.Stdout.WriteString(big.Lookup(len(os.Args)) + "\n")
+}
+`
+	if err := ioutil.WriteFile("hello.go", []byte(bigMain), 0666); err != nil {
+		t.Fatal(err)
+	}
+	out, err := bazel_testing.BazelOutput("test", "--test_output=errors", "//:hello_size_test")
+	if err == nil {
+		t.Fatal("test passed after binary grew")
+	}
+	if output := string(out) + err.Error(); !strings.Contains(output, "example.com/big (new)") {
+		t.Errorf("test output does not name the package that grew:\n%s", output)
+	}
+}
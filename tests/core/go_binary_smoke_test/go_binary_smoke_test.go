@@ -0,0 +1,116 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_binary_smoke_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+load("@io_bazel_rules_go//extras:go_binary_smoke_test.bzl", "go_binary_smoke_test")
+
+go_binary(
+    name = "fail",
+    srcs = ["fail.go"],
+)
+
+go_binary(
+    name = "hang",
+    srcs = ["hang.go"],
+)
+
+go_binary_smoke_test(
+    name = "exit_code_test",
+    binary = ":fail",
+)
+
+go_binary_smoke_test(
+    name = "output_test",
+    binary = ":fail",
+    exit_code = 1,
+    output = "^ready$",
+)
+
+go_binary_smoke_test(
+    name = "timeout_test",
+    binary = ":hang",
+    timeout_secs = 1,
+)
+
+-- fail.go --
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println("could not start")
+	os.Exit(1)
+}
+
+-- hang.go --
+package main
+
+import "time"
+
+func main() {
+	time.Sleep(time.Hour)
+}
+`,
+	})
+}
+
+func TestFailure(t *testing.T) {
+	for _, tc := range []struct {
+		target string
+		want   []string
+	}{
+		{
+			target: "//:exit_code_test",
+			want:   []string{"could not start", "exited with code 1; want 0"},
+		}, {
+			target: "//:output_test",
+			want:   []string{`does not match "^ready$"`},
+		}, {
+			target: "//:timeout_test",
+			want:   []string{"did not exit within 1s"},
+		},
+	} {
+		t.Run(strings.TrimPrefix(tc.target, "//:"), func(t *testing.T) {
+			out, err := bazel_testing.BazelOutput("test", "--test_output=errors", tc.target)
+			if err == nil {
+				t.Fatal("got success; want failure")
+			}
+			xerr, ok := err.(*bazel_testing.StderrExitError)
+			if !ok || xerr.Err.ExitCode() != 3 {
+				t.Fatalf("got %v; want exit code 3 (test failure)", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(string(out), want) {
+					t.Errorf("output does not contain %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
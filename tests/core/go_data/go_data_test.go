@@ -0,0 +1,57 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_data
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+const hello = "Hello, world!\n"
+
+func TestFiles(t *testing.T) {
+	want := map[string][]byte{
+		"hello.txt":     []byte(hello),
+		"generated.txt": []byte("generated\n"),
+		"value":         []byte("a\nvalue"),
+	}
+	if !reflect.DeepEqual(Files, want) {
+		t.Errorf("got %q; want %q", Files, want)
+	}
+}
+
+func TestSingle(t *testing.T) {
+	if Hello != hello {
+		t.Errorf("got %q; want %q", Hello, hello)
+	}
+}
+
+func TestCompressed(t *testing.T) {
+	if got := CompressedSizes["hello.txt"]; got != len(hello) {
+		t.Errorf("got size %d; want %d", got, len(hello))
+	}
+	r, err := OpenCompressed("hello.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != hello {
+		t.Errorf("got %q; want %q", data, hello)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_dep_graph_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_dep_graph", "go_library")
+
+go_library(
+    name = "cmd_lib",
+    srcs = ["main.go"],
+    importpath = "example.com/cmd",
+    deps = [":a"],
+)
+
+go_binary(
+    name = "cmd",
+    embed = [":cmd_lib"],
+    deps = [":b"],
+)
+
+go_library(
+    name = "a",
+    srcs = ["a.go"],
+    importpath = "example.com/a",
+    deps = [":internal"],
+)
+
+go_library(
+    name = "b",
+    srcs = ["b.go"],
+    importpath = "example.com/b",
+    deps = [":internal"],
+)
+
+go_library(
+    name = "internal",
+    srcs = ["internal.go"],
+    importpath = "example.com/internal",
+    deps = [":leaf"],
+)
+
+go_library(
+    name = "leaf",
+    srcs = ["leaf.go"],
+    importpath = "example.com/leaf",
+)
+
+go_dep_graph(
+    name = "graph",
+    dep = ":cmd",
+    format = "json",
+)
+
+go_dep_graph(
+    name = "graph_filtered",
+    dep = ":cmd",
+    exclude = "internal",
+)
+
+-- main.go --
+package main
+
+import (
+	_ "example.com/a"
+	_ "example.com/b"
+)
+
+func main() {}
+
+-- a.go --
+package a
+
+import _ "example.com/internal"
+
+-- b.go --
+package b
+
+import _ "example.com/internal"
+
+-- internal.go --
+package internal
+
+import _ "example.com/leaf"
+
+-- leaf.go --
+package leaf
+`,
+	})
+}
+
+type jsonPackage struct {
+	ImportPath string   `json:"importpath"`
+	Label      string   `json:"label"`
+	Imports    []string `json:"imports"`
+}
+
+type jsonGraph struct {
+	Root     string        `json:"root"`
+	Packages []jsonPackage `json:"packages"`
+}
+
+func TestJSON(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("run", "//:graph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g jsonGraph
+	if err := json.Unmarshal(out, &g); err != nil {
+		t.Fatalf("parsing output: %v\n%s", err, out)
+	}
+	if g.Root != "example.com/cmd" {
+		t.Errorf("got root %q; want %q", g.Root, "example.com/cmd")
+	}
+	got := make(map[string][]string)
+	for _, p := range g.Packages {
+		got[p.ImportPath] = p.Imports
+	}
+	want := map[string][]string{
+		"example.com/cmd":      {"example.com/a", "example.com/b"},
+		"example.com/a":        {"example.com/internal"},
+		"example.com/b":        {"example.com/internal"},
+		"example.com/internal": {"example.com/leaf"},
+		"example.com/leaf":     {},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+}
+
+func TestDOTFiltered(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("run", "//:graph_filtered", "--", "-depth=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var edges []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.Contains(line, "->") {
+			edges = append(edges, strings.TrimSpace(line))
+		}
+	}
+	sort.Strings(edges)
+	// internal is hidden, so a and b are connected to leaf through it, but
+	// leaf is three imports away from the root.
+	want := []string{
+		`"example.com/cmd" -> "example.com/a";`,
+		`"example.com/cmd" -> "example.com/b";`,
+	}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("got edges:\n%s\nwant:\n%s", strings.Join(edges, "\n"), strings.Join(want, "\n"))
+	}
+	if strings.Contains(string(out), "example.com/internal") {
+		t.Errorf("excluded package in output:\n%s", out)
+	}
+}
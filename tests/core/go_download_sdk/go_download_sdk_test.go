@@ -15,8 +15,16 @@
 package go_download_sdk_test
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
@@ -33,6 +41,14 @@ go_test(
     srcs = ["version_test.go"],
 )
 
+go_test(
+    name = "patched_test",
+    srcs = [
+        "patched_test.go",
+        "version_test.go",
+    ],
+)
+
 -- version_test.go --
 package version_test
 
@@ -49,13 +65,43 @@ func Test(t *testing.T) {
 		t.Errorf("got version %q; want %q", v, *want)
 	}
 }
+
+-- patched_test.go --
+package version_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPatched(t *testing.T) {
+	if !strings.Patched() {
+		t.Error("standard library was not patched")
+	}
+}
+
+-- go.mod --
+module example.com/version
+
+go 1.13
+
+toolchain go1.14.4
+
+-- strings.patch --
+--- /dev/null
++++ b/src/strings/patched.go
+@@ -0,0 +1,4 @@
++package strings
++
++// Patched reports whether the SDK was patched.
++func Patched() bool { return true }
 `,
 	})
 }
 
 func Test(t *testing.T) {
 	for _, test := range []struct {
-		desc, rule, wantVersion string
+		desc, rule, target, wantVersion string
 	}{
 		{
 			desc: "version",
@@ -84,39 +130,148 @@ go_download_sdk(
 )
 `,
 			wantVersion: "go1.13",
+		}, {
+			desc: "go_mod",
+			rule: `
+load("@io_bazel_rules_go//go:deps.bzl", "go_download_sdk")
+
+go_download_sdk(
+    name = "go_sdk",
+    go_mod = "//:go.mod",
+)
+
+`,
+			wantVersion: "go1.14.4",
+		}, {
+			desc: "url_template",
+			rule: `
+load("@io_bazel_rules_go//go:deps.bzl", "go_download_sdk")
+
+go_download_sdk(
+    name = "go_sdk",
+    version = "1.13",
+    urls = [
+        "file:///nonexistent/go{version}.{os}-{arch}.tar.gz",
+        "https://dl.google.com/go/go{version}.{os}-{arch}.tar.gz",
+    ],
+)
+
+`,
+			wantVersion: "go1.13",
+		}, {
+			desc: "patches",
+			rule: `
+load("@io_bazel_rules_go//go:deps.bzl", "go_download_sdk")
+
+go_download_sdk(
+    name = "go_sdk",
+    version = "1.13",
+    patches = ["//:strings.patch"],
+    patch_args = ["-p1"],
+)
+
+`,
+			target:      "//:patched_test",
+			wantVersion: "go1.13",
 		},
 	} {
 		t.Run(test.desc, func(t *testing.T) {
-			origWorkspaceData, err := ioutil.ReadFile("WORKSPACE")
-			if err != nil {
-				t.Fatal(err)
+			if test.desc == "url_template" && runtime.GOOS == "windows" {
+				t.Skip("Windows SDKs are distributed as .zip archives")
 			}
+			defer setSDKRule(t, test.rule)()
 
-			i := bytes.Index(origWorkspaceData, []byte("go_rules_dependencies()"))
-			if i < 0 {
-				t.Fatalf("%s: could not find call to go_rules_dependencies()")
+			target := test.target
+			if target == "" {
+				target = "//:version_test"
+			}
+			if err := bazel_testing.RunBazel("test", target, "--test_arg=-version="+test.wantVersion); err != nil {
+				t.Fatal(err)
 			}
+		})
+	}
+}
+
+// setSDKRule replaces the SDK declared in WORKSPACE with rule. It returns a
+// function that restores WORKSPACE.
+func setSDKRule(t *testing.T, rule string) func() {
+	origWorkspaceData, err := ioutil.ReadFile("WORKSPACE")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-			buf := &bytes.Buffer{}
-			buf.Write(origWorkspaceData[:i])
-			buf.WriteString(test.rule)
-			buf.WriteString(`
+	i := bytes.Index(origWorkspaceData, []byte("go_rules_dependencies()"))
+	if i < 0 {
+		t.Fatal("could not find call to go_rules_dependencies()")
+	}
+
+	buf := &bytes.Buffer{}
+	buf.Write(origWorkspaceData[:i])
+	buf.WriteString(rule)
+	buf.WriteString(`
 go_rules_dependencies()
 
 go_register_toolchains()
 `)
-			if err := ioutil.WriteFile("WORKSPACE", buf.Bytes(), 0666); err != nil {
-				t.Fatal(err)
-			}
-			defer func() {
-				if err := ioutil.WriteFile("WORKSPACE", origWorkspaceData, 0666); err != nil {
-					t.Errorf("error restoring WORKSPACE: %v", err)
-				}
-			}()
+	if err := ioutil.WriteFile("WORKSPACE", buf.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		if err := ioutil.WriteFile("WORKSPACE", origWorkspaceData, 0666); err != nil {
+			t.Errorf("error restoring WORKSPACE: %v", err)
+		}
+	}
+}
 
-			if err := bazel_testing.RunBazel("test", "//:version_test", "--test_arg=-version="+test.wantVersion); err != nil {
-				t.Fatal(err)
-			}
-		})
+// TestPrebuiltStdlib checks that a prebuilt standard library for the mode is
+// used instead of compiling one. The archive only contains empty files, so
+// actions are inspected but not run.
+func TestPrebuiltStdlib(t *testing.T) {
+	mode := runtime.GOOS + "_" + runtime.GOARCH + "_pure"
+	dir, err := ioutil.TempDir("", "TestPrebuiltStdlib")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archive := &bytes.Buffer{}
+	zw := gzip.NewWriter(archive)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{
+		Name: "pkg/" + runtime.GOOS + "_" + runtime.GOARCH + "/fmt.a",
+		Mode: 0644,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, mode+".tar.gz"), archive.Bytes(), 0666); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(archive.Bytes())
+
+	defer setSDKRule(t, fmt.Sprintf(`
+load("@io_bazel_rules_go//go:deps.bzl", "go_download_sdk")
+
+go_download_sdk(
+    name = "go_sdk",
+    version = "1.13",
+    stdlib_sha256s = {"%s": "%x"},
+    stdlib_urls = ["file://%s/{mode}.tar.gz"],
+)
+`, mode, sum, filepath.ToSlash(dir)))()
+
+	out, err := bazel_testing.BazelOutput("aquery", "--@io_bazel_rules_go//go/config:pure", "deps(//:version_test)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "Mnemonic: GoStdlib") {
+		t.Errorf("standard library is compiled although a prebuilt one was declared:\n%s", out)
+	}
+	if want := "external/go_sdk/stdlib/" + mode + "/pkg/"; !strings.Contains(string(out), want) {
+		t.Errorf("actions do not use the prebuilt standard library in %s:\n%s", want, out)
 	}
 }
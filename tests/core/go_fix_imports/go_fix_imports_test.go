@@ -0,0 +1,106 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_fix_imports_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- go.mod --
+module example.com/fix
+
+-- BUILD.bazel --
+-- main.go --
+package main
+
+import (
+	"example.com/fix/lib"
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Println(strings.ToUpper(lib.Name))
+}
+-- lib/lib.go --
+package lib
+
+const Name = "lib"
+-- testdata/bad.go --
+package bad
+
+import "os"
+`,
+	})
+}
+
+const fixedMain = `package main
+
+import (
+	"fmt"
+	"strings"
+
+	"example.com/fix/lib"
+)
+
+func main() {
+	fmt.Println(strings.ToUpper(lib.Name))
+}
+`
+
+func TestFixImports(t *testing.T) {
+	before, err := ioutil.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// -l lists files that need changes without rewriting them.
+	out, err := bazel_testing.BazelOutput("run", "@io_bazel_rules_go//go:fix_imports", "--", "-l")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), "main.go") {
+		t.Errorf("main.go not listed in output:\n%s", out)
+	}
+	if strings.Contains(string(out), "bad.go") {
+		t.Errorf("testdata/bad.go listed in output:\n%s", out)
+	}
+	if got, err := ioutil.ReadFile("main.go"); err != nil {
+		t.Fatal(err)
+	} else if string(got) != string(before) {
+		t.Errorf("main.go was changed with -l:\n%s", got)
+	}
+
+	if err := bazel_testing.RunBazel("run", "@io_bazel_rules_go//go:fix_imports"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ioutil.ReadFile("main.go"); err != nil {
+		t.Fatal(err)
+	} else if string(got) != fixedMain {
+		t.Errorf("got main.go:\n%s\nwant:\n%s", got, fixedMain)
+	}
+	if got, err := ioutil.ReadFile("testdata/bad.go"); err != nil {
+		t.Fatal(err)
+	} else if string(got) != "package bad\n\nimport \"os\"\n" {
+		t.Errorf("testdata/bad.go was changed:\n%s", got)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_host_sdk_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "hello",
+    srcs = ["hello.go"],
+)
+
+-- hello.go --
+package main
+
+func main() {}
+`,
+	})
+}
+
+const wrapSDK = `go_wrap_sdk(
+    name = "go_sdk",
+    root_file = "@local_go_sdk//:ROOT",
+)`
+
+func Test(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("info", "output_base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	goroot := filepath.Join(strings.TrimSpace(string(out)), "external", "local_go_sdk")
+	goName := "go"
+	if runtime.GOOS == "windows" {
+		goName += ".exe"
+	}
+	goData, err := ioutil.ReadFile(filepath.Join(goroot, "bin", goName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goSum := fmt.Sprintf("%x", sha256.Sum256(goData))
+
+	for _, test := range []struct {
+		desc, attrs, wantErr string
+	}{
+		{
+			desc:  "min_version",
+			attrs: `min_version = "1.13"`,
+		}, {
+			desc:    "min_version_too_new",
+			attrs:   `min_version = "100.0"`,
+			wantErr: "but at least go100.0 is required",
+		}, {
+			desc:  "checksums",
+			attrs: fmt.Sprintf(`checksums = {"bin/%s": "%s"}`, goName, goSum),
+		}, {
+			desc:    "checksums_mismatch",
+			attrs:   fmt.Sprintf(`checksums = {"bin/%s": "%s"}`, goName, strings.Repeat("0", 64)),
+			wantErr: "The SDK may have been modified or replaced",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			origWorkspaceData, err := ioutil.ReadFile("WORKSPACE")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(origWorkspaceData, []byte(wrapSDK)) {
+				t.Fatalf("could not find go_wrap_sdk in WORKSPACE")
+			}
+			hostSDK := fmt.Sprintf(`load("@io_bazel_rules_go//go:deps.bzl", "go_host_sdk")
+
+go_host_sdk(
+    name = "go_sdk",
+    %s,
+)`, test.attrs)
+			workspaceData := bytes.Replace(origWorkspaceData, []byte(wrapSDK), []byte(hostSDK), 1)
+			if err := ioutil.WriteFile("WORKSPACE", workspaceData, 0666); err != nil {
+				t.Fatal(err)
+			}
+			defer func() {
+				if err := ioutil.WriteFile("WORKSPACE", origWorkspaceData, 0666); err != nil {
+					t.Errorf("error restoring WORKSPACE: %v", err)
+				}
+			}()
+
+			err = bazel_testing.RunBazel("build", "--repo_env=GOROOT="+goroot, "//:hello")
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("unexpected success")
+			}
+			if !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("got error:\n%v\nwant error containing %q", err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package compiler_concurrency_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_binary(
+    name = "bin",
+    srcs = ["bin.go"],
+    deps = [":lib"],
+)
+
+-- lib.go --
+package lib
+
+func A(x int) int { return x + 1 }
+
+func B(x int) int { return A(x) * 2 }
+
+func C(x int) int { return B(x) - 3 }
+
+-- bin.go --
+package main
+
+import (
+	"fmt"
+
+	"example.com/lib"
+)
+
+func main() {
+	fmt.Println(lib.C(1))
+}
+`,
+	})
+}
+
+func TestCompilerConcurrency(t *testing.T) {
+	for _, args := range [][]string{
+		{"--@io_bazel_rules_go//go/config:compiler_concurrency=4"},
+		// -c is not compatible with these modes and should be left out.
+		{"--@io_bazel_rules_go//go/config:compiler_concurrency=4", "--@io_bazel_rules_go//go/config:race"},
+		{"--@io_bazel_rules_go//go/config:compiler_concurrency=4", "--@io_bazel_rules_go//go/config:debug"},
+	} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			out, err := bazel_testing.BazelOutput(append([]string{"run"}, append(args, "//:bin")...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSpace(string(out)); got != "1" {
+				t.Errorf("got %q; want %q", got, "1")
+			}
+		})
+	}
+}
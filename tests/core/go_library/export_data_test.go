@@ -0,0 +1,112 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export_data_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
+
+go_library(
+    name = "dep",
+    srcs = ["dep.go"],
+    importpath = "example.com/dep",
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+    deps = [":dep"],
+)
+
+go_binary(
+    name = "bin",
+    srcs = ["bin.go"],
+    deps = [":lib"],
+)
+
+-- dep.go --
+package dep
+
+func Answer() int { return 42 }
+
+-- lib.go --
+package lib
+
+import "example.com/dep"
+
+func Answer() int { return dep.Answer() }
+
+-- bin.go --
+package main
+
+import (
+	"fmt"
+
+	"example.com/lib"
+)
+
+func main() {
+	fmt.Println(lib.Answer())
+}
+`,
+	})
+}
+
+func TestCompileInputs(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("aquery", "--output=text", "mnemonic(GoCompilePkg, //:lib)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := regexp.MustCompile(`(?m)^\s*Inputs: \[(.*)\]$`).FindSubmatch(out)
+	if m == nil {
+		t.Fatalf("could not find inputs of compile action in:\n%s", out)
+	}
+	var hasExport, hasArchive bool
+	for _, input := range strings.Split(string(m[1]), ", ") {
+		switch {
+		case strings.HasSuffix(input, "/dep.export"):
+			hasExport = true
+		case strings.HasSuffix(input, "/dep.a"):
+			hasArchive = true
+		}
+	}
+	if !hasExport {
+		t.Errorf("compile action for //:lib does not read dep.export; inputs: %s", m[1])
+	}
+	if hasArchive {
+		t.Errorf("compile action for //:lib reads dep.a; inputs: %s", m[1])
+	}
+}
+
+func TestRun(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("run", "//:bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "42" {
+		t.Errorf("got %q; want %q", got, "42")
+	}
+}
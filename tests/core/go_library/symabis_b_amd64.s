@@ -0,0 +1,25 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+#include "textflag.h"
+
+// func Square(x int64) int64
+TEXT ·Square(SB),0,$24-16
+	MOVQ x+0(FP), AX
+	MOVQ AX, 0(SP)
+	MOVQ AX, 8(SP)
+	CALL symabis_a·Mul(SB)
+	MOVQ 16(SP), AX
+	MOVQ AX, ret+8(FP)
+	RET
@@ -0,0 +1,97 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package werror_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "heap",
+    srcs = ["heap.go"],
+    gc_goopts = ["-m"],
+    importpath = "example.com/heap",
+)
+
+go_library(
+    name = "heap_werror",
+    srcs = ["heap.go"],
+    gc_goopts = ["-m"],
+    importpath = "example.com/heap",
+    werror = ["moved to heap"],
+)
+
+-- policy.txt --
+# Only the root package is checked.
+//:heap moved to heap
+//other/... .
+
+-- heap.go --
+package heap
+
+func New() *int {
+	x := 1
+	return &x
+}
+
+-- other/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "other",
+    srcs = ["other.go"],
+    importpath = "example.com/other",
+)
+
+-- other/other.go --
+package other
+`,
+	})
+}
+
+const policyFlag = "--@io_bazel_rules_go//go/config:werror_policy=//:policy.txt"
+
+func TestWerror(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:heap", "//other"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{
+		{"//:heap_werror"},
+		{policyFlag, "//:heap"},
+	} {
+		err := bazel_testing.RunBazel(append([]string{"build"}, args...)...)
+		if err == nil {
+			t.Errorf("%s: build succeeded; want failure", strings.Join(args, " "))
+		} else if !strings.Contains(err.Error(), "moved to heap: x") {
+			t.Errorf("%s: error does not mention the compiler output:\n%v", strings.Join(args, " "), err)
+		}
+	}
+
+	// The policy for //other/... matches any output, but the compiler doesn't
+	// print anything for it.
+	if err := bazel_testing.RunBazel("build", policyFlag, "//other"); err != nil {
+		t.Fatal(err)
+	}
+}
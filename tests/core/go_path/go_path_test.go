@@ -29,7 +29,7 @@ import (
 	"github.com/bazelbuild/rules_go/go/tools/bazel"
 )
 
-var copyPath, linkPath, archivePath, nodataPath string
+var copyPath, linkPath, archivePath, nodataPath, vendorPath string
 
 var defaultMode = runtime.GOOS + "_" + runtime.GOARCH
 
@@ -58,6 +58,7 @@ func TestMain(m *testing.M) {
 	flag.StringVar(&linkPath, "link_path", "", "path to symlinked go_path")
 	flag.StringVar(&archivePath, "archive_path", "", "path to archive go_path")
 	flag.StringVar(&nodataPath, "nodata_path", "", "path to go_path without data")
+	flag.StringVar(&vendorPath, "vendor_path", "", "path to go_path with vendor layout")
 	flag.Parse()
 	os.Exit(m.Run())
 }
@@ -133,6 +134,45 @@ func TestNoDataPath(t *testing.T) {
 	checkPath(t, nodataPath, files)
 }
 
+func TestVendorPath(t *testing.T) {
+	if vendorPath == "" {
+		t.Fatal("-vendor_path not set")
+	}
+	files := []string{
+		"-src/",
+		"go.mod",
+		"cmd/bin/bin.go",
+		"pkg/lib/lib.go",
+		"pkg/lib/data.txt",
+		"vendor/modules.txt",
+		"vendor/example.com/repo2/vendored.go",
+	}
+	checkPath(t, vendorPath, files)
+
+	for name, want := range map[string]string{
+		"go.mod": `module example.com/repo
+
+go 1.14
+
+require (
+	example.com/repo2 v1.2.3
+)
+`,
+		"vendor/modules.txt": `# example.com/repo2 v1.2.3
+## explicit
+example.com/repo2
+`,
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(vendorPath, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("%s: got:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+}
+
 // checkPath checks that dir contains a list of files. files is a list of
 // slash-separated paths relative to dir. Files that start with "-" should be
 // absent. Files that end with "/" should be directories.
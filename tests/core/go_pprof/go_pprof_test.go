@@ -0,0 +1,100 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_pprof_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_pprof")
+
+go_binary(
+    name = "alloc",
+    srcs = ["alloc.go"],
+)
+
+go_pprof(
+    name = "alloc_pprof",
+    binary = ":alloc",
+)
+
+-- alloc.go --
+package main
+
+import (
+	"log"
+	"os"
+	"runtime"
+	"runtime/pprof"
+)
+
+var sink [][]byte
+
+//go:noinline
+func allocate() {
+	for i := 0; i < 100; i++ {
+		sink = append(sink, make([]byte, 1<<16))
+	}
+}
+
+func main() {
+	runtime.MemProfileRate = 1
+	allocate()
+	runtime.GC()
+	f, err := os.Create(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := pprof.Lookup("allocs").WriteTo(f, 0); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+`,
+	})
+}
+
+func TestPprof(t *testing.T) {
+	profile, err := filepath.Abs("alloc.pprof")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bazel_testing.RunBazel("run", "//:alloc", "--", profile); err != nil {
+		t.Fatal(err)
+	}
+
+	// Profiles are named relative to the directory bazel was run in.
+	for _, target := range []string{"//:alloc_pprof", "@io_bazel_rules_go//go/tools/pprof"} {
+		t.Run(target, func(t *testing.T) {
+			out, err := bazel_testing.BazelOutput("run", target, "--", "-top", "-sample_index=alloc_space", "alloc.pprof")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(out), "main.allocate") {
+				t.Errorf("main.allocate not found in output:\n%s", out)
+			}
+		})
+	}
+}
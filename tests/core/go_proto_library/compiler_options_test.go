@@ -0,0 +1,31 @@
+/* Copyright 2020 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package compiler_options_test
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/rules_go/tests/core/go_proto_library/grpc"
+)
+
+func use(interface{}) {}
+
+func TestCompilerOptions(t *testing.T) {
+	// The gRPC types are only generated with the plugins=grpc option.
+	use(grpc.RPCServer(nil))
+	use(grpc.RPCClient(nil))
+	use(&grpc.HelloRequest{})
+}
@@ -0,0 +1,31 @@
+/* Copyright 2020 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package import_remaps_test
+
+import (
+	"testing"
+
+	bar "github.com/bazelbuild/rules_go/tests/core/go_proto_library/bar"
+	foo "github.com/bazelbuild/rules_go/tests/core/go_proto_library/foo_remapped"
+)
+
+func TestImportRemaps(t *testing.T) {
+	// bar.proto imports foo.proto, which was remapped to foo_remapped.
+	b := bar.Bar{Value: &foo.Foo{Value: 42}}
+	if got := b.GetValue().GetValue(); got != 42 {
+		t.Errorf("got %d; want 42", got)
+	}
+}
@@ -0,0 +1,46 @@
+/* Copyright 2020 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package multiple_outputs_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/tests/core/go_proto_library/grpc"
+)
+
+func TestMultipleOutputs(t *testing.T) {
+	want := []string{"HelloRequest", "HelloReply"}
+	if !reflect.DeepEqual(grpc.MessageNames, want) {
+		t.Errorf("MessageNames: got %q; want %q", grpc.MessageNames, want)
+	}
+	use(&grpc.HelloRequest{})
+
+	// The .names.txt file isn't compiled, but it's a default output of the
+	// go_proto_library.
+	data, err := ioutil.ReadFile(os.Getenv("NAMES_TXT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Fields(string(data)); !reflect.DeepEqual(got, want) {
+		t.Errorf("grpc.names.txt: got %q; want %q", got, want)
+	}
+}
+
+func use(interface{}) {}
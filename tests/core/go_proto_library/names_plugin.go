@@ -0,0 +1,49 @@
+/* Copyright 2020 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// names_plugin is a protoc plugin that writes two files for each .proto:
+// a .names.go file declaring a list of message names and a .names.txt file
+// with the same names, one per line.
+package main
+
+import (
+	"strconv"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+func main() {
+	protogen.Options{}.Run(func(gen *protogen.Plugin) error {
+		for _, f := range gen.Files {
+			if !f.Generate {
+				continue
+			}
+			g := gen.NewGeneratedFile(f.GeneratedFilenamePrefix+".names.go", f.GoImportPath)
+			g.P("package ", f.GoPackageName)
+			g.P()
+			g.P("var MessageNames = []string{")
+			for _, m := range f.Messages {
+				g.P(strconv.Quote(string(m.Desc.Name())), ",")
+			}
+			g.P("}")
+
+			t := gen.NewGeneratedFile(f.GeneratedFilenamePrefix+".names.txt", f.GoImportPath)
+			for _, m := range f.Messages {
+				t.P(m.Desc.Name())
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package go_source_roots_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_source_roots")
+
+genrule(
+    name = "gen",
+    outs = ["gen.go"],
+    cmd = "echo 'package lib' > $@",
+)
+
+go_library(
+    name = "lib",
+    srcs = [
+        "lib.go",
+        ":gen",
+    ],
+    importpath = "example.com/lib",
+    deps = ["@io_bazel_rules_go//go/tools/bazel:go_default_library"],
+)
+
+go_source_roots(
+    name = "roots",
+    deps = [":lib"],
+)
+
+go_source_roots(
+    name = "roots_other",
+    deps = [":lib"],
+    dir = "other",
+)
+
+-- lib.go --
+package lib
+
+import _ "github.com/bazelbuild/rules_go/go/tools/bazel"
+
+-- .bazelignore --
+.go_source_roots
+
+-- other/keep.txt --
+`,
+	})
+}
+
+func TestSourceRoots(t *testing.T) {
+	if err := bazel_testing.RunBazel("run", "//:roots"); err != nil {
+		t.Fatal(err)
+	}
+
+	gen := filepath.Join(".go_source_roots", "example.com", "lib", "gen.go")
+	if data, err := ioutil.ReadFile(gen); err != nil {
+		t.Error(err)
+	} else if strings.TrimSpace(string(data)) != "package lib" {
+		t.Errorf("%s: got %q", gen, data)
+	}
+	if _, err := os.Lstat(filepath.Join(".go_source_roots", "example.com", "lib", "lib.go")); !os.IsNotExist(err) {
+		t.Errorf("workspace source lib.go was linked: %v", err)
+	}
+	ext := filepath.Join(".go_source_roots", "github.com", "bazelbuild", "rules_go", "go", "tools", "bazel", "bazel.go")
+	if _, err := os.Stat(ext); err != nil {
+		t.Error(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(".go_source_roots", "source_roots.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mapping struct {
+		Packages []struct {
+			ImportPath string `json:"importpath"`
+			Label      string `json:"label"`
+			Files      []struct {
+				Name string `json:"name"`
+				Path string `json:"path"`
+			} `json:"files"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &mapping); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, p := range mapping.Packages {
+		if p.ImportPath != "example.com/lib" {
+			continue
+		}
+		found = true
+		if p.Label != "//:lib" || len(p.Files) != 1 || !strings.HasSuffix(p.Files[0].Path, "/bin/gen.go") {
+			t.Errorf("unexpected mapping for example.com/lib: %+v", p)
+		}
+	}
+	if !found {
+		t.Errorf("example.com/lib not found in mapping:\n%s", data)
+	}
+}
+
+func TestKeepOtherDir(t *testing.T) {
+	if err := bazel_testing.RunBazel("run", "//:roots_other"); err == nil {
+		t.Fatal("unexpected success")
+	}
+	if _, err := os.Stat(filepath.Join("other", "keep.txt")); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package benchmark_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_benchmark", "go_library")
+
+go_library(
+    name = "sum",
+    srcs = ["sum.go"],
+    importpath = "example.com/sum",
+)
+
+go_benchmark(
+    name = "sum_bench",
+    srcs = ["sum_test.go"],
+    benchmem = True,
+    benchtime = "10x",
+    count = 3,
+    embed = [":sum"],
+)
+
+-- sum.go --
+package sum
+
+func Sum(n int) int {
+	s := 0
+	for i := 0; i < n; i++ {
+		s += i
+	}
+	return s
+}
+
+-- sum_test.go --
+package sum
+
+import "testing"
+
+func TestSum(t *testing.T) {
+	t.Fatal("tests should not run in a go_benchmark")
+}
+
+func BenchmarkSum(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Sum(100)
+	}
+}
+`,
+	})
+}
+
+func TestBenchmarkResults(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:sum_bench"); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.OpenReader("bazel-testlogs/sum_bench/test.outputs/outputs.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name != "benchmark.txt" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := bytes.Count(data, []byte("\nBenchmarkSum")); n != 3 {
+			t.Errorf("got %d results for BenchmarkSum; want 3:\n%s", n, data)
+		}
+		if !bytes.Contains(data, []byte("allocs/op")) {
+			t.Errorf("memory allocations were not reported:\n%s", data)
+		}
+		return
+	}
+	t.Error("benchmark.txt not found in test outputs")
+}
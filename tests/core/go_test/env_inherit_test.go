@@ -0,0 +1,78 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env_inherit_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "inherit_test",
+    srcs = ["inherit_test.go"],
+    env_inherit = ["INHERITED"],
+)
+
+-- inherit_test.go --
+package inherit
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnv(t *testing.T) {
+	if got, want := os.Getenv("INHERITED"), "yes"; got != want {
+		t.Errorf("INHERITED = %q; want %q", got, want)
+	}
+	if got := os.Getenv("NOT_INHERITED"); got != "" {
+		t.Errorf("NOT_INHERITED = %q; want it unset", got)
+	}
+}
+`,
+	})
+}
+
+func TestEnvInherit(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("info", "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(out)), "release %d.%d", &major, &minor); err != nil {
+		t.Skipf("can't parse Bazel version %q", out)
+	}
+	if major < 5 || major == 5 && minor < 2 {
+		t.Skipf("env_inherit requires Bazel 5.2 or later; got %d.%d", major, minor)
+	}
+
+	cmd := bazel_testing.BazelCmd("test", "--test_output=errors", "//:inherit_test")
+	cmd.Env = append(cmd.Env, "INHERITED=yes", "NOT_INHERITED=yes")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel"
+)
+
+func TestLocation(t *testing.T) {
+	path := os.Getenv("DATA_PATH")
+	if want := "tests/core/go_test/x"; path != want {
+		t.Fatalf("DATA_PATH: got %q; want %q", path, want)
+	}
+	if _, err := bazel.Runfile(path); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMakeVariable(t *testing.T) {
+	switch mode := os.Getenv("COMPILATION_MODE"); mode {
+	case "fastbuild", "dbg", "opt":
+	default:
+		t.Errorf("COMPILATION_MODE: got %q; want a compilation mode", mode)
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.16
+// +build go1.16
+
+package example_testdata_test
+
+import (
+	_ "embed"
+	"fmt"
+)
+
+//go:embed testdata/hello.txt
+var hello string
+
+// Examples can print files listed in embedsrcs, which are embedded when the
+// package is compiled.
+func Example_embed() {
+	fmt.Print(hello)
+	// Output:
+	// Hello from testdata!
+}
@@ -0,0 +1,40 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example_only_test
+
+import (
+	"fmt"
+
+	"github.com/bazelbuild/rules_go/tests/core/go_test/example_only"
+)
+
+func ExampleGreet() {
+	fmt.Println(example_only.Greet("gopher"))
+	// Output: Hello, Gopher!
+}
+
+func ExampleGreet_many() {
+	for _, name := range []string{"alice", "bob"} {
+		fmt.Println(example_only.Greet(name))
+	}
+	// Unordered output:
+	// Hello, Bob!
+	// Hello, Alice!
+}
+
+func ExampleGreet_empty() {
+	fmt.Println(example_only.Greet(""))
+	// Output: Hello, !
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package example_output_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "ordered_test",
+    srcs = ["ordered_test.go"],
+)
+
+go_test(
+    name = "unordered_test",
+    srcs = ["unordered_test.go"],
+)
+
+go_test(
+    name = "empty_test",
+    srcs = ["empty_test.go"],
+)
+
+go_test(
+    name = "no_output_test",
+    srcs = ["no_output_test.go"],
+)
+
+-- ordered_test.go --
+package ordered_test
+
+import "fmt"
+
+func ExampleOrdered() {
+	fmt.Println("b")
+	fmt.Println("a")
+	// Output:
+	// a
+	// b
+}
+
+-- unordered_test.go --
+package unordered
+
+import "fmt"
+
+func ExampleUnordered() {
+	fmt.Println("b")
+	fmt.Println("c")
+	// Unordered output:
+	// a
+	// b
+}
+
+-- empty_test.go --
+package empty
+
+import "fmt"
+
+func ExampleEmpty() {
+	fmt.Println("unexpected")
+	// Output:
+}
+
+-- no_output_test.go --
+package no_output
+
+func ExampleNoOutput() {
+	panic("examples without output comments are compiled but not run")
+}
+`,
+	})
+}
+
+func TestMismatchedOutput(t *testing.T) {
+	for _, tc := range []struct {
+		target, want string
+	}{
+		{"//:ordered_test", "--- FAIL: ExampleOrdered"},
+		{"//:unordered_test", "--- FAIL: ExampleUnordered"},
+		{"//:empty_test", "--- FAIL: ExampleEmpty"},
+	} {
+		t.Run(tc.target, func(t *testing.T) {
+			cmd := bazel_testing.BazelCmd("test", "--test_output=errors", tc.target)
+			out, err := cmd.CombinedOutput()
+			if err == nil {
+				t.Fatal("unexpected success")
+			}
+			if !strings.Contains(string(out), tc.want) {
+				t.Errorf("got output:\n%s\nwant it to contain %q", out, tc.want)
+			}
+		})
+	}
+}
+
+func TestNoOutput(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:no_output_test"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package failure_hook_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+sh_binary(
+    name = "hook",
+    srcs = ["hook.sh"],
+)
+
+go_test(
+    name = "pass_test",
+    srcs = ["pass_test.go"],
+    failure_hook = ":hook",
+)
+
+go_test(
+    name = "fail_test",
+    srcs = ["fail_test.go"],
+    failure_hook = ":hook",
+)
+
+-- hook.sh --
+#!/bin/sh
+echo "hook ran for $GO_TEST_PACKAGE"
+test -d "$1" && echo "hook outputs dir exists"
+
+-- pass_test.go --
+package pass_test
+
+import "testing"
+
+func TestPass(t *testing.T) {}
+
+-- fail_test.go --
+package fail_test
+
+import "testing"
+
+func TestFail(t *testing.T) {
+	t.Fatal("fails")
+}
+`,
+	})
+}
+
+func TestPass(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:pass_test"); err != nil {
+		t.Fatal(err)
+	}
+	log, err := ioutil.ReadFile("bazel-testlogs/pass_test/test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(log), "hook ran") {
+		t.Errorf("hook ran for passing test:\n%s", log)
+	}
+}
+
+func TestFail(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:fail_test"); err == nil {
+		t.Fatal("got success; want failure")
+	} else if bErr, ok := err.(*bazel_testing.StderrExitError); !ok || bErr.Err.ExitCode() != 3 {
+		t.Fatalf("got %v; want exit code 3 (tests failed)", err)
+	}
+	log, err := ioutil.ReadFile("bazel-testlogs/fail_test/test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"running failure hook",
+		"hook ran for",
+		"hook outputs dir exists",
+	} {
+		if !strings.Contains(string(log), want) {
+			t.Errorf("%q not found in log:\n%s", want, log)
+		}
+	}
+}
+
+func TestHookTimeout(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:fail_test", "--test_env=GO_TEST_FAILURE_HOOK_TIMEOUT=1ns"); err == nil {
+		t.Fatal("got success; want failure")
+	}
+	log, err := ioutil.ReadFile("bazel-testlogs/fail_test/test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(log), "timed out after 1ns") {
+		t.Errorf("hook timeout not reported in log:\n%s", log)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fuzz_test
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_fuzz_test", "go_library")
+
+go_library(
+    name = "parse",
+    srcs = ["parse.go"],
+    importpath = "example.com/parse",
+)
+
+go_fuzz_test(
+    name = "fuzz_parse_test",
+    srcs = [
+        "fuzz_test.go",
+        "parse_test.go",
+    ],
+    embed = [":parse"],
+    fuzz = "FuzzParse",
+    fuzztime = "100x",
+)
+
+-- parse.go --
+package parse
+
+func Parse(s string) int {
+	return len(s)
+}
+
+-- parse_test.go --
+package parse
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	if _, err := os.Stat("testdata/fuzz/FuzzParse/seed"); err != nil {
+		println("seed corpus is missing:", err.Error())
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestOther(t *testing.T) {
+	t.Fatal("only the fuzz target should run")
+}
+
+-- fuzz_test.go --
+// +build go1.18
+
+package parse
+
+import "testing"
+
+func FuzzParse(f *testing.F) {
+	f.Add("hello")
+	f.Fuzz(func(t *testing.T, s string) {
+		if Parse(s) != len(s) {
+			t.Fatal("bad length")
+		}
+	})
+}
+
+-- testdata/fuzz/FuzzParse/seed --
+go test fuzz v1
+string("seed")
+`,
+	})
+}
+
+func TestRegression(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:fuzz_parse_test"); err != nil {
+		t.Fatal(err)
+	}
+}
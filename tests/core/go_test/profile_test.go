@@ -0,0 +1,97 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package profile_test
+
+import (
+	"archive/zip"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "profile_test",
+    srcs = ["profile_test.go"],
+    profiles = ["cpu", "mem"],
+)
+
+-- profile_test.go --
+package profile_test
+
+import "testing"
+
+func TestProfile(t *testing.T) {
+	s := make([]int, 0)
+	for i := 0; i < 1000; i++ {
+		s = append(s, i)
+	}
+}
+`,
+	})
+}
+
+// outputFiles returns the sorted names of the files in the test's
+// undeclared outputs.
+func outputFiles(t *testing.T) []string {
+	t.Helper()
+	r, err := zip.OpenReader("bazel-testlogs/profile_test/test.outputs/outputs.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestProfiles(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		args []string
+		want string
+	}{
+		{
+			desc: "attribute",
+			want: "cpu.pprof mem.pprof",
+		},
+		{
+			desc: "env",
+			args: []string{"--test_env=GO_TEST_PROFILES=mutex,trace"},
+			want: "mutex.pprof trace.out",
+		},
+	} {
+		t.Run(tc.desc, func(t *testing.T) {
+			args := append([]string{"test", "--nocache_test_results"}, tc.args...)
+			args = append(args, "//:profile_test")
+			if err := bazel_testing.RunBazel(args...); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(outputFiles(t), " "); got != tc.want {
+				t.Errorf("got outputs %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "flaky_test",
+    srcs = ["flaky_test.go"],
+    retries = 1,
+)
+
+go_test(
+    name = "broken_test",
+    srcs = ["broken_test.go"],
+    retries = 2,
+)
+
+-- flaky_test.go --
+package flaky_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOK(t *testing.T) {}
+
+func TestFlaky(t *testing.T) {
+	path := filepath.Join(os.Getenv("TEST_TMPDIR"), "flaky")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(path, nil, 0666); err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal("first attempt fails")
+	}
+}
+
+-- broken_test.go --
+package broken_test
+
+import "testing"
+
+func TestOK(t *testing.T) {}
+
+func TestBroken(t *testing.T) {
+	t.Fatal("always fails")
+}
+`,
+	})
+}
+
+func TestFlaky(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:flaky_test"); err != nil {
+		t.Fatal(err)
+	}
+	log, err := ioutil.ReadFile("bazel-testlogs/flaky_test/test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(log), "=== RUN   TestOK"); n != 1 {
+		t.Errorf("TestOK ran %d times; want 1", n)
+	}
+	if !strings.Contains(string(log), "failed tests passed when retried: TestFlaky") {
+		t.Errorf("retry not reported in log:\n%s", log)
+	}
+	xml, err := ioutil.ReadFile("bazel-testlogs/flaky_test/test.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(xml), "<failure") {
+		t.Errorf("test.xml reports a failure:\n%s", xml)
+	}
+}
+
+func TestBroken(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:broken_test"); err == nil {
+		t.Fatal("got success; want failure")
+	} else if bErr, ok := err.(*bazel_testing.StderrExitError); !ok || bErr.Err.ExitCode() != 3 {
+		t.Fatalf("got %v; want exit code 3 (tests failed)", err)
+	}
+	log, err := ioutil.ReadFile("bazel-testlogs/broken_test/test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"retrying failed tests (attempt 1 of 2): TestBroken",
+		"retrying failed tests (attempt 2 of 2): TestBroken",
+	} {
+		if !strings.Contains(string(log), want) {
+			t.Errorf("%q not found in log:\n%s", want, log)
+		}
+	}
+	if n := strings.Count(string(log), "=== RUN   TestOK"); n != 1 {
+		t.Errorf("TestOK ran %d times; want 1", n)
+	}
+}
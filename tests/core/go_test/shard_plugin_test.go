@@ -0,0 +1,92 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard_plugin_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "plugin_test",
+    srcs = ["plugin_test.go"],
+    data = [
+        "select_a.sh",
+        "select_unknown.sh",
+    ],
+    shard_count = 2,
+)
+
+-- plugin_test.go --
+package plugin_test
+
+import "testing"
+
+func TestA(t *testing.T) {}
+
+func TestB(t *testing.T) {
+	t.Fatal("TestB was not selected by the shard plugin")
+}
+
+func TestC(t *testing.T) {
+	t.Fatal("TestC was not selected by the shard plugin")
+}
+
+-- select_a.sh --
+#!/bin/sh
+[ "$TEST_TARGET" = //:plugin_test ] || exit 1
+[ -n "$TEST_SHARD_INDEX" ] || exit 1
+grep -x TestA
+
+-- select_unknown.sh --
+#!/bin/sh
+echo TestD
+`,
+		SetUp: func() error {
+			for _, name := range []string{"select_a.sh", "select_unknown.sh"} {
+				if err := os.Chmod(name, 0777); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+func TestPlugin(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "--test_env=GO_TEST_SHARD_PLUGIN=./select_a.sh", "//:plugin_test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithoutPlugin(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:plugin_test"); err == nil {
+		t.Fatal("unexpected success")
+	}
+}
+
+func TestUnknownTest(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "--test_env=GO_TEST_SHARD_PLUGIN=./select_unknown.sh", "//:plugin_test"); err == nil {
+		t.Fatal("unexpected success")
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shard_timings_test
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "timed_test",
+    srcs = ["timed_test.go"],
+    shard_count = 2,
+    shard_timings = "timings.txt",
+)
+
+-- timed_test.go --
+package timed_test
+
+import "testing"
+
+func TestSlow(t *testing.T) {}
+
+func TestA(t *testing.T) {}
+
+func TestB(t *testing.T) {}
+
+func TestC(t *testing.T) {}
+
+-- timings.txt --
+TestSlow 30
+TestA 10
+TestB 10
+TestC 10
+`,
+	})
+}
+
+var passRe = regexp.MustCompile(`(?m)^--- PASS: (\w+)`)
+
+func TestShardTimings(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:timed_test"); err != nil {
+		t.Fatal(err)
+	}
+
+	var shards []string
+	for _, shard := range []string{"shard_1_of_2", "shard_2_of_2"} {
+		log, err := ioutil.ReadFile("bazel-testlogs/timed_test/" + shard + "/test.log")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, m := range passRe.FindAllStringSubmatch(string(log), -1) {
+			names = append(names, m[1])
+		}
+		sort.Strings(names)
+		shards = append(shards, strings.Join(names, " "))
+
+		r, err := zip.OpenReader("bazel-testlogs/timed_test/" + shard + "/test.outputs/outputs.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := false
+		for _, f := range r.File {
+			found = found || f.Name == "shard_timings.txt"
+		}
+		r.Close()
+		if !found {
+			t.Errorf("%s: shard_timings.txt not found in test outputs", shard)
+		}
+	}
+	sort.Strings(shards)
+	if want := []string{"TestA TestB TestC", "TestSlow"}; strings.Join(shards, ",") != strings.Join(want, ",") {
+		t.Errorf("got shards %q; want %q", shards, want)
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testmain_errors_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "multiple_test",
+    srcs = [
+        "multiple_internal_test.go",
+        "multiple_external_test.go",
+    ],
+    importpath = "example.com/multiple",
+)
+
+go_test(
+    name = "signature_test",
+    srcs = ["signature_test.go"],
+)
+
+-- multiple_internal_test.go --
+package multiple
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+-- multiple_external_test.go --
+package multiple_test
+
+import (
+	"os"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(m.Run())
+}
+
+-- signature_test.go --
+package signature
+
+import "testing"
+
+func TestMain(t *testing.T) {}
+`,
+	})
+}
+
+func TestErrors(t *testing.T) {
+	for _, tc := range []struct {
+		target, want string
+	}{
+		{"//:multiple_test", "multiple definitions of TestMain"},
+		{"//:signature_test", "wrong signature for TestMain, must be: func TestMain(m *testing.M)"},
+	} {
+		t.Run(tc.target, func(t *testing.T) {
+			err := bazel_testing.RunBazel("build", tc.target)
+			if err == nil {
+				t.Fatal("unexpected success")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("got error:\n%v\nwant it to contain %q", err, tc.want)
+			}
+		})
+	}
+}
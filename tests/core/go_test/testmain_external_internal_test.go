@@ -0,0 +1,9 @@
+package testmain_external
+
+import "testing"
+
+func TestInternal(t *testing.T) {
+	if !Setup {
+		t.Error("TestMain in the external test package did not run before internal tests")
+	}
+}
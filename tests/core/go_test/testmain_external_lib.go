@@ -0,0 +1,4 @@
+package testmain_external
+
+// Setup is set by TestMain in the external test package.
+var Setup bool
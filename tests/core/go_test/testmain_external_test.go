@@ -0,0 +1,19 @@
+package testmain_external_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/tests/core/go_test/testmain_external"
+)
+
+func TestMain(m *testing.M) {
+	testmain_external.Setup = true
+	os.Exit(m.Run())
+}
+
+func TestExternal(t *testing.T) {
+	if !testmain_external.Setup {
+		t.Error("TestMain did not run")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeout_test
+
+import (
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "hang_test",
+    srcs = ["hang_test.go"],
+)
+
+-- hang_test.go --
+package hang_test
+
+import (
+	"testing"
+	"time"
+)
+
+func waitForever() {
+	time.Sleep(time.Hour)
+}
+
+func TestHang(t *testing.T) {
+	waitForever()
+}
+`,
+	})
+}
+
+func TestTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("goroutines can't be printed on Windows")
+	}
+	if err := bazel_testing.RunBazel("test", "--test_timeout=3", "//:hang_test"); err == nil {
+		t.Fatal("got success; want failure")
+	} else if bErr, ok := err.(*bazel_testing.StderrExitError); !ok || bErr.Err.ExitCode() != 3 {
+		t.Fatalf("got %v; want exit code 3 (tests failed)", err)
+	}
+	log, err := ioutil.ReadFile("bazel-testlogs/hang_test/test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"sent SIGQUIT to print goroutines",
+		"SIGQUIT: quit",
+		"hang_test.waitForever",
+	} {
+		if !strings.Contains(string(log), want) {
+			t.Errorf("%q not found in log:\n%s", want, log)
+		}
+	}
+}
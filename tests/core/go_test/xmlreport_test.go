@@ -93,6 +93,20 @@ type xmlTestSuites struct {
 	Suites  []xmlTestSuite `xml:"testsuite"`
 }
 
+// xmlTestCases is used to check the summary messages and output recorded for
+// individual tests.
+type xmlTestCases struct {
+	Suite struct {
+		TestCases []struct {
+			Name    string `xml:"name,attr"`
+			Failure *struct {
+				Message string `xml:"message,attr"`
+			} `xml:"failure"`
+			SystemOut string `xml:"system-out"`
+		} `xml:"testcase"`
+	} `xml:"testsuite"`
+}
+
 func Test(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -100,8 +114,8 @@ func Test(t *testing.T) {
 		expected xmlTestSuites
 	}{
 		{
-			name: "default",
-			args: []string{"test", "//:xml_test"},
+			name: "quiet",
+			args: []string{"test", "--test_env=GO_TEST_WRAP_TESTV=0", "//:xml_test"},
 			expected: xmlTestSuites{
 				XMLName: xml.Name{Local: "testsuites"},
 				Suites: []xmlTestSuite{{
@@ -114,8 +128,8 @@ func Test(t *testing.T) {
 			},
 		},
 		{
-			name: "verbose",
-			args: []string{"test", "--test_env=GO_TEST_WRAP_TESTV=1", "//:xml_test"},
+			name: "default",
+			args: []string{"test", "//:xml_test"},
 			expected: xmlTestSuites{
 				XMLName: xml.Name{Local: "testsuites"},
 				Suites: []xmlTestSuite{{
@@ -142,7 +156,7 @@ func Test(t *testing.T) {
 
 			p, err := bazel_testing.BazelOutput("info", "bazel-testlogs")
 			if err != nil {
-				t.Fatal("could not find testlog root: %s", err)
+				t.Fatalf("could not find testlog root: %s", err)
 			}
 			path := filepath.Join(strings.TrimSpace(string(p)), "xml_test/test.xml")
 			b, err := ioutil.ReadFile(path)
@@ -158,6 +172,23 @@ func Test(t *testing.T) {
 			if !reflect.DeepEqual(suites, tt.expected) {
 				t.Fatalf("expected %#v, got: %#v", tt.expected, suites)
 			}
+
+			var cases xmlTestCases
+			if err := xml.Unmarshal(b, &cases); err != nil {
+				t.Fatalf("could not unmarshall generated xml: %s", err)
+			}
+			for _, c := range cases.Suite.TestCases {
+				switch c.Name {
+				case "TestFail":
+					if c.Failure == nil || !strings.HasSuffix(c.Failure.Message, ": Not working") {
+						t.Errorf("TestFail: got failure %#v, want message ending with %q", c.Failure, ": Not working")
+					}
+				case "TestPassLog":
+					if !strings.Contains(c.SystemOut, "pass") {
+						t.Errorf("TestPassLog: logged output not found in system-out: %q", c.SystemOut)
+					}
+				}
+			}
 		})
 	}
 }
@@ -0,0 +1,155 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modules_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_module", "go_modules")
+
+go_module(
+    name = "module",
+    path = "example.com/repo",
+)
+
+go_modules(
+    name = "modules",
+    modules = [
+        ":module",
+        "//tools:module",
+    ],
+    visibility = ["//visibility:public"],
+)
+
+-- util/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "util",
+    srcs = ["util.go"],
+    visibility = ["//visibility:public"],
+)
+
+-- util/util.go --
+package util
+
+const Name = "util"
+
+-- tools/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_module")
+
+go_module(
+    name = "module",
+    path = "example.com/tools",
+    go = "1.12",
+    visibility = ["//visibility:public"],
+)
+
+-- tools/lib/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "go_default_library",
+    srcs = ["lib.go"],
+    visibility = ["//visibility:public"],
+)
+
+-- tools/lib/lib.go --
+package lib
+
+const Name = "lib"
+
+-- tools/cmd/cli/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "cli",
+    srcs = ["main.go"],
+    deps = [
+        "//tools/lib:go_default_library",
+        "//util",
+    ],
+)
+
+-- tools/cmd/cli/main.go --
+package main
+
+import (
+	"fmt"
+
+	"example.com/repo/util"
+	"example.com/tools/lib"
+)
+
+func main() {
+	fmt.Println(lib.Name, util.Name)
+}
+
+-- tools/newsyntax/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "newsyntax",
+    srcs = ["newsyntax.go"],
+)
+
+-- tools/newsyntax/newsyntax.go --
+package newsyntax
+
+const X = 0b101
+`,
+	})
+}
+
+const modulesFlag = "--@io_bazel_rules_go//go/config:modules=//:modules"
+
+func TestInferredImportPaths(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("run", modulesFlag, "//tools/cmd/cli")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(bytes.TrimSpace(out)), "lib util"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestModuleLanguageVersion(t *testing.T) {
+	err := bazel_testing.RunBazel("build", modulesFlag, "//tools/newsyntax")
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	if !strings.Contains(err.Error(), "requires go1.13") {
+		t.Errorf("did not find expected error in:\n%v", err)
+	}
+}
+
+func TestNoModules(t *testing.T) {
+	err := bazel_testing.RunBazel("build", "//util")
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	if !strings.Contains(err.Error(), "importpath must be specified") {
+		t.Errorf("did not find expected error in:\n%v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package baseline_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_tool_library", "nogo")
+
+nogo(
+    name = "nogo",
+    baseline = "nogo_baseline.txt",
+    deps = [":nofoo"],
+    visibility = ["//visibility:public"],
+)
+
+go_tool_library(
+    name = "nofoo",
+    srcs = ["nofoo.go"],
+    importpath = "nofoo",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+go_library(
+    name = "old",
+    srcs = ["old.go"],
+    importpath = "example.com/old",
+)
+
+go_library(
+    name = "new",
+    srcs = ["new.go"],
+    importpath = "example.com/new",
+)
+
+-- nogo_baseline.txt --
+# Known nogo findings.
+old.go	nofoo	e71181b5aadc7ed5
+
+-- nofoo.go --
+package nofoo
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "nofoo",
+	Doc:  "reports functions named Foo",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, f := range pass.Files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "Foo" {
+				pass.Reportf(fn.Name.Pos(), "function named Foo")
+			}
+		}
+	}
+	return nil, nil
+}
+
+-- old.go --
+package old
+
+func Foo() {}
+
+-- new.go --
+package new
+
+func Foo() {}
+`,
+	})
+}
+
+func TestBaselineFinding(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:old"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewFinding(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("build", "//:new")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("unexpected success")
+	}
+	if !strings.Contains(stderr.String(), "new.go:3:6: function named Foo") {
+		t.Errorf("finding in new.go was not reported:\n%s", stderr)
+	}
+}
+
+func TestGenerateBaseline(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "--@io_bazel_rules_go//go/config:nogo_sarif", "--output_groups=nogo_sarif", "//:old", "//:new"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bazel_testing.RunBazel("run", "@io_bazel_rules_go//go/tools/nogo/baseline", "--", "-o", "generated.txt"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile("generated.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Findings already in the baseline are kept.
+	want := "new.go\tnofoo\te71181b5aadc7ed5\n" +
+		"old.go\tnofoo\te71181b5aadc7ed5\n"
+	if got := string(data); !strings.HasSuffix(got, want) {
+		t.Errorf("got baseline:\n%s\nwant it to end with:\n%s", got, want)
+	}
+}
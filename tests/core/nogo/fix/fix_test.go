@@ -0,0 +1,131 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fix_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_tool_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = [":renamefoo"],
+    visibility = ["//visibility:public"],
+)
+
+go_tool_library(
+    name = "renamefoo",
+    srcs = ["renamefoo.go"],
+    importpath = "renamefoo",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+-- renamefoo.go --
+package renamefoo
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "renamefoo",
+	Doc:  "suggests renaming functions named Foo to Bar",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, f := range pass.Files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if !ok || id.Name != "Foo" {
+				return true
+			}
+			pass.Report(analysis.Diagnostic{
+				Pos:     id.Pos(),
+				End:     id.End(),
+				Message: "Foo should be named Bar",
+				SuggestedFixes: []analysis.SuggestedFix{{
+					Message:   "rename to Bar",
+					TextEdits: []analysis.TextEdit{{Pos: id.Pos(), End: id.End(), NewText: []byte("Bar")}},
+				}},
+			})
+			return true
+		})
+	}
+	return nil, nil
+}
+
+-- lib.go --
+package lib
+
+func Foo() {}
+
+func Call() {
+	Foo()
+}
+`,
+	})
+}
+
+func Test(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:lib"); err == nil {
+		t.Fatal("build without nogo_fix: unexpected success")
+	}
+
+	cmd := bazel_testing.BazelCmd("build", "--@io_bazel_rules_go//go/config:nogo_fix", "--output_groups=nogo_fix", "//:lib")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("build with nogo_fix: %v\n%s", err, stderr.Bytes())
+	}
+	if !strings.Contains(stderr.String(), "Foo should be named Bar") {
+		t.Errorf("findings were not printed:\n%s", stderr.Bytes())
+	}
+
+	if err := bazel_testing.RunBazel("run", "@io_bazel_rules_go//go/tools/nogo:fix"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile("lib.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "package lib\n\nfunc Bar() {}\n\nfunc Call() {\n\tBar()\n}\n"
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := bazel_testing.RunBazel("build", "//:lib"); err != nil {
+		t.Fatalf("build after fixing: %v", err)
+	}
+}
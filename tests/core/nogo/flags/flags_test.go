@@ -0,0 +1,138 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flags_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_tool_library", "nogo")
+
+nogo(
+    name = "nogo",
+    config = "config.json",
+    deps = [":funcname"],
+    visibility = ["//visibility:public"],
+)
+
+go_tool_library(
+    name = "funcname",
+    srcs = ["funcname.go"],
+    importpath = "funcname",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+-- config.json --
+{
+  "funcname": {
+    "analyzer_flags": {
+      "name": "Bar"
+    }
+  }
+}
+
+-- funcname.go --
+package funcname
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "funcname",
+	Doc:  "reports functions with the name given by the name flag",
+	Run:  run,
+}
+
+var name string
+
+func init() {
+	Analyzer.Flags.StringVar(&name, "name", "Foo", "the name of functions to report")
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, f := range pass.Files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == name {
+				pass.Reportf(fn.Name.Pos(), "function named %s", name)
+			}
+		}
+	}
+	return nil, nil
+}
+
+-- lib.go --
+package lib
+
+func Foo() {}
+
+func Bar() {}
+`,
+	})
+}
+
+func TestConfiguredFlag(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("build", "//:lib")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("unexpected success")
+	}
+	if !strings.Contains(stderr.String(), "lib.go:5:6: function named Bar") {
+		t.Errorf("configured name was not reported:\n%s", stderr)
+	}
+	if strings.Contains(stderr.String(), "function named Foo") {
+		t.Errorf("default name was reported:\n%s", stderr)
+	}
+}
+
+func TestUnknownFlag(t *testing.T) {
+	orig, err := ioutil.ReadFile("config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ioutil.WriteFile("config.json", orig, 0666)
+	config := `{"funcname": {"analyzer_flags": {"nope": "1"}}}`
+	if err := ioutil.WriteFile("config.json", []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+	cmd := bazel_testing.BazelCmd("build", "//:lib")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("unexpected success")
+	}
+	if !strings.Contains(stderr.String(), `analyzer "funcname" has no flag "nope"`) {
+		t.Errorf("unknown flag was not reported:\n%s", stderr)
+	}
+}
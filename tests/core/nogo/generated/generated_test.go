@@ -0,0 +1,168 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generated_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_tool_library", "nogo")
+
+nogo(
+    name = "nogo",
+    config = "config.json",
+    deps = [
+        ":badname",
+        ":badname_all",
+    ],
+    visibility = ["//visibility:public"],
+)
+
+go_tool_library(
+    name = "badname",
+    srcs = ["badname/badname.go"],
+    importpath = "badname",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+go_tool_library(
+    name = "badname_all",
+    srcs = ["badname_all/badname_all.go"],
+    importpath = "badname_all",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+go_library(
+    name = "lib",
+    srcs = [
+        "gen.go",
+        "lib.pb.go",
+        "plain.go",
+    ],
+    importpath = "example.com/lib",
+)
+
+-- config.json --
+{
+  "badname": {
+    "exclude_generated": true
+  }
+}
+
+-- badname/badname.go --
+package badname
+
+import (
+	"go/ast"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "badname",
+	Doc:  "reports functions with names starting with Bad",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && strings.HasPrefix(fn.Name.Name, "Bad") {
+					pass.Reportf(fn.Name.Pos(), "badname: function named %s", fn.Name.Name)
+				}
+			}
+		}
+		return nil, nil
+	},
+}
+
+-- badname_all/badname_all.go --
+package badname_all
+
+import (
+	"go/ast"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "badname_all",
+	Doc:  "reports functions with names starting with Bad, including in generated files",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && strings.HasPrefix(fn.Name.Name, "Bad") {
+					pass.Reportf(fn.Name.Pos(), "badname_all: function named %s", fn.Name.Name)
+				}
+			}
+		}
+		return nil, nil
+	},
+}
+
+-- gen.go --
+// Code generated by hand for testing. DO NOT EDIT.
+
+package lib
+
+func BadGenerated() {}
+
+-- lib.pb.go --
+package lib
+
+func BadProto() {}
+
+-- plain.go --
+package lib
+
+func BadPlain() {}
+`,
+	})
+}
+
+func TestExcludeGenerated(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("build", "//:lib")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("unexpected success")
+	}
+	for _, want := range []string{
+		"badname: function named BadPlain",
+		"badname_all: function named BadPlain",
+		"badname_all: function named BadGenerated",
+		"badname_all: function named BadProto",
+	} {
+		if !strings.Contains(stderr.String(), want) {
+			t.Errorf("did not find %q in output:\n%s", want, stderr)
+		}
+	}
+	for _, notWant := range []string{
+		"badname: function named BadGenerated",
+		"badname: function named BadProto",
+	} {
+		if strings.Contains(stderr.String(), notWant) {
+			t.Errorf("found %q in output:\n%s", notWant, stderr)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package incremental_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_tool_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = [
+        ":badcall",
+        ":nofoo",
+    ],
+    visibility = ["//visibility:public"],
+)
+
+go_tool_library(
+    name = "badcall",
+    srcs = ["badcall.go"],
+    importpath = "badcall",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+go_tool_library(
+    name = "nofoo",
+    srcs = ["nofoo.go"],
+    importpath = "nofoo",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+go_library(
+    name = "dep",
+    srcs = ["dep.go"],
+    importpath = "example.com/dep",
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+    deps = [":dep"],
+)
+
+go_library(
+    name = "bad",
+    srcs = ["bad.go"],
+    importpath = "example.com/bad",
+    deps = [":dep"],
+)
+
+-- badcall.go --
+package badcall
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+type isBad struct{}
+
+func (*isBad) AFact() {}
+
+var Analyzer = &analysis.Analyzer{
+	Name:      "badcall",
+	Doc:       "reports calls to functions named Bad in other packages",
+	FactTypes: []analysis.Fact{new(isBad)},
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.FuncDecl:
+					if strings.HasPrefix(n.Name.Name, "Bad") {
+						pass.ExportObjectFact(pass.TypesInfo.Defs[n.Name], new(isBad))
+					}
+				case *ast.SelectorExpr:
+					fn, ok := pass.TypesInfo.Uses[n.Sel].(*types.Func)
+					if ok && fn.Pkg() != pass.Pkg && pass.ImportObjectFact(fn, new(isBad)) {
+						pass.Reportf(n.Pos(), "call to bad function %s", fn.Name())
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+-- nofoo.go --
+package nofoo
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "nofoo",
+	Doc:  "reports functions named Foo",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "Foo" {
+					pass.Reportf(fn.Pos(), "function named Foo")
+				}
+			}
+		}
+		return nil, nil
+	},
+}
+
+-- dep.go --
+package dep
+
+//go:noinline
+func Good() int {
+	return 1
+}
+
+func BadThing() {}
+
+-- lib.go --
+package lib
+
+import "example.com/dep"
+
+func Lib() int {
+	return dep.Good()
+}
+
+-- bad.go --
+package bad
+
+import "example.com/dep"
+
+func Bad() {
+	dep.BadThing()
+}
+`,
+	})
+}
+
+func TestFactsFromDependency(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("build", "//:bad")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err == nil {
+		t.Fatal("unexpected success")
+	}
+	if !bytes.Contains(stderr.Bytes(), []byte("call to bad function BadThing")) {
+		t.Errorf("finding not reported:\n%s", stderr.Bytes())
+	}
+}
+
+func TestBodyChange(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:lib"); err != nil {
+		t.Fatal(err)
+	}
+
+	depData, err := ioutil.ReadFile("dep.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ioutil.WriteFile("dep.go", depData, 0666)
+	newDepData := bytes.Replace(depData, []byte("return 1"), []byte("return 2"), 1)
+	if err := ioutil.WriteFile("dep.go", newDepData, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	logPath, err := filepath.Abs("exec.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bazel_testing.RunBazel("build", "--execution_log_json_file="+logPath, "//:lib"); err != nil {
+		t.Fatal(err)
+	}
+	ran, err := nogoActions(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"GoNogoFacts dep.x", "GoNogo dep.nogo"} {
+		if !ran[want] {
+			t.Errorf("%s did not run after dep.go changed", want)
+		}
+	}
+	for _, notWant := range []string{"GoNogoFacts lib.x", "GoNogo lib.nogo"} {
+		if ran[notWant] {
+			t.Errorf("%s ran, but the export data and facts of its dependencies didn't change", notWant)
+		}
+	}
+}
+
+// nogoActions returns the mnemonics and output file names of the nogo
+// actions in an execution log, like "GoNogoFacts dep.x".
+func nogoActions(logPath string) (map[string]bool, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ran := make(map[string]bool)
+	dec := json.NewDecoder(f)
+	for {
+		var spawn struct {
+			Mnemonic      string
+			ListedOutputs []string
+		}
+		if err := dec.Decode(&spawn); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(spawn.Mnemonic, "GoNogo") {
+			continue
+		}
+		for _, out := range spawn.ListedOutputs {
+			ran[spawn.Mnemonic+" "+filepath.Base(out)] = true
+		}
+	}
+	return ran, nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package modes_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library", "go_tool_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = [":nofoo"],
+    visibility = ["//visibility:public"],
+)
+
+go_tool_library(
+    name = "nofoo",
+    srcs = ["nofoo.go"],
+    importpath = "nofoo",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_binary(
+    name = "bin",
+    srcs = ["bin.go"],
+    deps = [":lib"],
+)
+
+go_library(
+    name = "foo",
+    srcs = ["foo.go"],
+    importpath = "example.com/foo",
+)
+
+go_binary(
+    name = "foo_bin",
+    srcs = ["foo_bin.go"],
+    deps = [":foo"],
+)
+
+-- nofoo.go --
+package nofoo
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "nofoo",
+	Doc:  "reports functions named Foo",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, f := range pass.Files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "Foo" {
+				pass.Reportf(fn.Pos(), "function named Foo")
+			}
+		}
+	}
+	return nil, nil
+}
+
+-- lib.go --
+package lib
+
+func Bar() {}
+
+-- foo.go --
+package foo
+
+func Foo() {}
+
+-- bin.go --
+package main
+
+import "example.com/lib"
+
+func main() {
+	lib.Bar()
+}
+
+-- foo_bin.go --
+package main
+
+import "example.com/foo"
+
+func main() {
+	foo.Foo()
+}
+`,
+	})
+}
+
+func TestCachedAcrossModes(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:bin"); err != nil {
+		t.Fatal(err)
+	}
+
+	logPath, err := filepath.Abs("exec.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bazel_testing.RunBazel("build", "--@io_bazel_rules_go//go/config:race", "--execution_log_json_file="+logPath, "//:bin"); err != nil {
+		t.Fatal(err)
+	}
+	log, err := ioutil.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for _, m := range regexp.MustCompile(`"mnemonic": "(\w+)"`).FindAllSubmatch(log, -1) {
+		counts[string(m[1])]++
+	}
+	if counts["GoCompilePkg"] == 0 {
+		t.Errorf("packages were not compiled again in race mode")
+	}
+	for _, mnemonic := range []string{"GoNogoFacts", "GoNogo"} {
+		if n := counts[mnemonic]; n != 0 {
+			t.Errorf("got %d %s actions in race mode; want 0", n, mnemonic)
+		}
+	}
+}
+
+func TestFindingsFailBuild(t *testing.T) {
+	for _, args := range [][]string{
+		{"build", "//:foo_bin"},
+		{"build", "--@io_bazel_rules_go//go/config:race", "//:foo_bin"},
+		{"build", "//:foo"},
+	} {
+		cmd := bazel_testing.BazelCmd(args...)
+		stderr := &bytes.Buffer{}
+		cmd.Stderr = stderr
+		if err := cmd.Run(); err == nil {
+			t.Errorf("bazel %s: unexpected success", strings.Join(args, " "))
+		} else if !bytes.Contains(stderr.Bytes(), []byte("function named Foo")) {
+			t.Errorf("bazel %s: finding not reported:\n%s", strings.Join(args, " "), stderr.Bytes())
+		}
+	}
+}
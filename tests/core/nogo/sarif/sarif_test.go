@@ -0,0 +1,180 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sarif_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_tool_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = [":nofoo"],
+    visibility = ["//visibility:public"],
+)
+
+go_tool_library(
+    name = "nofoo",
+    srcs = ["nofoo.go"],
+    importpath = "nofoo",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+-- nofoo.go --
+package nofoo
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "nofoo",
+	Doc:  "reports functions named Foo",
+	Run:  run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	for _, f := range pass.Files {
+		for _, decl := range f.Decls {
+			if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "Foo" {
+				pass.Report(analysis.Diagnostic{
+					Pos:     fn.Name.Pos(),
+					End:     fn.Name.End(),
+					Message: "function named Foo",
+				})
+			}
+		}
+	}
+	return nil, nil
+}
+
+-- lib.go --
+package lib
+
+// Ünïcode comment.
+/* é */ func Foo() {}
+`,
+	})
+}
+
+type region struct {
+	StartLine, StartColumn, EndLine, EndColumn int
+}
+
+type report struct {
+	Version string
+	Runs    []struct {
+		Tool struct {
+			Driver struct {
+				Name  string
+				Rules []struct {
+					ID               string
+					ShortDescription struct{ Text string }
+				}
+			}
+		}
+		Results []struct {
+			RuleID    string
+			Level     string
+			Message   struct{ Text string }
+			Locations []struct {
+				PhysicalLocation struct {
+					ArtifactLocation struct{ URI string }
+					Region           region
+				}
+			}
+		}
+	}
+}
+
+func Test(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "--@io_bazel_rules_go//go/config:nogo_sarif", "--output_groups=nogo_sarif", "//:lib"); err != nil {
+		t.Fatal(err)
+	}
+
+	bazelBin, err := filepath.EvalSymlinks("bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reports []string
+	err = filepath.Walk(bazelBin, func(path string, info os.FileInfo, err error) error {
+		if err == nil && strings.HasSuffix(path, ".nogo.sarif") {
+			reports = append(reports, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 {
+		t.Fatalf("got reports %q; want one report", reports)
+	}
+	data, err := ioutil.ReadFile(reports[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r report
+	if err := json.Unmarshal(data, &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Version != "2.1.0" || len(r.Runs) != 1 {
+		t.Fatalf("got version %q with %d runs; want 2.1.0 with one run", r.Version, len(r.Runs))
+	}
+	run := r.Runs[0]
+	if len(run.Tool.Driver.Rules) != 1 || run.Tool.Driver.Rules[0].ID != "nofoo" {
+		t.Fatalf("got rules %+v; want nofoo", run.Tool.Driver.Rules)
+	}
+	if got, want := run.Tool.Driver.Rules[0].ShortDescription.Text, "reports functions named Foo"; got != want {
+		t.Errorf("got description %q; want %q", got, want)
+	}
+	if len(run.Results) != 1 {
+		t.Fatalf("got %d results; want 1", len(run.Results))
+	}
+	result := run.Results[0]
+	if result.RuleID != "nofoo" || result.Level != "error" || result.Message.Text != "function named Foo" {
+		t.Errorf("got result %+v", result)
+	}
+	loc := result.Locations[0].PhysicalLocation
+	if loc.ArtifactLocation.URI != "lib.go" {
+		t.Errorf("got uri %q; want lib.go", loc.ArtifactLocation.URI)
+	}
+	// "/* é */ func " is 14 bytes, but 13 UTF-16 code units.
+	if want := (region{StartLine: 4, StartColumn: 14, EndLine: 4, EndColumn: 17}); !reflect.DeepEqual(loc.Region, want) {
+		t.Errorf("got region %+v; want %+v", loc.Region, want)
+	}
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scope_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_tool_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = [":nofoo"],
+    includes = ["//src/..."],
+    excludes = ["//src/third_party/..."],
+    exclude_tags = ["nonogo"],
+    visibility = ["//visibility:public"],
+)
+
+go_tool_library(
+    name = "nofoo",
+    srcs = ["nofoo.go"],
+    importpath = "nofoo",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+-- nofoo.go --
+package nofoo
+
+import (
+	"go/ast"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "nofoo",
+	Doc:  "reports functions named Foo",
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			for _, decl := range f.Decls {
+				if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "Foo" {
+					pass.Reportf(fn.Pos(), "function named Foo")
+				}
+			}
+		}
+		return nil, nil
+	},
+}
+
+-- src/lib/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test")
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_test(
+    name = "lib_test",
+    srcs = ["lib_test.go"],
+    gotags = ["nonogo"],
+)
+
+-- src/lib/lib.go --
+package lib
+
+func Foo() {}
+
+-- src/lib/lib_test.go --
+package lib
+
+import "testing"
+
+func Foo() {}
+
+func TestFoo(t *testing.T) {}
+
+-- src/third_party/dep/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "dep",
+    srcs = ["dep.go"],
+    importpath = "example.com/third_party/dep",
+)
+
+-- src/third_party/dep/dep.go --
+package dep
+
+func Foo() {}
+
+-- tools/BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "tools",
+    srcs = ["tools.go"],
+    importpath = "example.com/tools",
+)
+
+-- tools/tools.go --
+package tools
+
+func Foo() {}
+`,
+	})
+}
+
+func TestInScope(t *testing.T) {
+	err := bazel_testing.RunBazel("build", "//src/lib")
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	if !strings.Contains(err.Error(), "function named Foo") {
+		t.Errorf("did not find expected finding in:\n%v", err)
+	}
+}
+
+func TestOutOfScope(t *testing.T) {
+	for _, target := range []string{
+		"//src/third_party/dep", // excluded
+		"//tools",               // not included
+		"//src/lib:lib_test",    // excluded tag
+	} {
+		t.Run(target, func(t *testing.T) {
+			if err := bazel_testing.RunBazel("build", target); err != nil {
+				t.Fatal(err)
+			}
+			out, err := bazel_testing.BazelOutput("aquery", "mnemonic('GoNogo.*', deps("+target+", 1))")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Contains(string(out), "GoNogo") {
+				t.Errorf("nogo runs for %s:\n%s", target, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ssa_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Nogo: "@//:nogo",
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_tool_library", "nogo")
+
+nogo(
+    name = "nogo",
+    deps = [":taint"],
+    visibility = ["//visibility:public"],
+)
+
+go_tool_library(
+    name = "taint",
+    srcs = ["taint.go"],
+    importpath = "taint",
+    deps = [
+        "@io_bazel_rules_go//go/tools/nogo/ssasummary:go_tool_library",
+        "@org_golang_x_tools//go/analysis:go_tool_library",
+        "@org_golang_x_tools//go/analysis/passes/buildssa:go_tool_library",
+        "@org_golang_x_tools//go/ssa:go_tool_library",
+    ],
+)
+
+go_library(
+    name = "secret",
+    srcs = ["secret.go"],
+    importpath = "example.com/secret",
+)
+
+go_library(
+    name = "log",
+    srcs = ["log.go"],
+    importpath = "example.com/log",
+)
+
+go_library(
+    name = "util",
+    srcs = ["util.go"],
+    importpath = "example.com/util",
+    deps = [":log"],
+)
+
+go_library(
+    name = "safe",
+    srcs = ["safe.go"],
+    importpath = "example.com/safe",
+    deps = [
+        ":log",
+        ":secret",
+        ":util",
+    ],
+)
+
+go_library(
+    name = "leak",
+    srcs = ["leak.go"],
+    importpath = "example.com/leak",
+    deps = [
+        ":log",
+        ":secret",
+        ":util",
+    ],
+)
+
+-- taint.go --
+package taint
+
+import (
+	"go/types"
+
+	"github.com/bazelbuild/rules_go/go/tools/nogo/ssasummary"
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/buildssa"
+	"golang.org/x/tools/go/ssa"
+)
+
+const (
+	source = "example.com/secret.Get"
+	sink   = "example.com/log.Print"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name:     "taint",
+	Doc:      "reports secrets passed to log.Print",
+	Requires: []*analysis.Analyzer{buildssa.Analyzer, ssasummary.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	summaries := pass.ResultOf[ssasummary.Analyzer].(*ssasummary.Result)
+	for _, f := range pass.ResultOf[buildssa.Analyzer].(*buildssa.SSA).SrcFuncs {
+		for _, b := range f.Blocks {
+			for _, instr := range b.Instrs {
+				call, ok := instr.(*ssa.Call)
+				if !ok {
+					continue
+				}
+				name := calleeName(&call.Call)
+				for i, arg := range call.Call.Args {
+					if tainted(arg, summaries) && reaches(name, i, summaries, map[string]bool{}) {
+						pass.Reportf(call.Pos(), "secret passed to %s", sink)
+					}
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+func calleeName(call *ssa.CallCommon) string {
+	if f := call.StaticCallee(); f != nil {
+		if fn, ok := f.Object().(*types.Func); ok {
+			return fn.FullName()
+		}
+	}
+	return ""
+}
+
+// tainted reports whether v comes from the source, possibly through calls
+// to functions that return their arguments.
+func tainted(v ssa.Value, summaries *ssasummary.Result) bool {
+	call, ok := v.(*ssa.Call)
+	if !ok {
+		return false
+	}
+	name := calleeName(&call.Call)
+	if name == source {
+		return true
+	}
+	s := summaries.LookupName(name)
+	if s == nil {
+		return false
+	}
+	for _, f := range s.Flows {
+		if f.Result == 0 && tainted(call.Call.Args[f.Param], summaries) {
+			return true
+		}
+	}
+	return false
+}
+
+// reaches reports whether argument arg of the named function may be passed
+// to the sink.
+func reaches(name string, arg int, summaries *ssasummary.Result, seen map[string]bool) bool {
+	if name == sink {
+		return true
+	}
+	if seen[name] {
+		return false
+	}
+	seen[name] = true
+	s := summaries.LookupName(name)
+	if s == nil {
+		return false
+	}
+	for _, c := range s.Calls {
+		if c.Param == arg && reaches(c.Func, c.Arg, summaries, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+-- secret.go --
+package secret
+
+func Get() string { return "hunter2" }
+
+-- log.go --
+package log
+
+import "fmt"
+
+func Print(s string) { fmt.Println(s) }
+
+-- util.go --
+package util
+
+import "example.com/log"
+
+func Wrap(s string) string { return "[" + s + "]" }
+
+func Ignore(s string) string { return "redacted" }
+
+func Forward(s string) { log.Print(s) }
+
+func Count(s string) { _ = len(s) }
+
+-- safe.go --
+package safe
+
+import (
+	"example.com/log"
+	"example.com/secret"
+	"example.com/util"
+)
+
+func Safe() {
+	log.Print(util.Ignore(secret.Get()))
+	util.Count(secret.Get())
+	util.Forward(util.Ignore(secret.Get()))
+}
+
+-- leak.go --
+package leak
+
+import (
+	"example.com/log"
+	"example.com/secret"
+	"example.com/util"
+)
+
+func Direct() {
+	log.Print(secret.Get())
+}
+
+func Wrapped() {
+	log.Print(util.Wrap(secret.Get()))
+}
+
+func Forwarded() {
+	util.Forward(util.Wrap(secret.Get()))
+}
+`,
+	})
+}
+
+func TestSafe(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:safe"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLeak(t *testing.T) {
+	err := bazel_testing.RunBazel("build", "//:leak")
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	for _, line := range []string{"10", "14", "18"} {
+		re := regexp.MustCompile(`leak\.go:` + line + `:\d+: secret passed to example\.com/log\.Print`)
+		if !re.MatchString(err.Error()) {
+			t.Errorf("did not find finding on line %s in:\n%v", line, err)
+		}
+	}
+}
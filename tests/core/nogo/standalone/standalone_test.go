@@ -0,0 +1,196 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package standalone_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library", "go_test", "go_tool_library", "nogo", "nogo_test")
+
+nogo(
+    name = "nogo",
+    deps = [":badcall"],
+)
+
+go_tool_library(
+    name = "badcall",
+    srcs = ["badcall.go"],
+    importpath = "badcall",
+    deps = ["@org_golang_x_tools//go/analysis:go_tool_library"],
+)
+
+go_library(
+    name = "dep",
+    srcs = ["dep.go"],
+    importpath = "example.com/dep",
+)
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+    deps = [":dep"],
+)
+
+go_test(
+    name = "lib_test",
+    srcs = ["lib_test.go"],
+    deps = [
+        ":dep",
+        ":lib",
+    ],
+)
+
+go_library(
+    name = "clean",
+    srcs = ["clean.go"],
+    importpath = "example.com/clean",
+    deps = [":dep"],
+)
+
+nogo_test(
+    name = "lib_nogo_test",
+    nogo = ":nogo",
+    deps = [
+        ":lib",
+        ":lib_test",
+    ],
+)
+
+nogo_test(
+    name = "clean_nogo_test",
+    nogo = ":nogo",
+    deps = [":clean"],
+)
+
+-- badcall.go --
+package badcall
+
+import (
+	"go/ast"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+type isBad struct{}
+
+func (*isBad) AFact() {}
+
+var Analyzer = &analysis.Analyzer{
+	Name:      "badcall",
+	Doc:       "reports calls to functions named Bad in other packages",
+	FactTypes: []analysis.Fact{new(isBad)},
+	Run: func(pass *analysis.Pass) (interface{}, error) {
+		for _, f := range pass.Files {
+			ast.Inspect(f, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.FuncDecl:
+					if strings.HasPrefix(n.Name.Name, "Bad") {
+						pass.ExportObjectFact(pass.TypesInfo.Defs[n.Name], new(isBad))
+					}
+				case *ast.SelectorExpr:
+					fn, ok := pass.TypesInfo.Uses[n.Sel].(*types.Func)
+					if ok && fn.Pkg() != pass.Pkg && pass.ImportObjectFact(fn, new(isBad)) {
+						pass.Reportf(n.Pos(), "call to bad function %s", fn.Name())
+					}
+				}
+				return true
+			})
+		}
+		return nil, nil
+	},
+}
+
+-- dep.go --
+package dep
+
+func BadDep() {}
+
+func GoodDep() {}
+
+-- lib.go --
+package lib
+
+import "example.com/dep"
+
+func Lib() {
+	dep.BadDep()
+}
+
+-- lib_test.go --
+package lib_test
+
+import (
+	"testing"
+
+	"example.com/dep"
+	_ "example.com/lib"
+)
+
+func TestLib(t *testing.T) {
+	dep.BadDep()
+}
+
+-- clean.go --
+package clean
+
+import "example.com/dep"
+
+func Clean() {
+	dep.GoodDep()
+}
+`,
+	})
+}
+
+func TestBuildWithoutNogo(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "//:lib", "//:lib_test"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindings(t *testing.T) {
+	cmd := bazel_testing.BazelCmd("test", "--test_output=errors", "//:lib_nogo_test")
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+	if err := cmd.Run(); err == nil {
+		t.Fatal("unexpected success")
+	}
+	for _, want := range []string{
+		"lib.go:6:2: call to bad function BadDep",
+		"lib_test.go:11:2: call to bad function BadDep",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("did not find %q in output:\n%s", want, out)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "//:clean_nogo_test"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package action_metadata_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
+
+go_library(
+    name = "lib",
+    srcs = [
+        "lib.go",
+        "lib_other.go",
+    ],
+    importpath = "example.com/lib",
+)
+
+go_library(
+    name = "unused",
+    srcs = ["unused.go"],
+    importpath = "example.com/unused",
+)
+
+go_binary(
+    name = "bin",
+    srcs = ["bin.go"],
+    deps = [
+        ":lib",
+        ":unused",
+    ],
+)
+
+-- lib.go --
+package lib
+
+func F() {}
+
+-- lib_other.go --
+// +build ignore
+
+package lib
+
+-- unused.go --
+package unused
+
+-- bin.go --
+package main
+
+import "example.com/lib"
+
+func main() {
+	lib.F()
+}
+`,
+	})
+}
+
+type actionMetadata struct {
+	Mnemonic    string
+	ImportPath  string
+	PackagePath string
+	Inputs      map[string]int
+	Outputs     map[string]int64
+}
+
+func TestActionMetadata(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "--@io_bazel_rules_go//go/config:action_metadata", "--output_groups=go_action_metadata", "//:bin"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := bazel_testing.BazelOutput("info", "--@io_bazel_rules_go//go/config:action_metadata", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bin := strings.TrimSpace(string(out))
+
+	read := func(name string) actionMetadata {
+		t.Helper()
+		data, err := ioutil.ReadFile(filepath.Join(bin, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m actionMetadata
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	lib := read("lib.meta.json")
+	if lib.Mnemonic != "GoCompilePkg" || lib.ImportPath != "example.com/lib" {
+		t.Errorf("lib: unexpected metadata: %#v", lib)
+	}
+	if lib.Inputs["srcs"] != 2 || lib.Inputs["go"] != 1 {
+		t.Errorf("lib: got inputs %v; want 2 srcs, 1 go file", lib.Inputs)
+	}
+	if lib.Outputs["archive"] <= 0 {
+		t.Errorf("lib: got outputs %v; want archive size", lib.Outputs)
+	}
+
+	link := read("bin.link.meta.json")
+	if link.Mnemonic != "GoLink" {
+		t.Errorf("bin: got mnemonic %q; want GoLink", link.Mnemonic)
+	}
+	// The unused library is a dependency, but bin doesn't import it.
+	if link.Inputs["archives"] != 2 || link.Inputs["linked_archives"] != 1 {
+		t.Errorf("bin: got inputs %v; want 2 archives, 1 linked", link.Inputs)
+	}
+	if link.Outputs["executable"] <= 0 {
+		t.Errorf("bin: got outputs %v; want executable size", link.Outputs)
+	}
+}
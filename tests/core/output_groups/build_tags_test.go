@@ -0,0 +1,150 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package build_tags_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_library")
+
+go_library(
+    name = "lib",
+    srcs = [
+        "lib.go",
+        "lib_plan9.go",
+        "tagged.go",
+        "untagged.go",
+    ],
+    importpath = "example.com/lib",
+)
+
+-- lib.go --
+package lib
+
+-- lib_plan9.go --
+package lib
+
+-- tagged.go --
+// +build foo
+
+package lib
+
+const Tagged = true
+
+-- untagged.go --
+// +build !foo
+
+package lib
+
+const Tagged = false
+`,
+	})
+}
+
+type report struct {
+	Label string
+	Tags  []string
+	Files []struct {
+		Path     string
+		Included bool
+		Reason   string
+	}
+}
+
+func TestBuildTags(t *testing.T) {
+	build := func(args ...string) (string, report) {
+		t.Helper()
+		args = append([]string{"build", "--output_groups=go_build_tags"}, args...)
+		if err := bazel_testing.RunBazel(append(args, "//:lib")...); err != nil {
+			t.Fatal(err)
+		}
+		path, err := filepath.EvalSymlinks("bazel-bin/lib.build_tags.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r report
+		if err := json.Unmarshal(data, &r); err != nil {
+			t.Fatal(err)
+		}
+		return string(data), r
+	}
+
+	before, r := build()
+	if r.Label != "//:lib" {
+		t.Errorf("got label %q; want //:lib", r.Label)
+	}
+	included := make(map[string]bool)
+	for _, f := range r.Files {
+		included[f.Path] = f.Included
+		if !f.Included && f.Reason == "" {
+			t.Errorf("%s: excluded without a reason", f.Path)
+		}
+	}
+	want := map[string]bool{"lib.go": true, "lib_plan9.go": false, "tagged.go": false, "untagged.go": true}
+	for path, inc := range want {
+		if got, ok := included[path]; !ok || got != inc {
+			t.Errorf("%s: got included=%v (present=%v); want %v", path, got, ok, inc)
+		}
+	}
+
+	beforeDir, err := ioutil.TempDir("", "build_tags_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(beforeDir)
+	if err := ioutil.WriteFile(filepath.Join(beforeDir, "lib.build_tags.json"), []byte(before), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	_, r = build("--@io_bazel_rules_go//go/config:tags=foo")
+	hasFoo := false
+	for _, tag := range r.Tags {
+		hasFoo = hasFoo || tag == "foo"
+	}
+	if !hasFoo {
+		t.Errorf("got tags %q; want foo", r.Tags)
+	}
+
+	out, err := bazel_testing.BazelOutput("run", "@io_bazel_rules_go//go/tools/build_tags:diff", "--", beforeDir, "bazel-bin")
+	if err == nil {
+		t.Fatal("diff: got success; want differences")
+	}
+	for _, line := range []string{
+		"//:lib",
+		"tags: +foo",
+		"tagged.go: excluded: build constraints not satisfied: // +build foo -> included",
+		"untagged.go: included -> excluded: build constraints not satisfied: // +build !foo",
+	} {
+		if !strings.Contains(string(out), line) {
+			t.Errorf("diff output does not contain %q:\n%s", line, out)
+		}
+	}
+}
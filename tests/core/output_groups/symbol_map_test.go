@@ -0,0 +1,135 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package symbol_map_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_library")
+
+go_library(
+    name = "lib",
+    srcs = ["lib.go"],
+    importpath = "example.com/lib",
+)
+
+go_binary(
+    name = "bin",
+    srcs = ["bin.go"],
+    deps = [":lib"],
+)
+
+-- lib.go --
+package lib
+
+import "fmt"
+
+func Used() {
+	fmt.Println("used")
+}
+
+func Unused() {
+	fmt.Println("unused")
+}
+
+-- bin.go --
+package main
+
+import "example.com/lib"
+
+func main() {
+	lib.Used()
+}
+`,
+	})
+}
+
+type symbolPackage struct {
+	ImportPath string
+	Label      string
+	Std        bool
+	Functions  []string
+}
+
+func TestSymbolMap(t *testing.T) {
+	if err := bazel_testing.RunBazel("build", "--output_groups=go_symbol_map", "//:bin"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := bazel_testing.BazelOutput("info", "bazel-bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(strings.TrimSpace(string(out)), "bin.symbols.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		GoVersion string `json:"go_version"`
+		Packages  []symbolPackage
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(m.GoVersion, "go1.") {
+		t.Errorf("got go_version %q; want a Go release", m.GoVersion)
+	}
+
+	pkgs := make(map[string]symbolPackage)
+	var mainPkg symbolPackage
+	for _, p := range m.Packages {
+		pkgs[p.ImportPath] = p
+		if p.Label == "//:bin" {
+			mainPkg = p
+		}
+	}
+	has := func(p symbolPackage, fn string) bool {
+		for _, f := range p.Functions {
+			if f == fn {
+				return true
+			}
+		}
+		return false
+	}
+	if lib, ok := pkgs["example.com/lib"]; !ok {
+		t.Error("example.com/lib not found")
+	} else {
+		if lib.Label != "//:lib" {
+			t.Errorf("example.com/lib: got label %q; want //:lib", lib.Label)
+		}
+		if !has(lib, "Used") {
+			t.Errorf("example.com/lib: Used not found in %v", lib.Functions)
+		}
+		if has(lib, "Unused") {
+			t.Errorf("example.com/lib: Unused was not expected in %v", lib.Functions)
+		}
+	}
+	if !has(mainPkg, "main") {
+		t.Errorf("main package: main not found in %v", mainPkg.Functions)
+	}
+	if fmt, ok := pkgs["fmt"]; !ok || !fmt.Std || !has(fmt, "Println") {
+		t.Errorf("fmt: got %#v; want standard library package with Println", fmt)
+	}
+}
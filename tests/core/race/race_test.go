@@ -15,9 +15,11 @@
 package race_test
 
 import (
+	"archive/zip"
 	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os/exec"
 	"runtime"
 	"strings"
@@ -299,3 +301,37 @@ func Test(t *testing.T) {
 		})
 	}
 }
+
+func TestRaceReportOutput(t *testing.T) {
+	// The race detector exits successfully with this setting, so the wrapper
+	// must notice the report.
+	err := bazel_testing.RunBazel("test", "--test_env=GORACE=exitcode=0", "--test_arg=-wantrace=true", "//:racy_test_race_mode")
+	if err == nil {
+		t.Fatal("test with a data race did not fail")
+	}
+
+	r, err := zip.OpenReader("bazel-testlogs/racy_test_race_mode/test.outputs/outputs.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	for _, f := range r.File {
+		if f.Name != "race_reports.txt" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(data, []byte("WARNING: DATA RACE")) {
+			t.Errorf("race_reports.txt does not contain a report:\n%s", data)
+		}
+		return
+	}
+	t.Error("race_reports.txt not found in test outputs")
+}
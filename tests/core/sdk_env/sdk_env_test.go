@@ -0,0 +1,113 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdk_env_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "env_test",
+    srcs = ["env_test.go"],
+)
+
+go_test(
+    name = "cgo_test",
+    srcs = ["cgo_test.go"],
+    cgo = True,
+)
+
+-- env_test.go --
+package env_test
+
+import (
+	"os"
+	"testing"
+)
+
+func Test(t *testing.T) {
+	if got, want := os.Getenv("SDK_ENV_TEST"), "from_sdk"; got != want {
+		t.Errorf("SDK_ENV_TEST: got %q; want %q", got, want)
+	}
+}
+
+-- cgo_test.go --
+package cgo_test
+
+/*
+#ifndef FROM_SDK_ENV
+#error FROM_SDK_ENV is not defined
+#endif
+static int value() { return FROM_SDK_ENV; }
+*/
+import "C"
+
+import "testing"
+
+func Test(t *testing.T) {
+	if got := C.value(); got != 42 {
+		t.Errorf("got %d; want 42", got)
+	}
+}
+`,
+	})
+}
+
+const wrapSDK = `go_wrap_sdk(
+    name = "go_sdk",
+    root_file = "@local_go_sdk//:ROOT",
+)`
+
+const wrapSDKWithEnv = `go_wrap_sdk(
+    name = "go_sdk",
+    root_file = "@local_go_sdk//:ROOT",
+    env = {
+        "SDK_ENV_TEST": "from_sdk",
+        "CGO_CPPFLAGS": "-DFROM_SDK_ENV=42",
+    },
+)`
+
+func Test(t *testing.T) {
+	origWorkspaceData, err := ioutil.ReadFile("WORKSPACE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(origWorkspaceData, []byte(wrapSDK)) {
+		t.Fatalf("could not find go_wrap_sdk in WORKSPACE")
+	}
+	workspaceData := bytes.Replace(origWorkspaceData, []byte(wrapSDK), []byte(wrapSDKWithEnv), 1)
+	if err := ioutil.WriteFile("WORKSPACE", workspaceData, 0666); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := ioutil.WriteFile("WORKSPACE", origWorkspaceData, 0666); err != nil {
+			t.Errorf("error restoring WORKSPACE: %v", err)
+		}
+	}()
+
+	if err := bazel_testing.RunBazel("test", "//:env_test", "//:cgo_test"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sdk_version_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_test")
+
+go_test(
+    name = "version_test",
+    srcs = ["version_test.go"],
+)
+
+go_test(
+    name = "go113_test",
+    srcs = ["version_test.go"],
+    args = ["-version=go1.13"],
+    go_version = "1.13",
+)
+
+-- version_test.go --
+package version_test
+
+import (
+	"flag"
+	"runtime"
+	"testing"
+)
+
+var want = flag.String("version", "", "")
+
+func Test(t *testing.T) {
+	if *want == "" {
+		return
+	}
+	if v := runtime.Version(); v != *want {
+		t.Errorf("got version %q; want %q", v, *want)
+	}
+}
+`,
+		WorkspaceSuffix: `
+load("@io_bazel_rules_go//go:deps.bzl", "go_download_sdk")
+
+go_download_sdk(
+    name = "go_sdk_1_13",
+    version = "1.13",
+)
+`,
+	})
+}
+
+func Test(t *testing.T) {
+	out, err := bazel_testing.BazelOutput("info", "release")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var major, minor int
+	if _, err := fmt.Sscanf(strings.TrimSpace(string(out)), "release %d.%d", &major, &minor); err != nil {
+		t.Skipf("can't parse Bazel version %q", out)
+	}
+	if major < 5 {
+		t.Skipf("selecting SDKs by version requires Bazel 5.0 or later; got %d.%d", major, minor)
+	}
+
+	t.Run("attribute", func(t *testing.T) {
+		if err := bazel_testing.RunBazel("test", "//:go113_test"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("flag", func(t *testing.T) {
+		if err := bazel_testing.RunBazel(
+			"test",
+			"--@io_bazel_rules_go//go/toolchain:sdk_version=1.13",
+			"--test_arg=-version=go1.13",
+			"//:version_test",
+		); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
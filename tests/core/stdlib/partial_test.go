@@ -0,0 +1,88 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package partial_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "fmt_bin",
+    srcs = ["fmt_bin.go"],
+)
+
+go_binary(
+    name = "http_bin",
+    srcs = ["http_bin.go"],
+)
+
+-- fmt_bin.go --
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println("hello")
+}
+
+-- http_bin.go --
+package main
+
+import "net/http"
+
+func main() {
+	http.ListenAndServe(":0", nil)
+}
+`,
+	})
+}
+
+// The precompiled standard library is never used in pure mode, so these
+// builds always compile it.
+var partialArgs = []string{
+	"--@io_bazel_rules_go//go/config:pure",
+	"--@io_bazel_rules_go//go/config:stdlib_packages=fmt",
+}
+
+func TestIncluded(t *testing.T) {
+	args := append([]string{"run"}, partialArgs...)
+	out, err := bazel_testing.BazelOutput(append(args, "//:fmt_bin")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "hello" {
+		t.Errorf("got %q; want %q", got, "hello")
+	}
+}
+
+func TestMissing(t *testing.T) {
+	args := append([]string{"build"}, partialArgs...)
+	err := bazel_testing.RunBazel(append(args, "//:http_bin")...)
+	if err == nil {
+		t.Fatal("unexpected success")
+	}
+	if want := `standard library package "net/http" was not built for this configuration`; !strings.Contains(err.Error(), want) {
+		t.Errorf("got error:\n%v\nwant it to contain %q", err, want)
+	}
+}
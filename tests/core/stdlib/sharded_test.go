@@ -0,0 +1,80 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sharded_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@io_bazel_rules_go//go:def.bzl", "go_binary")
+
+go_binary(
+    name = "http_bin",
+    srcs = ["http_bin.go"],
+)
+
+-- http_bin.go --
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func main() {
+	fmt.Println(http.StatusText(http.StatusTeapot))
+}
+`,
+	})
+}
+
+// The precompiled standard library is never used in pure mode, so these
+// builds always compile it.
+var shardedArgs = []string{
+	"--@io_bazel_rules_go//go/config:pure",
+	"--@io_bazel_rules_go//go/config:stdlib_shards=3",
+}
+
+func TestShardActions(t *testing.T) {
+	args := append([]string{"aquery"}, shardedArgs...)
+	out, err := bazel_testing.BazelOutput(append(args, "deps(//:http_bin)")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(out), "Mnemonic: GoStdlib\n"); n != 3 {
+		t.Errorf("got %d GoStdlib actions; want 3:\n%s", n, out)
+	}
+	if n := strings.Count(string(out), "Mnemonic: GoStdlibMerge\n"); n != 1 {
+		t.Errorf("got %d GoStdlibMerge actions; want 1:\n%s", n, out)
+	}
+}
+
+func TestShardedRun(t *testing.T) {
+	args := append([]string{"run"}, shardedArgs...)
+	out, err := bazel_testing.BazelOutput(append(args, "//:http_bin")...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.TrimSpace(string(out)), "I'm a teapot"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package custom_settings_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bazelbuild/rules_go/go/tools/bazel_testing"
+)
+
+func TestMain(m *testing.M) {
+	bazel_testing.TestMain(m, bazel_testing.Args{
+		Main: `
+-- BUILD.bazel --
+load("@bazel_skylib//rules:common_settings.bzl", "bool_flag", "string_flag")
+load("@io_bazel_rules_go//go:def.bzl", "go_binary", "go_custom_settings", "go_reset_target")
+
+bool_flag(
+    name = "fancy",
+    build_setting_default = False,
+)
+
+string_flag(
+    name = "db",
+    build_setting_default = "",
+)
+
+go_custom_settings(
+    name = "settings",
+    tags = {
+        ":fancy": "fancy",
+        ":db": "db_{value}",
+    },
+)
+
+go_binary(
+    name = "print",
+    srcs = [
+        "db_none.go",
+        "db_postgres.go",
+        "fancy.go",
+        "main.go",
+        "plain.go",
+    ],
+)
+
+go_binary(
+    name = "print_pure",
+    srcs = [
+        "db_none.go",
+        "db_postgres.go",
+        "fancy.go",
+        "main.go",
+        "plain.go",
+    ],
+    pure = "on",
+)
+
+go_reset_target(
+    name = "print_reset",
+    dep = ":print",
+)
+
+-- main.go --
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Println(style, db)
+}
+
+-- fancy.go --
+// +build fancy
+
+package main
+
+const style = "fancy"
+
+-- plain.go --
+// +build !fancy
+
+package main
+
+const style = "plain"
+
+-- db_postgres.go --
+// +build db_postgres
+
+package main
+
+const db = "postgres"
+
+-- db_none.go --
+// +build !db_postgres
+
+package main
+
+const db = "none"
+`,
+	})
+}
+
+func TestCustomSettings(t *testing.T) {
+	for _, test := range []struct {
+		desc, target string
+		args         []string
+		want         string
+	}{
+		{
+			desc:   "unregistered",
+			target: "//:print",
+			args:   []string{"--//:fancy", "--//:db=postgres"},
+			want:   "plain none",
+		}, {
+			desc:   "defaults",
+			target: "//:print",
+			args:   []string{"--@io_bazel_rules_go//go/config:custom_settings=//:settings"},
+			want:   "plain none",
+		}, {
+			desc:   "set",
+			target: "//:print",
+			args:   []string{"--@io_bazel_rules_go//go/config:custom_settings=//:settings", "--//:fancy", "--//:db=postgres"},
+			want:   "fancy postgres",
+		}, {
+			desc:   "transition",
+			target: "//:print_pure",
+			args:   []string{"--@io_bazel_rules_go//go/config:custom_settings=//:settings", "--//:fancy"},
+			want:   "fancy none",
+		}, {
+			desc:   "reset",
+			target: "//:print_reset",
+			args:   []string{"--@io_bazel_rules_go//go/config:custom_settings=//:settings", "--//:fancy", "--//:db=postgres"},
+			want:   "plain none",
+		},
+	} {
+		t.Run(test.desc, func(t *testing.T) {
+			args := append([]string{"run"}, test.args...)
+			args = append(args, test.target)
+			out, err := bazel_testing.BazelOutput(args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := string(bytes.TrimSpace(out)); got != test.want {
+				t.Errorf("got %q; want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -42,6 +42,17 @@ go_test(
         "github.com/bazelbuild/rules_go/examples/stamped_bin/stamp.BUILD_TIMESTAMP": "{BUILD_TIMESTAMP}",
         "github.com/bazelbuild/rules_go/examples/stamped_bin/stamp.PassIfEmpty": "",
         "github.com/bazelbuild/rules_go/examples/stamped_bin/stamp.XdefInvalid": "{Undefined_Var}",  # undefined should leave the var alone
+        "github.com/bazelbuild/rules_go/examples/stamped_bin/stamp.XdefDefault": "{Undefined_Var|dev}",  # undefined should use the default
+    },
+    deps = [":stamp"],
+)
+
+go_test(
+    name = "unstamped_default",
+    size = "small",
+    srcs = ["unstamped_default_test.go"],
+    x_defs = {
+        "github.com/bazelbuild/rules_go/examples/stamped_bin/stamp.XdefDefault": "{BUILD_TIMESTAMP|dev}",  # without --stamp, should use the default
     },
     deps = [":stamp"],
 )
@@ -60,6 +71,9 @@ var XdefBuildTimestamp = ""
 // an xdef with a missing key should leave this alone
 var XdefInvalid = "pass"
 
+// an xdef with a missing key and a default should set this to the default
+var XdefDefault = "fail"
+
 -- stamped_bin_test.go --
 package stamped_bin_test
 
@@ -85,6 +99,24 @@ func TestStampedBin(t *testing.T) {
 	if stamp.XdefInvalid != "pass" {
 		t.Errorf("Expected XdefInvalid to have been left alone, got %s.", stamp.XdefInvalid)
 	}
+	if stamp.XdefDefault != "dev" {
+		t.Errorf("Expected XdefDefault to have been set to 'dev', got %s.", stamp.XdefDefault)
+	}
+}
+
+-- unstamped_default_test.go --
+package unstamped_default_test
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/rules_go/examples/stamped_bin/stamp"
+)
+
+func TestUnstampedDefault(t *testing.T) {
+	if stamp.XdefDefault != "dev" {
+		t.Errorf("Expected XdefDefault to have been set to 'dev', got %s.", stamp.XdefDefault)
+	}
 }
 
 `
@@ -96,13 +128,13 @@ func TestMain(m *testing.M) {
 }
 
 func TestBuild(t *testing.T) {
-	if err := bazel_testing.RunBazel("test", "--stamp", ":all"); err != nil {
+	if err := bazel_testing.RunBazel("test", "--stamp", ":stamp_with_x_defs"); err != nil {
 		t.Fatal(err)
 	}
 }
 
 func TestBuildWithoutStamp(t *testing.T) {
-	if err := bazel_testing.RunBazel("test", "--nostamp", ":all"); err != nil {
+	if err := bazel_testing.RunBazel("test", "--nostamp", ":stamp_with_x_defs"); err != nil {
 		if eErr, ok := err.(*bazel_testing.StderrExitError); ok {
 			if eErr.Err.ExitCode() == 3 { // 3 is TEST_FAILED bazel exit code
 				return
@@ -113,3 +145,9 @@ func TestBuildWithoutStamp(t *testing.T) {
 	}
 	t.Fatal("expected error")
 }
+
+func TestDefaultWithoutStamp(t *testing.T) {
+	if err := bazel_testing.RunBazel("test", "--nostamp", ":unstamped_default"); err != nil {
+		t.Fatal(err)
+	}
+}